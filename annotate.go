@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+type annotateOpts struct {
+	at           string
+	by           string
+	control      string
+	controlCA    string
+	controlCert  string
+	controlKey   string
+	controlToken string
+}
+
+func annotateCmd() command {
+	fs := flag.NewFlagSet("korra annotate", flag.ExitOnError)
+	opts := &annotateOpts{}
+
+	fs.StringVar(&opts.at, "at", "", "Time the annotation marks, as RFC 3339; now if not given")
+	fs.StringVar(&opts.by, "by", "", "Who or what is annotating, like a deploy job; the control API names the caller's address if not given")
+	fs.StringVar(&opts.control, "control", "", "Address (host:port) of the running attack's control API, as given to sessions with -control")
+	fs.StringVar(&opts.controlCA, "control-ca", "", "CA certificate file to verify a control API served with TLS by")
+	fs.StringVar(&opts.controlCert, "control-cert", "", "Certificate file to present to a control API requiring client certificates, with -control-key")
+	fs.StringVar(&opts.controlKey, "control-key", "", "Private key file for -control-cert")
+	fs.StringVar(&opts.controlToken, "control-token", "", "Bearer token the control API requires, as given to sessions with -control-token")
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		return annotate(opts, strings.Join(fs.Args(), " "))
+	}}
+}
+
+var (
+	errNoAnnotation = errors.New("give the text to annotate the attack with, like: korra annotate -control=localhost:9911 deployed v2.3")
+	errNoControl    = errors.New("give the address of the attack's control API with -control")
+)
+
+// annotate marks a running attack with the text through its control API,
+// so reports on it show the moment against its results
+func annotate(opts *annotateOpts, text string) error {
+	if opts.control == "" {
+		return errNoControl
+	}
+	if strings.TrimSpace(text) == "" {
+		return errNoAnnotation
+	}
+	req := annotationRequest{Text: text, By: opts.by}
+	if opts.at != "" {
+		at, err := time.Parse(time.RFC3339, opts.at)
+		if err != nil {
+			return fmt.Errorf("bad -at: %s", err)
+		}
+		req.Timestamp = at
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	client, scheme := &http.Client{Timeout: 10 * time.Second}, "http"
+	if opts.controlCA != "" || opts.controlCert != "" {
+		tlsc, err := korra.ControlClientTLS(opts.controlCert, opts.controlKey, opts.controlCA)
+		if err != nil {
+			return fmt.Errorf("error setting up TLS for the control API: %s", err)
+		}
+		client.Transport, scheme = &http.Transport{TLSClientConfig: tlsc}, "https"
+	}
+	post, err := http.NewRequest("POST", fmt.Sprintf("%s://%s/annotations", scheme, opts.control), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	post.Header.Set("Content-Type", "application/json")
+	if opts.controlToken != "" {
+		post.Header.Set("Authorization", "Bearer "+opts.controlToken)
+	}
+	resp, err := client.Do(post)
+	if err != nil {
+		return fmt.Errorf("error annotating through %s: %s", opts.control, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		reason, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("error annotating through %s: %s %s", opts.control, resp.Status, strings.TrimSpace(string(reason)))
+	}
+	var added korra.Annotation
+	if err = json.NewDecoder(resp.Body).Decode(&added); err != nil {
+		return err
+	}
+	fmt.Printf("Annotated %s\n", added)
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+type bundleOpts struct {
+	dir    string
+	keygen string
+	out    string
+	sign   string
+}
+
+func bundleCmd() command {
+	fs := flag.NewFlagSet("korra bundle", flag.ExitOnError)
+	opts := &bundleOpts{}
+	fs.StringVar(&opts.dir, "dir", ".", "Directory of sessions to bundle, with their feeds, certificates and configuration")
+	fs.StringVar(&opts.keygen, "keygen", "", "Instead of bundling, write a new signing key to this name with .key added, and its public half with .pub")
+	fs.StringVar(&opts.out, "out", "", "Bundle file to write, ending in .kor; the directory's name with .kor if not given")
+	fs.StringVar(&opts.sign, "sign", "", "Ed25519 private key file (PEM) to sign the bundle with")
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		if opts.keygen != "" {
+			return bundleKeygen(opts.keygen)
+		}
+		return bundle(opts)
+	}}
+}
+
+var errBundleExt = errors.New("give -out a name ending in " + korra.BundleExt + ", so commands know it's a bundle")
+
+// bundle packs the directory of sessions into a single file, to version and
+// hand to every host running them
+func bundle(opts *bundleOpts) error {
+	out := opts.out
+	if out == "" {
+		out = strings.TrimSuffix(strings.TrimSuffix(opts.dir, "/"), string(os.PathSeparator)) + korra.BundleExt
+	}
+	if !korra.IsBundle(out) {
+		return errBundleExt
+	}
+	var key ed25519.PrivateKey
+	if opts.sign != "" {
+		private, _, err := korra.ReadBundleKey(opts.sign)
+		if err != nil {
+			return fmt.Errorf("bad -sign: %s", err)
+		}
+		if private == nil {
+			return fmt.Errorf("bad -sign: %s is a public key, sign with its private half", opts.sign)
+		}
+		key = private
+	}
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	manifest, err := korra.WriteBundle(file, opts.dir, key)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out)
+		return err
+	}
+	signed := "unsigned"
+	if key != nil {
+		signed = "signed"
+	}
+	fmt.Printf("Bundled %d files from %s into %s, %s\n", len(manifest.Files), opts.dir, out, signed)
+	return nil
+}
+
+// bundleKeygen writes a new key pair to sign and check bundles with
+func bundleKeygen(name string) error {
+	private, public, err := korra.GenerateBundleKeys()
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(name+".key", private, 0600); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(name+".pub", public, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Sign bundles with -sign=%s.key, and check them with sessions -bundle-key=%s.pub\n", name, name)
+	return nil
+}
+
+// extractBundle checks the bundle of sessions named by -dir and unpacks it
+// next to itself, into the directory of its name without .kor, which the
+// sessions then run from
+func extractBundle(opts *sessionsOpts, log chan string) error {
+	var key ed25519.PublicKey
+	if opts.bundleKey != "" {
+		_, public, err := korra.ReadBundleKey(opts.bundleKey)
+		if err != nil {
+			return fmt.Errorf("bad -bundle-key: %s", err)
+		}
+		key = public
+	}
+	dir := strings.TrimSuffix(opts.sessiond, korra.BundleExt)
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("%s is in the way of bundle %s; remove it, or run the sessions in it with -dir=%s", dir, opts.sessiond, dir)
+	}
+	in, err := os.Open(opts.sessiond)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	manifest, signed, err := korra.ExtractBundle(in, dir, key)
+	if err != nil {
+		return fmt.Errorf("bad bundle %s: %s", opts.sessiond, err)
+	}
+	checked := "unsigned"
+	switch {
+	case key != nil:
+		checked = "signature checked"
+	case signed:
+		checked = "signed, but not checked without -bundle-key"
+	}
+	log <- fmt.Sprintf("Bundle %s of %d files, made %s by korra %s (%s), extracted to %s",
+		opts.sessiond, len(manifest.Files), manifest.Created.Format(time.RFC3339), manifest.Korra, checked, dir)
+	opts.sessiond = dir
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+// applyConfig sets the command's flags from the options in the config file
+// for the profile, leaving those given on the command line as they are.
+// Without a file korra.yaml is read, if it's there. With secrets, the
+// file's secret options are resolved first, and the ${secrets.name}
+// references in its other options filled in with them.
+func applyConfig(fs *flag.FlagSet, file, profile string, secrets *korra.Secrets) error {
+	if file == "" {
+		if _, err := os.Stat(korra.ConfigFile); err != nil {
+			if profile != "" {
+				return fmt.Errorf("no %s for -profile=%s; give the file with -config", korra.ConfigFile, profile)
+			}
+			return nil
+		}
+		file = korra.ConfigFile
+	}
+	in, err := korra.File(file, false)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %s", file, err)
+	}
+	config, err := korra.ReadConfig(in)
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("bad config %s: %s", file, err)
+	}
+	options, err := config.Options(profile)
+	if err != nil {
+		return fmt.Errorf("bad -profile: %s in %s", err, file)
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "secret") != (names[j] == "secret") {
+			return names[i] == "secret"
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		if name == "config" || name == "profile" || fs.Lookup(name) == nil {
+			return fmt.Errorf("bad config %s: %s isn't an option of %s", file, name, fs.Name())
+		}
+		if given[name] {
+			continue
+		}
+		for _, value := range options[name] {
+			if secrets != nil {
+				if value, err = secrets.Expand(value); err != nil {
+					return fmt.Errorf("bad config %s: bad %s: %s", file, name, err)
+				}
+			}
+			if err = fs.Set(name, value); err != nil {
+				return fmt.Errorf("bad config %s: bad %s %q: %s", file, name, secrets.Redact(value), secrets.Redact(err.Error()))
+			}
+		}
+	}
+	return nil
+}
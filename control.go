@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+// attackProgress sums up how far along all the sessions of an attack are
+type attackProgress struct {
+	Elapsed      time.Duration `json:"elapsed_ns"`
+	Paused       bool          `json:"paused"`
+	Actions      int           `json:"actions"`
+	ActionsDone  int           `json:"actions_done"`
+	Sessions     int           `json:"sessions"`
+	SessionsDone int           `json:"sessions_done"`
+}
+
+func progressOf(sessions []*korra.Session, gate *korra.Gate, startTime time.Time) attackProgress {
+	p := attackProgress{Elapsed: time.Since(startTime), Paused: gate.Paused(), Sessions: len(sessions)}
+	for _, session := range sessions {
+		progress := session.Progress()
+		p.Actions += progress.Actions
+		p.ActionsDone += progress.Current
+		if progress.Complete {
+			p.SessionsDone += 1
+		}
+	}
+	return p
+}
+
+func (p attackProgress) String() string {
+	paused := ""
+	if p.Paused {
+		paused = " PAUSED"
+	}
+	return fmt.Sprintf("Elapsed %s%s: %d/%d actions complete (%.2f%%); %d/%d sessions complete (%.2f%%)",
+		p.Elapsed, paused,
+		p.ActionsDone, p.Actions, (float32(p.ActionsDone)/float32(p.Actions))*100,
+		p.SessionsDone, p.Sessions, (float32(p.SessionsDone)/float32(p.Sessions))*100)
+}
+
+// setPaused pauses or resumes the gate and logs who asked for it, returning
+// false if it was already in that state
+func setPaused(gate *korra.Gate, paused bool, by string, log chan string) bool {
+	if paused && gate.Pause() {
+		log <- fmt.Sprintf("Paused by %s, sessions will wait before their next request", by)
+		return true
+	} else if !paused && gate.Resume() {
+		log <- fmt.Sprintf("Resumed by %s", by)
+		return true
+	}
+	return false
+}
+
+// control is the HTTP API for steering a running attack
+type control struct {
+	gate     *korra.Gate
+	log      chan string
+	progress func() attackProgress
+	snapshot func() []byte             // the latest snapshot report, nil if there isn't one
+	notes    *korra.AnnotationLog      // the attack's annotations, which POST /annotations adds to
+	sessions map[string]*korra.Session // each session recording results, by its name
+	token    string                    // every request must carry as a bearer token, if any
+	tls      *tls.Config               // to serve with, if any, which may require client certificates
+}
+
+// serveControl starts serving the control API on the address, with:
+//
+//	GET  /status       the attack's progress as JSON
+//	GET  /snapshot     the latest snapshot report, with -snapshot
+//	POST /pause        hold every session before its next request
+//	POST /resume       let the paused sessions carry on
+//	GET  /annotations  the annotations made so far, as JSON
+//	POST /annotations  mark the attack with {"text": ..., "by": ...}
+//	GET  /results      every session's results as they're recorded, as JSON lines
+func serveControl(addr string, c *control) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error starting control API on %s: %s", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", c.status)
+	mux.HandleFunc("/snapshot", c.latestSnapshot)
+	mux.HandleFunc("/pause", c.pause(true))
+	mux.HandleFunc("/resume", c.pause(false))
+	mux.HandleFunc("/annotations", c.annotate)
+	mux.HandleFunc("/results", c.streamResults)
+	secured := ""
+	if c.tls != nil {
+		listener = tls.NewListener(listener, c.tls)
+		secured = " with TLS"
+		if c.tls.ClientAuth == tls.RequireAndVerifyClientCert {
+			secured += ", requiring client certificates"
+		}
+	}
+	if c.token != "" && secured != "" {
+		secured += " and a token"
+	} else if c.token != "" {
+		secured = " with a token"
+	}
+	go http.Serve(listener, c.authorize(mux))
+	c.log <- fmt.Sprintf("Control API listening on %s%s", listener.Addr(), secured)
+	return listener, nil
+}
+
+// authorize refuses requests without the token, if there is one
+func (c *control) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !korra.BearerAuthorized(c.token, r.Header) {
+			c.log <- fmt.Sprintf("Control API refused a request from %s without the token", r.RemoteAddr)
+			http.Error(w, "missing or wrong token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *control) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.progress())
+}
+
+func (c *control) latestSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	report := c.snapshot()
+	if report == nil {
+		http.Error(w, "no snapshot yet (take them with -snapshot)", http.StatusNotFound)
+		return
+	}
+	w.Write(report)
+}
+
+func (c *control) pause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !setPaused(c.gate, paused, fmt.Sprintf("control API (%s)", r.RemoteAddr), c.log) {
+			w.WriteHeader(http.StatusConflict)
+		}
+		json.NewEncoder(w).Encode(c.progress())
+	}
+}
+
+// annotationRequest is what's posted to annotate the attack; the time is
+// now unless it's given
+type annotationRequest struct {
+	Text      string    `json:"text"`
+	By        string    `json:"by"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (c *control) annotate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.notes.All())
+	case "POST":
+		var req annotationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("bad annotation: %s", err), http.StatusBadRequest)
+			return
+		}
+		by := fmt.Sprintf("control API (%s)", r.RemoteAddr)
+		if req.By != "" {
+			by = req.By
+		}
+		annotation, err := c.notes.Add(korra.Annotation{Timestamp: req.Timestamp, Text: req.Text, By: by})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.log <- fmt.Sprintf("Annotated by %s: %s", by, annotation.Text)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(annotation)
+	default:
+		http.Error(w, "use GET or POST", http.StatusMethodNotAllowed)
+	}
+}
+
+// resultsPoll is how often a streamed result file is checked for more
+const resultsPoll = 100 * time.Millisecond
+
+// streamedResult is a line of GET /results: the metadata a session's result
+// file starts with, one of its results, or why its results stopped coming
+type streamedResult struct {
+	Session  string          `json:"session"`
+	Metadata *korra.Metadata `json:"metadata,omitempty"`
+	Result   *korra.Result   `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// streamResults streams the results of every session, or of those named by
+// session parameters, from the start, following each session's result file
+// as it's recorded until the session's done. The files are read rather than
+// the results taken from the sessions, so a slow client only falls behind:
+// what it hasn't read yet waits on disk and the attack never waits on it.
+func (c *control) streamResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	sessions := c.sessions
+	if names := r.URL.Query()["session"]; len(names) > 0 {
+		sessions = map[string]*korra.Session{}
+		for _, name := range names {
+			session, ok := c.sessions[name]
+			if !ok {
+				http.Error(w, fmt.Sprintf("no results recorded for session %s", name), http.StatusNotFound)
+				return
+			}
+			sessions[name] = session
+		}
+	}
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	done := r.Context().Done()
+	lines := make(chan streamedResult)
+	var following sync.WaitGroup
+	for name, session := range sessions {
+		following.Add(1)
+		go func(name string, session *korra.Session) {
+			defer following.Done()
+			followResults(name, korra.ResultPath(session.Path), session.Done(), lines, done)
+		}(name, session)
+	}
+	go func() {
+		following.Wait()
+		close(lines)
+	}()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(line); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// followResults sends the session's results to lines as they're recorded to
+// its file, which may not have been created yet, until the session's
+// finished, once it's sent every result, or done is closed
+func followResults(session, file string, finished <-chan struct{}, lines chan<- streamedResult, done <-chan struct{}) {
+	in, err := os.Open(file)
+	for err != nil {
+		select {
+		case <-done:
+			return
+		case <-finished:
+			if in, err = os.Open(file); err != nil {
+				return // it recorded nothing
+			}
+		case <-time.After(resultsPoll):
+			in, err = os.Open(file)
+		}
+	}
+	defer in.Close()
+	follower := korra.NewFollower(in, resultsPoll)
+	go func() {
+		// once the session's finished, the end of its file is the end of
+		// its results, through its final checkpoint
+		select {
+		case <-done:
+		case <-finished:
+		}
+		follower.Stop()
+	}()
+	failed := func(err error) {
+		select {
+		case lines <- streamedResult{Session: session, Error: err.Error()}:
+		case <-done:
+		}
+	}
+	reader, err := korra.NewResultReader(korra.ResultEncoding, follower)
+	if err != nil {
+		failed(err)
+		return
+	}
+	for {
+		result, err := reader.Read()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			failed(fmt.Errorf("reading %s: %s", file, err))
+			return
+		}
+		line := streamedResult{Session: session, Result: result}
+		if result.Metadata != nil {
+			line = streamedResult{Session: session, Metadata: result.Metadata}
+		}
+		select {
+		case lines <- line:
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+// newStreamedSession returns a session of the script, with its log drained
+func newStreamedSession(t *testing.T, script string) (*korra.Session, chan string) {
+	path := filepath.Join(t.TempDir(), "shopper.txt")
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	log := make(chan string, 100)
+	go func() {
+		for range log {
+		}
+	}()
+	session, err := korra.NewSession(path, nil, log, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session, log
+}
+
+// readStream reads the lines of GET /results until the stream ends, failing
+// if it doesn't
+func readStream(t *testing.T, c *control, query string) []streamedResult {
+	server := httptest.NewServer(http.HandlerFunc(c.streamResults))
+	defer server.Close()
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(server.URL + "/results" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %s", resp.Status)
+	}
+	var lines []streamedResult
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line streamedResult
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("bad line %q: %s", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("want the stream to end once the session's done, got %s", err)
+	}
+	return lines
+}
+
+func TestStreamResults(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	session, log := newStreamedSession(t, fmt.Sprintf("GET %s/cart\n\nPAUSE 200\n\nGET %s/checkout\n", target.URL, target.URL))
+	c := &control{sessions: map[string]*korra.Session{session.Name: session}}
+
+	// the stream starts before the session does, so it waits on its file
+	go func() {
+		time.Sleep(2 * resultsPoll)
+		session.Run(log)
+	}()
+	lines := readStream(t, c, "")
+	if len(lines) != 2 || lines[0].Result == nil || lines[1].Result == nil ||
+		lines[0].Result.Path != "/cart" || lines[1].Result.Path != "/checkout" || lines[1].Session != "shopper.txt" {
+		t.Fatalf("want both results and the stream ended, got %+v", lines)
+	}
+
+	if lines = readStream(t, c, "?session=shopper.txt"); len(lines) != 2 {
+		t.Fatalf("want a finished session's results streamed from the start, got %+v", lines)
+	}
+	server := httptest.NewServer(http.HandlerFunc(c.streamResults))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "?session=nobody.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("want 404 for a session that isn't recording, got %s", resp.Status)
+	}
+}
+
+func TestStreamResultsError(t *testing.T) {
+	session, log := newStreamedSession(t, "PAUSE 1\n")
+	session.Run(log)
+	if err := os.WriteFile(korra.ResultPath(session.Path), []byte("not results"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &control{sessions: map[string]*korra.Session{session.Name: session}}
+	lines := readStream(t, c, "")
+	if len(lines) != 1 || lines[0].Session != "shopper.txt" || lines[0].Error == "" {
+		t.Fatalf("want the stream ended with why the results stopped, got %+v", lines)
+	}
+}
+
+// writeCert writes a certificate and key for the name signed by the CA, or
+// a self-signed CA without one, returning them and the files
+func writeCert(t *testing.T, dir, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if ca == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		ca, caKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return cert, key, certFile, keyFile
+}
+
+func TestServeControlClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caFile, _ := writeCert(t, dir, "ca", nil, nil)
+	_, _, serverCert, serverKey := writeCert(t, dir, "server", ca, caKey)
+	_, _, clientCert, clientKey := writeCert(t, dir, "client", ca, caKey)
+	config, err := korra.ControlTLS(serverCert, serverKey, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := make(chan string, 100)
+	c := &control{gate: korra.NewGate(), log: log, progress: func() attackProgress { return attackProgress{} }, token: "s3cret", tls: config}
+	listener, err := serveControl("127.0.0.1:0", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if started := <-log; !strings.Contains(started, "with TLS, requiring client certificates and a token") {
+		t.Fatalf("want the control API logged as secured, got: %s", started)
+	}
+
+	status := func(cert, key, token string) (int, error) {
+		clientConfig, err := korra.ControlClientTLS(cert, key, caFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}, Timeout: 5 * time.Second}
+		req, _ := http.NewRequest("GET", "https://"+listener.Addr().String()+"/status", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	if code, err := status(clientCert, clientKey, "s3cret"); code != http.StatusOK {
+		t.Fatalf("want a client with a certificate and the token let in, got %d, %v", code, err)
+	}
+	if code, err := status("", "", "s3cret"); err == nil {
+		t.Fatalf("want a client without a certificate refused in the handshake, got %d", code)
+	}
+	if code, err := status(clientCert, clientKey, ""); code != http.StatusUnauthorized {
+		t.Fatalf("want a client with a certificate but no token refused, got %d, %v", code, err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+func convertCmd() command {
+	encodings := strings.Join(korra.Encodings, ", ")
+	fs := flag.NewFlagSet("korra convert", flag.ExitOnError)
+	from := fs.String("from", "gob", "Encoding of the input ["+encodings+"]")
+	to := fs.String("to", "json", "Encoding of the output ["+encodings+"]")
+	input := fs.String("input", "stdin", "Input file")
+	output := fs.String("output", "stdout", "Output file")
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		return convert(*from, *to, *input, *output)
+	}}
+}
+
+// convert transcodes one result file into another encoding, record by
+// record, so it works on files too big to hold and in a pipe
+func convert(from, to, input, output string) error {
+	in, err := korra.File(input, false)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader, err := korra.NewResultReader(from, in)
+	if err != nil {
+		return err
+	}
+
+	out, err := korra.File(output, true)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer, err := korra.NewResultWriter(to, out)
+	if err != nil {
+		return err
+	}
+
+	count, err := korra.ConvertResults(reader, writer)
+	if err != nil {
+		return fmt.Errorf("converting %s: %s", input, err)
+	}
+	fmt.Fprintf(os.Stderr, "Converted %d results from %s to %s\n", count, from, to)
+	return nil
+}
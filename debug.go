@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+type debugOpts struct {
+	feeds     feeds
+	headers   headers
+	secrets   secretSources
+	timeout   time.Duration
+	verifyTLS bool
+}
+
+func debugCmd() command {
+	fs := flag.NewFlagSet("korra debug", flag.ExitOnError)
+	opts := &debugOpts{
+		feeds:   feeds{},
+		headers: headers{http.Header{}},
+		secrets: secretSources{korra.NewSecrets(), map[string]string{}},
+	}
+	fs.Var(opts.feeds, "feed", "CSV file of rows for FEED steps as name=path, as for sessions")
+	fs.Var(&opts.headers, "header", "Request header")
+	fs.Var(opts.secrets, "secret", "Secret to reference as ${secrets.name}, as for sessions")
+	fs.DurationVar(&opts.timeout, "timeout", korra.DefaultTimeout, "Requests timeout")
+	fs.BoolVar(&opts.verifyTLS, "verify-tls", false, "Verify servers' certificates, failing requests to any that don't verify")
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			return errNoDebugScript
+		}
+		return debug(opts, fs.Arg(0), os.Stdin)
+	}}
+}
+
+var errNoDebugScript = errors.New("give the one script to step through, like: korra debug shoppers/user_1.txt")
+
+const debugHelp = `  Enter, n  run the next step
+  s         skip the next step
+  r         run the last step again
+  e         edit the last step in $EDITOR and run it in its place
+  v         show the values steps can reference
+  l         list the steps
+  q         quit`
+
+// debug steps through the script, a step at a time as the user asks,
+// showing what each sent and got back and what it saved
+func debug(opts *debugOpts, scriptFile string, in io.Reader) error {
+	logChan := make(chan string)
+	go func() {
+		for msg := range logChan {
+			fmt.Printf("  %s\n", opts.secrets.Redact(msg))
+		}
+	}()
+	feeders, err := readFeeders(opts.feeds, korra.Partition{First: 1, Last: 1, Of: 1})
+	if err != nil {
+		return err
+	}
+	clientOptions := []func(*korra.Attacker){
+		korra.Timeout(opts.timeout),
+		korra.VerifyCertificates(opts.verifyTLS),
+		korra.Headers(opts.headers.Header),
+	}
+	debugger, err := korra.NewDebugger(scriptFile, clientOptions, feeders, logChan)
+	if err != nil {
+		return err
+	}
+	debugger.Session.Secrets = opts.secrets.Secrets
+
+	fmt.Printf("Debugging %s, %d steps; Enter runs the next, h lists the rest\n", scriptFile, len(debugger.Session.Script.Actions))
+	lines := bufio.NewScanner(in)
+	for {
+		if next := debugger.Next(); next != nil {
+			fmt.Printf("next %s\n", stepLabel(next))
+		} else {
+			fmt.Println("at the end of the script")
+		}
+		fmt.Print("> ")
+		if !lines.Scan() {
+			fmt.Println()
+			return lines.Err()
+		}
+		switch strings.TrimSpace(lines.Text()) {
+		case "", "n":
+			showRun(debugger.Step(), opts.secrets.Secrets)
+		case "s":
+			debugger.Skip()
+		case "r":
+			if debugger.Last() == nil {
+				fmt.Println("no step has run yet")
+				continue
+			}
+			showRun(debugger.Retry(), opts.secrets.Secrets)
+		case "e":
+			if debugger.Last() == nil {
+				fmt.Println("no step has run yet")
+				continue
+			}
+			raw, err := editStep(debugger.Last().Raw)
+			if err != nil {
+				fmt.Printf("not edited: %s\n", err)
+				continue
+			}
+			run, err := debugger.Edit(raw)
+			if err != nil {
+				fmt.Printf("not edited: %s\n", err)
+				continue
+			}
+			showRun(run, opts.secrets.Secrets)
+		case "v":
+			values := debugger.Values()
+			refs := make([]string, 0, len(values))
+			for ref := range values {
+				refs = append(refs, ref)
+			}
+			sort.Strings(refs)
+			for _, ref := range refs {
+				fmt.Printf("  ${%s} = %s\n", ref, values[ref])
+			}
+			if len(refs) == 0 {
+				fmt.Println("  no values yet")
+			}
+		case "l":
+			for _, action := range debugger.Session.Script.Actions {
+				marker := " "
+				if action == debugger.Next() {
+					marker = ">"
+				}
+				fmt.Printf("%s %s\n", marker, stepLabel(action))
+			}
+		case "q":
+			return nil
+		case "h", "?":
+			fmt.Println(debugHelp)
+		default:
+			fmt.Println("unknown command; h lists them")
+		}
+	}
+}
+
+// stepLabel shows the step by its line and first line of text
+func stepLabel(action *korra.SessionAction) string {
+	first := strings.SplitN(action.Raw, "\n", 2)[0]
+	label := fmt.Sprintf("line %d: %s", action.Line, first)
+	if action.Chance != nil {
+		label += fmt.Sprintf(" (in %s)", action.Chance)
+	}
+	if action.Hook != "" {
+		label += fmt.Sprintf(" (%s)", action.Hook)
+	}
+	return label
+}
+
+// showRun prints each result of the step with its request and response,
+// and what the step saved
+func showRun(run *korra.StepRun, secrets *korra.Secrets) {
+	if run == nil {
+		fmt.Println("nothing left to run")
+		return
+	}
+	for i, result := range run.Results {
+		fmt.Printf("%d => %s %s, %d ms %s\n", result.Code, result.Method, result.Path, int64(result.Latency/time.Millisecond), result.Error)
+		if dump := strings.TrimRight(run.Dumps[i], "\r\n"); dump != "" {
+			fmt.Printf("%s\n\n", dump)
+		}
+	}
+	stores := make([]string, 0, len(run.Saved))
+	for store := range run.Saved {
+		stores = append(stores, store)
+	}
+	sort.Strings(stores)
+	for _, store := range stores {
+		for column, value := range run.Saved[store] {
+			fmt.Printf("saved ${%s.%s} = %s\n", store, column, secrets.Redact(value))
+		}
+	}
+	fmt.Printf("took %s\n", run.Took.Round(time.Millisecond))
+}
+
+// editStep opens the step's text in the user's editor, returning it edited
+func editStep(raw string) (string, error) {
+	file, err := ioutil.TempFile("", "korra-step-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(raw + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], file.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err = cmd.Run(); err != nil {
+		return "", err
+	}
+	edited, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(edited)), nil
+}
+
+// editorCommand returns the command in VISUAL, or else EDITOR, split into
+// its arguments, or vi if neither has one
+func editorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+func downsampleCmd() command {
+	fs := flag.NewFlagSet("korra downsample", flag.ExitOnError)
+	window := fs.Duration("window", 10*time.Second, "Width of the windows to reduce results to")
+	samples := fs.Int("samples", 10, "Most results to keep for each kind of result in a window")
+	input := fs.String("input", "stdin", "Input result file")
+	output := fs.String("output", "stdout", "Output result file")
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		return downsample(*window, *samples, *input, *output)
+	}}
+}
+
+// downsample reduces a result file to a few results per window and kind of
+// result, for keeping long after the attack; the output is a result file
+// like any other, so it reports, inspects and converts the same
+func downsample(window time.Duration, samples int, input, output string) error {
+	in, err := korra.File(input, false)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader, _ := korra.NewResultReader(korra.ResultEncoding, in)
+
+	out, err := korra.File(output, true)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer, _ := korra.NewResultWriter("gob", out)
+
+	kept := 0
+	downsampler, err := korra.NewDownsampler(window, samples, func(r *korra.Result) error {
+		if r.Metadata != nil {
+			// say the results aren't the raw ones anymore
+			m := *r.Metadata
+			m.Resolution = window
+			r = &korra.Result{Metadata: &m}
+		} else {
+			kept++
+		}
+		return writer.Write(r)
+	})
+	if err != nil {
+		return err
+	}
+
+	count, err := korra.ConvertResults(reader, downsampleWriter{downsampler, writer})
+	if err != nil {
+		return fmt.Errorf("downsampling %s: %s", input, err)
+	}
+	fmt.Fprintf(os.Stderr, "Downsampled %d results to %d in %s windows\n", count, kept, window)
+	return nil
+}
+
+// downsampleWriter passes results through the downsampler on their way to
+// the result file
+type downsampleWriter struct {
+	downsampler *korra.Downsampler
+	writer      korra.ResultWriter
+}
+
+func (w downsampleWriter) Write(r *korra.Result) error { return w.downsampler.Add(r) }
+
+func (w downsampleWriter) Flush() error {
+	if err := w.downsampler.Flush(); err != nil {
+		return err
+	}
+	return w.writer.Flush()
+}
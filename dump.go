@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"os/signal"
 
 	korra "github.com/cwinters/korra/lib"
@@ -12,20 +14,33 @@ import (
 
 func dumpCmd() command {
 	fs := flag.NewFlagSet("korra dump", flag.ExitOnError)
-	dumper := fs.String("dumper", "", "Dumper [json, csv]")
+	dumper := fs.String("dumper", "", "Dumper [json, csv, sql, sqlite]")
 	inputs := fs.String("inputs", "", "Input files as glob")
-	output := fs.String("output", "stdout", "Output file")
+	output := fs.String("output", "stdout", "Output file, or the database file for sqlite")
+	urlf := fs.String("urls", "", "URL patterns file to bucket results by, for sql and sqlite")
 	//	include := fs.String("include", "", "(TBD) Filter expression(s) to include only certain transactions")
 	//	exclude := fs.String("exclude", "", "(TBD) Filter expression(s) to exclude transactions")
 
 	return command{fs, func(args []string) error {
 		fs.Parse(args)
-		return dump(*dumper, *inputs, *output)
+		if *dumper == "sqlite" {
+			if _, err := sqliteCommand(*output); err != nil {
+				return err
+			}
+		}
+		return dump(*dumper, *inputs, *output, *urlf)
 	}}
 }
 
-func dump(dumper, inputs, output string) error {
+func dump(dumper, inputs, output, urlf string) (err error) {
 	dump, ok := dumpers[dumper]
+	if dumper == "sql" || dumper == "sqlite" {
+		buckets, err := readBuckets(urlf)
+		if err != nil {
+			return err
+		}
+		dump, ok = &korra.SQLDumper{Collection: &buckets}, true
+	}
 	if !ok {
 		return fmt.Errorf("unsupported dumper: %s", dumper)
 	}
@@ -41,15 +56,32 @@ func dump(dumper, inputs, output string) error {
 		srcs[i] = in
 	}
 
-	out, err := korra.File(output, true)
+	var out io.WriteCloser
+	if dumper == "sqlite" {
+		out, err = sqliteDatabase(output)
+	} else {
+		out, err = korra.File(output, true)
+	}
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
 
-	if dumpHeaders[dumper] != nil {
+	if header, ok := dump.(korra.DumpHeader); ok {
+		out.Write(header.Header())
+	} else if dumpHeaders[dumper] != nil {
 		out.Write(dumpHeaders[dumper].Header())
 	}
+	// what's been dumped when interrupted is kept, so finish it off
+	defer func() {
+		if footer, ok := dump.(korra.DumpFooter); ok && err == nil {
+			_, err = out.Write(footer.Footer())
+		}
+	}()
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt)
@@ -78,6 +110,54 @@ func dump(dumper, inputs, output string) error {
 	}
 }
 
+var errNoDatabase = errors.New("give the database file to dump results into, like: korra dump -dumper=sqlite -inputs='results/*.bin' -output=results.db")
+
+// sqliteDatabase returns the input of a sqlite3 process loading what's
+// written to it into the database file, which it creates if it's not there;
+// closing it waits for sqlite3 to finish.
+func sqliteDatabase(path string) (io.WriteCloser, error) {
+	sqlite, err := sqliteCommand(path)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(sqlite, "-bail", path)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &sqliteInput{in, cmd}, nil
+}
+
+// sqliteCommand returns the sqlite3 command to load results into the
+// database file with, checked before any are read
+func sqliteCommand(path string) (string, error) {
+	if path == "" || path == "stdout" {
+		return "", errNoDatabase
+	}
+	sqlite, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return "", errors.New("the sqlite dumper needs the sqlite3 command installed, which isn't on the PATH; dump with -dumper=sql to load the results some other way")
+	}
+	return sqlite, nil
+}
+
+type sqliteInput struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (s *sqliteInput) Close() error {
+	s.WriteCloser.Close()
+	if err := s.cmd.Wait(); err != nil {
+		return fmt.Errorf("loading the results into the database: %s", err)
+	}
+	return nil
+}
+
 var dumpers = map[string]korra.Dumper{
 	"csv":  korra.DumpCSV,
 	"json": korra.DumpJSON,
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+type envOpts struct {
+	compose string
+	dir     string
+	keep    bool
+	wait    time.Duration
+}
+
+func envCmd() command {
+	fs := flag.NewFlagSet("korra env", flag.ExitOnError)
+	opts := &envOpts{}
+	fs.StringVar(&opts.compose, "compose", "docker compose", "Command to run Compose with, like docker-compose or podman compose")
+	fs.StringVar(&opts.dir, "dir", ".", "Directory of sessions with the compose file of their environment")
+	fs.BoolVar(&opts.keep, "keep", false, "If true leave the environment up after running a command in it, to look around (false*)")
+	fs.DurationVar(&opts.wait, "wait", 2*time.Minute, "Time to wait for the environment's services to be running and healthy")
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		return env(opts, fs.Args())
+	}}
+}
+
+var errNoEnvAction = errors.New("give up, down, or the command to run in the environment, like: korra env -dir=scripts sessions -dir=scripts")
+
+// env brings the environment defined next to the sessions up or down, or
+// brings it up, runs the korra command in args against it in its own
+// process, and brings it down again however that went
+func env(opts *envOpts, args []string) error {
+	if len(args) == 0 {
+		return errNoEnvAction
+	}
+	if opts.wait < time.Second {
+		return fmt.Errorf("bad -wait: %s, want at least 1s", opts.wait)
+	}
+	environment, err := korra.FindComposeEnv(opts.dir, opts.compose)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "up":
+		return envUp(environment, opts.wait)
+	case "down":
+		return envDown(environment)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// the command gets interrupts too, so let it finish up before going down
+	signal.Ignore(os.Interrupt)
+	if err = envUp(environment, opts.wait); err != nil {
+		if downErr := envDown(environment); downErr != nil {
+			log.Printf("Environment %s not brought down: %s", environment.Project, downErr)
+		}
+		return err
+	}
+	log.Printf("Running in environment %s: korra %s", environment.Project, strings.Join(args, " "))
+	cmd := exec.Command(self, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		log.Printf("korra %s failed: %s", args[0], err)
+	}
+	if opts.keep {
+		log.Printf("Environment %s left up; bring it down with: korra env -dir=%s down", environment.Project, opts.dir)
+		return err
+	}
+	if downErr := envDown(environment); err == nil {
+		err = downErr
+	}
+	return err
+}
+
+func envUp(environment *korra.ComposeEnv, wait time.Duration) error {
+	log.Printf("Bringing up environment %s from %s", environment.Project, environment.File)
+	if err := environment.Up(wait).Run(); err != nil {
+		return fmt.Errorf("error bringing up environment %s: %s", environment.Project, err)
+	}
+	log.Printf("Environment %s is up", environment.Project)
+	return nil
+}
+
+func envDown(environment *korra.ComposeEnv) error {
+	log.Printf("Bringing down environment %s", environment.Project)
+	if err := environment.Down().Run(); err != nil {
+		return fmt.Errorf("error bringing down environment %s: %s", environment.Project, err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+type estimateOpts struct {
+	latency      time.Duration
+	phases       phaseDirs
+	responseSize string
+	sessiond     string
+	setupf       string
+	teardownf    string
+}
+
+func estimateCmd() command {
+	fs := flag.NewFlagSet("korra estimate", flag.ExitOnError)
+	opts := &estimateOpts{}
+	fs.StringVar(&opts.sessiond, "dir", ".", "Directory of sessions to estimate, as sessions would run them")
+	fs.DurationVar(&opts.latency, "latency", 100*time.Millisecond, "Time to assume each request takes")
+	fs.StringVar(&opts.responseSize, "response-size", "0", "Size to assume of each response, like 10KB; 0 leaves what's received out")
+	fs.StringVar(&opts.setupf, "setup", "", "Script sessions would run once before any sessions start")
+	fs.StringVar(&opts.teardownf, "teardown", "", "Script sessions would run once after all sessions are done")
+	fs.Var(&opts.phases, "then", "Directory of sessions sessions would start as a later phase; repeat for more")
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		return estimate(opts)
+	}}
+}
+
+// estimate works out what sessions would send with the same directories
+// and scripts, bucket by bucket, and how long it would take, without
+// sending anything, so a run's volume can be checked against a third
+// party's quota before it's spent
+func estimate(opts *estimateOpts) error {
+	responseSize, err := korra.ParseSize(opts.responseSize)
+	if err != nil {
+		return fmt.Errorf("bad -response-size: %s", err)
+	}
+	var (
+		names  []string
+		phases [][]*korra.SessionScript
+	)
+	add := func(name string, files []string) error {
+		var scripts []*korra.SessionScript
+		for _, file := range files {
+			script, err := korra.CheckScript(file)
+			if err != nil {
+				return err
+			}
+			for _, action := range script.Actions {
+				if action.Error != nil {
+					return fmt.Errorf("%s: %s (korra validate -file=%s lists every problem)", file, action.Error, file)
+				}
+			}
+			scripts = append(scripts, script)
+		}
+		names, phases = append(names, name), append(phases, scripts)
+		return nil
+	}
+	if opts.setupf != "" {
+		if err = add("setup", []string{opts.setupf}); err != nil {
+			return err
+		}
+	}
+	for _, dir := range append([]string{opts.sessiond}, opts.phases...) {
+		files := excludeFiles(korra.GlobInputs(fmt.Sprintf("%s/*.txt", dir)), opts.setupf, opts.teardownf)
+		if len(files) == 0 {
+			return fmt.Errorf("no sessions in %s", dir)
+		}
+		if err = add(dir, files); err != nil {
+			return err
+		}
+	}
+	if opts.teardownf != "" {
+		if err = add("teardown", []string{opts.teardownf}); err != nil {
+			return err
+		}
+	}
+
+	est := korra.NewEstimate(names, phases, korra.EstimateOptions{Latency: opts.latency, ResponseSize: responseSize})
+	received := responseSize > 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "ESTIMATE: assuming %s per request", opts.latency)
+	if received {
+		fmt.Fprintf(w, " and %s per response", opts.responseSize)
+	}
+	fmt.Fprintf(w, "\n\nPhase\tSessions\tRequests\tDuration\n")
+	sessions := 0
+	for _, phase := range est.Phases {
+		sessions += phase.Sessions
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", phase.Name, phase.Sessions, formatCount(phase.Requests), phase.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "Total\t%d\t%s\t%s\n\n", sessions, formatCount(est.Requests), est.Duration.Round(time.Millisecond))
+
+	fmt.Fprintf(w, "Bucket\tRequests\tSent")
+	if received {
+		fmt.Fprintf(w, "\tReceived")
+	}
+	fmt.Fprintln(w)
+	for _, bucket := range est.Buckets {
+		fmt.Fprintf(w, "%s\t%s\t%s", bucket.Key, formatCount(bucket.Requests), formatSize(bucket.BytesOut))
+		if received {
+			fmt.Fprintf(w, "\t%s", formatSize(bucket.BytesIn))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "Total\t%s\t%s", formatCount(est.Requests), formatSize(est.BytesOut))
+	if received {
+		fmt.Fprintf(w, "\t%s", formatSize(est.BytesIn))
+	}
+	fmt.Fprintln(w)
+	return w.Flush()
+}
+
+// formatCount shows an expected count whole, or to a decimal place if
+// CHANCE blocks made it fractional
+func formatCount(n float64) string {
+	if n == float64(int64(n)) {
+		return fmt.Sprintf("%d", int64(n))
+	}
+	return fmt.Sprintf("%.1f", n)
+}
+
+var sizeUnits = []string{"B", "KB", "MB", "GB", "TB"}
+
+// formatSize shows the bytes in the largest unit there's at least one of
+func formatSize(size float64) string {
+	for i := len(sizeUnits) - 1; i > 0; i-- {
+		if unit := float64(uint64(1) << (10 * uint(i))); size >= unit {
+			return fmt.Sprintf("%.2f%s", size/unit, sizeUnits[i])
+		}
+	}
+	return fmt.Sprintf("%.0fB", size)
+}
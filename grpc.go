@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+type grpcOpts struct {
+	certf   string
+	methods string
+	target  string
+	timeout time.Duration
+}
+
+func grpcCmd() command {
+	fs := flag.NewFlagSet("korra grpc", flag.ExitOnError)
+	opts := &grpcOpts{}
+	fs.StringVar(&opts.certf, "cert", "", "x509 Certificate file")
+	fs.StringVar(&opts.methods, "methods", "", "Comma-separated methods (package.Service/Method) that must be available")
+	fs.StringVar(&opts.target, "target", "", "gRPC server as grpc://host:port or grpcs://host:port")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "Time allowed for each probe")
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		return grpcCheck(opts.target, opts.methods, opts.certf, opts.timeout)
+	}}
+}
+
+var errGRPCCheck = errors.New("gRPC target is not ready to attack")
+
+// grpcCheck discovers what the gRPC target serves and reports on it,
+// returning an error if it's unhealthy or missing any of the methods.
+func grpcCheck(target, methods, certf string, timeout time.Duration) error {
+	if target == "" {
+		return fmt.Errorf("a gRPC -target is required")
+	}
+	tlsc, err := setupTLS(certf)
+	if err != nil {
+		return err
+	}
+	client, err := korra.NewGRPCClient(target, tlsc, timeout)
+	if err != nil {
+		return err
+	}
+	var required []string
+	for _, method := range strings.Split(methods, ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			required = append(required, method)
+		}
+	}
+	discovery := korra.DiscoverGRPC(client, target)
+	discovery.Report(os.Stdout, required)
+	if len(discovery.Check(required)) > 0 {
+		return errGRPCCheck
+	}
+	return nil
+}
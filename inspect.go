@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+func inspectCmd() command {
+	fs := flag.NewFlagSet("korra inspect", flag.ExitOnError)
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		return inspect(fs.Args())
+	}}
+}
+
+var errNoResultFiles = errors.New("give the result files to inspect, like: korra inspect results/user_4512.bin 'results/1*.bin'")
+
+// inspect prints what's in each result file without reporting on it: what
+// it says about its attack, how many results it has and from when, and
+// whether it could be read to its end. It fails if any of them couldn't.
+func inspect(inputs []string) error {
+	var files []string
+	for _, input := range inputs {
+		files = append(files, korra.GlobResults(input)...)
+	}
+	if len(files) == 0 {
+		return errNoResultFiles
+	}
+	damaged := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, file := range files {
+		in, err := korra.File(file, false)
+		if err != nil {
+			return err
+		}
+		info := korra.InspectResults(in)
+		in.Close()
+
+		fmt.Fprintf(w, "%s\n", file)
+		fmt.Fprintf(w, "  Format\t%d\n", info.Format)
+		if info.Err != nil {
+			damaged++
+			fmt.Fprintf(w, "  Integrity\tdamaged after %d results: %s\n", info.Records, info.Err)
+		} else {
+			fmt.Fprintf(w, "  Integrity\tok%s\n", checkpointsVerified(info.Checkpoints))
+		}
+		fmt.Fprintf(w, "  Results\t%d\n", info.Records)
+		if info.Records > 0 {
+			fmt.Fprintf(w, "  Time range\t%s to %s (%s)\n",
+				info.First.Format(time.RFC3339), info.Last.Format(time.RFC3339), info.Last.Sub(info.First))
+		}
+		if m := info.Metadata; m != nil {
+			fmt.Fprintf(w, "  Session\t%s, of %d\n", m.Session, m.Sessions)
+			fmt.Fprintf(w, "  Korra\t%s on %s\n", m.Version, m.Hostname)
+			fmt.Fprintf(w, "  Started\t%s\n", m.Started.Format(time.RFC3339))
+			fmt.Fprintf(w, "  Settings\t%s\n", m.SettingsString())
+			if m.Resolution > 0 {
+				fmt.Fprintf(w, "  Downsampled\tto %s windows\n", m.Resolution)
+			}
+		} else {
+			fmt.Fprintf(w, "  Metadata\t(none, recorded before result files had it)\n")
+		}
+	}
+	w.Flush()
+	if damaged > 0 {
+		return fmt.Errorf("%d of %d result files are damaged", damaged, len(files))
+	}
+	return nil
+}
+
+// checkpointsVerified says how many of a file's checkpoints were verified,
+// if it had any
+func checkpointsVerified(n int) string {
+	switch n {
+	case 0:
+		return ""
+	case 1:
+		return ", 1 checkpoint verified"
+	}
+	return fmt.Sprintf(", %d checkpoints verified", n)
+}
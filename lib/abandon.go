@@ -0,0 +1,109 @@
+package korra
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The reasons a session's user abandons it
+const (
+	AbandonChance  = "chance"  // they lost interest, as users do at random
+	AbandonLatency = "latency" // a response took longer than their Patience
+	AbandonTimeout = "timeout" // the session ran longer than their Budget
+)
+
+// AbandonKinds are the reasons a session may be abandoned for
+var AbandonKinds = []string{AbandonChance, AbandonLatency, AbandonTimeout}
+
+// Abandonment is how patient the user of a session is: on seeing the
+// response to each step of the script they give up with Chance percent
+// probability (0-100), for sure if it took longer than Patience, and for
+// sure if the session has been running longer than Budget (0 for never, for
+// either), not counting the time it was held by its Gate. A session
+// abandoned skips to its ON_END steps, as when it's stopped, and marks the
+// result it was abandoned on with why (see Result.Abandoned); one out of
+// budget while waiting, at a barrier say, gives up there and then. ON_START
+// and ON_END steps are never abandoned.
+type Abandonment struct {
+	Budget   time.Duration
+	Chance   float64
+	Patience time.Duration
+}
+
+func (ab Abandonment) String() string {
+	return fmt.Sprintf("chance=%s%% patience=%s budget=%s",
+		strconv.FormatFloat(ab.Chance, 'f', -1, 64), orNone(ab.Patience), orNone(ab.Budget))
+}
+
+func orNone(d time.Duration) string {
+	if d > 0 {
+		return d.String()
+	}
+	return "none"
+}
+
+// abandon decides whether the user gives up on seeing the result, marking
+// it with why if so; the chance is rolled once a step, on its first result
+func (session *Session) abandon(result *Result) {
+	ab := session.Abandonment
+	if session.hook != "" || session.gaveUp != "" {
+		return
+	}
+	if ab.Patience > 0 && result.Latency > ab.Patience {
+		result.Abandoned = AbandonLatency
+	} else if ab.Budget > 0 && session.elapsed() > ab.Budget {
+		result.Abandoned = AbandonTimeout
+	} else if !session.rolled && ab.Chance > 0 {
+		session.rolled = true
+		if session.attacker.random.Float64()*100 < ab.Chance {
+			result.Abandoned = AbandonChance
+		}
+	}
+	session.gaveUp = result.Abandoned
+}
+
+// elapsed returns how long the session has been running, less the time it
+// was held by its gate
+func (session *Session) elapsed() time.Duration {
+	return time.Since(session.began) - (session.Gate.pausedFor() - session.gated)
+}
+
+// watchBudget stops the session once it's been running longer than its
+// budget, cutting short whatever it's waiting on, until the session stops
+// or the watch is closed
+func (session *Session) watchBudget(watch chan struct{}) {
+	timer := time.NewTimer(session.Abandonment.Budget - session.elapsed())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-watch:
+			return
+		case <-session.aborted:
+			return
+		}
+		// time held by the gate doesn't count, so check again for the rest
+		if left := session.Abandonment.Budget - session.elapsed(); left > 0 {
+			timer.Reset(left)
+			continue
+		}
+		close(session.spent)
+		session.Stop()
+		return
+	}
+}
+
+// overBudget returns true if the session was stopped for running past its
+// budget
+func (session *Session) overBudget() bool {
+	if session.spent == nil {
+		return false
+	}
+	select {
+	case <-session.spent:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,161 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionAbandonedOnLatency(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		hits []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits = append(hits, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	script := filepath.Join(t.TempDir(), "shopper.txt")
+	raw := strings.ReplaceAll("GET {}/fast\nGET {}/slow\nGET {}/after\n\nON_END\nGET {}/logout\nEND\n", "{}", server.URL)
+	if err := os.WriteFile(script, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	log := make(chan string, 100)
+	session, err := NewSession(script, nil, log, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.LogOnly = true
+	session.Abandonment = Abandonment{Patience: 50 * time.Millisecond}
+	session.Run(log)
+	if want := "/fast /slow /logout"; strings.Join(hits, " ") != want {
+		t.Fatalf("want: %s, got: %s", want, strings.Join(hits, " "))
+	}
+	found := false
+	for len(log) > 0 {
+		line := <-log
+		found = found || strings.Contains(line, "Abandoned (latency) on the step on line 2")
+	}
+	if !found {
+		t.Fatal("want the abandonment logged")
+	}
+}
+
+func TestSessionAbandonedOnBudget(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		hits []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits = append(hits, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer server.Close()
+	script := filepath.Join(t.TempDir(), "shopper.txt")
+	raw := strings.ReplaceAll("GET {}/cart\n\nBARRIER sale 2\n\nGET {}/checkout\n\nON_END\nGET {}/logout\nEND\n", "{}", server.URL)
+	if err := os.WriteFile(script, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(gate *Gate) (time.Duration, []string) {
+		hits = nil
+		log := make(chan string, 100)
+		session, err := NewSession(script, nil, log, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.LogOnly = true
+		session.Barriers, session.Gate = NewBarriers(), gate
+		session.Abandonment = Abandonment{Budget: 200 * time.Millisecond}
+		began := time.Now()
+		session.Run(log)
+		for len(log) > 0 {
+			if line := <-log; strings.Contains(line, "Abandoned (timeout) on the step on line 2") {
+				return time.Since(began), hits
+			}
+		}
+		t.Fatal("want the abandonment at the barrier logged")
+		return 0, nil
+	}
+
+	// the barrier never fills, so only the budget gets the session past it
+	took, got := run(nil)
+	if want := "/cart /logout"; strings.Join(got, " ") != want {
+		t.Fatalf("want: %s, got: %s", want, strings.Join(got, " "))
+	}
+	if took > 5*time.Second {
+		t.Fatalf("want the session abandoned on its budget, took %s", took)
+	}
+
+	// the time the gate holds the session doesn't count against it
+	gate := NewGate()
+	gate.Pause()
+	time.AfterFunc(400*time.Millisecond, func() { gate.Resume() })
+	if took, got = run(gate); strings.Join(got, " ") != "/cart /logout" {
+		t.Fatalf("want the gated session abandoned at the barrier, got: %s", strings.Join(got, " "))
+	}
+	if took < 600*time.Millisecond {
+		t.Fatalf("want the budget to leave out the 400ms paused, abandoned after %s", took)
+	}
+}
+
+func TestAbandonChance(t *testing.T) {
+	session := &Session{attacker: NewAttacker(Seed(1)), Abandonment: Abandonment{Chance: 100}}
+	session.hook = HookStart
+	hooked := &Result{}
+	if session.abandon(hooked); hooked.Abandoned != "" {
+		t.Fatalf("want hooks never abandoned, got: %s", hooked.Abandoned)
+	}
+	session.hook = ""
+	first, second := &Result{}, &Result{}
+	session.abandon(first)
+	session.abandon(second)
+	if first.Abandoned != AbandonChance || second.Abandoned != "" {
+		t.Fatalf("want only the first result abandoned, got: %q, %q", first.Abandoned, second.Abandoned)
+	}
+
+	m := NewMetrics(Results{first, second, {Abandoned: AbandonLatency, Weight: 2}})
+	if m.Abandoned[AbandonChance] != 1 || m.Abandoned[AbandonLatency] != 2 {
+		t.Fatalf("bad abandoned counts: %v", m.Abandoned)
+	}
+
+	// the budget is for the whole session, from when it started
+	session = &Session{attacker: NewAttacker(Seed(1)), Abandonment: Abandonment{Budget: time.Minute}}
+	session.began = time.Now().Add(-30 * time.Second)
+	early := &Result{}
+	if session.abandon(early); early.Abandoned != "" {
+		t.Fatalf("want no abandonment within the budget, got: %s", early.Abandoned)
+	}
+	session.began = time.Now().Add(-2 * time.Minute)
+	late := &Result{}
+	if session.abandon(late); late.Abandoned != AbandonTimeout {
+		t.Fatalf("want the session timed out past its budget, got: %q", late.Abandoned)
+	}
+
+	// rolled once a step, at the rate given
+	session = &Session{attacker: NewAttacker(Seed(1)), Abandonment: Abandonment{Chance: 20}}
+	abandoned := 0
+	for i := 0; i < 10000; i++ {
+		session.gaveUp, session.rolled = "", false
+		result := &Result{}
+		session.abandon(result)
+		session.abandon(&Result{})
+		if result.Abandoned != "" {
+			abandoned += 1
+		}
+	}
+	if abandoned < 1800 || abandoned > 2200 {
+		t.Fatalf("want about 20%% of steps abandoned, got %d of 10000", abandoned)
+	}
+}
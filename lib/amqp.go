@@ -0,0 +1,474 @@
+package korra
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// the AMQP 0-9-1 frame types
+const (
+	amqpMethodFrame = 1
+	amqpHeaderFrame = 2
+	amqpBodyFrame   = 3
+	amqpFrameEnd    = 0xce
+)
+
+// the AMQP 0-9-1 methods a PUBLISH step sends or reads, as class and method
+// IDs
+var (
+	amqpConnectionStart   = [2]uint16{10, 10}
+	amqpConnectionStartOk = [2]uint16{10, 11}
+	amqpConnectionTune    = [2]uint16{10, 30}
+	amqpConnectionTuneOk  = [2]uint16{10, 31}
+	amqpConnectionOpen    = [2]uint16{10, 40}
+	amqpConnectionOpenOk  = [2]uint16{10, 41}
+	amqpConnectionClose   = [2]uint16{10, 50}
+	amqpChannelOpen       = [2]uint16{20, 10}
+	amqpChannelOpenOk     = [2]uint16{20, 11}
+	amqpChannelClose      = [2]uint16{20, 40}
+	amqpQueueDeclare      = [2]uint16{50, 10}
+	amqpQueueDeclareOk    = [2]uint16{50, 11}
+	amqpQueueBind         = [2]uint16{50, 20}
+	amqpQueueBindOk       = [2]uint16{50, 21}
+	amqpBasicConsume      = [2]uint16{60, 20}
+	amqpBasicConsumeOk    = [2]uint16{60, 21}
+	amqpBasicPublish      = [2]uint16{60, 40}
+	amqpBasicDeliver      = [2]uint16{60, 60}
+	amqpBasicAck          = [2]uint16{60, 80}
+	amqpBasicNack         = [2]uint16{60, 120}
+	amqpConfirmSelect     = [2]uint16{85, 10}
+	amqpConfirmSelectOk   = [2]uint16{85, 11}
+)
+
+// amqpArgs builds the arguments of a method, or the properties of a
+// content header, in AMQP's encoding
+type amqpArgs struct {
+	bytes.Buffer
+}
+
+func (a *amqpArgs) octet(v byte) *amqpArgs {
+	a.WriteByte(v)
+	return a
+}
+
+func (a *amqpArgs) short(v uint16) *amqpArgs {
+	binary.Write(a, binary.BigEndian, v)
+	return a
+}
+
+func (a *amqpArgs) long(v uint32) *amqpArgs {
+	binary.Write(a, binary.BigEndian, v)
+	return a
+}
+
+func (a *amqpArgs) longlong(v uint64) *amqpArgs {
+	binary.Write(a, binary.BigEndian, v)
+	return a
+}
+
+func (a *amqpArgs) shortstr(s string) *amqpArgs {
+	a.WriteByte(byte(len(s)))
+	a.WriteString(s)
+	return a
+}
+
+func (a *amqpArgs) longstr(s string) *amqpArgs {
+	a.long(uint32(len(s)))
+	a.WriteString(s)
+	return a
+}
+
+// table writes an empty field table
+func (a *amqpArgs) table() *amqpArgs {
+	return a.long(0)
+}
+
+// amqpFields reads the arguments of a method, or the properties of a
+// content header; reading past the end of them is an error, kept until
+// the end.
+type amqpFields struct {
+	data []byte
+	err  error
+}
+
+func (f *amqpFields) take(n int) []byte {
+	if f.err != nil || n > len(f.data) {
+		f.err = errors.New("AMQP frame too short")
+		return make([]byte, n)
+	}
+	taken := f.data[:n]
+	f.data = f.data[n:]
+	return taken
+}
+
+func (f *amqpFields) octet() byte      { return f.take(1)[0] }
+func (f *amqpFields) short() uint16    { return binary.BigEndian.Uint16(f.take(2)) }
+func (f *amqpFields) long() uint32     { return binary.BigEndian.Uint32(f.take(4)) }
+func (f *amqpFields) longlong() uint64 { return binary.BigEndian.Uint64(f.take(8)) }
+func (f *amqpFields) shortstr() string { return string(f.take(int(f.octet()))) }
+func (f *amqpFields) longstr() string  { return string(f.take(int(f.long()))) }
+
+// amqpConn is a connection to an AMQP broker with a channel open on it,
+// publishing to the step's exchange and routing key or consuming from a
+// queue they're routed to. Messages carry their correlation ID in the
+// correlation-id property.
+type amqpConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	config    *PublishConfig
+	delivered func(string)
+	frameMax  uint32
+	tag       uint64     // the delivery tag of the last message published with confirms
+	acks      chan error // the outcome of publishes the broker confirmed, nil if it acked them
+	done      chan struct{}
+	sync.Mutex
+	err error // why the connection was lost, once done is closed
+}
+
+func (c *amqpConn) frame(kind byte, channel uint16, payload []byte) error {
+	var frame bytes.Buffer
+	frame.WriteByte(kind)
+	binary.Write(&frame, binary.BigEndian, channel)
+	binary.Write(&frame, binary.BigEndian, uint32(len(payload)))
+	frame.Write(payload)
+	frame.WriteByte(amqpFrameEnd)
+	_, err := c.conn.Write(frame.Bytes())
+	return err
+}
+
+func (c *amqpConn) method(channel uint16, method [2]uint16, args *amqpArgs) error {
+	var payload amqpArgs
+	payload.short(method[0]).short(method[1])
+	if args != nil {
+		payload.Write(args.Bytes())
+	}
+	return c.frame(amqpMethodFrame, channel, payload.Bytes())
+}
+
+// readFrame reads the next frame, returning its type, channel and payload
+func (c *amqpConn) readFrame() (byte, uint16, []byte, error) {
+	var header [7]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[3:])
+	if size > 1<<24 {
+		return 0, 0, nil, fmt.Errorf("AMQP frame too big: %d bytes", size)
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	if payload[size] != amqpFrameEnd {
+		return 0, 0, nil, errors.New("bad AMQP frame end")
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:]), payload[:size], nil
+}
+
+// closed returns the error a connection.close or channel.close from the
+// broker is, or nil if the method is neither
+func amqpClosed(method [2]uint16, fields *amqpFields) error {
+	if method != amqpConnectionClose && method != amqpChannelClose {
+		return nil
+	}
+	code := fields.short()
+	return brokerError(fmt.Sprintf("AMQP %d %s", code, fields.shortstr()))
+}
+
+// expect reads frames until the method, skipping heartbeats, and returns
+// its arguments
+func (c *amqpConn) expect(want [2]uint16) (*amqpFields, error) {
+	for {
+		kind, _, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if kind != amqpMethodFrame {
+			continue
+		}
+		fields := &amqpFields{data: payload}
+		method := [2]uint16{fields.short(), fields.short()}
+		if err := amqpClosed(method, fields); err != nil {
+			return nil, err
+		}
+		if method != want {
+			return nil, fmt.Errorf("expected AMQP method %d.%d, got %d.%d", want[0], want[1], method[0], method[1])
+		}
+		return fields, fields.err
+	}
+}
+
+// dialAMQP opens a connection to the URL's virtual host over the conn,
+// logging in with the URL's user and password (guest if none), and a channel
+// on it. With delivered it consumes the messages routed to the step's topic;
+// without, it puts the channel in confirm mode for QoS 1.
+func dialAMQP(conn net.Conn, u *url.URL, config *PublishConfig, delivered func(string)) (*amqpConn, error) {
+	c := &amqpConn{conn: conn, reader: bufio.NewReader(conn), config: config, delivered: delivered,
+		acks: make(chan error, 16), done: make(chan struct{})}
+	if _, err := conn.Write([]byte("AMQP\x00\x00\x09\x01")); err != nil {
+		return nil, err
+	}
+	if _, err := c.expect(amqpConnectionStart); err != nil {
+		return nil, err
+	}
+	user, password := "guest", "guest"
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	login := new(amqpArgs).table().shortstr("PLAIN").longstr("\x00" + user + "\x00" + password).shortstr("en_US")
+	if err := c.method(0, amqpConnectionStartOk, login); err != nil {
+		return nil, err
+	}
+	tune, err := c.expect(amqpConnectionTune)
+	if err != nil {
+		return nil, err
+	}
+	channels, frameMax := tune.short(), tune.long()
+	if frameMax == 0 || frameMax > 1<<17 {
+		frameMax = 1 << 17
+	}
+	c.frameMax = frameMax
+	// heartbeats are off, since steps hold their connections only while publishing
+	if err := c.method(0, amqpConnectionTuneOk, new(amqpArgs).short(channels).long(frameMax).short(0)); err != nil {
+		return nil, err
+	}
+	vhost, _ := url.PathUnescape(u.Path)
+	if len(vhost) > 1 {
+		vhost = vhost[1:]
+	} else {
+		vhost = "/"
+	}
+	if err := c.method(0, amqpConnectionOpen, new(amqpArgs).shortstr(vhost).shortstr("").octet(0)); err != nil {
+		return nil, err
+	}
+	if _, err := c.expect(amqpConnectionOpenOk); err != nil {
+		return nil, err
+	}
+	if err := c.method(1, amqpChannelOpen, new(amqpArgs).shortstr("")); err != nil {
+		return nil, err
+	}
+	if _, err := c.expect(amqpChannelOpenOk); err != nil {
+		return nil, err
+	}
+
+	if delivered != nil {
+		if err := c.consume(); err != nil {
+			return nil, err
+		}
+	} else if config.QoS == 1 {
+		if err := c.method(1, amqpConfirmSelect, new(amqpArgs).octet(0)); err != nil {
+			return nil, err
+		}
+		if _, err := c.expect(amqpConfirmSelectOk); err != nil {
+			return nil, err
+		}
+	}
+	go c.read()
+	return c, nil
+}
+
+// consume starts consuming the messages routed to the topic: from a queue of
+// its own bound to the exchange with the topic as its key, or with the
+// default exchange, from the queue the topic names, which must exist
+func (c *amqpConn) consume() error {
+	queue := c.config.Topic
+	if c.config.Exchange == "" {
+		// passive: only check the queue's there
+		if err := c.method(1, amqpQueueDeclare, new(amqpArgs).short(0).shortstr(queue).octet(0x01).table()); err != nil {
+			return err
+		}
+		if _, err := c.expect(amqpQueueDeclareOk); err != nil {
+			return err
+		}
+	} else {
+		// exclusive and auto-deleted, with a name from the broker
+		if err := c.method(1, amqpQueueDeclare, new(amqpArgs).short(0).shortstr("").octet(0x0c).table()); err != nil {
+			return err
+		}
+		declared, err := c.expect(amqpQueueDeclareOk)
+		if err != nil {
+			return err
+		}
+		queue = declared.shortstr()
+		bind := new(amqpArgs).short(0).shortstr(queue).shortstr(c.config.Exchange).shortstr(c.config.Topic).octet(0).table()
+		if err := c.method(1, amqpQueueBind, bind); err != nil {
+			return err
+		}
+		if _, err := c.expect(amqpQueueBindOk); err != nil {
+			return err
+		}
+	}
+	// no-ack, since only their timing matters
+	if err := c.method(1, amqpBasicConsume, new(amqpArgs).short(0).shortstr(queue).shortstr("").octet(0x02).table()); err != nil {
+		return err
+	}
+	_, err := c.expect(amqpBasicConsumeOk)
+	return err
+}
+
+// read reads the frames the broker sends until the connection's lost,
+// passing on confirms and the correlation IDs of messages delivered
+func (c *amqpConn) read() {
+	var (
+		err         error
+		delivering  bool   // between a basic.deliver and the end of its body
+		correlation string // of the message being delivered
+		left        uint64 // bytes of its body to come
+	)
+	defer func() {
+		c.Lock()
+		c.err = err
+		c.Unlock()
+		close(c.done)
+	}()
+	for {
+		var (
+			kind    byte
+			payload []byte
+		)
+		if kind, _, payload, err = c.readFrame(); err != nil {
+			return
+		}
+		fields := &amqpFields{data: payload}
+		switch kind {
+		case amqpMethodFrame:
+			method := [2]uint16{fields.short(), fields.short()}
+			if err = amqpClosed(method, fields); err != nil {
+				return
+			}
+			switch method {
+			case amqpBasicDeliver:
+				delivering, correlation = true, ""
+			case amqpBasicAck, amqpBasicNack:
+				tag, multiple := fields.longlong(), fields.octet()&0x01 != 0
+				var outcome error
+				if method == amqpBasicNack {
+					outcome = brokerError("AMQP message refused by the broker")
+				}
+				if tag == c.lastTag() || multiple && tag >= c.lastTag() {
+					select {
+					case c.acks <- outcome:
+					default:
+					}
+				}
+			}
+		case amqpHeaderFrame:
+			if !delivering {
+				continue
+			}
+			fields.short() // class
+			fields.short() // weight
+			left = fields.longlong()
+			flags := fields.short()
+			if flags&(1<<15) != 0 {
+				fields.shortstr() // content-type
+			}
+			if flags&(1<<14) != 0 {
+				fields.shortstr() // content-encoding
+			}
+			if flags&(1<<13) != 0 {
+				fields.take(int(fields.long())) // headers
+			}
+			if flags&(1<<12) != 0 {
+				fields.octet() // delivery-mode
+			}
+			if flags&(1<<11) != 0 {
+				fields.octet() // priority
+			}
+			if flags&(1<<10) != 0 {
+				correlation = fields.shortstr()
+			}
+			if fields.err == nil && left == 0 {
+				delivering = false
+				c.delivered(correlation)
+			}
+		case amqpBodyFrame:
+			if !delivering {
+				continue
+			}
+			if size := uint64(len(payload)); size < left {
+				left -= size
+			} else {
+				delivering = false
+				c.delivered(correlation)
+			}
+		}
+	}
+}
+
+func (c *amqpConn) lastTag() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.tag
+}
+
+// lost returns why the connection was lost
+func (c *amqpConn) lost() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.err == nil || c.err == io.EOF {
+		return errors.New("AMQP connection closed by the broker")
+	}
+	return c.err
+}
+
+func (c *amqpConn) publish(correlation string, payload []byte, deadline time.Time) error {
+	if c.config.QoS == 1 {
+		// before it's sent, so the confirm's never taken for an earlier one's
+		c.Lock()
+		c.tag++
+		c.Unlock()
+	}
+	c.conn.SetWriteDeadline(deadline)
+	publish := new(amqpArgs).short(0).shortstr(c.config.Exchange).shortstr(c.config.Topic).octet(0)
+	if err := c.method(1, amqpBasicPublish, publish); err != nil {
+		return err
+	}
+	header := new(amqpArgs).short(60).short(0).longlong(uint64(len(payload)))
+	if correlation != "" {
+		header.short(1 << 10).shortstr(correlation)
+	} else {
+		header.short(0)
+	}
+	if err := c.frame(amqpHeaderFrame, 1, header.Bytes()); err != nil {
+		return err
+	}
+	for chunk := int(c.frameMax) - 8; len(payload) > 0; {
+		if chunk > len(payload) {
+			chunk = len(payload)
+		}
+		if err := c.frame(amqpBodyFrame, 1, payload[:chunk]); err != nil {
+			return err
+		}
+		payload = payload[chunk:]
+	}
+	if c.config.QoS == 0 {
+		return nil
+	}
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+	select {
+	case outcome := <-c.acks:
+		return outcome
+	case <-c.done:
+		return c.lost()
+	case <-timeout.C:
+		return errPublishTimeout{}
+	}
+}
+
+// Close closes the connection, telling the broker first
+func (c *amqpConn) Close() error {
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.method(0, amqpConnectionClose, new(amqpArgs).short(200).shortstr("").short(0).short(0))
+	return c.conn.Close()
+}
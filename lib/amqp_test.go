@@ -0,0 +1,173 @@
+package korra
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// amqpBroker is an AMQP broker with one queue, orders, routing the messages
+// published to the consumers of the queue they name, or bound to their
+// exchange with their routing key. It keeps the logins and virtual hosts
+// it's sent.
+type amqpBroker struct {
+	sync.Mutex
+	listener  net.Listener
+	consumers map[string][]*amqpConn
+	queues    int
+	logins    []string
+}
+
+func newAMQPBroker(t *testing.T) *amqpBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &amqpBroker{listener: listener, consumers: map[string][]*amqpConn{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *amqpBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	c := &amqpConn{conn: conn, reader: bufio.NewReader(conn)}
+	if _, err := io.ReadFull(c.reader, make([]byte, 8)); err != nil {
+		return
+	}
+	c.method(0, amqpConnectionStart, new(amqpArgs).octet(0).octet(9).table().longstr("PLAIN").longstr("en_US"))
+	var (
+		confirms bool
+		tag      uint64
+		queue    string // the queue the connection declared or bound
+		login    string
+		route    string // of the message whose content is coming
+		header   []byte
+	)
+	for {
+		kind, _, payload, err := c.readFrame()
+		if err != nil {
+			return
+		}
+		fields := &amqpFields{data: payload}
+		switch kind {
+		case amqpHeaderFrame:
+			fields.short()
+			fields.short()
+			if header = payload; fields.longlong() == 0 {
+				b.route(c, route, header, nil, &tag, confirms)
+			}
+			continue
+		case amqpBodyFrame:
+			b.route(c, route, header, payload, &tag, confirms)
+			continue
+		}
+		switch [2]uint16{fields.short(), fields.short()} {
+		case amqpConnectionStartOk:
+			fields.long() // the client properties
+			fields.shortstr()
+			login = fields.longstr()
+			c.method(0, amqpConnectionTune, new(amqpArgs).short(2047).long(4096).short(60))
+		case amqpConnectionOpen:
+			b.Lock()
+			b.logins = append(b.logins, strings.ReplaceAll(login, "\x00", " ")+" "+fields.shortstr())
+			b.Unlock()
+			c.method(0, amqpConnectionOpenOk, new(amqpArgs).shortstr(""))
+		case amqpChannelOpen:
+			c.method(1, amqpChannelOpenOk, new(amqpArgs).longstr(""))
+		case amqpQueueDeclare:
+			fields.short()
+			if queue = fields.shortstr(); queue == "" {
+				b.Lock()
+				b.queues++
+				queue = fmt.Sprintf("amq.gen-%d", b.queues)
+				b.Unlock()
+			} else if queue != "orders" {
+				c.method(1, amqpChannelClose, new(amqpArgs).short(404).shortstr("NOT_FOUND - no queue '"+queue+"'").short(50).short(10))
+				return
+			}
+			c.method(1, amqpQueueDeclareOk, new(amqpArgs).shortstr(queue).long(0).long(0))
+		case amqpQueueBind:
+			fields.short()
+			fields.shortstr()
+			exchange := fields.shortstr()
+			queue = exchange + " " + fields.shortstr()
+			c.method(1, amqpQueueBindOk, nil)
+		case amqpBasicConsume:
+			b.Lock()
+			b.consumers[queue] = append(b.consumers[queue], c)
+			b.Unlock()
+			c.method(1, amqpBasicConsumeOk, new(amqpArgs).shortstr("ctag"))
+		case amqpConfirmSelect:
+			confirms = true
+			c.method(1, amqpConfirmSelectOk, nil)
+		case amqpBasicPublish:
+			fields.short()
+			if exchange, key := fields.shortstr(), fields.shortstr(); exchange == "" {
+				route = key
+			} else {
+				route = exchange + " " + key
+			}
+		case amqpConnectionClose:
+			return
+		}
+	}
+}
+
+// route acknowledges a message published on the connection, if it's
+// confirming them, and delivers it with its content header as it was
+// published to the consumers of its route
+func (b *amqpBroker) route(c *amqpConn, route string, header, body []byte, tag *uint64, confirms bool) {
+	b.Lock()
+	defer b.Unlock()
+	*tag++
+	if confirms {
+		c.method(1, amqpBasicAck, new(amqpArgs).longlong(*tag).octet(0))
+	}
+	for _, consumer := range b.consumers[route] {
+		consumer.method(1, amqpBasicDeliver, new(amqpArgs).shortstr("ctag").longlong(*tag).octet(0).shortstr("").shortstr(route))
+		consumer.frame(amqpHeaderFrame, 1, header)
+		if body != nil {
+			consumer.frame(amqpBodyFrame, 1, body)
+		}
+	}
+}
+
+func TestAMQP(t *testing.T) {
+	broker := newAMQPBroker(t)
+	defer broker.listener.Close()
+
+	for params, path := range map[string]string{"topic=orders": "/amqp/orders", "topic=sensors.1 exchange=readings": "/amqp/readings/sensors.1"} {
+		results := runAction(t, fmt.Sprintf("PUBLISH amqp://korra:secret@%s/prod\n[%s messages=4 subscribe=true wait=1000]", broker.listener.Addr(), params), 4, (*Session).doPublish, nil)
+		if len(results) != 4 {
+			t.Fatalf("want a result for each message, got %d", len(results))
+		}
+		for i, r := range results {
+			if r.Method != "PUBLISH" || r.Path != path || r.Code != 200 || r.RequestCount != i+1 || r.Error != "" || r.Lost || r.Delivery == 0 {
+				t.Fatalf("want every message to %s delivered, got: %+v", path, r)
+			}
+		}
+	}
+	broker.Lock()
+	login := broker.logins[0]
+	broker.Unlock()
+	if login != " korra secret prod" {
+		t.Fatalf("want the URL's login and virtual host, got: %q", login)
+	}
+
+	results := runAction(t, fmt.Sprintf("PUBLISH amqp://%s\n[topic=missing subscribe=true]", broker.listener.Addr()), 1, (*Session).doPublish, nil)
+	if len(results) != 1 || results[0].Method != "SUBSCRIBE" || results[0].Error != "AMQP 404 NOT_FOUND - no queue 'missing'" {
+		t.Fatalf("want the subscription refused, got: %+v", results)
+	}
+}
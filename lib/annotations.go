@@ -0,0 +1,185 @@
+package korra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AnnotationsFile is the name of the file an attack's annotations are
+// written to, in the directory of its sessions, next to their results
+const AnnotationsFile = "annotations.jsonl"
+
+// Annotation marks a moment of an attack, like "deployed v2.3" or "killed
+// node-3", for reports to show against its results.
+type Annotation struct {
+	Timestamp time.Time `json:"timestamp"`
+	Text      string    `json:"text"`
+	By        string    `json:"by,omitempty"` // what made it: the control API, a step, ...
+}
+
+func (a Annotation) String() string {
+	if a.By == "" {
+		return fmt.Sprintf("%s %s", a.Timestamp.Format("15:04:05.000"), a.Text)
+	}
+	return fmt.Sprintf("%s %s (%s)", a.Timestamp.Format("15:04:05.000"), a.Text, a.By)
+}
+
+// Annotations is a slice of annotations with sorting behavior attached.
+type Annotations []Annotation
+
+func (a Annotations) Len() int           { return len(a) }
+func (a Annotations) Less(i, j int) bool { return a[i].Timestamp.Before(a[j].Timestamp) }
+func (a Annotations) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// AnnotationsPath returns the path the annotations of the sessions in the
+// directory are written to
+func AnnotationsPath(dir string) string {
+	return path.Join(dir, AnnotationsFile)
+}
+
+// AnnotationLog writes the annotations of a running attack, one JSON object
+// to a line, so it can be read while it's still being written. It's safe to
+// add to from every session at once.
+type AnnotationLog struct {
+	mu    sync.Mutex
+	file  io.WriteCloser
+	enc   *json.Encoder
+	added Annotations
+}
+
+// NewAnnotationLog starts the annotations of the sessions in the directory,
+// replacing any an earlier attack left, like their results are.
+func NewAnnotationLog(dir string) (*AnnotationLog, error) {
+	file, err := os.Create(AnnotationsPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	return &AnnotationLog{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Add writes the annotation, at now if it has no time, and returns it as
+// written. Adding to a nil log does nothing, so sessions needn't check.
+func (l *AnnotationLog) Add(a Annotation) (Annotation, error) {
+	added, err := l.AddAll(Annotations{a})
+	if err != nil {
+		return a, err
+	}
+	return added[0], nil
+}
+
+// AddAll writes the annotations, as Add does, if every one of them has
+// text, and returns them as written. It refuses them all, returning none,
+// if any hasn't; if writing fails part way it returns those written before
+// it did, with the error.
+func (l *AnnotationLog) AddAll(as Annotations) (Annotations, error) {
+	now := time.Now()
+	checked := make(Annotations, len(as))
+	for i, a := range as {
+		if a.Text = strings.TrimSpace(a.Text); a.Text == "" {
+			return nil, fmt.Errorf("an annotation needs text")
+		}
+		if a.Timestamp.IsZero() {
+			a.Timestamp = now
+		}
+		checked[i] = a
+	}
+	if l == nil {
+		return checked, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, a := range checked {
+		if err := l.enc.Encode(a); err != nil {
+			return checked[:i], err
+		}
+		l.added = append(l.added, a)
+	}
+	return checked, nil
+}
+
+// All returns the annotations added so far, in time order
+func (l *AnnotationLog) All() Annotations {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	all := append(Annotations{}, l.added...)
+	l.mu.Unlock()
+	sort.Stable(all)
+	return all
+}
+
+func (l *AnnotationLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// ReadAnnotations reads the annotations written by an AnnotationLog, in time
+// order; a last line only partly written, by a log still being written,
+// is left out.
+func ReadAnnotations(in io.Reader) (Annotations, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(data), "\n")
+	// the last line is empty, unless it's still being written
+	lines = lines[:len(lines)-1]
+	var all Annotations
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var a Annotation
+		if err := json.Unmarshal([]byte(line), &a); err != nil {
+			return nil, fmt.Errorf("bad annotation on line %d: %s", i+1, err)
+		}
+		all = append(all, a)
+	}
+	sort.Stable(all)
+	return all, nil
+}
+
+// annotationMarks draws where each of the annotations falls in the span as
+// a line to go under its sparklines: each is numbered by its place in the
+// annotations, 1 to 9, then +, and a slot with more than one gets a *.
+// It's empty if none fall in the span.
+func (s runSpan) annotationMarks(annotations Annotations) string {
+	if len(annotations) == 0 || !s.end.After(s.start) {
+		return ""
+	}
+	slot := s.slot()
+	marks := []rune(strings.Repeat(" ", sparklineSlots))
+	marked := false
+	for i, a := range annotations {
+		if a.Timestamp.Before(s.start) || a.Timestamp.After(s.end) {
+			continue
+		}
+		idx := int(a.Timestamp.Sub(s.start) / slot)
+		if idx >= sparklineSlots {
+			idx = sparklineSlots - 1
+		}
+		mark := '+'
+		if i < 9 {
+			mark = rune('1' + i)
+		}
+		if marks[idx] != ' ' {
+			mark = '*'
+		}
+		marks[idx] = mark
+		marked = true
+	}
+	if !marked {
+		return ""
+	}
+	return strings.TrimRight(string(marks), " ")
+}
@@ -0,0 +1,103 @@
+package korra
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnnotationLog(t *testing.T) {
+	dir := t.TempDir()
+	log, err := NewAnnotationLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err = log.Add(Annotation{Text: "killed node-3", By: "chaos"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = log.Add(Annotation{Timestamp: start.Add(-time.Minute), Text: " deployed v2.3 "}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = log.Add(Annotation{Text: "  "}); err == nil {
+		t.Fatal("want an error for an annotation without text")
+	}
+	if _, err = log.AddAll(Annotations{{Text: "scaled up"}, {Text: ""}}); err == nil {
+		t.Fatal("want an error for a batch with an annotation without text")
+	}
+	if all := log.All(); len(all) != 2 || all[0].Text != "deployed v2.3" || all[1].By != "chaos" || all[1].Timestamp.Before(start) {
+		t.Fatalf("want both annotations in time order, got: %+v", all)
+	}
+	log.Close()
+
+	// a line still being written is left out
+	file, err := os.OpenFile(AnnotationsPath(dir), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"timestamp":"2026-10-15T`)
+	file.Close()
+	in, err := os.Open(AnnotationsPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	read, err := ReadAnnotations(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || read[0].Text != "deployed v2.3" || read[1].Text != "killed node-3" {
+		t.Fatalf("want the annotations as written, got: %+v", read)
+	}
+	if _, err = ReadAnnotations(strings.NewReader("{\"text\":\"a\"}\nnot json\n")); err == nil {
+		t.Fatal("want an error for a damaged annotations file")
+	}
+
+	var nilLog *AnnotationLog
+	if a, err := nilLog.Add(Annotation{Text: "ignored"}); err != nil || a.Timestamp.IsZero() {
+		t.Fatalf("want adding to no log to do nothing, got: %+v %v", a, err)
+	}
+}
+
+func TestAnnotationsReported(t *testing.T) {
+	start := time.Date(2026, 10, 15, 15, 0, 0, 0, time.UTC)
+	var r Results
+	for i := 0; i < 40; i++ {
+		r = append(r, &Result{Code: 200, Method: "GET", Path: "/a", Timestamp: start.Add(time.Duration(i) * time.Second), Latency: time.Millisecond})
+	}
+	annotations := Annotations{
+		{Timestamp: start.Add(-time.Second), Text: "warmed caches"},
+		{Timestamp: start.Add(10 * time.Second), Text: "deployed v2.3", By: "deploy"},
+		{Timestamp: start.Add(10*time.Second + time.Millisecond), Text: "killed node-3"},
+	}
+	if got := spanOf(r).annotationMarks(annotations); got != strings.Repeat(" ", 10)+"*" {
+		t.Fatalf("want two annotations in one slot marked together, got: %q", got)
+	}
+	if got := spanOf(r).annotationMarks(annotations[:1]); got != "" {
+		t.Fatalf("want nothing marked for an annotation before the run, got: %q", got)
+	}
+
+	out, err := TextReporter{Annotations: annotations}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(out)
+	for _, want := range []string{"ANNOTATIONS: 3", "15:00:10.000", "[+10s]", "deployed v2.3 (deploy)", "[before the run]", "[as listed]"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("want %q in the report, got:\n%s", want, report)
+		}
+	}
+
+	out, err = JSONReporter{Annotations: annotations}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var j struct {
+		Annotations Annotations `json:"annotations"`
+	}
+	if err = json.Unmarshal(out, &j); err != nil || len(j.Annotations) != 3 || j.Annotations[1].By != "deploy" {
+		t.Fatalf("want the annotations in the JSON report, got: %s", out)
+	}
+}
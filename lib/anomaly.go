@@ -0,0 +1,150 @@
+package korra
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// AnomalyThreshold is how many MADs (median absolute deviations, scaled so
+// they compare to standard deviations) a window's mean latency must be above
+// the median of all windows for it to be an anomaly.
+var AnomalyThreshold = 3.5
+
+// minAnomalyWindows is the fewest windows with results there must be for
+// their median to say what's normal
+const minAnomalyWindows = 5
+
+// Anomaly is a stretch of the run, one or more windows in a row, where the
+// latency was far above what it was in the rest of the run -- like a pause
+// for garbage collection or a failover on the target.
+type Anomaly struct {
+	Start   time.Time     `json:"start"`
+	End     time.Time     `json:"end"`
+	Latency time.Duration `json:"latency"` // the highest mean latency of its windows
+	Score   float64       `json:"score"`   // the highest MADs above the median of its windows
+	Results int           `json:"results"`
+}
+
+func (a Anomaly) String() string {
+	return fmt.Sprintf("%s - %s: %s mean latency, %.1f MADs above the median, %d results",
+		a.Start.Format("15:04:05.000"), a.End.Format("15:04:05.000"), a.Latency, a.Score, a.Results)
+}
+
+// DetectAnomalies splits the results into windows of the given width and
+// returns those whose mean latency stands out from the other windows by the
+// AnomalyThreshold, with anomalous windows in a row joined into one. Using the
+// median and MAD rather than the mean and standard deviation keeps the very
+// windows being looked for from hiding themselves by skewing what's normal.
+func DetectAnomalies(r Results, window time.Duration) []Anomaly {
+	if window <= 0 || len(r) == 0 {
+		return nil
+	}
+	start, windows := windowed(r, window)
+	if len(windows) < minAnomalyWindows {
+		return nil
+	}
+	means := make([]float64, len(windows))
+	for i, w := range windows {
+		means[i] = w.meanLatency()
+	}
+
+	median := medianOf(means)
+	deviations := make([]float64, len(means))
+	for i, mean := range means {
+		deviations[i] = math.Abs(mean - median)
+	}
+	// 1.4826 scales the MAD to the standard deviation of normal data; when
+	// over half the windows are the same the MAD is 0, so fall back to the
+	// mean absolute deviation, scaled the same way
+	spread := 1.4826 * medianOf(deviations)
+	if spread == 0 {
+		var total float64
+		for _, deviation := range deviations {
+			total += deviation
+		}
+		spread = 1.2533 * total / float64(len(deviations))
+	}
+	if spread == 0 {
+		return nil
+	}
+
+	var anomalies []Anomaly
+	last := -2
+	for _, w := range windows {
+		mean := w.meanLatency()
+		score := (mean - median) / spread
+		if score < AnomalyThreshold {
+			continue
+		}
+		windowStart := start.Add(time.Duration(w.idx) * window)
+		if w.idx != last+1 || len(anomalies) == 0 {
+			anomalies = append(anomalies, Anomaly{Start: windowStart})
+		}
+		a := &anomalies[len(anomalies)-1]
+		a.End = windowStart.Add(window)
+		a.Results += w.results
+		if latency := time.Duration(mean); latency > a.Latency {
+			a.Latency = latency
+		}
+		if score > a.Score {
+			a.Score = score
+		}
+		last = w.idx
+	}
+	return anomalies
+}
+
+// resultWindow is the results in one window of a run
+type resultWindow struct {
+	idx     int // which window from the start of the run
+	latency time.Duration
+	results int
+	errors  int
+}
+
+func (w *resultWindow) meanLatency() float64 { return float64(w.latency) / float64(w.results) }
+func (w *resultWindow) errorRate() float64   { return float64(w.errors) / float64(w.results) }
+
+// windowed splits the results into windows of the width from the first of
+// them, returning that start and the windows that have results, in order
+func windowed(r Results, width time.Duration) (time.Time, []*resultWindow) {
+	var start time.Time
+	for i, result := range r {
+		if i == 0 || result.Timestamp.Before(start) {
+			start = result.Timestamp
+		}
+	}
+	byIdx := map[int]*resultWindow{}
+	for _, result := range r {
+		idx := int(result.Timestamp.Sub(start) / width)
+		w := byIdx[idx]
+		if w == nil {
+			w = &resultWindow{idx: idx}
+			byIdx[idx] = w
+		}
+		weight := result.weight()
+		w.latency += result.Latency * time.Duration(weight)
+		w.results += weight
+		if result.Error != "" {
+			w.errors += weight
+		}
+	}
+	windows := make([]*resultWindow, 0, len(byIdx))
+	for _, w := range byIdx {
+		windows = append(windows, w)
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].idx < windows[j].idx })
+	return start, windows
+}
+
+// medianOf returns the median of the values, reordering them
+func medianOf(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
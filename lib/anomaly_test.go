@@ -0,0 +1,51 @@
+package korra
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	var r Results
+	// twenty seconds of steady traffic with a little noise, and a pause
+	// covering seconds 12 and 13
+	for sec := 0; sec < 20; sec++ {
+		for i := 0; i < 10; i++ {
+			latency := time.Duration(95+i) * time.Millisecond
+			if sec == 12 || sec == 13 {
+				latency = 2 * time.Second
+			}
+			r = append(r, &Result{Timestamp: start.Add(time.Duration(sec)*time.Second + time.Duration(i)*100*time.Millisecond), Latency: latency})
+		}
+	}
+	anomalies := DetectAnomalies(r, time.Second)
+	if len(anomalies) != 1 {
+		t.Fatalf("want one anomaly, got: %v", anomalies)
+	}
+	a := anomalies[0]
+	if !a.Start.Equal(start.Add(12*time.Second)) || !a.End.Equal(start.Add(14*time.Second)) {
+		t.Fatalf("want the anomaly from 12s to 14s, got: %s", a)
+	}
+	if a.Results != 20 || a.Latency != 2*time.Second || a.Score < AnomalyThreshold {
+		t.Fatalf("want 20 results at 2s, got: %s", a)
+	}
+
+	if got := DetectAnomalies(r[:40], time.Second); got != nil {
+		t.Fatalf("want none for too few windows, got: %v", got)
+	}
+	if got := DetectAnomalies(r, 0); got != nil {
+		t.Fatalf("want none without a window, got: %v", got)
+	}
+}
+
+func TestDetectAnomaliesSteady(t *testing.T) {
+	start := time.Now()
+	var r Results
+	for sec := 0; sec < 20; sec++ {
+		r = append(r, &Result{Timestamp: start.Add(time.Duration(sec) * time.Second), Latency: 100 * time.Millisecond})
+	}
+	if got := DetectAnomalies(r, time.Second); got != nil {
+		t.Fatalf("want none when every window is the same, got: %v", got)
+	}
+}
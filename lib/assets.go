@@ -0,0 +1,221 @@
+package korra
+
+import (
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// htmlComment matches the comments an HTML page's references may be
+	// commented out in
+	htmlComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+	// assetTag matches the tags that reference what a browser fetches to
+	// show a page, with their attributes
+	assetTag = regexp.MustCompile(`(?i)<(link|script|img|base)\b([^>]*)>`)
+	// tagAttribute matches an attribute of a tag, quoted or not
+	tagAttribute = regexp.MustCompile(`([a-zA-Z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	// assetRels are the rel values of links to assets a browser fetches
+	assetRels = map[string]bool{"stylesheet": true, "icon": true, "preload": true, "modulepreload": true}
+)
+
+// isHTML returns true if the Content-Type is of an HTML page
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// pageAssets returns the URLs of the stylesheets, scripts, icons, preloads
+// and images the HTML page fetched from the URL references, resolved
+// against it (or its <base>), once each and in the order they come.
+func pageAssets(body []byte, page string) []string {
+	base, err := url.Parse(page)
+	if err != nil {
+		return nil
+	}
+	var (
+		assets []string
+		seen   = map[string]bool{}
+	)
+	for _, tag := range assetTag.FindAllStringSubmatch(htmlComment.ReplaceAllString(string(body), ""), -1) {
+		attrs := map[string]string{}
+		for _, attr := range tagAttribute.FindAllStringSubmatch(tag[2], -1) {
+			attrs[strings.ToLower(attr[1])] = html.UnescapeString(attr[2] + attr[3] + attr[4])
+		}
+		var ref string
+		switch strings.ToLower(tag[1]) {
+		case "base":
+			if resolved, err := base.Parse(attrs["href"]); err == nil && attrs["href"] != "" {
+				base = resolved
+			}
+			continue
+		case "link":
+			for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+				if assetRels[rel] {
+					ref = attrs["href"]
+				}
+			}
+		default:
+			ref = attrs["src"]
+		}
+		if ref = strings.TrimSpace(ref); ref == "" {
+			continue
+		}
+		resolved, err := base.Parse(ref)
+		if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+			continue // data: URIs and the like aren't fetched
+		}
+		resolved.Fragment = ""
+		if asset := resolved.String(); !seen[asset] {
+			seen[asset] = true
+			assets = append(assets, asset)
+		}
+	}
+	return assets
+}
+
+// asset returns a Target for an asset of the page, fetched with the page's
+// headers, as the page refers to it, and its timeouts
+func asset(page *Target, assetURL string) *Target {
+	tgt := NewTarget()
+	tgt.Method, tgt.URL, tgt.Timeouts = "GET", assetURL, page.Timeouts
+	tgt.Header = page.Header.Clone()
+	if tgt.Header == nil {
+		tgt.Header = http.Header{}
+	}
+	if tgt.Header.Get("Referer") == "" {
+		tgt.Header.Set("Referer", page.URL)
+	}
+	return tgt
+}
+
+// fetchAssets fetches the assets of the HTML page the target's result is,
+// Assets at a time, as a browser loading it would. Each is a result of its
+// own, with the page's path as its Page, and the page's result records how
+// long it took to be complete with them (see Result.PageLoad).
+func (session *Session) fetchAssets(target *Target, page *Result) {
+	assets := pageAssets(page.body, target.URL)
+	var (
+		urls    = make(chan string)
+		results = make(chan *Result)
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < session.Assets && i < len(assets); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range urls {
+				session.Gate.wait(session.aborted)
+				tgt := asset(target, u)
+				results <- session.attacker.Hit(func() (*Target, error) { return tgt, nil }, time.Now(), 1)
+			}
+		}()
+	}
+	go func() {
+		defer close(results)
+		defer wg.Wait()
+		defer close(urls)
+		for _, u := range assets {
+			select {
+			case urls <- u:
+			case <-session.aborted:
+				return
+			}
+		}
+	}()
+	loaded := page.Timestamp.Add(page.Latency)
+	for result := range results {
+		if result.Error == ErrLimitAborted.Error() {
+			continue
+		}
+		result.Page = page.Path
+		session.debug(fmt.Sprintf("%d => asset %s %s, %d ms",
+			result.Code, result.Method, result.Path, int64(result.Latency/time.Millisecond)))
+		if end := result.Timestamp.Add(result.Latency); end.After(loaded) {
+			loaded = end
+		}
+		session.send(result)
+	}
+	page.PageLoad = loaded.Sub(page.Timestamp)
+	session.debug(fmt.Sprintf("Page %s %s loaded with %d assets in %d ms",
+		page.Method, page.Path, len(assets), int64(page.PageLoad/time.Millisecond)))
+}
+
+// pageShard is what a metrics shard adds up the pages and their assets from
+type pageShard struct {
+	pageLoads quantiles
+	pageLoad  time.Duration
+}
+
+func newPageShard(count int) *pageShard {
+	return &pageShard{pageLoads: newQuantiles(count, 0)}
+}
+
+// add counts an asset, or a page loaded with its assets, towards the assets
+func (ps *pageShard) add(m *Metrics, result *Result, w int) {
+	a := &m.Assets
+	if result.Page != "" {
+		a.Total += uint64(w)
+	}
+	if result.PageLoad == 0 {
+		return
+	}
+	a.Pages += uint64(w)
+	ps.pageLoad += result.PageLoad * time.Duration(w)
+	for i := 0; i < w; i++ {
+		ps.pageLoads.Insert(float64(result.PageLoad))
+	}
+	if result.PageLoad > a.PageLoad.Max {
+		a.PageLoad.Max = result.PageLoad
+	}
+}
+
+func (ps *pageShard) merge(m, om *Metrics, o *pageShard) {
+	a, oa := &m.Assets, &om.Assets
+	ps.pageLoads.merge(o.pageLoads)
+	ps.pageLoad += o.pageLoad
+	a.Total += oa.Total
+	a.Pages += oa.Pages
+	if oa.PageLoad.Max > a.PageLoad.Max {
+		a.PageLoad.Max = oa.PageLoad.Max
+	}
+}
+
+// finish computes the mean and percentiles of the page complete times
+func (ps *pageShard) finish(m *Metrics) {
+	a := &m.Assets
+	if a.Pages == 0 {
+		return
+	}
+	a.PageLoad.Mean = time.Duration(float64(ps.pageLoad) / float64(a.Pages))
+	a.PageLoad.P50 = time.Duration(ps.pageLoads.Query(0.50))
+	a.PageLoad.P95 = time.Duration(ps.pageLoads.Query(0.95))
+	a.PageLoad.P99 = time.Duration(ps.pageLoads.Query(0.99))
+}
+
+// SplitPages groups the HTML pages assets were fetched for with their
+// assets, by the page's path, returning the paths sorted; results that are
+// neither are left out.
+func SplitPages(r Results) ([]string, map[string]Results) {
+	byPage := map[string]Results{}
+	for _, result := range r {
+		if page := result.Page; page != "" {
+			byPage[page] = append(byPage[page], result)
+		} else if result.PageLoad > 0 {
+			byPage[result.Path] = append(byPage[result.Path], result)
+		}
+	}
+	pages := make([]string, 0, len(byPage))
+	for page := range byPage {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+	return pages, byPage
+}
@@ -0,0 +1,150 @@
+package korra
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPageAssets(t *testing.T) {
+	page := `<!doctype html>
+<html><head>
+  <link rel="stylesheet" href="/css/site.css?v=1&amp;x=2">
+  <link rel="canonical" href="http://example.com/">
+  <link rel="preload icon" href='img/logo.png'>
+  <script src=app.js></script>
+  <script>var inline = true;</script>
+  <!-- <script src="commented.js"></script> -->
+</head><body>
+  <IMG SRC="//cdn.example.com/hero.jpg#top" alt="hero">
+  <img src="data:image/gif;base64,R0lGOD">
+  <img src="app.js">
+</body></html>`
+	got := strings.Join(pageAssets([]byte(page), "http://example.com/shop/index.html"), " ")
+	want := "http://example.com/css/site.css?v=1&x=2 http://example.com/shop/img/logo.png http://example.com/shop/app.js http://cdn.example.com/hero.jpg"
+	if got != want {
+		t.Fatalf("want %s, got: %s", want, got)
+	}
+
+	based := `<base href="http://static.example.com/v2/"><script src="app.js"></script>`
+	if got := pageAssets([]byte(based), "http://example.com/"); len(got) != 1 || got[0] != "http://static.example.com/v2/app.js" {
+		t.Fatalf("want the asset resolved against the base, got: %v", got)
+	}
+	for contentType, want := range map[string]bool{"text/html; charset=utf-8": true, "application/xhtml+xml": true, "text/plain": false, "": false} {
+		if isHTML(contentType) != want {
+			t.Errorf("want %t for '%s'", want, contentType)
+		}
+	}
+}
+
+func TestFetchAssets(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		assets   []string
+		inFlight int
+		most     int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Header().Set("Content-Type", "text/html")
+			for i := 0; i < 6; i++ {
+				fmt.Fprintf(w, "<img src=\"/img/%d.png\">", i)
+			}
+			return
+		}
+		mu.Lock()
+		assets = append(assets, r.URL.Path+" "+r.Header.Get("Referer"))
+		inFlight++
+		if inFlight > most {
+			most = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	action := &SessionAction{Raw: "GET " + server.URL + "/", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{Assets: 2, attacker: NewAttacker(), aborted: make(chan struct{}), results: make(chan *Result, 10)}
+	session.doHttp(action)
+	close(session.results)
+	var results Results
+	for result := range session.results {
+		results = append(results, result)
+	}
+
+	sort.Strings(assets)
+	if len(assets) != 6 || assets[0] != "/img/0.png "+server.URL+"/" {
+		t.Fatalf("want every image fetched with the page as the referer, got: %v", assets)
+	}
+	if most != 2 {
+		t.Fatalf("want 2 assets at a time, got %d", most)
+	}
+	if len(results) != 7 {
+		t.Fatalf("want a result each for the assets and the page, got %d", len(results))
+	}
+	page := results[6]
+	if page.Page != "" || page.PageLoad < 60*time.Millisecond || page.PageLoad < page.Latency {
+		t.Fatalf("want the page last, loaded with 3 rounds of its assets, got: %+v", page)
+	}
+	for _, r := range results[:6] {
+		if r.Page != "/" || r.PageLoad != 0 || r.Code != 200 {
+			t.Fatalf("want an asset, got: %+v", r)
+		}
+	}
+
+	m := NewMetrics(results)
+	if m.Requests != 7 || m.Assets.Total != 6 || m.Assets.Pages != 1 || m.Assets.PageLoad.Max != page.PageLoad {
+		t.Fatalf("bad asset metrics: %d requests, %+v", m.Requests, m.Assets)
+	}
+
+	// without -assets, the page is all there is
+	session.Assets, session.results = 0, make(chan *Result, 10)
+	session.doHttp(action)
+	if first := <-session.results; first.PageLoad != 0 || first.body != nil || len(session.results) != 0 {
+		t.Fatalf("want the page alone, got: %+v", first)
+	}
+}
+
+func TestPageSections(t *testing.T) {
+	now := time.Now()
+	r := Results{
+		{Method: "GET", Path: "/shop", Code: 200, Timestamp: now, Latency: 40 * time.Millisecond, PageLoad: 300 * time.Millisecond},
+		{Method: "GET", Path: "/css/site.css", Code: 200, Timestamp: now, Latency: 20 * time.Millisecond, Page: "/shop"},
+		{Method: "GET", Path: "/js/app.js", Code: 200, Timestamp: now, Latency: 260 * time.Millisecond, Page: "/shop"},
+		{Method: "GET", Path: "/about", Code: 200, Timestamp: now, Latency: 30 * time.Millisecond, PageLoad: 100 * time.Millisecond},
+		{Method: "GET", Path: "/api/cart", Code: 200, Timestamp: now, Latency: 10 * time.Millisecond},
+	}
+	pages, byPage := SplitPages(r)
+	if strings.Join(pages, " ") != "/about /shop" || len(byPage["/shop"]) != 3 || len(byPage["/about"]) != 1 {
+		t.Fatalf("want the pages with their assets, got: %v, %v", pages, byPage)
+	}
+
+	m := NewMetrics(r)
+	if p := m.Assets.PageLoad; m.Assets.Pages != 2 || p.Mean != 200*time.Millisecond || p.Max != 300*time.Millisecond || p.P50 == 0 {
+		t.Fatalf("bad page complete times: %+v", m.Assets)
+	}
+	report, err := TextReporter{}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"PAGE /about: 1 results", "PAGE /shop: 3 results", "Page Complete"} {
+		if !strings.Contains(string(report), want) {
+			t.Errorf("want '%s' in the report:\n%s", want, report)
+		}
+	}
+	data := NewReportData(r, BucketCollection{}, SectionOptions{})
+	if len(data.Pages) != 2 || data.Pages[1].Name != "/shop" || data.Pages[1].Metrics.Requests != 3 {
+		t.Fatalf("want a section for each page, got: %+v", data.Pages)
+	}
+}
@@ -1,19 +1,41 @@
 package korra
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"hash"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 // Attacker is an attack executor which wraps an http.Client
 type Attacker struct {
-	dialer    *net.Dialer
-	client    http.Client
-	redirects int
+	abort      <-chan struct{} // stops waiting on the limiters when closed
+	base       *url.URL
+	cache      *clientCache
+	captures   *Captures
+	dialer     *net.Dialer
+	client     http.Client
+	conditions NetworkConditions
+	dumps      bool // keep each request and response in its result
+	fresh      bool
+	fuzz       float64 // the percentage of requests to fuzz
+	header     http.Header
+	limiters   *Limiters
+	random     *Random
+	record     []string // the response headers to record
+	redirects  int
+	resolver   *resolver
+	timeouts   Timeouts
+	tracer     *Tracer
+	transfers  bool // read every response body to the end
 }
 
 var (
@@ -35,7 +57,7 @@ var (
 // NewAttacker returns a new Attacker with default options which are overridden
 // by the optionally provided opts.
 func NewAttacker(opts ...func(*Attacker)) *Attacker {
-	a := &Attacker{}
+	a := &Attacker{resolver: newResolver(DNSOptions{})}
 	a.dialer = &net.Dialer{
 		LocalAddr: &net.TCPAddr{IP: DefaultLocalAddr.IP, Zone: DefaultLocalAddr.Zone},
 		KeepAlive: 30 * time.Second,
@@ -43,8 +65,8 @@ func NewAttacker(opts ...func(*Attacker)) *Attacker {
 	}
 	a.client = http.Client{
 		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			Dial:  a.dialer.Dial,
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           a.dial,
 			ResponseHeaderTimeout: DefaultTimeout,
 			TLSClientConfig:       DefaultTLSConfig,
 			TLSHandshakeTimeout:   10 * time.Second,
@@ -53,9 +75,32 @@ func NewAttacker(opts ...func(*Attacker)) *Attacker {
 	for _, opt := range opts {
 		opt(a)
 	}
+	a.conditions.random = a.random
 	return a
 }
 
+// dial resolves and connects with the Attacker's dialer and applies any
+// network conditions to the resulting connection.
+func (a *Attacker) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if a.conditions.Active() {
+		// the connection handshake's round trip, cut short like the dial
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(a.conditions.delay()):
+		}
+	}
+	conn, err := a.resolver.dial(ctx, a.dialer, network, address)
+	if err != nil {
+		return nil, err
+	}
+	conn = a.conditions.Wrap(conn)
+	if a.captures != nil {
+		conn = newTappedConn(conn)
+	}
+	return conn, nil
+}
+
 // KeepAlive returns a functional option which toggles KeepAlive
 // connections on the dialer and transport.
 func KeepAlive(keepalive bool) func(*Attacker) {
@@ -64,7 +109,7 @@ func KeepAlive(keepalive bool) func(*Attacker) {
 		tr.DisableKeepAlives = !keepalive
 		if !keepalive {
 			a.dialer.KeepAlive = 0
-			tr.Dial = a.dialer.Dial
+			tr.DialContext = a.dial
 		}
 	}
 }
@@ -75,7 +120,78 @@ func LocalAddr(addr net.IPAddr) func(*Attacker) {
 	return func(a *Attacker) {
 		tr := a.client.Transport.(*http.Transport)
 		a.dialer.LocalAddr = &net.TCPAddr{IP: addr.IP, Zone: addr.Zone}
-		tr.Dial = a.dialer.Dial
+		tr.DialContext = a.dial
+	}
+}
+
+// Conditions returns a functional option which shapes every connection
+// an Attacker makes with the given network conditions.
+func Conditions(nc NetworkConditions) func(*Attacker) {
+	return func(a *Attacker) {
+		a.conditions = nc
+	}
+}
+
+// BaseURL returns a functional option which sends every request an Attacker
+// makes to the base URL instead of the scheme and host in its target, and
+// tags its results with it.
+func BaseURL(base *url.URL) func(*Attacker) {
+	return func(a *Attacker) {
+		a.base = base
+	}
+}
+
+// Headers returns a functional option which adds headers to every request
+// an Attacker makes that doesn't already set them; for a header given more
+// than once the last option wins.
+func Headers(header http.Header) func(*Attacker) {
+	return func(a *Attacker) {
+		if a.header == nil {
+			a.header = http.Header{}
+		}
+		for k, vs := range header {
+			a.header[k] = vs
+		}
+	}
+}
+
+// addHeaders adds the Attacker's headers to the request, unless they're set
+func (a *Attacker) addHeaders(request *http.Request) {
+	for k, vs := range a.header {
+		if _, ok := request.Header[k]; !ok {
+			request.Header[k] = append([]string{}, vs...)
+		}
+	}
+}
+
+// RecordHeaders returns a functional option which records the values of the
+// named response headers in each Result, like X-Cache or X-Backend, for the
+// report to count.
+func RecordHeaders(names ...string) func(*Attacker) {
+	return func(a *Attacker) {
+		a.record = a.record[:0]
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" {
+				a.record = append(a.record, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+}
+
+// Seed returns a functional option which makes every random choice an
+// Attacker makes, like network jitter and resets, reproducible.
+func Seed(seed int64) func(*Attacker) {
+	return func(a *Attacker) {
+		a.random = NewRandom(seed)
+	}
+}
+
+// Limits returns a functional option which sets the rate and concurrency
+// limiters an Attacker waits on before each request; share them between
+// Attackers to cap traffic across sessions.
+func Limits(ls *Limiters) func(*Attacker) {
+	return func(a *Attacker) {
+		a.limiters = ls
 	}
 }
 
@@ -100,7 +216,15 @@ func Timeout(d time.Duration) func(*Attacker) {
 		tr := a.client.Transport.(*http.Transport)
 		tr.ResponseHeaderTimeout = d
 		a.dialer.Timeout = d
-		tr.Dial = a.dialer.Dial
+		tr.DialContext = a.dial
+	}
+}
+
+// PhaseTimeouts returns a functional option which sets the default time
+// allowed for each phase of a request; a step may override any of them.
+func PhaseTimeouts(t Timeouts) func(*Attacker) {
+	return func(a *Attacker) {
+		a.timeouts = t
 	}
 }
 
@@ -113,6 +237,40 @@ func TLSConfig(c *tls.Config) func(*Attacker) {
 	}
 }
 
+// ClientCache returns a functional option which toggles simulating a
+// browser cache, where the Attacker remembers the ETag and Last-Modified
+// of every GET and HEAD response and sends conditional requests for them.
+func ClientCache(enabled bool) func(*Attacker) {
+	return func(a *Attacker) {
+		a.cache = nil
+		if enabled {
+			a.cache = newClientCache()
+		}
+	}
+}
+
+// DNS returns a functional option which sets how an Attacker resolves the
+// hosts it connects to.
+func DNS(opts DNSOptions) func(*Attacker) {
+	return func(a *Attacker) {
+		a.resolver = newResolver(opts)
+	}
+}
+
+// FreshConnections toggles whether every request the Attacker sends opens a
+// new connection, rather than reusing one from its pool; switching it on
+// drops any pooled connections so the next request can't reuse them.
+func (a *Attacker) FreshConnections(fresh bool) {
+	if fresh && !a.fresh {
+		a.client.Transport.(*http.Transport).CloseIdleConnections()
+	}
+	a.fresh = fresh
+}
+
+// inFlight is how many requests every Attacker has sent between them and
+// not had answered yet
+var inFlight int64
+
 // Hit reads the next target from the targeter and sends the HTTP request with
 // the headers and body from the Target, recording the bytes sent and received,
 // the status code and error message.
@@ -123,6 +281,9 @@ func (a *Attacker) Hit(targeter Targeter, tm time.Time, requestCount int) *Resul
 		response *http.Response
 		result   = Result{Timestamp: tm, RequestCount: requestCount}
 		tgt      *Target
+		traced   bool
+		sent     int64
+		tap      *connTrace
 	)
 
 	defer func() {
@@ -130,6 +291,18 @@ func (a *Attacker) Hit(targeter Targeter, tm time.Time, requestCount int) *Resul
 		if err != nil {
 			result.Error = err.Error()
 		}
+		if conn := tap.tapped(); conn != nil {
+			if result.Error != "" {
+				a.captures.save(conn, &result)
+			}
+			conn.reset()
+		}
+		if traced {
+			a.tracer.write(sent, &result)
+			if !a.dumps {
+				result.dump = ""
+			}
+		}
 	}()
 
 	if tgt, err = targeter(); err != nil {
@@ -137,31 +310,144 @@ func (a *Attacker) Hit(targeter Targeter, tm time.Time, requestCount int) *Resul
 	}
 	result.Method = tgt.Method
 	result.PathFromURL(tgt.URL)
+	result.Target = targetLabel(a.base)
+
+	// time spent waiting on limits isn't part of the request
+	if a.limiters != nil {
+		release, ok := a.limiters.acquire(tgt, a.abort)
+		if !ok {
+			err = ErrLimitAborted
+			return &result
+		}
+		defer release()
+		tm = time.Now()
+		result.Timestamp = tm
+	}
+	result.InFlight = int(atomic.AddInt64(&inFlight, 1))
+	defer atomic.AddInt64(&inFlight, -1)
 
 	if request, err = tgt.Request(); err != nil {
 		return &result
 	}
+	rebase(request, a.base)
+	a.addHeaders(request)
+	request.Close = a.fresh
+	if sent, traced = a.tracer.sample(); a.dumps || traced {
+		result.dump = dumpRequest(request)
+	}
+	// a range is part of a response, which the cache doesn't keep
+	cached := a.cache != nil && request.Header.Get("Range") == ""
+	if cached {
+		result.Conditional = a.cache.prepare(request)
+	}
+	dns := &dnsTrace{}
+	request = request.WithContext(context.WithValue(request.Context(), dnsTraceKey{}, dns))
+	defer func() {
+		dns.Lock()
+		result.DNSLatency, result.DNSResolver = dns.latency, dns.from
+		dns.Unlock()
+	}()
+	handshake := &tlsTrace{}
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), handshake.clientTrace()))
+	if a.captures != nil {
+		tap = &connTrace{}
+		request = request.WithContext(httptrace.WithClientTrace(request.Context(), tap.clientTrace()))
+	}
+	firstByte := &firstByteTrace{start: tm}
+	transfer := a.transfers || tgt.IsRanges() || tgt.IsPlayback()
+	if transfer {
+		request = request.WithContext(httptrace.WithClientTrace(request.Context(), firstByte.clientTrace()))
+	}
+	defer func() {
+		handshake.Lock()
+		result.TLSHandshake, result.TLSResumed = handshake.latency, handshake.resumed
+		handshake.Unlock()
+	}()
+
+	if timeouts := a.timeouts.Merge(tgt.Timeouts); timeouts.Active() {
+		var timer *phaseTimer
+		request, timer = timeouts.bind(request)
+		defer func() { err = timer.finish(err) }()
+	}
 
-	if response, err = a.client.Do(request); err != nil {
+	if result.Fuzz = a.fuzzKind(); result.Fuzz != "" {
+		response, err = a.sendFuzzed(request, result.Fuzz)
+	} else {
+		response, err = a.client.Do(request)
+	}
+	if err != nil {
 		// ignore redirect errors when the user set --redirects=NoFollow
 		if a.redirects == NoFollow && strings.Contains(err.Error(), "stopped after") {
 			err = nil
 		}
 		return &result
 	}
+	var (
+		counted           = &countingReader{r: response.Body}
+		body    io.Reader = counted
+		digest  hash.Hash
+	)
+	if tgt.Checksum != nil {
+		digest = tgt.Checksum.hash()
+		body = io.TeeReader(body, digest)
+	}
+	keep := tgt.keepBody || tgt.assets && isHTML(response.Header.Get("Content-Type"))
+	if len(tgt.Saves) > 0 || keep || result.dump != "" {
+		saveBody, _ := io.ReadAll(io.LimitReader(body, saveBodyLimit))
+		if result.dump != "" {
+			result.dump += "\n" + dumpResponse(response, saveBody)
+		}
+		if len(tgt.Saves) > 0 {
+			result.saved = saveValues(tgt.Saves, saveBody)
+		}
+		if keep {
+			result.body = saveBody
+		}
+	}
+	if tgt.IsRanges() {
+		result.size = objectSize(response)
+	}
+	if digest != nil || transfer {
+		// the whole body, so the checksum is of what the server really sent
+		_, copyErr := io.Copy(io.Discard, body)
+		if transfer {
+			result.FirstByte, result.LastByte = firstByte.firstByte(), time.Since(tm)
+			result.BytesIn = uint64(counted.n)
+		}
+		if err = copyErr; err != nil {
+			response.Body.Close()
+			return &result
+		}
+	}
 	response.Body.Close()
+	if cached {
+		a.cache.store(request, response)
+	}
+	for _, name := range a.record {
+		if value := response.Header.Get(name); value != "" {
+			if result.Headers == nil {
+				result.Headers = map[string]string{}
+			}
+			result.Headers[name] = value
+		}
+	}
 
 	if request.ContentLength != -1 {
 		result.BytesOut = uint64(request.ContentLength)
 	}
 
-	if response.ContentLength != -1 {
+	if response.ContentLength != -1 && !transfer {
 		result.BytesIn = uint64(response.ContentLength)
 	}
 
 	if result.Code = uint16(response.StatusCode); result.HasErrorCode() {
 		result.Error = response.Status
 	}
+	if digest != nil && result.Error == "" {
+		if mismatch := tgt.Checksum.verify(digest.Sum(nil), response.Header); mismatch != nil {
+			result.Corrupt, result.Error = true, mismatch.Error()
+		}
+	}
 
 	return &result
 }
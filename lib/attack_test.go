@@ -13,19 +13,26 @@ import (
 	"time"
 )
 
+// staticTargeter returns a Targeter always giving the target
+func staticTargeter(tgt *Target) Targeter {
+	return func() (*Target, error) { return tgt, nil }
+}
+
 func TestAttackRate(t *testing.T) {
 	server := httptest.NewServer(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
 	)
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
+	tr := staticTargeter(&Target{Method: "GET", URL: server.URL})
 	rate := uint64(100)
-	atk := NewAttacker()
+	limiters := NewLimiters()
+	limiters.AddBucket("GET", "/", Limit{Rate: float64(rate)})
+	atk := NewAttacker(Limits(limiters))
 	var hits uint64
-	for _ = range atk.Attack(tr, rate, 1*time.Second) {
-		hits++
+	for end := time.Now().Add(1 * time.Second); time.Now().Before(end); hits++ {
+		atk.Hit(tr, time.Now(), 1)
 	}
-	if got, want := hits, rate; got != want {
-		t.Fatalf("got: %v, want: %v", rate, hits)
+	if got, want := hits, rate; got < want-5 || got > want+1 {
+		t.Fatalf("got: %v, want: %v", got, want)
 	}
 }
 
@@ -45,8 +52,8 @@ func TestRedirects(t *testing.T) {
 	)
 	redirects := 2
 	atk := NewAttacker(Redirects(redirects))
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
-	res := atk.hit(tr, time.Now())
+	tr := staticTargeter(&Target{Method: "GET", URL: server.URL})
+	res := atk.Hit(tr, time.Now(), 1)
 	want := fmt.Sprintf("stopped after %d redirects", redirects)
 	if got := res.Error; !strings.HasSuffix(got, want) {
 		t.Fatalf("want: '%v' in '%v'", want, got)
@@ -60,8 +67,8 @@ func TestNoFollow(t *testing.T) {
 		}),
 	)
 	atk := NewAttacker(Redirects(NoFollow))
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
-	if res := atk.hit(tr, time.Now()); res.Error != "" {
+	tr := staticTargeter(&Target{Method: "GET", URL: server.URL})
+	if res := atk.Hit(tr, time.Now(), 1); res.Error != "" {
 		t.Fatalf("got err: %v", res.Error)
 	}
 }
@@ -73,8 +80,8 @@ func TestTimeout(t *testing.T) {
 		}),
 	)
 	atk := NewAttacker(Timeout(10 * time.Millisecond))
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
-	res := atk.hit(tr, time.Now())
+	tr := staticTargeter(&Target{Method: "GET", URL: server.URL})
+	res := atk.Hit(tr, time.Now(), 1)
 	want := "net/http: timeout awaiting response headers"
 	if got := res.Error; !strings.HasSuffix(got, want) {
 		t.Fatalf("want: '%v' in '%v'", want, got)
@@ -96,8 +103,8 @@ func TestLocalAddr(t *testing.T) {
 		}),
 	)
 	atk := NewAttacker(LocalAddr(*addr))
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
-	atk.hit(tr, time.Now())
+	tr := staticTargeter(&Target{Method: "GET", URL: server.URL})
+	atk.Hit(tr, time.Now(), 1)
 }
 
 func TestKeepAlive(t *testing.T) {
@@ -118,8 +125,8 @@ func TestStatusCodeErrors(t *testing.T) {
 		}),
 	)
 	atk := NewAttacker()
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
-	res := atk.hit(tr, time.Now())
+	tr := staticTargeter(&Target{Method: "GET", URL: server.URL})
+	res := atk.Hit(tr, time.Now(), 1)
 	if got, want := res.Error, "400 Bad Request"; got != want {
 		t.Fatalf("got: %v, want: %v", got, want)
 	}
@@ -128,7 +135,7 @@ func TestStatusCodeErrors(t *testing.T) {
 func TestBadTargeterError(t *testing.T) {
 	atk := NewAttacker()
 	tr := func() (*Target, error) { return nil, io.EOF }
-	res := atk.hit(tr, time.Now())
+	res := atk.Hit(tr, time.Now(), 1)
 	if got, want := res.Error, io.EOF.Error(); got != want {
 		t.Fatalf("got: %v, want: %v", got, want)
 	}
@@ -0,0 +1,123 @@
+package korra
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// WeightedTarget is a base URL to send sessions to, and its share of them
+// relative to the other targets
+type WeightedTarget struct {
+	URL    *url.URL
+	Weight int
+}
+
+// ParseWeightedTarget reads a target as a base URL, optionally followed by
+// '=' and its weight (default 1):
+//
+//	https://us-east.example.com=3
+func ParseWeightedTarget(value string) (WeightedTarget, error) {
+	target := WeightedTarget{Weight: 1}
+	if idx := strings.LastIndex(value, "="); idx >= 0 {
+		weight, err := strconv.Atoi(value[idx+1:])
+		if err != nil || weight < 1 {
+			return target, fmt.Errorf("Expected positive int as weight for target, got: %s", value[idx+1:])
+		}
+		target.Weight = weight
+		value = value[:idx]
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return target, fmt.Errorf("Expected a base URL like https://host:port for target, got: %s", value)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	target.URL = u
+	return target, nil
+}
+
+func (t WeightedTarget) String() string {
+	return fmt.Sprintf("%s=%d", t.URL, t.Weight)
+}
+
+// smoothWeights picks indexes in proportion to their weights, interleaving
+// them as evenly as it can (the 'smooth' weighted round robin), so any run
+// of picks is spread close to the weights.
+type smoothWeights struct {
+	weights []int
+	current []int
+	total   int
+}
+
+func newSmoothWeights(weights []int) *smoothWeights {
+	w := &smoothWeights{weights: weights, current: make([]int, len(weights))}
+	for _, weight := range weights {
+		w.total += weight
+	}
+	return w
+}
+
+// next returns the next index, or -1 if there aren't any
+func (w *smoothWeights) next() int {
+	if len(w.weights) == 0 {
+		return -1
+	}
+	best := 0
+	for idx, weight := range w.weights {
+		w.current[idx] += weight
+		if w.current[idx] > w.current[best] {
+			best = idx
+		}
+	}
+	w.current[best] -= w.total
+	return best
+}
+
+// Balancer hands out targets in proportion to their weights, spread evenly
+type Balancer struct {
+	targets []WeightedTarget
+	weights *smoothWeights
+}
+
+func NewBalancer(targets []WeightedTarget) *Balancer {
+	weights := make([]int, len(targets))
+	for idx, target := range targets {
+		weights[idx] = target.Weight
+	}
+	return &Balancer{targets: targets, weights: newSmoothWeights(weights)}
+}
+
+// Next returns the next target, or nil if there aren't any
+func (b *Balancer) Next() *url.URL {
+	if idx := b.weights.next(); idx >= 0 {
+		return b.targets[idx].URL
+	}
+	return nil
+}
+
+// targetLabel is how results from an Attacker with the base URL are tagged
+func targetLabel(base *url.URL) string {
+	if base == nil {
+		return ""
+	}
+	return base.String()
+}
+
+// rebase points the request at the base URL: its scheme and host replace
+// the request's, and any path prefixes the request's path.
+func rebase(request *http.Request, base *url.URL) {
+	if base == nil {
+		return
+	}
+	request.URL.Scheme = base.Scheme
+	request.URL.Host = base.Host
+	request.URL.Path = base.Path + request.URL.Path
+	if request.URL.RawPath != "" {
+		request.URL.RawPath = base.EscapedPath() + request.URL.RawPath
+	}
+	if request.Header.Get("Host") == "" {
+		request.Host = base.Host
+	}
+}
@@ -0,0 +1,62 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBalancerWeights(t *testing.T) {
+	var targets []WeightedTarget
+	for _, value := range []string{"https://us.foo=3", "https://eu.foo", "http://ap.foo:8080/v2/=2"} {
+		target, err := ParseWeightedTarget(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, target)
+	}
+	balancer := NewBalancer(targets)
+	var hosts []string
+	for i := 0; i < 6; i++ {
+		hosts = append(hosts, balancer.Next().Host)
+	}
+	if got, want := strings.Join(hosts, ","), "us.foo,ap.foo:8080,us.foo,eu.foo,ap.foo:8080,us.foo"; got != want {
+		t.Fatalf("Expected targets %s, got %s", want, got)
+	}
+	if targets[2].URL.Path != "/v2" {
+		t.Fatalf("Expected trailing slash trimmed from path, got %s", targets[2].URL.Path)
+	}
+	for _, bad := range []string{"us.foo", "https://us.foo=0", "https://us.foo=many"} {
+		if _, err := ParseWeightedTarget(bad); err == nil {
+			t.Fatalf("Expected error parsing target '%s'", bad)
+		}
+	}
+}
+
+func TestAttackerBaseURL(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	defer server.Close()
+	target, err := ParseWeightedTarget(server.URL + "/prefix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attacker := NewAttacker(BaseURL(target.URL))
+	tgt := NewTarget()
+	tgt.Method = "GET"
+	tgt.URL = "http://somewhere.invalid/foo/bar"
+	result := attacker.Hit(func() (*Target, error) { return tgt, nil }, time.Now(), 1)
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	if path != "/prefix/foo/bar" {
+		t.Fatalf("Expected request to /prefix/foo/bar, got %s", path)
+	}
+	if result.Path != "/foo/bar" || result.Target != target.URL.String() {
+		t.Fatalf("Expected result for /foo/bar tagged %s, got %s tagged %s", target.URL, result.Path, result.Target)
+	}
+}
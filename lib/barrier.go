@@ -0,0 +1,111 @@
+package korra
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BarrierStep is a script step where sessions wait for each other: once
+// Parties sessions are waiting at barriers of the same name they're all let
+// go at once, so their next steps hit the servers together, like a flash
+// sale opening or a cache expiring under a crowd. The barrier then starts
+// over for the next Parties sessions.
+type BarrierStep struct {
+	Name    string
+	Parties int
+	Timeout time.Duration // how long to wait before going on alone; 0 for ever
+}
+
+// ParseBarrierStep parses a step like BARRIER name parties [timeout ms]
+func ParseBarrierStep(line string) (*BarrierStep, error) {
+	tokens := strings.Fields(line)
+	if len(tokens) < 3 || len(tokens) > 4 || !feedName.MatchString(tokens[1]) {
+		return nil, fmt.Errorf("Expected a name and number of sessions, and optionally a timeout in ms, as arguments to BARRIER, got '%s'",
+			strings.Join(tokens[1:], " "))
+	}
+	step := &BarrierStep{Name: tokens[1]}
+	var err error
+	if step.Parties, err = strconv.Atoi(tokens[2]); err != nil || step.Parties < 1 {
+		return nil, fmt.Errorf("Expected a positive number of sessions for BARRIER %s, got '%s'", step.Name, tokens[2])
+	}
+	if len(tokens) == 4 {
+		millis, err := strconv.Atoi(tokens[3])
+		if err != nil || millis < 1 {
+			return nil, fmt.Errorf("Expected a positive timeout in ms for BARRIER %s, got '%s'", step.Name, tokens[3])
+		}
+		step.Timeout = time.Duration(millis) * time.Millisecond
+	}
+	return step, nil
+}
+
+func (step *BarrierStep) String() string {
+	if step.Timeout > 0 {
+		return fmt.Sprintf("BARRIER %s %d %d", step.Name, step.Parties, step.Timeout/time.Millisecond)
+	}
+	return fmt.Sprintf("BARRIER %s %d", step.Name, step.Parties)
+}
+
+// Barriers are the barriers every session of an attack shares, by name
+type Barriers struct {
+	sync.Mutex
+	open map[string]*barrier
+}
+
+// barrier is a group of sessions gathering at a barrier
+type barrier struct {
+	parties int
+	arrived int
+	release chan struct{}
+}
+
+func NewBarriers() *Barriers {
+	return &Barriers{open: map[string]*barrier{}}
+}
+
+// Wait blocks until the step's number of sessions are waiting at the
+// barrier, or its timeout passes, or abort is closed. It returns how many
+// had arrived and whether that was all of them. The first session to arrive
+// sets the number to wait for.
+func (bs *Barriers) Wait(step *BarrierStep, abort <-chan struct{}) (int, bool) {
+	bs.Lock()
+	b := bs.open[step.Name]
+	if b == nil {
+		b = &barrier{parties: step.Parties, release: make(chan struct{})}
+		bs.open[step.Name] = b
+	}
+	b.arrived += 1
+	if b.arrived == b.parties {
+		delete(bs.open, step.Name)
+		close(b.release)
+		bs.Unlock()
+		return b.arrived, true
+	}
+	bs.Unlock()
+
+	var timeout <-chan time.Time
+	if step.Timeout > 0 {
+		timer := time.NewTimer(step.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-b.release:
+		return b.parties, true
+	case <-timeout:
+	case <-abort:
+	}
+	// leave, unless everyone arrived just now
+	bs.Lock()
+	defer bs.Unlock()
+	select {
+	case <-b.release:
+		return b.parties, true
+	default:
+	}
+	arrived := b.arrived
+	b.arrived -= 1
+	return arrived, false
+}
@@ -0,0 +1,81 @@
+package korra
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBarriersRelease(t *testing.T) {
+	barriers := NewBarriers()
+	step := &BarrierStep{Name: "sale", Parties: 5}
+	for round := 0; round < 2; round++ {
+		var wg sync.WaitGroup
+		released := make(chan bool, step.Parties)
+		for i := 0; i < step.Parties; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, all := barriers.Wait(step, nil)
+				released <- all
+			}()
+			if i < step.Parties-1 {
+				time.Sleep(time.Millisecond)
+				if len(released) > 0 {
+					t.Fatalf("round %d; want no session let go before all %d arrive", round, step.Parties)
+				}
+			}
+		}
+		wg.Wait()
+		for i := 0; i < step.Parties; i++ {
+			if !<-released {
+				t.Fatalf("round %d; want every session released together", round)
+			}
+		}
+	}
+}
+
+func TestBarriersTimeout(t *testing.T) {
+	barriers := NewBarriers()
+	step := &BarrierStep{Name: "sale", Parties: 3, Timeout: 10 * time.Millisecond}
+	if arrived, all := barriers.Wait(step, nil); all || arrived != 1 {
+		t.Fatalf("want to go on alone after the timeout, got: %d, %v", arrived, all)
+	}
+	abort := make(chan struct{})
+	close(abort)
+	if _, all := barriers.Wait(&BarrierStep{Name: "sale", Parties: 3}, abort); all {
+		t.Fatal("want an aborted session to leave the barrier")
+	}
+
+	// those that left no longer count
+	done := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, all := barriers.Wait(step, nil)
+			done <- all
+		}()
+	}
+	if arrived, all := barriers.Wait(&BarrierStep{Name: "sale", Parties: 3}, nil); !all || arrived != 3 {
+		t.Fatalf("want the third session to release the others, got: %d, %v", arrived, all)
+	}
+	if !<-done || !<-done {
+		t.Fatal("want the others released")
+	}
+}
+
+func TestParseBarrierStep(t *testing.T) {
+	for line, want := range map[string]BarrierStep{
+		"BARRIER sale 100":       {Name: "sale", Parties: 100},
+		"BARRIER sale 100 5000 ": {Name: "sale", Parties: 100, Timeout: 5 * time.Second},
+	} {
+		step, err := ParseBarrierStep(line)
+		if err != nil || *step != want {
+			t.Fatalf("%s; want: %+v, got: %+v, %v", line, want, step, err)
+		}
+	}
+	for _, bad := range []string{"BARRIER", "BARRIER sale", "BARRIER sale 0", "BARRIER sale x", "BARRIER sale 1 -5", "BARRIER sale 1 5 5", "BARRIER sa-le 1"} {
+		if _, err := ParseBarrierStep(bad); err == nil {
+			t.Errorf("%s; want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package korra
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrorBudgetWindow is the window an SLO's error budget is for, which the
+// time to use one up and the share of it used are in terms of
+var ErrorBudgetWindow = 30 * 24 * time.Hour
+
+// ErrorBudget is what a set of results did to the error budget of an SLO:
+// the errors it allows, 1 in 1000 for 99.9% success. The burn rate is the
+// error rate over that, so at 1 the budget lasts exactly its window, at 10 a
+// tenth of it, and below 1 there's some left at the end.
+type ErrorBudget struct {
+	SLO       float64       `json:"slo"`        // the success ratio aimed for
+	ErrorRate float64       `json:"error_rate"` // of the results
+	BurnRate  float64       `json:"burn_rate"`
+	Spent     float64       `json:"spent"`        // the share of a window's budget the results used, over their duration
+	Exhausted time.Duration `json:"exhausted_in"` // how long a window's budget would last at the burn rate; 0 for ever
+}
+
+func (b *ErrorBudget) String() string {
+	lasts := "for ever"
+	if b.Exhausted > 0 {
+		lasts = b.Exhausted.Round(time.Minute).String()
+	}
+	return fmt.Sprintf("%.2f%%, %.2fx, %.4f%%, %s", b.SLO*100, b.BurnRate, b.Spent*100, lasts)
+}
+
+// NewErrorBudget returns what the metrics did to the error budget of the
+// SLO, a success ratio between 0 and 1, or nil if there is no SLO.
+func NewErrorBudget(m *Metrics, slo float64) *ErrorBudget {
+	if slo <= 0 || slo >= 1 {
+		return nil
+	}
+	b := &ErrorBudget{SLO: slo}
+	if m.Requests > 0 {
+		b.ErrorRate = 1 - m.Success
+	}
+	b.BurnRate = b.ErrorRate / (1 - slo)
+	b.Spent = b.BurnRate * float64(m.Duration+m.Wait) / float64(ErrorBudgetWindow)
+	if lasts := float64(ErrorBudgetWindow) / b.BurnRate; b.BurnRate > 0 && lasts < math.MaxInt64 {
+		b.Exhausted = time.Duration(lasts)
+	}
+	return b
+}
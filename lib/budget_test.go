@@ -0,0 +1,33 @@
+package korra
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNewErrorBudget(t *testing.T) {
+	m := &Metrics{Requests: 10000, Success: 0.998, Duration: 72 * time.Hour}
+	b := NewErrorBudget(m, 0.999)
+	if math.Abs(b.ErrorRate-0.002) > 1e-9 || math.Abs(b.BurnRate-2) > 1e-6 {
+		t.Fatalf("want twice the error rate allowed: %+v", b)
+	}
+	// three days at twice the rate spends a fifth of a 30 day budget
+	if math.Abs(b.Spent-0.2) > 1e-6 {
+		t.Fatalf("want 20%% spent, got: %v", b.Spent)
+	}
+	if want, got := 15*24*time.Hour, b.Exhausted.Round(time.Minute); want != got {
+		t.Fatalf("exhausted; want: %s, got: %s", want, got)
+	}
+	if want, got := "99.90%, 2.00x, 20.0000%, 360h0m0s", b.String(); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+
+	m.Success = 1
+	if b = NewErrorBudget(m, 0.999); b.BurnRate != 0 || b.Exhausted != 0 || b.String() != "99.90%, 0.00x, 0.0000%, for ever" {
+		t.Fatalf("want no burn: %s", b)
+	}
+	if NewErrorBudget(m, 0) != nil {
+		t.Fatal("expected no budget without an SLO")
+	}
+}
@@ -0,0 +1,311 @@
+package korra
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BundleExt is the extension of a bundle, which commands taking a directory
+// of sessions take in its place
+const BundleExt = ".kor"
+
+// The bundle's own entries, first in its archive: its manifest, and the
+// signature of the manifest if it's signed
+const (
+	bundleManifest  = "BUNDLE.json"
+	bundleSignature = "BUNDLE.sig"
+)
+
+// BundleManifest lists every file in a bundle with its SHA-256, so a bundle
+// whose files were changed, or that was cut short, is caught before any of
+// it's used. Signing the manifest signs the whole bundle.
+type BundleManifest struct {
+	Created time.Time    `json:"created"`
+	Korra   string       `json:"korra"` // the version that made it
+	Files   []BundleFile `json:"files"` // in path order
+}
+
+// BundleFile is a file of a bundle, by its path from the bundle's top
+type BundleFile struct {
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	Mode   os.FileMode `json:"mode"`
+	SHA256 string      `json:"sha256"`
+}
+
+// IsBundle returns true if the path names a bundle rather than a directory
+func IsBundle(name string) bool {
+	return strings.HasSuffix(name, BundleExt)
+}
+
+// WriteBundle packs every file under the directory -- session scripts,
+// feeds, certificates, configuration -- into a gzipped tar, with a manifest
+// signed with the key if there is one. Hidden files and directories, result
+// files and the files attacks write next to them are left out.
+func WriteBundle(out io.Writer, dir string, key ed25519.PrivateKey) (*BundleManifest, error) {
+	manifest := &BundleManifest{Created: time.Now().UTC().Truncate(time.Second), Korra: Version}
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		base := info.Name()
+		if name != dir && strings.HasPrefix(base, ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || bundleSkips(base) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		sum, err := fileSHA256(name)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, BundleFile{Path: filepath.ToSlash(rel), Size: info.Size(), Mode: info.Mode().Perm(), SHA256: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Files) == 0 {
+		return nil, fmt.Errorf("nothing to bundle in %s", dir)
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	zipped := gzip.NewWriter(out)
+	archive := tar.NewWriter(zipped)
+	add := func(name string, mode os.FileMode, size int64, body io.Reader) error {
+		header := &tar.Header{Name: name, Mode: int64(mode), Size: size, ModTime: manifest.Created, Typeflag: tar.TypeReg}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := io.Copy(archive, body)
+		return err
+	}
+	if err = add(bundleManifest, 0644, int64(len(data)), bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	if key != nil {
+		signature := []byte(hex.EncodeToString(ed25519.Sign(key, data)))
+		if err = add(bundleSignature, 0644, int64(len(signature)), bytes.NewReader(signature)); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range manifest.Files {
+		in, err := os.Open(filepath.Join(dir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			return nil, err
+		}
+		err = add(file.Path, file.Mode, file.Size, in)
+		in.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = archive.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, zipped.Close()
+}
+
+// bundleSkips returns true for the files an attack writes into its
+// directory of sessions, which don't belong in a bundle
+func bundleSkips(name string) bool {
+	return strings.HasSuffix(name, ".bin") || strings.HasSuffix(name, BundleExt) || strings.HasSuffix(name, CaptureExt) ||
+		name == AnnotationsFile || name == ScrapesFile || name == TraceFile
+}
+
+// fileSHA256 returns the hex SHA-256 of the file's contents
+func fileSHA256(name string) (string, error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, in); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ExtractBundle checks the bundle and unpacks it into the directory, which
+// must not exist yet, and is removed again if the bundle doesn't check out.
+// With a key the bundle must be signed with its private half; without one a
+// signature isn't checked, but every file still has to match the manifest.
+// Whether it was signed is returned with its manifest.
+func ExtractBundle(in io.Reader, dir string, key ed25519.PublicKey) (*BundleManifest, bool, error) {
+	zipped, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, false, fmt.Errorf("not a bundle: %s", err)
+	}
+	archive := tar.NewReader(zipped)
+	header, err := archive.Next()
+	if err != nil || header.Name != bundleManifest {
+		return nil, false, fmt.Errorf("not a bundle: no %s first", bundleManifest)
+	}
+	data, err := ioutil.ReadAll(archive)
+	if err != nil {
+		return nil, false, err
+	}
+	manifest := &BundleManifest{}
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, false, fmt.Errorf("bad %s: %s", bundleManifest, err)
+	}
+
+	header, err = archive.Next()
+	signed := err == nil && header.Name == bundleSignature
+	if signed {
+		signature, readErr := ioutil.ReadAll(archive)
+		if readErr != nil {
+			return nil, false, readErr
+		}
+		sig, hexErr := hex.DecodeString(strings.TrimSpace(string(signature)))
+		if key != nil && (hexErr != nil || !ed25519.Verify(key, data, sig)) {
+			return nil, true, fmt.Errorf("bundle isn't signed with the key")
+		}
+		header, err = archive.Next()
+	}
+	if key != nil && !signed {
+		return nil, false, fmt.Errorf("bundle isn't signed")
+	}
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, signed, err
+	}
+	if err = extractBundleFiles(archive, header, err, dir, manifest); err != nil {
+		os.RemoveAll(dir)
+		return nil, signed, err
+	}
+	return manifest, signed, nil
+}
+
+// extractBundleFiles writes the files read from the archive, the first
+// with its header already read, under the directory
+func extractBundleFiles(archive *tar.Reader, header *tar.Header, err error, dir string, manifest *BundleManifest) error {
+	expected := map[string]BundleFile{}
+	for _, file := range manifest.Files {
+		expected[file.Path] = file
+	}
+	for ; err == nil; header, err = archive.Next() {
+		file, ok := expected[header.Name]
+		if !ok {
+			return fmt.Errorf("%s is in the bundle but not its manifest", header.Name)
+		}
+		delete(expected, header.Name)
+		if err = extractBundleFile(archive, dir, file); err != nil {
+			return err
+		}
+	}
+	if err != io.EOF {
+		return fmt.Errorf("bad bundle: %s", err)
+	}
+	for name := range expected {
+		return fmt.Errorf("%s is in the manifest but not the bundle", name)
+	}
+	return nil
+}
+
+// extractBundleFile writes the file read from the archive under the
+// directory, checking it's what the manifest says
+func extractBundleFile(in io.Reader, dir string, file BundleFile) error {
+	clean := path.Clean(file.Path)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("%s is outside the bundle", file.Path)
+	}
+	name := filepath.Join(dir, filepath.FromSlash(clean))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, file.Mode|0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), in)
+	if err != nil {
+		return err
+	}
+	if size != file.Size || hex.EncodeToString(hash.Sum(nil)) != file.SHA256 {
+		return fmt.Errorf("%s doesn't match the manifest; the bundle was changed or damaged", file.Path)
+	}
+	return nil
+}
+
+// ReadBundleKey reads an Ed25519 key to sign bundles with, or to check
+// them with, in PEM: a PKCS #8 private key or a PKIX public one, as
+// written by GenerateBundleKeys or openssl genpkey -algorithm ed25519.
+func ReadBundleKey(name string) (ed25519.PrivateKey, ed25519.PublicKey, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no PEM key in %s", name)
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if private, ok := key.(ed25519.PrivateKey); ok {
+			return private, private.Public().(ed25519.PublicKey), nil
+		}
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if public, ok := key.(ed25519.PublicKey); ok {
+			return nil, public, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%s isn't an Ed25519 key", name)
+}
+
+// GenerateBundleKeys makes a new key to sign bundles with, returning its
+// private and public halves in PEM for ReadBundleKey
+func GenerateBundleKeys() ([]byte, []byte, error) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), nil
+}
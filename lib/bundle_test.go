@@ -0,0 +1,138 @@
+package korra
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	dir := t.TempDir()
+	scripts := filepath.Join(dir, "scripts")
+	for name, content := range map[string]string{
+		"user_1.txt":        "GET http://localhost/\n",
+		"data/users.csv":    "email\nuser@example.com\n",
+		"certs/ca.pem":      "not really a certificate\n",
+		"user_1.bin":        "results aren't bundled",
+		"annotations.jsonl": "",
+		".git/HEAD":         "hidden directories aren't either",
+	} {
+		name = filepath.Join(scripts, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	private, public, err := GenerateBundleKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile, pubFile := filepath.Join(dir, "team.key"), filepath.Join(dir, "team.pub")
+	os.WriteFile(keyFile, private, 0600)
+	os.WriteFile(pubFile, public, 0644)
+	signing, _, err := ReadBundleKey(keyFile)
+	if err != nil || signing == nil {
+		t.Fatalf("want the private key, got: %v", err)
+	}
+	_, checking, err := ReadBundleKey(pubFile)
+	if err != nil || checking == nil {
+		t.Fatalf("want the public key, got: %v", err)
+	}
+
+	var signed bytes.Buffer
+	manifest, err := WriteBundle(&signed, scripts, signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, file := range manifest.Files {
+		paths = append(paths, file.Path)
+	}
+	if got := strings.Join(paths, ","); got != "certs/ca.pem,data/users.csv,user_1.txt" {
+		t.Fatalf("want the scripts, feeds and certs bundled, got: %s", got)
+	}
+
+	out := filepath.Join(dir, "suite")
+	if _, wasSigned, err := ExtractBundle(bytes.NewReader(signed.Bytes()), out, checking); err != nil || !wasSigned {
+		t.Fatalf("want the signed bundle extracted, got: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(out, "data", "users.csv")); err != nil || string(data) != "email\nuser@example.com\n" {
+		t.Fatalf("want the feed extracted, got: %q %v", data, err)
+	}
+	if _, _, err = ExtractBundle(bytes.NewReader(signed.Bytes()), out, checking); err == nil {
+		t.Error("want an error extracting over a directory")
+	}
+
+	var unsigned bytes.Buffer
+	if _, err = WriteBundle(&unsigned, scripts, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, wasSigned, err := ExtractBundle(bytes.NewReader(unsigned.Bytes()), filepath.Join(dir, "unsigned"), nil); err != nil || wasSigned {
+		t.Fatalf("want the unsigned bundle extracted without a key, got: %v", err)
+	}
+	if _, _, err = ExtractBundle(bytes.NewReader(unsigned.Bytes()), filepath.Join(dir, "refused"), checking); err == nil {
+		t.Error("want an error for an unsigned bundle with a key")
+	}
+
+	// a bundle signed with another key, or changed after it was signed, is refused
+	otherKey, _, _ := GenerateBundleKeys()
+	os.WriteFile(keyFile, otherKey, 0600)
+	other, _, _ := ReadBundleKey(keyFile)
+	var forged bytes.Buffer
+	WriteBundle(&forged, scripts, other)
+	if _, _, err = ExtractBundle(&forged, filepath.Join(dir, "forged"), checking); err == nil {
+		t.Error("want an error for a bundle signed with another key")
+	}
+	tampered := filepath.Join(dir, "tampered")
+	if _, _, err = ExtractBundle(bytes.NewReader(retar(t, signed.Bytes(), "user_1.txt", "DELETE http://localhost/\n")), tampered, checking); err == nil ||
+		!strings.Contains(err.Error(), "doesn't match") {
+		t.Fatalf("want an error for a changed file, got: %v", err)
+	}
+	if _, err = os.Stat(tampered); !os.IsNotExist(err) {
+		t.Error("want what was extracted of a bad bundle removed")
+	}
+	if _, _, err = ExtractBundle(strings.NewReader("not a bundle"), filepath.Join(dir, "bad"), nil); err == nil {
+		t.Error("want an error for something that isn't a bundle")
+	}
+	if _, err = WriteBundle(io.Discard, t.TempDir(), nil); err == nil {
+		t.Error("want an error bundling an empty directory")
+	}
+}
+
+// retar rewrites the bundle with the file's contents replaced
+func retar(t *testing.T, bundle []byte, name, content string) []byte {
+	zipped, err := gzip.NewReader(bytes.NewReader(bundle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := tar.NewReader(zipped)
+	var buf bytes.Buffer
+	rezipped := gzip.NewWriter(&buf)
+	out := tar.NewWriter(rezipped)
+	for {
+		header, err := in.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(in)
+		if header.Name == name {
+			data = []byte(content)
+			header.Size = int64(len(data))
+		}
+		out.WriteHeader(header)
+		out.Write(data)
+	}
+	out.Close()
+	rezipped.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,67 @@
+package korra
+
+import (
+	"strings"
+	"time"
+)
+
+// CacheSplit is the latencies of a set of results split by whether a cache
+// served them, which a response header recorded with RecordHeaders says,
+// like X-Cache. Blended percentiles of hits and misses show neither the
+// cache's latency nor the origin's behind it.
+type CacheSplit struct {
+	Header string         `json:"header"`
+	Hits   CacheLatencies `json:"hits"`
+	Misses CacheLatencies `json:"misses"`
+}
+
+// CacheLatencies is the latencies of the hits or misses of a CacheSplit
+type CacheLatencies struct {
+	Results int           `json:"results"`
+	Mean    time.Duration `json:"mean"`
+	P50     time.Duration `json:"50th"`
+	P95     time.Duration `json:"95th"`
+	P99     time.Duration `json:"99th"`
+	Max     time.Duration `json:"max"`
+}
+
+// SplitByCache splits the results by the header, or returns nil if none of
+// them recorded it. A value is a hit if it has "hit" in it in any case, like
+// HIT or TCP_HIT; where there's a list, like "MISS, HIT" from a CDN with a
+// shield, only the last -- the cache nearest the client -- counts.
+func SplitByCache(r Results, header string) *CacheSplit {
+	if header == "" {
+		return nil
+	}
+	var hits, misses Results
+	for _, result := range r {
+		value, ok := result.Headers[header]
+		if !ok {
+			continue
+		}
+		if idx := strings.LastIndex(value, ","); idx >= 0 {
+			value = value[idx+1:]
+		}
+		if strings.Contains(strings.ToUpper(value), "HIT") {
+			hits = append(hits, result)
+		} else {
+			misses = append(misses, result)
+		}
+	}
+	if len(hits) == 0 && len(misses) == 0 {
+		return nil
+	}
+	return &CacheSplit{Header: header, Hits: cacheLatencies(hits), Misses: cacheLatencies(misses)}
+}
+
+func cacheLatencies(r Results) CacheLatencies {
+	m := NewMetrics(r)
+	return CacheLatencies{
+		Results: r.Count(),
+		Mean:    m.Latencies.Mean,
+		P50:     m.Latencies.P50,
+		P95:     m.Latencies.P95,
+		P99:     m.Latencies.P99,
+		Max:     m.Latencies.Max,
+	}
+}
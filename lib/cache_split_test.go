@@ -0,0 +1,46 @@
+package korra
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitByCache(t *testing.T) {
+	var r Results
+	for i := 0; i < 10; i++ {
+		result := &Result{Code: 200, Timestamp: time.Unix(int64(i), 0), Latency: 5 * time.Millisecond, Headers: map[string]string{"X-Cache": "TCP_HIT"}}
+		switch i {
+		case 0, 1:
+			result.Latency, result.Headers["X-Cache"] = 200*time.Millisecond, "MISS"
+		case 2:
+			// a shield miss the edge served
+			result.Headers["X-Cache"] = "MISS, HIT"
+		case 3:
+			result.Headers = nil
+		}
+		r = append(r, result)
+	}
+
+	split := SplitByCache(r, "X-Cache")
+	if split == nil || split.Hits.Results != 7 || split.Misses.Results != 2 {
+		t.Fatalf("want 7 hits and 2 misses, got: %+v", split)
+	}
+	if want, got := 5*time.Millisecond, split.Hits.P99; want != got {
+		t.Fatalf("hits P99; want: %s, got: %s", want, got)
+	}
+	if want, got := 200*time.Millisecond, split.Misses.P50; want != got {
+		t.Fatalf("misses P50; want: %s, got: %s", want, got)
+	}
+	if SplitByCache(r, "X-Served-By") != nil || SplitByCache(r, "") != nil {
+		t.Fatal("expected no split without the header")
+	}
+
+	report, err := TextReporter{SectionOptions: SectionOptions{CacheHeader: "X-Cache"}}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), "Cache Misses") {
+		t.Fatalf("no cache misses in report:\n%s", report)
+	}
+}
@@ -0,0 +1,339 @@
+package korra
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CapturesDir is the directory, in the directory of sessions, the packet
+// captures of failed requests are written to by default
+const CapturesDir = "captures"
+
+// CaptureExt is the extension of a packet capture
+const CaptureExt = ".pcap"
+
+const (
+	// captureLimit is the most of a connection's traffic since its last
+	// request ended that's kept to capture, each way
+	captureLimit = 64 << 10
+	// captureSegment is the most payload a captured packet carries, as
+	// an Ethernet MTU would allow
+	captureSegment = 1460
+	// the initial sequence numbers captured connections are given
+	captureClientISN = 0x10000000
+	captureServerISN = 0x20000000
+)
+
+// Captures writes a packet capture of the connection of every failed HTTP
+// request, up to a maximum, each to its own file Wireshark or tcpdump can
+// read, and names it in the request's result. The packets are made up from
+// what the connection sent and received, as a tap on the socket sees them
+// with no libpcap or privileges needed, so they have the bytes and timing
+// of the traffic but not its retransmissions, windows or acknowledgements.
+// A capture starts with the connection, handshake and all, if the request
+// opened it, or else with what it sent after the request before it ended.
+type Captures struct {
+	Dir string // directory to write the captures to
+	Max int    // the most captures to write
+
+	mu      sync.Mutex
+	written int
+}
+
+// NewCaptures captures up to max failed requests into the directory,
+// making it if it isn't there
+func NewCaptures(dir string, max int) (*Captures, error) {
+	if max < 1 {
+		return nil, fmt.Errorf("capture %d failures? at least 1", max)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Captures{Dir: dir, Max: max}, nil
+}
+
+// Capture returns a functional option which makes an Attacker tap every
+// connection it makes, writing the captures of failed requests' connections
+func Capture(c *Captures) func(*Attacker) {
+	return func(a *Attacker) {
+		a.captures = c
+	}
+}
+
+// save writes the capture of the failed result's connection, if there are
+// captures left to write, naming it in the result; one that can't be
+// written is left out
+func (c *Captures) save(conn *tappedConn, result *Result) {
+	c.mu.Lock()
+	if c.written >= c.Max {
+		c.mu.Unlock()
+		return
+	}
+	c.written++
+	name := filepath.Join(c.Dir, fmt.Sprintf("failure-%d%s", c.written, CaptureExt))
+	c.mu.Unlock()
+
+	file, err := os.Create(name)
+	if err != nil {
+		return
+	}
+	out := bufio.NewWriter(file)
+	conn.writePcap(out)
+	err = out.Flush()
+	if closeErr := file.Close(); err == nil && closeErr == nil {
+		result.Capture = name
+	}
+}
+
+// connTrace is the tapped connection a request got, if any
+type connTrace struct {
+	sync.Mutex
+	conn *tappedConn
+}
+
+func (t *connTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			conn := info.Conn
+			if tlsConn, ok := conn.(*tls.Conn); ok {
+				conn = tlsConn.NetConn()
+			}
+			if tapped, ok := conn.(*tappedConn); ok {
+				t.Lock()
+				t.conn = tapped
+				t.Unlock()
+			}
+		},
+	}
+}
+
+// tapped returns the connection the request got, or nil if it got none
+// or wasn't traced
+func (t *connTrace) tapped() *tappedConn {
+	if t == nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	return t.conn
+}
+
+// tappedPacket is what a tapped connection sent or received at once
+type tappedPacket struct {
+	at       time.Time
+	out      bool   // sent, not received
+	seq, ack uint32 // the bytes its sender had sent and received before it
+	data     []byte
+	fin      bool
+}
+
+// tappedConn keeps what's sent and received on a connection since it
+// opened or its last request ended, up to captureLimit each way
+type tappedConn struct {
+	net.Conn
+	mu              sync.Mutex
+	opened          time.Time // when it opened, until its first request ends
+	packets         []tappedPacket
+	sent, received  uint32
+	keptOut, keptIn int
+	local, remote   *net.TCPAddr
+	ipID            uint16
+}
+
+func newTappedConn(conn net.Conn) *tappedConn {
+	t := &tappedConn{Conn: conn, opened: time.Now()}
+	t.local, _ = conn.LocalAddr().(*net.TCPAddr)
+	t.remote, _ = conn.RemoteAddr().(*net.TCPAddr)
+	return t
+}
+
+func (t *tappedConn) Read(p []byte) (int, error) {
+	n, err := t.Conn.Read(p)
+	if n > 0 {
+		t.tap(false, p[:n])
+	}
+	return n, err
+}
+
+func (t *tappedConn) Write(p []byte) (int, error) {
+	n, err := t.Conn.Write(p)
+	if n > 0 {
+		t.tap(true, p[:n])
+	}
+	return n, err
+}
+
+func (t *tappedConn) Close() error {
+	t.mu.Lock()
+	t.packets = append(t.packets, tappedPacket{at: time.Now(), out: true, seq: t.sent, ack: t.received, fin: true})
+	t.mu.Unlock()
+	return t.Conn.Close()
+}
+
+// tap keeps the bytes, as much of them as the limit leaves room for
+func (t *tappedConn) tap(out bool, p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	kept, moved := &t.keptIn, &t.received
+	packet := tappedPacket{at: time.Now(), out: out, seq: t.received, ack: t.sent}
+	if out {
+		kept, moved = &t.keptOut, &t.sent
+		packet.seq, packet.ack = t.sent, t.received
+	}
+	*moved += uint32(len(p))
+	if room := captureLimit - *kept; room > 0 {
+		if len(p) > room {
+			p = p[:room]
+		}
+		packet.data = append([]byte(nil), p...)
+		*kept += len(p)
+		t.packets = append(t.packets, packet)
+	}
+}
+
+// reset drops what's kept, at the end of a request
+func (t *tappedConn) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.opened = time.Time{}
+	t.packets, t.keptOut, t.keptIn = nil, 0, 0
+}
+
+// writePcap writes what's kept as a pcap file of raw IP packets
+func (t *tappedConn) writePcap(out *bufio.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// magic, version 2.4, UTC, snapshot length and LINKTYPE_RAW
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], 101)
+	out.Write(header)
+
+	if !t.opened.IsZero() {
+		t.writePacket(out, t.opened, true, 0, 0, tcpSYN, nil)
+		t.writePacket(out, t.opened, false, 0, 1, tcpSYN|tcpACK, nil)
+		t.writePacket(out, t.opened, true, 1, 1, tcpACK, nil)
+	}
+	for _, packet := range t.packets {
+		if packet.fin {
+			t.writePacket(out, packet.at, true, packet.seq+1, packet.ack+1, tcpFIN|tcpACK, nil)
+			continue
+		}
+		for data, seq := packet.data, packet.seq; len(data) > 0; {
+			n := len(data)
+			if n > captureSegment {
+				n = captureSegment
+			}
+			t.writePacket(out, packet.at, packet.out, seq+1, packet.ack+1, tcpPSH|tcpACK, data[:n])
+			data, seq = data[n:], seq+uint32(n)
+		}
+	}
+}
+
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// writePacket writes a pcap record of an IP packet carrying a TCP segment,
+// from the client or else from the server, with sequence numbers relative
+// to its sender's initial one and acknowledgements to the other's
+func (t *tappedConn) writePacket(out *bufio.Writer, at time.Time, fromClient bool, seq, ack uint32, flags byte, data []byte) {
+	src, dst := tcpAddr(t.local), tcpAddr(t.remote)
+	isn, otherISN := uint32(captureClientISN), uint32(captureServerISN)
+	if !fromClient {
+		src, dst = dst, src
+		isn, otherISN = otherISN, isn
+	}
+	seq, ack = seq+isn, ack+otherISN
+	if flags&tcpACK == 0 {
+		ack = 0
+	}
+
+	segment := make([]byte, 20+len(data))
+	binary.BigEndian.PutUint16(segment[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(segment[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint32(segment[4:], seq)
+	binary.BigEndian.PutUint32(segment[8:], ack)
+	segment[12] = 5 << 4
+	segment[13] = flags
+	binary.BigEndian.PutUint16(segment[14:], 65535)
+	copy(segment[20:], data)
+
+	var packet []byte
+	if src4, dst4 := src.IP.To4(), dst.IP.To4(); src4 != nil && dst4 != nil {
+		packet = make([]byte, 20, 20+len(segment))
+		packet[0] = 0x45
+		binary.BigEndian.PutUint16(packet[2:], uint16(20+len(segment)))
+		t.ipID++
+		binary.BigEndian.PutUint16(packet[4:], t.ipID)
+		packet[6] = 0x40 // don't fragment
+		packet[8], packet[9] = 64, 6
+		copy(packet[12:], src4)
+		copy(packet[16:], dst4)
+		binary.BigEndian.PutUint16(packet[10:], checksum(packet, 0))
+		pseudo := checksumAdd(checksumAdd(0, src4), dst4) + 6 + uint32(len(segment))
+		binary.BigEndian.PutUint16(segment[16:], checksum(segment, pseudo))
+	} else {
+		src16, dst16 := src.IP.To16(), dst.IP.To16()
+		packet = make([]byte, 40, 40+len(segment))
+		packet[0] = 0x60
+		binary.BigEndian.PutUint16(packet[4:], uint16(len(segment)))
+		packet[6], packet[7] = 6, 64
+		copy(packet[8:], src16)
+		copy(packet[24:], dst16)
+		pseudo := checksumAdd(checksumAdd(0, src16), dst16) + 6 + uint32(len(segment))
+		binary.BigEndian.PutUint16(segment[16:], checksum(segment, pseudo))
+	}
+	packet = append(packet, segment...)
+
+	record := make([]byte, 16)
+	binary.LittleEndian.PutUint32(record[0:], uint32(at.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(at.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(packet)))
+	out.Write(record)
+	out.Write(packet)
+}
+
+// tcpAddr returns the address, or the unspecified IPv4 address and port 0
+// for a connection that isn't TCP
+func tcpAddr(addr *net.TCPAddr) *net.TCPAddr {
+	if addr == nil || addr.IP == nil {
+		return &net.TCPAddr{IP: net.IPv4zero}
+	}
+	return addr
+}
+
+// checksumAdd adds the bytes as big-endian 16-bit words to the sum
+func checksumAdd(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	return sum
+}
+
+// checksum returns the Internet checksum of the bytes, on top of the sum
+func checksum(b []byte, sum uint32) uint16 {
+	sum = checksumAdd(sum, b)
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
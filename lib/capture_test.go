@@ -0,0 +1,85 @@
+package korra
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCaptures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		w.Write([]byte("body of " + r.URL.Path))
+	}))
+	defer server.Close()
+	if _, err := NewCaptures(t.TempDir(), 0); err == nil {
+		t.Error("want an error capturing 0 failures")
+	}
+	captures, err := NewCaptures(t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attacker := NewAttacker(Capture(captures))
+	hit := func(path string) *Result {
+		target := &Target{Method: "GET", URL: server.URL + path}
+		return attacker.Hit(func() (*Target, error) { return target, nil }, time.Now(), 1)
+	}
+
+	if result := hit("/fine"); result.Capture != "" {
+		t.Errorf("want no capture of a success, got %s", result.Capture)
+	}
+	result := hit("/broken")
+	if result.Capture == "" {
+		t.Fatal("want a capture of the failure")
+	}
+	if again := hit("/broken"); again.Capture != "" {
+		t.Errorf("want no capture past the maximum, got %s", again.Capture)
+	}
+
+	capture, err := os.ReadFile(result.Capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if magic, linkType := binary.LittleEndian.Uint32(capture), binary.LittleEndian.Uint32(capture[20:]); magic != 0xa1b2c3d4 || linkType != 101 {
+		t.Fatalf("want a pcap of raw IP, got magic %x and link type %d", magic, linkType)
+	}
+	var payloads [][]byte
+	for rest := capture[24:]; len(rest) > 0; {
+		size := binary.LittleEndian.Uint32(rest[8:])
+		packet := rest[16 : 16+size]
+		if packet[0]>>4 != 4 || packet[9] != 6 || checksum(packet[:20], 0) != 0 {
+			t.Fatalf("want an IPv4 TCP packet with a good checksum, got % x", packet[:20])
+		}
+		segment := packet[20:]
+		pseudo := checksumAdd(checksumAdd(0, packet[12:16]), packet[16:20]) + 6 + uint32(len(segment))
+		if checksum(segment, pseudo) != 0 {
+			t.Errorf("want a good TCP checksum, got % x", segment[:20])
+		}
+		payloads = append(payloads, segment[20:])
+		rest = rest[16+size:]
+	}
+	// the connection was opened by the success, so the failure's capture
+	// picks up after it, without the handshake
+	if len(payloads) != 2 {
+		t.Fatalf("want the request and response, got %d packets", len(payloads))
+	}
+	if !bytes.HasPrefix(payloads[0], []byte("GET /broken HTTP/1.1")) || !bytes.Contains(payloads[1], []byte("502 Bad Gateway")) || bytes.Contains(payloads[1], []byte("/fine")) {
+		t.Errorf("want the failure's request and response, got:\n%s\n%s", payloads[0], payloads[1])
+	}
+
+	// a capture of a connection the failure opened starts with its handshake
+	fresh, _ := NewCaptures(t.TempDir(), 1)
+	result = NewAttacker(Capture(fresh)).Hit(func() (*Target, error) { return &Target{Method: "GET", URL: server.URL + "/broken"}, nil }, time.Now(), 1)
+	if capture, err = os.ReadFile(result.Capture); err != nil {
+		t.Fatal(err)
+	}
+	if flags := capture[24+16+20+13]; flags != tcpSYN {
+		t.Errorf("want the capture to start with a SYN, got flags %x", flags)
+	}
+}
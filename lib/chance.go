@@ -0,0 +1,46 @@
+package korra
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Chance is a CHANCE block of a script: each time a session comes to it, it
+// runs the block's steps with the given probability and skips them all
+// otherwise, so one script can follow a funnel where, say, 30% of users add
+// to their cart.
+type Chance struct {
+	Line    int     // where the block opens
+	Percent float64 // in (0, 100]
+}
+
+// ParseChance parses the line opening a block like CHANCE 30 or CHANCE 12.5%
+func ParseChance(line string, lineNumber int) (*Chance, error) {
+	tokens := strings.Fields(line)
+	if len(tokens) != 2 {
+		return nil, fmt.Errorf("Line %d: Expected a percentage as the only argument to %s", lineNumber, chanceOpen)
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(tokens[1], "%"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return nil, fmt.Errorf("Line %d: Expected a percentage above 0 and at most 100 for %s, got '%s'", lineNumber, chanceOpen, tokens[1])
+	}
+	return &Chance{Line: lineNumber, Percent: percent}, nil
+}
+
+func (c *Chance) String() string {
+	return fmt.Sprintf("%s %s%%", chanceOpen, strconv.FormatFloat(c.Percent, 'f', -1, 64))
+}
+
+// taken rolls whether to run the block this time
+func (c *Chance) taken(random *Random) bool {
+	return random.Float64()*100 < c.Percent
+}
+
+// SkipChance moves past the rest of the actions in the CHANCE block, which
+// are all together
+func (script *SessionScript) SkipChance(chance *Chance) {
+	for script.ActionsRemain() && script.Actions[script.Current].Chance == chance {
+		script.Current += 1
+	}
+}
@@ -0,0 +1,86 @@
+package korra
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// The algorithms a Checksum may verify a response body with
+const (
+	ChecksumMD5    = "md5"
+	ChecksumSHA256 = "sha256"
+)
+
+// checksumHeaderPrefix marks a Checksum's expected digest as the name of
+// the response header holding it
+const checksumHeaderPrefix = "header:"
+
+// Checksum verifies the digest of a step's whole response body, against
+// either the value given or the one in a response header, as hex or
+// base64. A mismatch fails the request as an integrity error (see
+// Result.Corrupt).
+type Checksum struct {
+	Algorithm string
+	Expected  string // the digest, which may refer to feed or var values
+	Header    string // the response header with the digest, instead of Expected
+}
+
+// ParseChecksum parses a checksum as the algorithm then the expected digest
+// or the header it's in:
+//
+//	sha256 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//	md5 header:Content-MD5
+func ParseChecksum(line string) (*Checksum, error) {
+	algorithm, expected, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if algorithm != ChecksumMD5 && algorithm != ChecksumSHA256 {
+		return nil, fmt.Errorf("Expected %s or %s as the checksum algorithm, got '%s'", ChecksumMD5, ChecksumSHA256, algorithm)
+	}
+	if expected = strings.TrimSpace(expected); expected == "" {
+		return nil, fmt.Errorf("Expected a %s digest or %s<name> to check against", algorithm, checksumHeaderPrefix)
+	}
+	checksum := &Checksum{Algorithm: algorithm}
+	if name, ok := strings.CutPrefix(expected, checksumHeaderPrefix); ok {
+		if checksum.Header = strings.TrimSpace(name); checksum.Header == "" {
+			return nil, fmt.Errorf("Expected a header name after '%s'", checksumHeaderPrefix)
+		}
+	} else {
+		checksum.Expected = expected
+	}
+	return checksum, nil
+}
+
+func (c *Checksum) String() string {
+	if c.Header != "" {
+		return fmt.Sprintf("%s %s%s", c.Algorithm, checksumHeaderPrefix, c.Header)
+	}
+	return fmt.Sprintf("%s %s", c.Algorithm, c.Expected)
+}
+
+func (c *Checksum) hash() hash.Hash {
+	if c.Algorithm == ChecksumMD5 {
+		return md5.New()
+	}
+	return sha256.New()
+}
+
+// verify returns an error if the digest of the body doesn't match the
+// expected one, or there's no expected one in the response's headers; the
+// error doesn't include either digest, so reports count mismatches together
+func (c *Checksum) verify(sum []byte, header http.Header) error {
+	expected := c.Expected
+	if c.Header != "" {
+		if expected = strings.TrimSpace(header.Get(c.Header)); expected == "" {
+			return fmt.Errorf("checksum mismatch (no %s header)", c.Header)
+		}
+	}
+	if strings.EqualFold(expected, hex.EncodeToString(sum)) || expected == base64.StdEncoding.EncodeToString(sum) {
+		return nil
+	}
+	return fmt.Errorf("checksum mismatch (%s)", c.Algorithm)
+}
@@ -0,0 +1,76 @@
+package korra
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// the sha256 of "download"
+const downloadSHA256 = "68ff63fb82e0e5dfec2a8496bf9afef608ad639ed552e740268eb537fa52067f"
+
+func TestCreateTargetChecksum(t *testing.T) {
+	action := &SessionAction{Raw: "GET http://shop/files/1\n= sha256 " + downloadSHA256, Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	if got := action.Target.Checksum; got == nil || got.Algorithm != ChecksumSHA256 || got.Expected != downloadSHA256 {
+		t.Fatalf("bad checksum: %v", got)
+	}
+	action = &SessionAction{Raw: "GET http://shop/files/1\n= md5 header:Content-MD5", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	if got := action.Target.Checksum.String(); got != "md5 header:Content-MD5" {
+		t.Fatalf("bad checksum: %s", got)
+	}
+	for _, bad := range []string{"= crc32 abc", "= sha256", "= md5 header:", "= md5 abc\n= md5 def"} {
+		action = &SessionAction{Raw: "GET http://shop/files/1\n" + bad, Line: 1}
+		if err := action.CreateTarget("."); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+func TestChecksumVerified(t *testing.T) {
+	sum := md5.Sum([]byte("download"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		if r.URL.Path == "/truncated" {
+			w.Write([]byte("down"))
+		} else {
+			w.Write([]byte("download"))
+		}
+	}))
+	defer server.Close()
+
+	attacker := NewAttacker()
+	hit := func(path, checksum string) *Result {
+		c, err := ParseChecksum(checksum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := &Target{Method: "GET", URL: server.URL + path, Checksum: c}
+		return attacker.Hit(func() (*Target, error) { return target, nil }, time.Now(), 1)
+	}
+	for _, checksum := range []string{"sha256 " + downloadSHA256, "md5 header:Content-MD5"} {
+		if result := hit("/file", checksum); result.Corrupt || result.Error != "" {
+			t.Fatalf("want %s to match, got: %s", checksum, result.Error)
+		}
+	}
+	corrupt := hit("/truncated", "md5 header:Content-MD5")
+	if !corrupt.Corrupt || corrupt.Error != "checksum mismatch (md5)" {
+		t.Fatalf("want a mismatch, got: %v %q", corrupt.Corrupt, corrupt.Error)
+	}
+	if missing := hit("/file", "sha256 header:X-Checksum"); !missing.Corrupt || missing.Error != "checksum mismatch (no X-Checksum header)" {
+		t.Fatalf("want a mismatch for the missing header, got: %q", missing.Error)
+	}
+
+	m := NewMetrics(Results{corrupt, hit("/file", "sha256 "+downloadSHA256)})
+	if m.IntegrityErrors != 1 || m.Success != 0.5 {
+		t.Fatalf("want 1 integrity error and half successful, got: %d, %.2f", m.IntegrityErrors, m.Success)
+	}
+}
@@ -0,0 +1,61 @@
+package korra
+
+import "net/http"
+
+// cacheValidators are what a server gave us to check whether a response
+// we've seen before is still current.
+type cacheValidators struct {
+	etag         string
+	lastModified string
+}
+
+// clientCache simulates a browser cache for a single session: it remembers
+// the validators for every URL fetched and uses them to make later requests
+// for that URL conditional. It's not safe for concurrent use, which is fine
+// since each session has its own Attacker.
+type clientCache struct {
+	entries map[string]cacheValidators
+}
+
+func newClientCache() *clientCache {
+	return &clientCache{entries: map[string]cacheValidators{}}
+}
+
+func cacheable(method string) bool {
+	return method == "GET" || method == "HEAD"
+}
+
+// prepare adds conditional headers to the request if we've seen its URL
+// before, returning true if it did; headers already in the script win.
+func (c *clientCache) prepare(req *http.Request) bool {
+	if !cacheable(req.Method) {
+		return false
+	}
+	validators, ok := c.entries[req.URL.String()]
+	if !ok {
+		return false
+	}
+	conditional := false
+	if validators.etag != "" && req.Header.Get("If-None-Match") == "" {
+		req.Header.Set("If-None-Match", validators.etag)
+		conditional = true
+	}
+	if validators.lastModified != "" && req.Header.Get("If-Modified-Since") == "" {
+		req.Header.Set("If-Modified-Since", validators.lastModified)
+		conditional = true
+	}
+	return conditional
+}
+
+// store remembers the validators from a full response to the request
+func (c *clientCache) store(req *http.Request, resp *http.Response) {
+	if !cacheable(req.Method) || resp.StatusCode != http.StatusOK {
+		return
+	}
+	validators := cacheValidators{resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")}
+	if validators.etag == "" && validators.lastModified == "" {
+		delete(c.entries, req.URL.String())
+		return
+	}
+	c.entries[req.URL.String()] = validators
+}
@@ -0,0 +1,39 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientCacheConditionalRequests(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+		}),
+	)
+	defer server.Close()
+	tgt := NewTarget()
+	tgt.Method, tgt.URL = "GET", server.URL
+	tr := func() (*Target, error) { return tgt, nil }
+	atk := NewAttacker(ClientCache(true))
+
+	first := atk.Hit(tr, time.Now(), 1)
+	if first.Conditional || first.Code != 200 {
+		t.Fatalf("first request: got conditional %t code %d, want false 200", first.Conditional, first.Code)
+	}
+	second := atk.Hit(tr, time.Now(), 1)
+	if !second.Conditional || !second.NotModified() {
+		t.Fatalf("second request: got conditional %t code %d, want true 304", second.Conditional, second.Code)
+	}
+
+	m := NewMetrics(Results{first, second})
+	if m.Cache.Conditional != 1 || m.Cache.NotModified != 1 {
+		t.Fatalf("got cache metrics %+v, want 1 conditional and 1 not modified", m.Cache)
+	}
+}
@@ -0,0 +1,61 @@
+package korra
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The clocks results can be timestamped by (see Clock)
+const (
+	WallClock      = "wall"      // the system's clock, as it's set at the time
+	MonotonicClock = "monotonic" // the attack's start plus the monotonic time since
+	BothClocks     = "both"      // the wall clock, recording the monotonic time as well
+)
+
+// ClockSources are the clocks results can be timestamped by
+var ClockSources = []string{WallClock, MonotonicClock, BothClocks}
+
+// Clock timestamps the results of an attack. Latencies are always measured
+// on Go's monotonic clock, which NTP can slew but never step; a timestamp
+// read from the wall clock, though, jumps with every step, so a long soak's
+// windows can overlap or gap where one did. By the monotonic clock results
+// are timestamped as the attack's start plus the monotonic time since, so
+// they keep their spacing whatever happens to the wall clock, at the cost of
+// drifting from it as much as it's corrected. Recording both keeps the wall
+// clock's timestamps; either way each result has the monotonic time since
+// the start as well, as Monotonic. Whichever the source, timestamps are
+// moved by the clock's offset from a reference (see SyncClock).
+type Clock struct {
+	Source  string
+	Started time.Time     // the attack's start, with its monotonic reading
+	Offset  time.Duration // added to every timestamp
+}
+
+// NewClock returns a clock by the source, one of ClockSources, starting now
+func NewClock(source string) (*Clock, error) {
+	for _, known := range ClockSources {
+		if source == known {
+			return &Clock{Source: source, Started: time.Now()}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown clock %s: want one of %s", source, strings.Join(ClockSources, ", "))
+}
+
+// stamp sets the result's timestamps by the clock; nil leaves them as they
+// are
+func (c *Clock) stamp(result *Result) {
+	if c == nil || result.Timestamp.IsZero() {
+		return
+	}
+	if c.Source != WallClock {
+		// the timestamp was read in this process, so this is by the
+		// monotonic clock
+		since := result.Timestamp.Sub(c.Started)
+		if c.Source == MonotonicClock {
+			result.Timestamp = c.Started.Round(0).Add(since)
+		}
+		result.Monotonic = since
+	}
+	result.Timestamp = result.Timestamp.Add(c.Offset)
+}
@@ -0,0 +1,42 @@
+package korra
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	if _, err := NewClock("sundial"); err == nil {
+		t.Error("want an error for an unknown clock")
+	}
+	for _, source := range ClockSources {
+		clock, err := NewClock(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent := clock.Started.Add(5 * time.Second)
+		result := &Result{Timestamp: sent}
+		clock.stamp(result)
+		switch source {
+		case WallClock:
+			if result.Monotonic != 0 || result.Timestamp != sent {
+				t.Errorf("want the wall clock's timestamp alone, got %+v", result)
+			}
+		case MonotonicClock:
+			if result.Monotonic != 5*time.Second || !result.Timestamp.Equal(sent) || strings.Contains(result.Timestamp.String(), "m=") {
+				t.Errorf("want the start plus 5s without a monotonic reading, got %s and %s", result.Timestamp, result.Monotonic)
+			}
+		case BothClocks:
+			if result.Monotonic != 5*time.Second || result.Timestamp != sent {
+				t.Errorf("want the wall clock's timestamp and 5s, got %s and %s", result.Timestamp, result.Monotonic)
+			}
+		}
+	}
+	var none *Clock
+	result := &Result{Timestamp: time.Now()}
+	none.stamp(result)
+	if result.Monotonic != 0 {
+		t.Errorf("want nothing recorded without a clock, got %s", result.Monotonic)
+	}
+}
@@ -0,0 +1,121 @@
+package korra
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// ntpEpochOffset is the seconds from NTP's epoch, 1900, to Unix's
+	ntpEpochOffset = 2208988800
+	// clockSyncSamples is how many times the server's asked the time, the
+	// quickest answer being the one trusted
+	clockSyncSamples = 8
+)
+
+// ClockSync is how far this host's clock was from a reference's, an NTP
+// server every host of a distributed run asks, when it was measured. Each
+// host's results are timestamped with its offset taken out, so results
+// merged from every host line up to within their errors.
+type ClockSync struct {
+	Server string        `json:"server"`
+	Offset time.Duration `json:"offset"` // add to this host's time to get the server's
+	Error  time.Duration `json:"error"`  // the most the offset may be off by: half the round trip
+}
+
+func (s *ClockSync) String() string {
+	direction := "behind"
+	if s.Offset < 0 {
+		direction = "ahead of"
+	}
+	return fmt.Sprintf("%s %s %s (±%s)", absDuration(s.Offset), direction, s.Server, s.Error)
+}
+
+// SyncClock measures this host's clock against the NTP server, given as host
+// or host:port, asking it the time a few times and trusting the quickest
+// answer, as NTP does
+func SyncClock(server string, timeout time.Duration) (*ClockSync, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var best *ClockSync
+	for i := 0; i < clockSyncSamples; i++ {
+		sample, err := sntpSample(conn, timeout)
+		if err != nil {
+			if best == nil && i == clockSyncSamples-1 {
+				return nil, fmt.Errorf("asking %s the time: %s", server, err)
+			}
+			continue
+		}
+		if best == nil || sample.Error < best.Error {
+			best = sample
+		}
+	}
+	best.Server = server
+	return best, nil
+}
+
+// sntpSample asks the server the time once, by SNTP (RFC 4330)
+func sntpSample(conn net.Conn, timeout time.Duration) (*ClockSync, error) {
+	request := make([]byte, 48)
+	request[0] = 0x23 // no leap warning, version 4, client
+	sent := time.Now()
+	binary.BigEndian.PutUint64(request[40:], ntpTime(sent))
+	conn.SetDeadline(sent.Add(timeout))
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, 48)
+	n, err := conn.Read(reply)
+	if err != nil {
+		return nil, err
+	}
+	// the round trip by the monotonic clock, so a step in the middle
+	// doesn't count
+	elapsed := time.Since(sent)
+	received := sent.Add(elapsed)
+	switch {
+	case n < 48 || reply[0]&0x7 != 4:
+		return nil, fmt.Errorf("not an NTP server's answer")
+	case reply[1] == 0:
+		return nil, fmt.Errorf("the server isn't synchronized")
+	case binary.BigEndian.Uint64(reply[24:]) != binary.BigEndian.Uint64(request[40:]):
+		return nil, fmt.Errorf("an answer to another request")
+	}
+	serverReceived, serverSent := fromNTPTime(binary.BigEndian.Uint64(reply[32:])), fromNTPTime(binary.BigEndian.Uint64(reply[40:]))
+	offset := (serverReceived.Sub(sent.Round(0)) + serverSent.Sub(received.Round(0))) / 2
+	roundTrip := elapsed - serverSent.Sub(serverReceived)
+	if roundTrip < 0 {
+		roundTrip = 0
+	}
+	return &ClockSync{Offset: offset, Error: roundTrip / 2}, nil
+}
+
+// ntpTime returns the time as an NTP timestamp: seconds since 1900 and
+// their fraction, 32 bits each
+func ntpTime(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fraction := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// fromNTPTime returns the time of an NTP timestamp
+func fromNTPTime(ntp uint64) time.Time {
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	nanos := int64((ntp & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(seconds, nanos)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,77 @@
+package korra
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSyncClock(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// a server whose clock is 3s ahead
+	go func() {
+		request := make([]byte, 48)
+		for {
+			_, from, err := conn.ReadFrom(request)
+			if err != nil {
+				return
+			}
+			reply := make([]byte, 48)
+			reply[0], reply[1] = 0x24, 2
+			copy(reply[24:32], request[40:48])
+			now := ntpTime(time.Now().Add(3 * time.Second))
+			binary.BigEndian.PutUint64(reply[32:], now)
+			binary.BigEndian.PutUint64(reply[40:], now)
+			conn.WriteTo(reply, from)
+		}
+	}()
+	sync, err := SyncClock(conn.LocalAddr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off := sync.Offset - 3*time.Second; off < -sync.Error-time.Millisecond || off > sync.Error+time.Millisecond {
+		t.Errorf("want 3s ahead, got %s", sync)
+	}
+
+	clock, _ := NewClock(WallClock)
+	clock.Offset = sync.Offset
+	sent := time.Now()
+	result := &Result{Timestamp: sent}
+	clock.stamp(result)
+	if result.Timestamp.Sub(sent) != sync.Offset {
+		t.Errorf("want the timestamp corrected by %s, got %s", sync.Offset, result.Timestamp.Sub(sent))
+	}
+
+	if _, err = SyncClock("127.0.0.1:1", 100*time.Millisecond); err == nil {
+		t.Error("want an error with no server to ask")
+	}
+}
+
+func TestNTPTime(t *testing.T) {
+	at := time.Date(2026, 10, 15, 1, 2, 3, 500000000, time.UTC)
+	if got := fromNTPTime(ntpTime(at)); got.Sub(at).Abs() > time.Microsecond {
+		t.Errorf("want %s back, got %s", at, got)
+	}
+}
+
+func TestSummarizeClockSkew(t *testing.T) {
+	summary := SummarizeMetadata([]*Metadata{
+		{Hostname: "a", ClockSync: &ClockSync{Error: 2 * time.Millisecond}},
+		{Hostname: "a", ClockSync: &ClockSync{Error: 3 * time.Millisecond}},
+		{Hostname: "b", ClockSync: &ClockSync{Error: 5 * time.Millisecond}},
+		{Hostname: "c", ClockSync: &ClockSync{Error: time.Millisecond}},
+		{Hostname: "d"},
+	})
+	if summary.Skew != 8*time.Millisecond || !reflect.DeepEqual(summary.Unsynced, []string{"d"}) {
+		t.Errorf("want 8ms of skew and d unsynced, got %s and %v", summary.Skew, summary.Unsynced)
+	}
+	if summary = SummarizeMetadata([]*Metadata{{Hostname: "a"}}); summary.Skew != 0 || summary.Unsynced != nil {
+		t.Errorf("want no skew reported without syncing, got %+v", summary)
+	}
+}
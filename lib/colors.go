@@ -0,0 +1,80 @@
+package korra
+
+import (
+	"os"
+	"strings"
+)
+
+// ANSI escape codes the text report is colored with
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+// Success ratios at or above which the text report colors them green, or
+// else yellow; below both they're red.
+var (
+	SuccessGreen  = 0.99
+	SuccessYellow = 0.95
+)
+
+// palette colors text for a terminal, or leaves it alone when it's off
+type palette bool
+
+func (p palette) paint(code, text string) string {
+	if !p || text == "" {
+		return text
+	}
+	return code + text + ansiReset
+}
+
+// heading is for the line starting each section of the report
+func (p palette) heading(text string) string { return p.paint(ansiBold, text) }
+
+// label is for the names of the values on a line, like [mean, 50, 95]
+func (p palette) label(text string) string { return p.paint(ansiDim, text) }
+
+// success colors the text for a success ratio by the thresholds
+func (p palette) success(ratio float64, text string) string {
+	switch {
+	case ratio >= SuccessGreen:
+		return p.paint(ansiGreen, text)
+	case ratio >= SuccessYellow:
+		return p.paint(ansiYellow, text)
+	}
+	return p.paint(ansiRed, text)
+}
+
+// status colors the text for a status code by its class: 2xx and 3xx are
+// green, 4xx yellow, and 5xx and no response at all red
+func (p palette) status(code, text string) string {
+	switch {
+	case strings.HasPrefix(code, "2"), strings.HasPrefix(code, "3"):
+		return p.paint(ansiGreen, text)
+	case strings.HasPrefix(code, "4"):
+		return p.paint(ansiYellow, text)
+	}
+	return p.paint(ansiRed, text)
+}
+
+// problems colors the text red when there are any of what it counts
+func (p palette) problems(count int, text string) string {
+	if count == 0 {
+		return text
+	}
+	return p.paint(ansiRed, text)
+}
+
+// IsTerminal returns whether the file is a terminal that can show colors,
+// which it can't if the NO_COLOR environment variable is set
+func IsTerminal(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
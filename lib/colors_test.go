@@ -0,0 +1,53 @@
+package korra
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPalette(t *testing.T) {
+	off, on := palette(false), palette(true)
+	if want, got := "99.00%", off.success(0.99, "99.00%"); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+	for _, tc := range []struct {
+		ratio float64
+		want  string
+	}{
+		{1, ansiGreen},
+		{0.99, ansiGreen},
+		{0.97, ansiYellow},
+		{0.5, ansiRed},
+	} {
+		if want, got := tc.want+"x"+ansiReset, on.success(tc.ratio, "x"); want != got {
+			t.Errorf("success %v; want: %q, got: %q", tc.ratio, want, got)
+		}
+	}
+	for code, want := range map[string]string{"200": ansiGreen, "304": ansiGreen, "404": ansiYellow, "503": ansiRed, "0": ansiRed} {
+		if got := on.status(code, "x"); want+"x"+ansiReset != got {
+			t.Errorf("status %s; want: %q, got: %q", code, want+"x"+ansiReset, got)
+		}
+	}
+	if want, got := "0", on.problems(0, "0"); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestTextReporterColor(t *testing.T) {
+	r := Results{{Code: 200, Method: "GET", Path: "/", Timestamp: time.Now(), Latency: time.Millisecond}}
+	plain, err := TextReporter{}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(plain), "\x1b[") {
+		t.Fatalf("want no escape codes without Color, got: %q", plain)
+	}
+	colored, err := TextReporter{Color: true}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(colored), ansiGreen+"100.00%"+ansiReset) {
+		t.Fatalf("want a green success ratio, got: %q", colored)
+	}
+}
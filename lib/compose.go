@@ -0,0 +1,78 @@
+package korra
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ComposeFiles are the names a directory's compose file is looked for by,
+// in the order Compose itself looks for them
+var ComposeFiles = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// ComposeEnv is a test environment of the target and what it needs,
+// defined by a compose file next to the sessions that attack it.
+type ComposeEnv struct {
+	Compose []string // the command to run Compose with, like docker compose
+	File    string
+	Project string // named for the directory, so runs don't share containers with anything else
+}
+
+// FindComposeEnv finds the compose file in the directory, to be run with
+// the command, like "docker compose" or "podman compose".
+func FindComposeEnv(dir, compose string) (*ComposeEnv, error) {
+	command := strings.Fields(compose)
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no compose command")
+	}
+	for _, name := range ComposeFiles {
+		file := filepath.Join(dir, name)
+		if _, err := os.Stat(file); err == nil {
+			return &ComposeEnv{Compose: command, File: file, Project: composeProject(dir)}, nil
+		}
+	}
+	return nil, fmt.Errorf("no compose file in %s (looked for %s)", dir, strings.Join(ComposeFiles, ", "))
+}
+
+// composeProject names the project for the directory, as korra-dir, in
+// the lowercase letters, digits, dashes and underscores Compose allows
+func composeProject(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	name := []rune{}
+	for _, r := range strings.ToLower(filepath.Base(abs)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			name = append(name, r)
+		} else {
+			name = append(name, '-')
+		}
+	}
+	return "korra-" + strings.Trim(string(name), "-_")
+}
+
+// command returns the Compose command for the environment with the args
+func (e *ComposeEnv) command(args ...string) *exec.Cmd {
+	all := append(append(e.Compose[1:len(e.Compose):len(e.Compose)], "-f", e.File, "-p", e.Project), args...)
+	cmd := exec.Command(e.Compose[0], all...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	return cmd
+}
+
+// Up returns the command that starts the environment, waiting up to the
+// time for every service to be running and, if it has a health check,
+// healthy
+func (e *ComposeEnv) Up(wait time.Duration) *exec.Cmd {
+	return e.command("up", "--detach", "--wait", "--wait-timeout", strconv.Itoa(int(wait.Seconds())))
+}
+
+// Down returns the command that stops the environment, removing its
+// containers, networks and volumes, so the next run starts afresh
+func (e *ComposeEnv) Down() *exec.Cmd {
+	return e.command("down", "--volumes", "--remove-orphans")
+}
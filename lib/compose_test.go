@@ -0,0 +1,49 @@
+package korra
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindComposeEnv(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Shop API")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FindComposeEnv(dir, "docker compose"); err == nil {
+		t.Fatal("want an error without a compose file")
+	}
+	for _, name := range []string{"docker-compose.yml", "compose.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("services: {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env, err := FindComposeEnv(dir, "docker compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "compose.yaml")
+	if env.File != file || env.Project != "korra-shop-api" {
+		t.Fatalf("want compose.yaml as project korra-shop-api, got: %+v", env)
+	}
+	if got, want := strings.Join(env.Up(90*time.Second).Args, " "), "docker compose -f "+file+" -p korra-shop-api up --detach --wait --wait-timeout 90"; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if got, want := strings.Join(env.Down().Args, " "), "docker compose -f "+file+" -p korra-shop-api down --volumes --remove-orphans"; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	env, err = FindComposeEnv(dir, "docker-compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := env.Down().Args; got[0] != "docker-compose" || got[1] != "-f" {
+		t.Errorf("want docker-compose -f ..., got %v", got)
+	}
+	if _, err = FindComposeEnv(dir, " "); err == nil {
+		t.Error("want an error without a compose command")
+	}
+}
@@ -0,0 +1,312 @@
+package korra
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigFile is the name of the file options are read from by default, if
+// it's in the directory a command runs in
+const ConfigFile = "korra.yaml"
+
+// Config is the options a command would otherwise take on its command
+// line, for every run and for each named profile, like smoke, soak and
+// stress. Each option is a list of values, one for each time its flag is
+// given.
+type Config struct {
+	Defaults map[string][]string
+	Profiles map[string]map[string][]string
+}
+
+// ReadConfig reads options from YAML, each option by its flag's name,
+// those under profiles for the profile named and the rest for every run:
+//
+//	dir: scripts
+//	timeout: 30s
+//	header:
+//	  - "X-Load-Test: korra"
+//	profiles:
+//	  smoke:
+//	    status: 5
+//	  soak:
+//	    snapshot: 10m
+//	    target: [http://api-1:8080, http://api-2:8080]
+//
+// It's the YAML of maps, lists of values and values, quoted or not, that
+// options need; anchors, multi-line values and the like aren't understood.
+func ReadConfig(in io.Reader) (*Config, error) {
+	lines, err := configLines(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return &Config{Defaults: map[string][]string{}, Profiles: map[string]map[string][]string{}}, nil
+	}
+	top, next, err := parseConfigBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("Line %d: Expected no more indented than line %d", lines[next].number, lines[0].number)
+	}
+	if top.values != nil {
+		return nil, fmt.Errorf("Line %d: Expected option: value, not a list", lines[0].number)
+	}
+	config := &Config{Profiles: map[string]map[string][]string{}}
+	for _, key := range top.keys {
+		if key.name != "profiles" {
+			continue
+		}
+		if key.node.keys == nil {
+			return nil, fmt.Errorf("Line %d: Expected each profile's options under profiles", key.number)
+		}
+		for _, profile := range key.node.keys {
+			if config.Profiles[profile.name], err = configOptions(profile.node, profile.number); err != nil {
+				return nil, err
+			}
+		}
+	}
+	top.keys = withoutKey(top.keys, "profiles")
+	if config.Defaults, err = configOptions(top, lines[0].number); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Options returns the options for the profile: those for every run, with
+// the profile's in place of any it has too. Without a profile they're just
+// those for every run.
+func (c *Config) Options(profile string) (map[string][]string, error) {
+	options := map[string][]string{}
+	for name, values := range c.Defaults {
+		options[name] = values
+	}
+	if profile == "" {
+		return options, nil
+	}
+	own, ok := c.Profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for name := range c.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("no profile %s, only: %s", profile, strings.Join(names, ", "))
+	}
+	for name, values := range own {
+		options[name] = values
+	}
+	return options, nil
+}
+
+// configLine is a line of a config file with something on it
+type configLine struct {
+	number int
+	indent int
+	text   string // without the indent or a comment
+}
+
+// configLines reads the lines with something on them, without comments
+func configLines(in io.Reader) ([]configLine, error) {
+	var lines []configLine
+	scanner := bufio.NewScanner(in)
+	for number := 1; scanner.Scan(); number++ {
+		raw := scanner.Text()
+		text := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("Line %d: Indent with spaces, not tabs", number)
+		}
+		indent := len(raw) - len(text)
+		text = strings.TrimSpace(stripConfigComment(text))
+		if text == "" || text == "---" {
+			continue
+		}
+		lines = append(lines, configLine{number, indent, text})
+	}
+	return lines, scanner.Err()
+}
+
+// stripConfigComment cuts a comment off the line: a # starting it, or
+// after a space, but not in quotes
+func stripConfigComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// configNode is a map of keys, a list of values, or a value
+type configNode struct {
+	keys   []configKey
+	values []string
+	value  string
+}
+
+type configKey struct {
+	name   string
+	number int
+	node   *configNode
+}
+
+// parseConfigBlock parses the lines from the first at the indent, up to
+// the first indented less: a list of values if they start with '-', or
+// else a map of keys
+func parseConfigBlock(lines []configLine, i, indent int) (*configNode, int, error) {
+	node := &configNode{}
+	if strings.HasPrefix(lines[i].text, "-") {
+		node.values = []string{}
+		for ; i < len(lines) && lines[i].indent == indent && strings.HasPrefix(lines[i].text, "-"); i++ {
+			value, err := configValue(strings.TrimSpace(lines[i].text[1:]))
+			if err != nil {
+				return nil, i, fmt.Errorf("Line %d: %s", lines[i].number, err)
+			}
+			node.values = append(node.values, value)
+		}
+		return node, i, nil
+	}
+	node.keys = []configKey{}
+	for i < len(lines) && lines[i].indent >= indent {
+		line := lines[i]
+		if line.indent > indent {
+			return nil, i, fmt.Errorf("Line %d: Expected it to line up with the line before", line.number)
+		}
+		colon := strings.Index(line.text+" ", ": ")
+		if colon <= 0 || strings.HasPrefix(line.text, "-") {
+			return nil, i, fmt.Errorf("Line %d: Expected key: value", line.number)
+		}
+		key := configKey{name: strings.TrimSpace(line.text[:colon]), number: line.number}
+		for _, other := range node.keys {
+			if other.name == key.name {
+				return nil, i, fmt.Errorf("Line %d: %s is given twice", line.number, key.name)
+			}
+		}
+		rest := strings.TrimSpace(line.text[colon+1:])
+		i++
+		switch {
+		case rest == "" && i < len(lines) && lines[i].indent > indent:
+			child, next, err := parseConfigBlock(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, next, err
+			}
+			key.node, i = child, next
+		case rest == "" && i < len(lines) && lines[i].indent == indent && strings.HasPrefix(lines[i].text, "-"):
+			// a list may line up with its key
+			child, next, err := parseConfigBlock(lines, i, indent)
+			if err != nil {
+				return nil, next, err
+			}
+			key.node, i = child, next
+		case strings.HasPrefix(rest, "["):
+			if !strings.HasSuffix(rest, "]") {
+				return nil, i, fmt.Errorf("Line %d: Expected ] at the end of the list", line.number)
+			}
+			values := []string{}
+			for _, item := range splitConfigList(rest[1 : len(rest)-1]) {
+				value, err := configValue(item)
+				if err != nil {
+					return nil, i, fmt.Errorf("Line %d: %s", line.number, err)
+				}
+				values = append(values, value)
+			}
+			key.node = &configNode{values: values}
+		default:
+			value, err := configValue(rest)
+			if err != nil {
+				return nil, i, fmt.Errorf("Line %d: %s", line.number, err)
+			}
+			key.node = &configNode{value: value}
+		}
+		node.keys = append(node.keys, key)
+	}
+	return node, i, nil
+}
+
+// splitConfigList splits an inline list's items on the commas outside quotes
+func splitConfigList(list string) []string {
+	var (
+		items []string
+		quote byte
+		start int
+	)
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+	for i := 0; i < len(list); i++ {
+		switch c := list[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(list[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, strings.TrimSpace(list[start:]))
+}
+
+// configValue unquotes a value if it's quoted
+func configValue(text string) (string, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return "", fmt.Errorf("Bad quoted value %s", text)
+		}
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return "", fmt.Errorf("Bad quoted value %s", text)
+		}
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	}
+	return text, nil
+}
+
+// configOptions turns a map of keys into options, each a value or a list
+func configOptions(node *configNode, number int) (map[string][]string, error) {
+	if node.keys == nil {
+		return nil, fmt.Errorf("Line %d: Expected option: value under it", number)
+	}
+	options := map[string][]string{}
+	for _, key := range node.keys {
+		switch {
+		case key.node.keys != nil:
+			return nil, fmt.Errorf("Line %d: Expected a value or a list for %s", key.number, key.name)
+		case key.node.values != nil:
+			options[key.name] = key.node.values
+		default:
+			options[key.name] = []string{key.node.value}
+		}
+	}
+	return options, nil
+}
+
+// withoutKey returns the keys without the one named
+func withoutKey(keys []configKey, name string) []configKey {
+	without := make([]configKey, 0, len(keys))
+	for _, key := range keys {
+		if key.name != name {
+			without = append(without, key)
+		}
+	}
+	return without
+}
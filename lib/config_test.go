@@ -0,0 +1,68 @@
+package korra
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	config, err := ReadConfig(strings.NewReader(`---
+# options for every run
+dir: scripts
+timeout: 30s   # per request
+header:
+  - "X-Load-Test: korra # not a comment"
+  - X-Team: checkout
+profiles:
+  smoke:
+    status: 5
+    precheck: 'true'
+  soak:
+    timeout: 1m
+    target: [http://api-1:8080, "http://api-2:8080=2"]
+    then:
+    - soak/cooldown
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"dir":     {"scripts"},
+		"timeout": {"1m"},
+		"header":  {"X-Load-Test: korra # not a comment", "X-Team: checkout"},
+		"target":  {"http://api-1:8080", "http://api-2:8080=2"},
+		"then":    {"soak/cooldown"},
+	}
+	if got, err := config.Options("soak"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v %v", want, got, err)
+	}
+	if got, err := config.Options("smoke"); err != nil || got["precheck"][0] != "true" || got["timeout"][0] != "30s" {
+		t.Fatalf("want smoke's options with those for every run, got %v %v", got, err)
+	}
+	if got, err := config.Options(""); err != nil || len(got) != 3 {
+		t.Fatalf("want just those for every run, got %v %v", got, err)
+	}
+	if _, err = config.Options("stress"); err == nil || !strings.Contains(err.Error(), "only: smoke, soak") {
+		t.Fatalf("want an error naming the profiles, got: %v", err)
+	}
+
+	for _, bad := range []string{
+		"dir scripts\n",
+		"- scripts\n",
+		"dir: scripts\n  timeout: 30s\n",
+		"dir: scripts\ndir: other\n",
+		"profiles:\n  smoke: fast\n",
+		"header:\n  name: value\n",
+		"target: [http://api-1:8080\n",
+		"dir: \"scripts\n",
+		"dir: scripts\n\ttimeout: 30s\n",
+	} {
+		if _, err := ReadConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("want an error for %q", bad)
+		}
+	}
+	if config, err = ReadConfig(strings.NewReader("# nothing yet\n")); err != nil || len(config.Defaults) != 0 {
+		t.Fatalf("want no options, got %+v %v", config, err)
+	}
+}
@@ -0,0 +1,120 @@
+package korra
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a certificate and key for the name signed by the parent,
+// or self-signed as a CA without one, returning them and the files
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return cert, key, certFile, keyFile
+}
+
+func TestControlTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caFile, _ := writeCert(t, dir, "ca", nil, nil)
+	_, _, serverCert, serverKey := writeCert(t, dir, "server", ca, caKey)
+	_, _, clientCert, clientKey := writeCert(t, dir, "client", ca, caKey)
+	other, otherKey, _, _ := writeCert(t, dir, "other", nil, nil)
+	_, _, strangerCert, strangerKey := writeCert(t, dir, "stranger", other, otherKey)
+
+	if config, err := ControlTLS("", "", ""); config != nil || err != nil {
+		t.Fatalf("want no TLS without a certificate, got %v, %v", config, err)
+	}
+	if _, err := ControlTLS("", "", caFile); err == nil {
+		t.Fatal("want an error requiring client certificates without a certificate to serve with")
+	}
+	config, err := ControlTLS(serverCert, serverKey, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), TLSConfig: config}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+	url := "https://" + listener.Addr().String()
+
+	for _, test := range []struct {
+		cert, key string
+		ok        bool
+	}{
+		{clientCert, clientKey, true},
+		{"", "", false},
+		{strangerCert, strangerKey, false},
+	} {
+		clientConfig, err := ControlClientTLS(test.cert, test.key, caFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}, Timeout: 5 * time.Second}
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err == nil) != test.ok {
+			t.Errorf("certificate %q: want ok %t, got %v", test.cert, test.ok, err)
+		}
+	}
+}
+
+func TestBearerAuthorized(t *testing.T) {
+	for _, test := range []struct {
+		token  string
+		header http.Header
+		want   bool
+	}{
+		{"", http.Header{}, true},
+		{"s3cret", http.Header{}, false},
+		{"s3cret", http.Header{"Authorization": {"Bearer s3cret"}}, true},
+		{"s3cret", http.Header{"Authorization": {"Bearer wrong"}}, false},
+		{"s3cret", http.Header{"Authorization": {"s3cret"}}, false},
+	} {
+		if got := BearerAuthorized(test.token, test.header); got != test.want {
+			t.Errorf("token %q with %v: want %t, got %t", test.token, test.header, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package korra
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encodings are the names of the encodings result files can be converted
+// between: gob is what sessions record (also called bin or binary, for the
+// extension), json is JSON lines and csv is the tab-separated records of
+// DumpCSV. Both json and csv read what the dump command writes. Results can
+// also be written as parquet, but not read from it.
+var Encodings = []string{"csv", "gob", "json", "parquet"}
+
+var encodingAliases = map[string]string{"bin": "gob", "binary": "gob", "jsonl": "json"}
+
+// ResultReader reads the records of a result file one at a time, returning
+// io.EOF after the last. The metadata record, if there is one, comes back as
+// a Result with only Metadata set, like it's stored.
+type ResultReader interface {
+	Read() (*Result, error)
+}
+
+// ResultWriter writes the records of a result file one at a time; Flush
+// must be called after the last.
+type ResultWriter interface {
+	Write(*Result) error
+	Flush() error
+}
+
+// NewResultReader returns a reader for results in the encoding
+func NewResultReader(encoding string, in io.Reader) (ResultReader, error) {
+	switch canonicalEncoding(encoding) {
+	case "gob":
+		return &gobResultReader{newResultDecoder(in)}, nil
+	case "json":
+		return &jsonResultReader{json.NewDecoder(bufio.NewReader(in))}, nil
+	case "csv":
+		return newCSVResultReader(in), nil
+	case "parquet":
+		return nil, fmt.Errorf("results can be written as parquet but not read from it")
+	}
+	return nil, fmt.Errorf("unsupported encoding: %s (want one of %s)", encoding, strings.Join(Encodings, ", "))
+}
+
+// NewResultWriter returns a writer of results in the encoding
+func NewResultWriter(encoding string, out io.Writer) (ResultWriter, error) {
+	buf := bufio.NewWriter(out)
+	switch canonicalEncoding(encoding) {
+	case "gob":
+		return &gobResultWriter{newResultEncoder(buf), buf}, nil
+	case "json":
+		return &jsonResultWriter{json.NewEncoder(buf), buf}, nil
+	case "csv":
+		return &csvResultWriter{w: buf}, nil
+	case "parquet":
+		return NewParquetWriter(out), nil
+	}
+	return nil, fmt.Errorf("unsupported encoding: %s (want one of %s)", encoding, strings.Join(Encodings, ", "))
+}
+
+func canonicalEncoding(encoding string) string {
+	if alias, ok := encodingAliases[encoding]; ok {
+		return alias
+	}
+	return encoding
+}
+
+// ConvertResults copies every record from the reader to the writer as it
+// reads them, so a file of any size converts in constant memory, and
+// returns how many results it copied, not counting the metadata.
+func ConvertResults(r ResultReader, w ResultWriter) (int, error) {
+	count := 0
+	for {
+		result, err := r.Read()
+		if err == io.EOF {
+			return count, w.Flush()
+		} else if err != nil {
+			w.Flush()
+			return count, fmt.Errorf("after %d results: %s", count, err)
+		}
+		if err = w.Write(result); err != nil {
+			return count, err
+		}
+		if result.Metadata == nil {
+			count++
+		}
+	}
+}
+
+type gobResultReader struct{ dec *resultDecoder }
+
+func (r *gobResultReader) Read() (*Result, error) {
+	var result Result
+	if err := r.dec.Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type gobResultWriter struct {
+	enc *resultEncoder
+	buf *bufio.Writer
+}
+
+func (w *gobResultWriter) Write(r *Result) error { return w.enc.Encode(r) }
+
+// Flush finishes the file with its final checkpoint
+func (w *gobResultWriter) Flush() error {
+	if err := w.enc.finish(); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+// jsonMetadata is how the metadata record is written as a JSON line, since
+// Result leaves it out of its JSON
+type jsonMetadata struct {
+	Metadata *Metadata `json:"metadata"`
+}
+
+type jsonResultReader struct{ dec *json.Decoder }
+
+func (r *jsonResultReader) Read() (*Result, error) {
+	var line struct {
+		Result
+		Metadata *Metadata `json:"metadata"`
+	}
+	if err := r.dec.Decode(&line); err != nil {
+		return nil, err
+	}
+	if line.Metadata != nil {
+		return &Result{Metadata: line.Metadata}, nil
+	}
+	return &line.Result, nil
+}
+
+type jsonResultWriter struct {
+	enc *json.Encoder
+	buf *bufio.Writer
+}
+
+func (w *jsonResultWriter) Write(r *Result) error {
+	if r.Metadata != nil {
+		return w.enc.Encode(jsonMetadata{r.Metadata})
+	}
+	return w.enc.Encode(r)
+}
+
+func (w *jsonResultWriter) Flush() error { return w.buf.Flush() }
+
+// csvColumns is how many columns DumpCSV writes
+const csvColumns = 12
+
+type csvResultReader struct {
+	lines *bufio.Scanner
+	line  int
+}
+
+func newCSVResultReader(in io.Reader) *csvResultReader {
+	lines := bufio.NewScanner(in)
+	lines.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &csvResultReader{lines: lines}
+}
+
+// Read parses the next record written by DumpCSV, skipping the header. The
+// columns don't say whether a request was conditional or which event it
+// was, and there's no metadata to read, so those come back empty.
+func (r *csvResultReader) Read() (*Result, error) {
+	for r.lines.Scan() {
+		r.line++
+		line := r.lines.Text()
+		if line == "" || (r.line == 1 && strings.HasPrefix(line, "Timestamp\t")) {
+			continue
+		}
+		return parseCSVResult(line, r.line)
+	}
+	if err := r.lines.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func parseCSVResult(line string, lineNum int) (*Result, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < csvColumns {
+		return nil, fmt.Errorf("line %d: want %d columns, got %d", lineNum, csvColumns, len(fields))
+	}
+	// the error is the only column that may have tabs of its own, so it's
+	// whatever is between the 8 columns before it and the 3 after
+	after := fields[len(fields)-3:]
+	fields = append(fields[:8:8], strings.Join(fields[8:len(fields)-3], "\t"))
+	fields = append(fields, after...)
+
+	var (
+		ints [7]int64
+		err  error
+	)
+	for i, col := range []int{0, 1, 4, 5, 6, 7, 9} {
+		if ints[i], err = strconv.ParseInt(fields[col], 10, 64); err != nil {
+			return nil, fmt.Errorf("line %d, column %d: %s", lineNum, col+1, err)
+		}
+	}
+	return &Result{
+		Timestamp:    time.Unix(0, ints[0]),
+		Code:         uint16(ints[1]),
+		Method:       fields[2],
+		Path:         fields[3],
+		RequestCount: int(ints[2]),
+		Latency:      time.Duration(ints[3]),
+		BytesOut:     uint64(ints[4]),
+		BytesIn:      uint64(ints[5]),
+		Error:        fields[8],
+		DNSLatency:   time.Duration(ints[6]),
+		DNSResolver:  fields[10],
+		Target:       fields[11],
+	}, nil
+}
+
+type csvResultWriter struct {
+	w      *bufio.Writer
+	header bool
+}
+
+// Write writes the result as DumpCSV does, after the header; CSV has no
+// place for the metadata, so it's left out.
+func (w *csvResultWriter) Write(r *Result) error {
+	if !w.header {
+		w.header = true
+		if _, err := w.w.Write(DumpCSVHeader()); err != nil {
+			return err
+		}
+	}
+	if r.Metadata != nil {
+		return nil
+	}
+	record, err := DumpCSV(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(record)
+	return err
+}
+
+func (w *csvResultWriter) Flush() error { return w.w.Flush() }
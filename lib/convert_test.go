@@ -0,0 +1,111 @@
+package korra
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConvertResultsRoundTrip(t *testing.T) {
+	meta := NewMetadata(1, map[string]string{"timeout": "10s"}).forSession("user_1.txt")
+	results := []*Result{
+		{Metadata: meta},
+		{
+			Timestamp: time.Unix(0, 1450000000123456789), Code: 200, Method: "GET", Path: "/a",
+			RequestCount: 1, Latency: 12 * time.Millisecond, BytesOut: 10, BytesIn: 2048,
+			DNSLatency: time.Millisecond, DNSResolver: "10.0.0.2:53", Target: "http://a.example",
+		},
+		{Timestamp: time.Unix(0, 1450000001000000000), Code: 0, Method: "POST", Path: "/b", Error: "read:\ttimeout"},
+	}
+
+	var src bytes.Buffer
+	w, _ := NewResultWriter("gob", &src)
+	for _, r := range results {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Flush()
+
+	// gob -> json -> csv -> gob
+	encoded := src.Bytes()
+	for _, step := range [][2]string{{"gob", "json"}, {"json", "csv"}, {"csv", "binary"}} {
+		r, err := NewResultReader(step[0], bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		w, err := NewResultWriter(step[1], &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := ConvertResults(r, w)
+		if err != nil {
+			t.Fatalf("%s to %s: %s", step[0], step[1], err)
+		}
+		if count != 2 {
+			t.Fatalf("%s to %s: want 2 results, got %d", step[0], step[1], count)
+		}
+		encoded = out.Bytes()
+	}
+
+	r, _ := NewResultReader("gob", bytes.NewReader(encoded))
+	for _, want := range results[1:] {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Timestamp.Equal(want.Timestamp) {
+			t.Fatalf("want timestamp %s, got %s", want.Timestamp, got.Timestamp)
+		}
+		got.Timestamp = want.Timestamp
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("want %+v, got %+v", want, got)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("want the end, got: %v", err)
+	}
+}
+
+func TestConvertResultsKeepsMetadata(t *testing.T) {
+	meta := NewMetadata(3, map[string]string{"seed": "7"}).forSession("user_2.txt")
+	var src bytes.Buffer
+	w, _ := NewResultWriter("json", &src)
+	w.Write(&Result{Metadata: meta})
+	w.Write(&Result{Code: 200, Path: "/"})
+	w.Flush()
+
+	r, _ := NewResultReader("json", &src)
+	var out bytes.Buffer
+	w, _ = NewResultWriter("gob", &out)
+	if _, err := ConvertResults(r, w); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadMetadata(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read == nil || read.Session != "user_2.txt" || read.Sessions != 3 || read.Settings["seed"] != "7" {
+		t.Fatalf("want the metadata to carry over, got: %+v", read)
+	}
+}
+
+func TestUnsupportedEncoding(t *testing.T) {
+	if _, err := NewResultReader("xml", nil); err == nil {
+		t.Fatal("want an error for an unknown encoding")
+	}
+	if _, err := NewResultWriter("xml", ioutil.Discard); err == nil {
+		t.Fatal("want an error for an unknown encoding")
+	}
+}
+
+func TestCSVResultReaderBadLine(t *testing.T) {
+	r, _ := NewResultReader("csv", bytes.NewBufferString(string(DumpCSVHeader())+"1\t200\tGET\n"))
+	if _, err := r.Read(); err == nil {
+		t.Fatal("want an error for a short line")
+	}
+}
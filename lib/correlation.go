@@ -0,0 +1,70 @@
+package korra
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// CorrelationThreshold is the coefficient at or above which a set of
+// results' errors and slowdowns are said to coincide
+var CorrelationThreshold = 0.7
+
+// minCorrelationWindows is the fewest windows with results there must be to
+// correlate them
+const minCorrelationWindows = 3
+
+// ErrorCorrelation is how closely the error rate of a set of results follows
+// their latency across windows of the run. Errors that come with slowdowns
+// point to overload, where errors that don't point to a bug of their own.
+type ErrorCorrelation struct {
+	Coefficient float64 `json:"coefficient"` // Pearson's r, from -1 to 1
+	Windows     int     `json:"windows"`
+	Coincide    bool    `json:"coincide"` // whether it's at least CorrelationThreshold
+}
+
+func (c *ErrorCorrelation) String() string {
+	verdict := "independent"
+	if c.Coincide {
+		verdict = "errors coincide with slowdowns"
+	}
+	return fmt.Sprintf("%+.2f over %d windows, %s", c.Coefficient, c.Windows, verdict)
+}
+
+// CorrelateErrors splits the results into windows of the given width and
+// correlates the error rate with the mean latency of each. It returns nil
+// if there's nothing to correlate: no window width, too few windows, or an
+// error rate or latency that never changes -- like having no errors at all.
+func CorrelateErrors(r Results, window time.Duration) *ErrorCorrelation {
+	if window <= 0 || len(r) == 0 {
+		return nil
+	}
+	_, windows := windowed(r, window)
+	if len(windows) < minCorrelationWindows {
+		return nil
+	}
+	var latencyMean, errorMean float64
+	for _, w := range windows {
+		latencyMean += w.meanLatency()
+		errorMean += w.errorRate()
+	}
+	latencyMean /= float64(len(windows))
+	errorMean /= float64(len(windows))
+
+	var covariance, latencyVariance, errorVariance float64
+	for _, w := range windows {
+		dl, de := w.meanLatency()-latencyMean, w.errorRate()-errorMean
+		covariance += dl * de
+		latencyVariance += dl * dl
+		errorVariance += de * de
+	}
+	if latencyVariance == 0 || errorVariance == 0 {
+		return nil
+	}
+	coefficient := covariance / math.Sqrt(latencyVariance*errorVariance)
+	return &ErrorCorrelation{
+		Coefficient: coefficient,
+		Windows:     len(windows),
+		Coincide:    coefficient >= CorrelationThreshold,
+	}
+}
@@ -0,0 +1,45 @@
+package korra
+
+import (
+	"testing"
+	"time"
+)
+
+// windows of results one second apart, each with the latency and the
+// number of errors out of ten
+func correlationResults(latencies []time.Duration, errors []int) Results {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	var r Results
+	for sec := range latencies {
+		for i := 0; i < 10; i++ {
+			result := &Result{Timestamp: start.Add(time.Duration(sec) * time.Second), Latency: latencies[sec]}
+			if i < errors[sec] {
+				result.Error = "503 Service Unavailable"
+			}
+			r = append(r, result)
+		}
+	}
+	return r
+}
+
+func TestCorrelateErrors(t *testing.T) {
+	ms := time.Millisecond
+	overload := correlationResults([]time.Duration{100 * ms, 110 * ms, 900 * ms, 1000 * ms, 120 * ms}, []int{0, 0, 4, 5, 0})
+	c := CorrelateErrors(overload, time.Second)
+	if c == nil || !c.Coincide || c.Windows != 5 {
+		t.Fatalf("want errors to coincide with slowdowns over 5 windows, got: %v", c)
+	}
+
+	bug := correlationResults([]time.Duration{100 * ms, 900 * ms, 100 * ms, 900 * ms, 100 * ms, 900 * ms}, []int{5, 0, 0, 5, 5, 0})
+	if c := CorrelateErrors(bug, time.Second); c == nil || c.Coincide || c.Coefficient > 0 {
+		t.Fatalf("want errors independent of slowdowns, got: %v", c)
+	}
+
+	healthy := correlationResults([]time.Duration{100 * ms, 900 * ms, 100 * ms}, []int{0, 0, 0})
+	if c := CorrelateErrors(healthy, time.Second); c != nil {
+		t.Fatalf("want nothing to correlate without errors, got: %v", c)
+	}
+	if c := CorrelateErrors(overload[:20], time.Second); c != nil {
+		t.Fatalf("want nothing to correlate in two windows, got: %v", c)
+	}
+}
@@ -0,0 +1,446 @@
+package korra
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the ways a CRAWL step picks which of the URLs found to request
+const (
+	CrawlUniform  = "uniform"  // every URL as likely as the next
+	CrawlPriority = "priority" // in proportion to their sitemap <priority>
+)
+
+// CrawlConfig defines how a CRAWL step crawls a site: it reads its URL, a
+// sitemap, following the sitemaps of a sitemap index Depth levels down, and
+// keeps the URLs robots.txt allows. Then it requests Requests of them, each
+// picked by Weight.
+type CrawlConfig struct {
+	Requests int    // GETs to make across the URLs found
+	Depth    int    // levels of sitemap indexes to follow
+	Weight   string // CrawlUniform or CrawlPriority
+}
+
+func NewCrawlConfig() *CrawlConfig {
+	return &CrawlConfig{Requests: 100, Depth: 2, Weight: CrawlPriority}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value param=value]
+//
+// and fills itself from the parameters, as:
+//
+//   - requests: The number of requests to make (default: 100)
+//   - depth: The levels of sitemap indexes to follow to their sitemaps; 0
+//     reads only the step's own (default: 2)
+//   - weight: How to pick each URL to request, 'uniform' or by sitemap
+//     'priority' (default: priority)
+func (config *CrawlConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for crawl param, got: %s", piece)
+		}
+		value := strings.TrimSpace(param[1])
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "requests":
+			num, err := strconv.Atoi(value)
+			if err != nil || num <= 0 {
+				return fmt.Errorf("Expected positive int for crawl param, got: %s", piece)
+			}
+			config.Requests = num
+		case "depth":
+			num, err := strconv.Atoi(value)
+			if err != nil || num < 0 {
+				return fmt.Errorf("Expected int of 0 or more for crawl param, got: %s", piece)
+			}
+			config.Depth = num
+		case "weight":
+			if value = strings.ToLower(value); value != CrawlUniform && value != CrawlPriority {
+				return fmt.Errorf("Expected %s or %s for crawl weight, got: %s", CrawlUniform, CrawlPriority, value)
+			}
+			config.Weight = value
+		default:
+			return fmt.Errorf("Unknown crawl param: %s", param[0])
+		}
+	}
+	return nil
+}
+
+func (config *CrawlConfig) String() string {
+	return fmt.Sprintf("[Requests=%d Depth=%d Weight=%s]", config.Requests, config.Depth, config.Weight)
+}
+
+// siteMap is what crawling a sitemap found: the URLs robots.txt allows,
+// with their priorities
+type siteMap struct {
+	URLs       []string
+	Priorities []float64
+	Disallowed int // URLs robots.txt disallows
+	Sitemaps   int // sitemaps read, counting the first
+}
+
+// the parts of a sitemap or sitemap index that matter to a crawl
+type sitemapXML struct {
+	XMLName  xml.Name
+	URLs     []sitemapURL `xml:"url"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+type sitemapURL struct {
+	Loc      string `xml:"loc"`
+	Priority string `xml:"priority"`
+}
+
+// sitemapLimit is the most of a robots.txt or sitemap read, the biggest a
+// sitemap may be
+const sitemapLimit = 50 << 20
+
+// fetchFunc gets the body of a URL for a crawl, with its status code
+type fetchFunc func(url string) ([]byte, int, error)
+
+// crawlSitemap reads the sitemap at the URL and the sitemaps it lists, to
+// depth levels, keeping the URLs each host's robots.txt allows the agent.
+func crawlSitemap(fetch fetchFunc, sitemap string, depth int, agent string) (*siteMap, error) {
+	site := &siteMap{}
+	robots := map[string]*robotsRules{}
+	allowed := func(u string) (bool, error) {
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Host == "" {
+			return false, fmt.Errorf("bad URL in sitemap: %s", u)
+		}
+		origin := parsed.Scheme + "://" + parsed.Host
+		rules, ok := robots[origin]
+		if !ok {
+			body, code, err := fetch(origin + "/robots.txt")
+			switch {
+			case err != nil:
+				return false, fmt.Errorf("can't read %s/robots.txt: %s", origin, err)
+			case code >= 200 && code < 300:
+				rules = parseRobots(body, agent)
+			case code >= 400 && code < 500:
+				rules = nil // no robots.txt, so nothing's disallowed
+			default:
+				return false, fmt.Errorf("can't read %s/robots.txt: status %d", origin, code)
+			}
+			robots[origin] = rules
+		}
+		return rules.allowed(parsed.RequestURI()), nil
+	}
+
+	seen := map[string]bool{}
+	var read func(u string, level int) error
+	read = func(u string, level int) error {
+		if seen[u] {
+			return nil
+		}
+		seen[u] = true
+		body, code, err := fetch(u)
+		if err != nil {
+			return fmt.Errorf("can't read sitemap %s: %s", u, err)
+		} else if code < 200 || code >= 300 {
+			return fmt.Errorf("can't read sitemap %s: status %d", u, code)
+		}
+		if len(body) > 1 && body[0] == 0x1f && body[1] == 0x8b {
+			unzipped, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return fmt.Errorf("bad gzipped sitemap %s: %s", u, err)
+			}
+			if body, err = io.ReadAll(io.LimitReader(unzipped, sitemapLimit)); err != nil {
+				return fmt.Errorf("bad gzipped sitemap %s: %s", u, err)
+			}
+		}
+		var parsed sitemapXML
+		if err := xml.Unmarshal(body, &parsed); err != nil {
+			return fmt.Errorf("bad sitemap %s: %s", u, err)
+		}
+		site.Sitemaps++
+		base, _ := url.Parse(u)
+		for _, entry := range parsed.URLs {
+			loc, err := base.Parse(strings.TrimSpace(entry.Loc))
+			if err != nil {
+				continue
+			}
+			ok, err := allowed(loc.String())
+			if err != nil {
+				return err
+			} else if !ok {
+				site.Disallowed++
+				continue
+			}
+			priority := 0.5
+			if entry.Priority != "" {
+				if p, err := strconv.ParseFloat(strings.TrimSpace(entry.Priority), 64); err == nil && p >= 0 && p <= 1 {
+					priority = p
+				}
+			}
+			site.URLs = append(site.URLs, loc.String())
+			site.Priorities = append(site.Priorities, priority)
+		}
+		if level >= depth {
+			return nil
+		}
+		for _, entry := range parsed.Sitemaps {
+			loc, err := base.Parse(strings.TrimSpace(entry.Loc))
+			if err != nil {
+				continue
+			}
+			if err := read(loc.String(), level+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := read(sitemap, 0); err != nil {
+		return nil, err
+	}
+	return site, nil
+}
+
+// robotsRules are the Allow and Disallow rules of a robots.txt group
+type robotsRules struct {
+	rules []robotsRule
+}
+
+type robotsRule struct {
+	allow   bool
+	length  int // of the rule's path, for the longest to win
+	pattern *regexp.Regexp
+}
+
+// parseRobots reads the rules of the robots.txt group for the agent: the
+// one whose User-agent is the longest found in it, or * if none is.
+func parseRobots(body []byte, agent string) *robotsRules {
+	type group struct {
+		agents []string
+		rules  []robotsRule
+	}
+	var (
+		groups  []*group
+		current *group
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "user-agent":
+			if current == nil || len(current.rules) > 0 {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil || value == "" {
+				continue // an empty Disallow disallows nothing
+			}
+			current.rules = append(current.rules, robotsRule{
+				allow:   strings.EqualFold(strings.TrimSpace(field), "allow"),
+				length:  len(value),
+				pattern: robotsPattern(value),
+			})
+		}
+	}
+	agent = strings.ToLower(agent)
+	var (
+		chosen *group
+		best   = -1
+	)
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a == "*" && best < 0 {
+				chosen, best = g, 0
+			} else if a != "*" && strings.Contains(agent, a) && len(a) > best {
+				chosen, best = g, len(a)
+			}
+		}
+	}
+	if chosen == nil {
+		return nil
+	}
+	return &robotsRules{chosen.rules}
+}
+
+// robotsPattern compiles a robots.txt path, where * is anything and a $ at
+// the end is the end of the path
+func robotsPattern(path string) *regexp.Regexp {
+	anchored := strings.HasSuffix(path, "$")
+	path = strings.TrimSuffix(path, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(path), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed returns true if the longest rule matching the path allows it, or
+// none matches; an Allow wins a tie
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	allow, longest := true, -1
+	for _, rule := range r.rules {
+		if rule.pattern.MatchString(path) && (rule.length > longest || rule.length == longest && rule.allow) {
+			allow, longest = rule.allow, rule.length
+		}
+	}
+	return allow
+}
+
+// newCrawlTargeter returns a Targeter picking one of the site's URLs for a
+// GET with the target's headers each time, CrawlUniform or by CrawlPriority
+func newCrawlTargeter(tgt *Target, site *siteMap, weight string, random *Random) Targeter {
+	cumulative := make([]float64, len(site.URLs))
+	total := 0.0
+	for i := range site.URLs {
+		if weight == CrawlPriority {
+			total += site.Priorities[i]
+		} else {
+			total++
+		}
+		cumulative[i] = total
+	}
+	return func() (*Target, error) {
+		if total == 0 {
+			return nil, fmt.Errorf("no URLs to crawl from %s", tgt.URL)
+		}
+		i := sort.SearchFloat64s(cumulative, random.Float64()*total)
+		for i < len(cumulative)-1 && cumulative[i] == 0 {
+			i++
+		}
+		crawl := NewTarget()
+		crawl.Method, crawl.URL, crawl.Header, crawl.Timeouts = "GET", site.URLs[i], tgt.Header, tgt.Timeouts
+		return crawl, nil
+	}
+}
+
+// Sitemaps are the sitemaps every session of an attack shares, crawled once
+// each by the first session to need them
+type Sitemaps struct {
+	sync.Mutex
+	crawled map[string]*crawledSitemap
+}
+
+type crawledSitemap struct {
+	once sync.Once
+	site *siteMap
+	err  error
+}
+
+func NewSitemaps() *Sitemaps {
+	return &Sitemaps{crawled: map[string]*crawledSitemap{}}
+}
+
+// crawl returns what crawling the target's sitemap finds, crawling it with
+// fetch if no session has, and whether this did; without Sitemaps every
+// crawl is its own.
+func (s *Sitemaps) crawl(tgt *Target, fetch fetchFunc) (*siteMap, bool, error) {
+	agent := tgt.Header.Get("User-Agent")
+	if agent == "" {
+		agent = "korra"
+	}
+	if s == nil {
+		site, err := crawlSitemap(fetch, tgt.URL, tgt.Crawl.Depth, agent)
+		return site, true, err
+	}
+	key := fmt.Sprintf("%s %d %s", tgt.URL, tgt.Crawl.Depth, agent)
+	s.Lock()
+	c := s.crawled[key]
+	if c == nil {
+		c = &crawledSitemap{}
+		s.crawled[key] = c
+	}
+	s.Unlock()
+	crawled := false
+	c.once.Do(func() {
+		c.site, c.err = crawlSitemap(fetch, tgt.URL, tgt.Crawl.Depth, agent)
+		crawled = true
+	})
+	return c.site, crawled, c.err
+}
+
+// get fetches the URL with the target's headers and the attacker's, for
+// crawling, reading at most sitemapLimit of the body
+func (a *Attacker) get(tgt *Target, u string) ([]byte, int, error) {
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	request.Header = tgt.Header.Clone()
+	if request.Header == nil {
+		request.Header = http.Header{}
+	}
+	rebase(request, a.base)
+	a.addHeaders(request)
+	response, err := a.client.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, sitemapLimit))
+	return body, response.StatusCode, err
+}
+
+// doCrawl crawls the target's sitemap, or has another session's crawl of it,
+// then makes its requests across the URLs found. Reading robots.txt and the
+// sitemaps isn't recorded; each request is a result, with its number as the
+// request count.
+func (session *Session) doCrawl(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	config := target.Crawl
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => CRAWL %s %s %s",
+			200, target.Method, target.URL, config))
+		return
+	}
+	session.Gate.wait(session.aborted)
+	started := time.Now()
+	site, crawled, err := session.Sitemaps.crawl(target, func(u string) ([]byte, int, error) {
+		return session.attacker.get(target, u)
+	})
+	if err == nil && len(site.URLs) == 0 {
+		err = fmt.Errorf("no URLs to crawl from %s", target.URL)
+	}
+	if err != nil {
+		result := &Result{Timestamp: started, Method: target.Method, Error: err.Error(), Latency: time.Since(started)}
+		result.PathFromURL(target.URL)
+		session.send(result)
+		return
+	}
+	if crawled {
+		session.log(fmt.Sprintf("CRAWL %s: %d URLs from %d sitemaps, %d disallowed by robots.txt",
+			target.URL, len(site.URLs), site.Sitemaps, site.Disallowed))
+	}
+	targeter := newCrawlTargeter(target, site, config.Weight, session.attacker.random)
+	for requests := 1; requests <= config.Requests && !session.isAborted(); requests++ {
+		session.Gate.wait(session.aborted)
+		result := session.attacker.Hit(targeter, time.Now(), requests)
+		if result.Error == ErrLimitAborted.Error() {
+			return
+		}
+		session.debug(fmt.Sprintf("%d => CRAWL %s %s, %d/%d, %d ms",
+			result.Code, result.Method, result.Path, requests, config.Requests, int64(result.Latency/time.Millisecond)))
+		session.send(result)
+	}
+}
@@ -0,0 +1,130 @@
+package korra
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCrawlConfig(t *testing.T) {
+	action := &SessionAction{Raw: "CRAWL GET http://foo/sitemap.xml\n[requests=500 weight=uniform]", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	if got := action.Target.Crawl.String(); got != "[Requests=500 Depth=2 Weight=uniform]" {
+		t.Fatalf("bad crawl config: %s", got)
+	}
+	for _, bad := range []string{"CRAWL POST http://foo/sitemap.xml", "CRAWL GET http://foo/sitemap.xml\n[requests=0]",
+		"CRAWL GET http://foo/sitemap.xml\n[depth=-1]", "CRAWL GET http://foo/sitemap.xml\n[weight=random]"} {
+		action = &SessionAction{Raw: bad, Line: 1}
+		if err := action.CreateTarget("."); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	robots := []byte(`# the robots
+User-agent: *
+Disallow: /private
+Allow: /private/open$
+
+User-agent: googlebot
+User-agent: korra
+Disallow: /
+Allow: /shop
+Disallow: /shop/*.pdf
+`)
+	rules := parseRobots(robots, "korra/1.0")
+	for path, want := range map[string]bool{"/": false, "/shop": true, "/shop/item/1": true, "/shop/list.pdf": false, "/about": false} {
+		if rules.allowed(path) != want {
+			t.Errorf("want %t for korra and %s", want, path)
+		}
+	}
+	rules = parseRobots(robots, "Mozilla/5.0")
+	for path, want := range map[string]bool{"/": true, "/private/x": false, "/private/open": true, "/private/open/x": false} {
+		if rules.allowed(path) != want {
+			t.Errorf("want %t for anyone and %s", want, path)
+		}
+	}
+	if rules := parseRobots([]byte("User-agent: other\nDisallow: /\n"), "korra"); !rules.allowed("/") {
+		t.Error("want everything allowed with no group for the agent")
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /admin\n")
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0"?><sitemapindex><sitemap><loc>%s/pages.xml.gz</loc></sitemap></sitemapindex>`, server.URL)
+		case "/pages.xml.gz":
+			var zipped bytes.Buffer
+			gz := gzip.NewWriter(&zipped)
+			fmt.Fprintf(gz, `<urlset><url><loc>%[1]s/home</loc><priority>1.0</priority></url>
+<url><loc>%[1]s/never</loc><priority>0.0</priority></url>
+<url><loc>%[1]s/admin/users</loc></url></urlset>`, server.URL)
+			gz.Close()
+			w.Write(zipped.Bytes())
+		case "/home":
+			fmt.Fprint(w, "home")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	action := &SessionAction{Raw: "CRAWL GET " + server.URL + "/sitemap.xml\n[requests=20]", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	sitemaps := NewSitemaps()
+	var results Results
+	for i := 0; i < 2; i++ {
+		session := &Session{Sitemaps: sitemaps, attacker: NewAttacker(), aborted: make(chan struct{}), results: make(chan *Result, 30)}
+		session.doCrawl(action)
+		close(session.results)
+		for result := range session.results {
+			results = append(results, result)
+		}
+	}
+
+	sort.Strings(requests)
+	if len(requests) != 43 || strings.Join(requests[40:], " ") != "/pages.xml.gz /robots.txt /sitemap.xml" {
+		t.Fatalf("want the sitemaps and robots.txt read once, then 40 crawls, got: %v", requests)
+	}
+	if len(results) != 40 {
+		t.Fatalf("want a result for each crawl, got %d", len(results))
+	}
+	for i, r := range results {
+		if r.Path != "/home" || r.RequestCount != i%20+1 {
+			t.Fatalf("want only the page with priority crawled, got: %+v", r)
+		}
+	}
+
+	// with no sitemap, the step fails
+	action = &SessionAction{Raw: "CRAWL GET " + server.URL + "/missing.xml", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{attacker: NewAttacker(), aborted: make(chan struct{}), results: make(chan *Result, 30)}
+	session.doCrawl(action)
+	if first := <-session.results; !strings.Contains(first.Error, "status 404") || len(session.results) != 0 {
+		t.Fatalf("want the failed sitemap as the only result, got: %+v", first)
+	}
+}
@@ -0,0 +1,314 @@
+package korra
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sqlDrivers are the database/sql drivers SQL steps use, by the scheme of
+// their URL. The korra command links them in only when built with the tag
+// of the same name, so it doesn't carry drivers nobody asked for.
+var sqlDrivers = map[string]string{
+	"postgres":   "postgres",
+	"postgresql": "postgres",
+	"mysql":      "mysql",
+}
+
+// sqlQueries are the statements that return rows, by their first word;
+// every other statement is executed for the rows it affects
+var sqlQueries = map[string]bool{"SELECT": true, "WITH": true, "SHOW": true, "EXPLAIN": true, "VALUES": true, "TABLE": true}
+
+// SQLConfig defines what a SQL step runs: the Statement, with its
+// placeholders filled from Args, Requests times. Its results are named for
+// the step by Name.
+type SQLConfig struct {
+	Statement string
+	Args      []string
+	Requests  int    // times to run the statement
+	Name      string // the last piece of the results' path
+}
+
+func NewSQLConfig() *SQLConfig {
+	return &SQLConfig{Requests: 1}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value]
+//
+// and fills itself from the parameters, as:
+//
+//   - requests: The number of times to run the statement (default: 1)
+//   - name: What to call the statement in the results, letters, digits
+//     and _ (default: line and the step's line number)
+func (config *SQLConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for SQL param, got: %s", piece)
+		}
+		value := strings.TrimSpace(param[1])
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "requests":
+			num, err := strconv.Atoi(value)
+			if err != nil || num <= 0 {
+				return fmt.Errorf("Expected positive int for SQL param, got: %s", piece)
+			}
+			config.Requests = num
+		case "name":
+			if !feedName.MatchString(value) {
+				return fmt.Errorf("Expected a name of letters, digits and _ for SQL param, got: %s", piece)
+			}
+			config.Name = value
+		default:
+			return fmt.Errorf("Unknown SQL param: %s", param[0])
+		}
+	}
+	return nil
+}
+
+// FillArgs takes a line formatted:
+//
+//	(value, value, ...)
+//
+// and sets the statement's args from the values, in order, trimmed of
+// spaces and of any single quotes around them. NULL is a null.
+func (config *SQLConfig) FillArgs(line string) error {
+	if config.Args != nil {
+		return fmt.Errorf("Expected one line of args, got another")
+	}
+	config.Args = []string{}
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	for _, arg := range strings.Split(line, ",") {
+		arg = strings.TrimSpace(arg)
+		if len(arg) >= 2 && strings.HasPrefix(arg, "'") && strings.HasSuffix(arg, "'") {
+			arg = arg[1 : len(arg)-1]
+		} else if arg == "" {
+			return fmt.Errorf("Expected a value for every arg, got: (%s)", line)
+		}
+		config.Args = append(config.Args, arg)
+	}
+	return nil
+}
+
+func (config *SQLConfig) String() string {
+	return fmt.Sprintf("[Requests=%d Name=%s Args=%d]", config.Requests, config.Name, len(config.Args))
+}
+
+// Verb returns the first word of the statement, upper-cased, which its
+// results have as their method
+func (config *SQLConfig) Verb() string {
+	if fields := strings.Fields(config.Statement); len(fields) > 0 {
+		return strings.ToUpper(fields[0])
+	}
+	return ""
+}
+
+// args returns the args to pass the driver, with NULL as nil
+func (config *SQLConfig) args() []interface{} {
+	args := make([]interface{}, len(config.Args))
+	for i, arg := range config.Args {
+		if arg != "NULL" {
+			args[i] = arg
+		}
+	}
+	return args
+}
+
+// sqlSource returns the driver and data source name for the URL of a SQL
+// step: a Postgres URL as it is, and a MySQL one rewritten as the MySQL
+// driver expects, user:password@tcp(host:port)/database?params.
+func sqlSource(raw string) (string, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", err
+	}
+	driver, ok := sqlDrivers[u.Scheme]
+	if !ok {
+		return "", "", fmt.Errorf("Expected a postgres:// or mysql:// URL, got: %s", raw)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("Expected a host, got: %s", raw)
+	}
+	if driver != "mysql" {
+		return driver, raw, nil
+	}
+	dsn := fmt.Sprintf("tcp(%s)%s", u.Host, u.EscapedPath())
+	if u.User != nil {
+		dsn = u.User.String() + "@" + dsn
+	}
+	if u.RawQuery != "" {
+		dsn += "?" + u.RawQuery
+	}
+	return driver, dsn, nil
+}
+
+// openSQL opens a pool of connections for the driver and source, failing if
+// the korra command was built without the driver
+func openSQL(driver, dsn string) (*sql.DB, error) {
+	for _, registered := range sql.Drivers() {
+		if registered == driver {
+			db, err := sql.Open(driver, dsn)
+			if err != nil {
+				return nil, err
+			}
+			// keep every connection the sessions open, not the default 2
+			db.SetMaxIdleConns(1 << 16)
+			return db, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s driver: build korra with -tags %s", driver, driver)
+}
+
+// Databases are the connection pools every session of an attack shares,
+// one per database, opened by the first session to use it
+type Databases struct {
+	sync.Mutex
+	pools map[string]*sql.DB
+}
+
+func NewDatabases() *Databases {
+	return &Databases{pools: map[string]*sql.DB{}}
+}
+
+// open returns the pool for the driver and source, and the function to call
+// when done with it; without Databases the pool is the caller's own, which
+// that function closes.
+func (d *Databases) open(driver, dsn string) (*sql.DB, func(), error) {
+	if d == nil {
+		db, err := openSQL(driver, dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, func() { db.Close() }, nil
+	}
+	d.Lock()
+	defer d.Unlock()
+	key := driver + " " + dsn
+	if db := d.pools[key]; db != nil {
+		return db, func() {}, nil
+	}
+	db, err := openSQL(driver, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.pools[key] = db
+	return db, func() {}, nil
+}
+
+// Close closes every pool
+func (d *Databases) Close() {
+	d.Lock()
+	defer d.Unlock()
+	for key, db := range d.pools {
+		db.Close()
+		delete(d.pools, key)
+	}
+}
+
+// hitSQL runs the target's statement once on the pool, reading every row it
+// returns. The result's code is 200 if it ran and 0 if it didn't, with the
+// driver's error.
+func (a *Attacker) hitSQL(db *sql.DB, tgt *Target, path string, tm time.Time, requestCount int) (*Result, int64) {
+	result := &Result{Timestamp: tm, RequestCount: requestCount, Method: tgt.SQL.Verb(), Path: path}
+	var (
+		err  error
+		rows int64
+	)
+	defer func() {
+		result.Latency = time.Since(tm)
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}()
+	if a.limiters != nil {
+		release, ok := a.limiters.acquire(tgt, a.abort)
+		if !ok {
+			err = ErrLimitAborted
+			return result, 0
+		}
+		defer release()
+		tm = time.Now()
+		result.Timestamp = tm
+	}
+	result.InFlight = int(atomic.AddInt64(&inFlight, 1))
+	defer atomic.AddInt64(&inFlight, -1)
+
+	ctx := context.Background()
+	if total := a.timeouts.Merge(tgt.Timeouts).Total; total > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, total)
+		defer cancel()
+	}
+	if sqlQueries[result.Method] {
+		var found *sql.Rows
+		if found, err = db.QueryContext(ctx, tgt.SQL.Statement, tgt.SQL.args()...); err == nil {
+			for found.Next() {
+				rows++
+			}
+			if err = found.Err(); err == nil {
+				err = found.Close()
+			}
+		}
+	} else {
+		var done sql.Result
+		if done, err = db.ExecContext(ctx, tgt.SQL.Statement, tgt.SQL.args()...); err == nil {
+			rows, _ = done.RowsAffected()
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = ErrTotalTimeout
+	}
+	if err == nil {
+		result.Code = 200
+	}
+	return result, rows
+}
+
+// doSQL runs the step's statement its number of times on the database's
+// pool, each a result of its own with its number as the request count.
+func (session *Session) doSQL(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	config := target.SQL
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => SQL %s %s %s", 200, target.URL, config.Verb(), config))
+		return
+	}
+	driver, dsn, err := sqlSource(target.URL)
+	path := "/" + driver + "/" + config.Name
+	var (
+		db   *sql.DB
+		done func()
+	)
+	if err == nil {
+		db, done, err = session.Databases.open(driver, dsn)
+	}
+	if err != nil {
+		session.send(&Result{Timestamp: time.Now(), Method: config.Verb(), Path: path, Error: err.Error()})
+		return
+	}
+	defer done()
+	for requests := 1; requests <= config.Requests && !session.isAborted(); requests++ {
+		session.Gate.wait(session.aborted)
+		result, rows := session.attacker.hitSQL(db, target, path, time.Now(), requests)
+		if result.Error == ErrLimitAborted.Error() {
+			return
+		}
+		session.debug(fmt.Sprintf("%d => SQL %s %s, %d rows, %d/%d, %d ms",
+			result.Code, result.Method, path, rows, requests, config.Requests, int64(result.Latency/time.Millisecond)))
+		session.send(result)
+	}
+}
@@ -0,0 +1,170 @@
+package korra
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDB is a database/sql driver answering every query with two rows and
+// every other statement with a row affected, and failing any statement on
+// the missing table; it keeps the statements it's sent, with their args.
+type fakeDB struct {
+	sync.Mutex
+	statements []string
+	opened     int
+}
+
+func (d *fakeDB) Open(name string) (driver.Conn, error) {
+	d.Lock()
+	d.opened++
+	d.Unlock()
+	return &fakeConn{d}, nil
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.db, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("no transactions") }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) record(args []driver.Value) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+	statement := s.query
+	for _, arg := range args {
+		if arg == nil {
+			statement += " NULL"
+		} else {
+			statement += " " + arg.(string)
+		}
+	}
+	s.db.statements = append(s.db.statements, statement)
+	if strings.Contains(s.query, "missing") {
+		return errors.New(`relation "missing" does not exist`)
+	}
+	return nil
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.record(args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.record(args); err != nil {
+		return nil, err
+	}
+	return &fakeRows{left: 2}, nil
+}
+
+type fakeRows struct{ left int }
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		return io.EOF
+	}
+	r.left--
+	dest[0] = int64(r.left)
+	return nil
+}
+
+var testDB = &fakeDB{}
+
+func init() {
+	sql.Register("korra-test", testDB)
+	sqlDrivers["test"] = "korra-test"
+}
+
+func TestSQLConfig(t *testing.T) {
+	action := &SessionAction{Raw: "SQL postgres://korra@db:5432/shop\nSELECT id FROM orders\n  WHERE user_id = $1 AND status = $2\n(${accounts.id}, 'shipped, late')\n[requests=5]", Line: 12}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	config := action.Target.SQL
+	if config.Statement != "SELECT id FROM orders WHERE user_id = $1 AND status = $2" || config.Verb() != "SELECT" {
+		t.Fatalf("want the statement joined from its lines, got: %s", config.Statement)
+	}
+	if got := config.String(); got != "[Requests=5 Name=line12 Args=3]" {
+		t.Fatalf("bad SQL config: %s", got)
+	}
+	for _, bad := range []string{"SQL postgres://db/shop", "SQL sqlite://db/shop\nSELECT 1", "SQL mysql://db/shop\nSELECT 1\n[name=a-b]",
+		"SQL mysql://db/shop\nSELECT 1\n(1)\n(2)", "SQL mysql://db/shop\nSELECT 1\n(1,,2)"} {
+		action = &SessionAction{Raw: bad, Line: 1}
+		if err := action.CreateTarget("."); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+	if driver, dsn, _ := sqlSource("mysql://korra:secret@db:3306/shop?parseTime=true"); driver != "mysql" || dsn != "korra:secret@tcp(db:3306)/shop?parseTime=true" {
+		t.Fatalf("want a MySQL DSN, got: %s %s", driver, dsn)
+	}
+}
+
+func TestSQL(t *testing.T) {
+	run := func(raw string, databases *Databases) Results {
+		action := &SessionAction{Raw: raw, Line: 1}
+		if err := action.CreateTarget("."); err != nil {
+			t.Fatal(err)
+		}
+		session := &Session{Databases: databases, attacker: NewAttacker(), aborted: make(chan struct{}), results: make(chan *Result, 10),
+			values: map[string]string{"accounts.id": "42"}}
+		session.doSQL(action)
+		close(session.results)
+		var results Results
+		for result := range session.results {
+			results = append(results, result)
+		}
+		return results
+	}
+
+	testDB.Lock()
+	testDB.statements, testDB.opened = nil, 0
+	testDB.Unlock()
+	databases := NewDatabases()
+	defer databases.Close()
+	results := run("SQL test://db/shop\nselect id from orders where user_id = $1 and note = $2\n(${accounts.id}, NULL)\n[requests=3 name=orders]", databases)
+	results = append(results, run("SQL test://db/shop\nUPDATE carts SET total = 0\n[requests=2]", databases)...)
+	if len(results) != 5 {
+		t.Fatalf("want a result each time a statement ran, got %d", len(results))
+	}
+	for i, r := range results {
+		method, path, count := "SELECT", "/korra-test/orders", i+1
+		if i >= 3 {
+			method, path, count = "UPDATE", "/korra-test/line1", i-2
+		}
+		if r.Method != method || r.Path != path || r.RequestCount != count || r.Code != 200 || r.Error != "" {
+			t.Fatalf("want %s %s #%d, got: %+v", method, path, count, r)
+		}
+	}
+	testDB.Lock()
+	statement, opened := testDB.statements[0], testDB.opened
+	testDB.Unlock()
+	if statement != "select id from orders where user_id = $1 and note = $2 42 NULL" || opened != 1 {
+		t.Fatalf("want the args filled in on one shared connection, got: %s, %d opened", statement, opened)
+	}
+
+	results = run("SQL test://db/shop\nDELETE FROM missing\n[requests=2]", nil)
+	if len(results) != 2 || results[0].Code != 0 || results[0].Error != `relation "missing" does not exist` {
+		t.Fatalf("want the driver's error, got: %+v", results)
+	}
+	if results = run("SQL postgres://db:5432/shop\nSELECT 1\n[requests=2]", nil); len(results) != 1 || results[0].Error != "no postgres driver: build korra with -tags postgres" {
+		t.Fatalf("want a single result for the missing driver, got: %+v", results)
+	}
+}
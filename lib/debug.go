@@ -0,0 +1,151 @@
+package korra
+
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
+// Debugger steps through a session's script for korra debug: it runs a
+// step at a time when asked, keeping the request and response of each
+// result, and runs a step again, or an edited one in its place, so a script
+// can be worked out against the real server without rerunning it from the
+// top. Every CHANCE block is taken; skip a step to leave it out.
+type Debugger struct {
+	Session *Session
+	last    *SessionAction // the step run last, to retry or edit
+}
+
+// StepRun is what running a step did
+type StepRun struct {
+	Action  *SessionAction
+	Results []*Result
+	Dumps   []string                     // the request and response of each result, if it was HTTP
+	Saved   map[string]map[string]string // values the step saved, by store (or vars) then column
+	Took    time.Duration
+}
+
+// NewDebugger reads the script into a session to step through, with
+// clients made with the options and the feeds, plus a store for each the
+// script saves into. Its log takes what the session logs as it goes.
+func NewDebugger(scriptPath string, opts []func(*Attacker), feeders Feeders, log chan string) (*Debugger, error) {
+	session, err := NewSession(scriptPath, append(append([]func(*Attacker){}, opts...), Dumps(true)), log, false)
+	if err != nil {
+		return nil, err
+	}
+	if feeders == nil {
+		feeders = Feeders{}
+	}
+	for _, store := range session.Script.Stores() {
+		if feeders[store] == nil {
+			feeders[store] = NewStore(store)
+		}
+	}
+	for _, feed := range session.Script.Feeds() {
+		if feeders[feed] == nil {
+			return nil, fmt.Errorf("script uses feed %s, but no -feed names it", feed)
+		}
+	}
+	session.Feeders = feeders
+	session.Vars = NewVars()
+	session.LogOnly = true
+	session.EveryChance = true
+	return &Debugger{Session: session}, nil
+}
+
+// Next returns the step to run next, or nil at the end of the script
+func (d *Debugger) Next() *SessionAction {
+	if !d.Session.Script.ActionsRemain() {
+		return nil
+	}
+	return d.Session.Script.Actions[d.Session.Script.Current]
+}
+
+// Last returns the step run last, or nil before any has run
+func (d *Debugger) Last() *SessionAction {
+	return d.last
+}
+
+// Step runs the next step, or returns nil at the end of the script
+func (d *Debugger) Step() *StepRun {
+	if d.Next() == nil {
+		return nil
+	}
+	d.last = d.Session.Script.NextAction()
+	return d.run(d.last)
+}
+
+// Skip moves past the next step without running it
+func (d *Debugger) Skip() {
+	if d.Next() != nil {
+		d.Session.Script.NextAction()
+	}
+}
+
+// Retry runs the step run last again, or returns nil before any has run
+func (d *Debugger) Retry() *StepRun {
+	if d.last == nil {
+		return nil
+	}
+	return d.run(d.last)
+}
+
+// Edit replaces the step run last with one read from the text, as it would
+// be written in the script, and runs it; the script's file is left as it
+// is. A step that doesn't parse is an error, and leaves the last in place.
+func (d *Debugger) Edit(raw string) (*StepRun, error) {
+	if d.last == nil {
+		return nil, fmt.Errorf("no step has run to edit")
+	}
+	edited := &SessionAction{Raw: raw, Line: d.last.Line, Hook: d.last.Hook, Chance: d.last.Chance}
+	if err := edited.CreateTarget(path.Dir(d.Session.Path)); err != nil {
+		return nil, err
+	}
+	for i, action := range d.Session.Script.Actions {
+		if action == d.last {
+			d.Session.Script.Actions[i] = edited
+		}
+	}
+	d.last = edited
+	return d.run(edited), nil
+}
+
+// Values returns the values steps can reference, by reference, like
+// vars.order or users.email, with secrets redacted
+func (d *Debugger) Values() map[string]string {
+	values := map[string]string{}
+	for ref, value := range d.Session.references() {
+		values[ref] = d.Session.Secrets.Redact(value)
+	}
+	return values
+}
+
+// run carries out the step, collecting its results as they're sent
+func (d *Debugger) run(action *SessionAction) *StepRun {
+	session := d.Session
+	results, collected := session.results, make(chan []*Result)
+	go func() {
+		var all []*Result
+		for result := range results {
+			all = append(all, result)
+		}
+		collected <- all
+	}()
+	began := time.Now()
+	session.step(action)
+	close(results)
+	run := &StepRun{Action: action, Results: <-collected, Took: time.Since(began), Saved: map[string]map[string]string{}}
+	session.results = make(chan *Result)
+	for _, result := range run.Results {
+		run.Dumps = append(run.Dumps, session.Secrets.Redact(result.dump))
+		for store, values := range result.saved {
+			if run.Saved[store] == nil {
+				run.Saved[store] = map[string]string{}
+			}
+			for column, value := range values {
+				run.Saved[store][column] = session.Secrets.Redact(value)
+			}
+		}
+	}
+	return run
+}
@@ -0,0 +1,77 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/orders":
+			w.Write([]byte(`{"id": "o-42"}`))
+		case "/orders/o-42":
+			w.Write([]byte(`{"status": "placed"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	script := filepath.Join(t.TempDir(), "shopper.txt")
+	os.WriteFile(script, []byte(`POST `+server.URL+`/orders
+> vars.order "id":\s*"([\w-]+)"
+
+GET `+server.URL+`/order/${vars.order}
+
+CHANCE 1
+GET `+server.URL+`/account
+END
+`), 0644)
+	debugger, err := NewDebugger(script, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := debugger.Step()
+	if len(run.Results) != 1 || run.Results[0].Error != "" || run.Saved["vars"]["order"] != "o-42" {
+		t.Fatalf("want the order placed and its id saved, got %+v", run)
+	}
+	if !strings.Contains(run.Dumps[0], "POST /orders HTTP/1.1") || !strings.Contains(run.Dumps[0], `{"id": "o-42"}`) {
+		t.Fatalf("want the request and response, got:\n%s", run.Dumps[0])
+	}
+	if got := debugger.Values()["vars.order"]; got != "o-42" {
+		t.Fatalf("want the var to reference, got %q", got)
+	}
+
+	if run = debugger.Step(); run.Results[0].Code != 404 || run.Results[0].Path != "/order/o-42" {
+		t.Fatalf("want the misspelled path to fail, got %+v", run.Results[0])
+	}
+	if run = debugger.Retry(); run.Results[0].Code != 404 {
+		t.Fatalf("want the same step run again, got %+v", run.Results[0])
+	}
+	line := debugger.Last().Line
+	if _, err = debugger.Edit("GET not a url"); err == nil {
+		t.Error("want an error for a step that doesn't parse")
+	}
+	if run, err = debugger.Edit("GET " + server.URL + "/orders/${vars.order}"); err != nil || run.Results[0].Code != 200 {
+		t.Fatalf("want the edited step to pass, got %+v %v", run, err)
+	}
+	if debugger.Last().Line != line || !strings.Contains(debugger.Session.Script.Actions[1].Raw, "/orders/") {
+		t.Fatalf("want the edit in the step's place, got %+v", debugger.Last())
+	}
+
+	if next := debugger.Next(); next == nil || next.Chance == nil {
+		t.Fatalf("want the CHANCE block's step next, however unlikely, got %+v", next)
+	}
+	debugger.Skip()
+	if debugger.Next() != nil || debugger.Step() != nil {
+		t.Error("want the end of the script")
+	}
+	if _, err = NewDebugger(script+".missing", nil, nil, nil); err == nil {
+		t.Error("want an error for a script that isn't there")
+	}
+}
@@ -0,0 +1,161 @@
+package korra
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// ResolverCache is recorded as the resolver when an answer came from the cache
+	ResolverCache = "cache"
+	// ResolverPinned is recorded as the resolver when a host was pinned to an address
+	ResolverPinned = "pinned"
+	// ResolverSystem is recorded as the resolver when the system answered
+	// without asking a nameserver, such as from a hosts file
+	ResolverSystem = "system"
+)
+
+// DNSOptions controls how an Attacker resolves the hosts it connects to.
+// The zero value resolves every new connection with the system's
+// nameservers and caches nothing.
+type DNSOptions struct {
+	TTL    time.Duration     // how long to cache answers; 0 disables the cache
+	Server string            // host:port of the nameserver to query instead of the system's
+	Pins   map[string]string // hosts that always resolve to the given address
+}
+
+type dnsAnswer struct {
+	addrs   []string
+	from    string
+	expires time.Time
+}
+
+// dnsTrace travels in a request's context so the lookup made when dialing
+// for that request can be recorded in its Result.
+type dnsTrace struct {
+	sync.Mutex
+	latency time.Duration
+	from    string
+}
+
+type dnsTraceKey struct{}
+
+type dnsServerKey struct{}
+
+// dnsServer records the nameserver a lookup asked; the A and AAAA queries
+// may be made concurrently
+type dnsServer struct {
+	sync.Mutex
+	address string
+}
+
+// resolver looks up hosts for an Attacker, honoring its DNSOptions and
+// recording the time and source of each answer.
+type resolver struct {
+	sync.Mutex
+	cache   map[string]dnsAnswer
+	opts    DNSOptions
+	network *net.Resolver
+}
+
+func newResolver(opts DNSOptions) *resolver {
+	r := &resolver{cache: map[string]dnsAnswer{}, opts: opts}
+	dialer := &net.Dialer{}
+	r.network = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if r.opts.Server != "" {
+				address = r.opts.Server
+			}
+			if server, ok := ctx.Value(dnsServerKey{}).(*dnsServer); ok {
+				server.Lock()
+				server.address = address
+				server.Unlock()
+			}
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+	return r
+}
+
+// lookup returns the addresses for host, where they came from, and how long
+// it took to get them.
+func (r *resolver) lookup(ctx context.Context, host string) ([]string, string, time.Duration, error) {
+	began := time.Now()
+	if addr, ok := r.opts.Pins[host]; ok {
+		return []string{addr}, ResolverPinned, time.Since(began), nil
+	}
+	if r.opts.TTL > 0 {
+		r.Lock()
+		answer, ok := r.cache[host]
+		r.Unlock()
+		if ok && began.Before(answer.expires) {
+			return answer.addrs, ResolverCache, time.Since(began), nil
+		}
+	}
+	asked := &dnsServer{address: ResolverSystem}
+	addrs, err := r.network.LookupHost(context.WithValue(ctx, dnsServerKey{}, asked), host)
+	latency := time.Since(began)
+	asked.Lock()
+	server := asked.address
+	asked.Unlock()
+	if err != nil {
+		return nil, server, latency, err
+	}
+	if r.opts.TTL > 0 {
+		r.Lock()
+		r.cache[host] = dnsAnswer{addrs, server, began.Add(r.opts.TTL)}
+		r.Unlock()
+	}
+	return addrs, server, latency, nil
+}
+
+// dial resolves the host in address and connects to the first of its
+// addresses that will accept a connection.
+func (r *resolver) dial(ctx context.Context, dialer *net.Dialer, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+	addrs, from, latency, err := r.lookup(ctx, host)
+	if trace, ok := ctx.Value(dnsTraceKey{}).(*dnsTrace); ok {
+		trace.Lock()
+		trace.latency, trace.from = latency, from
+		trace.Unlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	for _, addr := range addrs {
+		if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr, port)); err == nil {
+			return conn, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("no addresses found for %s", host)
+	}
+	return nil, err
+}
+
+// PinHosts resolves every host in pins that doesn't yet have an address with
+// the system resolver, so all sessions use the same answer for the entire run.
+func PinHosts(pins map[string]string) error {
+	for host, addr := range pins {
+		if addr != "" {
+			continue
+		}
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			return fmt.Errorf("cannot pin %s: %s", host, err)
+		}
+		pins[host] = addrs[0]
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package korra
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolverCache(t *testing.T) {
+	r := newResolver(DNSOptions{TTL: time.Minute})
+	if _, from, _, err := r.lookup(context.Background(), "localhost"); err != nil {
+		t.Fatal(err)
+	} else if from == ResolverCache {
+		t.Fatalf("first lookup should not be from cache")
+	}
+	if _, from, _, err := r.lookup(context.Background(), "localhost"); err != nil {
+		t.Fatal(err)
+	} else if from != ResolverCache {
+		t.Fatalf("got: %s, want: %s", from, ResolverCache)
+	}
+}
+
+func TestDNSPinnedResult(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	tgt := NewTarget()
+	tgt.Method, tgt.URL = "GET", "http://korra.test:"+port+"/"
+	atk := NewAttacker(DNS(DNSOptions{Pins: map[string]string{"korra.test": "127.0.0.1"}}))
+	res := atk.Hit(func() (*Target, error) { return tgt, nil }, time.Now(), 1)
+	if res.Error != "" {
+		t.Fatal(res.Error)
+	}
+	if got, want := res.DNSResolver, ResolverPinned; got != want {
+		t.Fatalf("got: %v, want: %v", got, want)
+	}
+}
@@ -0,0 +1,465 @@
+package korra
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// the transports a DNS step queries over, by the scheme of its URL
+const (
+	dnsUDP   = "udp"
+	dnsTCP   = "tcp"
+	dnsHTTPS = "https" // DNS over HTTPS, RFC 8484
+)
+
+// dnsTypes are the record types a DNS step may query for, by name
+var dnsTypes = map[string]uint16{
+	"A": 1, "NS": 2, "CNAME": 5, "SOA": 6, "PTR": 12, "MX": 15, "TXT": 16,
+	"AAAA": 28, "SRV": 33, "NAPTR": 35, "DS": 43, "DNSKEY": 48, "HTTPS": 65, "ANY": 255, "CAA": 257,
+}
+
+// dnsRcodes are the names of the response codes, and the status codes their
+// results have so the reports count them as they do HTTP's; any other
+// response code is a 500.
+var dnsRcodes = map[byte]struct {
+	name string
+	code uint16
+}{
+	0: {"NOERROR", 200},
+	1: {"FORMERR", 400},
+	2: {"SERVFAIL", 503},
+	3: {"NXDOMAIN", 404},
+	4: {"NOTIMP", 501},
+	5: {"REFUSED", 403},
+}
+
+// DNSQuery is one of the queries a DNS step picks from: a name and record
+// type, picked Weight times as often as a query of weight 1
+type DNSQuery struct {
+	Name   string
+	Type   string
+	Weight int
+}
+
+func (q DNSQuery) String() string {
+	s := q.Name + "/" + q.Type
+	if q.Weight != 1 {
+		s += "*" + strconv.Itoa(q.Weight)
+	}
+	return s
+}
+
+// DNSConfig defines the queries a DNS step sends a nameserver: Requests of
+// them, each picked from Queries by their weights.
+type DNSConfig struct {
+	Requests int        // queries to send
+	Queries  []DNSQuery // the mix to pick them from
+	Recurse  bool       // ask the server to recurse, as a client of a resolver does
+}
+
+func NewDNSConfig() *DNSConfig {
+	return &DNSConfig{Requests: 1000, Recurse: true}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value ...]
+//
+// and fills itself from the parameters, as:
+//
+//   - requests: The number of queries to send (default: 1000)
+//   - queries: The queries to pick from, separated by commas, each a name
+//     with, optionally, /type, and *weight to pick it more or less often
+//     than others (required; type default: A, weight default: 1)
+//   - recurse: Whether to ask for recursion (default: true)
+func (config *DNSConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for DNS param, got: %s", piece)
+		}
+		value := strings.TrimSpace(param[1])
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "requests":
+			num, err := strconv.Atoi(value)
+			if err != nil || num <= 0 {
+				return fmt.Errorf("Expected positive int for DNS param, got: %s", piece)
+			}
+			config.Requests = num
+		case "queries":
+			config.Queries = nil
+			for _, raw := range strings.Split(value, ",") {
+				query, err := parseDNSQuery(raw)
+				if err != nil {
+					return err
+				}
+				config.Queries = append(config.Queries, query)
+			}
+		case "recurse":
+			recurse, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("Expected true or false for DNS param, got: %s", piece)
+			}
+			config.Recurse = recurse
+		default:
+			return fmt.Errorf("Unknown DNS param: %s", param[0])
+		}
+	}
+	return nil
+}
+
+// parseDNSQuery parses a query of a DNS step's mix: name[/type][*weight]
+func parseDNSQuery(raw string) (DNSQuery, error) {
+	query := DNSQuery{Type: "A", Weight: 1}
+	if star := strings.LastIndex(raw, "*"); star >= 0 {
+		weight, err := strconv.Atoi(raw[star+1:])
+		if err != nil || weight <= 0 {
+			return query, fmt.Errorf("Expected a positive int weight for DNS query, got: %s", raw)
+		}
+		query.Weight, raw = weight, raw[:star]
+	}
+	if slash := strings.LastIndex(raw, "/"); slash >= 0 {
+		query.Type, raw = strings.ToUpper(raw[slash+1:]), raw[:slash]
+		if _, ok := dnsTypes[query.Type]; !ok {
+			return query, fmt.Errorf("Unknown DNS record type: %s", query.Type)
+		}
+	}
+	if query.Name = strings.TrimSuffix(raw, "."); query.Name == "" {
+		return query, fmt.Errorf("Expected a name for DNS query, got: %s", raw)
+	}
+	for _, label := range strings.Split(query.Name, ".") {
+		if label == "" || len(label) > 63 {
+			return query, fmt.Errorf("Expected a name of labels of 1 to 63 characters for DNS query, got: %s", query.Name)
+		}
+	}
+	return query, nil
+}
+
+// check returns an error if the config has no queries to send
+func (config *DNSConfig) check() error {
+	if len(config.Queries) == 0 {
+		return fmt.Errorf("Expected Queries to send")
+	}
+	return nil
+}
+
+func (config *DNSConfig) String() string {
+	queries := make([]string, len(config.Queries))
+	for i, query := range config.Queries {
+		queries[i] = query.String()
+	}
+	return fmt.Sprintf("[Requests=%d Queries=%s Recurse=%t]", config.Requests, strings.Join(queries, ","), config.Recurse)
+}
+
+// parseDNSURL checks the URL of a DNS step: udp://host:port, tcp://host:port
+// or the https:// URL of a DNS over HTTPS endpoint
+func parseDNSURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case dnsUDP, dnsTCP:
+		if u.Port() == "" || strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("Expected a host and port, with no path, got: %s", raw)
+		}
+	case dnsHTTPS:
+		if u.Host == "" {
+			return nil, fmt.Errorf("Expected a host, got: %s", raw)
+		}
+	default:
+		return nil, fmt.Errorf("Expected a %s://, %s:// or %s:// URL, got: %s", dnsUDP, dnsTCP, dnsHTTPS, raw)
+	}
+	return u, nil
+}
+
+// dnsMessage returns a query for the name and type, with the ID
+func dnsMessage(query DNSQuery, id uint16, recurse bool) []byte {
+	var msg bytes.Buffer
+	flags := uint16(0)
+	if recurse {
+		flags |= 0x0100
+	}
+	binary.Write(&msg, binary.BigEndian, []uint16{id, flags, 1, 0, 0, 0})
+	for _, label := range strings.Split(query.Name, ".") {
+		msg.WriteByte(byte(len(label)))
+		msg.WriteString(label)
+	}
+	msg.WriteByte(0)
+	binary.Write(&msg, binary.BigEndian, []uint16{dnsTypes[query.Type], 1})
+	return msg.Bytes()
+}
+
+// dnsReply is what a DNS step reads from a response: whether it was
+// truncated, and its response code
+type dnsReply struct {
+	truncated bool
+	rcode     byte
+}
+
+func parseDNSReply(msg []byte) (dnsReply, error) {
+	if len(msg) < 12 {
+		return dnsReply{}, errors.New("DNS response too short")
+	}
+	if msg[2]&0x80 == 0 {
+		return dnsReply{}, errors.New("DNS message isn't a response")
+	}
+	return dnsReply{truncated: msg[2]&0x02 != 0, rcode: msg[3] & 0x0f}, nil
+}
+
+// dnsClient sends queries over one of the transports, returning the
+// response to the query with the query's ID
+type dnsClient interface {
+	exchange(msg []byte, deadline time.Time) ([]byte, error)
+	Close() error
+}
+
+// dnsConnClient queries over a UDP socket or a TCP connection, a TCP
+// message prefixed with its length
+type dnsConnClient struct {
+	net.Conn
+	tcp bool
+}
+
+func (c *dnsConnClient) exchange(msg []byte, deadline time.Time) ([]byte, error) {
+	c.SetDeadline(deadline)
+	out := msg
+	if c.tcp {
+		out = append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...)
+	}
+	if _, err := c.Write(out); err != nil {
+		return nil, err
+	}
+	for {
+		var reply []byte
+		if c.tcp {
+			var size [2]byte
+			if _, err := io.ReadFull(c, size[:]); err != nil {
+				return nil, err
+			}
+			reply = make([]byte, binary.BigEndian.Uint16(size[:]))
+			if _, err := io.ReadFull(c, reply); err != nil {
+				return nil, err
+			}
+		} else {
+			buf := make([]byte, 65535)
+			n, err := c.Read(buf)
+			if err != nil {
+				return nil, err
+			}
+			reply = buf[:n]
+		}
+		// a late answer to an earlier query that timed out isn't this one's
+		if len(reply) >= 2 && bytes.Equal(reply[:2], msg[:2]) {
+			return reply, nil
+		}
+	}
+}
+
+// dnsHTTPClient queries a DNS over HTTPS endpoint with the attacker's client
+type dnsHTTPClient struct {
+	client *http.Client
+	url    string
+}
+
+// dnsHTTPError is a response from a DNS over HTTPS endpoint that isn't a 200
+type dnsHTTPError int
+
+func (e dnsHTTPError) Error() string {
+	return fmt.Sprintf("DNS over HTTPS endpoint answered %d %s", int(e), http.StatusText(int(e)))
+}
+
+func (c *dnsHTTPClient) exchange(msg []byte, deadline time.Time) ([]byte, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, res.Body)
+		return nil, dnsHTTPError(res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 65535))
+}
+
+func (c *dnsHTTPClient) Close() error {
+	return nil
+}
+
+// dialDNS returns a client for the transport of the URL, connecting with the
+// attacker's dialer for UDP and TCP
+func (a *Attacker) dialDNS(u *url.URL, network string, timeouts Timeouts) (dnsClient, error) {
+	if network == dnsHTTPS {
+		return &dnsHTTPClient{client: &a.client, url: u.String()}, nil
+	}
+	connect := timeouts.Connect
+	if connect == 0 {
+		connect = DefaultTimeout
+	}
+	dialer := a.dialer
+	if local, ok := dialer.LocalAddr.(*net.TCPAddr); ok && network == dnsUDP {
+		// the local address is for TCP, which UDP won't dial from
+		udp := *dialer
+		udp.LocalAddr = &net.UDPAddr{IP: local.IP, Zone: local.Zone}
+		dialer = &udp
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connect)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, network, u.Host)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = ErrConnectTimeout
+		}
+		return nil, err
+	}
+	return &dnsConnClient{Conn: conn, tcp: network == dnsTCP}, nil
+}
+
+// hitDNS sends the query, connecting first if client is nil, and retries a
+// truncated UDP answer over TCP. The result's method is the record type, its
+// path the transport and name, and its code the status code for the response code (see
+// dnsRcodes), which it records too. A client that fails is closed, and
+// returned nil for the next query to make a new one.
+func (a *Attacker) hitDNS(client dnsClient, tgt *Target, u *url.URL, query DNSQuery, id uint16, tm time.Time, requestCount int) (dnsClient, *Result) {
+	result := &Result{Timestamp: tm, RequestCount: requestCount, Method: query.Type, Path: "/" + u.Scheme + "/" + query.Name}
+	var err error
+	defer func() {
+		result.Latency = time.Since(tm)
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}()
+	if a.limiters != nil {
+		release, ok := a.limiters.acquire(tgt, a.abort)
+		if !ok {
+			err = ErrLimitAborted
+			return client, result
+		}
+		defer release()
+		tm = time.Now()
+		result.Timestamp = tm
+	}
+	result.InFlight = int(atomic.AddInt64(&inFlight, 1))
+	defer atomic.AddInt64(&inFlight, -1)
+
+	timeouts := a.timeouts.Merge(tgt.Timeouts)
+	if client == nil {
+		if client, err = a.dialDNS(u, u.Scheme, timeouts); err != nil {
+			return nil, result
+		}
+	}
+	total := timeouts.Total
+	if total == 0 {
+		total = DefaultTimeout
+	}
+	if u.Scheme == dnsHTTPS {
+		// the ID is 0 over HTTPS, so the responses can be cached
+		id = 0
+	}
+	msg := dnsMessage(query, id, tgt.DNS.Recurse)
+	result.BytesOut = uint64(len(msg))
+	var raw []byte
+	var reply dnsReply
+	if raw, err = client.exchange(msg, tm.Add(total)); err == nil {
+		result.BytesIn = uint64(len(raw))
+		if reply, err = parseDNSReply(raw); err == nil && reply.truncated && u.Scheme == dnsUDP {
+			var tcp dnsClient
+			if tcp, err = a.dialDNS(u, dnsTCP, timeouts); err == nil {
+				result.BytesOut += uint64(len(msg))
+				if raw, err = tcp.exchange(msg, tm.Add(total)); err == nil {
+					result.BytesIn += uint64(len(raw))
+					reply, err = parseDNSReply(raw)
+				}
+				tcp.Close()
+			}
+		}
+	}
+	var httpErr dnsHTTPError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &httpErr):
+		result.Code = uint16(httpErr)
+	case err != nil:
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			err = ErrTotalTimeout
+		}
+		client.Close()
+		return nil, result
+	default:
+		rcode, ok := dnsRcodes[reply.rcode]
+		if !ok {
+			rcode.name, rcode.code = "RCODE"+strconv.Itoa(int(reply.rcode)), 500
+		}
+		result.Rcode, result.Code = rcode.name, rcode.code
+	}
+	return client, result
+}
+
+// doDNS sends the step's queries to its nameserver over a socket or
+// connection of its own, each a result of its own with its number as the
+// request count.
+func (session *Session) doDNS(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	config := target.DNS
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => DNS %s %s", 200, target.URL, config))
+		return
+	}
+	u, err := parseDNSURL(target.URL)
+	if err != nil {
+		result := &Result{Timestamp: time.Now(), Error: err.Error()}
+		result.PathFromURL(target.URL)
+		session.send(result)
+		return
+	}
+	rng := rand.New(rand.NewSource(session.attacker.random.Int63n(1 << 62)))
+	weights := make([]int, len(config.Queries))
+	total := 0
+	for i, query := range config.Queries {
+		total += query.Weight
+		weights[i] = total
+	}
+
+	var client dnsClient
+	defer func() {
+		if client != nil {
+			client.Close()
+		}
+	}()
+	for requests := 1; requests <= config.Requests && !session.isAborted(); requests++ {
+		session.Gate.wait(session.aborted)
+		query := config.Queries[sort.SearchInts(weights, rng.Intn(total)+1)]
+		var result *Result
+		client, result = session.attacker.hitDNS(client, target, u, query, uint16(rng.Intn(1<<16)), time.Now(), requests)
+		if result.Error == ErrLimitAborted.Error() {
+			return
+		}
+		session.debug(fmt.Sprintf("%d => DNS %s %s %s, %d/%d, %d ms",
+			result.Code, query.Type, query.Name, result.Rcode, requests, config.Requests, int64(result.Latency/time.Millisecond)))
+		session.send(result)
+	}
+}
@@ -0,0 +1,125 @@
+package korra
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDNSConfig(t *testing.T) {
+	action := &SessionAction{Raw: "DNS udp://10.0.0.2:53\n[requests=10 queries=example.com/aaaa*3,nope.example.com. recurse=false]\n<Rate=10>", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	target := action.Target
+	if got := target.DNS.String(); got != "[Requests=10 Queries=example.com/AAAA*3,nope.example.com/A Recurse=false]" {
+		t.Fatalf("bad DNS config: %s", got)
+	}
+	if !target.Limit.Active() || target.String() != "DNS udp://10.0.0.2:53" {
+		t.Fatalf("want a DNS step with limits, got: %s", target)
+	}
+	for _, bad := range []string{"DNS udp://10.0.0.2:53", "DNS udp://10.0.0.2\n[queries=a]", "DNS dns://10.0.0.2:53\n[queries=a]",
+		"DNS tcp://10.0.0.2:53/a\n[queries=a]", "DNS udp://10.0.0.2:53\n[queries=a/BOGUS]", "DNS udp://10.0.0.2:53\n[queries=a*0]",
+		"DNS udp://10.0.0.2:53\n[queries=a..b]", "DNS udp://10.0.0.2:53\n[queries=a requests=0]", "DNS udp://10.0.0.2:53\n[queries=a]\nHost: b"} {
+		action = &SessionAction{Raw: bad, Line: 1}
+		if err := action.CreateTarget("."); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+// answerDNS answers a query with NXDOMAIN for names starting with nope,
+// SERVFAIL for ones starting with broken, and NOERROR for the rest.
+func answerDNS(query []byte) []byte {
+	var name []string
+	for i := 12; i < len(query) && query[i] != 0; i += int(query[i]) + 1 {
+		name = append(name, string(query[i+1:i+1+int(query[i])]))
+	}
+	reply := append([]byte{}, query...)
+	reply[2] |= 0x80
+	switch {
+	case strings.HasPrefix(name[0], "nope"):
+		reply[3] |= 3
+	case strings.HasPrefix(name[0], "broken"):
+		reply[3] |= 2
+	}
+	return reply
+}
+
+// rcodes returns how many of the results had each response code
+func rcodes(results Results) map[string]int {
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[fmt.Sprintf("%s %d", r.Rcode, r.Code)]++
+	}
+	return counts
+}
+
+func TestDNSUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(answerDNS(buf[:n]), addr)
+		}
+	}()
+
+	results := runAction(t, fmt.Sprintf("DNS udp://%s\n[requests=100 queries=example.com/AAAA,nope.example.com,broken.example.com]", conn.LocalAddr()), 100, (*Session).doDNS, nil)
+	counts := rcodes(results)
+	if len(results) != 100 || counts["NOERROR 200"] == 0 || counts["NXDOMAIN 404"] == 0 || counts["SERVFAIL 503"] == 0 || len(counts) != 3 {
+		t.Fatalf("want each response code, got: %v", counts)
+	}
+	for i, r := range results {
+		if r.Error != "" || r.RequestCount != i+1 || r.BytesIn != r.BytesOut || !strings.HasPrefix(r.Path, "/udp/") {
+			t.Fatalf("bad DNS result: %+v", r)
+		}
+		if (r.Method == "AAAA") != (r.Path == "/udp/example.com") {
+			t.Fatalf("want the query's type as the method, got: %+v", r)
+		}
+	}
+}
+
+func TestDNSHTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "application/dns-message" || !bytes.Equal(query[:2], []byte{0, 0}) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path != "/dns-query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(answerDNS(query))
+	}))
+	defer server.Close()
+
+	results := runAction(t, fmt.Sprintf("DNS %s/dns-query\n[requests=2 queries=nope.example.com]", server.URL), 2, (*Session).doDNS, nil)
+	for _, r := range results {
+		if r.Rcode != "NXDOMAIN" || r.Code != 404 || r.Error != "" || r.Path != "/https/nope.example.com" {
+			t.Fatalf("want the query answered NXDOMAIN, got: %+v", r)
+		}
+	}
+	if len(results) != 2 {
+		t.Fatalf("want 2 results, got: %d", len(results))
+	}
+
+	results = runAction(t, fmt.Sprintf("DNS %s/elsewhere\n[requests=1 queries=example.com]", server.URL), 1, (*Session).doDNS, nil)
+	if r := results[0]; r.Rcode != "" || r.Code != 404 || r.Error != "DNS over HTTPS endpoint answered 404 Not Found" {
+		t.Fatalf("want the endpoint's status code, got: %+v", r)
+	}
+}
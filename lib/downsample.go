@@ -0,0 +1,207 @@
+package korra
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Downsampler reduces results to a few per window of time for each kind of
+// result, so a long run's result file can be kept for years at a fraction of
+// its size. Results of a kind are those alike in everything reports group or
+// count them by: the method, path, target, status code, error, DNS resolver,
+// response headers recorded, the anomaly it was fuzzed with, whether it was
+// conditional, whether it made a TLS handshake and resumed a session with
+// it, and whether it was the first event of a stream, a later one or no
+// event at all. Each window keeps the slowest result of a kind as it was and
+// stands the rest in for with Samples-1 results, each the mean of a run of
+// them in order of latency, weighted by how many there were (see
+// Result.Weight). Counts, totals and means report the same as they did
+// from the raw results, give or take rounding the sizes, and percentiles
+// land within a run of the latencies.
+type Downsampler struct {
+	Window  time.Duration // the width of a window, from the zero time
+	Samples int           // the most results kept for each kind in a window; at least 2
+
+	write  func(*Result) error
+	open   map[int64]map[sampleKind]Results
+	latest int64
+}
+
+// sampleKind is what results must have in common to be downsampled together
+type sampleKind struct {
+	method, path, target, err, resolver string
+	headers                             string // the recorded headers and their values, in order
+	fuzz, abandoned                     string
+	code                                uint16
+	conditional, handshake, resumed     bool
+	held, corrupt, download             bool
+	segment, playback, page             bool
+	delivered, lost                     bool
+	asset                               string // the path of the page it's for
+	rcode                               string
+	event                               int // 0 for no event, 1 for the first, 2 for later ones
+}
+
+// NewDownsampler returns a Downsampler writing what it keeps with write
+func NewDownsampler(window time.Duration, samples int, write func(*Result) error) (*Downsampler, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("downsampling needs a window above zero, got %s", window)
+	}
+	if samples < 2 {
+		return nil, fmt.Errorf("downsampling needs at least 2 samples per window, got %d", samples)
+	}
+	return &Downsampler{
+		Window:  window,
+		Samples: samples,
+		write:   write,
+		open:    map[int64]map[sampleKind]Results{},
+	}, nil
+}
+
+// Add adds a result to its window. Result files are written about in order
+// of time, so a window is written out once a result two windows past it
+// turns up; a result later than that starts its window anew, which reports
+// can't tell from the window having been kept whole.
+func (d *Downsampler) Add(r *Result) error {
+	if r.Metadata != nil {
+		return d.write(r)
+	}
+	idx := r.Timestamp.UnixNano() / int64(d.Window)
+	if idx > d.latest {
+		d.latest = idx
+		if err := d.flushBefore(idx - 1); err != nil {
+			return err
+		}
+	}
+	kinds := d.open[idx]
+	if kinds == nil {
+		kinds = map[sampleKind]Results{}
+		d.open[idx] = kinds
+	}
+	kind := sampleKind{r.Method, r.Path, r.Target, r.Error, r.DNSResolver, headerKey(r.Headers), r.Fuzz, r.Abandoned, r.Code, r.Conditional, r.TLSHandshake > 0, r.TLSResumed, r.Held, r.Corrupt, r.Ranges > 0, r.Segment, r.Segments > 0, r.PageLoad > 0, r.Delivery > 0, r.Lost, r.Page, r.Rcode, r.Event}
+	if kind.event > 2 {
+		kind.event = 2
+	}
+	kinds[kind] = append(kinds[kind], r)
+	return nil
+}
+
+// headerKey joins the recorded headers into something results with the
+// same ones have in common
+func headerKey(headers map[string]string) string {
+	if len(headers) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(headers))
+	for name, value := range headers {
+		pairs = append(pairs, name+": "+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\n")
+}
+
+// Flush writes out every window still open
+func (d *Downsampler) Flush() error {
+	return d.flushBefore(d.latest + 1)
+}
+
+// flushBefore writes out the windows before idx, in order
+func (d *Downsampler) flushBefore(idx int64) error {
+	var closing []int64
+	for open := range d.open {
+		if open < idx {
+			closing = append(closing, open)
+		}
+	}
+	sort.Slice(closing, func(i, j int) bool { return closing[i] < closing[j] })
+	for _, open := range closing {
+		var kept Results
+		for kind, r := range d.open[open] {
+			kept = append(kept, downsample(r, d.Samples, kind.event)...)
+		}
+		delete(d.open, open)
+		sort.Sort(kept)
+		for _, r := range kept {
+			if err := d.write(r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// downsample reduces results of one kind to at most samples results
+func downsample(r Results, samples, event int) Results {
+	if len(r) <= samples {
+		return r
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Latency < r[j].Latency })
+	kept := make(Results, 0, samples)
+	rest := r[:len(r)-1]
+	for i := 0; i < samples-1; i++ {
+		from, to := i*len(rest)/(samples-1), (i+1)*len(rest)/(samples-1)
+		if from < to {
+			kept = append(kept, meanOf(rest[from:to], event))
+		}
+	}
+	return append(kept, r[len(r)-1])
+}
+
+// meanOf returns a result standing for the results, which are of a kind
+func meanOf(r Results, event int) *Result {
+	var (
+		mean                        = *r[0]
+		count                       int
+		latency, dns, handshake     time.Duration
+		firstByte, lastByte         time.Duration
+		stalled, startup, pageLoad  time.Duration
+		delivery                    time.Duration
+		bytesIn, bytesOut, requests uint64
+		inFlight, ranges            int
+		segments, rebuffers         int
+	)
+	for _, result := range r {
+		w := result.weight()
+		count += w
+		latency += result.Latency * time.Duration(w)
+		dns += result.DNSLatency * time.Duration(w)
+		handshake += result.TLSHandshake * time.Duration(w)
+		firstByte += result.FirstByte * time.Duration(w)
+		lastByte += result.LastByte * time.Duration(w)
+		bytesIn += result.BytesIn * uint64(w)
+		bytesOut += result.BytesOut * uint64(w)
+		requests += uint64(result.RequestCount * w)
+		inFlight += result.InFlight * w
+		ranges += result.Ranges * w
+		segments += result.Segments * w
+		rebuffers += result.Rebuffers * w
+		stalled += result.Stalled * time.Duration(w)
+		startup += result.Startup * time.Duration(w)
+		pageLoad += result.PageLoad * time.Duration(w)
+		delivery += result.Delivery * time.Duration(w)
+		if result.Timestamp.Before(mean.Timestamp) {
+			mean.Timestamp = result.Timestamp
+		}
+	}
+	mean.Weight = count
+	mean.Latency = latency / time.Duration(count)
+	mean.DNSLatency = dns / time.Duration(count)
+	mean.TLSHandshake = handshake / time.Duration(count)
+	mean.FirstByte = firstByte / time.Duration(count)
+	mean.LastByte = lastByte / time.Duration(count)
+	mean.BytesIn = bytesIn / uint64(count)
+	mean.BytesOut = bytesOut / uint64(count)
+	mean.RequestCount = int(requests / uint64(count))
+	mean.InFlight = inFlight / count
+	mean.Ranges = ranges / count
+	mean.Segments = segments / count
+	mean.Rebuffers = rebuffers / count
+	mean.Stalled = stalled / time.Duration(count)
+	mean.Startup = startup / time.Duration(count)
+	mean.PageLoad = pageLoad / time.Duration(count)
+	mean.Delivery = delivery / time.Duration(count)
+	mean.Event = event
+	return &mean
+}
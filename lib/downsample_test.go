@@ -0,0 +1,113 @@
+package korra
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDownsamplerKeepsMetrics(t *testing.T) {
+	start := time.Unix(1450000000, 0)
+	var raw Results
+	for i := 0; i < 1000; i++ {
+		code, path := uint16(200), "/a"
+		if i%10 == 0 {
+			code, path = 503, "/b"
+		}
+		raw = append(raw, &Result{
+			Timestamp: start.Add(time.Duration(i) * 30 * time.Millisecond),
+			Code:      code,
+			Method:    "GET",
+			Path:      path,
+			Latency:   time.Duration(1+i%97) * time.Millisecond,
+			BytesIn:   1000,
+		})
+	}
+
+	var kept Results
+	d, err := NewDownsampler(5*time.Second, 5, func(r *Result) error {
+		kept = append(kept, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range raw {
+		if err := d.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 30s in 5s windows is 6 or 7 windows of 2 kinds, at most 5 results each
+	if len(kept) > 7*2*5 {
+		t.Fatalf("want at most 70 results kept, got %d", len(kept))
+	}
+	if kept.Count() != len(raw) {
+		t.Fatalf("want the kept results to stand for all %d, got %d", len(raw), kept.Count())
+	}
+	want, got := NewMetrics(raw), NewMetrics(kept)
+	if got.Requests != want.Requests || got.StatusCodes["503"] != want.StatusCodes["503"] || got.Success != want.Success {
+		t.Fatalf("want the same counts, got %+v for %+v", got, want)
+	}
+	if got.Latencies.Max != want.Latencies.Max || got.BytesIn.Total != want.BytesIn.Total {
+		t.Fatalf("want the same max and totals, got %+v for %+v", got, want)
+	}
+	if diff := got.Latencies.Mean - want.Latencies.Mean; diff < -time.Microsecond || diff > time.Microsecond {
+		t.Fatalf("want the same mean latency, got %s for %s", got.Latencies.Mean, want.Latencies.Mean)
+	}
+	if diff := got.Latencies.P95 - want.Latencies.P95; diff < -20*time.Millisecond || diff > 20*time.Millisecond {
+		t.Fatalf("want about the same P95, got %s for %s", got.Latencies.P95, want.Latencies.P95)
+	}
+	for i := 1; i < len(kept); i++ {
+		if kept[i].Timestamp.Before(kept[i-1].Timestamp) {
+			t.Fatalf("want the kept results in order of time, got %s after %s", kept[i].Timestamp, kept[i-1].Timestamp)
+		}
+	}
+}
+
+func TestDownsamplerKeepsFewResults(t *testing.T) {
+	var kept Results
+	d, _ := NewDownsampler(time.Minute, 3, func(r *Result) error {
+		kept = append(kept, r)
+		return nil
+	})
+	d.Add(&Result{Metadata: &Metadata{Session: "user_1.txt"}})
+	d.Add(&Result{Code: 200, Latency: time.Second, Timestamp: time.Unix(60, 0)})
+	d.Add(&Result{Code: 200, Latency: time.Millisecond, Timestamp: time.Unix(61, 0)})
+	d.Flush()
+	if len(kept) != 3 || kept[0].Metadata == nil || kept[1].Weight != 0 || kept[2].Weight != 0 {
+		t.Fatalf("want the metadata and both results as they were, got %+v", kept)
+	}
+}
+
+func TestDownsamplerKeepsHeadersApart(t *testing.T) {
+	var kept Results
+	d, _ := NewDownsampler(time.Minute, 2, func(r *Result) error {
+		kept = append(kept, r)
+		return nil
+	})
+	for i := 0; i < 6; i++ {
+		cache := "HIT"
+		if i%3 == 0 {
+			cache = "MISS"
+		}
+		d.Add(&Result{Code: 200, Latency: time.Duration(i+1) * time.Millisecond, Timestamp: time.Unix(60, 0), Headers: map[string]string{"X-Cache": cache}})
+	}
+	d.Flush()
+	if want, got := map[string]int{"HIT": 4, "MISS": 2}, NewMetrics(kept).Headers["X-Cache"]; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+}
+
+func TestNewDownsamplerChecks(t *testing.T) {
+	write := func(*Result) error { return nil }
+	if _, err := NewDownsampler(0, 5, write); err == nil {
+		t.Fatal("want an error for no window")
+	}
+	if _, err := NewDownsampler(time.Second, 1, write); err == nil {
+		t.Fatal("want an error for too few samples")
+	}
+}
@@ -0,0 +1,51 @@
+package korra
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+)
+
+// dumpBodyLimit is the most of a request or response body a dump shows
+const dumpBodyLimit = 4 << 10
+
+// Dumps returns a functional option which makes an Attacker keep each
+// request it sends and the response it gets in the result, headers and the
+// start of the bodies, so a failure can be logged with what caused it. It
+// costs every request a copy of its body, so it's for smoke tests rather
+// than load.
+func Dumps(enabled bool) func(*Attacker) {
+	return func(a *Attacker) {
+		a.dumps = enabled
+	}
+}
+
+// dumpRequest shows the request as it's sent, leaving its body to send
+func dumpRequest(request *http.Request) string {
+	dump, err := httputil.DumpRequestOut(request, true)
+	if err != nil {
+		return fmt.Sprintf("%s %s (can't show the request: %s)\n", request.Method, request.URL, err)
+	}
+	return limitDump(string(dump))
+}
+
+// dumpResponse shows the response's status line and headers, and the start
+// of its body that was read
+func dumpResponse(response *http.Response, body []byte) string {
+	dump, err := httputil.DumpResponse(response, false)
+	if err != nil {
+		return fmt.Sprintf("%s (can't show the response: %s)\n", response.Status, err)
+	}
+	return limitDump(string(dump) + string(body))
+}
+
+// limitDump cuts the dump's body short at the limit
+func limitDump(dump string) string {
+	bodyAt := strings.Index(dump, "\r\n\r\n")
+	if bodyAt < 0 || len(dump)-bodyAt-4 <= dumpBodyLimit {
+		return dump
+	}
+	cut := bodyAt + 4 + dumpBodyLimit
+	return fmt.Sprintf("%s\n... (%d more bytes)", dump[:cut], len(dump)-cut)
+}
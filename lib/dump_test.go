@@ -0,0 +1,70 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDumps(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Reason", "sold out")
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"error": "sold out"}` + strings.Repeat(" ", 2*dumpBodyLimit)))
+	}))
+	defer server.Close()
+	body := filepath.Join(t.TempDir(), "item.json")
+	os.WriteFile(body, []byte(`{"sku": "1234"}`), 0644)
+	target := &Target{Method: "POST", URL: server.URL + "/cart", BodyPath: body, Header: http.Header{"X-Team": {"checkout"}}}
+	targeter := func() (*Target, error) { return target, nil }
+
+	if result := NewAttacker().Hit(targeter, time.Now(), 1); result.dump != "" {
+		t.Fatalf("want no dump without Dumps, got: %s", result.dump)
+	}
+	result := NewAttacker(Dumps(true)).Hit(targeter, time.Now(), 1)
+	if result.Error == "" {
+		t.Fatal("want the conflict to fail")
+	}
+	for _, want := range []string{"POST /cart HTTP/1.1", "X-Team: checkout", `{"sku": "1234"}`, "409 Conflict", "X-Reason: sold out", `{"error": "sold out"}`, "more bytes)"} {
+		if !strings.Contains(result.dump, want) {
+			t.Errorf("want %q in the dump, got:\n%s", want, result.dump)
+		}
+	}
+}
+
+func TestSessionLogsFailureDumps(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cart" {
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer server.Close()
+	script := filepath.Join(t.TempDir(), "shopper.txt")
+	raw := strings.ReplaceAll("GET {}/\nPOST {}/cart\nGET {}/\n", "{}", server.URL)
+	if err := os.WriteFile(script, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+	log := make(chan string, 100)
+	session, err := NewSession(script, []func(*Attacker){Dumps(true)}, log, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.LogOnly = true
+	session.Run(log)
+	dumps := 0
+	for len(log) > 0 {
+		if line := <-log; strings.Contains(line, "Request and response of the failure") {
+			dumps++
+			if !strings.Contains(line, "shopper.txt 2/3:") || !strings.Contains(line, "POST /cart") {
+				t.Errorf("want the failed step's dump at its progress, got: %s", line)
+			}
+		}
+	}
+	if dumps != 1 {
+		t.Errorf("want the one failure dumped, got %d", dumps)
+	}
+}
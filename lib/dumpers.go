@@ -15,6 +15,12 @@ type DumpHeader interface {
 	Header() []byte
 }
 
+// DumpFooter is implemented by Dumpers with something to write after the
+// last Result.
+type DumpFooter interface {
+	Footer() []byte
+}
+
 // DumperFunc is an adapter to allow the use of ordinary functions as
 // Dumpers. If f is a function with the appropriate signature, DumperFunc(f)
 // is a Dumper object that calls f.
@@ -25,15 +31,16 @@ func (f DumperFunc) Dump(r *Result) ([]byte, error) { return f(r) }
 func (f HeaderFunc) Header() []byte                 { return f() }
 
 var DumpCSVHeader HeaderFunc = func() []byte {
-	return []byte("Timestamp\tStatus\tMethod\tPath\tRequestCount\tLatency\tBytes Out\tBytes In\tError\n")
+	return []byte("Timestamp\tStatus\tMethod\tPath\tRequestCount\tLatency\tBytes Out\tBytes In\tError\tDNS Latency\tDNS Resolver\tTarget\n")
 }
 
-// DumpCSV dumps a Result as a CSV record with six columns.
-// The columns are: unix timestamp in ns since epoch, http status code,
-// request latency in ns, bytes out, bytes in, and lastly the error.
+// DumpCSV dumps a Result as a tab-separated record. The columns are: unix
+// timestamp in ns since epoch, http status code, method, path, request
+// count, request latency in ns, bytes out, bytes in, the error, DNS lookup
+// latency in ns, the DNS resolver, and lastly the target base URL.
 var DumpCSV DumperFunc = func(r *Result) ([]byte, error) {
 	var buf bytes.Buffer
-	_, err := fmt.Fprintf(&buf, "%d\t%d\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n",
+	_, err := fmt.Fprintf(&buf, "%d\t%d\t%s\t%s\t%d\t%d\t%d\t%d\t%s\t%d\t%s\t%s\n",
 		r.Timestamp.UnixNano(),
 		r.Code,
 		r.Method,
@@ -43,6 +50,9 @@ var DumpCSV DumperFunc = func(r *Result) ([]byte, error) {
 		r.BytesOut,
 		r.BytesIn,
 		r.Error,
+		r.DNSLatency.Nanoseconds(),
+		r.DNSResolver,
+		r.Target,
 	)
 	return buf.Bytes(), err
 }
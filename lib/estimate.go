@@ -0,0 +1,139 @@
+package korra
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// EstimateOptions are what an estimate assumes of the target, since it
+// sends nothing to find out
+type EstimateOptions struct {
+	Latency      time.Duration // each request takes
+	ResponseSize uint64        // bytes of each response
+}
+
+// Estimate is what an attack with the scripts would send and how long it
+// would take, worked out without sending anything. Counts are expected
+// ones: steps in a CHANCE block count by its chance, so they're fractional,
+// and POLL steps count every attempt they may make.
+type Estimate struct {
+	Phases   []*PhaseEstimate
+	Buckets  []*BucketEstimate // sorted by key
+	Requests float64
+	BytesOut float64
+	BytesIn  float64
+	Duration time.Duration // of the phases one after another
+}
+
+// PhaseEstimate is the estimate for one phase of an attack, whose sessions
+// all run at once
+type PhaseEstimate struct {
+	Name     string
+	Sessions int
+	Requests float64
+	Duration time.Duration // of its longest session
+}
+
+// BucketEstimate is the estimate for the requests of one bucket, keyed by
+// method, host and path the way the precheck groups them
+type BucketEstimate struct {
+	Key      string
+	Requests float64
+	BytesOut float64
+	BytesIn  float64
+}
+
+// NewEstimate estimates an attack running the phases one after another, the
+// scripts of each by name at once, a session for each.
+func NewEstimate(names []string, phases [][]*SessionScript, opts EstimateOptions) *Estimate {
+	estimate := &Estimate{}
+	buckets := map[string]*BucketEstimate{}
+	for idx, scripts := range phases {
+		phase := &PhaseEstimate{Name: names[idx], Sessions: len(scripts)}
+		for _, script := range scripts {
+			if took := estimateScript(script, opts, phase, buckets); took > phase.Duration {
+				phase.Duration = took
+			}
+		}
+		estimate.Phases = append(estimate.Phases, phase)
+		estimate.Requests += phase.Requests
+		estimate.Duration += phase.Duration
+	}
+	for _, bucket := range buckets {
+		estimate.Buckets = append(estimate.Buckets, bucket)
+		estimate.BytesOut += bucket.BytesOut
+		estimate.BytesIn += bucket.BytesIn
+	}
+	sort.Slice(estimate.Buckets, func(i, j int) bool { return estimate.Buckets[i].Key < estimate.Buckets[j].Key })
+	return estimate
+}
+
+// estimateScript adds the requests a session of the script would send to
+// the phase and their buckets, returning how long it would take
+func estimateScript(script *SessionScript, opts EstimateOptions, phase *PhaseEstimate, buckets map[string]*BucketEstimate) time.Duration {
+	var took float64
+	for _, action := range script.Actions {
+		tgt := action.Target
+		if tgt == nil {
+			continue
+		}
+		chance := 1.0
+		if action.Chance != nil {
+			chance = action.Chance.Percent / 100
+		}
+		if tgt.PauseTime > 0 {
+			took += chance * float64(time.Duration(tgt.PauseTime)*time.Millisecond)
+		}
+		if tgt.Method == "" {
+			continue
+		}
+		sends := 1.0
+		if tgt.Poller.Active {
+			sends = float64(tgt.Poller.UntilCount)
+			took += chance * (sends - 1) * float64(time.Duration(tgt.Poller.WaitBetweenPolls)*time.Millisecond)
+		}
+		if tgt.KV != nil {
+			sends *= float64(tgt.KV.Requests)
+		}
+		requests := chance * sends
+		took += requests * float64(opts.Latency)
+		phase.Requests += requests
+
+		key := bucketKey(tgt)
+		bucket := buckets[key]
+		if bucket == nil {
+			bucket = &BucketEstimate{Key: key}
+			buckets[key] = bucket
+		}
+		bucket.Requests += requests
+		bucket.BytesOut += requests * float64(requestSize(tgt))
+		bucket.BytesIn += requests * float64(opts.ResponseSize)
+	}
+	return time.Duration(took)
+}
+
+// requestSize is the size of the target's request as HTTP/1.1 puts it on
+// the wire, before any values are filled in: the request line, the headers
+// and the body
+func requestSize(tgt *Target) int64 {
+	size := int64(len(fmt.Sprintf("%s %s HTTP/1.1\r\n\r\n", tgt.Method, tgt.URL)))
+	for name, values := range tgt.Header {
+		for _, value := range values {
+			size += int64(len(http.CanonicalHeaderKey(name)) + len(": \r\n") + len(value))
+		}
+	}
+	if tgt.BodyPath != "" {
+		if info, err := os.Stat(tgt.BodyPath); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// ParseSize reads a size in bytes, like 512, 10KB or 1.5MB
+func ParseSize(value string) (uint64, error) {
+	return parseBytes(value)
+}
@@ -0,0 +1,65 @@
+package korra
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEstimate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "item.json"), []byte(`{"sku": "1234"}`), 0644)
+	write := func(name, content string) *SessionScript {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		script, err := CheckScript(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return script
+	}
+	shopper := write("shopper.txt", `GET http://shop/products/1
+
+CHANCE 50
+POST http://shop/cart
+@item.json
+PAUSE 2000
+END
+
+POLL GET http://shop/orders/7
+[Wait=500 Count=3]
+`)
+	browser := write("browser.txt", `GET http://shop/products/2
+GET http://shop/products/3
+`)
+	estimate := NewEstimate([]string{"shop", "again"}, [][]*SessionScript{{shopper, browser}, {browser}},
+		EstimateOptions{Latency: 100 * time.Millisecond, ResponseSize: 1000})
+
+	if estimate.Requests != 8.5 {
+		t.Fatalf("want 8.5 requests, got %v", estimate.Requests)
+	}
+	// the shopper's 4.5 requests, 1s of expected pausing and 1s between polls
+	if want := 2450 * time.Millisecond; estimate.Phases[0].Duration != want || estimate.Phases[0].Sessions != 2 {
+		t.Fatalf("want the shopper's %s for the first phase, got %+v", want, estimate.Phases[0])
+	}
+	if want := 2650 * time.Millisecond; estimate.Duration != want {
+		t.Fatalf("want %s in all, got %s", want, estimate.Duration)
+	}
+	byKey := map[string]*BucketEstimate{}
+	for _, bucket := range estimate.Buckets {
+		byKey[bucket.Key] = bucket
+	}
+	if len(byKey) != 3 || byKey["GET shop/products/*"].Requests != 5 || byKey["GET shop/orders/*"].Requests != 3 {
+		t.Fatalf("want products and orders bucketed, got %+v", estimate.Buckets)
+	}
+	cart := byKey["POST shop/cart"]
+	if want := 0.5 * float64(len("POST http://shop/cart HTTP/1.1\r\n\r\n")+len(`{"sku": "1234"}`)); cart == nil || cart.BytesOut != want || cart.BytesIn != 500 {
+		t.Fatalf("want half a cart request with its body, got %+v", cart)
+	}
+	if estimate.BytesIn != 8500 {
+		t.Fatalf("want 8.5 responses received, got %v", estimate.BytesIn)
+	}
+}
@@ -0,0 +1,182 @@
+package korra
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// FeedStop ends a session quietly (after its ON_END hooks) when it
+	// asks for a row and there are none left
+	FeedStop = "stop"
+	// FeedRecycle starts over from the first row once every row is used,
+	// so rows are only reused after all of them have been
+	FeedRecycle = "recycle"
+	// FeedFail records a failed result for a session that asks for a row
+	// when there are none left, then ends it like FeedStop
+	FeedFail = "fail"
+)
+
+// ErrFeedExhausted is the error for a session asking for a row from a
+// feeder that has none left
+var ErrFeedExhausted = errors.New("feed exhausted")
+
+// feedReference matches the ${feed.column} references to feeder values in
+// URLs, headers and bodies
+var feedReference = regexp.MustCompile(`\$\{(\w+)\.(\w+)\}`)
+
+// Feeder hands out the rows of a CSV file to sessions, each row to at most
+// one session unless its policy is FeedRecycle. The first line of the file
+// names the columns.
+type Feeder struct {
+	sync.Mutex
+	Name    string
+	Policy  string
+	columns []string
+	rows    [][]string
+	next    int
+	store   bool // filled by saves (see NewStore)
+}
+
+// Partition is a node's share of the rows of every feed, so that nodes
+// sharing feeds never share rows: the rows are dealt out in turn to Of
+// partitions and the node takes those dealt to First through Last. A node
+// that can take twice the load of the others takes two partitions, like
+// 1-2/4 for the first of three nodes where it's the larger, and so twice
+// their share of the rates too.
+type Partition struct {
+	First, Last, Of int
+}
+
+// ParsePartition parses a partition as node/nodes, like 2/3, or a range of
+// them, like 3-4/4
+func ParsePartition(s string) (Partition, error) {
+	share, of, ok := strings.Cut(s, "/")
+	first, last, isRange := strings.Cut(share, "-")
+	if !isRange {
+		last = first
+	}
+	var (
+		p    Partition
+		errs [3]error
+	)
+	p.First, errs[0] = strconv.Atoi(first)
+	p.Last, errs[1] = strconv.Atoi(last)
+	p.Of, errs[2] = strconv.Atoi(of)
+	if !ok || errs[0] != nil || errs[1] != nil || errs[2] != nil {
+		return p, fmt.Errorf("feed partition '%s' has a wrong format, expected node/nodes or first-last/nodes", s)
+	}
+	if !p.valid() {
+		return p, fmt.Errorf("feed partition '%s' isn't within 1 and its number of nodes", s)
+	}
+	return p, nil
+}
+
+// valid returns whether the partition's range is within 1 and Of
+func (p Partition) valid() bool {
+	return p.Of >= 1 && p.First >= 1 && p.First <= p.Last && p.Last <= p.Of
+}
+
+// Share is the fraction of the load the partition's node takes, like 0.5
+// for 1-2/4, by which its rates are scaled (see Limiters.Share)
+func (p Partition) Share() float64 {
+	return float64(p.Last-p.First+1) / float64(p.Of)
+}
+
+func (p Partition) String() string {
+	if p.First == p.Last {
+		return fmt.Sprintf("%d/%d", p.First, p.Of)
+	}
+	return fmt.Sprintf("%d-%d/%d", p.First, p.Last, p.Of)
+}
+
+// has returns whether the row, numbered from 0, falls in the partition
+func (p Partition) has(row int) bool {
+	dealt := row%p.Of + 1
+	return dealt >= p.First && dealt <= p.Last
+}
+
+// NewFeeder reads the CSV rows for the feeder from the reader. To keep rows
+// unique across a run spread over several nodes, give each node a different
+// partition and it will only use the rows that fall in it.
+func NewFeeder(name, policy string, in io.Reader, partition Partition) (*Feeder, error) {
+	if policy != FeedStop && policy != FeedRecycle && policy != FeedFail {
+		return nil, fmt.Errorf("Unknown policy for feed %s: %s (expected %s, %s or %s)",
+			name, policy, FeedStop, FeedRecycle, FeedFail)
+	}
+	if !partition.valid() {
+		return nil, fmt.Errorf("Bad partition %s for feed %s", partition, name)
+	}
+	records, err := csv.NewReader(in).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading feed %s: %s", name, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("Feed %s has no header row", name)
+	}
+	feeder := &Feeder{Name: name, Policy: policy, columns: records[0]}
+	for idx, row := range records[1:] {
+		if partition.has(idx) {
+			feeder.rows = append(feeder.rows, row)
+		}
+	}
+	if len(feeder.rows) == 0 {
+		return nil, fmt.Errorf("Feed %s has no rows for partition %s", name, partition)
+	}
+	return feeder, nil
+}
+
+// Next claims the next row, returning its values keyed as they're
+// referenced in scripts ("feed.column"); it returns ErrFeedExhausted if
+// every row is claimed and the policy doesn't recycle them, or there are
+// none at all.
+func (f *Feeder) Next() (map[string]string, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.next == len(f.rows) {
+		if f.Policy != FeedRecycle || len(f.rows) == 0 {
+			return nil, ErrFeedExhausted
+		}
+		f.next = 0
+	}
+	row := f.rows[f.next]
+	f.next += 1
+	values := make(map[string]string, len(f.columns))
+	for idx, column := range f.columns {
+		if idx < len(row) {
+			values[f.Name+"."+strings.TrimSpace(column)] = row[idx]
+		}
+	}
+	return values, nil
+}
+
+// Remaining returns the number of rows not yet claimed
+func (f *Feeder) Remaining() int {
+	f.Lock()
+	defer f.Unlock()
+	return len(f.rows) - f.next
+}
+
+// Feeders are all the feeders for a run, by name
+type Feeders map[string]*Feeder
+
+// expandFeeds replaces every ${feed.column} reference in the string that
+// has a value; others are left as they are.
+func expandFeeds(s string, values map[string]string) string {
+	if len(values) == 0 || !strings.Contains(s, "${") {
+		return s
+	}
+	return feedReference.ReplaceAllStringFunc(s, func(ref string) string {
+		match := feedReference.FindStringSubmatch(ref)
+		if value, ok := values[match[1]+"."+match[2]]; ok {
+			return value
+		}
+		return ref
+	})
+}
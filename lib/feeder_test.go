@@ -0,0 +1,131 @@
+package korra
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const feedCSV = "id,email\n1,a@foo\n2,b@foo\n3,c@foo\n4,d@foo\n"
+
+func TestFeederUniqueRows(t *testing.T) {
+	feeder, err := NewFeeder("accounts", FeedStop, strings.NewReader(feedCSV), Partition{1, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		values, err := feeder.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := values["accounts.id"]; seen[id] {
+			t.Fatalf("Row %s claimed twice", id)
+		} else {
+			seen[id] = true
+		}
+	}
+	if _, err := feeder.Next(); err != ErrFeedExhausted {
+		t.Fatalf("Expected %s, got %v", ErrFeedExhausted, err)
+	}
+}
+
+func TestFeederRecycle(t *testing.T) {
+	feeder, err := NewFeeder("accounts", FeedRecycle, strings.NewReader(feedCSV), Partition{1, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		feeder.Next()
+	}
+	values, err := feeder.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := values["accounts.id"]; got != "1" {
+		t.Fatalf("Expected to recycle to row 1, got %s", got)
+	}
+}
+
+func TestFeederPartitions(t *testing.T) {
+	var ids []string
+	for partition := 1; partition <= 2; partition++ {
+		feeder, err := NewFeeder("accounts", FeedFail, strings.NewReader(feedCSV), Partition{partition, partition, 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for feeder.Remaining() > 0 {
+			values, _ := feeder.Next()
+			ids = append(ids, values["accounts.id"])
+		}
+	}
+	if got := strings.Join(ids, ","); got != "1,3,2,4" {
+		t.Fatalf("Expected partitions to split rows as 1,3,2,4, got %s", got)
+	}
+	if _, err := NewFeeder("accounts", "sometimes", strings.NewReader(feedCSV), Partition{1, 1, 1}); err == nil {
+		t.Fatal("Expected error for unknown policy")
+	}
+}
+
+func TestFeederWeightedPartitions(t *testing.T) {
+	partition, err := ParsePartition("1-2/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partition != (Partition{1, 2, 3}) || partition.String() != "1-2/3" || partition.Share() != 2.0/3 {
+		t.Fatalf("Expected partition 1-2/3, two thirds of the load, got %s", partition)
+	}
+	feeder, err := NewFeeder("accounts", FeedFail, strings.NewReader(feedCSV), partition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for feeder.Remaining() > 0 {
+		values, _ := feeder.Next()
+		ids = append(ids, values["accounts.id"])
+	}
+	if got := strings.Join(ids, ","); got != "1,2,4" {
+		t.Fatalf("Expected two of every three rows, 1,2,4, got %s", got)
+	}
+	for _, bad := range []string{"2", "a/3", "1-/3", "2-1/3", "0/3", "3-4/3"} {
+		if _, err := ParsePartition(bad); err == nil {
+			t.Fatalf("Expected error for partition %s", bad)
+		}
+	}
+}
+
+func TestTargetBind(t *testing.T) {
+	dir := t.TempDir()
+	bodyPath := path.Join(dir, "body.json")
+	if err := os.WriteFile(bodyPath, []byte(`{"email": "${accounts.email}"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tgt := NewTarget()
+	tgt.Method = "POST"
+	tgt.URL = "http://foo/users/${accounts.id}/${other.id}"
+	tgt.Header.Add("X-Email", "${accounts.email}")
+	tgt.BodyPath = bodyPath
+	bound, err := tgt.bind(map[string]string{"accounts.id": "7", "accounts.email": "a@foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://foo/users/7/${other.id}"; bound.URL != want {
+		t.Fatalf("Expected URL %s, got %s", want, bound.URL)
+	}
+	if got := bound.Header.Get("X-Email"); got != "a@foo" {
+		t.Fatalf("Expected header a@foo, got %s", got)
+	}
+	if got := tgt.Header.Get("X-Email"); got != "${accounts.email}" {
+		t.Fatalf("Expected the original target untouched, got header %s", got)
+	}
+	req, err := bound.Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, 64)
+	n, _ := req.Body.Read(body)
+	if want := `{"email": "a@foo"}`; string(body[:n]) != want {
+		t.Fatalf("Expected body %s, got %s", want, body[:n])
+	}
+}
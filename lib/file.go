@@ -1,7 +1,9 @@
 package korra
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -21,6 +23,42 @@ func File(name string, create bool) (*os.File, error) {
 	}
 }
 
+// OpenResults opens a result file for reading, mapped into memory where it
+// can be: decoding reads straight from the pages the OS caches for the file
+// rather than copying them through buffers of its own, and those pages can
+// be dropped under memory pressure, since they're the file's.
+func OpenResults(name string) (io.ReadCloser, error) {
+	f, err := File(name, false)
+	if err != nil || f == os.Stdin {
+		return f, err
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 || int64(int(info.Size())) != info.Size() {
+		return f, nil
+	}
+	data, unmap, err := mapFile(f, info.Size())
+	if err != nil {
+		return f, nil
+	}
+	return &mappedFile{bytes.NewReader(data), f, unmap}, nil
+}
+
+// mappedFile is a result file mapped into memory; bytes.Reader is an
+// io.ByteReader, so gob decodes from it without buffering
+type mappedFile struct {
+	*bytes.Reader
+	f     *os.File
+	unmap func() error
+}
+
+func (m *mappedFile) Close() error {
+	err := m.unmap()
+	if closeErr := m.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
 func GlobInputs(spec string) []string {
 	info, err := os.Stat(spec)
 	if err == nil && info.IsDir() {
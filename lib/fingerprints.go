@@ -0,0 +1,118 @@
+package korra
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fingerprint is the set of headers a particular browser on a particular
+// device sends with every request
+type Fingerprint struct {
+	Name   string
+	Header http.Header
+}
+
+// Fingerprints are the built-in browser and device fingerprints, by name
+var Fingerprints = map[string]Fingerprint{
+	"chrome-windows": {"chrome-windows", http.Header{
+		"User-Agent":         {"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"},
+		"Accept":             {"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+		"Accept-Language":    {"en-US,en;q=0.9"},
+		"Sec-Ch-Ua":          {`"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`},
+		"Sec-Ch-Ua-Mobile":   {"?0"},
+		"Sec-Ch-Ua-Platform": {`"Windows"`},
+	}},
+	"chrome-android": {"chrome-android", http.Header{
+		"User-Agent":         {"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"},
+		"Accept":             {"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+		"Accept-Language":    {"en-US,en;q=0.9"},
+		"Sec-Ch-Ua":          {`"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`},
+		"Sec-Ch-Ua-Mobile":   {"?1"},
+		"Sec-Ch-Ua-Platform": {`"Android"`},
+	}},
+	"edge-windows": {"edge-windows", http.Header{
+		"User-Agent":         {"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.0.0"},
+		"Accept":             {"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+		"Accept-Language":    {"en-US,en;q=0.9"},
+		"Sec-Ch-Ua":          {`"Chromium";v="124", "Microsoft Edge";v="124", "Not-A.Brand";v="99"`},
+		"Sec-Ch-Ua-Mobile":   {"?0"},
+		"Sec-Ch-Ua-Platform": {`"Windows"`},
+	}},
+	"firefox-linux": {"firefox-linux", http.Header{
+		"User-Agent":      {"Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0"},
+		"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+		"Accept-Language": {"en-US,en;q=0.5"},
+	}},
+	"firefox-windows": {"firefox-windows", http.Header{
+		"User-Agent":      {"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0"},
+		"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+		"Accept-Language": {"en-US,en;q=0.5"},
+	}},
+	"safari-iphone": {"safari-iphone", http.Header{
+		"User-Agent":      {"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"},
+		"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+		"Accept-Language": {"en-US,en;q=0.9"},
+	}},
+	"safari-mac": {"safari-mac", http.Header{
+		"User-Agent":      {"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15"},
+		"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+		"Accept-Language": {"en-US,en;q=0.9"},
+	}},
+}
+
+// FingerprintNames returns the names of the built-in fingerprints, sorted
+func FingerprintNames() []string {
+	names := make([]string, 0, len(Fingerprints))
+	for name := range Fingerprints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FingerprintRotation hands out fingerprints to sessions by their weights,
+// spread evenly
+type FingerprintRotation struct {
+	fingerprints []Fingerprint
+	weights      *smoothWeights
+}
+
+// ParseFingerprintRotation reads a comma-separated list of fingerprint
+// names, each optionally followed by '=' and its weight (default 1):
+//
+//	chrome-windows=5,safari-iphone=3,chrome-android=2
+//
+// 'all' rotates through every built-in fingerprint equally.
+func ParseFingerprintRotation(spec string) (*FingerprintRotation, error) {
+	rotation := &FingerprintRotation{}
+	var weights []int
+	if strings.TrimSpace(spec) == "all" {
+		spec = strings.Join(FingerprintNames(), ",")
+	}
+	for _, piece := range strings.Split(spec, ",") {
+		pieces := strings.SplitN(strings.TrimSpace(piece), "=", 2)
+		fingerprint, ok := Fingerprints[pieces[0]]
+		if !ok {
+			return nil, fmt.Errorf("Unknown fingerprint '%s', expected one of: %s", pieces[0], strings.Join(FingerprintNames(), ", "))
+		}
+		weight := 1
+		if len(pieces) == 2 {
+			var err error
+			if weight, err = strconv.Atoi(pieces[1]); err != nil || weight < 1 {
+				return nil, fmt.Errorf("Expected positive int as weight for fingerprint %s, got: %s", pieces[0], pieces[1])
+			}
+		}
+		rotation.fingerprints = append(rotation.fingerprints, fingerprint)
+		weights = append(weights, weight)
+	}
+	rotation.weights = newSmoothWeights(weights)
+	return rotation, nil
+}
+
+// Next returns the fingerprint for the next session
+func (r *FingerprintRotation) Next() Fingerprint {
+	return r.fingerprints[r.weights.next()]
+}
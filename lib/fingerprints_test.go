@@ -0,0 +1,42 @@
+package korra
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFingerprintRotation(t *testing.T) {
+	rotation, err := ParseFingerprintRotation("chrome-windows=2,safari-iphone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i := 0; i < 6; i++ {
+		names = append(names, rotation.Next().Name)
+	}
+	if got, want := strings.Join(names, ","), "chrome-windows,safari-iphone,chrome-windows,chrome-windows,safari-iphone,chrome-windows"; got != want {
+		t.Fatalf("Expected rotation %s, got %s", want, got)
+	}
+
+	all, err := ParseFingerprintRotation("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for range Fingerprints {
+		fingerprint := all.Next()
+		if fingerprint.Header.Get("User-Agent") == "" {
+			t.Fatalf("Expected fingerprint %s to have a User-Agent", fingerprint.Name)
+		}
+		seen[fingerprint.Name] = true
+	}
+	if len(seen) != len(Fingerprints) {
+		t.Fatalf("Expected 'all' to use every fingerprint once, got %d of %d", len(seen), len(Fingerprints))
+	}
+
+	for _, bad := range []string{"netscape", "chrome-windows=0", "chrome-windows=lots"} {
+		if _, err := ParseFingerprintRotation(bad); err == nil {
+			t.Fatalf("Expected error parsing '%s'", bad)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package korra
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Follower reads a file as it's written, like tail -f: at the end of what's
+// been written it waits for more rather than returning io.EOF, until it's
+// stopped. A result file being recorded by a running attack can be decoded
+// through it as the results come in.
+type Follower struct {
+	in       io.Reader
+	poll     time.Duration
+	stop     chan struct{}
+	stopOnce sync.Once
+	caughtUp chan struct{}
+	upOnce   sync.Once
+}
+
+// NewFollower returns a Follower of in, checking for more to read every poll
+func NewFollower(in io.Reader, poll time.Duration) *Follower {
+	return &Follower{in: in, poll: poll, stop: make(chan struct{}), caughtUp: make(chan struct{})}
+}
+
+func (f *Follower) Read(p []byte) (int, error) {
+	stopped := false
+	for {
+		n, err := f.in.Read(p)
+		if n > 0 {
+			return n, nil
+		} else if err != nil && err != io.EOF {
+			return 0, err
+		}
+		f.upOnce.Do(func() { close(f.caughtUp) })
+		if stopped {
+			return 0, io.EOF
+		}
+		select {
+		case <-f.stop:
+			// read once more, for what was written before it stopped
+			stopped = true
+		case <-time.After(f.poll):
+		}
+	}
+}
+
+// CaughtUp is closed once everything written before following began has
+// been read
+func (f *Follower) CaughtUp() <-chan struct{} {
+	return f.caughtUp
+}
+
+// Stop makes reads at the end return io.EOF instead of waiting, once
+// they've read what was written before it
+func (f *Follower) Stop() {
+	f.stopOnce.Do(func() { close(f.stop) })
+}
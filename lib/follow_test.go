@@ -0,0 +1,57 @@
+package korra
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFollower(t *testing.T) {
+	file, err := ioutil.TempFile("", "korra-follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("ab")
+
+	in, _ := os.Open(file.Name())
+	defer in.Close()
+	f := NewFollower(in, time.Millisecond)
+	p := make([]byte, 8)
+	if n, err := f.Read(p); n != 2 || err != nil || string(p[:n]) != "ab" {
+		t.Fatalf("want what's written so far, got %q, %v", p[:n], err)
+	}
+
+	read := make(chan string)
+	go func() {
+		n, _ := f.Read(p)
+		read <- string(p[:n])
+	}()
+	select {
+	case <-f.CaughtUp():
+	case <-time.After(time.Second):
+		t.Fatal("want to be caught up at the end of the file")
+	}
+	file.WriteString("cd")
+	if got := <-read; got != "cd" {
+		t.Fatalf("want what's written while following, got %q", got)
+	}
+
+	// stopped while it waits, it still reads what was written before
+	f = NewFollower(in, time.Hour)
+	go func() {
+		n, _ := f.Read(p)
+		read <- string(p[:n])
+	}()
+	<-f.CaughtUp()
+	file.WriteString("ef")
+	f.Stop()
+	if got := <-read; got != "ef" {
+		t.Fatalf("want what's written before stopping, got %q", got)
+	}
+	if n, err := f.Read(p); n != 0 || err != io.EOF {
+		t.Fatalf("want the end once stopped, got %d, %v", n, err)
+	}
+}
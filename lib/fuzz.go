@@ -0,0 +1,189 @@
+package korra
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+)
+
+// FuzzKinds are the protocol anomalies a fuzzed request may carry:
+//
+//   - duplicate-headers sends every header twice, Host and Content-Length
+//     included
+//   - chunk-size sends the body chunked, with chunk sizes zero-padded,
+//     upper case and carrying a chunk extension
+//   - content-length claims a Content-Length one short of the body, or -1
+//     for a request without one
+var FuzzKinds = []string{"duplicate-headers", "chunk-size", "content-length"}
+
+// Fuzz returns a functional option which makes an Attacker send the given
+// percentage (0-100) of its requests malformed, each with one of FuzzKinds
+// picked at random, to see how proxies, WAFs and servers take them. Fuzzed
+// requests are written by hand on a connection of their own, which is never
+// reused, and don't go through a proxy.
+func Fuzz(percent float64) func(*Attacker) {
+	return func(a *Attacker) {
+		a.fuzz = percent
+	}
+}
+
+// fuzzKind picks whether to fuzz the next request and how, returning an
+// empty string if not
+func (a *Attacker) fuzzKind() string {
+	if a.fuzz <= 0 || a.random.Float64()*100 >= a.fuzz {
+		return ""
+	}
+	return FuzzKinds[a.random.Int63n(int64(len(FuzzKinds)))]
+}
+
+// sendFuzzed sends the request with the anomaly on a new connection and
+// reads the response, which is whole and needn't be closed
+func (a *Attacker) sendFuzzed(request *http.Request, kind string) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		if body, err = io.ReadAll(request.Body); err != nil {
+			return nil, err
+		}
+		request.Body.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), a.dialer.Timeout)
+	defer cancel()
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace == nil {
+		trace = &httptrace.ClientTrace{}
+	}
+	host, port := request.URL.Hostname(), request.URL.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[request.URL.Scheme]
+	}
+	conn, err := a.dial(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if request.URL.Scheme == "https" {
+		config := &tls.Config{}
+		if tr := a.client.Transport.(*http.Transport); tr.TLSClientConfig != nil {
+			config = tr.TLSClientConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = host
+		}
+		config.NextProtos = []string{"http/1.1"}
+		tlsConn := tls.Client(conn, config)
+		if trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		err := tlsConn.HandshakeContext(ctx)
+		if trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	if _, err = conn.Write(fuzzedRequest(request, body, kind)); err != nil {
+		return nil, err
+	}
+	if trace.WroteRequest != nil {
+		trace.WroteRequest(httptrace.WroteRequestInfo{})
+	}
+	reader := bufio.NewReader(conn)
+	if _, err = reader.Peek(1); err == nil && trace.GotFirstResponseByte != nil {
+		trace.GotFirstResponseByte()
+	}
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		return nil, err
+	}
+	read, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(read))
+	return response, nil
+}
+
+// fuzzedRequest writes out the request with the body and the anomaly
+func fuzzedRequest(request *http.Request, body []byte, kind string) []byte {
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+	lines := []string{"Host: " + host}
+	names := make([]string, 0, len(request.Header))
+	for name := range request.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch name {
+		case "Host", "Content-Length", "Transfer-Encoding", "Connection":
+			continue
+		}
+		for _, value := range request.Header[name] {
+			lines = append(lines, name+": "+value)
+		}
+	}
+	switch kind {
+	case "chunk-size":
+		lines = append(lines, "Transfer-Encoding: chunked")
+	case "content-length":
+		length := strconv.Itoa(len(body) - 1)
+		lines = append(lines, "Content-Length: "+length)
+	default:
+		if len(body) > 0 || request.Method == "POST" || request.Method == "PUT" || request.Method == "PATCH" {
+			lines = append(lines, "Content-Length: "+strconv.Itoa(len(body)))
+		}
+	}
+	lines = append(lines, "Connection: close")
+	if kind == "duplicate-headers" {
+		doubled := make([]string, 0, 2*len(lines))
+		for _, line := range lines {
+			doubled = append(doubled, line, line)
+		}
+		lines = doubled
+	}
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "%s %s HTTP/1.1\r\n", request.Method, request.URL.RequestURI())
+	for _, line := range lines {
+		out.WriteString(line + "\r\n")
+	}
+	out.WriteString("\r\n")
+	if kind == "chunk-size" {
+		for len(body) > 0 {
+			size := len(body)
+			if size > fuzzChunkSize {
+				size = fuzzChunkSize
+			}
+			fmt.Fprintf(out, "%08X;korra=fuzz\r\n", size)
+			out.Write(body[:size])
+			out.WriteString("\r\n")
+			body = body[size:]
+		}
+		out.WriteString("0\r\n\r\n")
+	} else {
+		out.Write(body)
+	}
+	return out.Bytes()
+}
+
+// fuzzChunkSize is the most body a chunk-size request puts in one chunk
+const fuzzChunkSize = 1024
@@ -0,0 +1,76 @@
+package korra
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFuzzedRequest(t *testing.T) {
+	request, _ := http.NewRequest("POST", "http://example.com/things?a=1", nil)
+	request.Header.Set("X-Token", "abc")
+	body := []byte("hello")
+
+	for kind, want := range map[string]string{
+		"duplicate-headers": "POST /things?a=1 HTTP/1.1\r\nHost: example.com\r\nHost: example.com\r\nX-Token: abc\r\nX-Token: abc\r\n" +
+			"Content-Length: 5\r\nContent-Length: 5\r\nConnection: close\r\nConnection: close\r\n\r\nhello",
+		"chunk-size": "POST /things?a=1 HTTP/1.1\r\nHost: example.com\r\nX-Token: abc\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n" +
+			"00000005;korra=fuzz\r\nhello\r\n0\r\n\r\n",
+		"content-length": "POST /things?a=1 HTTP/1.1\r\nHost: example.com\r\nX-Token: abc\r\nContent-Length: 4\r\nConnection: close\r\n\r\nhello",
+	} {
+		if got := string(fuzzedRequest(request, body, kind)); got != want {
+			t.Errorf("%s; want:\n%q\ngot:\n%q", kind, want, got)
+		}
+	}
+	if got := string(fuzzedRequest(request, nil, "content-length")); !strings.Contains(got, "Content-Length: -1\r\n") {
+		t.Errorf("want a negative length without a body, got: %q", got)
+	}
+}
+
+func TestFuzz(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Read", strconv.Itoa(len(body)))
+	}))
+	defer server.Close()
+	targeter := func() (*Target, error) {
+		return &Target{Method: "POST", URL: server.URL + "/", body: []byte("hello")}, nil
+	}
+
+	attacker := NewAttacker(Seed(1), Fuzz(100), RecordHeaders("X-Read"))
+	var results Results
+	for i := 0; i < 30; i++ {
+		result := attacker.Hit(targeter, time.Now(), i)
+		if result.Fuzz == "" {
+			t.Fatalf("want every request fuzzed, got: %+v", result)
+		}
+		results = append(results, result)
+	}
+	want := map[string]struct {
+		code uint16
+		read string
+	}{
+		"duplicate-headers": {400, ""}, // Go's server won't take two Host headers
+		"chunk-size":        {200, "5"},
+		"content-length":    {200, "4"},
+	}
+	for _, result := range results {
+		if w := want[result.Fuzz]; result.Code != w.code || result.Headers["X-Read"] != w.read {
+			t.Fatalf("%s; want %d having read %q, got: %+v", result.Fuzz, w.code, w.read, result)
+		}
+	}
+	m := NewMetrics(results)
+	for kind, w := range want {
+		if m.Fuzz[kind][strconv.Itoa(int(w.code))] == 0 {
+			t.Fatalf("want %s counted, got: %v", kind, m.Fuzz)
+		}
+	}
+
+	if result := NewAttacker(Fuzz(0)).Hit(targeter, time.Now(), 1); result.Fuzz != "" || result.Code != 200 {
+		t.Fatalf("want no fuzzing, got: %+v", result)
+	}
+}
@@ -0,0 +1,87 @@
+package korra
+
+import (
+	"sync"
+	"time"
+)
+
+// Gate lets a running attack be paused and resumed: while it's paused every
+// session sharing it waits before its next step, or its next request in a
+// polling step, until it's resumed. A nil *Gate is always open.
+type Gate struct {
+	sync.Mutex
+	resumed chan struct{} // nil unless paused; closed on resume
+	since   time.Time     // when it was paused
+	held    time.Duration // paused for, over the pauses before this one
+}
+
+func NewGate() *Gate {
+	return &Gate{}
+}
+
+// Pause holds every session at its next step; it returns false if the
+// gate was already paused.
+func (g *Gate) Pause() bool {
+	g.Lock()
+	defer g.Unlock()
+	if g.resumed != nil {
+		return false
+	}
+	g.resumed, g.since = make(chan struct{}), time.Now()
+	return true
+}
+
+// Resume lets every waiting session carry on; it returns false if the gate
+// wasn't paused.
+func (g *Gate) Resume() bool {
+	g.Lock()
+	defer g.Unlock()
+	if g.resumed == nil {
+		return false
+	}
+	close(g.resumed)
+	g.resumed = nil
+	g.held += time.Since(g.since)
+	return true
+}
+
+// Paused returns true if the gate is holding sessions
+func (g *Gate) Paused() bool {
+	if g == nil {
+		return false
+	}
+	g.Lock()
+	defer g.Unlock()
+	return g.resumed != nil
+}
+
+// pausedFor returns how long the gate has been paused for in all, counting
+// the pause it's in, if any
+func (g *Gate) pausedFor() time.Duration {
+	if g == nil {
+		return 0
+	}
+	g.Lock()
+	defer g.Unlock()
+	if g.resumed != nil {
+		return g.held + time.Since(g.since)
+	}
+	return g.held
+}
+
+// wait blocks until the gate is open or the abort channel is closed
+func (g *Gate) wait(abort chan struct{}) {
+	if g == nil {
+		return
+	}
+	g.Lock()
+	resumed := g.resumed
+	g.Unlock()
+	if resumed == nil {
+		return
+	}
+	select {
+	case <-resumed:
+	case <-abort:
+	}
+}
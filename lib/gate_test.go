@@ -0,0 +1,44 @@
+package korra
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGatePauseResume(t *testing.T) {
+	gate := NewGate()
+	if !gate.Pause() || gate.Pause() {
+		t.Fatal("Expected only the first pause to pause the gate")
+	}
+	waited := make(chan struct{})
+	go func() {
+		gate.wait(make(chan struct{}))
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("Expected wait to block while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if !gate.Resume() || gate.Resume() {
+		t.Fatal("Expected only the first resume to resume the gate")
+	}
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Expected wait to return once resumed")
+	}
+}
+
+func TestGateAbort(t *testing.T) {
+	gate := NewGate()
+	gate.Pause()
+	abort := make(chan struct{})
+	close(abort)
+	gate.wait(abort) // returns even though still paused
+	var open *Gate
+	open.wait(nil)
+	if open.Paused() {
+		t.Fatal("Expected a nil gate to be open")
+	}
+}
@@ -0,0 +1,431 @@
+package korra
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The gRPC services we use to probe a server before attacking it
+const (
+	grpcHealthCheck         = "/grpc.health.v1.Health/Check"
+	grpcReflectionV1        = "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"
+	grpcReflectionV1a       = "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"
+	grpcStatusOK            = "0"
+	grpcStatusUnimplemented = "12" // what servers answer for unknown methods
+)
+
+// GRPCHealthStatuses are the names of the statuses returned by a gRPC health
+// check, indexed by their value
+var GRPCHealthStatuses = []string{"UNKNOWN", "SERVING", "NOT_SERVING", "SERVICE_UNKNOWN"}
+
+// errGRPCUnimplemented is returned when the server doesn't have a method
+var errGRPCUnimplemented = errors.New("unimplemented")
+
+// GRPCClient makes unary calls to the health and reflection services of a
+// gRPC server, enough to find out what it serves without generated code.
+type GRPCClient struct {
+	base   string
+	client *http.Client
+}
+
+// NewGRPCClient creates a client for the target, which is either
+// grpc://host:port for a plaintext server or grpcs://host:port for one
+// using TLS with the given config.
+func NewGRPCClient(target string, tlsc *tls.Config, timeout time.Duration) (*GRPCClient, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("bad gRPC target '%s', expected grpc://host:port or grpcs://host:port", target)
+	}
+	protocols := new(http.Protocols)
+	// cloned, since HTTP/2 adds itself to the config's protocols
+	tr := &http.Transport{TLSClientConfig: tlsc.Clone(), Protocols: protocols}
+	base := "https://" + u.Host
+	switch u.Scheme {
+	case "grpc":
+		protocols.SetUnencryptedHTTP2(true)
+		base = "http://" + u.Host
+	case "grpcs":
+		protocols.SetHTTP2(true)
+		tr.ForceAttemptHTTP2 = true
+	default:
+		return nil, fmt.Errorf("bad gRPC target '%s', expected grpc://host:port or grpcs://host:port", target)
+	}
+	return &GRPCClient{base: base, client: &http.Client{Transport: tr, Timeout: timeout}}, nil
+}
+
+// call sends each message to the method in a single request and returns
+// every message the server responds with.
+func (c *GRPCClient) call(method string, messages ...[]byte) ([][]byte, error) {
+	body := &bytes.Buffer{}
+	for _, msg := range messages {
+		frame := make([]byte, 5)
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+		body.Write(frame)
+		body.Write(msg)
+	}
+	req, err := http.NewRequest("POST", c.base+method, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %s", method, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// a trailers-only response has its status in the headers
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status == grpcStatusUnimplemented {
+		return nil, errGRPCUnimplemented
+	} else if status != grpcStatusOK {
+		return nil, fmt.Errorf("%s: gRPC status %s: %s", method, status, message)
+	}
+
+	var responses [][]byte
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, fmt.Errorf("%s: truncated message", method)
+		}
+		size := int(binary.BigEndian.Uint32(data[1:5]))
+		if data[0] != 0 {
+			return nil, fmt.Errorf("%s: compressed messages not supported", method)
+		} else if len(data) < 5+size {
+			return nil, fmt.Errorf("%s: truncated message", method)
+		}
+		responses = append(responses, data[5:5+size])
+		data = data[5+size:]
+	}
+	return responses, nil
+}
+
+// Health returns the status of the service, or of the whole server if the
+// service is blank.
+func (c *GRPCClient) Health(service string) (string, error) {
+	var request []byte
+	if service != "" {
+		request = appendProtoBytes(request, 1, []byte(service))
+	}
+	responses, err := c.call(grpcHealthCheck, request)
+	if err == errGRPCUnimplemented {
+		return "", fmt.Errorf("server does not implement grpc.health.v1.Health")
+	} else if err != nil {
+		return "", err
+	} else if len(responses) != 1 {
+		return "", fmt.Errorf("expected one health check response, got %d", len(responses))
+	}
+	status := uint64(0)
+	fields, err := protoFields(responses[0])
+	if err != nil {
+		return "", err
+	}
+	for _, field := range fields {
+		if field.num == 1 {
+			status = field.varint
+		}
+	}
+	if status >= uint64(len(GRPCHealthStatuses)) {
+		return "", fmt.Errorf("unknown health status %d", status)
+	}
+	return GRPCHealthStatuses[status], nil
+}
+
+// reflect sends a single reflection request, trying the v1 service before
+// falling back to v1alpha, and returns the field holding the answer.
+func (c *GRPCClient) reflect(request []byte, answer int) ([]byte, error) {
+	responses, err := c.call(grpcReflectionV1, request)
+	if err == errGRPCUnimplemented {
+		responses, err = c.call(grpcReflectionV1a, request)
+	}
+	if err == errGRPCUnimplemented {
+		return nil, fmt.Errorf("server does not implement grpc.reflection")
+	} else if err != nil {
+		return nil, err
+	} else if len(responses) != 1 {
+		return nil, fmt.Errorf("expected one reflection response, got %d", len(responses))
+	}
+	fields, err := protoFields(responses[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		switch field.num {
+		case answer:
+			return field.bytes, nil
+		case 7: // error_response
+			var message string
+			if errFields, err := protoFields(field.bytes); err == nil {
+				for _, errField := range errFields {
+					if errField.num == 2 {
+						message = string(errField.bytes)
+					}
+				}
+			}
+			return nil, fmt.Errorf("reflection error: %s", message)
+		}
+	}
+	return nil, fmt.Errorf("reflection response missing its answer")
+}
+
+// Services returns the fully qualified names of all services on the server
+func (c *GRPCClient) Services() ([]string, error) {
+	answer, err := c.reflect(appendProtoBytes(nil, 7, []byte("*")), 6)
+	if err != nil {
+		return nil, err
+	}
+	serviceFields, err := protoFields(answer)
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, serviceField := range serviceFields {
+		nameFields, err := protoFields(serviceField.bytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, nameField := range nameFields {
+			if nameField.num == 1 {
+				services = append(services, string(nameField.bytes))
+			}
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// Methods returns the names of the methods of the fully qualified service
+func (c *GRPCClient) Methods(service string) ([]string, error) {
+	answer, err := c.reflect(appendProtoBytes(nil, 4, []byte(service)), 4)
+	if err != nil {
+		return nil, err
+	}
+	files, err := protoFields(answer)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		methods, found, err := serviceMethods(file.bytes, service)
+		if err != nil {
+			return nil, err
+		} else if found {
+			return methods, nil
+		}
+	}
+	return nil, fmt.Errorf("no descriptor found for service %s", service)
+}
+
+// serviceMethods looks for the service in a FileDescriptorProto and returns
+// the names of its methods if found.
+func serviceMethods(descriptor []byte, service string) ([]string, bool, error) {
+	fields, err := protoFields(descriptor)
+	if err != nil {
+		return nil, false, err
+	}
+	pkg := ""
+	for _, field := range fields {
+		if field.num == 2 {
+			pkg = string(field.bytes) + "."
+		}
+	}
+	for _, field := range fields {
+		if field.num != 6 { // service
+			continue
+		}
+		serviceFields, err := protoFields(field.bytes)
+		if err != nil {
+			return nil, false, err
+		}
+		var name string
+		var methods []string
+		for _, serviceField := range serviceFields {
+			switch serviceField.num {
+			case 1:
+				name = string(serviceField.bytes)
+			case 2:
+				methodFields, err := protoFields(serviceField.bytes)
+				if err != nil {
+					return nil, false, err
+				}
+				for _, methodField := range methodFields {
+					if methodField.num == 1 {
+						methods = append(methods, string(methodField.bytes))
+					}
+				}
+			}
+		}
+		if pkg+name == service {
+			sort.Strings(methods)
+			return methods, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// GRPCDiscovery is what we learned about a gRPC server from its health
+// and reflection services.
+type GRPCDiscovery struct {
+	Target   string
+	Health   string
+	Services map[string][]string // service name => method names
+	Errors   []string
+}
+
+// DiscoverGRPC probes the server's health and lists every service and
+// method it serves; problems along the way are collected in Errors.
+func DiscoverGRPC(client *GRPCClient, target string) *GRPCDiscovery {
+	d := &GRPCDiscovery{Target: target, Services: map[string][]string{}}
+	var err error
+	if d.Health, err = client.Health(""); err != nil {
+		d.Errors = append(d.Errors, fmt.Sprintf("health check: %s", err))
+	}
+	services, err := client.Services()
+	if err != nil {
+		d.Errors = append(d.Errors, fmt.Sprintf("listing services: %s", err))
+	}
+	for _, service := range services {
+		if d.Services[service], err = client.Methods(service); err != nil {
+			d.Errors = append(d.Errors, fmt.Sprintf("describing %s: %s", service, err))
+		}
+	}
+	return d
+}
+
+// Check returns a problem for every method (as package.Service/Method) that
+// isn't available on the server, plus any problems found during discovery
+// and an unhealthy server. An empty slice means we're good to go.
+func (d *GRPCDiscovery) Check(methods []string) []string {
+	problems := append([]string{}, d.Errors...)
+	if d.Health != "" && d.Health != "SERVING" {
+		problems = append(problems, fmt.Sprintf("server health is %s", d.Health))
+	}
+	for _, method := range methods {
+		pieces := strings.SplitN(strings.TrimPrefix(method, "/"), "/", 2)
+		if len(pieces) != 2 {
+			problems = append(problems, fmt.Sprintf("bad method '%s', expected package.Service/Method", method))
+			continue
+		}
+		available, ok := d.Services[pieces[0]]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("service %s not found", pieces[0]))
+			continue
+		}
+		found := false
+		for _, name := range available {
+			found = found || name == pieces[1]
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("method %s not found in service %s", pieces[1], pieces[0]))
+		}
+	}
+	return problems
+}
+
+// Report writes a summary of the discovery and the result of checking the
+// methods to out.
+func (d *GRPCDiscovery) Report(out io.Writer, methods []string) {
+	health := d.Health
+	if health == "" {
+		health = "(unavailable)"
+	}
+	fmt.Fprintf(out, "gRPC target %s: health %s, %d services\n", d.Target, health, len(d.Services))
+	names := make([]string, 0, len(d.Services))
+	for name := range d.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "\t%s\n", name)
+		for _, method := range d.Services[name] {
+			fmt.Fprintf(out, "\t\t%s\n", method)
+		}
+	}
+	problems := d.Check(methods)
+	if len(problems) == 0 {
+		fmt.Fprintf(out, "OK\n")
+		return
+	}
+	fmt.Fprintf(out, "FAIL %d\n", len(problems))
+	for _, problem := range problems {
+		fmt.Fprintf(out, "\t%s\n", problem)
+	}
+}
+
+// protoField is a single decoded protocol buffer field; we only need to
+// read varints and length-delimited values.
+type protoField struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+// protoFields decodes the top-level fields of a protocol buffer message
+func protoFields(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("bad protobuf tag")
+		}
+		b = b[n:]
+		field := protoField{num: int(tag >> 3)}
+		switch tag & 7 {
+		case 0:
+			if field.varint, n = binary.Uvarint(b); n <= 0 {
+				return nil, errors.New("bad protobuf varint")
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, errors.New("truncated protobuf fixed64")
+			}
+			b = b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, errors.New("truncated protobuf bytes")
+			}
+			field.bytes = b[n : n+int(size)]
+			b = b[n+int(size):]
+		case 5:
+			if len(b) < 4 {
+				return nil, errors.New("truncated protobuf fixed32")
+			}
+			b = b[4:]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", tag&7)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// appendProtoBytes appends a length-delimited field to a message
+func appendProtoBytes(b []byte, num int, value []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(num<<3|2))
+	b = append(b, buf[:n]...)
+	n = binary.PutUvarint(buf, uint64(len(value)))
+	b = append(b, buf[:n]...)
+	return append(b, value...)
+}
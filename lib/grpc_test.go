@@ -0,0 +1,83 @@
+package korra
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+func newGRPCTestServer(t *testing.T) *httptest.Server {
+	file := appendProtoBytes(nil, 2, []byte("shop"))
+	method := appendProtoBytes(nil, 1, []byte("AddItem"))
+	service := appendProtoBytes(appendProtoBytes(nil, 1, []byte("Cart")), 2, method)
+	file = appendProtoBytes(file, 6, service)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		switch r.URL.Path {
+		case grpcHealthCheck:
+			w.Write(grpcFrame([]byte{0x08, 0x01})) // SERVING
+		case grpcReflectionV1a:
+			if strings.Contains(string(body), "*") {
+				names := appendProtoBytes(nil, 1, appendProtoBytes(nil, 1, []byte("shop.Cart")))
+				w.Write(grpcFrame(appendProtoBytes(nil, 6, names)))
+			} else {
+				w.Write(grpcFrame(appendProtoBytes(nil, 4, appendProtoBytes(nil, 1, file))))
+			}
+		default:
+			w.Header().Set("Grpc-Status", grpcStatusUnimplemented)
+			return
+		}
+		w.Header().Set("Grpc-Status", grpcStatusOK)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	return server
+}
+
+func TestDiscoverGRPC(t *testing.T) {
+	server := newGRPCTestServer(t)
+	defer server.Close()
+	target := "grpcs://" + strings.TrimPrefix(server.URL, "https://")
+	client, err := NewGRPCClient(target, DefaultTLSConfig, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DiscoverGRPC(client, target)
+	if len(d.Errors) > 0 {
+		t.Fatalf("discovery errors: %v", d.Errors)
+	}
+	if d.Health != "SERVING" {
+		t.Fatalf("health: got: %s, want: SERVING", d.Health)
+	}
+	if want := map[string][]string{"shop.Cart": {"AddItem"}}; !reflect.DeepEqual(d.Services, want) {
+		t.Fatalf("services: got: %v, want: %v", d.Services, want)
+	}
+	if problems := d.Check([]string{"shop.Cart/AddItem"}); len(problems) != 0 {
+		t.Fatalf("got problems: %v", problems)
+	}
+	if problems := d.Check([]string{"shop.Cart/Checkout", "shop.Orders/List"}); len(problems) != 2 {
+		t.Fatalf("got problems: %v, want 2", problems)
+	}
+}
+
+func TestNewGRPCClientBadTarget(t *testing.T) {
+	for _, target := range []string{"localhost:50051", "http://localhost:50051"} {
+		if _, err := NewGRPCClient(target, nil, time.Second); err == nil {
+			t.Errorf("want error for '%s'", target)
+		}
+	}
+}
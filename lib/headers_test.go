@@ -0,0 +1,80 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordHeaders(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits++; hits%4 == 0 {
+			w.Header().Set("X-Cache", "MISS")
+		} else {
+			w.Header().Set("X-Cache", "HIT")
+		}
+		w.Header().Set("X-Ignored", "yes")
+	}))
+	defer server.Close()
+
+	attacker := NewAttacker(RecordHeaders("x-cache", " X-Backend"))
+	target := &Target{Method: "GET", URL: server.URL}
+	var r Results
+	for i := 0; i < 8; i++ {
+		r = append(r, attacker.Hit(func() (*Target, error) { return target, nil }, time.Now(), 1))
+	}
+	if want, got := map[string]string{"X-Cache": "HIT"}, r[0].Headers; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+
+	m := NewMetrics(r)
+	if want, got := map[string]map[string]int{"X-Cache": {"HIT": 6, "MISS": 2}}, m.Headers; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+	if want, got := "HIT:6 (75.00%), MISS:2 (25.00%)", headerValues(m.Headers["X-Cache"], m.Requests); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestHeaderValuesShown(t *testing.T) {
+	values := map[string]int{}
+	for _, backend := range "abcdefghijkl" {
+		values[string(backend)] = 1
+	}
+	values["z"] = 2
+	want := "z:2 (15.38%), a:1 (7.69%), b:1 (7.69%), c:1 (7.69%), d:1 (7.69%), e:1 (7.69%), f:1 (7.69%), g:1 (7.69%), h:1 (7.69%), i:1 (7.69%), 3 more"
+	if got := headerValues(values, 13); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestReportByInstance(t *testing.T) {
+	var r Results
+	for i, instance := range []string{"app-1", "app-2", "app-1", "app-1", ""} {
+		result := &Result{Code: 200, Timestamp: time.Unix(int64(i), 0), Latency: time.Millisecond}
+		if instance != "" {
+			result.Headers = map[string]string{"X-Served-By": instance}
+		}
+		r = append(r, result)
+	}
+	opts := SectionOptions{InstanceHeader: "X-Served-By"}
+	data := NewReportData(r, BucketCollection{}, opts)
+	if len(data.Instances) != 3 {
+		t.Fatalf("want 3 instances, got: %+v", data.Instances)
+	}
+	if data.Instances[0].Name != "(none)" || data.Instances[1].Name != "app-1" || data.Instances[1].Results != 3 {
+		t.Fatalf("bad instances: %+v", data.Instances)
+	}
+
+	report, err := TextReporter{SectionOptions: opts}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), "INSTANCE X-Served-By=app-1: 3 results, 60.00%") {
+		t.Fatalf("no app-1 section in report:\n%s", report)
+	}
+}
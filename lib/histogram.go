@@ -1,6 +1,12 @@
 package korra
 
-import "time"
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Histogram computes a histogram for the given Results with the defined
 // buckets and returns it. The provided Results must be sorted.
@@ -13,7 +19,102 @@ func Histogram(buckets []time.Duration, r Results) []uint64 {
 				break
 			}
 		}
-		counts[i]++
+		counts[i] += uint64(res.weight())
 	}
 	return counts
 }
+
+// SizeHistogram computes a histogram of the bytes received for the given
+// Results with the defined buckets of sizes and returns it.
+func SizeHistogram(buckets []uint64, r Results) []uint64 {
+	var i int
+	counts := make([]uint64, len(buckets))
+	for _, res := range r {
+		for i = 0; i < len(buckets)-1; i++ {
+			if res.BytesIn >= buckets[i] && res.BytesIn < buckets[i+1] {
+				break
+			}
+		}
+		counts[i] += uint64(res.weight())
+	}
+	return counts
+}
+
+// LinearBuckets returns buckets of the same width from min to max, with
+// everything from max on in the last one.
+func LinearBuckets(min, max time.Duration, count int) []time.Duration {
+	width := (max - min) / time.Duration(count)
+	buckets := make([]time.Duration, count+1)
+	for i := range buckets {
+		buckets[i] = min + time.Duration(i)*width
+	}
+	buckets[count] = max
+	return buckets
+}
+
+// ExponentialBuckets returns a bucket from zero to start and count more,
+// each factor times as wide as the one before.
+func ExponentialBuckets(start time.Duration, factor float64, count int) []time.Duration {
+	buckets := []time.Duration{0}
+	bound := float64(start)
+	for i := 0; i < count; i++ {
+		buckets = append(buckets, time.Duration(bound))
+		bound *= factor
+	}
+	return buckets
+}
+
+// QuantileBuckets returns up to count buckets with about the same number of
+// the Results' latencies in each; results with the same latency always stay
+// in the same bucket, so there may be fewer.
+func QuantileBuckets(r Results, count int) []time.Duration {
+	latencies := make([]time.Duration, len(r))
+	for i, res := range r {
+		latencies[i] = res.Latency
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	buckets := []time.Duration{0}
+	for i := 1; i < count && len(latencies) > 0; i++ {
+		bound := latencies[i*len(latencies)/count]
+		if bound > buckets[len(buckets)-1] {
+			buckets = append(buckets, bound)
+		}
+	}
+	return buckets
+}
+
+// generateBuckets makes buckets with the named generator and its arguments
+func generateBuckets(generator string, args []string) ([]time.Duration, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("expected 3 arguments for %s, got %d", generator, len(args))
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(args[2]))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("expected a positive bucket count, got %s", args[2])
+	}
+	first, err := time.ParseDuration(strings.TrimSpace(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	switch generator {
+	case "linear":
+		max, err := time.ParseDuration(strings.TrimSpace(args[1]))
+		if err != nil {
+			return nil, err
+		}
+		if max <= first {
+			return nil, fmt.Errorf("expected max above min, got %s to %s", first, max)
+		}
+		return LinearBuckets(first, max, count), nil
+	case "exp":
+		factor, err := strconv.ParseFloat(strings.TrimSpace(args[1]), 64)
+		if err != nil || factor <= 1 {
+			return nil, fmt.Errorf("expected a factor above 1, got %s", args[1])
+		}
+		if first <= 0 {
+			return nil, fmt.Errorf("expected a start above zero, got %s", first)
+		}
+		return ExponentialBuckets(first, factor, count), nil
+	}
+	return nil, fmt.Errorf("unknown generator %s, expected linear or exp", generator)
+}
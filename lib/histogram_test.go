@@ -1,6 +1,7 @@
 package korra
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -28,3 +29,91 @@ func TestHistogram(t *testing.T) {
 		}
 	}
 }
+
+func TestSizeHistogram(t *testing.T) {
+	var buckets SizeHistogramReporter
+	if err := buckets.Set("[0,1KB,10KB,1.5MB]"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "[0,1024,10240,1572864]", buckets.String(); want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+	results := Results{
+		{BytesIn: 10},
+		{BytesIn: 2048},
+		{BytesIn: 1 << 20},
+		{BytesIn: 10 << 20},
+	}
+	for _, count := range SizeHistogram(buckets, results) {
+		if want, got := uint64(1), count; want != got {
+			t.Fatalf("want: %d, got: %d", want, got)
+		}
+	}
+	if want, got := "10KB", formatBytes(10240); want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+	if err := buckets.Set("[0,lots]"); err == nil {
+		t.Fatal("want: error for a bad size")
+	}
+}
+
+func TestGeneratedBuckets(t *testing.T) {
+	for spec, want := range map[string]string{
+		"[linear:0,100ms,4]":   "[0,25000000,50000000,75000000,100000000]",
+		"[exp:10ms,2,4]":       "[0,10000000,20000000,40000000,80000000]",
+		"[0,10ms,1s]":          "[0,10000000,1000000000]",
+		"[linear:50ms,60ms,1]": "[50000000,60000000]",
+	} {
+		var hist HistogramReporter
+		if err := hist.Set(spec); err != nil {
+			t.Fatal(err)
+		}
+		if got := hist.String(); want != got {
+			t.Fatalf("%s; want: %s, got: %s", spec, want, got)
+		}
+	}
+	for _, spec := range []string{"[linear:0,100ms]", "[linear:1s,1ms,4]", "[exp:0,2,4]", "[exp:1ms,1,4]", "[log:1ms,2,4]"} {
+		var hist HistogramReporter
+		if err := hist.Set(spec); err == nil {
+			t.Fatalf("%s; want: error", spec)
+		}
+	}
+}
+
+func TestQuantileBuckets(t *testing.T) {
+	var results Results
+	for i := 1; i <= 100; i++ {
+		results = append(results, &Result{Latency: time.Duration(i) * time.Millisecond})
+	}
+	buckets := QuantileBuckets(results, 4)
+	if want, got := "[0,26000000,51000000,76000000]", HistogramReporter(buckets).String(); want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+	for i, count := range Histogram(buckets, results) {
+		if want := uint64(25); count != want {
+			t.Fatalf("bucket %d; want: %d, got: %d", i, want, count)
+		}
+	}
+}
+
+func TestHistogramStyleBar(t *testing.T) {
+	for _, tc := range []struct {
+		style HistogramStyle
+		count uint64
+		want  string
+	}{
+		{HistogramStyle{}, 0, ""},
+		{HistogramStyle{}, 1, ""},
+		{HistogramStyle{}, 500, strings.Repeat("#", 37)},
+		{HistogramStyle{Log: true}, 1, strings.Repeat("#", 7)},
+		{HistogramStyle{Log: true}, 1000, strings.Repeat("#", 75)},
+		{HistogramStyle{Unicode: true}, 0, ""},
+		{HistogramStyle{Unicode: true}, 1, "▏"},
+		{HistogramStyle{Unicode: true}, 500, strings.Repeat("█", 37) + "▌"},
+		{HistogramStyle{Log: true, Unicode: true}, 1, strings.Repeat("█", 7) + "▌"},
+	} {
+		if got := tc.style.bar(tc.count, 1000); tc.want != got {
+			t.Errorf("%+v with %d of 1000; want: %q, got: %q", tc.style, tc.count, tc.want, got)
+		}
+	}
+}
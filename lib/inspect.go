@@ -0,0 +1,46 @@
+package korra
+
+import (
+	"io"
+	"time"
+)
+
+// ResultFileInfo is what InspectResults finds in a result file
+type ResultFileInfo struct {
+	Metadata *Metadata // nil if the file is from before result files had it
+	Format   int       // see ResultFormat
+	Records  int       // how many results, not counting the metadata
+	First    time.Time // when the earliest result started
+	Last     time.Time // when the latest result started
+	Err      error     // what kept the file from being read to its end; nil if it's intact
+
+	Checkpoints int // how many of the file's checkpoints were verified
+}
+
+// InspectResults reads a result file to its end, or as far as it can, and
+// returns what it found.
+func InspectResults(in io.Reader) ResultFileInfo {
+	info := ResultFileInfo{Format: 1}
+	dec := newResultDecoder(in)
+	for {
+		var r Result
+		if err := dec.Decode(&r); err != nil {
+			if err != io.EOF {
+				info.Err = err
+			}
+			info.Checkpoints = dec.checkpoints
+			return info
+		}
+		if r.Metadata != nil {
+			info.Metadata, info.Format = r.Metadata, r.Metadata.Format
+			continue
+		}
+		info.Records++
+		if info.First.IsZero() || r.Timestamp.Before(info.First) {
+			info.First = r.Timestamp
+		}
+		if r.Timestamp.After(info.Last) {
+			info.Last = r.Timestamp
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package korra
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// checkpointEvery is how many results are written between the checkpoints
+// of a result file
+const checkpointEvery = 1000
+
+// castagnoli is the CRC-32C table, which most CPUs compute in hardware
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Checkpoint is a record written into a result file every so many results
+// and as its last, with the CRC-32C of every byte of the file before it.
+// Reading the file, each is checked against what was read, so a file that's
+// been damaged, or cut short by a crashed or killed host before its final
+// checkpoint, is found out rather than reported on as if it were whole.
+type Checkpoint struct {
+	Records int    // how many results came before it
+	Sum     uint32 // the CRC-32C of the file up to it
+	Final   bool   // written as the file was closed, so nothing's missing
+}
+
+// summingWriter keeps the CRC-32C of everything written through it
+type summingWriter struct {
+	w   io.Writer
+	sum uint32
+}
+
+func (s *summingWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.sum = crc32.Update(s.sum, castagnoli, p[:n])
+	return n, err
+}
+
+// resultEncoder encodes records to a result file, with a checkpoint every
+// checkpointEvery results and a final one when it's finished
+type resultEncoder struct {
+	enc     *gob.Encoder
+	out     *summingWriter
+	records int
+}
+
+func newResultEncoder(out io.Writer) *resultEncoder {
+	summed := &summingWriter{w: out}
+	return &resultEncoder{enc: gob.NewEncoder(summed), out: summed}
+}
+
+func (e *resultEncoder) Encode(r *Result) error {
+	if err := e.enc.Encode(r); err != nil {
+		return err
+	}
+	if r.Metadata != nil {
+		return nil
+	}
+	if e.records++; e.records%checkpointEvery == 0 {
+		return e.checkpoint(false)
+	}
+	return nil
+}
+
+// finish writes the final checkpoint
+func (e *resultEncoder) finish() error {
+	return e.checkpoint(true)
+}
+
+func (e *resultEncoder) checkpoint(final bool) error {
+	return e.enc.Encode(&Result{Checkpoint: &Checkpoint{Records: e.records, Sum: e.out.sum, Final: final}})
+}
+
+// ErrUnfinished is what reading a result file that ends without its final
+// checkpoint returns, wrapped with how far it got: the file was cut short,
+// or is still being recorded. The results read before it are whole, so like
+// io.ErrUnexpectedEOF, which it also is, it means there's no more to read
+// rather than that what was read is wrong.
+var ErrUnfinished = errors.New("results end without a final checkpoint")
+
+// unfinishedError is ErrUnfinished for a file cut short after records results
+type unfinishedError struct {
+	records int
+}
+
+func (e unfinishedError) Error() string {
+	return fmt.Sprintf("%s, cut short after %d", ErrUnfinished, e.records)
+}
+
+func (e unfinishedError) Is(target error) bool {
+	return target == ErrUnfinished || target == io.ErrUnexpectedEOF
+}
+
+// byteReader is a reader gob decodes from without buffering it
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// summingReader keeps the CRC-32C of everything read through it. Being an
+// io.ByteReader, a gob.Decoder reads it without buffering ahead, so no
+// further than the record it's decoding and the sum is of the records
+// decoded so far.
+type summingReader struct {
+	r   byteReader
+	sum uint32
+	one [1]byte
+}
+
+func (s *summingReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.sum = crc32.Update(s.sum, castagnoli, p[:n])
+	return n, err
+}
+
+func (s *summingReader) ReadByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err == nil {
+		s.one[0] = b
+		s.sum = crc32.Update(s.sum, castagnoli, s.one[:])
+	}
+	return b, err
+}
+
+// resultDecoder decodes the records of a result file, checking and
+// skipping its checkpoints. A file whose metadata says it has them, or that
+// has had one, has to end with a final one; files from before there were
+// checkpoints are read as they are.
+type resultDecoder struct {
+	dec         *gob.Decoder
+	in          *summingReader
+	records     int
+	checked     int // the results up to the last checkpoint
+	checkpoints int
+	expected    bool // a final checkpoint
+	final       bool // the last record was it
+}
+
+// newResultDecoder returns a decoder of the input, buffering it unless it's
+// an io.ByteReader already, like a file mapped into memory (see OpenResults)
+func newResultDecoder(in io.Reader) *resultDecoder {
+	r, ok := in.(byteReader)
+	if !ok {
+		r = bufio.NewReader(in)
+	}
+	summed := &summingReader{r: r}
+	return &resultDecoder{dec: gob.NewDecoder(summed), in: summed}
+}
+
+// Decode decodes the next result, or metadata, into r, which must be zero.
+// It returns io.EOF at the end of a file that's whole, and an error for one
+// that isn't.
+func (d *resultDecoder) Decode(r *Result) error {
+	for {
+		sum := d.in.sum
+		if err := d.dec.Decode(r); err != nil {
+			if err == io.EOF && d.expected && !d.final {
+				// once: reading on, it's the end like any other
+				d.expected = false
+				return unfinishedError{d.records}
+			}
+			return err
+		}
+		d.final = false
+		checkpoint := r.Checkpoint
+		if checkpoint == nil {
+			if r.Metadata == nil {
+				d.records++
+			} else if r.Metadata.Format >= 3 {
+				d.expected = true
+			}
+			return nil
+		}
+		if checkpoint.Sum != sum || checkpoint.Records != d.records {
+			return fmt.Errorf("results don't match checkpoint %d: damaged between results %d and %d",
+				d.checkpoints+1, d.checked, d.records)
+		}
+		d.checked = d.records
+		d.checkpoints++
+		d.expected, d.final = true, checkpoint.Final
+		*r = Result{}
+	}
+}
@@ -0,0 +1,84 @@
+package korra
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkpointedFile returns a result file of n results with its checkpoints,
+// and its length before the final one
+func checkpointedFile(t *testing.T, n int) ([]byte, int) {
+	var buf bytes.Buffer
+	enc := newResultEncoder(&buf)
+	if err := enc.Encode(&Result{Metadata: NewMetadata(1, map[string]string{})}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		if err := enc.Encode(&Result{Code: 200, Path: fmt.Sprintf("/item/%04d", i), Timestamp: start.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results := buf.Len()
+	if err := enc.finish(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), results
+}
+
+// decodeAll decodes the file to its end, returning how many results it
+// had and what stopped it, if anything but the end
+func decodeAll(file []byte) (int, *resultDecoder, error) {
+	dec := newResultDecoder(bytes.NewReader(file))
+	count := 0
+	for {
+		var r Result
+		if err := dec.Decode(&r); err == io.EOF {
+			return count, dec, nil
+		} else if err != nil {
+			return count, dec, err
+		}
+		if r.Checkpoint != nil {
+			return count, dec, fmt.Errorf("want checkpoints skipped, got %+v", r.Checkpoint)
+		}
+		if r.Metadata == nil {
+			count++
+		}
+	}
+}
+
+func TestCheckpoints(t *testing.T) {
+	file, results := checkpointedFile(t, 2500)
+	count, dec, err := decodeAll(file)
+	if err != nil || count != 2500 || dec.checkpoints != 3 {
+		t.Fatalf("want 2500 results and 3 checkpoints, got %d and %d: %v", count, dec.checkpoints, err)
+	}
+	if _, direct := dec.in.r.(*bytes.Reader); !direct {
+		t.Errorf("want a bytes.Reader decoded from directly, got it buffered in a %T", dec.in.r)
+	}
+
+	damaged := bytes.Replace(file, []byte("/item/1500"), []byte("/item/9500"), 1)
+	if _, _, err := decodeAll(damaged); err == nil || !strings.Contains(err.Error(), "between results 1000 and 2000") {
+		t.Fatalf("want the damage found between checkpoints, got %v", err)
+	}
+
+	count, _, err = decodeAll(file[:results])
+	if err == nil || !strings.Contains(err.Error(), "cut short") || count != 2500 {
+		t.Fatalf("want a file without its final checkpoint cut short, got %d: %v", count, err)
+	}
+}
+
+func TestCheckpointsOptional(t *testing.T) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	enc.Encode(&Result{Metadata: &Metadata{Format: 2}})
+	enc.Encode(&Result{Code: 200})
+	if count, _, err := decodeAll(buf.Bytes()); err != nil || count != 1 {
+		t.Fatalf("want a file from before checkpoints read as it is, got %d: %v", count, err)
+	}
+}
@@ -0,0 +1,128 @@
+package korra
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// kneeLevels is the most concurrency levels a knee curve is split into
+const kneeLevels = 20
+
+// ConcurrencyLevel is how the target held up over the windows of an attack
+// with about the same number of requests in flight, the mean over each
+// window of how many were: the attack's concurrency, as the target saw it.
+type ConcurrencyLevel struct {
+	From, To   float64 // the mean requests in flight of its windows
+	Windows    int
+	Results    int
+	Throughput float64 // results started per second
+	P50, P99   time.Duration
+}
+
+// KneeCurve splits the results into windows of the width, figures how many
+// requests were in flight in each, and groups the windows into levels of
+// that concurrency, lowest first. As a test ramps its load up, throughput
+// should climb with concurrency until the target saturates -- the knee --
+// past which only latency does. Windows with nothing in flight, like those
+// an attack spent paused, are left out.
+func KneeCurve(r Results, window time.Duration) []ConcurrencyLevel {
+	if len(r) == 0 || window <= 0 {
+		return nil
+	}
+	span := spanOf(r)
+	count := int(span.end.Sub(span.start)/window) + 1
+	busy := make([]time.Duration, count) // time spent in flight, by all the requests of a window
+	started := make([]Results, count)
+	for _, result := range r {
+		from, to := result.Timestamp.Sub(span.start), result.Timestamp.Add(result.Latency).Sub(span.start)
+		started[from/window] = append(started[from/window], result)
+		for idx := from / window; idx <= to/window && int(idx) < count; idx++ {
+			start, end := idx*window, (idx+1)*window
+			if from > start {
+				start = from
+			}
+			if to < end {
+				end = to
+			}
+			busy[idx] += (end - start) * time.Duration(result.weight())
+		}
+	}
+
+	var (
+		inFlight = make([]float64, count)
+		most     float64
+	)
+	for idx := range busy {
+		if inFlight[idx] = float64(busy[idx]) / float64(window); inFlight[idx] > most {
+			most = inFlight[idx]
+		}
+	}
+	if most == 0 {
+		return nil
+	}
+	// levels are a request in flight wide until there are too many of them
+	width := math.Max(1, math.Ceil(most/kneeLevels))
+	byLevel := make([]Results, int(most/width)+1)
+	windows := make([]int, len(byLevel))
+	for idx, concurrency := range inFlight {
+		if concurrency == 0 {
+			continue
+		}
+		level := int(concurrency / width)
+		byLevel[level] = append(byLevel[level], started[idx]...)
+		windows[level]++
+	}
+
+	var levels []ConcurrencyLevel
+	for level, results := range byLevel {
+		if windows[level] == 0 {
+			continue
+		}
+		m := NewMetrics(results)
+		levels = append(levels, ConcurrencyLevel{
+			From:       float64(level) * width,
+			To:         float64(level+1) * width,
+			Windows:    windows[level],
+			Results:    results.Count(),
+			Throughput: float64(results.Count()) / (float64(windows[level]) * window.Seconds()),
+			P50:        m.Latencies.P50,
+			P99:        m.Latencies.P99,
+		})
+	}
+	return levels
+}
+
+// KneeReporter tabulates the KneeCurve of the results over windows of its
+// width, with a bar for each level's throughput against the highest.
+type KneeReporter time.Duration
+
+// DefaultKneeWindow is the window width of a KneeReporter without one
+const DefaultKneeWindow = KneeReporter(time.Second)
+
+// Report implements the Reporter interface.
+func (k KneeReporter) Report(r Results) ([]byte, error) {
+	var (
+		buf    bytes.Buffer
+		levels = KneeCurve(r, time.Duration(k))
+		most   float64
+	)
+	for _, level := range levels {
+		most = math.Max(most, level.Throughput)
+	}
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', tabwriter.StripEscape)
+	fmt.Fprintf(w, "In flight\t\tWindows\tResults\tReq/s\tP50\tP99\tThroughput\n")
+	for _, level := range levels {
+		bar := ""
+		if most > 0 {
+			bar = strings.Repeat("#", int(level.Throughput/most*histogramWidth/2))
+		}
+		fmt.Fprintf(w, "[%g,\t%g)\t%d\t%d\t%.2f\t%s\t%s\t%s\n",
+			level.From, level.To, level.Windows, level.Results, level.Throughput, level.P50, level.P99, bar)
+	}
+	err := w.Flush()
+	return buf.Bytes(), err
+}
@@ -0,0 +1,65 @@
+package korra
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKneeCurve(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	var r Results
+	// ten seconds with a request always in flight, then ten with four; the
+	// target only manages twice the throughput, so latency doubles
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			at := start.Add(time.Duration(i)*time.Second + time.Duration(j)*100*time.Millisecond)
+			r = append(r, &Result{Timestamp: at, Latency: 100 * time.Millisecond})
+		}
+	}
+	for i := 10; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			at := start.Add(time.Duration(i)*time.Second + time.Duration(j)*50*time.Millisecond)
+			r = append(r, &Result{Timestamp: at, Latency: 200 * time.Millisecond})
+		}
+	}
+
+	levels := KneeCurve(r, time.Second)
+	if len(levels) != 4 {
+		t.Fatalf("want 4 levels, got: %+v", levels)
+	}
+	// the requests started at the end of each of the busy windows spill
+	// into the next, so the first has fewer in flight and there's a window
+	// after with only that tail end
+	tail, low, first, high := levels[0], levels[1], levels[2], levels[3]
+	if tail.From != 0 || tail.Windows != 1 || tail.Results != 0 {
+		t.Fatalf("tail level: %+v", tail)
+	}
+	if low.From != 1 || low.Windows != 10 || low.Results != 100 || low.Throughput != 10 {
+		t.Fatalf("low level: %+v", low)
+	}
+	if want, got := 100*time.Millisecond, low.P99; want != got {
+		t.Fatalf("low P99; want: %s, got: %s", want, got)
+	}
+	if first.From != 3 || first.Windows != 1 || first.Results != 20 {
+		t.Fatalf("first busy level: %+v", first)
+	}
+	if high.From != 4 || high.Windows != 9 || high.Throughput != 20 {
+		t.Fatalf("high level: %+v", high)
+	}
+	if want, got := 200*time.Millisecond, high.P99; want != got {
+		t.Fatalf("high P99; want: %s, got: %s", want, got)
+	}
+
+	report, err := KneeReporter(time.Second).Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(report)), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[4], "[4,") || !strings.HasSuffix(lines[4], strings.Repeat("#", histogramWidth/2)) {
+		t.Fatalf("bad report:\n%s", report)
+	}
+	if KneeCurve(nil, time.Second) != nil {
+		t.Fatal("expected no levels without results")
+	}
+}
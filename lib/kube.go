@@ -0,0 +1,255 @@
+package korra
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// KubeInCluster is given as the API to watch the cluster korra is running
+// in, with the service account of its pod
+const KubeInCluster = "in-cluster"
+
+// kubeServiceAccount is where a pod's service account is mounted
+const kubeServiceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubeWatch watches the target's pods and horizontal pod autoscalers through
+// the Kubernetes API while an attack runs, turning what changes into
+// annotations: pods created and deleted, containers restarting (OOMKills
+// included), and autoscalers scaling. It polls rather than watches, so it
+// needs nothing more than list access, and kubectl proxy will do.
+type KubeWatch struct {
+	API       string // the API server's base URL, like http://localhost:8001 from kubectl proxy
+	Namespace string
+	Selector  string // of the pods to watch, like app=api; all in the namespace if empty
+	Every     time.Duration
+
+	client    http.Client
+	tokenFile string // the service account's, if in the cluster
+
+	polled bool
+	pods   map[string]kubePod
+	scales map[string]int32 // each autoscaler's desired replicas
+}
+
+// NewKubeWatch watches the pods matching the selector, and the autoscalers,
+// in the namespace through the API, or with KubeInCluster the cluster korra
+// runs in, defaulting to its own namespace.
+func NewKubeWatch(api, namespace, selector string, every time.Duration) (*KubeWatch, error) {
+	if every <= 0 {
+		return nil, fmt.Errorf("bad Kubernetes poll interval: %s", every)
+	}
+	w := &KubeWatch{API: strings.TrimSuffix(api, "/"), Namespace: namespace, Selector: selector, Every: every,
+		client: http.Client{Timeout: every}}
+	if api == KubeInCluster {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in a Kubernetes cluster")
+		}
+		ca, err := ioutil.ReadFile(path.Join(kubeServiceAccount, "ca.crt"))
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("bad cluster CA in %s", kubeServiceAccount)
+		}
+		w.API = "https://" + net.JoinHostPort(host, port)
+		w.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+		w.tokenFile = path.Join(kubeServiceAccount, "token")
+		if w.Namespace == "" {
+			own, err := ioutil.ReadFile(path.Join(kubeServiceAccount, "namespace"))
+			if err != nil {
+				return nil, err
+			}
+			w.Namespace = strings.TrimSpace(string(own))
+		}
+	}
+	if w.Namespace == "" {
+		w.Namespace = "default"
+	}
+	return w, nil
+}
+
+// kubePod is what's watched of a pod
+type kubePod struct {
+	Metadata struct {
+		Name              string    `json:"name"`
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	Status struct {
+		ContainerStatuses []struct {
+			Name         string `json:"name"`
+			RestartCount int32  `json:"restartCount"`
+			LastState    struct {
+				Terminated *struct {
+					Reason     string    `json:"reason"`
+					ExitCode   int32     `json:"exitCode"`
+					FinishedAt time.Time `json:"finishedAt"`
+				} `json:"terminated"`
+			} `json:"lastState"`
+		} `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// restarts returns each container's restart count, by name
+func (p kubePod) restarts() map[string]int32 {
+	counts := map[string]int32{}
+	for _, c := range p.Status.ContainerStatuses {
+		counts[c.Name] = c.RestartCount
+	}
+	return counts
+}
+
+// kubeScaler is what's watched of a horizontal pod autoscaler
+type kubeScaler struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Status struct {
+		CurrentReplicas int32      `json:"currentReplicas"`
+		DesiredReplicas int32      `json:"desiredReplicas"`
+		LastScaleTime   *time.Time `json:"lastScaleTime"`
+	} `json:"status"`
+}
+
+// Poll lists the pods and autoscalers, returning annotations for what
+// changed since the last poll; the first poll only takes stock.
+func (w *KubeWatch) Poll(now time.Time) ([]Annotation, error) {
+	var pods struct {
+		Items []kubePod `json:"items"`
+	}
+	query := url.Values{}
+	if w.Selector != "" {
+		query.Set("labelSelector", w.Selector)
+	}
+	if err := w.list("/api/v1/namespaces/"+w.Namespace+"/pods", query, &pods); err != nil {
+		return nil, err
+	}
+	var scalers struct {
+		Items []kubeScaler `json:"items"`
+	}
+	if err := w.list("/apis/autoscaling/v2/namespaces/"+w.Namespace+"/horizontalpodautoscalers", nil, &scalers); err != nil {
+		return nil, err
+	}
+
+	by := "kubernetes " + w.Namespace
+	var annotations []Annotation
+	pod := map[string]kubePod{}
+	for _, p := range pods.Items {
+		name := p.Metadata.Name
+		pod[name] = p
+		before, seen := w.pods[name]
+		if !seen {
+			if w.polled {
+				annotations = append(annotations, Annotation{Timestamp: p.Metadata.CreationTimestamp, By: by,
+					Text: fmt.Sprintf("pod %s created", name)})
+			}
+			continue
+		}
+		counted := before.restarts()
+		for _, c := range p.Status.ContainerStatuses {
+			if c.RestartCount <= counted[c.Name] {
+				continue
+			}
+			text := fmt.Sprintf("pod %s container %s restarted", name, c.Name)
+			at := now
+			if t := c.LastState.Terminated; t != nil {
+				text = fmt.Sprintf("%s: %s (exit %d)", text, firstOf(t.Reason, "Terminated"), t.ExitCode)
+				if !t.FinishedAt.IsZero() {
+					at = t.FinishedAt
+				}
+			}
+			annotations = append(annotations, Annotation{Timestamp: at, Text: text, By: by})
+		}
+	}
+	for name := range w.pods {
+		if _, ok := pod[name]; !ok {
+			annotations = append(annotations, Annotation{Timestamp: now, Text: fmt.Sprintf("pod %s deleted", name), By: by})
+		}
+	}
+
+	scales := map[string]int32{}
+	for _, s := range scalers.Items {
+		name, desired := s.Metadata.Name, s.Status.DesiredReplicas
+		scales[name] = desired
+		if before, seen := w.scales[name]; seen && desired != before {
+			at := now
+			if s.Status.LastScaleTime != nil {
+				at = *s.Status.LastScaleTime
+			}
+			annotations = append(annotations, Annotation{Timestamp: at, By: by,
+				Text: fmt.Sprintf("autoscaler %s scaling from %d to %d replicas", name, before, desired)})
+		}
+	}
+
+	w.polled, w.pods, w.scales = true, pod, scales
+	sort.Stable(Annotations(annotations))
+	return annotations, nil
+}
+
+// list gets the list of objects at the path, into the value; a kind the
+// cluster doesn't serve is an empty list
+func (w *KubeWatch) list(at string, query url.Values, v interface{}) error {
+	u := w.API + at
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	if w.tokenFile != "" {
+		// service account tokens are rotated, so read it every time
+		token, err := ioutil.ReadFile(w.tokenFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(resp.Body).Decode(v)
+	case http.StatusNotFound:
+		return nil
+	}
+	return fmt.Errorf("%s answered %s", u, resp.Status)
+}
+
+// Run polls until stopped, adding what changed to the annotations and
+// logging it, and logging polls that fail
+func (w *KubeWatch) Run(stop <-chan struct{}, notes *AnnotationLog, log chan string) {
+	ticker := time.NewTicker(w.Every)
+	defer ticker.Stop()
+	for now := time.Now(); ; {
+		annotations, err := w.Poll(now)
+		if err != nil {
+			log <- fmt.Sprintf("Kubernetes poll failed: %s", err)
+		}
+		for _, annotation := range annotations {
+			if annotation, err = notes.Add(annotation); err == nil {
+				log <- fmt.Sprintf("Annotated by %s: %s", annotation.By, annotation.Text)
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case now = <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package korra
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKubeWatch(t *testing.T) {
+	// the cluster as each poll finds it: on the second api-2 is OOMKilled and
+	// the autoscaler adds a pod, on the third api-1 is gone
+	pods := []string{
+		`{"items": [
+			{"metadata": {"name": "api-1"}, "status": {"containerStatuses": [{"name": "app", "restartCount": 0}]}},
+			{"metadata": {"name": "api-2"}, "status": {"containerStatuses": [{"name": "app", "restartCount": 1}]}}]}`,
+		`{"items": [
+			{"metadata": {"name": "api-1"}, "status": {"containerStatuses": [{"name": "app", "restartCount": 0}]}},
+			{"metadata": {"name": "api-2"}, "status": {"containerStatuses": [{"name": "app", "restartCount": 2,
+				"lastState": {"terminated": {"reason": "OOMKilled", "exitCode": 137, "finishedAt": "2026-10-15T15:47:02Z"}}}]}},
+			{"metadata": {"name": "api-3", "creationTimestamp": "2026-10-15T15:47:05Z"}, "status": {}}]}`,
+		`{"items": [
+			{"metadata": {"name": "api-2"}, "status": {"containerStatuses": [{"name": "app", "restartCount": 2}]}},
+			{"metadata": {"name": "api-3"}, "status": {}}]}`,
+	}
+	scalers := []string{
+		`{"items": [{"metadata": {"name": "api"}, "status": {"currentReplicas": 2, "desiredReplicas": 2}}]}`,
+		`{"items": [{"metadata": {"name": "api"}, "status": {"currentReplicas": 2, "desiredReplicas": 3, "lastScaleTime": "2026-10-15T15:47:04Z"}}]}`,
+		`{"items": [{"metadata": {"name": "api"}, "status": {"currentReplicas": 3, "desiredReplicas": 2, "lastScaleTime": "2026-10-15T15:49:00Z"}}]}`,
+	}
+	var poll int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.LoadInt32(&poll)
+		switch r.URL.Path {
+		case "/api/v1/namespaces/shop/pods":
+			if r.URL.Query().Get("labelSelector") != "app=api" {
+				t.Errorf("want the selector, got %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, pods[n])
+		case "/apis/autoscaling/v2/namespaces/shop/horizontalpodautoscalers":
+			fmt.Fprint(w, scalers[n])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	watch, err := NewKubeWatch(server.URL+"/", "shop", "app=api", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 15, 15, 50, 0, 0, time.UTC)
+	at := func(minute, second int) time.Time { return time.Date(2026, 10, 15, 15, minute, second, 0, time.UTC) }
+	for i, want := range [][]Annotation{
+		nil,
+		{{at(47, 2), "pod api-2 container app restarted: OOMKilled (exit 137)", "kubernetes shop"},
+			{at(47, 4), "autoscaler api scaling from 2 to 3 replicas", "kubernetes shop"},
+			{at(47, 5), "pod api-3 created", "kubernetes shop"}},
+		{{at(49, 0), "autoscaler api scaling from 3 to 2 replicas", "kubernetes shop"},
+			{now, "pod api-1 deleted", "kubernetes shop"}},
+	} {
+		atomic.StoreInt32(&poll, int32(i))
+		got, err := watch.Poll(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("poll %d: want %d annotations, got: %+v", i, len(want), got)
+		}
+		for j, a := range got {
+			if a.Text != want[j].Text || a.By != want[j].By || !a.Timestamp.Equal(want[j].Timestamp) {
+				t.Errorf("poll %d: want %+v, got %+v", i, want[j], a)
+			}
+		}
+	}
+
+	// a cluster without the autoscaling API has no autoscalers to watch
+	watch, err = NewKubeWatch(server.URL, "nowhere", "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := watch.Poll(now); err != nil || len(got) != 0 {
+		t.Fatalf("want nothing in a namespace that isn't there, got: %+v %v", got, err)
+	}
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer broken.Close()
+	if watch, err = NewKubeWatch(broken.URL, "", "", time.Second); err != nil || watch.Namespace != "default" {
+		t.Fatalf("want the default namespace, got: %+v %v", watch, err)
+	}
+	if _, err = watch.Poll(now); err == nil {
+		t.Error("want an error without access to the pods")
+	}
+}
@@ -0,0 +1,463 @@
+package korra
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// the ways a KV step spreads its commands across its keys
+const (
+	KVUniform = "uniform" // every key as likely as the next
+	KVZipf    = "zipf"    // a few hot keys and a long tail, as caches see
+)
+
+// the protocols a KV step speaks, by the scheme of its URL
+const (
+	kvRedis     = "redis"
+	kvMemcached = "memcached"
+)
+
+// KVConfig defines the mix of commands a KV step sends a Redis or Memcached
+// server: Requests of them, Gets percent GETs and the rest SETs of Size-byte
+// values, each to one of Keys keys spread by Spread.
+type KVConfig struct {
+	Requests int     // commands to send
+	Gets     int     // percentage of the commands that are GETs
+	Keys     int     // distinct keys to pick from
+	Spread   string  // KVUniform or KVZipf
+	Skew     float64 // of a Zipfian spread: the higher, the hotter the hot keys
+	Size     uint64  // bytes in each value SET
+	Prefix   string  // of every key
+}
+
+func NewKVConfig() *KVConfig {
+	return &KVConfig{Requests: 1000, Gets: 90, Keys: 10000, Spread: KVZipf, Skew: 1.1, Size: 100, Prefix: "korra:"}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value ...]
+//
+// and fills itself from the parameters, as:
+//
+//   - requests: The number of commands to send (default: 1000)
+//   - gets: The percentage of them that are GETs, from 0 to 100; the rest
+//     are SETs (default: 90)
+//   - keys: The number of distinct keys (default: 10000)
+//   - spread: How the commands pick their keys, 'uniform' or 'zipf'
+//     (default: zipf)
+//   - skew: The exponent of a Zipfian spread, above 1 (default: 1.1)
+//   - size: The size of each value SET, in bytes or with a unit like 4KB
+//     (default: 100)
+//   - prefix: What every key starts with (default: korra:)
+func (config *KVConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for KV param, got: %s", piece)
+		}
+		value := strings.TrimSpace(param[1])
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "requests", "keys":
+			num, err := strconv.Atoi(value)
+			if err != nil || num <= 0 {
+				return fmt.Errorf("Expected positive int for KV param, got: %s", piece)
+			}
+			if strings.EqualFold(param[0], "requests") {
+				config.Requests = num
+			} else {
+				config.Keys = num
+			}
+		case "gets":
+			num, err := strconv.Atoi(value)
+			if err != nil || num < 0 || num > 100 {
+				return fmt.Errorf("Expected a percentage from 0 to 100 for KV param, got: %s", piece)
+			}
+			config.Gets = num
+		case "spread":
+			if value = strings.ToLower(value); value != KVUniform && value != KVZipf {
+				return fmt.Errorf("Expected %s or %s for KV spread, got: %s", KVUniform, KVZipf, value)
+			}
+			config.Spread = value
+		case "skew":
+			skew, err := strconv.ParseFloat(value, 64)
+			if err != nil || skew <= 1 {
+				return fmt.Errorf("Expected a number above 1 for KV param, got: %s", piece)
+			}
+			config.Skew = skew
+		case "size":
+			size, err := parseBytes(value)
+			if err != nil || size == 0 {
+				return fmt.Errorf("Expected positive size for KV param, got: %s", piece)
+			}
+			config.Size = size
+		case "prefix":
+			if len(value) > 200 {
+				return fmt.Errorf("Expected a KV prefix of at most 200 bytes, got %d", len(value))
+			}
+			config.Prefix = value
+		default:
+			return fmt.Errorf("Unknown KV param: %s", param[0])
+		}
+	}
+	return nil
+}
+
+func (config *KVConfig) String() string {
+	return fmt.Sprintf("[Requests=%d Gets=%d Keys=%d Spread=%s Skew=%g Size=%s Prefix=%s]",
+		config.Requests, config.Gets, config.Keys, config.Spread, config.Skew, formatBytes(config.Size), config.Prefix)
+}
+
+// parseKVURL checks the URL of a KV step: redis://[[user]:password@]host:port[/db]
+// or memcached://host:port
+func parseKVURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != kvRedis && u.Scheme != kvMemcached {
+		return nil, fmt.Errorf("Expected a %s:// or %s:// URL, got: %s", kvRedis, kvMemcached, raw)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("Expected a host and port, got: %s", raw)
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if _, err := strconv.Atoi(db); err != nil || u.Scheme != kvRedis {
+			return nil, fmt.Errorf("Expected a Redis database number as the path, got: %s", raw)
+		}
+	}
+	return u, nil
+}
+
+// kvClient is a connection to a server speaking one of the KV protocols;
+// get returns true for a hit. Errors the server answers with are
+// kvServerErrors, after which the connection can still be used.
+type kvClient interface {
+	get(key string) (bool, error)
+	set(key string, value []byte) error
+	counts() (in, out uint64)
+	SetDeadline(t time.Time) error
+	Close() error
+}
+
+// kvServerError is an error the server answered a command with
+type kvServerError string
+
+func (e kvServerError) Error() string {
+	return string(e)
+}
+
+// kvWire is a connection to a KV server, counting the bytes through it
+type kvWire struct {
+	net.Conn
+	reader *bufio.Reader
+	in     *countingReader
+	out    uint64
+}
+
+func newKVWire(conn net.Conn) *kvWire {
+	in := &countingReader{r: conn}
+	return &kvWire{Conn: conn, reader: bufio.NewReader(in), in: in}
+}
+
+func (w *kvWire) send(command []byte) error {
+	n, err := w.Write(command)
+	w.out += uint64(n)
+	return err
+}
+
+// line reads a line of the reply, without its \r\n
+func (w *kvWire) line() (string, error) {
+	line, err := w.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (w *kvWire) counts() (uint64, uint64) {
+	return uint64(w.in.n) - uint64(w.reader.Buffered()), w.out
+}
+
+// redisClient speaks RESP, the Redis protocol
+type redisClient struct {
+	*kvWire
+}
+
+func (c *redisClient) command(args ...[]byte) (string, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n", len(arg))
+		buf.Write(arg)
+		buf.WriteString("\r\n")
+	}
+	if err := c.send(buf.Bytes()); err != nil {
+		return "", err
+	}
+	return c.reply()
+}
+
+// reply reads a reply, returning the line that starts it and discarding any
+// bulk string that follows
+func (c *redisClient) reply() (string, error) {
+	line, err := c.line()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(line, "-"):
+		return line, kvServerError(line[1:])
+	case strings.HasPrefix(line, "$"):
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return line, fmt.Errorf("bad Redis reply: %s", line)
+		}
+		if size >= 0 {
+			if _, err := io.CopyN(io.Discard, c.reader, int64(size)+2); err != nil {
+				return line, err
+			}
+		}
+	case line == "" || !strings.ContainsAny(line[:1], "+:"):
+		return line, fmt.Errorf("unexpected Redis reply: %s", line)
+	}
+	return line, nil
+}
+
+func (c *redisClient) get(key string) (bool, error) {
+	line, err := c.command([]byte("GET"), []byte(key))
+	return err == nil && line != "$-1", err
+}
+
+func (c *redisClient) set(key string, value []byte) error {
+	_, err := c.command([]byte("SET"), []byte(key), value)
+	return err
+}
+
+// memcachedClient speaks the Memcached text protocol
+type memcachedClient struct {
+	*kvWire
+}
+
+// serverError returns the error a reply line is, if it's one
+func (c *memcachedClient) serverError(line string) error {
+	if line == "ERROR" || strings.HasPrefix(line, "CLIENT_ERROR") || strings.HasPrefix(line, "SERVER_ERROR") {
+		return kvServerError(line)
+	}
+	return fmt.Errorf("unexpected Memcached reply: %s", line)
+}
+
+func (c *memcachedClient) get(key string) (bool, error) {
+	if err := c.send([]byte("get " + key + "\r\n")); err != nil {
+		return false, err
+	}
+	hit := false
+	for {
+		line, err := c.line()
+		if err != nil {
+			return false, err
+		}
+		if line == "END" {
+			return hit, nil
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "VALUE" {
+			return false, c.serverError(line)
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("bad Memcached reply: %s", line)
+		}
+		if _, err := io.CopyN(io.Discard, c.reader, size+2); err != nil {
+			return false, err
+		}
+		hit = true
+	}
+}
+
+func (c *memcachedClient) set(key string, value []byte) error {
+	command := append([]byte(fmt.Sprintf("set %s 0 0 %d\r\n", key, len(value))), value...)
+	if err := c.send(append(command, '\r', '\n')); err != nil {
+		return err
+	}
+	line, err := c.line()
+	if err != nil || line == "STORED" {
+		return err
+	} else if line == "NOT_STORED" {
+		return kvServerError(line)
+	}
+	return c.serverError(line)
+}
+
+// dialKV connects to the server at the URL with the attacker's dialer,
+// logging in to a Redis server and selecting its database if the URL says to
+func (a *Attacker) dialKV(u *url.URL, timeouts Timeouts) (kvClient, error) {
+	connect := timeouts.Connect
+	if connect == 0 {
+		connect = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connect)
+	defer cancel()
+	conn, err := a.dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = ErrConnectTimeout
+		}
+		return nil, err
+	}
+	wire := newKVWire(conn)
+	if u.Scheme == kvMemcached {
+		return &memcachedClient{wire}, nil
+	}
+	c := &redisClient{wire}
+	conn.SetDeadline(time.Now().Add(connect))
+	defer conn.SetDeadline(time.Time{})
+	if password, ok := u.User.Password(); ok {
+		args := [][]byte{[]byte("AUTH"), []byte(password)}
+		if user := u.User.Username(); user != "" {
+			args = [][]byte{args[0], []byte(user), args[1]}
+		}
+		if _, err := c.command(args...); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("Redis AUTH failed: %s", err)
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" && db != "0" {
+		if _, err := c.command([]byte("SELECT"), []byte(db)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("Redis SELECT %s failed: %s", db, err)
+		}
+	}
+	return c, nil
+}
+
+// hitKV sends a GET, or a SET of the value if it isn't nil, for the key,
+// connecting first if client is nil. The result's code is 200 for a hit or
+// a value stored, 404 for a miss and 500 for an error the server answered
+// with; a connection that fails any other way is closed, and returned nil
+// for the next command to make a new one.
+func (a *Attacker) hitKV(client kvClient, tgt *Target, u *url.URL, key string, value []byte, tm time.Time, requestCount int) (kvClient, *Result) {
+	result := &Result{Timestamp: tm, RequestCount: requestCount, Method: "GET", Path: "/" + u.Scheme}
+	if value != nil {
+		result.Method = "SET"
+	}
+	var err error
+	defer func() {
+		result.Latency = time.Since(tm)
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}()
+	if a.limiters != nil {
+		release, ok := a.limiters.acquire(tgt, a.abort)
+		if !ok {
+			err = ErrLimitAborted
+			return client, result
+		}
+		defer release()
+		tm = time.Now()
+		result.Timestamp = tm
+	}
+	result.InFlight = int(atomic.AddInt64(&inFlight, 1))
+	defer atomic.AddInt64(&inFlight, -1)
+
+	timeouts := a.timeouts.Merge(tgt.Timeouts)
+	if client == nil {
+		if client, err = a.dialKV(u, timeouts); err != nil {
+			return nil, result
+		}
+	}
+	total := timeouts.Total
+	if total == 0 {
+		total = DefaultTimeout
+	}
+	client.SetDeadline(tm.Add(total))
+	in, out := client.counts()
+	hit := true
+	if value != nil {
+		err = client.set(key, value)
+	} else {
+		hit, err = client.get(key)
+	}
+	afterIn, afterOut := client.counts()
+	result.BytesIn, result.BytesOut = afterIn-in, afterOut-out
+
+	var serverErr kvServerError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &serverErr):
+		result.Code = 500
+	case err != nil:
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			err = ErrTotalTimeout
+		}
+		client.Close()
+		return nil, result
+	case hit:
+		result.Code = 200
+	default:
+		result.Code = 404
+	}
+	return client, result
+}
+
+// doKV sends the step's mix of commands to its server over a connection of
+// its own, each a result of its own with its number as the request count.
+func (session *Session) doKV(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	config := target.KV
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => KV %s %s", 200, target.URL, config))
+		return
+	}
+	u, err := parseKVURL(target.URL)
+	if err != nil {
+		result := &Result{Timestamp: time.Now(), Error: err.Error()}
+		result.PathFromURL(target.URL)
+		session.send(result)
+		return
+	}
+	rng := rand.New(rand.NewSource(session.attacker.random.Int63n(1 << 62)))
+	key := func() int { return rng.Intn(config.Keys) }
+	if config.Spread == KVZipf {
+		zipf := rand.NewZipf(rng, config.Skew, 1, uint64(config.Keys-1))
+		key = func() int { return int(zipf.Uint64()) }
+	}
+	value := bytes.Repeat([]byte("k"), int(config.Size))
+
+	var client kvClient
+	defer func() {
+		if client != nil {
+			client.Close()
+		}
+	}()
+	for requests := 1; requests <= config.Requests && !session.isAborted(); requests++ {
+		session.Gate.wait(session.aborted)
+		var set []byte
+		if rng.Intn(100) >= config.Gets {
+			set = value
+		}
+		var result *Result
+		client, result = session.attacker.hitKV(client, target, u, config.Prefix+strconv.Itoa(key()), set, time.Now(), requests)
+		if result.Error == ErrLimitAborted.Error() {
+			return
+		}
+		session.debug(fmt.Sprintf("%d => KV %s %s, %d/%d, %d ms",
+			result.Code, result.Method, u.Host, requests, config.Requests, int64(result.Latency/time.Millisecond)))
+		session.send(result)
+	}
+}
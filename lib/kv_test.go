@@ -0,0 +1,189 @@
+package korra
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestKVConfig(t *testing.T) {
+	action := &SessionAction{Raw: "KV redis://cache:6379/2\n[requests=50 gets=75 spread=uniform size=1KB]\n<Rate=100>", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	if got := action.Target.KV.String(); got != "[Requests=50 Gets=75 Keys=10000 Spread=uniform Skew=1.1 Size=1KB Prefix=korra:]" {
+		t.Fatalf("bad KV config: %s", got)
+	}
+	if !action.Target.Limit.Active() || action.Target.String() != "KV redis://cache:6379/2" {
+		t.Fatalf("want a limited KV step, got: %s", action.Target)
+	}
+	for _, bad := range []string{"KV http://cache:6379", "KV redis://cache", "KV memcached://cache:11211/1",
+		"KV redis://cache:6379\n[gets=101]", "KV redis://cache:6379\n[skew=1]", "KV redis://cache:6379\nAccept: */*"} {
+		action = &SessionAction{Raw: bad, Line: 1}
+		if err := action.CreateTarget("."); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+// kvServer answers the GETs and SETs of one of the KV protocols from a map,
+// keeping the commands it's sent
+type kvServer struct {
+	sync.Mutex
+	listener net.Listener
+	values   map[string]string
+	commands []string
+}
+
+func newKVServer(t *testing.T, memcached bool) *kvServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &kvServer{listener: listener, values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if memcached {
+				go s.memcached(conn)
+			} else {
+				go s.redis(conn)
+			}
+		}
+	}()
+	return s
+}
+
+func (s *kvServer) record(command string) {
+	s.Lock()
+	s.commands = append(s.commands, command)
+	s.Unlock()
+}
+
+func (s *kvServer) redis(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		var count int
+		if _, err := fmt.Fscanf(r, "*%d\r\n", &count); err != nil {
+			return
+		}
+		args := make([]string, count)
+		for i := range args {
+			var size int
+			fmt.Fscanf(r, "$%d\r\n", &size)
+			arg := make([]byte, size+2)
+			io.ReadFull(r, arg)
+			args[i] = string(arg[:size])
+		}
+		s.record(args[0] + " " + args[1])
+		s.Lock()
+		value, ok := s.values[args[1]]
+		switch {
+		case args[0] == "AUTH" && args[1] != "secret":
+			fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+		case args[0] == "GET" && !ok:
+			fmt.Fprint(conn, "$-1\r\n")
+		case args[0] == "GET":
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+		case args[0] == "SET":
+			s.values[args[1]] = args[2]
+			fmt.Fprint(conn, "+OK\r\n")
+		default:
+			fmt.Fprint(conn, "+OK\r\n")
+		}
+		s.Unlock()
+	}
+}
+
+func (s *kvServer) memcached(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		s.record(fields[0] + " " + fields[1])
+		s.Lock()
+		if fields[0] == "set" {
+			size, _ := strconv.Atoi(fields[4])
+			value := make([]byte, size+2)
+			io.ReadFull(r, value)
+			s.values[fields[1]] = string(value[:size])
+			fmt.Fprint(conn, "STORED\r\n")
+		} else if value, ok := s.values[fields[1]]; ok {
+			fmt.Fprintf(conn, "VALUE %s 0 %d\r\n%s\r\nEND\r\n", fields[1], len(value), value)
+		} else {
+			fmt.Fprint(conn, "END\r\n")
+		}
+		s.Unlock()
+	}
+}
+
+func TestKV(t *testing.T) {
+	for scheme, memcached := range map[string]bool{"redis": false, "memcached": true} {
+		server := newKVServer(t, memcached)
+		defer server.listener.Close()
+		auth := ""
+		if !memcached {
+			auth = ":secret@"
+		}
+		action := &SessionAction{Raw: fmt.Sprintf("KV %s://%s%s\n[requests=200 gets=50 keys=5 size=10]", scheme, auth, server.listener.Addr()), Line: 1}
+		if err := action.CreateTarget("."); err != nil {
+			t.Fatal(err)
+		}
+		// seeded, so which keys are set before they're got is the same every run
+		session := &Session{attacker: NewAttacker(Seed(1)), aborted: make(chan struct{}), results: make(chan *Result, 200)}
+		session.doKV(action)
+		close(session.results)
+
+		codes := map[string]int{}
+		requests := 0
+		for result := range session.results {
+			requests++
+			if result.Error != "" || result.Path != "/"+scheme || result.RequestCount != requests || result.BytesIn == 0 || result.BytesOut == 0 {
+				t.Fatalf("bad %s result: %+v", scheme, result)
+			}
+			if result.Method == "SET" {
+				codes["SET"] += int(result.Code) / 200
+			} else {
+				codes[strconv.Itoa(int(result.Code))]++
+			}
+		}
+		if requests != 200 || codes["200"] == 0 || codes["404"] == 0 || codes["200"]+codes["404"]+codes["SET"] != 200 {
+			t.Fatalf("want %s hits, misses and SETs, got: %v", scheme, codes)
+		}
+		server.Lock()
+		first := server.commands[0]
+		server.Unlock()
+		if !memcached && first != "AUTH secret" {
+			t.Fatalf("want the session logged in first, got: %s", first)
+		}
+	}
+
+	// a server that won't have the session fails every command
+	server := newKVServer(t, false)
+	defer server.listener.Close()
+	action := &SessionAction{Raw: fmt.Sprintf("KV redis://:wrong@%s\n[requests=3]", server.listener.Addr()), Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{attacker: NewAttacker(), aborted: make(chan struct{}), results: make(chan *Result, 3)}
+	session.doKV(action)
+	close(session.results)
+	for result := range session.results {
+		if result.Code != 0 || result.Error != "Redis AUTH failed: WRONGPASS invalid password" {
+			t.Fatalf("want the AUTH error, got: %+v", result)
+		}
+	}
+}
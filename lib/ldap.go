@@ -0,0 +1,583 @@
+package korra
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the protocols LDAP steps speak, by the scheme of their URL; the second is
+// over TLS from the start
+const (
+	ldapPlain = "ldap"
+	ldapTLS   = "ldaps"
+)
+
+// the operations each request of an LDAP step may do
+const (
+	LDAPBind   = "bind"
+	LDAPSearch = "search"
+)
+
+// ldapScopes are the scopes a search may have, by name
+var ldapScopes = map[string]byte{"base": 0, "one": 1, "sub": 2}
+
+// ldapResults are the names of the LDAP result codes, and the status codes
+// their results have so the reports count them as they do HTTP's; any other
+// result code is a 500.
+var ldapResults = map[int]struct {
+	name string
+	code uint16
+}{
+	0:  {"success", 200},
+	2:  {"protocolError", 400},
+	3:  {"timeLimitExceeded", 504},
+	4:  {"sizeLimitExceeded", 413},
+	7:  {"authMethodNotSupported", 501},
+	8:  {"strongerAuthRequired", 401},
+	10: {"referral", 302},
+	11: {"adminLimitExceeded", 429},
+	32: {"noSuchObject", 404},
+	34: {"invalidDNSyntax", 400},
+	48: {"inappropriateAuthentication", 401},
+	49: {"invalidCredentials", 401},
+	50: {"insufficientAccessRights", 403},
+	51: {"busy", 503},
+	52: {"unavailable", 503},
+	53: {"unwillingToPerform", 503},
+}
+
+// LDAPConfig defines what an LDAP step does: Requests requests, each doing
+// Ops in order, binding as DN with Password and searching under Base for
+// entries matching Filter.
+type LDAPConfig struct {
+	Requests   int
+	Ops        []string // LDAPBind and LDAPSearch, in the order to do them
+	DN         string   // the DN to bind as, anonymously if empty
+	Password   string
+	Base       string
+	Scope      string // base, one or sub
+	Filter     string
+	Attributes []string // the attributes to return, all if none
+}
+
+func NewLDAPConfig() *LDAPConfig {
+	return &LDAPConfig{Requests: 1, Ops: []string{LDAPSearch}, Scope: "sub", Filter: "(objectClass=*)"}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value ...]
+//
+// and fills itself from the parameters, as:
+//
+//   - requests: The number of requests to send (default: 1)
+//   - ops: The operations each request does, in order, separated by
+//     commas: bind, search or both (default: search)
+//   - dn: The DN to bind as (default: none, an anonymous bind)
+//   - password: The password to bind with (default: none)
+//   - base: The DN to search under (default: none, the root DSE)
+//   - scope: How deep to search under it: base, one or sub (default: sub)
+//   - filter: The filter for the entries to return (default: (objectClass=*))
+//   - attributes: The attributes to return, separated by commas (default:
+//     all)
+func (config *LDAPConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for LDAP param, got: %s", piece)
+		}
+		value := strings.TrimSpace(param[1])
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "requests":
+			num, err := strconv.Atoi(value)
+			if err != nil || num <= 0 {
+				return fmt.Errorf("Expected positive int for LDAP param, got: %s", piece)
+			}
+			config.Requests = num
+		case "ops":
+			config.Ops = nil
+			for _, op := range strings.Split(strings.ToLower(value), ",") {
+				if op != LDAPBind && op != LDAPSearch {
+					return fmt.Errorf("Expected %s or %s for LDAP op, got: %s", LDAPBind, LDAPSearch, op)
+				}
+				config.Ops = append(config.Ops, op)
+			}
+		case "dn":
+			config.DN = value
+		case "password":
+			config.Password = value
+		case "base":
+			config.Base = value
+		case "scope":
+			if _, ok := ldapScopes[strings.ToLower(value)]; !ok {
+				return fmt.Errorf("Expected base, one or sub for LDAP scope, got: %s", value)
+			}
+			config.Scope = strings.ToLower(value)
+		case "filter":
+			if _, err := ldapFilter(value); err != nil {
+				return fmt.Errorf("Bad LDAP filter '%s': %s", value, err)
+			}
+			config.Filter = value
+		case "attributes":
+			config.Attributes = strings.Split(value, ",")
+		default:
+			return fmt.Errorf("Unknown LDAP param: %s", param[0])
+		}
+	}
+	return nil
+}
+
+// binds returns true if each request binds
+func (config *LDAPConfig) binds() bool {
+	for _, op := range config.Ops {
+		if op == LDAPBind {
+			return true
+		}
+	}
+	return false
+}
+
+func (config *LDAPConfig) String() string {
+	s := fmt.Sprintf("[Requests=%d Ops=%s", config.Requests, strings.Join(config.Ops, ","))
+	if config.DN != "" {
+		s += " DN=" + config.DN
+	}
+	s += fmt.Sprintf(" Base=%s Scope=%s Filter=%s", config.Base, config.Scope, config.Filter)
+	if len(config.Attributes) > 0 {
+		s += " Attributes=" + strings.Join(config.Attributes, ",")
+	}
+	return s + "]"
+}
+
+// parseLDAPURL checks the URL of an LDAP step: ldap[s]://host:port
+func parseLDAPURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != ldapPlain && u.Scheme != ldapTLS {
+		return nil, fmt.Errorf("Expected a %s:// or %s:// URL, got: %s", ldapPlain, ldapTLS, raw)
+	}
+	if u.Port() == "" || strings.Trim(u.Path, "/") != "" {
+		return nil, fmt.Errorf("Expected a host and port, with no path, got: %s", raw)
+	}
+	return u, nil
+}
+
+// ber returns the BER encoding of the tag and content
+func ber(tag byte, content ...[]byte) []byte {
+	size := 0
+	for _, c := range content {
+		size += len(c)
+	}
+	out := []byte{tag}
+	if size < 0x80 {
+		out = append(out, byte(size))
+	} else {
+		var length []byte
+		for n := size; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		out = append(append(out, 0x80|byte(len(length))), length...)
+	}
+	for _, c := range content {
+		out = append(out, c...)
+	}
+	return out
+}
+
+// berInt returns the BER encoding of the integer with the tag, an INTEGER's
+// or an ENUMERATED's
+func berInt(tag byte, n int) []byte {
+	content := []byte{byte(n)}
+	for n >>= 8; n > 0; n >>= 8 {
+		content = append([]byte{byte(n)}, content...)
+	}
+	if content[0]&0x80 != 0 {
+		content = append([]byte{0}, content...)
+	}
+	return ber(tag, content)
+}
+
+// berString returns the BER encoding of an OCTET STRING, or of a string
+// with another tag
+func berString(tag byte, s string) []byte {
+	return ber(tag, []byte(s))
+}
+
+// berNext splits the next element off b, returning its tag, its content and
+// what's after it
+func berNext(b []byte) (byte, []byte, []byte, error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errors.New("LDAP message truncated")
+	}
+	tag, size, b := b[0], int(b[1]), b[2:]
+	if size&0x80 != 0 {
+		octets := size & 0x7f
+		if octets == 0 || octets > 3 || len(b) < octets {
+			return 0, nil, nil, errors.New("LDAP message has a bad length")
+		}
+		size = 0
+		for _, octet := range b[:octets] {
+			size = size<<8 | int(octet)
+		}
+		b = b[octets:]
+	}
+	if len(b) < size {
+		return 0, nil, nil, errors.New("LDAP message truncated")
+	}
+	return tag, b[:size], b[size:], nil
+}
+
+// berReadMessage reads the next LDAPMessage from r, returning its message
+// ID, and the tag and content of its protocolOp
+func berReadMessage(r *bufio.Reader) (int, byte, []byte, error) {
+	head := make([]byte, 2, 5)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, 0, nil, err
+	}
+	size := int(head[1])
+	if size&0x80 != 0 {
+		octets := size & 0x7f
+		if octets == 0 || octets > 3 {
+			return 0, 0, nil, errors.New("LDAP message has a bad length")
+		}
+		head = head[:2+octets]
+		if _, err := io.ReadFull(r, head[2:]); err != nil {
+			return 0, 0, nil, err
+		}
+		size = 0
+		for _, octet := range head[2:] {
+			size = size<<8 | int(octet)
+		}
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return 0, 0, nil, err
+	}
+	_, id, rest, err := berNext(message)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	tag, op, _, err := berNext(rest)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return berValue(id), tag, op, nil
+}
+
+// berValue returns the value of an INTEGER's or ENUMERATED's content
+func berValue(content []byte) int {
+	n := 0
+	for _, octet := range content {
+		n = n<<8 | int(octet)
+	}
+	return n
+}
+
+// ldapFilter returns the BER encoding of a filter in its string form, as in
+// RFC 4515: (attr=value), (attr=*), (attr=with*substrings*), (attr>=value),
+// (attr<=value), (attr~=value), and &, | and ! of them
+func ldapFilter(s string) ([]byte, error) {
+	filter, rest, err := ldapNextFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("Unexpected '%s' after the filter", rest)
+	}
+	return filter, nil
+}
+
+func ldapNextFilter(s string) ([]byte, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, s, errors.New("Expected a filter in parentheses")
+	}
+	s = s[1:]
+	if s != "" && (s[0] == '&' || s[0] == '|' || s[0] == '!') {
+		tag := map[byte]byte{'&': 0xa0, '|': 0xa1, '!': 0xa2}[s[0]]
+		var filters [][]byte
+		rest := s[1:]
+		for strings.HasPrefix(rest, "(") {
+			filter, after, err := ldapNextFilter(rest)
+			if err != nil {
+				return nil, s, err
+			}
+			filters, rest = append(filters, filter), after
+		}
+		if !strings.HasPrefix(rest, ")") || len(filters) == 0 || (tag == 0xa2 && len(filters) != 1) {
+			return nil, s, fmt.Errorf("Bad filter list at '%s'", s)
+		}
+		return ber(tag, filters...), rest[1:], nil
+	}
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, s, errors.New("Expected ) to end the filter")
+	}
+	item, rest := s[:end], s[end+1:]
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, s, fmt.Errorf("Expected attr=value, got: %s", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+	tag := byte(0xa3)
+	switch attr[len(attr)-1] {
+	case '>':
+		tag, attr = 0xa5, attr[:len(attr)-1]
+	case '<':
+		tag, attr = 0xa6, attr[:len(attr)-1]
+	case '~':
+		tag, attr = 0xa8, attr[:len(attr)-1]
+	}
+	if attr == "" {
+		return nil, s, fmt.Errorf("Expected an attribute, got: %s", item)
+	}
+	if tag == 0xa3 && value == "*" {
+		return berString(0x87, attr), rest, nil
+	}
+	if tag == 0xa3 && strings.Contains(value, "*") {
+		parts := strings.Split(value, "*")
+		var substrings [][]byte
+		for i, part := range parts {
+			if part == "" {
+				continue
+			}
+			unescaped, err := ldapUnescape(part)
+			if err != nil {
+				return nil, s, err
+			}
+			choice := byte(0x81) // any
+			if i == 0 {
+				choice = 0x80 // initial
+			} else if i == len(parts)-1 {
+				choice = 0x82 // final
+			}
+			substrings = append(substrings, berString(choice, unescaped))
+		}
+		return ber(0xa4, berString(0x04, attr), ber(0x30, substrings...)), rest, nil
+	}
+	unescaped, err := ldapUnescape(value)
+	if err != nil {
+		return nil, s, err
+	}
+	return ber(tag, berString(0x04, attr), berString(0x04, unescaped)), rest, nil
+}
+
+// ldapUnescape returns a filter's value with its \XX escapes decoded
+func ldapUnescape(value string) (string, error) {
+	if !strings.Contains(value, `\`) {
+		return value, nil
+	}
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			out.WriteByte(value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return "", fmt.Errorf("Bad escape in filter value: %s", value)
+		}
+		b, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("Bad escape in filter value: %s", value)
+		}
+		out.WriteByte(byte(b))
+		i += 2
+	}
+	return out.String(), nil
+}
+
+// ldapConn is a connection to an LDAP server, sending numbered requests
+type ldapConn struct {
+	*mailConn
+	reader *bufio.Reader
+	id     int
+}
+
+// request sends the protocolOp, numbered, and reads the responses to it
+// until one with the tag done, returning the number of others before it
+// and the error its result code stands for, if it isn't success
+func (c *ldapConn) request(method string, op []byte, done byte) (int, error) {
+	c.id++
+	if _, err := c.Write(ber(0x30, berInt(0x02, c.id), op)); err != nil {
+		return 0, err
+	}
+	others := 0
+	for {
+		id, tag, content, err := berReadMessage(c.reader)
+		if err != nil {
+			return others, err
+		}
+		if id == 0 {
+			return others, errors.New("LDAP server gave notice of disconnection")
+		}
+		if id != c.id {
+			continue
+		}
+		if tag != done {
+			others++
+			continue
+		}
+		_, code, rest, err := berNext(content)
+		if err != nil {
+			return others, err
+		}
+		if code := berValue(code); code != 0 {
+			return others, ldapError(method, code, rest)
+		}
+		return others, nil
+	}
+}
+
+// ldapError returns the error for an LDAPResult with the code, and the
+// matchedDN and diagnosticMessage in rest, as a mailError with the status
+// code the result code stands for
+func ldapError(method string, code int, rest []byte) error {
+	result, ok := ldapResults[code]
+	if !ok {
+		result.name, result.code = "resultCode"+strconv.Itoa(code), 500
+	}
+	text := fmt.Sprintf("LDAP %s failed: %s (%d)", method, result.name, code)
+	if _, _, rest, err := berNext(rest); err == nil {
+		if _, message, _, err := berNext(rest); err == nil && len(message) > 0 {
+			text += ": " + string(message)
+		}
+	}
+	return &mailError{code: result.code, text: text}
+}
+
+// bind sends a simple BindRequest
+func (c *ldapConn) bind(dn, password string) error {
+	_, err := c.request("BIND", ber(0x60, berInt(0x02, 3), berString(0x04, dn), berString(0x80, password)), 0x61)
+	return err
+}
+
+// search sends a SearchRequest, returning how many entries it found
+func (c *ldapConn) search(config *LDAPConfig) (int, error) {
+	filter, err := ldapFilter(config.Filter)
+	if err != nil {
+		return 0, err
+	}
+	attributes := make([][]byte, len(config.Attributes))
+	for i, attribute := range config.Attributes {
+		attributes[i] = berString(0x04, attribute)
+	}
+	op := ber(0x63,
+		berString(0x04, config.Base),
+		berInt(0x0a, int(ldapScopes[config.Scope])),
+		berInt(0x0a, 0), // never dereference aliases
+		berInt(0x02, 0), // no size limit
+		berInt(0x02, 0), // no time limit
+		ber(0x01, []byte{0}),
+		filter,
+		ber(0x30, attributes...))
+	return c.request("SEARCH", op, 0x65)
+}
+
+// doLDAP sends the step's requests, each bind and search of them a result
+// of its own with BIND or SEARCH as its method; connecting, with CONNECT,
+// and, unless each request binds, binding as the step's DN, with BIND, are
+// results of their own, for the session's connection and any it makes
+// after one fails.
+func (session *Session) doLDAP(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	config := target.LDAP
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => LDAP %s %s", 200, target.URL, config))
+		return
+	}
+	u, err := parseLDAPURL(target.URL)
+	if err == nil {
+		_, err = ldapFilter(config.Filter)
+	}
+	if err != nil {
+		result := &Result{Timestamp: time.Now(), Error: err.Error()}
+		result.PathFromURL(target.URL)
+		session.send(result)
+		return
+	}
+	attacker, path := session.attacker, "/"+ldapPlain+"/"+config.Base
+	timeouts := attacker.timeouts.Merge(target.Timeouts)
+
+	var (
+		conn   *mailConn
+		client *ldapConn
+	)
+	defer func() {
+		if conn != nil {
+			conn.SetDeadline(time.Now().Add(time.Second))
+			client.Write(ber(0x30, berInt(0x02, client.id+1), ber(0x42)))
+			conn.Close()
+		}
+	}()
+	// run times an operation and sends its result, returning false if the
+	// step's to stop or the operation failed
+	run := func(method string, requests int, op func(deadline time.Time) error) bool {
+		result := attacker.hitMail(target, method, path, time.Now(), requests, &conn, func(deadline time.Time) error {
+			if conn != nil {
+				conn.SetDeadline(deadline)
+			}
+			return op(deadline)
+		})
+		if result.Error == ErrLimitAborted.Error() {
+			return false
+		}
+		session.debug(fmt.Sprintf("%d => LDAP %s %s, %d/%d, %d ms",
+			result.Code, method, path, requests, config.Requests, int64(result.Latency/time.Millisecond)))
+		session.send(result)
+		return result.Code == 200
+	}
+	for requests := 1; requests <= config.Requests && !session.isAborted(); requests++ {
+		session.Gate.wait(session.aborted)
+		if conn == nil {
+			connected := run("CONNECT", requests, func(deadline time.Time) (err error) {
+				if conn, err = attacker.dialMail(u, timeouts); err != nil {
+					return err
+				}
+				client = &ldapConn{mailConn: conn, reader: bufio.NewReader(conn)}
+				return nil
+			})
+			if connected && config.DN != "" && !config.binds() {
+				connected = run("BIND", requests, func(time.Time) error {
+					return client.bind(config.DN, config.Password)
+				})
+			}
+			if !connected {
+				if conn != nil {
+					conn.Close()
+					conn = nil
+				}
+				continue
+			}
+		}
+		for _, op := range config.Ops {
+			var ok bool
+			if op == LDAPBind {
+				ok = run("BIND", requests, func(time.Time) error {
+					return client.bind(config.DN, config.Password)
+				})
+			} else {
+				ok = run("SEARCH", requests, func(time.Time) error {
+					entries, err := client.search(config)
+					if err == nil && entries == 0 {
+						// nothing matched the filter
+						return &mailError{code: 404, text: "LDAP SEARCH found no entries"}
+					}
+					return err
+				})
+			}
+			if !ok || conn == nil {
+				break
+			}
+		}
+	}
+}
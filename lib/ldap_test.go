@@ -0,0 +1,160 @@
+package korra
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLDAPConfig(t *testing.T) {
+	action := &SessionAction{Raw: "LDAP ldaps://directory:636\n[requests=5 ops=bind,search dn=uid=a,dc=example password=secret]\n[base=dc=example scope=one filter=(uid=a) attributes=cn,mail]", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	if got := action.Target.LDAP.String(); got != "[Requests=5 Ops=bind,search DN=uid=a,dc=example Base=dc=example Scope=one Filter=(uid=a) Attributes=cn,mail]" {
+		t.Fatalf("bad LDAP config: %s", got)
+	}
+	if action.Target.String() != "LDAP ldaps://directory:636" || action.Target.LDAP.Password != "secret" {
+		t.Fatalf("want an LDAP step, got: %s", action.Target)
+	}
+	for _, bad := range []string{"LDAP http://directory:389", "LDAP ldap://directory", "LDAP ldap://directory:389/dc=example",
+		"LDAP ldap://directory:389\n[ops=modify]", "LDAP ldap://directory:389\n[scope=deep]", "LDAP ldap://directory:389\n[filter=uid=a]",
+		"LDAP ldap://directory:389\n[requests=0]", "LDAP ldap://directory:389\nFilter: (uid=a)"} {
+		action = &SessionAction{Raw: bad, Line: 1}
+		if err := action.CreateTarget("."); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+func TestLDAPFilter(t *testing.T) {
+	for filter, want := range map[string][]byte{
+		"(uid=a)":         {0xa3, 8, 0x04, 3, 'u', 'i', 'd', 0x04, 1, 'a'},
+		"(cn=*)":          {0x87, 2, 'c', 'n'},
+		"(cn>=b)":         {0xa5, 7, 0x04, 2, 'c', 'n', 0x04, 1, 'b'},
+		"(!(cn=*))":       {0xa2, 4, 0x87, 2, 'c', 'n'},
+		"(cn=a*b*c)":      {0xa4, 15, 0x04, 2, 'c', 'n', 0x30, 9, 0x80, 1, 'a', 0x81, 1, 'b', 0x82, 1, 'c'},
+		"(cn=\\2a)":       {0xa3, 7, 0x04, 2, 'c', 'n', 0x04, 1, '*'},
+		"(|(cn=*)(sn=*))": {0xa1, 8, 0x87, 2, 'c', 'n', 0x87, 2, 's', 'n'},
+	} {
+		got, err := ldapFilter(filter)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: want %v, got %v, %v", filter, want, got, err)
+		}
+	}
+	for _, bad := range []string{"uid=a", "(uid=a", "(=a)", "(&)", "(!(a=*)(b=*))", "(a=\\2)", "(a=*))"} {
+		if _, err := ldapFilter(bad); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+// ldapServer is a directory with the user korra, password secret, with an
+// entry under dc=example; anyone else's bind fails, as does a search under
+// any other base.
+type ldapServer struct {
+	sync.Mutex
+	listener net.Listener
+	ops      []string
+}
+
+func newLDAPServer(t *testing.T) *ldapServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &ldapServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *ldapServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		id, tag, op, err := berReadMessage(reader)
+		if err != nil {
+			return
+		}
+		reply := func(tag byte, parts ...[]byte) {
+			conn.Write(ber(0x30, berInt(0x02, id), ber(tag, parts...)))
+		}
+		result := func(tag byte, code int, message string) {
+			reply(tag, berInt(0x0a, code), berString(0x04, ""), berString(0x04, message))
+		}
+		s.Lock()
+		s.ops = append(s.ops, fmt.Sprintf("%x", tag))
+		s.Unlock()
+		switch tag {
+		case 0x60:
+			_, _, rest, _ := berNext(op)
+			_, dn, rest, _ := berNext(rest)
+			_, password, _, _ := berNext(rest)
+			if string(dn) == "uid=korra,dc=example" && string(password) == "secret" {
+				result(0x61, 0, "")
+			} else {
+				result(0x61, 49, "Invalid credentials")
+			}
+		case 0x63:
+			_, base, _, _ := berNext(op)
+			if string(base) != "dc=example" {
+				result(0x65, 32, "No such object")
+				continue
+			}
+			reply(0x64, berString(0x04, "uid=korra,dc=example"), ber(0x30))
+			result(0x65, 0, "")
+		case 0x42:
+			return
+		}
+	}
+}
+
+// ldapValues are the values of the session binding and searching
+var ldapValues = map[string]string{"users.name": "korra"}
+
+func TestLDAP(t *testing.T) {
+	server := newLDAPServer(t)
+	defer server.listener.Close()
+	addr := server.listener.Addr()
+
+	results := runAction(t, fmt.Sprintf("LDAP ldap://%s\n[requests=2 dn=uid=${users.name},dc=example password=secret base=dc=example filter=(uid=${users.name})]", addr), 10, (*Session).doLDAP, ldapValues)
+	if got := methods(results); got != "CONNECT 200, BIND 200, SEARCH 200, SEARCH 200" {
+		t.Fatalf("want the session to bind once, got: %s", got)
+	}
+	for _, r := range results {
+		if r.Path != "/ldap/dc=example" || r.Error != "" {
+			t.Fatalf("bad LDAP result: %+v", r)
+		}
+	}
+	if results[2].BytesIn == 0 || results[2].BytesOut == 0 {
+		t.Fatalf("want the search's bytes counted, got: %+v", results[2])
+	}
+	server.Lock()
+	ops := strings.Join(server.ops, " ")
+	server.Unlock()
+	if !strings.HasPrefix(ops, "60 63 63") {
+		t.Fatalf("want a bind, then the searches, got: %s", ops)
+	}
+
+	results = runAction(t, fmt.Sprintf("LDAP ldap://%s\n[requests=2 ops=bind,search dn=uid=korra,dc=example password=wrong base=dc=example]", addr), 10, (*Session).doLDAP, ldapValues)
+	if got := methods(results); got != "CONNECT 200, BIND 401, BIND 401" || results[1].Error != "LDAP BIND failed: invalidCredentials (49): Invalid credentials" {
+		t.Fatalf("want each request's bind refused, got: %s, %s", got, results[1].Error)
+	}
+
+	results = runAction(t, fmt.Sprintf("LDAP ldap://%s\n[requests=1 base=dc=elsewhere]", addr), 10, (*Session).doLDAP, ldapValues)
+	if got := methods(results); got != "CONNECT 200, SEARCH 404" || !strings.Contains(results[1].Error, "noSuchObject (32)") {
+		t.Fatalf("want the base not found, got: %s, %s", got, results[1].Error)
+	}
+}
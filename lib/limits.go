@@ -0,0 +1,315 @@
+package korra
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit caps the traffic to a bucket across every session: Rate is the
+// maximum requests per second and Concurrency the maximum requests in
+// flight. A zero value for either means no cap. Jitter varies the intervals
+// between the Rate's send times.
+type Limit struct {
+	Rate        float64
+	Concurrency int
+	Jitter      Jitter
+}
+
+// Jitter varies the intervals between requests sent on a rate schedule, as
+// perfectly regular arrivals set up harmonics in the queues of the servers
+// that real traffic never would. Intervals keep the rate's mean either way:
+//
+//   - uniform spreads each interval evenly within Spread of its mean, as a
+//     fraction of it from 0 to 1
+//   - exponential draws intervals from an exponential distribution, so
+//     requests arrive as a Poisson process, as independent users do
+type Jitter struct {
+	Kind   string // "", uniform or exponential
+	Spread float64
+}
+
+// ParseJitter parses exponential, uniform, or uniform:spread with the spread
+// as a fraction like 0.5; uniform alone spreads intervals from 0 to twice
+// their mean.
+func ParseJitter(value string) (Jitter, error) {
+	kind, spread, hasSpread := strings.Cut(strings.ToLower(value), ":")
+	switch kind {
+	case "exponential":
+		if hasSpread {
+			return Jitter{}, fmt.Errorf("Exponential jitter takes no spread, got: %s", value)
+		}
+		return Jitter{Kind: kind}, nil
+	case "uniform":
+		j := Jitter{Kind: kind, Spread: 1}
+		if hasSpread {
+			var err error
+			if j.Spread, err = strconv.ParseFloat(spread, 64); err != nil || j.Spread < 0 || j.Spread > 1 {
+				return Jitter{}, fmt.Errorf("Expected a spread from 0 to 1 for uniform jitter, got: %s", spread)
+			}
+		}
+		return j, nil
+	}
+	return Jitter{}, fmt.Errorf("Expected uniform, uniform:spread or exponential for jitter, got: %s", value)
+}
+
+// interval returns the time until the next request of a schedule with the
+// mean interval
+func (j Jitter) interval(mean time.Duration, random *Random) time.Duration {
+	switch j.Kind {
+	case "uniform":
+		return time.Duration(float64(mean) * (1 + j.Spread*(2*random.Float64()-1)))
+	case "exponential":
+		return time.Duration(-float64(mean) * math.Log(1-random.Float64()))
+	}
+	return mean
+}
+
+func (j Jitter) String() string {
+	if j.Kind == "uniform" {
+		return fmt.Sprintf("uniform:%g", j.Spread)
+	}
+	return j.Kind
+}
+
+// Active returns true if the limit caps anything
+func (l Limit) Active() bool {
+	return l.Rate > 0 || l.Concurrency > 0
+}
+
+// FillFromLine takes a line formatted:
+//
+//	param=value param=value
+//
+// and fills itself from the parameters, as:
+//
+//   - rate: The max requests per second (may be fractional)
+//   - concurrency: The max requests in flight at once
+//   - jitter: How the intervals between the rate's requests vary (see
+//     ParseJitter)
+func (l *Limit) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for limit param, got: %s", piece)
+		}
+		value := strings.TrimSpace(param[1])
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "rate":
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil || rate < 0 {
+				return fmt.Errorf("Expected positive number for rate, got: %s", value)
+			}
+			l.Rate = rate
+		case "concurrency":
+			concurrency, err := strconv.Atoi(value)
+			if err != nil || concurrency < 0 {
+				return fmt.Errorf("Expected positive int for concurrency, got: %s", value)
+			}
+			l.Concurrency = concurrency
+		case "jitter":
+			jitter, err := ParseJitter(value)
+			if err != nil {
+				return err
+			}
+			l.Jitter = jitter
+		default:
+			return fmt.Errorf("Unknown limit param: %s", param[0])
+		}
+	}
+	return nil
+}
+
+func (l Limit) String() string {
+	if l.Jitter.Kind != "" {
+		return fmt.Sprintf("<Rate=%g Concurrency=%d Jitter=%s>", l.Rate, l.Concurrency, l.Jitter)
+	}
+	return fmt.Sprintf("<Rate=%g Concurrency=%d>", l.Rate, l.Concurrency)
+}
+
+// ErrLimitAborted is the error of a request whose session was stopped while
+// it waited on its limits; it was never sent.
+var ErrLimitAborted = errors.New("aborted while waiting on limits")
+
+// limiter enforces a Limit: requests wait for one of the concurrency slots,
+// and then for a slot in the rate schedule, so that those let through by a
+// request finishing are still spaced out by the rate.
+type limiter struct {
+	sync.Mutex
+	limit  Limit
+	next   time.Time
+	random *Random // for the jitter
+	slots  chan struct{}
+}
+
+func newLimiter(limit Limit) *limiter {
+	l := &limiter{limit: limit}
+	if limit.Concurrency > 0 {
+		l.slots = make(chan struct{}, limit.Concurrency)
+	}
+	return l
+}
+
+// acquire blocks until a request may proceed, returning the function to
+// call when it's done; it gives up, returning false, if abort is closed
+// first, giving back the slots it took.
+func (l *limiter) acquire(abort <-chan struct{}) (func(), bool) {
+	release := func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			release = func() { <-l.slots }
+		case <-abort:
+			return nil, false
+		}
+	}
+	if l.limit.Rate > 0 {
+		interval := time.Duration(float64(time.Second) / l.limit.Rate)
+		l.Lock()
+		now := time.Now()
+		if l.next.Before(now) {
+			l.next = now
+		}
+		slot := l.next
+		l.next = l.next.Add(l.limit.Jitter.interval(interval, l.random))
+		next := l.next
+		l.Unlock()
+		timer := time.NewTimer(slot.Sub(now))
+		select {
+		case <-timer.C:
+		case <-abort:
+			timer.Stop()
+			// the send time is given back unless a later one's been taken
+			l.Lock()
+			if l.next.Equal(next) {
+				l.next = slot
+			}
+			l.Unlock()
+			release()
+			return nil, false
+		}
+	}
+	return release, true
+}
+
+type bucketLimiter struct {
+	bucket  *PathBucket
+	limiter *limiter
+}
+
+// Limiters hold the limits shared by every session's Attacker. Limits for
+// buckets are checked in the order they were added, and the first matching
+// bucket wins; limits declared by a step apply to every step in the same
+// inferred bucket.
+type Limiters struct {
+	sync.Mutex
+	buckets []bucketLimiter
+	random  *Random
+	share   float64 // of the rates, if this node takes only part of the load
+	steps   map[string]*limiter
+}
+
+func NewLimiters() *Limiters {
+	return &Limiters{steps: map[string]*limiter{}}
+}
+
+// Seed makes the jitter of the limits added after it reproducible, though
+// which session's request gets which send time still isn't.
+func (ls *Limiters) Seed(seed int64) {
+	ls.Lock()
+	defer ls.Unlock()
+	ls.random = NewRandom(seed)
+}
+
+// Share scales the rates of the limits added after it, from a file or a
+// step, by the share of the load this node takes (see Partition.Share). A
+// limit's rate is then that of the whole run across every node, with each
+// node sending its part of it.
+func (ls *Limiters) Share(share float64) {
+	ls.Lock()
+	defer ls.Unlock()
+	ls.share = share
+}
+
+// newLimiter returns a limiter for the limit using the Limiters' random
+// source and scaled to their share; the caller holds the lock
+func (ls *Limiters) newLimiter(limit Limit) *limiter {
+	if ls.share > 0 {
+		limit.Rate *= ls.share
+	}
+	l := newLimiter(limit)
+	l.random = ls.random
+	return l
+}
+
+// AddBucket caps the requests matching the method and path pattern, which
+// has the same format as the URL patterns for reports.
+func (ls *Limiters) AddBucket(method, path string, limit Limit) {
+	ls.Lock()
+	defer ls.Unlock()
+	ls.buckets = append(ls.buckets, bucketLimiter{NewPathBucketFromStrings(method, path), ls.newLimiter(limit)})
+}
+
+// ReadLimits adds a bucket limit for every line of the reader, formatted
+// as the method, path pattern and limit params:
+//
+//	POST /checkout/* rate=50 concurrency=10
+//
+// Blank lines and those starting with '#' are skipped.
+func (ls *Limiters) ReadLimits(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pieces := strings.SplitN(line, " ", 3)
+		if len(pieces) != 3 {
+			return fmt.Errorf("Bad limit definition, expect METHOD PATH PARAMS, got '%s'", line)
+		}
+		var limit Limit
+		if err := limit.FillFromLine(pieces[2]); err != nil {
+			return fmt.Errorf("Bad limit definition '%s': %s", line, err)
+		}
+		ls.AddBucket(pieces[0], pieces[1], limit)
+	}
+	return scanner.Err()
+}
+
+// find returns the limiter for the target, if any
+func (ls *Limiters) find(tgt *Target) *limiter {
+	ls.Lock()
+	defer ls.Unlock()
+	if tgt.Limit.Active() {
+		key := bucketKey(tgt)
+		if ls.steps[key] == nil {
+			ls.steps[key] = ls.newLimiter(tgt.Limit)
+		}
+		return ls.steps[key]
+	}
+	result := &Result{Method: tgt.Method, Path: tgt.URL}
+	result.PathFromURL(tgt.URL)
+	pieces := pathToPieces(result.Path)
+	for _, bl := range ls.buckets {
+		if bl.bucket.Match(pieces, result) {
+			return bl.limiter
+		}
+	}
+	return nil
+}
+
+// acquire blocks until the target's limits allow it to proceed, returning
+// the function to call when the request is done, or false if abort was
+// closed while it waited.
+func (ls *Limiters) acquire(tgt *Target, abort <-chan struct{}) (func(), bool) {
+	if l := ls.find(tgt); l != nil {
+		return l.acquire(abort)
+	}
+	return func() {}, true
+}
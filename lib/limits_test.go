@@ -0,0 +1,215 @@
+package korra
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimiterRate(t *testing.T) {
+	l := newLimiter(Limit{Rate: 100})
+	began := time.Now()
+	for i := 0; i < 5; i++ {
+		release, _ := l.acquire(nil)
+		release()
+	}
+	if got, want := time.Since(began), 40*time.Millisecond; got < want {
+		t.Fatalf("5 requests at 100/s took %s, want at least %s", got, want)
+	}
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	l := newLimiter(Limit{Concurrency: 1})
+	release, _ := l.acquire(nil)
+	acquired := make(chan struct{})
+	go func() {
+		release, _ := l.acquire(nil)
+		release()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second request should wait for the first")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	<-acquired
+}
+
+func TestLimiterAbort(t *testing.T) {
+	l := newLimiter(Limit{Rate: 1, Concurrency: 1})
+	release, _ := l.acquire(nil)
+	release()
+	abort := make(chan struct{})
+	time.AfterFunc(10*time.Millisecond, func() { close(abort) })
+	began := time.Now()
+	if _, ok := l.acquire(abort); ok {
+		t.Fatal("want the wait for the rate to give up on abort")
+	}
+	if took := time.Since(began); took > 500*time.Millisecond {
+		t.Fatalf("abort took %s, want it to cut the wait short", took)
+	}
+	l = newLimiter(Limit{Concurrency: 1})
+	release, _ = l.acquire(nil)
+	defer release()
+	if _, ok := l.acquire(abort); ok {
+		t.Fatal("want the wait for a slot to give up on abort")
+	}
+}
+
+func TestLimiterConcurrencyBeforeRate(t *testing.T) {
+	// requests let through together by others finishing are still spaced
+	// out by the rate, rather than sent at once on send times they took
+	// while they waited
+	l := newLimiter(Limit{Rate: 20, Concurrency: 2})
+	first, _ := l.acquire(nil)
+	second, _ := l.acquire(nil)
+	started := make(chan time.Time, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			release, _ := l.acquire(nil)
+			started <- time.Now()
+			release()
+		}()
+	}
+	time.Sleep(300 * time.Millisecond)
+	first()
+	second()
+	a, b := <-started, <-started
+	if gap := b.Sub(a); gap < 40*time.Millisecond {
+		t.Fatalf("want the waiting requests 50ms apart at 20/s, got %s", gap)
+	}
+
+	// an aborted request gives back its concurrency slot and send time
+	l = newLimiter(Limit{Rate: 10, Concurrency: 1})
+	release, _ := l.acquire(nil)
+	release()
+	abort := make(chan struct{})
+	time.AfterFunc(10*time.Millisecond, func() { close(abort) })
+	if _, ok := l.acquire(abort); ok {
+		t.Fatal("want the wait for the rate to give up on abort")
+	}
+	began := time.Now()
+	release, ok := l.acquire(nil)
+	if !ok {
+		t.Fatal("want the slot the aborted request took given back")
+	}
+	release()
+	if took := time.Since(began); took > 150*time.Millisecond {
+		t.Fatalf("want the next request sent on the aborted one's send time, 90ms on, took %s", took)
+	}
+}
+
+func TestLimitersFind(t *testing.T) {
+	ls := NewLimiters()
+	err := ls.ReadLimits(strings.NewReader("# checkout is fragile\nPOST /checkout/* rate=50 concurrency=10\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkout := &Target{Method: "POST", URL: "http://shop/checkout/123"}
+	if l := ls.find(checkout); l == nil || l.limit != (Limit{Rate: 50, Concurrency: 10}) {
+		t.Fatalf("want checkout limiter, got: %v", l)
+	}
+	if l := ls.find(&Target{Method: "GET", URL: "http://shop/checkout/123"}); l != nil {
+		t.Fatalf("want no limiter for GET, got: %v", l)
+	}
+	step := &Target{Method: "GET", URL: "http://shop/items/1", Limit: Limit{Rate: 5}}
+	other := &Target{Method: "GET", URL: "http://shop/items/2", Limit: Limit{Rate: 5}}
+	if ls.find(step) != ls.find(other) {
+		t.Fatal("steps in the same bucket should share a limiter")
+	}
+	if err := ls.ReadLimits(strings.NewReader("POST /checkout rate=fast")); err == nil {
+		t.Fatal("want error for bad rate")
+	}
+}
+
+func TestLimitersShare(t *testing.T) {
+	// three nodes, the first twice the size of the others, each with the
+	// same limits: their rates add up to the limits' and split 2:1:1
+	var total float64
+	rates := map[string]float64{}
+	for _, share := range []string{"1-2/4", "3/4", "4/4"} {
+		partition, err := ParsePartition(share)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ls := NewLimiters()
+		ls.Share(partition.Share())
+		if err := ls.ReadLimits(strings.NewReader("POST /checkout/* rate=200 concurrency=10\n")); err != nil {
+			t.Fatal(err)
+		}
+		checkout := ls.find(&Target{Method: "POST", URL: "http://shop/checkout/123"})
+		step := ls.find(&Target{Method: "GET", URL: "http://shop/items/1", Limit: Limit{Rate: 40}})
+		if checkout.limit.Concurrency != 10 || step.limit.Rate != 40*partition.Share() {
+			t.Fatalf("%s: want the step's rate scaled and concurrency left alone, got %v and %v", share, checkout.limit, step.limit)
+		}
+		rates[share] = checkout.limit.Rate
+		total += checkout.limit.Rate
+	}
+	if total != 200 || rates["1-2/4"] != 100 || rates["3/4"] != 50 || rates["4/4"] != 50 {
+		t.Fatalf("want 200/s split 100, 50 and 50, got %v", rates)
+	}
+
+	// and the node sends at its share: 5 requests at 50/s take 80ms
+	ls := NewLimiters()
+	ls.Share(0.25)
+	ls.AddBucket("GET", "/*", Limit{Rate: 200})
+	began := time.Now()
+	for i := 0; i < 5; i++ {
+		release, _ := ls.acquire(&Target{Method: "GET", URL: "http://shop/items"}, nil)
+		release()
+	}
+	if got, want := time.Since(began), 80*time.Millisecond; got < want {
+		t.Fatalf("5 requests at a quarter of 200/s took %s, want at least %s", got, want)
+	}
+}
+
+func TestJitterIntervals(t *testing.T) {
+	mean := 100 * time.Millisecond
+	for _, tt := range []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"uniform", 0, 200 * time.Millisecond},
+		{"Uniform:0.25", 75 * time.Millisecond, 125 * time.Millisecond},
+		{"exponential", 0, time.Hour},
+	} {
+		jitter, err := ParseJitter(tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		random := NewRandom(1)
+		var total time.Duration
+		distinct := map[time.Duration]bool{}
+		for i := 0; i < 10000; i++ {
+			interval := jitter.interval(mean, random)
+			if interval < tt.min || interval > tt.max {
+				t.Fatalf("%s: interval %s outside [%s, %s]", tt.value, interval, tt.min, tt.max)
+			}
+			total += interval
+			distinct[interval] = true
+		}
+		if got := total / 10000; got < 95*time.Millisecond || got > 105*time.Millisecond {
+			t.Fatalf("%s: want a mean interval near %s, got: %s", tt.value, mean, got)
+		}
+		if len(distinct) < 1000 {
+			t.Fatalf("%s: want the intervals to vary, got %d distinct", tt.value, len(distinct))
+		}
+	}
+	if got := (Jitter{}).interval(mean, nil); got != mean {
+		t.Fatalf("want no jitter to keep the interval, got: %s", got)
+	}
+
+	var limit Limit
+	if err := limit.FillFromLine("rate=10 jitter=uniform:0.5"); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Limit{Rate: 10, Jitter: Jitter{"uniform", 0.5}}); limit != want {
+		t.Fatalf("want: %s, got: %s", want, limit)
+	}
+	for _, bad := range []string{"normal", "uniform:2", "exponential:0.5"} {
+		if _, err := ParseJitter(bad); err == nil {
+			t.Errorf("%s: want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package korra
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// LittleTolerance is how far, as a fraction of the expected, the recorded
+// concurrency of an attack may be from what Little's Law expects before
+// it's flagged
+var LittleTolerance = 0.2
+
+// LittleCheck checks an attack's concurrency with Little's Law: the mean
+// number of requests in flight is their throughput times their mean latency.
+// The generator records how many it had in flight as it sent each request
+// (see Result.InFlight), so the two should agree. Recording more than the
+// latencies account for means requests waited in the generator outside of
+// what was timed -- queuing for connections, or a host too busy to send
+// them -- and recording fewer means the latencies count time the requests
+// weren't outstanding; either way the latencies can't be taken at face
+// value.
+type LittleCheck struct {
+	Throughput  float64       `json:"throughput"`   // results per second, over the span of the run
+	MeanLatency time.Duration `json:"mean_latency"` // of the results that recorded what was in flight
+	Expected    float64       `json:"expected"`     // the mean in flight, by Little's Law
+	Recorded    float64       `json:"recorded"`     // the mean in flight as each request was sent
+	Results     int           `json:"results"`      // that recorded what was in flight
+	Flagged     bool          `json:"flagged"`      // whether Recorded is more than LittleTolerance from Expected
+}
+
+func (c *LittleCheck) String() string {
+	verdict := "consistent"
+	if c.Flagged && c.Recorded > c.Expected {
+		verdict = "more in flight than the latencies account for: generator-side queuing?"
+	} else if c.Flagged {
+		verdict = "fewer in flight than the latencies account for: a measurement bug?"
+	}
+	return fmt.Sprintf("%.2f recorded vs %.2f expected (%.2f/s x %s), %+.1f%%, %s",
+		c.Recorded, c.Expected, c.Throughput, c.MeanLatency, c.deviation()*100, verdict)
+}
+
+func (c *LittleCheck) deviation() float64 { return (c.Recorded - c.Expected) / c.Expected }
+
+// CheckLittle checks the results with Little's Law. It returns nil if there's
+// nothing to check: no results recorded what was in flight, or they took no
+// time at all. Since the generator counts everything it has in flight, the
+// results should be all of those one host recorded, unfiltered.
+func CheckLittle(r Results) *LittleCheck {
+	var (
+		recorded []*Result
+		check    LittleCheck
+		latency  time.Duration
+		inFlight int
+	)
+	for _, result := range r {
+		if result.InFlight > 0 {
+			recorded = append(recorded, result)
+		}
+	}
+	span := spanOf(recorded)
+	if len(recorded) == 0 || !span.end.After(span.start) {
+		return nil
+	}
+	for _, result := range recorded {
+		w := result.weight()
+		check.Results += w
+		latency += result.Latency * time.Duration(w)
+		inFlight += result.InFlight * w
+	}
+	check.Throughput = float64(check.Results) / span.end.Sub(span.start).Seconds()
+	check.MeanLatency = latency / time.Duration(check.Results)
+	check.Expected = check.Throughput * check.MeanLatency.Seconds()
+	check.Recorded = float64(inFlight) / float64(check.Results)
+	check.Flagged = check.Expected == 0 || math.Abs(check.deviation()) > LittleTolerance
+	return &check
+}
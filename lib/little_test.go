@@ -0,0 +1,79 @@
+package korra
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckLittle(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	// four sessions back to back for ten seconds, each request 100ms
+	results := func(inFlight int) Results {
+		var r Results
+		for i := 0; i < 100; i++ {
+			for s := 0; s < 4; s++ {
+				r = append(r, &Result{Timestamp: start.Add(time.Duration(i) * 100 * time.Millisecond), Latency: 100 * time.Millisecond, InFlight: inFlight})
+			}
+		}
+		return r
+	}
+
+	check := CheckLittle(results(4))
+	if check == nil {
+		t.Fatal("expected a check")
+	}
+	if check.Results != 400 || check.Throughput != 40 || check.MeanLatency != 100*time.Millisecond {
+		t.Fatalf("bad check: %+v", check)
+	}
+	if math.Abs(check.Expected-4) > 1e-9 || check.Recorded != 4 || check.Flagged {
+		t.Fatalf("expected 4 in flight unflagged: %+v", check)
+	}
+	if !strings.HasSuffix(check.String(), ", consistent") {
+		t.Fatalf("bad string: %s", check)
+	}
+
+	// the generator holding twice what the latencies account for
+	check = CheckLittle(results(8))
+	if !check.Flagged || !strings.Contains(check.String(), "generator-side queuing") {
+		t.Fatalf("expected a flag: %s", check)
+	}
+	if CheckLittle(results(0)) != nil {
+		t.Fatal("expected nothing to check without recorded in flight")
+	}
+}
+
+func TestHitRecordsInFlight(t *testing.T) {
+	var held sync.WaitGroup
+	held.Add(3)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		held.Done()
+		<-release
+	}))
+	defer server.Close()
+
+	attacker := NewAttacker()
+	target := &Target{Method: "GET", URL: server.URL}
+	most := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			most <- attacker.Hit(func() (*Target, error) { return target, nil }, time.Now(), 1).InFlight
+		}()
+	}
+	held.Wait()
+	close(release)
+	seen := map[int]bool{}
+	for i := 0; i < 3; i++ {
+		seen[<-most] = true
+	}
+	for n := 1; n <= 3; n++ {
+		if !seen[n] {
+			t.Fatalf("want each of 1 to 3 in flight, got: %v", seen)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package korra
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LongPollConfig defines how a LONGPOLL step behaves: it sends its request,
+// waits up to Hold for the server to answer, then immediately sends it again
+// -- or after Backoff if the request failed -- until it's done Cycles requests.
+type LongPollConfig struct {
+	Cycles  int // number of requests to make
+	Hold    int // milliseconds to wait for the server to answer each request
+	Backoff int // milliseconds to wait before reconnecting after a failure
+}
+
+func NewLongPollConfig() *LongPollConfig {
+	return &LongPollConfig{Cycles: 10, Hold: 30000, Backoff: 1000}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value param=value]
+//
+// and fills itself from the parameters, as:
+//
+//   - cycles: The number of requests to make (default: 10)
+//   - hold: The time (in milliseconds) to wait for each response (default: 30000)
+//   - backoff: The time (in milliseconds) to wait before reconnecting after
+//     a failed request (default: 1000)
+func (config *LongPollConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for long poll param, got: %s", piece)
+		}
+		num, err := strconv.Atoi(strings.TrimSpace(param[1]))
+		if err != nil || num < 0 {
+			return fmt.Errorf("Expected positive int for long poll param, got: %s", piece)
+		}
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "cycles":
+			config.Cycles = num
+		case "hold":
+			config.Hold = num
+		case "backoff":
+			config.Backoff = num
+		default:
+			return fmt.Errorf("Unknown long poll param: %s", param[0])
+		}
+	}
+	if config.Cycles == 0 || config.Hold == 0 {
+		return fmt.Errorf("Long poll cycles and hold must be greater than 0")
+	}
+	return nil
+}
+
+// Cycle returns a Target for a single cycle: the original, but with its
+// total timeout being the time to hold unless the step gave its own.
+func (config *LongPollConfig) Cycle(tgt *Target) *Target {
+	cycle := *tgt
+	if cycle.Timeouts.Total == 0 {
+		cycle.Timeouts.Total = time.Duration(config.Hold) * time.Millisecond
+	}
+	return &cycle
+}
+
+// idle marks the result of a cycle of the target that the server held for
+// the whole of Hold, which is how a long poll waits when there's no news, as
+// held rather than timed out, returning whether it was. A total timeout the
+// step gave itself is a timeout like any other.
+func (config *LongPollConfig) idle(tgt *Target, result *Result) bool {
+	if tgt.Timeouts.Total != 0 || TimeoutKind(result.Error) != "total" {
+		return false
+	}
+	result.Error, result.Held = "", true
+	return true
+}
+
+func (config *LongPollConfig) String() string {
+	return fmt.Sprintf("[Cycles=%d Hold=%d Backoff=%d]", config.Cycles, config.Hold, config.Backoff)
+}
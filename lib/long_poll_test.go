@@ -0,0 +1,72 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLongPollCycles(t *testing.T) {
+	var cycles int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&cycles, 1) {
+		case 1:
+			w.Write([]byte("news"))
+		case 2:
+			// no news: hold the poll until the client gives up
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	action := &SessionAction{Raw: "LONGPOLL GET " + server.URL + "\n[cycles=3 hold=50 backoff=10]", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{attacker: NewAttacker(), aborted: make(chan struct{}), results: make(chan *Result, 3)}
+	session.doLongPoll(action)
+	close(session.results)
+	var results Results
+	for result := range session.results {
+		results = append(results, result)
+	}
+	if len(results) != 3 {
+		t.Fatalf("want a result a cycle, got %d", len(results))
+	}
+	if r := results[0]; r.Code != 200 || r.Error != "" || r.Held {
+		t.Fatalf("want the news, got: %+v", r)
+	}
+	if r := results[1]; r.Code != 0 || r.Error != "" || !r.Held || r.Latency < 50*time.Millisecond {
+		t.Fatalf("want the cycle held without an error, got: %+v", r)
+	}
+	if r := results[2]; r.Code != 500 || r.Held {
+		t.Fatalf("want the failure, got: %+v", r)
+	}
+
+	m := NewMetrics(results)
+	if m.Held != 1 || m.Requests != 3 || m.Timeouts["total"] != 0 || m.StatusCodes["0"] != 0 {
+		t.Fatalf("want the held cycle counted on its own, got: held %d, timeouts %v, codes %v", m.Held, m.Timeouts, m.StatusCodes)
+	}
+	if want := 2.0 / 3; m.Success != want {
+		t.Fatalf("want the held cycle a success; want: %v, got: %v", want, m.Success)
+	}
+
+	// a total timeout the step gave itself is a timeout
+	action = &SessionAction{Raw: "LONGPOLL GET " + server.URL + "\n[cycles=1 hold=1000]\n{total=50}", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&cycles, 1)
+	session.results = make(chan *Result, 1)
+	session.doLongPoll(action)
+	if r := <-session.results; r.Held || TimeoutKind(r.Error) != "total" {
+		t.Fatalf("want a total timeout, got: %+v", r)
+	}
+}
@@ -0,0 +1,635 @@
+package korra
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// the protocols SMTP and IMAP steps speak, by the scheme of their URL; the
+// second of each is over TLS from the start
+const (
+	mailSMTP  = "smtp"
+	mailSMTPS = "smtps"
+	mailIMAP  = "imap"
+	mailIMAPS = "imaps"
+)
+
+// SMTPConfig defines what an SMTP step sends: Messages messages From the
+// sender To each of the recipients.
+type SMTPConfig struct {
+	From     string
+	To       []string
+	Messages int // messages to send
+}
+
+func NewSMTPConfig() *SMTPConfig {
+	return &SMTPConfig{Messages: 1}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value ...]
+//
+// and fills itself from the parameters, as:
+//
+//   - from: The address to send the messages from (required)
+//   - to: The addresses to send them to, separated by commas (required)
+//   - messages: The number of messages to send (default: 1)
+func (config *SMTPConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for SMTP param, got: %s", piece)
+		}
+		value := strings.TrimSpace(param[1])
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "from":
+			config.From = value
+		case "to":
+			config.To = strings.Split(value, ",")
+		case "messages":
+			num, err := strconv.Atoi(value)
+			if err != nil || num <= 0 {
+				return fmt.Errorf("Expected positive int for SMTP param, got: %s", piece)
+			}
+			config.Messages = num
+		default:
+			return fmt.Errorf("Unknown SMTP param: %s", param[0])
+		}
+	}
+	return nil
+}
+
+// check returns an error if the config is missing the sender or recipients
+func (config *SMTPConfig) check() error {
+	if config.From == "" || len(config.To) == 0 {
+		return fmt.Errorf("Expected From and To addresses to send from and to")
+	}
+	return nil
+}
+
+func (config *SMTPConfig) String() string {
+	return fmt.Sprintf("[From=%s To=%s Messages=%d]", config.From, strings.Join(config.To, ","), config.Messages)
+}
+
+// IMAPConfig defines what an IMAP step fetches: the newest Fetch messages of
+// the mailbox in the step's URL, Requests times.
+type IMAPConfig struct {
+	Requests int // FETCHes to send
+	Fetch    int // messages each FETCH reads
+}
+
+func NewIMAPConfig() *IMAPConfig {
+	return &IMAPConfig{Requests: 1, Fetch: 1}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value]
+//
+// and fills itself from the parameters, as:
+//
+//   - requests: The number of FETCHes to send (default: 1)
+//   - fetch: The number of the newest messages each reads (default: 1)
+func (config *IMAPConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for IMAP param, got: %s", piece)
+		}
+		num, err := strconv.Atoi(strings.TrimSpace(param[1]))
+		if err != nil || num <= 0 {
+			return fmt.Errorf("Expected positive int for IMAP param, got: %s", piece)
+		}
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "requests":
+			config.Requests = num
+		case "fetch":
+			config.Fetch = num
+		default:
+			return fmt.Errorf("Unknown IMAP param: %s", param[0])
+		}
+	}
+	return nil
+}
+
+func (config *IMAPConfig) String() string {
+	return fmt.Sprintf("[Requests=%d Fetch=%d]", config.Requests, config.Fetch)
+}
+
+// parseMailURL checks the URL of an SMTP or IMAP step, one of the schemes
+// given: smtp[s]://[user:password@]host:port or
+// imap[s]://user:password@host:port[/mailbox]
+func parseMailURL(raw string, schemes ...string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != schemes[0] && u.Scheme != schemes[1] {
+		return nil, fmt.Errorf("Expected a %s:// or %s:// URL, got: %s", schemes[0], schemes[1], raw)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("Expected a host and port, got: %s", raw)
+	}
+	if u.Scheme == mailIMAP || u.Scheme == mailIMAPS {
+		if _, ok := u.User.Password(); !ok {
+			return nil, fmt.Errorf("Expected a user and password to log in with, got: %s", raw)
+		}
+	} else if strings.Trim(u.Path, "/") != "" {
+		return nil, fmt.Errorf("Expected no path for SMTP, got: %s", raw)
+	}
+	return u, nil
+}
+
+// imapMailbox returns the mailbox an IMAP step's URL names, INBOX if none
+func imapMailbox(u *url.URL) string {
+	if mailbox := strings.Trim(u.Path, "/"); mailbox != "" {
+		return mailbox
+	}
+	return "INBOX"
+}
+
+// mailConn is a connection to a mail server, counting the bytes through it
+type mailConn struct {
+	net.Conn
+	in, out uint64
+}
+
+func (c *mailConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.in += uint64(n)
+	return n, err
+}
+
+func (c *mailConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.out += uint64(n)
+	return n, err
+}
+
+// mailError is an error an IMAP server answered a command with, NO or BAD,
+// or an LDAP server a request with, which leaves the connection as it was;
+// SMTP's are textproto.Errors, with the server's reply code.
+type mailError struct {
+	code uint16
+	text string
+}
+
+func (e *mailError) Error() string {
+	return e.text
+}
+
+// dialMail connects to the server at the URL with the attacker's dialer,
+// over TLS for smtps, imaps and ldaps
+func (a *Attacker) dialMail(u *url.URL, timeouts Timeouts) (*mailConn, error) {
+	connect := timeouts.Connect
+	if connect == 0 {
+		connect = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connect)
+	defer cancel()
+	conn, err := a.dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = ErrConnectTimeout
+		}
+		return nil, err
+	}
+	if u.Scheme != mailSMTPS && u.Scheme != mailIMAPS && u.Scheme != ldapTLS {
+		return &mailConn{Conn: conn}, nil
+	}
+	tlsConn := tls.Client(conn, a.mailTLSConfig(u))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &mailConn{Conn: tlsConn}, nil
+}
+
+// mailTLSConfig returns a copy of the attacker's TLS config for the server
+func (a *Attacker) mailTLSConfig(u *url.URL) *tls.Config {
+	config := &tls.Config{}
+	if tr := a.client.Transport.(*http.Transport); tr.TLSClientConfig != nil {
+		config = tr.TLSClientConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = u.Hostname()
+	}
+	config.NextProtos = nil
+	return config
+}
+
+// hitMail times one operation of an SMTP, IMAP or LDAP step, the method of the
+// result. op does it before the deadline, on the step's connection through
+// conn; the result's code is 200 if it did, or the code of the error the
+// server answered with. Any other error closes the connection, and op
+// returns with it nil for the next operation to make a new one.
+func (a *Attacker) hitMail(tgt *Target, method, path string, tm time.Time, requestCount int, conn **mailConn, op func(deadline time.Time) error) *Result {
+	result := &Result{Timestamp: tm, RequestCount: requestCount, Method: method, Path: path}
+	var err error
+	defer func() {
+		result.Latency = time.Since(tm)
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}()
+	if a.limiters != nil {
+		release, ok := a.limiters.acquire(tgt, a.abort)
+		if !ok {
+			err = ErrLimitAborted
+			return result
+		}
+		defer release()
+		tm = time.Now()
+		result.Timestamp = tm
+	}
+	result.InFlight = int(atomic.AddInt64(&inFlight, 1))
+	defer atomic.AddInt64(&inFlight, -1)
+
+	total := a.timeouts.Merge(tgt.Timeouts).Total
+	if total == 0 {
+		total = DefaultTimeout
+	}
+	var in, out uint64
+	if *conn != nil {
+		in, out = (*conn).in, (*conn).out
+	}
+	err = op(tm.Add(total))
+	if *conn != nil {
+		result.BytesIn, result.BytesOut = (*conn).in-in, (*conn).out-out
+	}
+
+	var mailErr *mailError
+	var protoErr *textproto.Error
+	var netErr net.Error
+	switch {
+	case err == nil:
+		result.Code = 200
+	case errors.As(err, &mailErr):
+		result.Code = mailErr.code
+	case errors.As(err, &protoErr):
+		result.Code = uint16(protoErr.Code)
+		err = errors.New(protoErr.Msg)
+	default:
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			err = ErrTotalTimeout
+		}
+		if *conn != nil {
+			(*conn).Close()
+			*conn = nil
+		}
+	}
+	return result
+}
+
+// smtpMessage returns the message an SMTP step sends: the step's headers,
+// with From, To, Date and Message-ID added unless it has them, and its body
+func smtpMessage(config *SMTPConfig, header http.Header, body []byte, id string) []byte {
+	header = header.Clone()
+	defaults := map[string]string{
+		"From":       config.From,
+		"To":         strings.Join(config.To, ", "),
+		"Date":       time.Now().Format(time.RFC1123Z),
+		"Message-Id": "<" + id + "@korra>",
+	}
+	for name, value := range defaults {
+		if header.Get(name) == "" {
+			header.Set(name, value)
+		}
+	}
+	var message strings.Builder
+	header.Write(&message)
+	message.WriteString("\r\n")
+	message.Write(body)
+	return []byte(message.String())
+}
+
+// doSMTP sends the step's messages, each as two results, MAIL for its
+// envelope and DATA for its content; connecting, with CONNECT, and logging
+// in, with AUTH, are results of their own, for the session's connection and
+// any it makes after one fails.
+func (session *Session) doSMTP(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	config := target.SMTP
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => SMTP %s %s", 200, target.URL, config))
+		return
+	}
+	u, err := parseMailURL(target.URL, mailSMTP, mailSMTPS)
+	var body []byte
+	if err == nil {
+		var reader io.Reader
+		if reader, err = target.Body(); err == nil && reader != nil {
+			body, err = io.ReadAll(reader)
+		}
+	}
+	if err != nil {
+		result := &Result{Timestamp: time.Now(), Error: err.Error()}
+		result.PathFromURL(target.URL)
+		session.send(result)
+		return
+	}
+	attacker, path := session.attacker, "/"+mailSMTP
+	timeouts := attacker.timeouts.Merge(target.Timeouts)
+	id := fmt.Sprintf("%012x", attacker.random.Int63n(1<<48))
+
+	var (
+		conn   *mailConn
+		client *smtp.Client
+	)
+	defer func() {
+		if conn != nil {
+			conn.SetDeadline(time.Now().Add(time.Second))
+			client.Quit()
+		}
+	}()
+	// run times an operation and sends its result, returning false if the
+	// step's to stop or the operation failed
+	run := func(method string, requests int, op func(deadline time.Time) error) bool {
+		result := attacker.hitMail(target, method, path, time.Now(), requests, &conn, func(deadline time.Time) error {
+			if conn != nil {
+				conn.SetDeadline(deadline)
+			}
+			return op(deadline)
+		})
+		if result.Error == ErrLimitAborted.Error() {
+			return false
+		}
+		session.debug(fmt.Sprintf("%d => SMTP %s %s, %d/%d, %d ms",
+			result.Code, method, u.Host, requests, config.Messages, int64(result.Latency/time.Millisecond)))
+		session.send(result)
+		return result.Code == 200
+	}
+	for messages := 1; messages <= config.Messages && !session.isAborted(); messages++ {
+		session.Gate.wait(session.aborted)
+		if conn == nil {
+			connected := run("CONNECT", messages, func(deadline time.Time) (err error) {
+				if conn, err = attacker.dialMail(u, timeouts); err != nil {
+					return err
+				}
+				conn.SetDeadline(deadline)
+				if client, err = smtp.NewClient(conn, u.Hostname()); err != nil {
+					return err
+				}
+				if err = client.Hello("korra"); err != nil {
+					return err
+				}
+				if ok, _ := client.Extension("STARTTLS"); ok && u.Scheme == mailSMTP {
+					return client.StartTLS(attacker.mailTLSConfig(u))
+				}
+				return nil
+			})
+			if connected && u.User != nil {
+				password, _ := u.User.Password()
+				connected = run("AUTH", messages, func(time.Time) error {
+					return client.Auth(smtp.PlainAuth("", u.User.Username(), password, u.Hostname()))
+				})
+			}
+			if !connected {
+				if conn != nil {
+					conn.Close()
+					conn = nil
+				}
+				continue
+			}
+		}
+		sent := run("MAIL", messages, func(time.Time) error {
+			if err := client.Mail(config.From); err != nil {
+				return err
+			}
+			for _, to := range config.To {
+				if err := client.Rcpt(to); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if sent {
+			sent = run("DATA", messages, func(time.Time) error {
+				w, err := client.Data()
+				if err != nil {
+					return err
+				}
+				if _, err := w.Write(smtpMessage(config, target.Header, body, fmt.Sprintf("%s.%d", id, messages))); err != nil {
+					return err
+				}
+				return w.Close()
+			})
+		}
+		if !sent && conn != nil {
+			// the server refused the message, so start the next one afresh
+			client.Reset()
+		}
+	}
+}
+
+// imapConn is a connection to an IMAP server, sending tagged commands
+type imapConn struct {
+	*mailConn
+	reader *bufio.Reader
+	tag    int
+}
+
+// imapExists matches the untagged response giving the messages in the
+// mailbox selected
+var imapExists = regexp.MustCompile(`^\* (\d+) EXISTS`)
+
+// imapQuote returns the string as an IMAP quoted string
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// readLine reads a line of a response, with any literals in it, and without
+// its \r\n
+func (c *imapConn) readLine() (string, error) {
+	var line strings.Builder
+	for {
+		part, err := c.reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		part = strings.TrimRight(part, "\r\n")
+		line.WriteString(part)
+		// a literal is {size} at the end of the line, then size bytes
+		open := strings.LastIndexByte(part, '{')
+		if open < 0 || !strings.HasSuffix(part, "}") {
+			return line.String(), nil
+		}
+		size, err := strconv.Atoi(part[open+1 : len(part)-1])
+		if err != nil {
+			return line.String(), nil
+		}
+		if _, err := io.CopyN(io.Discard, c.reader, int64(size)); err != nil {
+			return "", err
+		}
+	}
+}
+
+// command sends the command, tagged, and reads the response until its tagged
+// status, returning the untagged lines before it
+func (c *imapConn) command(command string) ([]string, error) {
+	c.tag++
+	tag := fmt.Sprintf("k%d", c.tag)
+	if _, err := fmt.Fprintf(c, "%s %s\r\n", tag, command); err != nil {
+		return nil, err
+	}
+	var untagged []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, tag+" ") {
+			untagged = append(untagged, line)
+			continue
+		}
+		status := strings.SplitN(line[len(tag)+1:], " ", 2)
+		if strings.EqualFold(status[0], "OK") {
+			return untagged, nil
+		}
+		verb := strings.SplitN(command, " ", 2)[0]
+		return untagged, &mailError{code: 500, text: "IMAP " + verb + " failed: " + line[len(tag)+1:]}
+	}
+}
+
+// doIMAP fetches the newest messages of the step's mailbox its number of
+// times, each FETCH a result of its own; connecting, with CONNECT, logging
+// in, with LOGIN, and selecting the mailbox, with SELECT, are results of
+// their own, for the session's connection and any it makes after one fails.
+func (session *Session) doIMAP(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	config := target.IMAP
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => IMAP %s %s", 200, target.URL, config))
+		return
+	}
+	u, err := parseMailURL(target.URL, mailIMAP, mailIMAPS)
+	if err != nil {
+		result := &Result{Timestamp: time.Now(), Error: err.Error()}
+		result.PathFromURL(target.URL)
+		session.send(result)
+		return
+	}
+	attacker, mailbox := session.attacker, imapMailbox(u)
+	path := "/" + mailIMAP + "/" + mailbox
+	timeouts := attacker.timeouts.Merge(target.Timeouts)
+
+	var (
+		conn   *mailConn
+		client *imapConn
+		exists int
+	)
+	defer func() {
+		if conn != nil {
+			conn.SetDeadline(time.Now().Add(time.Second))
+			client.command("LOGOUT")
+			conn.Close()
+		}
+	}()
+	run := func(method string, requests int, op func(deadline time.Time) error) *Result {
+		result := attacker.hitMail(target, method, path, time.Now(), requests, &conn, func(deadline time.Time) error {
+			if conn != nil {
+				conn.SetDeadline(deadline)
+			}
+			return op(deadline)
+		})
+		if result.Error != ErrLimitAborted.Error() {
+			session.debug(fmt.Sprintf("%d => IMAP %s %s, %d/%d, %d ms",
+				result.Code, method, path, requests, config.Requests, int64(result.Latency/time.Millisecond)))
+			session.send(result)
+		}
+		return result
+	}
+	for requests := 1; requests <= config.Requests && !session.isAborted(); requests++ {
+		session.Gate.wait(session.aborted)
+		if conn == nil {
+			password, _ := u.User.Password()
+			steps := []struct {
+				method string
+				op     func(deadline time.Time) error
+			}{
+				{"CONNECT", func(deadline time.Time) (err error) {
+					if conn, err = attacker.dialMail(u, timeouts); err != nil {
+						return err
+					}
+					conn.SetDeadline(deadline)
+					client = &imapConn{mailConn: conn, reader: bufio.NewReader(conn)}
+					greeting, err := client.readLine()
+					if err != nil {
+						return err
+					} else if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+						return fmt.Errorf("IMAP server refused the connection: %s", greeting)
+					}
+					return nil
+				}},
+				{"LOGIN", func(time.Time) error {
+					_, err := client.command("LOGIN " + imapQuote(u.User.Username()) + " " + imapQuote(password))
+					return err
+				}},
+				{"SELECT", func(time.Time) error {
+					untagged, err := client.command("SELECT " + imapQuote(mailbox))
+					for _, line := range untagged {
+						if found := imapExists.FindStringSubmatch(line); found != nil {
+							exists, _ = strconv.Atoi(found[1])
+						}
+					}
+					return err
+				}},
+			}
+			for _, step := range steps {
+				if result := run(step.method, requests, step.op); result.Code != 200 {
+					if conn != nil {
+						conn.Close()
+						conn = nil
+					}
+					break
+				}
+			}
+			if conn == nil {
+				continue
+			}
+		}
+		result := attacker.hitMail(target, "FETCH", path, time.Now(), requests, &conn, func(deadline time.Time) error {
+			if exists == 0 {
+				return nil
+			}
+			conn.SetDeadline(deadline)
+			from := exists - config.Fetch + 1
+			if from < 1 {
+				from = 1
+			}
+			_, err := client.command(fmt.Sprintf("FETCH %d:%d (BODY.PEEK[])", from, exists))
+			return err
+		})
+		if result.Error == ErrLimitAborted.Error() {
+			return
+		}
+		if exists == 0 && result.Code == 200 {
+			// nothing in the mailbox to fetch
+			result.Code = 404
+		}
+		session.debug(fmt.Sprintf("%d => IMAP FETCH %s, %d/%d, %d ms",
+			result.Code, path, requests, config.Requests, int64(result.Latency/time.Millisecond)))
+		session.send(result)
+	}
+}
@@ -0,0 +1,335 @@
+package korra
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mediaSegment is a piece of a stream a player fetches: its URL and how
+// much of the media it holds (0 for an initialization segment)
+type mediaSegment struct {
+	URL      string
+	Duration time.Duration
+}
+
+// mediaManifest is what a player gets from a manifest: either the URL of
+// the variant it picked, which has the segments, or the segments
+type mediaManifest struct {
+	Variant  string
+	Segments []mediaSegment
+	Sequence int           // number of the first segment, for an HLS playlist
+	Live     bool          // more segments are coming; reload to get them
+	Target   time.Duration // the longest a segment of a live playlist lasts
+}
+
+// parseManifest parses an HLS playlist or a DASH MPD, telling them apart by
+// their first bytes, with URLs resolved against the one it was fetched from
+func parseManifest(body []byte, from string) (*mediaManifest, error) {
+	base, err := url.Parse(from)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(body)
+	if bytes.HasPrefix(trimmed, []byte("#EXTM3U")) {
+		return parseHLS(trimmed, base)
+	}
+	if bytes.HasPrefix(trimmed, []byte("<")) {
+		return parseDASH(trimmed, base)
+	}
+	return nil, fmt.Errorf("not an HLS playlist or a DASH manifest")
+}
+
+// hlsBandwidth finds the BANDWIDTH of a variant in a master playlist
+var hlsBandwidth = regexp.MustCompile(`[:,]BANDWIDTH=(\d+)`)
+
+// parseHLS reads a master playlist, picking its variant with the most
+// bandwidth, or a media playlist's segments
+func parseHLS(body []byte, base *url.URL) (*mediaManifest, error) {
+	var (
+		manifest  = &mediaManifest{Live: true}
+		bandwidth = -1
+		variant   = false // the next URI is a variant to play
+		duration  time.Duration
+		segment   = false // the next URI is a segment
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			bw := 0
+			if match := hlsBandwidth.FindStringSubmatch(line); match != nil {
+				bw, _ = strconv.Atoi(match[1])
+			}
+			// the next URI is the one to play if it has the most so far
+			if variant = bw > bandwidth; variant {
+				bandwidth = bw
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			seconds, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			value, err := strconv.ParseFloat(strings.TrimSpace(seconds), 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad segment duration: %s", line)
+			}
+			duration, segment = time.Duration(value*float64(time.Second)), true
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			manifest.Sequence, _ = strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"))
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			seconds, _ := strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"))
+			manifest.Target = time.Duration(seconds) * time.Second
+		case strings.HasPrefix(line, "#EXT-X-ENDLIST"):
+			manifest.Live = false
+		case strings.HasPrefix(line, "#"):
+		default:
+			resolved, err := base.Parse(line)
+			if err != nil {
+				return nil, fmt.Errorf("bad URI: %s", line)
+			}
+			if variant {
+				manifest.Variant, variant = resolved.String(), false
+			} else if segment {
+				manifest.Segments = append(manifest.Segments, mediaSegment{resolved.String(), duration})
+				segment = false
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if manifest.Variant != "" {
+		manifest.Segments, manifest.Live = nil, false
+	} else if len(manifest.Segments) == 0 && !manifest.Live {
+		return nil, fmt.Errorf("no segments or variants in the playlist")
+	}
+	return manifest, nil
+}
+
+// the parts of a DASH MPD a player needs to find the segments of a
+// representation; the rest is ignored
+type (
+	dashMPD struct {
+		Duration string       `xml:"mediaPresentationDuration,attr"`
+		BaseURL  string       `xml:"BaseURL"`
+		Periods  []dashPeriod `xml:"Period"`
+	}
+	dashPeriod struct {
+		BaseURL string            `xml:"BaseURL"`
+		Sets    []dashAdaptations `xml:"AdaptationSet"`
+	}
+	dashAdaptations struct {
+		MimeType        string               `xml:"mimeType,attr"`
+		ContentType     string               `xml:"contentType,attr"`
+		BaseURL         string               `xml:"BaseURL"`
+		Template        *dashTemplate        `xml:"SegmentTemplate"`
+		Representations []dashRepresentation `xml:"Representation"`
+	}
+	dashRepresentation struct {
+		ID        string        `xml:"id,attr"`
+		Bandwidth int           `xml:"bandwidth,attr"`
+		MimeType  string        `xml:"mimeType,attr"`
+		BaseURL   string        `xml:"BaseURL"`
+		Template  *dashTemplate `xml:"SegmentTemplate"`
+		List      *dashList     `xml:"SegmentList"`
+	}
+	dashTemplate struct {
+		Media          string         `xml:"media,attr"`
+		Initialization string         `xml:"initialization,attr"`
+		StartNumber    *int           `xml:"startNumber,attr"`
+		Duration       float64        `xml:"duration,attr"`
+		Timescale      float64        `xml:"timescale,attr"`
+		Timeline       []dashTimeline `xml:"SegmentTimeline>S"`
+	}
+	dashTimeline struct {
+		T *int64 `xml:"t,attr"`
+		D int64  `xml:"d,attr"`
+		R int    `xml:"r,attr"`
+	}
+	dashList struct {
+		Duration       float64 `xml:"duration,attr"`
+		Timescale      float64 `xml:"timescale,attr"`
+		Initialization struct {
+			SourceURL string `xml:"sourceURL,attr"`
+		} `xml:"Initialization"`
+		URLs []struct {
+			Media string `xml:"media,attr"`
+		} `xml:"SegmentURL"`
+	}
+)
+
+// parseDASH reads the segments of the representation with the most
+// bandwidth in the first video adaptation set (or the first set, if none is
+// video) of the MPD's first period. Dynamic MPDs are read as if static.
+func parseDASH(body []byte, base *url.URL) (*mediaManifest, error) {
+	var mpd dashMPD
+	if err := xml.Unmarshal(body, &mpd); err != nil {
+		return nil, fmt.Errorf("bad DASH manifest: %s", err)
+	}
+	if len(mpd.Periods) == 0 || len(mpd.Periods[0].Sets) == 0 {
+		return nil, fmt.Errorf("no adaptation sets in the DASH manifest")
+	}
+	period := mpd.Periods[0]
+	set := period.Sets[0]
+	for _, s := range period.Sets {
+		if strings.HasPrefix(s.MimeType, "video/") || s.ContentType == "video" {
+			set = s
+			break
+		}
+	}
+	if len(set.Representations) == 0 {
+		return nil, fmt.Errorf("no representations in the DASH manifest")
+	}
+	rep := set.Representations[0]
+	for _, r := range set.Representations[1:] {
+		if r.Bandwidth > rep.Bandwidth {
+			rep = r
+		}
+	}
+	for _, next := range []string{mpd.BaseURL, period.BaseURL, set.BaseURL, rep.BaseURL} {
+		if next = strings.TrimSpace(next); next != "" {
+			resolved, err := base.Parse(next)
+			if err != nil {
+				return nil, fmt.Errorf("bad BaseURL: %s", next)
+			}
+			base = resolved
+		}
+	}
+	resolve := func(ref string) (string, error) {
+		resolved, err := base.Parse(ref)
+		if err != nil {
+			return "", fmt.Errorf("bad segment URL: %s", ref)
+		}
+		return resolved.String(), nil
+	}
+
+	manifest := &mediaManifest{}
+	add := func(ref string, duration time.Duration) error {
+		resolved, err := resolve(ref)
+		if err == nil {
+			manifest.Segments = append(manifest.Segments, mediaSegment{resolved, duration})
+		}
+		return err
+	}
+	if list := rep.List; list != nil {
+		if list.Initialization.SourceURL != "" {
+			if err := add(list.Initialization.SourceURL, 0); err != nil {
+				return nil, err
+			}
+		}
+		duration := dashDuration(list.Duration, list.Timescale)
+		for _, u := range list.URLs {
+			if err := add(u.Media, duration); err != nil {
+				return nil, err
+			}
+		}
+		return manifest, nil
+	}
+
+	template := rep.Template
+	if template == nil {
+		template = set.Template
+	}
+	if template == nil || template.Media == "" {
+		return nil, fmt.Errorf("no SegmentTemplate or SegmentList for representation %s", rep.ID)
+	}
+	fill := func(pattern string, number int, at int64) string {
+		return dashIdentifier.ReplaceAllStringFunc(pattern, func(id string) string {
+			match := dashIdentifier.FindStringSubmatch(id)
+			format := "%d"
+			if match[2] != "" {
+				format = match[2]
+			}
+			switch match[1] {
+			case "":
+				return "$"
+			case "RepresentationID":
+				return rep.ID
+			case "Bandwidth":
+				return fmt.Sprintf(format, rep.Bandwidth)
+			case "Number":
+				return fmt.Sprintf(format, number)
+			case "Time":
+				return fmt.Sprintf(format, at)
+			}
+			return id
+		})
+	}
+	if template.Initialization != "" {
+		if err := add(fill(template.Initialization, 0, 0), 0); err != nil {
+			return nil, err
+		}
+	}
+	number := 1
+	if template.StartNumber != nil {
+		number = *template.StartNumber
+	}
+	if len(template.Timeline) > 0 {
+		var at int64
+		for _, s := range template.Timeline {
+			if s.T != nil {
+				at = *s.T
+			}
+			for i := 0; i <= s.R; i++ {
+				if err := add(fill(template.Media, number, at), dashDuration(float64(s.D), template.Timescale)); err != nil {
+					return nil, err
+				}
+				number++
+				at += s.D
+			}
+		}
+		return manifest, nil
+	}
+	duration := dashDuration(template.Duration, template.Timescale)
+	total, err := isoDuration(mpd.Duration)
+	if err != nil || duration <= 0 {
+		return nil, fmt.Errorf("can't count the segments of representation %s without the durations", rep.ID)
+	}
+	count := int(math.Ceil(float64(total) / float64(duration)))
+	for i := 0; i < count; i++ {
+		if err := add(fill(template.Media, number+i, int64(i)*int64(template.Duration)), duration); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// dashIdentifier matches the $Identifier$ and $Identifier%05d$ in a
+// SegmentTemplate, and $$ for a dollar sign
+var dashIdentifier = regexp.MustCompile(`\$(\w*)(%0\d+d)?\$`)
+
+// dashDuration converts a duration in timescale units to a time.Duration
+func dashDuration(units, timescale float64) time.Duration {
+	if timescale <= 0 {
+		timescale = 1
+	}
+	return time.Duration(units / timescale * float64(time.Second))
+}
+
+// isoPeriod matches the ISO 8601 durations MPDs have, like PT1H2M3.5S
+var isoPeriod = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:([\d.]+)S)?)?$`)
+
+func isoDuration(value string) (time.Duration, error) {
+	match := isoPeriod.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil || value == "P" || value == "PT" {
+		return 0, fmt.Errorf("bad duration: %s", value)
+	}
+	var total float64
+	for i, unit := range []float64{24 * 3600, 3600, 60, 1} {
+		if match[i+1] != "" {
+			n, err := strconv.ParseFloat(match[i+1], 64)
+			if err != nil {
+				return 0, fmt.Errorf("bad duration: %s", value)
+			}
+			total += n * unit
+		}
+	}
+	return time.Duration(total * float64(time.Second)), nil
+}
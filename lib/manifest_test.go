@@ -0,0 +1,130 @@
+package korra
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHLS(t *testing.T) {
+	master := `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360
+low/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2400000,RESOLUTION=1280x720
+high/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=1200000
+mid/index.m3u8
+`
+	manifest, err := parseManifest([]byte(master), "http://cdn/show/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Variant != "http://cdn/show/high/index.m3u8" || len(manifest.Segments) != 0 {
+		t.Fatalf("want the variant with the most bandwidth, got: %+v", manifest)
+	}
+
+	media := `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:7
+#EXTINF:4.0,
+seg7.ts
+#EXTINF:3.5,title
+/abs/seg8.ts
+`
+	if manifest, err = parseManifest([]byte(media), "http://cdn/show/high/index.m3u8"); err != nil {
+		t.Fatal(err)
+	}
+	if !manifest.Live || manifest.Sequence != 7 || manifest.Target != 4*time.Second {
+		t.Fatalf("want a live playlist from 7, got: %+v", manifest)
+	}
+	want := []mediaSegment{{"http://cdn/show/high/seg7.ts", 4 * time.Second}, {"http://cdn/abs/seg8.ts", 3500 * time.Millisecond}}
+	if len(manifest.Segments) != 2 || manifest.Segments[0] != want[0] || manifest.Segments[1] != want[1] {
+		t.Fatalf("bad segments: %+v", manifest.Segments)
+	}
+	if manifest, err = parseManifest([]byte(media+"#EXT-X-ENDLIST\n"), "http://cdn/index.m3u8"); err != nil || manifest.Live {
+		t.Fatalf("want a playlist that ended, got: %+v, %v", manifest, err)
+	}
+
+	for _, bad := range []string{"#EXTM3U\n#EXTINF:x,\nseg.ts", "#EXTM3U\n#EXT-X-ENDLIST", "segments, please"} {
+		if _, err := parseManifest([]byte(bad), "http://cdn/index.m3u8"); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+func TestParseDASH(t *testing.T) {
+	template := `<?xml version="1.0"?>
+<MPD type="static" mediaPresentationDuration="PT0M9.5S">
+  <Period>
+    <AdaptationSet mimeType="audio/mp4">
+      <Representation id="audio" bandwidth="128000"/>
+    </AdaptationSet>
+    <AdaptationSet mimeType="video/mp4">
+      <SegmentTemplate media="$RepresentationID$/seg-$Number%03d$.m4s" initialization="$RepresentationID$/init.mp4" startNumber="0" duration="4000" timescale="1000"/>
+      <Representation id="480p" bandwidth="1000000"/>
+      <Representation id="720p" bandwidth="3000000"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+	manifest, err := parseManifest([]byte(template), "http://cdn/show/stream.mpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mediaSegment{
+		{"http://cdn/show/720p/init.mp4", 0},
+		{"http://cdn/show/720p/seg-000.m4s", 4 * time.Second},
+		{"http://cdn/show/720p/seg-001.m4s", 4 * time.Second},
+		{"http://cdn/show/720p/seg-002.m4s", 4 * time.Second},
+	}
+	if len(manifest.Segments) != len(want) {
+		t.Fatalf("want %d segments, got: %+v", len(want), manifest.Segments)
+	}
+	for i := range want {
+		if manifest.Segments[i] != want[i] {
+			t.Fatalf("want segment %d to be %+v, got: %+v", i, want[i], manifest.Segments[i])
+		}
+	}
+
+	timeline := `<MPD><Period><BaseURL>http://media/</BaseURL><AdaptationSet contentType="video">
+  <Representation id="v" bandwidth="1">
+    <SegmentTemplate media="t$Time$.m4s" timescale="90000">
+      <SegmentTimeline><S t="900" d="180000" r="1"/><S d="90000"/></SegmentTimeline>
+    </SegmentTemplate>
+  </Representation>
+</AdaptationSet></Period></MPD>`
+	if manifest, err = parseManifest([]byte(timeline), "http://cdn/stream.mpd"); err != nil {
+		t.Fatal(err)
+	}
+	want = []mediaSegment{{"http://media/t900.m4s", 2 * time.Second}, {"http://media/t180900.m4s", 2 * time.Second}, {"http://media/t360900.m4s", time.Second}}
+	if len(manifest.Segments) != 3 || manifest.Segments[0] != want[0] || manifest.Segments[1] != want[1] || manifest.Segments[2] != want[2] {
+		t.Fatalf("bad timeline segments: %+v", manifest.Segments)
+	}
+
+	list := `<MPD><Period><AdaptationSet><Representation id="v">
+  <SegmentList duration="6"><Initialization sourceURL="init.mp4"/><SegmentURL media="a.m4s"/><SegmentURL media="b.m4s"/></SegmentList>
+</Representation></AdaptationSet></Period></MPD>`
+	if manifest, err = parseManifest([]byte(list), "http://cdn/v/stream.mpd"); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Segments) != 3 || manifest.Segments[2] != (mediaSegment{"http://cdn/v/b.m4s", 6 * time.Second}) {
+		t.Fatalf("bad list segments: %+v", manifest.Segments)
+	}
+
+	for _, bad := range []string{"<MPD>", "<MPD><Period/></MPD>", `<MPD><Period><AdaptationSet><Representation id="v"/></AdaptationSet></Period></MPD>`} {
+		if _, err := parseManifest([]byte(bad), "http://cdn/stream.mpd"); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+func TestISODuration(t *testing.T) {
+	for value, want := range map[string]time.Duration{"PT1H2M3.5S": time.Hour + 2*time.Minute + 3500*time.Millisecond, "P1D": 24 * time.Hour, "PT30S": 30 * time.Second} {
+		if got, err := isoDuration(value); err != nil || got != want {
+			t.Errorf("want %s for '%s', got: %s, %v", want, value, got, err)
+		}
+	}
+	for _, bad := range []string{"", "P", "PT", "1H", "PT1X"} {
+		if _, err := isoDuration(bad); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
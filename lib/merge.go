@@ -0,0 +1,157 @@
+package korra
+
+import (
+	"container/heap"
+	"io"
+)
+
+// mergeBatch is how many results are decoded, and passed along merged, at
+// a time
+const mergeBatch = 1024
+
+// MergeResults decodes each of the inputs in a goroutine of its own and
+// merges their results into batches in order of timestamp, as long as each
+// input is in order itself -- as result files are, near enough, so reports
+// needn't sort them all after. It passes along errors like Collect, but
+// stops decoding an input after its first.
+func MergeResults(in ...io.Reader) (<-chan Results, <-chan error) {
+	merged := make(chan Results)
+	errs := make(chan error, len(in))
+	sources := make(mergeHeap, 0, len(in))
+	for _, src := range in {
+		source := &mergeSource{batches: make(chan Results, 2)}
+		go source.decode(src, errs)
+		sources = append(sources, source)
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(merged)
+		live := sources[:0]
+		for _, source := range sources {
+			if source.next() {
+				live = append(live, source)
+			}
+		}
+		heap.Init(&live)
+		batch := make(Results, 0, mergeBatch)
+		for len(live) > 0 {
+			source := live[0]
+			batch = append(batch, source.head())
+			if source.next() {
+				heap.Fix(&live, 0)
+			} else {
+				heap.Pop(&live)
+			}
+			if len(batch) == mergeBatch {
+				merged <- batch
+				batch = make(Results, 0, mergeBatch)
+			}
+		}
+		if len(batch) > 0 {
+			merged <- batch
+		}
+	}()
+	return merged, errs
+}
+
+// mergeSource is an input being merged: the batch being merged from it and
+// those decoded ahead of the merge
+type mergeSource struct {
+	batches chan Results
+	batch   Results
+	idx     int
+}
+
+func (s *mergeSource) decode(src io.Reader, errs chan<- error) {
+	defer close(s.batches)
+	dec := newResultDecoder(src)
+	strings := interner{}
+	batch := make(Results, 0, mergeBatch)
+	for {
+		var r Result
+		if err := dec.Decode(&r); err != nil {
+			if err != io.EOF {
+				errs <- err
+			}
+			break
+		}
+		if r.Metadata != nil {
+			continue
+		}
+		strings.result(&r)
+		if batch = append(batch, &r); len(batch) == mergeBatch {
+			s.batches <- batch
+			batch = make(Results, 0, mergeBatch)
+		}
+	}
+	if len(batch) > 0 {
+		s.batches <- batch
+	}
+}
+
+// next moves on to the next result, returning false if there are no more
+func (s *mergeSource) next() bool {
+	if s.idx++; s.idx < len(s.batch) {
+		return true
+	}
+	for batch := range s.batches {
+		if len(batch) > 0 {
+			s.batch, s.idx = batch, 0
+			return true
+		}
+	}
+	return false
+}
+
+func (s *mergeSource) head() *Result { return s.batch[s.idx] }
+
+// maxInterned is the most strings an interner keeps, so that strings few
+// results share, like paths with ids in them, don't make it grow without end
+const maxInterned = 65536
+
+// interner shares the strings results have in common, which would otherwise
+// each have their own copy decoded; with millions of results they're much of
+// a report's memory
+type interner map[string]string
+
+func (in interner) intern(s string) string {
+	if shared, ok := in[s]; ok {
+		return shared
+	}
+	if len(in) < maxInterned {
+		in[s] = s
+	}
+	return s
+}
+
+func (in interner) result(r *Result) {
+	r.Method = in.intern(r.Method)
+	r.Path = in.intern(r.Path)
+	r.Target = in.intern(r.Target)
+	r.Error = in.intern(r.Error)
+	r.DNSResolver = in.intern(r.DNSResolver)
+	r.Fuzz = in.intern(r.Fuzz)
+	r.Abandoned = in.intern(r.Abandoned)
+	if r.Headers != nil {
+		headers := make(map[string]string, len(r.Headers))
+		for name, value := range r.Headers {
+			headers[in.intern(name)] = in.intern(value)
+		}
+		r.Headers = headers
+	}
+}
+
+// mergeHeap orders the sources by the timestamp of their next results
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int            { return len(h) }
+func (h mergeHeap) Less(i, j int) bool  { return h[i].head().Timestamp.Before(h[j].head().Timestamp) }
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeSource)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	source := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return source
+}
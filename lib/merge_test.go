@@ -0,0 +1,115 @@
+package korra
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMergeResults(t *testing.T) {
+	start := time.Unix(1424181720, 0)
+	sources := make([]io.Reader, 3)
+	for i := range sources {
+		var buf bytes.Buffer
+		enc := gob.NewEncoder(&buf)
+		enc.Encode(&Result{Metadata: &Metadata{Session: "user.txt"}})
+		for j := 0; j < 1500; j++ {
+			enc.Encode(&Result{Timestamp: start.Add(time.Duration(j*3+i) * time.Millisecond), Code: uint16(200 + i)})
+		}
+		sources[i] = &buf
+	}
+
+	var merged Results
+	res, errs := MergeResults(sources...)
+	for batch := range res {
+		merged = append(merged, batch...)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if len(merged) != 4500 {
+		t.Fatalf("want all 4500 results, got %d", len(merged))
+	}
+	if !sort.IsSorted(merged) {
+		t.Fatal("want the results merged in order of time")
+	}
+	if merged[0].Code != 200 || merged[1].Code != 201 || merged[2].Code != 202 {
+		t.Fatalf("want the results of the files interleaved, got %d, %d, %d", merged[0].Code, merged[1].Code, merged[2].Code)
+	}
+}
+
+func TestMergeResultsDamaged(t *testing.T) {
+	var buf bytes.Buffer
+	gob.NewEncoder(&buf).Encode(&Result{Code: 200})
+	damaged := bytes.NewReader(buf.Bytes()[:buf.Len()-2])
+
+	res, errs := MergeResults(damaged)
+	for range res {
+	}
+	if err := <-errs; err == nil {
+		t.Fatal("want the error decoding the damaged input")
+	}
+}
+
+func TestMergeResultsUnfinished(t *testing.T) {
+	file, results := checkpointedFile(t, 2500)
+	res, errs := MergeResults(bytes.NewReader(file[:results]))
+	var merged Results
+	for batch := range res {
+		merged = append(merged, batch...)
+	}
+	err := <-errs
+	if !errors.Is(err, ErrUnfinished) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("want a file without its final checkpoint unfinished, got %v", err)
+	}
+	if len(merged) != 2500 {
+		t.Fatalf("want the results before the end kept, got %d", len(merged))
+	}
+}
+
+func TestOpenResults(t *testing.T) {
+	file, err := ioutil.TempFile("", "korra-results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	enc := gob.NewEncoder(file)
+	for i := 0; i < 10; i++ {
+		enc.Encode(&Result{Code: 200, Path: "/users/1"})
+	}
+	file.Close()
+
+	in, err := OpenResults(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, errs := MergeResults(in)
+	var merged Results
+	for batch := range res {
+		merged = append(merged, batch...)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(merged) != 10 || merged[9].Path != "/users/1" {
+		t.Fatalf("want the 10 results back, got %d", len(merged))
+	}
+}
+
+func TestInterner(t *testing.T) {
+	in := interner{}
+	in.result(&Result{Method: "GET", Path: "/users"})
+	in.result(&Result{Method: "GET", Path: "/users"})
+	if len(in) != 3 {
+		t.Fatalf("want the method, path and empty string kept once each, got %v", in)
+	}
+}
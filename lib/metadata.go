@@ -0,0 +1,188 @@
+package korra
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version is the version of korra, set when building a release with
+// -ldflags "-X github.com/cwinters/korra/lib.Version=..."
+var Version = "dev"
+
+// ResultFormat is the version of the result file format written now: 1 is
+// results alone, 2 starts with Metadata, 3 has a Checkpoint every so many
+// results and at the end.
+const ResultFormat = 3
+
+// Metadata describes the attack a result file came from. It's written as
+// the first record of the file, so the file describes itself long after
+// the scripts and command line that made it are gone.
+type Metadata struct {
+	Format   int               `json:"format"`   // of the result file, see ResultFormat
+	Version  string            `json:"version"`  // of korra
+	Session  string            `json:"session"`  // the name of the session's script
+	Sessions int               `json:"sessions"` // how many sessions ran alongside it, including it
+	Hostname string            `json:"hostname"`
+	Started  time.Time         `json:"started"`
+	Settings map[string]string `json:"settings"` // the options the attack was run with, by name
+
+	// Resolution is the window the results were downsampled to, or 0 if
+	// they're as the attack recorded them (see Downsampler)
+	Resolution time.Duration `json:"resolution,omitempty"`
+	// ClockSync is how far the host's clock was from the reference its
+	// timestamps were corrected to, if they were (see SyncClock)
+	ClockSync *ClockSync `json:"clock_sync,omitempty"`
+}
+
+// NewMetadata returns the metadata for an attack starting now, with the
+// number of sessions and the options it was run with.
+func NewMetadata(sessions int, settings map[string]string) *Metadata {
+	hostname, _ := os.Hostname()
+	return &Metadata{
+		Format:   ResultFormat,
+		Version:  Version,
+		Sessions: sessions,
+		Hostname: hostname,
+		Started:  time.Now(),
+		Settings: settings,
+	}
+}
+
+// forSession returns a copy of the metadata for the named session
+func (m *Metadata) forSession(name string) *Metadata {
+	copied := *m
+	copied.Session = name
+	return &copied
+}
+
+// SettingsString returns the settings as name=value, sorted by name
+func (m *Metadata) SettingsString() string {
+	return settingsString(m.Settings)
+}
+
+func (m *Metadata) String() string {
+	return fmt.Sprintf("korra %s on %s, started %s with %d sessions",
+		m.Version, m.Hostname, m.Started.Format(time.RFC3339), m.Sessions)
+}
+
+// ReadMetadata returns the metadata from the start of a result file, or nil
+// if the file was written before result files had it.
+func ReadMetadata(in io.Reader) (*Metadata, error) {
+	var r Result
+	if err := newResultDecoder(in).Decode(&r); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return r.Metadata, nil
+}
+
+// AttackMetadata summarizes the metadata of the result files of one or
+// more attacks: each distinct version, host and start, and the settings
+// they have in common.
+type AttackMetadata struct {
+	Files    int               `json:"files"`
+	Versions []string          `json:"versions"`
+	Hosts    []string          `json:"hosts"`
+	Started  []time.Time       `json:"started"`
+	Settings map[string]string `json:"settings"` // those every file had the same value for
+	// Skew is the most the clocks of the hosts whose clocks were synced
+	// may still differ by, their two largest errors; Unsynced are the
+	// hosts that weren't, whose results may be off by anything.
+	Skew     time.Duration `json:"skew,omitempty"`
+	Unsynced []string      `json:"unsynced,omitempty"`
+}
+
+// SummarizeMetadata summarizes the metadata, skipping nils for files that
+// didn't have any; it returns nil if none of them did.
+func SummarizeMetadata(all []*Metadata) *AttackMetadata {
+	var (
+		summary     = &AttackMetadata{Settings: map[string]string{}}
+		versions    = map[string]bool{}
+		hosts       = map[string]bool{}
+		starts      = map[time.Time]bool{}
+		differ      = map[string]bool{}
+		clockErrors = map[string]time.Duration{}
+		unsynced    = map[string]bool{}
+	)
+	for _, m := range all {
+		if m == nil {
+			continue
+		}
+		if summary.Files == 0 {
+			for name, value := range m.Settings {
+				summary.Settings[name] = value
+			}
+		}
+		summary.Files++
+		versions[m.Version], hosts[m.Hostname], starts[m.Started] = true, true, true
+		if m.ClockSync == nil {
+			unsynced[m.Hostname] = true
+		} else if m.ClockSync.Error > clockErrors[m.Hostname] {
+			clockErrors[m.Hostname] = m.ClockSync.Error
+		}
+		for name, value := range summary.Settings {
+			if m.Settings[name] != value {
+				differ[name] = true
+			}
+		}
+	}
+	if summary.Files == 0 {
+		return nil
+	}
+	for name := range differ {
+		delete(summary.Settings, name)
+	}
+	for version := range versions {
+		summary.Versions = append(summary.Versions, version)
+	}
+	for host := range hosts {
+		summary.Hosts = append(summary.Hosts, host)
+	}
+	for start := range starts {
+		summary.Started = append(summary.Started, start)
+	}
+	var largest []time.Duration
+	for _, err := range clockErrors {
+		largest = append(largest, err)
+	}
+	sort.Slice(largest, func(i, j int) bool { return largest[i] > largest[j] })
+	if len(largest) > 2 {
+		largest = largest[:2]
+	}
+	for _, err := range largest {
+		summary.Skew += err
+	}
+	// a host is only unsynced if none of its files were synced
+	if len(clockErrors) > 0 {
+		for host := range unsynced {
+			if _, synced := clockErrors[host]; !synced {
+				summary.Unsynced = append(summary.Unsynced, host)
+			}
+		}
+	}
+	sort.Strings(summary.Versions)
+	sort.Strings(summary.Hosts)
+	sort.Strings(summary.Unsynced)
+	sort.Slice(summary.Started, func(i, j int) bool { return summary.Started[i].Before(summary.Started[j]) })
+	return summary
+}
+
+// settingsString returns the settings as name=value, sorted by name
+func settingsString(settings map[string]string) string {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pieces := make([]string, len(names))
+	for i, name := range names {
+		pieces[i] = fmt.Sprintf("%s=%s", name, settings[name])
+	}
+	return strings.Join(pieces, " ")
+}
@@ -0,0 +1,96 @@
+package korra
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+)
+
+func TestMetadataRecord(t *testing.T) {
+	var buf bytes.Buffer
+	enc := &ResultEncoder{encoder: newResultEncoder(&buf)}
+	meta := NewMetadata(2, map[string]string{"timeout": "10s"}).forSession("user_1.txt")
+	if err := enc.AddMetadata(meta); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := enc.AddResult(&Result{Code: 200, Path: "/", Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	enc.encoder.finish()
+
+	read, err := ReadMetadata(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read == nil || read.Session != "user_1.txt" || read.Sessions != 2 || read.Settings["timeout"] != "10s" || read.Version != Version {
+		t.Fatalf("want the metadata back, got: %+v", read)
+	}
+
+	results, errs := Collect(bytes.NewReader(buf.Bytes()))
+	count := 0
+	for range results {
+		count++
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("want the 3 results without the metadata, got: %d", count)
+	}
+}
+
+func TestReadMetadataWithout(t *testing.T) {
+	var buf bytes.Buffer
+	gob.NewEncoder(&buf).Encode(&Result{Code: 200})
+	if m, err := ReadMetadata(&buf); err != nil || m != nil {
+		t.Fatalf("want no metadata, got: %v, %v", m, err)
+	}
+}
+
+func TestSummarizeMetadata(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	summary := SummarizeMetadata([]*Metadata{
+		{Version: "1.2", Hostname: "b", Started: start, Settings: map[string]string{"timeout": "10s", "seed": "1"}},
+		nil,
+		{Version: "1.2", Hostname: "a", Started: start, Settings: map[string]string{"timeout": "10s", "seed": "2"}},
+	})
+	if summary.Files != 2 || len(summary.Versions) != 1 || len(summary.Started) != 1 {
+		t.Fatalf("want 2 files from one attack, got: %+v", summary)
+	}
+	if want, got := "a b", summary.Hosts[0]+" "+summary.Hosts[1]; want != got {
+		t.Fatalf("want hosts: %s, got: %s", want, got)
+	}
+	if want, got := "timeout=10s", settingsString(summary.Settings); want != got {
+		t.Fatalf("want settings in common: %s, got: %s", want, got)
+	}
+	if SummarizeMetadata([]*Metadata{nil}) != nil {
+		t.Fatal("want no summary without metadata")
+	}
+}
+
+func TestInspectResults(t *testing.T) {
+	var buf bytes.Buffer
+	enc := &ResultEncoder{encoder: newResultEncoder(&buf)}
+	enc.AddMetadata(NewMetadata(1, map[string]string{}))
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		enc.AddResult(&Result{Code: 200, Path: "/", Timestamp: start.Add(time.Duration(i) * time.Minute)})
+	}
+	results := buf.Len()
+	enc.encoder.finish()
+	info := InspectResults(bytes.NewReader(buf.Bytes()))
+	if info.Err != nil || info.Metadata == nil || info.Format != ResultFormat || info.Records != 3 {
+		t.Fatalf("want an intact file with metadata and 3 results, got: %+v", info)
+	}
+	if !info.First.Equal(start) || !info.Last.Equal(start.Add(2*time.Minute)) {
+		t.Fatalf("want results from %s to %s, got: %s to %s", start, start.Add(2*time.Minute), info.First, info.Last)
+	}
+
+	truncated := InspectResults(bytes.NewReader(buf.Bytes()[:results-5]))
+	if truncated.Err == nil || truncated.Records != 2 {
+		t.Fatalf("want a damaged file with 2 results, got: %+v", truncated)
+	}
+}
@@ -1,6 +1,7 @@
 package korra
 
 import (
+	"sort"
 	"strconv"
 	"time"
 
@@ -16,6 +17,13 @@ type Metrics struct {
 		P95  time.Duration `json:"95th"` // P95 is the 95th percentile upper value
 		P99  time.Duration `json:"99th"` // P99 is the 99th percentile upper value
 		Max  time.Duration `json:"max"`
+		// Exact is whether the percentiles were computed from every latency
+		// rather than estimated, which they are past ExactQuantiles results.
+		Exact bool `json:"exact"`
+		// RankError bounds how far each percentile may be from its quantile
+		// as a fraction of the results: at 0.01 the P95 lies somewhere from
+		// the 94th to the 96th percentile. It's 0 when Exact.
+		RankError float64 `json:"rank_error"`
 	} `json:"latencies"`
 
 	BytesIn struct {
@@ -28,6 +36,115 @@ type Metrics struct {
 		Mean  float64 `json:"mean"`
 	} `json:"bytes_out"`
 
+	DNS struct {
+		Lookups   uint64         `json:"lookups"`
+		Mean      time.Duration  `json:"mean"`
+		Max       time.Duration  `json:"max"`
+		Resolvers map[string]int `json:"resolvers"` // Resolvers counts the lookups answered by each resolver
+	} `json:"dns"`
+
+	// Cache counts the conditional requests sent by the client cache, and
+	// how many of those were answered with a 304 Not Modified.
+	Cache struct {
+		Conditional uint64 `json:"conditional"`
+		NotModified uint64 `json:"not_modified"`
+	} `json:"cache"`
+
+	// Events summarizes the Server-Sent Events read by STREAM steps: the
+	// time until each stream's first event, and the time between events.
+	Events struct {
+		Total        uint64        `json:"total"`
+		FirstMean    time.Duration `json:"first_mean"`
+		IntervalMean time.Duration `json:"interval_mean"`
+		IntervalMax  time.Duration `json:"interval_max"`
+	} `json:"events"`
+
+	// TLS summarizes the TLS handshakes made for new connections: how long
+	// they took and how many of them resumed an earlier session.
+	TLS struct {
+		Handshakes uint64        `json:"handshakes"`
+		Resumed    uint64        `json:"resumed"`
+		Resumption float64       `json:"resumption"` // the ratio of handshakes resumed
+		Mean       time.Duration `json:"mean"`
+		P50        time.Duration `json:"50th"`
+		P95        time.Duration `json:"95th"`
+		P99        time.Duration `json:"99th"`
+		Max        time.Duration `json:"max"`
+	} `json:"tls"`
+
+	// Transfers summarizes the response bodies read to the end (see
+	// Transfers), as the ranges of RANGES steps and the manifests and
+	// segments of PLAYBACK steps always are: the time to their first and
+	// last bytes, and the rate, in bytes per second, the bytes between came
+	// at.
+	Transfers struct {
+		Responses uint64        `json:"responses"`
+		FirstByte DurationStats `json:"first_byte"`
+		LastByte  DurationStats `json:"last_byte"`
+		Rate      struct {
+			Mean float64 `json:"mean"`
+			Min  float64 `json:"min"`
+			P50  float64 `json:"50th"`
+			Max  float64 `json:"max"`
+		} `json:"rate"`
+	} `json:"transfers"`
+
+	// Downloads summarizes the RANGES downloads (see Result.Ranges): how
+	// many there were, the ranges they took between them, and the rate, in
+	// bytes per second, each came at as a whole.
+	Downloads struct {
+		Total  uint64 `json:"total"`
+		Ranges uint64 `json:"ranges"`
+		Rate   struct {
+			Mean float64 `json:"mean"`
+			Min  float64 `json:"min"`
+			Max  float64 `json:"max"`
+		} `json:"rate"`
+	} `json:"downloads"`
+
+	// Playback summarizes the PLAYBACK steps (see Result.Segments): how
+	// many there were, the segments they fetched and how long those took,
+	// the times they rebuffered and stalled for, and how long they took to
+	// start playing.
+	Playback struct {
+		Total            uint64        `json:"total"`
+		Segments         uint64        `json:"segments"`
+		SegmentLatencies DurationStats `json:"segment_latencies"`
+		Rebuffers        uint64        `json:"rebuffers"`
+		Stalled          time.Duration `json:"stalled"`
+		RebufferRatio    float64       `json:"rebuffer_ratio"` // the share of the playbacks' time spent stalled
+		Startup          struct {
+			Mean time.Duration `json:"mean"`
+			Max  time.Duration `json:"max"`
+		} `json:"startup"`
+	} `json:"playback"`
+
+	// Assets summarizes the assets fetched for HTML pages (see
+	// Result.Page): how many there were, the pages they were for, and how
+	// long those took to be complete with them.
+	Assets struct {
+		Total    uint64        `json:"total"`
+		Pages    uint64        `json:"pages"`
+		PageLoad DurationStats `json:"page_load"`
+	} `json:"assets"`
+
+	// Deliveries summarizes the messages PUBLISH steps subscribed to (see
+	// Result.Delivery): how many there were, how many were never
+	// delivered, and how long the rest took to be.
+	Deliveries struct {
+		Total     uint64        `json:"total"`
+		Lost      uint64        `json:"lost"`
+		Latencies DurationStats `json:"latencies"`
+	} `json:"deliveries"`
+
+	// Held counts the LONGPOLL cycles the server held for their whole Hold
+	// without answering (see Result.Held); they're successful requests, but
+	// not under any status code.
+	Held uint64 `json:"held"`
+	// IntegrityErrors counts the responses whose bodies didn't match their
+	// step's checksum (see Result.Corrupt), whatever their status code.
+	IntegrityErrors uint64 `json:"integrity_errors"`
+
 	// Duration is the duration of the attack.
 	Duration time.Duration `json:"duration"`
 	// Wait is the extra time waiting for responses from targets.
@@ -38,61 +155,436 @@ type Metrics struct {
 	Success float64 `json:"success"`
 	// StatusCodes is a histogram of the responses' status codes.
 	StatusCodes map[string]int `json:"status_codes"`
+	// Rcodes is a histogram of the response codes of DNS steps' queries.
+	Rcodes map[string]int `json:"rcodes,omitempty"`
 	// Errors is a set of unique errors returned by the targets during the attack.
 	Errors []string `json:"errors"`
+	// Timeouts counts the requests that timed out by each of TimeoutKinds.
+	Timeouts map[string]int `json:"timeouts"`
+	// CertificateErrors counts the requests that failed because the server's
+	// certificate didn't verify by each of CertificateErrorKinds.
+	CertificateErrors map[string]int `json:"certificate_errors"`
+	// Abandoned counts the sessions whose users gave up (see Abandonment)
+	// by each of AbandonKinds.
+	Abandoned map[string]int `json:"abandoned"`
+	// Headers counts the values of each response header recorded (see
+	// RecordHeaders), by name then value.
+	Headers map[string]map[string]int `json:"headers,omitempty"`
+	// Fuzz counts the status codes of the fuzzed requests (see Fuzz), by the
+	// anomaly they were sent with then code; 0 is no response at all.
+	Fuzz map[string]map[string]int `json:"fuzz,omitempty"`
 }
 
+// ExactQuantiles is the number of results up to which NewMetrics computes
+// percentiles exactly, by sorting every latency; past it they're estimated
+// with a streaming sketch so the time to sort them doesn't grow with them.
+var ExactQuantiles = 100000
+
+// sketchRankError is the rank error the targeted quantile stream keeps its
+// estimates within, its default epsilon
+const sketchRankError = 0.01
+
 // NewMetrics computes and returns a Metrics struct out of a slice of Results.
+// Many results are split among the CPUs, each computing the metrics of its
+// share, which are then merged.
 func NewMetrics(r Results) *Metrics {
-	m := &Metrics{StatusCodes: map[string]int{}}
-
 	if len(r) == 0 {
-		return m
+		return newMetricsShard(r, newQuantiles(0, 0), newQuantiles(0, 0), newTransferShard(0), newPlaybackShard(0), newPageShard(0), newDeliveryShard(0)).m
 	}
 
-	var (
-		errorSet       = map[string]struct{}{}
-		quants         = quantile.NewTargeted(0.50, 0.95, 0.99)
-		totalSuccess   int
-		totalLatencies time.Duration
-		latest         time.Time
-	)
+	count := r.Count()
+	shards := make([]*metricsShard, shardCount(len(r)))
+	forEachShard(len(r), len(shards), func(shard, from, to int) {
+		// the first shard's values are what the rest are merged into
+		size := to - from
+		if shard == 0 {
+			size = count
+		}
+		shards[shard] = newMetricsShard(r[from:to], newQuantiles(count, size), newQuantiles(count, 0), newTransferShard(count), newPlaybackShard(count), newPageShard(count), newDeliveryShard(count))
+	})
+	total := shards[0]
+	for _, shard := range shards[1:] {
+		total.merge(shard)
+	}
+
+	m, quants := total.m, total.quants
+	m.Requests = uint64(total.requests)
+	m.Duration = r[len(r)-1].Timestamp.Sub(r[0].Timestamp)
+	m.Wait = total.latest.Sub(r[len(r)-1].Timestamp)
+	if m.Requests > 0 {
+		m.Latencies.Mean = time.Duration(float64(total.latencies) / float64(m.Requests))
+		m.BytesIn.Mean = float64(m.BytesIn.Total) / float64(m.Requests)
+		m.BytesOut.Mean = float64(m.BytesOut.Total) / float64(m.Requests)
+		m.Success = float64(total.success) / float64(m.Requests)
+	}
+	m.Latencies.P50 = time.Duration(quants.Query(0.50))
+	m.Latencies.P95 = time.Duration(quants.Query(0.95))
+	m.Latencies.P99 = time.Duration(quants.Query(0.99))
+	if _, m.Latencies.Exact = quants.(*exactQuantiles); !m.Latencies.Exact {
+		m.Latencies.RankError = sketchRankError
+	}
+	if total.firstEvents > 0 {
+		m.Events.FirstMean = time.Duration(float64(total.first) / float64(total.firstEvents))
+	}
+	if intervals := m.Events.Total - total.firstEvents; intervals > 0 {
+		m.Events.IntervalMean = time.Duration(float64(total.interval) / float64(intervals))
+	}
+	if m.DNS.Lookups > 0 {
+		m.DNS.Mean = time.Duration(float64(total.dns) / float64(m.DNS.Lookups))
+	}
+	if m.TLS.Handshakes > 0 {
+		m.TLS.Resumption = float64(m.TLS.Resumed) / float64(m.TLS.Handshakes)
+		m.TLS.Mean = time.Duration(float64(total.handshake) / float64(m.TLS.Handshakes))
+		m.TLS.P50 = time.Duration(total.handshakes.Query(0.50))
+		m.TLS.P95 = time.Duration(total.handshakes.Query(0.95))
+		m.TLS.P99 = time.Duration(total.handshakes.Query(0.99))
+	}
+	total.transfers.finish(m)
+	total.playbacks.finish(m)
+	total.pages.finish(m)
+	total.deliveries.finish(m)
+	if m.Downloads.Total > 0 {
+		m.Downloads.Rate.Mean = total.downloadRate / float64(m.Downloads.Total)
+	}
+
+	m.Errors = make([]string, 0, len(total.errorSet))
+	for err := range total.errorSet {
+		m.Errors = append(m.Errors, err)
+	}
+
+	return m
+}
+
+// metricsShard is what the metrics of a share of the results add up from:
+// the counts, totals and maximums in m, and what the rest are computed from
+type metricsShard struct {
+	m            *Metrics
+	quants       quantiles
+	handshakes   quantiles // of the TLS handshakes
+	transfers    *transferShard
+	playbacks    *playbackShard
+	pages        *pageShard
+	deliveries   *deliveryShard
+	errorSet     map[string]struct{}
+	success      int
+	requests     int // the results that aren't events, downloads or playbacks
+	latencies    time.Duration
+	dns          time.Duration
+	handshake    time.Duration
+	firstEvents  uint64
+	first        time.Duration
+	interval     time.Duration
+	latest       time.Time
+	downloadRate float64 // the sum of the downloads' rates
+}
+
+func newMetricsShard(r Results, quants, handshakes quantiles, transfers *transferShard, playbacks *playbackShard, pages *pageShard, deliveries *deliveryShard) *metricsShard {
+	m := &Metrics{StatusCodes: map[string]int{}, Rcodes: map[string]int{}, Timeouts: map[string]int{}, CertificateErrors: map[string]int{}, Abandoned: map[string]int{}, Headers: map[string]map[string]int{}, Fuzz: map[string]map[string]int{}}
+	m.DNS.Resolvers = map[string]int{}
+	for _, kind := range TimeoutKinds {
+		m.Timeouts[kind] = 0
+	}
+	for _, kind := range CertificateErrorKinds {
+		m.CertificateErrors[kind] = 0
+	}
+	for _, kind := range AbandonKinds {
+		m.Abandoned[kind] = 0
+	}
+	s := &metricsShard{m: m, quants: quants, handshakes: handshakes, transfers: transfers, playbacks: playbacks, pages: pages, deliveries: deliveries, errorSet: map[string]struct{}{}}
 
 	for _, result := range r {
-		quants.Insert(float64(result.Latency))
-		m.StatusCodes[strconv.Itoa(int(result.Code))]++
-		totalLatencies += result.Latency
-		m.BytesOut.Total += result.BytesOut
-		m.BytesIn.Total += result.BytesIn
+		// a downsampled result counts as every result it stands for
+		w := result.weight()
+		if end := result.Timestamp.Add(result.Latency); end.After(s.latest) {
+			s.latest = end
+		}
+		// events aren't requests, so they count only towards Events
+		if result.Event > 0 {
+			m.Events.Total += uint64(w)
+			if result.Event == 1 {
+				s.firstEvents += uint64(w)
+				s.first += result.Latency * time.Duration(w)
+			} else {
+				s.interval += result.Latency * time.Duration(w)
+				if result.Latency > m.Events.IntervalMax {
+					m.Events.IntervalMax = result.Latency
+				}
+			}
+			continue
+		}
+		// a download sums up its ranges, which were the requests
+		if result.Ranges > 0 {
+			d := &m.Downloads
+			d.Total += uint64(w)
+			d.Ranges += uint64(result.Ranges * w)
+			rate := result.DownloadRate()
+			s.downloadRate += rate * float64(w)
+			if d.Rate.Min == 0 || rate < d.Rate.Min {
+				d.Rate.Min = rate
+			}
+			if rate > d.Rate.Max {
+				d.Rate.Max = rate
+			}
+			continue
+		}
+		// so does a playback its manifests and segments
+		if result.Segments > 0 {
+			s.playbacks.add(m, result, w)
+			continue
+		}
+		s.requests += w
+		for i := 0; i < w; i++ {
+			quants.Insert(float64(result.Latency))
+		}
+		if result.Held {
+			m.Held += uint64(w)
+		} else {
+			m.StatusCodes[strconv.Itoa(int(result.Code))] += w
+		}
+		if result.Rcode != "" {
+			m.Rcodes[result.Rcode] += w
+		}
+		s.latencies += result.Latency * time.Duration(w)
+		m.BytesOut.Total += result.BytesOut * uint64(w)
+		m.BytesIn.Total += result.BytesIn * uint64(w)
 		if result.Latency > m.Latencies.Max {
 			m.Latencies.Max = result.Latency
 		}
-		if end := result.Timestamp.Add(result.Latency); end.After(latest) {
-			latest = end
+		if result.Conditional {
+			m.Cache.Conditional += uint64(w)
+			if result.NotModified() {
+				m.Cache.NotModified += uint64(w)
+			}
+		}
+		if result.DNSResolver != "" {
+			m.DNS.Lookups += uint64(w)
+			m.DNS.Resolvers[result.DNSResolver] += w
+			s.dns += result.DNSLatency * time.Duration(w)
+			if result.DNSLatency > m.DNS.Max {
+				m.DNS.Max = result.DNSLatency
+			}
 		}
-		if result.Code >= 200 && result.Code < 400 {
-			totalSuccess++
+		if result.TLSHandshake > 0 {
+			m.TLS.Handshakes += uint64(w)
+			if result.TLSResumed {
+				m.TLS.Resumed += uint64(w)
+			}
+			for i := 0; i < w; i++ {
+				handshakes.Insert(float64(result.TLSHandshake))
+			}
+			s.handshake += result.TLSHandshake * time.Duration(w)
+			if result.TLSHandshake > m.TLS.Max {
+				m.TLS.Max = result.TLSHandshake
+			}
+		}
+		s.transfers.add(m, result, w)
+		s.playbacks.add(m, result, w)
+		s.pages.add(m, result, w)
+		s.deliveries.add(m, result, w)
+		for name, value := range result.Headers {
+			m.countHeader(name, value, w)
+		}
+		if result.Abandoned != "" {
+			m.Abandoned[result.Abandoned] += w
+		}
+		if result.Fuzz != "" {
+			countIn(m.Fuzz, result.Fuzz, strconv.Itoa(int(result.Code)), w)
+		}
+		if result.Corrupt {
+			m.IntegrityErrors += uint64(w)
+		} else if result.Held || result.Code >= 200 && result.Code < 400 {
+			s.success += w
 		}
 		if result.Error != "" {
-			errorSet[result.Error] = struct{}{}
+			s.errorSet[result.Error] = struct{}{}
+			if kind := TimeoutKind(result.Error); kind != "" {
+				m.Timeouts[kind] += w
+			} else if kind := CertificateErrorKind(result.Error); kind != "" {
+				m.CertificateErrors[kind] += w
+			}
 		}
 	}
+	return s
+}
 
-	m.Requests = uint64(len(r))
-	m.Duration = r[len(r)-1].Timestamp.Sub(r[0].Timestamp)
-	m.Wait = latest.Sub(r[len(r)-1].Timestamp)
-	m.Latencies.Mean = time.Duration(float64(totalLatencies) / float64(m.Requests))
-	m.Latencies.P50 = time.Duration(quants.Query(0.50))
-	m.Latencies.P95 = time.Duration(quants.Query(0.95))
-	m.Latencies.P99 = time.Duration(quants.Query(0.99))
-	m.BytesIn.Mean = float64(m.BytesIn.Total) / float64(m.Requests)
-	m.BytesOut.Mean = float64(m.BytesOut.Total) / float64(m.Requests)
-	m.Success = float64(totalSuccess) / float64(m.Requests)
+// merge adds the other shard into this one
+func (s *metricsShard) merge(o *metricsShard) {
+	m, om := s.m, o.m
+	s.quants.merge(o.quants)
+	s.handshakes.merge(o.handshakes)
+	s.transfers.merge(m, om, o.transfers)
+	s.playbacks.merge(m, om, o.playbacks)
+	s.pages.merge(m, om, o.pages)
+	s.deliveries.merge(m, om, o.deliveries)
+	for code, count := range om.StatusCodes {
+		m.StatusCodes[code] += count
+	}
+	for rcode, count := range om.Rcodes {
+		m.Rcodes[rcode] += count
+	}
+	for kind, count := range om.Timeouts {
+		m.Timeouts[kind] += count
+	}
+	for kind, count := range om.CertificateErrors {
+		m.CertificateErrors[kind] += count
+	}
+	for kind, count := range om.Abandoned {
+		m.Abandoned[kind] += count
+	}
+	for resolver, count := range om.DNS.Resolvers {
+		m.DNS.Resolvers[resolver] += count
+	}
+	for name, values := range om.Headers {
+		for value, count := range values {
+			m.countHeader(name, value, count)
+		}
+	}
+	for kind, codes := range om.Fuzz {
+		for code, count := range codes {
+			countIn(m.Fuzz, kind, code, count)
+		}
+	}
+	for err := range o.errorSet {
+		s.errorSet[err] = struct{}{}
+	}
+	m.BytesOut.Total += om.BytesOut.Total
+	m.BytesIn.Total += om.BytesIn.Total
+	m.Events.Total += om.Events.Total
+	m.Held += om.Held
+	m.Downloads.Total += om.Downloads.Total
+	m.Downloads.Ranges += om.Downloads.Ranges
+	if om.Downloads.Rate.Min > 0 && (m.Downloads.Rate.Min == 0 || om.Downloads.Rate.Min < m.Downloads.Rate.Min) {
+		m.Downloads.Rate.Min = om.Downloads.Rate.Min
+	}
+	if om.Downloads.Rate.Max > m.Downloads.Rate.Max {
+		m.Downloads.Rate.Max = om.Downloads.Rate.Max
+	}
+	m.IntegrityErrors += om.IntegrityErrors
+	m.Cache.Conditional += om.Cache.Conditional
+	m.Cache.NotModified += om.Cache.NotModified
+	m.DNS.Lookups += om.DNS.Lookups
+	m.TLS.Handshakes += om.TLS.Handshakes
+	m.TLS.Resumed += om.TLS.Resumed
+	if om.Latencies.Max > m.Latencies.Max {
+		m.Latencies.Max = om.Latencies.Max
+	}
+	if om.Events.IntervalMax > m.Events.IntervalMax {
+		m.Events.IntervalMax = om.Events.IntervalMax
+	}
+	if om.DNS.Max > m.DNS.Max {
+		m.DNS.Max = om.DNS.Max
+	}
+	if om.TLS.Max > m.TLS.Max {
+		m.TLS.Max = om.TLS.Max
+	}
+	if o.latest.After(s.latest) {
+		s.latest = o.latest
+	}
+	s.success += o.success
+	s.requests += o.requests
+	s.latencies += o.latencies
+	s.dns += o.dns
+	s.handshake += o.handshake
+	s.firstEvents += o.firstEvents
+	s.first += o.first
+	s.interval += o.interval
+	s.downloadRate += o.downloadRate
+}
 
-	m.Errors = make([]string, 0, len(errorSet))
-	for err := range errorSet {
-		m.Errors = append(m.Errors, err)
+// countHeader counts results with the value of a response header
+func (m *Metrics) countHeader(name, value string, count int) {
+	countIn(m.Headers, name, value, count)
+}
+
+// countIn adds the count of the value under the name to the counts
+func countIn(counts map[string]map[string]int, name, value string, count int) {
+	values := counts[name]
+	if values == nil {
+		values = map[string]int{}
+		counts[name] = values
 	}
+	values[value] += count
+}
 
-	return m
+// quantiles is what the percentiles of the latencies are queried from
+type quantiles interface {
+	Insert(float64)
+	Query(float64) float64
+	merge(quantiles) // adds the other's values, which must be the same type
+}
+
+// newQuantiles returns exact quantiles for up to ExactQuantiles values, and
+// a sketch that estimates them past that; exact ones have room for size
+func newQuantiles(count, size int) quantiles {
+	if count <= ExactQuantiles {
+		return &exactQuantiles{values: make([]float64, 0, size)}
+	}
+	return &sketchQuantiles{}
+}
+
+// sketchQuantiles estimates quantiles in bounded memory. Sketches can't be
+// merged without losing their accuracy, so each shard only gathers its
+// values, and those of the shards merged in are fed to the first one's
+// sketch, from the one goroutine merging them, in their order.
+type sketchQuantiles struct {
+	stream  *quantile.Stream
+	pending []float64 // values not yet in the sketch
+}
+
+func (q *sketchQuantiles) Insert(value float64) {
+	q.pending = append(q.pending, value)
+}
+
+func (q *sketchQuantiles) merge(o quantiles) {
+	q.pending = append(q.pending, o.(*sketchQuantiles).pending...)
+	q.flush()
+}
+
+func (q *sketchQuantiles) Query(at float64) float64 {
+	q.flush()
+	return q.stream.Query(at)
+}
+
+// flush feeds the pending values to the sketch
+func (q *sketchQuantiles) flush() {
+	if q.stream == nil {
+		q.stream = quantile.NewTargeted(0.50, 0.95, 0.99)
+	}
+	for _, value := range q.pending {
+		q.stream.Insert(value)
+	}
+	q.pending = nil
+}
+
+// exactQuantiles keeps every value to find quantiles exactly
+type exactQuantiles struct {
+	values []float64
+	sorted bool
+}
+
+func (q *exactQuantiles) Insert(value float64) {
+	q.values = append(q.values, value)
+	q.sorted = false
+}
+
+func (q *exactQuantiles) merge(o quantiles) {
+	q.values = append(q.values, o.(*exactQuantiles).values...)
+	q.sorted = false
+}
+
+// Query returns the value at the quantile's rank, rounding down, the same as
+// the sketch does before it has to estimate
+func (q *exactQuantiles) Query(at float64) float64 {
+	if len(q.values) == 0 {
+		return 0
+	}
+	if !q.sorted {
+		sort.Float64s(q.values)
+		q.sorted = true
+	}
+	idx := int(float64(len(q.values))*at) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return q.values[idx]
 }
@@ -9,10 +9,10 @@ func TestNewMetrics(t *testing.T) {
 	t.Parallel()
 
 	m := NewMetrics(Results{
-		&Result{500, time.Unix(0, 0), 100 * time.Millisecond, 10, 30, "Internal server error", "GET", "http://foo"},
-		&Result{200, time.Unix(1, 0), 20 * time.Millisecond, 20, 20, "", "GET", "http://foo"},
-		&Result{302, time.Unix(0, 0), 10 * time.Millisecond, 20, 20, "", "GET", "http://foo"},
-		&Result{200, time.Unix(2, 0), 30 * time.Millisecond, 30, 10, "", "GET", "http://foo"},
+		&Result{Code: 500, Timestamp: time.Unix(0, 0), Latency: 100 * time.Millisecond, BytesOut: 10, BytesIn: 30, Error: "Internal server error", Method: "GET", Path: "http://foo"},
+		&Result{Code: 200, Timestamp: time.Unix(1, 0), Latency: 20 * time.Millisecond, BytesOut: 20, BytesIn: 20, Error: "", Method: "GET", Path: "http://foo"},
+		&Result{Code: 302, Timestamp: time.Unix(0, 0), Latency: 10 * time.Millisecond, BytesOut: 20, BytesIn: 20, Error: "", Method: "GET", Path: "http://foo"},
+		&Result{Code: 200, Timestamp: time.Unix(2, 0), Latency: 30 * time.Millisecond, BytesOut: 30, BytesIn: 10, Error: "", Method: "GET", Path: "http://foo"},
 	})
 
 	for field, values := range map[string][]float64{
@@ -62,3 +62,25 @@ func TestNewMetrics(t *testing.T) {
 func TestNewMetricsEmptyResults(t *testing.T) {
 	_ = NewMetrics(Results{}) // Must not panic
 }
+
+func TestMetricsQuantileEstimates(t *testing.T) {
+	defer func(limit int) { ExactQuantiles = limit }(ExactQuantiles)
+	ExactQuantiles = 10
+
+	var r Results
+	for i := 1; i <= 10; i++ {
+		r = append(r, &Result{Timestamp: time.Unix(int64(i), 0), Latency: time.Duration(i) * time.Millisecond})
+	}
+	m := NewMetrics(r)
+	if !m.Latencies.Exact || m.Latencies.RankError != 0 {
+		t.Fatalf("want exact with no rank error, got: %v, %v", m.Latencies.Exact, m.Latencies.RankError)
+	}
+	if want, got := 5*time.Millisecond, m.Latencies.P50; want != got {
+		t.Fatalf("P50; want: %s, got: %s", want, got)
+	}
+
+	m = NewMetrics(append(r, &Result{Timestamp: time.Unix(11, 0), Latency: 11 * time.Millisecond}))
+	if m.Latencies.Exact || m.Latencies.RankError != sketchRankError {
+		t.Fatalf("want estimated with rank error %v, got: %v, %v", sketchRankError, m.Latencies.Exact, m.Latencies.RankError)
+	}
+}
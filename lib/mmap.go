@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package korra
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the file into memory read only, returning what unmaps it
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
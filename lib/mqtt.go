@@ -0,0 +1,265 @@
+package korra
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// the MQTT 3.1.1 control packets a PUBLISH step sends or reads, by type
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttSubscribe  = 8
+	mqttSuback     = 9
+	mqttPingresp   = 13
+	mqttDisconnect = 14
+)
+
+// mqttRefusals are why a broker refused a connection, by CONNACK return code
+var mqttRefusals = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttConn is a connection to an MQTT broker, publishing or subscribed to
+// the step's topic. A subscribed connection's payloads start with the
+// correlation ID and a newline, since MQTT 3.1.1 messages have no
+// properties to carry it in.
+type mqttConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	config    *PublishConfig
+	delivered func(string)
+	packet    uint16      // the ID of the last QoS 1 packet sent
+	acks      chan uint16 // the IDs of the packets acknowledged
+	done      chan struct{}
+	sync.Mutex
+	err error // why the connection was lost, once done is closed
+}
+
+// mqttPacket returns a control packet of the type, with its flags, whose
+// variable header and payload are the body
+func mqttPacket(kind, flags byte, body []byte) []byte {
+	packet := []byte{kind<<4 | flags}
+	// the remaining length is 7 bits a byte, the high bit set on all but the last
+	for size := len(body); ; {
+		digit := byte(size % 128)
+		if size /= 128; size > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if size == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// mqttString writes the string prefixed with its length, as MQTT does
+func mqttString(w *bytes.Buffer, s string) {
+	binary.Write(w, binary.BigEndian, uint16(len(s)))
+	w.WriteString(s)
+}
+
+// readPacket reads the next control packet, returning its type, flags and
+// body
+func (c *mqttConn) readPacket() (byte, byte, []byte, error) {
+	first, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	size, shift := 0, uint(0)
+	for {
+		digit, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		size |= int(digit&0x7f) << shift
+		if digit&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, 0, nil, errors.New("bad MQTT packet length")
+		}
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return first >> 4, first & 0x0f, body, nil
+}
+
+// dialMQTT connects to the broker over the connection as the client, with
+// the URL's user and password, and subscribes if delivered isn't nil.
+func dialMQTT(conn net.Conn, u *url.URL, config *PublishConfig, client string, delivered func(string)) (*mqttConn, error) {
+	c := &mqttConn{conn: conn, reader: bufio.NewReader(conn), config: config, delivered: delivered,
+		acks: make(chan uint16, 16), done: make(chan struct{})}
+
+	var body bytes.Buffer
+	mqttString(&body, "MQTT")
+	flags := byte(0x02) // a clean session
+	password, hasPassword := u.User.Password()
+	if u.User != nil && u.User.Username() != "" {
+		flags |= 0x80
+	}
+	if hasPassword {
+		flags |= 0x40
+	}
+	body.Write([]byte{4, flags, 0, 0}) // version 3.1.1, with no keep alive
+	mqttString(&body, client)
+	if flags&0x80 != 0 {
+		mqttString(&body, u.User.Username())
+	}
+	if hasPassword {
+		mqttString(&body, password)
+	}
+	if _, err := conn.Write(mqttPacket(mqttConnect, 0, body.Bytes())); err != nil {
+		return nil, err
+	}
+	kind, _, reply, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	} else if kind != mqttConnack || len(reply) != 2 {
+		return nil, fmt.Errorf("expected an MQTT CONNACK, got packet type %d", kind)
+	} else if reply[1] != 0 {
+		refusal := mqttRefusals[reply[1]]
+		if refusal == "" {
+			refusal = fmt.Sprintf("return code %d", reply[1])
+		}
+		return nil, brokerError("MQTT connection refused: " + refusal)
+	}
+
+	if delivered != nil {
+		body.Reset()
+		body.Write([]byte{0, 1})
+		mqttString(&body, config.Topic)
+		body.WriteByte(0) // delivered at most once, since only their timing matters
+		if _, err := conn.Write(mqttPacket(mqttSubscribe, 0x02, body.Bytes())); err != nil {
+			return nil, err
+		}
+		kind, _, reply, err := c.readPacket()
+		if err != nil {
+			return nil, err
+		} else if kind != mqttSuback || len(reply) < 3 {
+			return nil, fmt.Errorf("expected an MQTT SUBACK, got packet type %d", kind)
+		} else if reply[2] == 0x80 {
+			return nil, brokerError("MQTT subscription to " + config.Topic + " refused")
+		}
+	}
+	go c.read()
+	return c, nil
+}
+
+// read reads the packets the broker sends until the connection's lost,
+// passing on acknowledgements and the correlation IDs of messages delivered
+func (c *mqttConn) read() {
+	var err error
+	defer func() {
+		c.Lock()
+		c.err = err
+		c.Unlock()
+		close(c.done)
+	}()
+	for {
+		var (
+			kind, flags byte
+			body        []byte
+		)
+		if kind, flags, body, err = c.readPacket(); err != nil {
+			return
+		}
+		switch kind {
+		case mqttPuback:
+			if len(body) >= 2 {
+				select {
+				case c.acks <- binary.BigEndian.Uint16(body):
+				default: // an ack no publish is waiting for any more
+				}
+			}
+		case mqttPublish:
+			if c.delivered == nil || len(body) < 2 {
+				continue
+			}
+			start := 2 + int(binary.BigEndian.Uint16(body))
+			if flags&0x06 != 0 {
+				start += 2 // the packet ID
+			}
+			if start > len(body) {
+				continue
+			}
+			if end := bytes.IndexByte(body[start:], '\n'); end > 0 {
+				c.delivered(string(body[start : start+end]))
+			}
+		case mqttPingresp:
+		}
+	}
+}
+
+// lost returns why the connection was lost
+func (c *mqttConn) lost() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.err == nil || c.err == io.EOF {
+		return errors.New("MQTT connection closed by the broker")
+	}
+	return c.err
+}
+
+func (c *mqttConn) publish(correlation string, payload []byte, deadline time.Time) error {
+	var body bytes.Buffer
+	mqttString(&body, c.config.Topic)
+	flags := byte(0)
+	if c.config.QoS == 1 {
+		flags = 0x02
+		c.packet++
+		if c.packet == 0 {
+			c.packet = 1 // 0 isn't a packet ID
+		}
+		binary.Write(&body, binary.BigEndian, c.packet)
+	}
+	if correlation != "" {
+		body.WriteString(correlation + "\n")
+	}
+	body.Write(payload)
+	c.conn.SetWriteDeadline(deadline)
+	if _, err := c.conn.Write(mqttPacket(mqttPublish, flags, body.Bytes())); err != nil {
+		return err
+	}
+	if c.config.QoS == 0 {
+		return nil
+	}
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+	for {
+		select {
+		case id := <-c.acks:
+			if id == c.packet {
+				return nil
+			}
+		case <-c.done:
+			return c.lost()
+		case <-timeout.C:
+			return errPublishTimeout{}
+		}
+	}
+}
+
+// Close disconnects from the broker
+func (c *mqttConn) Close() error {
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.conn.Write(mqttPacket(mqttDisconnect, 0, nil))
+	return c.conn.Close()
+}
@@ -0,0 +1,131 @@
+package korra
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mqttBroker is an MQTT broker passing the messages published to a topic on
+// to the connections subscribed to it, except every one with drop in it
+type mqttBroker struct {
+	sync.Mutex
+	listener    net.Listener
+	drop        string
+	subscribers map[string][]net.Conn
+	clients     []string
+}
+
+func newMQTTBroker(t *testing.T, drop string) *mqttBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &mqttBroker{listener: listener, drop: drop, subscribers: map[string][]net.Conn{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *mqttBroker) write(conn net.Conn, packet []byte) {
+	b.Lock()
+	conn.Write(packet)
+	b.Unlock()
+}
+
+func (b *mqttBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	c := &mqttConn{conn: conn, reader: bufio.NewReader(conn)}
+	for {
+		kind, flags, body, err := c.readPacket()
+		if err != nil {
+			return
+		}
+		switch kind {
+		case mqttConnect:
+			// the protocol name, version, flags and keep alive come first
+			client := string(body[12 : 12+binary.BigEndian.Uint16(body[10:])])
+			b.Lock()
+			b.clients = append(b.clients, client)
+			b.Unlock()
+			code := byte(0)
+			if bytes.HasSuffix(body, []byte("wrong")) {
+				code = 4
+			}
+			b.write(conn, mqttPacket(mqttConnack, 0, []byte{0, code}))
+		case mqttSubscribe:
+			topic := string(body[4 : 4+binary.BigEndian.Uint16(body[2:])])
+			b.Lock()
+			b.subscribers[topic] = append(b.subscribers[topic], conn)
+			b.Unlock()
+			b.write(conn, mqttPacket(mqttSuback, 0, []byte{body[0], body[1], 0}))
+		case mqttPublish:
+			size := int(binary.BigEndian.Uint16(body))
+			topic, payload := string(body[2:2+size]), body[2+size:]
+			if flags&0x06 != 0 {
+				b.write(conn, mqttPacket(mqttPuback, 0, payload[:2]))
+				payload = payload[2:]
+			}
+			if strings.Contains(string(payload), b.drop) {
+				continue
+			}
+			var forward bytes.Buffer
+			mqttString(&forward, topic)
+			forward.Write(payload)
+			b.Lock()
+			subscribers := b.subscribers[topic]
+			b.Unlock()
+			for _, subscriber := range subscribers {
+				b.write(subscriber, mqttPacket(mqttPublish, 0, forward.Bytes()))
+			}
+		case mqttDisconnect:
+			return
+		}
+	}
+}
+
+func TestMQTT(t *testing.T) {
+	broker := newMQTTBroker(t, "-3\n")
+	defer broker.listener.Close()
+
+	results := runAction(t, fmt.Sprintf("PUBLISH mqtt://korra:secret@%s\n[topic=sensors/1 messages=5 subscribe=true wait=200]", broker.listener.Addr()), 5, (*Session).doPublish, nil)
+	if len(results) != 5 {
+		t.Fatalf("want a result for each message, got %d", len(results))
+	}
+	for i, r := range results {
+		if r.Method != "PUBLISH" || r.Path != "/mqtt/sensors/1" || r.Code != 200 || r.RequestCount != i+1 || r.Error != "" {
+			t.Fatalf("bad MQTT result: %+v", r)
+		}
+		if lost := i == 2; r.Lost != lost || (r.Delivery > 0) == lost {
+			t.Fatalf("want only the third message lost, got #%d: %+v", i+1, r)
+		}
+	}
+	broker.Lock()
+	clients := broker.clients
+	broker.Unlock()
+	if len(clients) != 2 || clients[0] != clients[1]+"-sub" || !strings.HasPrefix(clients[1], "korra-") {
+		t.Fatalf("want a subscriber and a publisher, got: %v", clients)
+	}
+
+	results = runAction(t, fmt.Sprintf("PUBLISH mqtt://%s\n[topic=sensors/2 messages=3 qos=0]", broker.listener.Addr()), 3, (*Session).doPublish, nil)
+	if len(results) != 3 || results[2].Code != 200 || results[2].Delivery != 0 || results[2].Lost {
+		t.Fatalf("want the messages published without timing them, got: %+v", results)
+	}
+
+	results = runAction(t, fmt.Sprintf("PUBLISH mqtt://korra:wrong@%s\n[topic=sensors/1 messages=2]", broker.listener.Addr()), 2, (*Session).doPublish, nil)
+	if len(results) != 2 || results[0].Code != 0 || results[0].Error != "MQTT connection refused: bad user name or password" {
+		t.Fatalf("want the refusal for each message, got: %+v", results)
+	}
+}
@@ -0,0 +1,397 @@
+package korra
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+)
+
+// ParquetRowGroup is how many results go in each row group of a Parquet
+// file, which is how many a ParquetWriter holds in memory at once
+var ParquetRowGroup = 100000
+
+// parquet's physical types, converted types and other enums used here, from
+// its parquet.thrift
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+	parquetNone            = -1
+
+	parquetRequired = 0
+	parquetPlain    = 0
+	parquetRLE      = 3
+	parquetGzip     = 2
+	parquetDataPage = 0
+)
+
+// parquetColumn is a column of the results in a Parquet file, and how each
+// result's value is encoded in it
+type parquetColumn struct {
+	name      string
+	kind      int32
+	converted int32
+	encode    func(page *bytes.Buffer, r *Result)
+}
+
+func int32Column(name string, value func(*Result) int32) parquetColumn {
+	return parquetColumn{name, parquetInt32, parquetNone, func(page *bytes.Buffer, r *Result) {
+		binary.Write(page, binary.LittleEndian, value(r))
+	}}
+}
+
+func int64Column(name string, converted int32, value func(*Result) int64) parquetColumn {
+	return parquetColumn{name, parquetInt64, converted, func(page *bytes.Buffer, r *Result) {
+		binary.Write(page, binary.LittleEndian, value(r))
+	}}
+}
+
+func stringColumn(name string, value func(*Result) string) parquetColumn {
+	return parquetColumn{name, parquetByteArray, parquetUTF8, func(page *bytes.Buffer, r *Result) {
+		s := value(r)
+		binary.Write(page, binary.LittleEndian, uint32(len(s)))
+		page.WriteString(s)
+	}}
+}
+
+// boolColumn writes a byte per value, which are packed into bits when the
+// page is written
+func boolColumn(name string, value func(*Result) bool) parquetColumn {
+	return parquetColumn{name, parquetBoolean, parquetNone, func(page *bytes.Buffer, r *Result) {
+		if value(r) {
+			page.WriteByte(1)
+		} else {
+			page.WriteByte(0)
+		}
+	}}
+}
+
+// parquetColumns are the same as the CSV's, along with whether a request
+// was conditional, its event and its weight; timestamps are in UTC to the
+// microsecond, and latencies in nanoseconds
+var parquetColumns = []parquetColumn{
+	int64Column("timestamp", parquetTimestampMicros, func(r *Result) int64 { return r.Timestamp.UnixNano() / 1000 }),
+	stringColumn("method", func(r *Result) string { return r.Method }),
+	stringColumn("path", func(r *Result) string { return r.Path }),
+	stringColumn("target", func(r *Result) string { return r.Target }),
+	int32Column("code", func(r *Result) int32 { return int32(r.Code) }),
+	int64Column("latency", parquetNone, func(r *Result) int64 { return int64(r.Latency) }),
+	int64Column("bytes_out", parquetNone, func(r *Result) int64 { return int64(r.BytesOut) }),
+	int64Column("bytes_in", parquetNone, func(r *Result) int64 { return int64(r.BytesIn) }),
+	stringColumn("error", func(r *Result) string { return r.Error }),
+	int64Column("dns_latency", parquetNone, func(r *Result) int64 { return int64(r.DNSLatency) }),
+	stringColumn("dns_resolver", func(r *Result) string { return r.DNSResolver }),
+	int32Column("request_count", func(r *Result) int32 { return int32(r.RequestCount) }),
+	boolColumn("conditional", func(r *Result) bool { return r.Conditional }),
+	int32Column("event", func(r *Result) int32 { return int32(r.Event) }),
+	int32Column("weight", func(r *Result) int32 { return int32(r.weight()) }),
+}
+
+// ParquetWriter writes results as a Parquet file, for analyzing very many
+// of them with columnar tools like DuckDB or Spark. It holds a row group of
+// results at a time, writing each column of them as one gzipped page, and the
+// file's footer on Flush; the metadata record is kept in the footer as JSON
+// under korra.metadata. Parquet files can only be written, not read back.
+type ParquetWriter struct {
+	out      *countingWriter
+	buf      *bufio.Writer
+	pages    []*bytes.Buffer // the values of each column in the row group so far
+	rows     int             // in the row group so far
+	total    int64
+	groups   []parquetRowGroup
+	metadata *Metadata
+	finished bool
+}
+
+type parquetRowGroup struct {
+	rows    int
+	size    int64
+	columns []parquetChunk
+}
+
+type parquetChunk struct {
+	offset, uncompressed, compressed int64
+}
+
+// NewParquetWriter returns a writer of a Parquet file to out
+func NewParquetWriter(out io.Writer) *ParquetWriter {
+	buf := bufio.NewWriter(out)
+	w := &ParquetWriter{out: &countingWriter{w: buf}, buf: buf}
+	for range parquetColumns {
+		w.pages = append(w.pages, &bytes.Buffer{})
+	}
+	return w
+}
+
+func (w *ParquetWriter) Write(r *Result) error {
+	if r.Metadata != nil {
+		w.metadata = r.Metadata
+		return nil
+	}
+	for i, column := range parquetColumns {
+		column.encode(w.pages[i], r)
+	}
+	w.rows++
+	if w.rows >= ParquetRowGroup {
+		return w.writeRowGroup()
+	}
+	return nil
+}
+
+// Flush writes the results left and the footer, finishing the file; nothing
+// can be written after it
+func (w *ParquetWriter) Flush() error {
+	if !w.finished {
+		w.finished = true
+		if err := w.writeRowGroup(); err != nil {
+			return err
+		}
+		if err := w.writeFooter(); err != nil {
+			return err
+		}
+	}
+	return w.buf.Flush()
+}
+
+func (w *ParquetWriter) writeRowGroup() error {
+	if w.out.n == 0 {
+		if _, err := w.out.Write([]byte("PAR1")); err != nil {
+			return err
+		}
+	}
+	if w.rows == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: w.rows}
+	for i, column := range parquetColumns {
+		values := w.pages[i].Bytes()
+		if column.kind == parquetBoolean {
+			values = packBits(values)
+		}
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		zw.Write(values)
+		zw.Close()
+
+		header := &thriftWriter{}
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(values)))
+		header.i32(3, int32(compressed.Len()))
+		header.structBegin(5)
+		header.i32(1, int32(w.rows))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.structEnd()
+		header.stop()
+
+		chunk := parquetChunk{
+			offset:       w.out.n,
+			uncompressed: int64(header.buf.Len() + len(values)),
+			compressed:   int64(header.buf.Len() + compressed.Len()),
+		}
+		if _, err := w.out.Write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if _, err := w.out.Write(compressed.Bytes()); err != nil {
+			return err
+		}
+		group.columns = append(group.columns, chunk)
+		group.size += chunk.uncompressed
+		w.pages[i].Reset()
+	}
+	w.groups = append(w.groups, group)
+	w.total += int64(w.rows)
+	w.rows = 0
+	return nil
+}
+
+func (w *ParquetWriter) writeFooter() error {
+	meta := &thriftWriter{}
+	meta.i32(1, 1)
+	meta.listBegin(2, thriftStruct, len(parquetColumns)+1)
+	meta.elemBegin()
+	meta.binary(4, "results")
+	meta.i32(5, int32(len(parquetColumns)))
+	meta.elemEnd()
+	for _, column := range parquetColumns {
+		meta.elemBegin()
+		meta.i32(1, column.kind)
+		meta.i32(3, parquetRequired)
+		meta.binary(4, column.name)
+		if column.converted != parquetNone {
+			meta.i32(6, column.converted)
+		}
+		meta.elemEnd()
+	}
+	meta.i64(3, w.total)
+	meta.listBegin(4, thriftStruct, len(w.groups))
+	for _, group := range w.groups {
+		meta.elemBegin()
+		meta.listBegin(1, thriftStruct, len(group.columns))
+		for i, chunk := range group.columns {
+			column := parquetColumns[i]
+			meta.elemBegin()
+			meta.i64(2, chunk.offset)
+			meta.structBegin(3)
+			meta.i32(1, column.kind)
+			meta.listBegin(2, thriftI32, 2)
+			meta.varint(parquetPlain)
+			meta.varint(parquetRLE)
+			meta.listBegin(3, thriftBinary, 1)
+			meta.string(column.name)
+			meta.i32(4, parquetGzip)
+			meta.i64(5, int64(group.rows))
+			meta.i64(6, chunk.uncompressed)
+			meta.i64(7, chunk.compressed)
+			meta.i64(9, chunk.offset)
+			meta.structEnd()
+			meta.elemEnd()
+		}
+		meta.i64(2, group.size)
+		meta.i64(3, int64(group.rows))
+		meta.elemEnd()
+	}
+	if w.metadata != nil {
+		encoded, err := json.Marshal(w.metadata)
+		if err != nil {
+			return err
+		}
+		meta.listBegin(5, thriftStruct, 1)
+		meta.elemBegin()
+		meta.binary(1, "korra.metadata")
+		meta.binary(2, string(encoded))
+		meta.elemEnd()
+	}
+	meta.binary(6, "korra "+Version)
+	meta.stop()
+
+	if _, err := w.out.Write(meta.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := binary.Write(w.out, binary.LittleEndian, uint32(meta.buf.Len())); err != nil {
+		return err
+	}
+	_, err := w.out.Write([]byte("PAR1"))
+	return err
+}
+
+// packBits packs bytes of 0 or 1 into bits, the first in the lowest
+func packBits(values []byte) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, value := range values {
+		packed[i/8] |= value << uint(i%8)
+	}
+	return packed
+}
+
+// countingWriter counts what's written through it, for the offsets of the
+// pages in the file
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// thrift compact protocol types, as far as Parquet's metadata needs them
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the thrift compact protocol, which is what
+// Parquet's page headers and footer are. Fields must be written in order of
+// their ids within each struct.
+type thriftWriter struct {
+	buf     bytes.Buffer
+	last    int16
+	parents []int16
+}
+
+func (t *thriftWriter) field(id int16, kind byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		t.buf.WriteByte(kind)
+		t.varint(int64(id))
+	}
+	t.last = id
+}
+
+// varint writes a zigzag varint, which is how i16, i32 and i64 are written
+func (t *thriftWriter) varint(n int64) {
+	t.uvarint(uint64(n<<1) ^ uint64(n>>63))
+}
+
+func (t *thriftWriter) uvarint(n uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	t.buf.Write(scratch[:binary.PutUvarint(scratch[:], n)])
+}
+
+func (t *thriftWriter) i32(id int16, n int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(n))
+}
+
+func (t *thriftWriter) i64(id int16, n int64) {
+	t.field(id, thriftI64)
+	t.varint(n)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.string(s)
+}
+
+// string writes a string without a field header, as in a list
+func (t *thriftWriter) string(s string) {
+	t.uvarint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elemBegin()
+}
+
+func (t *thriftWriter) structEnd() { t.elemEnd() }
+
+// listBegin writes the header of a list of size elements of the kind; each
+// one follows, structs between elemBegin and elemEnd
+func (t *thriftWriter) listBegin(id int16, kind byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | kind)
+	} else {
+		t.buf.WriteByte(0xf0 | kind)
+		t.uvarint(uint64(size))
+	}
+}
+
+func (t *thriftWriter) elemBegin() {
+	t.parents = append(t.parents, t.last)
+	t.last = 0
+}
+
+func (t *thriftWriter) elemEnd() {
+	t.stop()
+	t.last = t.parents[len(t.parents)-1]
+	t.parents = t.parents[:len(t.parents)-1]
+}
+
+func (t *thriftWriter) stop() { t.buf.WriteByte(0) }
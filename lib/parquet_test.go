@@ -0,0 +1,130 @@
+package korra
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestParquetWriter(t *testing.T) {
+	defer func(size int) { ParquetRowGroup = size }(ParquetRowGroup)
+	ParquetRowGroup = 2
+
+	var buf bytes.Buffer
+	w := NewParquetWriter(&buf)
+	w.Write(&Result{Metadata: &Metadata{Session: "user_1.txt"}})
+	for i, code := range []uint16{200, 502, 304} {
+		w.Write(&Result{Timestamp: time.Unix(1424181720, 0), Method: "GET", Path: "/", Code: code, Latency: time.Duration(i), Conditional: code == 304})
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := buf.Bytes()
+	if string(file[:4]) != "PAR1" || string(file[len(file)-4:]) != "PAR1" {
+		t.Fatal("want the file to start and end with PAR1")
+	}
+	size := binary.LittleEndian.Uint32(file[len(file)-8:])
+	footer := readThrift(t, bytes.NewReader(file[len(file)-8-int(size):len(file)-8]))
+	if footer[3] != int64(3) {
+		t.Fatalf("want 3 rows, got %v", footer[3])
+	}
+	if schema := footer[2].([]interface{}); len(schema) != len(parquetColumns)+1 {
+		t.Fatalf("want a schema element for the root and each column, got %d", len(schema))
+	}
+	groups := footer[4].([]interface{})
+	if len(groups) != 2 || groups[0].(map[int16]interface{})[3] != int64(2) || groups[1].(map[int16]interface{})[3] != int64(1) {
+		t.Fatalf("want row groups of 2 and 1, got %v", groups)
+	}
+	kv := footer[5].([]interface{})[0].(map[int16]interface{})
+	if kv[1] != "korra.metadata" || !bytes.Contains([]byte(kv[2].(string)), []byte("user_1.txt")) {
+		t.Fatalf("want the metadata in the footer, got %v", kv)
+	}
+
+	// the codes of the first row group, from the page the footer points to
+	codeColumn := 4
+	chunk := groups[0].(map[int16]interface{})[1].([]interface{})[codeColumn].(map[int16]interface{})
+	offset := chunk[3].(map[int16]interface{})[9].(int64)
+	page := bytes.NewReader(file[offset:])
+	header := readThrift(t, page)
+	if header[5].(map[int16]interface{})[1] != int64(2) {
+		t.Fatalf("want a page of 2 values, got %v", header)
+	}
+	compressed := make([]byte, header[3].(int64))
+	page.Read(compressed)
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, _ := ioutil.ReadAll(zr)
+	if len(values) != 8 || binary.LittleEndian.Uint32(values) != 200 || binary.LittleEndian.Uint32(values[4:]) != 502 {
+		t.Fatalf("want codes 200 and 502, got %v", values)
+	}
+}
+
+// readThrift reads a struct in the thrift compact protocol, as far as the
+// Parquet metadata goes, into its fields by id
+func readThrift(t *testing.T, r *bytes.Reader) map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var last int16
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b == 0 {
+			return fields
+		}
+		kind := b & 0x0f
+		if delta := int16(b >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(readZigzag(t, r))
+		}
+		fields[last] = readThriftValue(t, r, kind)
+	}
+}
+
+func readThriftValue(t *testing.T, r *bytes.Reader, kind byte) interface{} {
+	switch kind {
+	case thriftI32, thriftI64:
+		return readZigzag(t, r)
+	case thriftBinary:
+		n, _ := binary.ReadUvarint(r)
+		s := make([]byte, n)
+		r.Read(s)
+		return string(s)
+	case thriftStruct:
+		return readThrift(t, r)
+	case thriftList:
+		b, _ := r.ReadByte()
+		size := uint64(b >> 4)
+		if size == 15 {
+			size, _ = binary.ReadUvarint(r)
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = readThriftValue(t, r, b&0x0f)
+		}
+		return list
+	}
+	t.Fatalf("unexpected thrift type %d", kind)
+	return nil
+}
+
+func readZigzag(t *testing.T, r *bytes.Reader) int64 {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(n>>1) ^ -int64(n&1)
+}
+
+func TestPackBits(t *testing.T) {
+	if packed := packBits([]byte{1, 0, 1, 1, 0, 0, 0, 0, 1}); !bytes.Equal(packed, []byte{0x0d, 0x01}) {
+		t.Fatalf("want 0d 01, got %x", packed)
+	}
+}
@@ -20,16 +20,46 @@ func (bc *BucketCollection) Buckets() []*PathBucket {
 	return bc.buckets
 }
 
+// AddResults adds each result to the bucket it matches. Matching them to the
+// buckets there are already is split among the CPUs; then, in order, they're
+// added, and those that didn't match get a bucket inferred, or the catch-all.
 func (bc *BucketCollection) AddResults(results Results) {
-	for _, result := range results {
-		pathPieces := pathToPieces(result.Path)
-		matchedBucket := bc.findPathBucket(pathPieces, result)
+	existing := len(bc.buckets)
+	matched := make([]*PathBucket, len(results))
+	forEachShard(len(results), shardCount(len(results)), func(_, from, to int) {
+		for i := from; i < to; i++ {
+			matched[i] = bc.matchBucket(bc.buckets[:existing], pathToPieces(results[i].Path), results[i])
+		}
+	})
+
+	for i, result := range results {
+		matchedBucket := matched[i]
 		if matchedBucket == nil {
-			bc.buckets = append(bc.buckets, NewPathBucketFromResult(pathPieces, result))
-		} else {
-			matchedBucket.AddResult(result)
+			// only buckets inferred since could match it now
+			pathPieces := pathToPieces(result.Path)
+			if matchedBucket = bc.matchBucket(bc.buckets[existing:], pathPieces, result); matchedBucket == nil {
+				matchedBucket = bc.catchAllBucket
+			}
+			if matchedBucket == nil {
+				bc.buckets = append(bc.buckets, NewPathBucketFromResult(pathPieces, result))
+				continue
+			}
 		}
+		matchedBucket.AddResult(result)
+	}
+}
+
+// BucketOf returns the bucket the result belongs in without adding it to the
+// bucket, adding a bucket inferred from the result if none matches it and
+// there's no catch-all; it's for sorting results that aren't kept around.
+func (bc *BucketCollection) BucketOf(result *Result) *PathBucket {
+	pathPieces := pathToPieces(result.Path)
+	if bucket := bc.findPathBucket(pathPieces, result); bucket != nil {
+		return bucket
 	}
+	bucket := NewPathBucketFromResult(pathPieces, result)
+	bc.buckets = append(bc.buckets, bucket)
+	return bucket
 }
 
 func (bc *BucketCollection) CatchAllBucket() *PathBucket {
@@ -64,12 +94,20 @@ func (bc *BucketCollection) CreateBucketsFromSpecs(lines []string) error {
 }
 
 func (bc *BucketCollection) findPathBucket(pathPieces []string, result *Result) *PathBucket {
-	for _, bucket := range bc.buckets {
+	if bucket := bc.matchBucket(bc.buckets, pathPieces, result); bucket != nil {
+		return bucket
+	}
+	return bc.catchAllBucket // either actual catch-all or nil is fine as return
+}
+
+// matchBucket returns the first of the buckets the result matches, or nil
+func (bc *BucketCollection) matchBucket(buckets []*PathBucket, pathPieces []string, result *Result) *PathBucket {
+	for _, bucket := range buckets {
 		if bucket.Match(pathPieces, result) {
 			return bucket
 		}
 	}
-	return bc.catchAllBucket // either actual catch-all or nil is fine as return
+	return nil
 }
 
 // PathBucket is a grouping of results by their path and method; each
@@ -132,9 +170,9 @@ func (b *PathBucket) AddResult(result *Result) {
 	// hasn't been seen before; result is off-by-one error in the urls
 	// mapped to the bucket, which isn't a big deal right now (IMO)
 	if val, ok := b.Urls[result.Path]; ok {
-		b.Urls[result.Path] = atomic.AddUint32(&val, 1)
+		b.Urls[result.Path] = atomic.AddUint32(&val, uint32(result.weight()))
 	} else {
-		b.Urls[result.Path] = 1
+		b.Urls[result.Path] = uint32(result.weight())
 	}
 }
 
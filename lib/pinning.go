@@ -0,0 +1,124 @@
+package korra
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sysNodes is where Linux lists the NUMA nodes and their CPUs
+var sysNodes = "/sys/devices/system/node"
+
+// CPUSet is a set of CPUs by number, in order
+type CPUSet []int
+
+// ParseCPUSet parses a list of CPUs and ranges of them the way Linux and
+// taskset write them, like 0-7,16-23
+func ParseCPUSet(s string) (CPUSet, error) {
+	seen := map[int]bool{}
+	for _, part := range strings.Split(strings.TrimSpace(s), ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		low, err := strconv.Atoi(first)
+		if err != nil || low < 0 {
+			return nil, fmt.Errorf("bad CPU %q in %q", part, s)
+		}
+		high := low
+		if isRange {
+			if high, err = strconv.Atoi(last); err != nil || high < low {
+				return nil, fmt.Errorf("bad CPU range %q in %q", part, s)
+			}
+		}
+		for cpu := low; cpu <= high; cpu++ {
+			seen[cpu] = true
+		}
+	}
+	set := make(CPUSet, 0, len(seen))
+	for cpu := range seen {
+		set = append(set, cpu)
+	}
+	sort.Ints(set)
+	return set, nil
+}
+
+// String writes the set the way ParseCPUSet reads it, with runs as ranges
+func (set CPUSet) String() string {
+	var parts []string
+	for i := 0; i < len(set); {
+		j := i
+		for j+1 < len(set) && set[j+1] == set[j]+1 {
+			j++
+		}
+		if j == i {
+			parts = append(parts, strconv.Itoa(set[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", set[i], set[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// NUMANodes returns the CPUs of each of the host's NUMA nodes, in the order
+// of the nodes
+func NUMANodes() ([]CPUSet, error) {
+	lists, err := filepath.Glob(filepath.Join(sysNodes, "node*", "cpulist"))
+	if err != nil {
+		return nil, err
+	}
+	node := func(list string) int {
+		n, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(list)), "node"))
+		return n
+	}
+	sort.Slice(lists, func(i, j int) bool { return node(lists[i]) < node(lists[j]) })
+	var nodes []CPUSet
+	for _, list := range lists {
+		raw, err := os.ReadFile(list)
+		if err != nil {
+			return nil, err
+		}
+		// a node of memory alone has no CPUs
+		if strings.TrimSpace(string(raw)) == "" {
+			continue
+		}
+		set, err := ParseCPUSet(string(raw))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, set)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no NUMA nodes in %s", sysNodes)
+	}
+	return nodes, nil
+}
+
+// CheckPinning returns an error if a thread can't be pinned to the CPUs
+func CheckPinning(set CPUSet) error {
+	done := make(chan error)
+	go func() {
+		// the thread's left locked, so it goes when this does
+		runtime.LockOSThread()
+		done <- pinThread(set)
+	}()
+	if err := <-done; err != nil {
+		return fmt.Errorf("can't pin to CPUs %s: %s", set, err)
+	}
+	return nil
+}
+
+// pin locks the calling goroutine to its thread and the thread to the
+// session's CPUs, if it has any. The thread is never unlocked, so it ends
+// with the goroutine rather than going back to run others on the CPUs.
+func (session *Session) pin() {
+	if len(session.CPUs) == 0 {
+		return
+	}
+	runtime.LockOSThread()
+	if err := pinThread(session.CPUs); err != nil {
+		session.log(fmt.Sprintf("Can't pin to CPUs %s: %s", session.CPUs, err))
+	}
+}
@@ -0,0 +1,25 @@
+package korra
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// CanPin is true where threads can be pinned to CPUs
+const CanPin = true
+
+// pinThread sets the calling thread's CPU affinity to the set
+func pinThread(set CPUSet) error {
+	var mask [1024 / 64]uint64
+	for _, cpu := range set {
+		if cpu >= len(mask)*64 {
+			return syscall.EINVAL
+		}
+		mask[cpu/64] |= 1 << uint(cpu%64)
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package korra
+
+import "errors"
+
+// CanPin is true where threads can be pinned to CPUs
+const CanPin = false
+
+// pinThread isn't available off Linux
+func pinThread(set CPUSet) error {
+	return errors.New("pinning to CPUs needs Linux")
+}
@@ -0,0 +1,55 @@
+package korra
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUSet(t *testing.T) {
+	set, err := ParseCPUSet("8, 0-3,2,10-11\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (CPUSet{0, 1, 2, 3, 8, 10, 11}); !reflect.DeepEqual(set, want) {
+		t.Errorf("want %v, got %v", want, set)
+	}
+	if set.String() != "0-3,8,10-11" {
+		t.Errorf("want 0-3,8,10-11, got %s", set)
+	}
+	for _, bad := range []string{"", "a", "3-1", "-1", "1-b"} {
+		if _, err = ParseCPUSet(bad); err == nil {
+			t.Errorf("want an error parsing %q", bad)
+		}
+	}
+}
+
+func TestNUMANodes(t *testing.T) {
+	defer func(was string) { sysNodes = was }(sysNodes)
+	sysNodes = t.TempDir()
+	for node, cpus := range map[string]string{"node0": "0-3,8-11", "node1": "4-7,12-15", "node2": "", "node10": "16"} {
+		os.MkdirAll(filepath.Join(sysNodes, node), 0755)
+		os.WriteFile(filepath.Join(sysNodes, node, "cpulist"), []byte(cpus+"\n"), 0644)
+	}
+	nodes, err := NUMANodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CPUSet{{0, 1, 2, 3, 8, 9, 10, 11}, {4, 5, 6, 7, 12, 13, 14, 15}, {16}}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("want %v, got %v", want, nodes)
+	}
+}
+
+func TestCheckPinning(t *testing.T) {
+	if !CanPin {
+		t.Skip("pinning needs Linux")
+	}
+	if err := CheckPinning(CPUSet{0}); err != nil {
+		t.Errorf("want CPU 0 pinnable, got %s", err)
+	}
+	if err := CheckPinning(CPUSet{1 << 20}); err == nil {
+		t.Error("want an error pinning to a CPU there can't be")
+	}
+}
@@ -0,0 +1,370 @@
+package korra
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PlaybackConfig defines how a PLAYBACK step plays its URL, an HLS playlist
+// or a DASH manifest, as a video player does: it fetches the segments one
+// after another, as fast as they come until it has Startup buffered to start
+// playing, then only as playing drains the buffer below Buffer, until it's
+// fetched Duration of media or the stream ends.
+type PlaybackConfig struct {
+	Duration int // milliseconds of media to play
+	Buffer   int // milliseconds of media to keep buffered ahead
+	Startup  int // milliseconds of media buffered before playing starts
+}
+
+func NewPlaybackConfig() *PlaybackConfig {
+	return &PlaybackConfig{Duration: 60000, Buffer: 30000, Startup: 2000}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value param=value]
+//
+// and fills itself from the parameters, as:
+//
+//   - duration: The time (in milliseconds) of media to play (default: 60000)
+//   - buffer: The time (in milliseconds) of media to buffer ahead (default: 30000)
+//   - startup: The time (in milliseconds) of media to buffer before playing
+//     starts (default: 2000)
+func (config *PlaybackConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for playback param, got: %s", piece)
+		}
+		num, err := strconv.Atoi(strings.TrimSpace(param[1]))
+		if err != nil || num <= 0 {
+			return fmt.Errorf("Expected positive int for playback param, got: %s", piece)
+		}
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "duration":
+			config.Duration = num
+		case "buffer":
+			config.Buffer = num
+		case "startup":
+			config.Startup = num
+		default:
+			return fmt.Errorf("Unknown playback param: %s", param[0])
+		}
+	}
+	if config.Startup > config.Buffer {
+		return fmt.Errorf("Playback startup can't be more than its buffer")
+	}
+	return nil
+}
+
+func (config *PlaybackConfig) String() string {
+	return fmt.Sprintf("[Duration=%d Buffer=%d Startup=%d]", config.Duration, config.Buffer, config.Startup)
+}
+
+// player keeps track of a playback's buffer as segments come in and time
+// passes, playing what's buffered once there's enough to start with
+type player struct {
+	config    *PlaybackConfig
+	began     time.Time
+	last      time.Time // when the buffer was last played from
+	buffered  time.Duration
+	playing   bool
+	stalled   bool // the buffer ran out and no segment has come since
+	startup   time.Duration
+	stall     time.Duration
+	rebuffers int
+}
+
+func newPlayer(config *PlaybackConfig, began time.Time) *player {
+	return &player{config: config, began: began, last: began}
+}
+
+// advance plays from the buffer until now, stalling if it runs out
+func (p *player) advance(now time.Time) {
+	elapsed := now.Sub(p.last)
+	p.last = now
+	if !p.playing || elapsed <= p.buffered {
+		if p.playing {
+			p.buffered -= elapsed
+		}
+		return
+	}
+	if !p.stalled {
+		p.stalled = true
+		p.rebuffers++
+	}
+	p.stall += elapsed - p.buffered
+	p.buffered = 0
+}
+
+// add buffers a segment of media that came in now, starting playing if
+// there's enough buffered
+func (p *player) add(now time.Time, media time.Duration) {
+	p.advance(now)
+	if media == 0 {
+		return
+	}
+	p.buffered += media
+	p.stalled = false
+	if !p.playing && p.buffered >= p.millis(p.config.Startup) {
+		p.start(now)
+	}
+}
+
+func (p *player) start(now time.Time) {
+	p.playing, p.startup, p.last = true, now.Sub(p.began), now
+}
+
+// full returns how long until the buffer's drained below Buffer, which is
+// when the next segment should be fetched; 0 if it's there already.
+func (p *player) full() time.Duration {
+	if ahead := p.buffered - p.millis(p.config.Buffer); p.playing && ahead > 0 {
+		return ahead
+	}
+	return 0
+}
+
+func (p *player) millis(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+// doPlayback plays the target's stream: it fetches the manifest, and the
+// playlist of the variant it names if it's an HLS master playlist, then the
+// segments as a player would (see PlaybackConfig), reloading a live
+// playlist for more. The manifests and segments are results like any other
+// (the segments marked Segment), and so is the playback as a whole, with the
+// number of segments it took (see Result.Segments).
+func (session *Session) doPlayback(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	config := target.Playback
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => PLAYBACK %s %s %s",
+			200, target.Method, target.URL, config))
+		return
+	}
+
+	session.Gate.wait(session.aborted)
+	began := time.Now()
+	playback := &Result{Timestamp: began, Method: target.Method, RequestCount: 1}
+	playback.PathFromURL(target.URL)
+	player := newPlayer(config, began)
+	requests, failed := 0, 0
+	// fetch gets a manifest or a segment, to be sent once it's checked; only
+	// the step's own URL is fetched with its method, body, saves and checksum
+	fetch := func(url string, manifest bool) (*Result, bool) {
+		tgt := *target
+		if url != target.URL {
+			tgt.URL, tgt.Method, tgt.BodyPath, tgt.body, tgt.Saves, tgt.Checksum = url, "GET", "", nil, nil, nil
+		}
+		tgt.keepBody = manifest
+		requests++
+		result := session.attacker.Hit(func() (*Target, error) { return &tgt, nil }, time.Now(), requests)
+		if result.Error == ErrLimitAborted.Error() {
+			return nil, false
+		}
+		result.Segment = !manifest
+		playback.BytesIn += result.BytesIn
+		playback.Target = result.Target
+		session.debug(fmt.Sprintf("%d => PLAYBACK %s %s, %d bytes, %d ms",
+			result.Code, result.Method, result.Path, result.BytesIn, int64(result.Latency/time.Millisecond)))
+		return result, true
+	}
+	// load gets a manifest; one that can't be parsed fails its result
+	load := func(url string) (*mediaManifest, bool) {
+		result, ok := fetch(url, true)
+		if !ok {
+			return nil, false
+		}
+		defer session.send(result)
+		playback.Code = result.Code
+		if result.Error != "" {
+			return nil, true
+		}
+		manifest, err := parseManifest(result.body, url)
+		if err != nil {
+			result.Error = err.Error()
+			return nil, true
+		}
+		return manifest, true
+	}
+
+	playlist := target.URL
+	manifest, ok := load(playlist)
+	if ok && manifest != nil && manifest.Variant != "" {
+		playlist = manifest.Variant
+		manifest, ok = load(playlist)
+	}
+	if manifest == nil {
+		return // the manifest's result says why
+	}
+
+	var (
+		wanted   = player.millis(config.Duration)
+		fetched  time.Duration
+		next     = manifest.Sequence // of the segment after the last in segments
+		segments = manifest.Segments
+	)
+	next += len(segments)
+	wait := func(d time.Duration) bool {
+		select {
+		case <-time.After(d):
+			return true
+		case <-session.aborted:
+			return false
+		}
+	}
+	for fetched < wanted && !session.isAborted() {
+		if len(segments) == 0 {
+			if !manifest.Live {
+				break
+			}
+			reload := manifest.Target
+			if reload == 0 {
+				reload = time.Second
+			}
+			if !wait(reload) {
+				break
+			}
+			if manifest, ok = load(playlist); manifest == nil {
+				break
+			}
+			if skip := next - manifest.Sequence; skip < len(manifest.Segments) {
+				if skip < 0 {
+					skip = 0 // fell behind the live edge
+				}
+				segments = manifest.Segments[skip:]
+				next = manifest.Sequence + len(manifest.Segments)
+			}
+			if len(segments) == 0 {
+				break // a live playlist that stopped changing has ended
+			}
+			continue
+		}
+		if full := player.full(); full > 0 && !wait(full) {
+			break
+		}
+		segment := segments[0]
+		segments = segments[1:]
+		session.Gate.wait(session.aborted)
+		result, ok := fetch(segment.URL, false)
+		if !ok {
+			break
+		}
+		session.send(result)
+		playback.Segments++
+		fetched += segment.Duration
+		if result.Error != "" {
+			failed++
+			player.advance(time.Now())
+			continue
+		}
+		player.add(time.Now(), segment.Duration)
+	}
+
+	// watch what's left in the buffer
+	if !player.playing && player.buffered > 0 {
+		player.start(time.Now())
+	}
+	if player.playing && player.buffered > 0 && wait(player.buffered) {
+		player.advance(player.last.Add(player.buffered))
+	}
+	if playback.Segments == 0 {
+		return // nothing was played
+	}
+	playback.Latency = time.Since(began)
+	playback.Rebuffers, playback.Stalled, playback.Startup = player.rebuffers, player.stall, player.startup
+	if failed > 0 {
+		playback.Error = fmt.Sprintf("%d of %d segments failed", failed, playback.Segments)
+	}
+	session.debug(fmt.Sprintf("PLAYBACK %s %s: %d segments, %d ms to start, %d rebuffers stalling %d ms, %d ms",
+		playback.Method, playback.Path, playback.Segments, int64(playback.Startup/time.Millisecond),
+		playback.Rebuffers, int64(playback.Stalled/time.Millisecond), int64(playback.Latency/time.Millisecond)))
+	session.send(playback)
+}
+
+// RebufferRatio returns the share of a PLAYBACK step's time spent stalled
+// waiting for segments, or 0 if the result isn't one.
+func (r *Result) RebufferRatio() float64 {
+	if r.Segments == 0 || r.Latency <= 0 {
+		return 0
+	}
+	return float64(r.Stalled) / float64(r.Latency)
+}
+
+// playbackShard is what a metrics shard adds up the playbacks from
+type playbackShard struct {
+	segmentLatencies quantiles
+	segmentLatency   time.Duration
+	played, startup  time.Duration // the playbacks' time, and to start
+}
+
+func newPlaybackShard(count int) *playbackShard {
+	return &playbackShard{segmentLatencies: newQuantiles(count, 0)}
+}
+
+// add counts a segment, or a playback as a whole, towards the playbacks
+func (ps *playbackShard) add(m *Metrics, result *Result, w int) {
+	p := &m.Playback
+	if result.Segment {
+		p.Segments += uint64(w)
+		ps.segmentLatency += result.Latency * time.Duration(w)
+		for i := 0; i < w; i++ {
+			ps.segmentLatencies.Insert(float64(result.Latency))
+		}
+		if result.Latency > p.SegmentLatencies.Max {
+			p.SegmentLatencies.Max = result.Latency
+		}
+		return
+	}
+	if result.Segments == 0 {
+		return
+	}
+	p.Total += uint64(w)
+	p.Rebuffers += uint64(result.Rebuffers * w)
+	p.Stalled += result.Stalled * time.Duration(w)
+	ps.played += result.Latency * time.Duration(w)
+	ps.startup += result.Startup * time.Duration(w)
+	if result.Startup > p.Startup.Max {
+		p.Startup.Max = result.Startup
+	}
+}
+
+func (ps *playbackShard) merge(m, om *Metrics, o *playbackShard) {
+	p, op := &m.Playback, &om.Playback
+	ps.segmentLatencies.merge(o.segmentLatencies)
+	ps.segmentLatency += o.segmentLatency
+	ps.played += o.played
+	ps.startup += o.startup
+	p.Total += op.Total
+	p.Segments += op.Segments
+	p.Rebuffers += op.Rebuffers
+	p.Stalled += op.Stalled
+	if op.SegmentLatencies.Max > p.SegmentLatencies.Max {
+		p.SegmentLatencies.Max = op.SegmentLatencies.Max
+	}
+	if op.Startup.Max > p.Startup.Max {
+		p.Startup.Max = op.Startup.Max
+	}
+}
+
+// finish computes the means, ratio and percentiles of the playbacks
+func (ps *playbackShard) finish(m *Metrics) {
+	p := &m.Playback
+	if p.Segments > 0 {
+		p.SegmentLatencies.Mean = time.Duration(float64(ps.segmentLatency) / float64(p.Segments))
+		p.SegmentLatencies.P50 = time.Duration(ps.segmentLatencies.Query(0.50))
+		p.SegmentLatencies.P95 = time.Duration(ps.segmentLatencies.Query(0.95))
+		p.SegmentLatencies.P99 = time.Duration(ps.segmentLatencies.Query(0.99))
+	}
+	if p.Total > 0 {
+		p.Startup.Mean = time.Duration(float64(ps.startup) / float64(p.Total))
+	}
+	if ps.played > 0 {
+		p.RebufferRatio = float64(p.Stalled) / float64(ps.played)
+	}
+}
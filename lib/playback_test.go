@@ -0,0 +1,131 @@
+package korra
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlaybackConfig(t *testing.T) {
+	action := &SessionAction{Raw: "PLAYBACK GET http://cdn/master.m3u8\n[duration=120000 buffer=10000]", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	if got := action.Target.Playback.String(); got != "[Duration=120000 Buffer=10000 Startup=2000]" {
+		t.Fatalf("bad playback config: %s", got)
+	}
+	for _, bad := range []string{"[duration=0]", "[buffer=1000 startup=2000]", "[speed=1]", "[startup]"} {
+		action = &SessionAction{Raw: "PLAYBACK GET http://cdn/master.m3u8\n" + bad, Line: 1}
+		if err := action.CreateTarget("."); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	began := time.Now()
+	at := func(ms int) time.Time { return began.Add(time.Duration(ms) * time.Millisecond) }
+	p := newPlayer(&PlaybackConfig{Duration: 60000, Buffer: 8000, Startup: 4000}, began)
+
+	p.add(at(500), 2*time.Second)
+	if p.playing {
+		t.Fatal("want no playing before the startup is buffered")
+	}
+	p.add(at(1000), 2*time.Second)
+	if !p.playing || p.startup != time.Second || p.buffered != 4*time.Second {
+		t.Fatalf("want playing a sec in with 4 sec buffered, got: %+v", p)
+	}
+	p.add(at(2000), 6*time.Second)
+	if p.buffered != 9*time.Second || p.full() != time.Second {
+		t.Fatalf("want 9 sec buffered, a sec over the buffer, got: %s, %s", p.buffered, p.full())
+	}
+	// the next segment takes 12 sec, 3 more than was buffered
+	p.add(at(14000), 2*time.Second)
+	if p.rebuffers != 1 || p.stall != 3*time.Second || p.buffered != 2*time.Second {
+		t.Fatalf("want a 3 sec rebuffer, got: %d, %s, %s buffered", p.rebuffers, p.stall, p.buffered)
+	}
+	// a failed segment doesn't end the stall
+	p.advance(at(17000))
+	p.advance(at(18000))
+	p.add(at(19000), 2*time.Second)
+	if p.rebuffers != 2 || p.stall != 6*time.Second {
+		t.Fatalf("want one more rebuffer, of 3 sec, got: %d, %s", p.rebuffers, p.stall)
+	}
+}
+
+func TestPlayback(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/master.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=100\nlow.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=900\nhigh.m3u8\n")
+		case "/high.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n")
+			for i := 0; i < 4; i++ {
+				fmt.Fprintf(w, "#EXTINF:0.05,\nseg%d.ts\n", i)
+			}
+			fmt.Fprint(w, "#EXT-X-ENDLIST\n")
+		case "/seg2.ts":
+			http.Error(w, "gone", http.StatusNotFound)
+		default:
+			time.Sleep(5 * time.Millisecond)
+			w.Write([]byte(strings.Repeat("x", 1000)))
+		}
+	}))
+	defer server.Close()
+
+	action := &SessionAction{Raw: "PLAYBACK GET " + server.URL + "/master.m3u8\n[duration=150 buffer=100 startup=50]", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{attacker: NewAttacker(), aborted: make(chan struct{}), results: make(chan *Result, 10)}
+	session.doPlayback(action)
+	close(session.results)
+	var results Results
+	for result := range session.results {
+		results = append(results, result)
+	}
+
+	if got := strings.Join(requests, ", "); got != "GET /master.m3u8, GET /high.m3u8, GET /seg0.ts, GET /seg1.ts, GET /seg2.ts" {
+		t.Fatalf("want the variant and 150 ms of its segments, got: %s", got)
+	}
+	if len(results) != 6 {
+		t.Fatalf("want a result a request and one for the playback, got %d", len(results))
+	}
+	for i, r := range results[:5] {
+		if r.Segment != (i >= 2) || r.RequestCount != i+1 || r.LastByte == 0 {
+			t.Fatalf("want the manifests then the segments, read to the end, got: %+v", r)
+		}
+	}
+	playback := results[5]
+	if playback.Segments != 3 || playback.Error != "1 of 3 segments failed" || playback.Startup <= 0 || playback.BytesIn < 2000 {
+		t.Fatalf("want the playback summed up, got: %+v", playback)
+	}
+	if playback.Latency < 100*time.Millisecond {
+		t.Fatalf("want the buffered segments played out, got: %s", playback.Latency)
+	}
+
+	m := NewMetrics(results)
+	if m.Requests != 5 || m.Playback.Total != 1 || m.Playback.Segments != 3 || m.Playback.SegmentLatencies.Max == 0 {
+		t.Fatalf("want the manifests and segments counted as the requests, got: %d requests, %+v", m.Requests, m.Playback)
+	}
+	if m.Playback.Startup.Mean != playback.Startup || m.Playback.RebufferRatio != playback.RebufferRatio() {
+		t.Fatalf("bad playback metrics: %+v", m.Playback)
+	}
+
+	// a manifest that isn't one fails, with no playback
+	action = &SessionAction{Raw: "PLAYBACK GET " + server.URL + "/seg0.ts", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	session.results = make(chan *Result, 10)
+	session.doPlayback(action)
+	close(session.results)
+	if first, more := <-session.results, len(session.results); first.Error != "not an HLS playlist or a DASH manifest" || more != 0 {
+		t.Fatalf("want only the manifest's failed result, got: %+v and %d more", first, more)
+	}
+}
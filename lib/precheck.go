@@ -0,0 +1,143 @@
+package korra
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrecheckConcurrency is how many precheck requests are in flight at once
+var PrecheckConcurrency = 16
+
+// PrecheckReport holds the result of hitting every unique bucket of
+// targets once before the attack begins.
+type PrecheckReport struct {
+	Results  map[string]*Result // bucket key => its result
+	Failures []string           // bucket keys that failed, sorted
+	Skipped  []string           // bucket keys with values only known at run time, sorted
+}
+
+// FailureRate returns the percentage of buckets whose request failed
+func (p *PrecheckReport) FailureRate() float64 {
+	if len(p.Results) == 0 {
+		return 0
+	}
+	return float64(len(p.Failures)) / float64(len(p.Results)) * 100
+}
+
+func (p *PrecheckReport) String() string {
+	out := fmt.Sprintf("Precheck: %d/%d buckets failed (%.2f%%)",
+		len(p.Failures), len(p.Results), p.FailureRate())
+	if len(p.Skipped) > 0 {
+		out += fmt.Sprintf(", %d skipped for feed or var references", len(p.Skipped))
+	}
+	return out
+}
+
+// precheckable methods are the ones we can send without worrying about
+// creating or changing anything on the server
+func precheckable(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+// unbound returns true if the target refers to feed or var values, which
+// aren't known until a session claims a row or sets the var
+func unbound(tgt *Target) bool {
+	if feedReference.MatchString(tgt.URL) {
+		return true
+	}
+	if tgt.Checksum != nil && feedReference.MatchString(tgt.Checksum.Expected) {
+		return true
+	}
+	for _, vs := range tgt.Header {
+		for _, v := range vs {
+			if feedReference.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bucketKey groups a target with every other target that has the same
+// method and host, and a path that varies only by digit-only pieces -- the
+// same way we infer buckets from results.
+func bucketKey(tgt *Target) string {
+	host := ""
+	if u, err := url.Parse(tgt.URL); err == nil {
+		host = u.Host
+	}
+	result := Result{Path: tgt.URL}
+	result.PathFromURL(tgt.URL)
+	pieces := pathToPieces(result.Path)
+	for idx, piece := range pieces {
+		if digitsPiece.MatchString(piece) {
+			pieces[idx] = "*"
+		}
+	}
+	return fmt.Sprintf("%s %s/%s", tgt.Method, host, strings.Join(pieces, "/"))
+}
+
+// Precheck sends one request for each unique bucket of GET, HEAD and OPTIONS
+// targets in the scripts, using an Attacker created with the options, so a
+// misconfigured environment can be caught before a long run against it.
+// Streaming and long polling targets are skipped since they'd hold the
+// precheck up for as long as the server holds them, ranged downloads since
+// they'd fetch the whole object, playbacks since they'd play the whole
+// stream, and crawls since they'd load the whole site. So are targets with ${feed.column} or ${vars.name} references,
+// which can't be filled in before the sessions run; the report lists those.
+func Precheck(scripts []*SessionScript, opts []func(*Attacker)) *PrecheckReport {
+	report := &PrecheckReport{Results: map[string]*Result{}}
+	targets := map[string]*Target{}
+	skipped := map[string]bool{}
+	for _, script := range scripts {
+		for _, action := range script.Actions {
+			tgt := action.Target
+			if tgt == nil || tgt.Method == "" || !precheckable(tgt.Method) || tgt.IsStream() || tgt.IsLongPoll() || tgt.IsRanges() || tgt.IsPlayback() || tgt.IsCrawl() {
+				continue
+			}
+			key := bucketKey(tgt)
+			if unbound(tgt) {
+				if !skipped[key] {
+					skipped[key] = true
+					report.Skipped = append(report.Skipped, key)
+				}
+			} else if targets[key] == nil {
+				targets[key] = tgt
+			}
+		}
+	}
+	sort.Strings(report.Skipped)
+
+	// the client cache isn't safe for concurrent use, and we don't want it anyway
+	attackerOpts := append(append([]func(*Attacker){}, opts...), ClientCache(false))
+	attacker := NewAttacker(attackerOpts...)
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, PrecheckConcurrency)
+	)
+	for key, tgt := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key string, tgt *Target) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result := attacker.Hit(func() (*Target, error) { return tgt, nil }, time.Now(), 1)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Results[key] = result
+			if result.Error != "" {
+				report.Failures = append(report.Failures, key)
+			}
+		}(key, tgt)
+	}
+	wg.Wait()
+	sort.Strings(report.Failures)
+	return report
+}
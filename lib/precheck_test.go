@@ -0,0 +1,84 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPrecheck(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			if strings.HasPrefix(r.URL.Path, "/broken") {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}),
+	)
+	defer server.Close()
+	var actions []*SessionAction
+	for _, raw := range []string{
+		"GET " + server.URL + "/items/1",
+		"GET " + server.URL + "/items/2",
+		"POST " + server.URL + "/items",
+		"GET " + server.URL + "/broken",
+	} {
+		action := &SessionAction{Raw: raw}
+		if err := action.CreateTarget("."); err != nil {
+			t.Fatal(err)
+		}
+		actions = append(actions, action)
+	}
+
+	report := Precheck([]*SessionScript{{Actions: actions}}, nil)
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Fatalf("got %d requests, want 2", got)
+	}
+	if len(report.Failures) != 1 || !strings.HasSuffix(report.Failures[0], "/broken") {
+		t.Fatalf("got failures %v, want just /broken", report.Failures)
+	}
+	if got := report.FailureRate(); got != 50 {
+		t.Fatalf("got failure rate %.2f, want 50", got)
+	}
+}
+
+func TestPrecheckSkipsReferences(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			if strings.Contains(r.URL.Path, "$") {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}),
+	)
+	defer server.Close()
+	script := "FEED users\n" +
+		"GET " + server.URL + "/users/${users.id}\n" +
+		"GET " + server.URL + "/carts/${vars.cart}\n" +
+		"GET " + server.URL + "/items\n" +
+		"X-Token: ${users.token}\n"
+	actions, err := ScanActions(strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range actions {
+		if err := action.CreateTarget("."); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := Precheck([]*SessionScript{{Actions: actions}}, nil)
+	if got := atomic.LoadInt32(&hits); got != 0 {
+		t.Fatalf("got %d requests, want none for targets with references", got)
+	}
+	if len(report.Failures) != 0 || len(report.Skipped) != 3 {
+		t.Fatalf("got failures %v and skipped %v, want 3 skipped", report.Failures, report.Skipped)
+	}
+	if got := report.String(); !strings.HasSuffix(got, "3 skipped for feed or var references") {
+		t.Fatalf("got %q, want the skipped count", got)
+	}
+}
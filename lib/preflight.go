@@ -0,0 +1,121 @@
+package korra
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procSys is where Linux keeps its sysctls
+var procSys = "/proc/sys"
+
+// preflightSpareFiles are the files an attack has open besides its
+// connections and result files: logs, feeds, the control API and so on
+const preflightSpareFiles = 64
+
+// PreflightLoad is what an attack will ask of the host it runs on
+type PreflightLoad struct {
+	Sessions  int  // the most sessions running at once
+	Conns     int  // the most connections each session holds at once
+	KeepAlive bool // whether connections are reused
+}
+
+// PreflightCheck is how a limit of the host compares to what the load
+// needs of it. A limit that can't be read isn't checked.
+type PreflightCheck struct {
+	Name   string
+	Have   int64
+	Need   int64
+	OK     bool
+	Raised bool   // whether Have was raised to meet Need
+	Advice string // how to raise it, when it isn't OK
+}
+
+func (c PreflightCheck) String() string {
+	switch {
+	case c.Raised:
+		return fmt.Sprintf("%s: raised to %d, need %d", c.Name, c.Have, c.Need)
+	case c.OK:
+		return fmt.Sprintf("%s: have %d, need %d", c.Name, c.Have, c.Need)
+	}
+	return fmt.Sprintf("%s: have %d, need %d; %s", c.Name, c.Have, c.Need, c.Advice)
+}
+
+// Preflight checks the host has the file descriptors, ephemeral ports and
+// connection tracking room the load needs, before an attack begins; run out
+// of any and requests fail with errors that look like the target's. The
+// process's own limit on open files is raised to what's needed if it's
+// allowed, but the host's are only reported, with how to raise them.
+func Preflight(load PreflightLoad) []PreflightCheck {
+	conns := int64(load.Sessions) * int64(load.Conns)
+	var checks []PreflightCheck
+	// each session has its result file open, too
+	if check, ok := preflightFiles(conns + int64(load.Sessions) + preflightSpareFiles); ok {
+		checks = append(checks, check)
+	}
+
+	timeWait := ""
+	if !load.KeepAlive {
+		timeWait = " (without -keepalive every request takes another, held for a minute after it's closed, so rates over ports/60 per second per target need keepalive)"
+	}
+	if low, high, err := readSysctlPair("net/ipv4/ip_local_port_range"); err == nil {
+		have := high - low + 1
+		check := PreflightCheck{Name: "ephemeral ports", Have: have, Need: conns, OK: have >= conns}
+		check.Advice = fmt.Sprintf(`widen the range with sysctl -w net.ipv4.ip_local_port_range="1024 65535", or spread the sessions across more hosts or -laddr addresses%s`, timeWait)
+		checks = append(checks, check)
+	}
+	// there's no connection tracking without the module loaded, so nothing
+	// to run out of
+	if max, err := readSysctl("net/netfilter/nf_conntrack_max"); err == nil {
+		count, _ := readSysctl("net/netfilter/nf_conntrack_count")
+		have := max - count
+		check := PreflightCheck{Name: "conntrack entries free", Have: have, Need: conns, OK: have >= conns}
+		check.Advice = fmt.Sprintf("raise the table with sysctl -w net.netfilter.nf_conntrack_max=%d, or the host drops new connections once it's full%s", count+conns*2, timeWait)
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// preflightFiles checks the process may open the files, raising its limit
+// if it's allowed to
+func preflightFiles(need int64) (PreflightCheck, bool) {
+	soft, hard, err := fileLimit()
+	if err != nil {
+		return PreflightCheck{}, false
+	}
+	check := PreflightCheck{Name: "open files", Have: soft, Need: need, OK: soft >= need}
+	if !check.OK && setFileLimit(need, hard) == nil {
+		check.Have, check.OK, check.Raised = need, true, true
+	}
+	check.Advice = fmt.Sprintf("raise it with ulimit -n %d before running korra (as root past the hard limit of %d), or in /etc/security/limits.conf", need, hard)
+	return check, true
+}
+
+// readSysctl reads a number from the sysctl, by its path under /proc/sys
+func readSysctl(name string) (int64, error) {
+	raw, err := os.ReadFile(filepath.Join(procSys, name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+}
+
+// readSysctlPair reads the two numbers of a sysctl like a range
+func readSysctlPair(name string) (int64, int64, error) {
+	raw, err := os.ReadFile(filepath.Join(procSys, name))
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("%s: want two numbers, got %q", name, raw)
+	}
+	low, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	high, err := strconv.ParseInt(fields[1], 10, 64)
+	return low, high, err
+}
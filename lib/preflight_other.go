@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package korra
+
+import "errors"
+
+// errNoFileLimit is why the open file limit isn't checked on other systems:
+// Windows has none, and the BSDs' Rlimit fields have types of their own
+var errNoFileLimit = errors.New("open file limit not checked on this system")
+
+// fileLimit isn't checked, so the preflight skips its open files check
+func fileLimit() (int64, int64, error) {
+	return 0, 0, errNoFileLimit
+}
+
+func setFileLimit(soft, hard int64) error {
+	return errNoFileLimit
+}
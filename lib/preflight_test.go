@@ -0,0 +1,49 @@
+package korra
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	defer func(was string) { procSys = was }(procSys)
+	procSys = t.TempDir()
+	sysctl := func(name, value string) {
+		os.MkdirAll(filepath.Dir(filepath.Join(procSys, name)), 0755)
+		os.WriteFile(filepath.Join(procSys, name), []byte(value+"\n"), 0644)
+	}
+	sysctl("net/ipv4/ip_local_port_range", "32768\t60999")
+
+	checks := map[string]PreflightCheck{}
+	for _, check := range Preflight(PreflightLoad{Sessions: 10000, Conns: 3, KeepAlive: true}) {
+		checks[check.Name] = check
+	}
+	if _, ok := checks["conntrack entries free"]; ok {
+		t.Error("want no conntrack check without the module loaded")
+	}
+	ports := checks["ephemeral ports"]
+	if ports.OK || ports.Have != 28232 || ports.Need != 30000 {
+		t.Errorf("want 28232 ports short of 30000, got %+v", ports)
+	}
+	if !strings.Contains(ports.String(), "ip_local_port_range") || strings.Contains(ports.String(), "keepalive") {
+		t.Errorf("want advice on widening the range, got %s", ports)
+	}
+
+	sysctl("net/netfilter/nf_conntrack_max", "262144")
+	sysctl("net/netfilter/nf_conntrack_count", "12000")
+	checks = map[string]PreflightCheck{}
+	for _, check := range Preflight(PreflightLoad{Sessions: 100, Conns: 1}) {
+		checks[check.Name] = check
+	}
+	if conntrack := checks["conntrack entries free"]; !conntrack.OK || conntrack.Have != 250144 || conntrack.Need != 100 {
+		t.Errorf("want 250144 free conntrack entries for 100, got %+v", conntrack)
+	}
+	if !strings.Contains(checks["ephemeral ports"].Advice, "keepalive") {
+		t.Errorf("want advice on keepalive, got %s", checks["ephemeral ports"].Advice)
+	}
+	if files, ok := checks["open files"]; ok && (!files.OK || files.Need != 100+100+preflightSpareFiles) {
+		t.Errorf("want room for 264 open files, got %+v", files)
+	}
+}
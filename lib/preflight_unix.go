@@ -0,0 +1,24 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package korra
+
+import "syscall"
+
+// fileLimit returns the process's soft and hard limits on open files
+func fileLimit() (int64, int64, error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, 0, err
+	}
+	return int64(limit.Cur), int64(limit.Max), nil
+}
+
+// setFileLimit raises the process's soft limit on open files, and its hard
+// limit too if it's lower, which only root may
+func setFileLimit(soft, hard int64) error {
+	if hard < soft {
+		hard = soft
+	}
+	return syscall.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: uint64(soft), Max: uint64(hard)})
+}
@@ -0,0 +1,141 @@
+package korra
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientProfile is a named kind of client -- its network and the headers it
+// sends -- given to a percentage of the sessions.
+type ClientProfile struct {
+	Name       string
+	Share      int // percentage of sessions
+	Conditions NetworkConditions
+	Header     http.Header
+}
+
+// ReadProfiles reads client profiles from the reader, each one a block that
+// starts with its name in brackets and has one param=value per line:
+//
+//	[us-east mobile]
+//	share=30
+//	latency=150ms
+//	jitter=50ms
+//	bandwidth=65536
+//	resets=0.5
+//	header=User-Agent: Mozilla/5.0 (iPhone; CPU iPhone OS 8_1 like Mac OS X)
+//
+// The header param may be repeated. Blank lines and those starting with '#'
+// are skipped. The shares may add up to at most 100; sessions left over get
+// no profile.
+func ReadProfiles(in io.Reader) ([]*ClientProfile, error) {
+	var (
+		profiles []*ClientProfile
+		current  *ClientProfile
+		total    int
+	)
+	scanner := bufio.NewScanner(in)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = &ClientProfile{Name: strings.TrimSpace(line[1 : len(line)-1]), Header: http.Header{}}
+			profiles = append(profiles, current)
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("Line %d: Expected a [profile name] before its params", lineNumber)
+		}
+		if err := current.fill(line); err != nil {
+			return nil, fmt.Errorf("Line %d: Bad param for profile %s: %s", lineNumber, current.Name, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		if profile.Share <= 0 {
+			return nil, fmt.Errorf("Profile %s needs a share of sessions", profile.Name)
+		}
+		total += profile.Share
+	}
+	if total > 100 {
+		return nil, fmt.Errorf("Profile shares add up to %d%%, expected at most 100%%", total)
+	}
+	return profiles, nil
+}
+
+func (p *ClientProfile) fill(line string) error {
+	param := strings.SplitN(line, "=", 2)
+	if len(param) != 2 {
+		return fmt.Errorf("Expected key=value, got: %s", line)
+	}
+	name, value := strings.ToLower(strings.TrimSpace(param[0])), strings.TrimSpace(param[1])
+	var err error
+	switch name {
+	case "share":
+		if p.Share, err = strconv.Atoi(value); err != nil || p.Share < 0 {
+			return fmt.Errorf("Expected a percentage for share, got: %s", value)
+		}
+	case "latency":
+		p.Conditions.Latency, err = time.ParseDuration(value)
+	case "jitter":
+		p.Conditions.Jitter, err = time.ParseDuration(value)
+	case "bandwidth":
+		p.Conditions.Bandwidth, err = strconv.ParseInt(value, 10, 64)
+	case "resets":
+		p.Conditions.ResetRate, err = strconv.ParseFloat(value, 64)
+	case "header":
+		header := strings.SplitN(value, ":", 2)
+		if len(header) != 2 || strings.TrimSpace(header[0]) == "" || strings.TrimSpace(header[1]) == "" {
+			return fmt.Errorf("Expected header as Key: Value, got: %s", value)
+		}
+		p.Header.Add(strings.TrimSpace(header[0]), strings.TrimSpace(header[1]))
+	default:
+		return fmt.Errorf("Unknown param: %s", name)
+	}
+	if err != nil {
+		return fmt.Errorf("Bad value for %s: %s", name, err)
+	}
+	return nil
+}
+
+func (p *ClientProfile) String() string {
+	return fmt.Sprintf("%s (%d%%)", p.Name, p.Share)
+}
+
+// ProfilePicker hands out the profiles to sessions by their shares, spread
+// evenly
+type ProfilePicker struct {
+	profiles []*ClientProfile
+	weights  *smoothWeights
+}
+
+func NewProfilePicker(profiles []*ClientProfile) *ProfilePicker {
+	if len(profiles) == 0 {
+		return &ProfilePicker{weights: newSmoothWeights(nil)}
+	}
+	weights := make([]int, len(profiles)+1)
+	remainder := 100
+	for idx, profile := range profiles {
+		weights[idx] = profile.Share
+		remainder -= profile.Share
+	}
+	weights[len(profiles)] = remainder // sessions with no profile
+	return &ProfilePicker{profiles: profiles, weights: newSmoothWeights(weights)}
+}
+
+// Next returns the profile for the next session, or nil if it gets none
+func (p *ProfilePicker) Next() *ClientProfile {
+	if idx := p.weights.next(); idx >= 0 && idx < len(p.profiles) {
+		return p.profiles[idx]
+	}
+	return nil
+}
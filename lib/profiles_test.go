@@ -0,0 +1,77 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const profilesText = `
+# slow phones
+[us-east mobile]
+share=25
+latency=150ms
+bandwidth=65536
+header=User-Agent: Mozilla/5.0 (iPhone)
+
+[eu-west fiber]
+share=50
+latency=20ms
+header=User-Agent: Mozilla/5.0 (Windows NT 10.0)
+header=Accept-Language: de-DE
+`
+
+func TestReadProfiles(t *testing.T) {
+	profiles, err := ReadProfiles(strings.NewReader(profilesText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 {
+		t.Fatalf("Expected 2 profiles, got %d", len(profiles))
+	}
+	mobile := profiles[0]
+	if mobile.Name != "us-east mobile" || mobile.Share != 25 || mobile.Conditions.Latency != 150*time.Millisecond ||
+		mobile.Conditions.Bandwidth != 65536 || mobile.Header.Get("User-Agent") != "Mozilla/5.0 (iPhone)" {
+		t.Fatalf("Unexpected profile %+v", mobile)
+	}
+
+	picker := NewProfilePicker(profiles)
+	counts := map[string]int{}
+	for i := 0; i < 100; i++ {
+		if profile := picker.Next(); profile != nil {
+			counts[profile.Name] += 1
+		} else {
+			counts[""] += 1
+		}
+	}
+	if counts["us-east mobile"] != 25 || counts["eu-west fiber"] != 50 || counts[""] != 25 {
+		t.Fatalf("Expected sessions split 25/50/25, got %v", counts)
+	}
+
+	for _, bad := range []string{"share=10", "[a]\nshare=60\n[b]\nshare=60", "[a]\nlatency=fast\nshare=1", "[a]\ncolor=red", "[a]\nlatency=1s"} {
+		if _, err := ReadProfiles(strings.NewReader(bad)); err == nil {
+			t.Fatalf("Expected error reading profiles %q", bad)
+		}
+	}
+}
+
+func TestAttackerHeaders(t *testing.T) {
+	var agent, language string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent, language = r.Header.Get("User-Agent"), r.Header.Get("Accept-Language")
+	}))
+	defer server.Close()
+	attacker := NewAttacker(
+		Headers(http.Header{"User-Agent": {"global"}, "Accept-Language": {"en-US"}}),
+		Headers(http.Header{"User-Agent": {"profile"}}))
+	tgt := NewTarget()
+	tgt.Method = "GET"
+	tgt.URL = server.URL
+	tgt.Header.Set("Accept-Language", "fr-FR")
+	attacker.Hit(func() (*Target, error) { return tgt, nil }, time.Now(), 1)
+	if agent != "profile" || language != "fr-FR" {
+		t.Fatalf("Expected the profile's agent and the target's language, got %s and %s", agent, language)
+	}
+}
@@ -0,0 +1,444 @@
+package korra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the protocols a PUBLISH step speaks, by the scheme of its URL
+const (
+	brokerMQTT = "mqtt"
+	brokerAMQP = "amqp"
+)
+
+// PublishConfig defines what a PUBLISH step sends a broker: Messages of the
+// step's body to Topic, Interval apart. With Subscribe it also receives them,
+// on a connection of its own, for how long each took to be delivered.
+type PublishConfig struct {
+	Topic     string // MQTT topic, or AMQP routing key
+	Exchange  string // AMQP exchange; "" is the default exchange
+	Messages  int    // messages to publish
+	Interval  int    // ms between messages
+	QoS       int    // 0 to publish and forget, 1 to wait for the broker to acknowledge each
+	Subscribe bool   // receive the messages to time their delivery
+	Wait      int    // ms to wait for the last message to be delivered
+}
+
+func NewPublishConfig() *PublishConfig {
+	return &PublishConfig{Messages: 1, QoS: 1, Wait: 5000}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value ...]
+//
+// and fills itself from the parameters, as:
+//
+//   - topic: The MQTT topic, or AMQP routing key, to publish to (required)
+//   - exchange: The AMQP exchange to publish to (default: the default
+//     exchange)
+//   - messages: The number of messages to publish (default: 1)
+//   - interval: The time to wait between them, in ms (default: 0)
+//   - qos: 0 to publish each without waiting, or 1 to wait for the broker
+//     to acknowledge it (default: 1)
+//   - subscribe: Whether to receive the messages too, to time their
+//     delivery (default: false)
+//   - wait: How long to wait for the last message to be delivered, in ms
+//     (default: 5000)
+func (config *PublishConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for publish param, got: %s", piece)
+		}
+		value := strings.TrimSpace(param[1])
+		switch name := strings.ToLower(strings.TrimSpace(param[0])); name {
+		case "topic":
+			config.Topic = value
+		case "exchange":
+			config.Exchange = value
+		case "messages", "interval", "wait":
+			num, err := strconv.Atoi(value)
+			if err != nil || num < 0 || (name != "interval" && num == 0) {
+				return fmt.Errorf("Expected positive int for publish param, got: %s", piece)
+			}
+			if name == "messages" {
+				config.Messages = num
+			} else if name == "interval" {
+				config.Interval = num
+			} else {
+				config.Wait = num
+			}
+		case "qos":
+			if value != "0" && value != "1" {
+				return fmt.Errorf("Expected 0 or 1 for publish QoS, got: %s", value)
+			}
+			config.QoS, _ = strconv.Atoi(value)
+		case "subscribe":
+			subscribe, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("Expected true or false for publish param, got: %s", piece)
+			}
+			config.Subscribe = subscribe
+		default:
+			return fmt.Errorf("Unknown publish param: %s", param[0])
+		}
+	}
+	return nil
+}
+
+// check returns an error if the config can't be published with the protocol
+func (config *PublishConfig) check(scheme string) error {
+	if config.Topic == "" {
+		return fmt.Errorf("Expected a topic to publish to")
+	}
+	if scheme == brokerMQTT && strings.ContainsAny(config.Topic, "+#") {
+		return fmt.Errorf("Expected an MQTT topic without wildcards, got: %s", config.Topic)
+	}
+	if scheme == brokerMQTT && config.Exchange != "" {
+		return fmt.Errorf("Expected no exchange for MQTT, got: %s", config.Exchange)
+	}
+	return nil
+}
+
+func (config *PublishConfig) String() string {
+	return fmt.Sprintf("[Topic=%s Exchange=%s Messages=%d Interval=%d QoS=%d Subscribe=%t Wait=%d]",
+		config.Topic, config.Exchange, config.Messages, config.Interval, config.QoS, config.Subscribe, config.Wait)
+}
+
+// parseBrokerURL checks the URL of a PUBLISH step:
+// mqtt://[user:password@]host:port or amqp://[user:password@]host:port[/vhost]
+func parseBrokerURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != brokerMQTT && u.Scheme != brokerAMQP {
+		return nil, fmt.Errorf("Expected a %s:// or %s:// URL, got: %s", brokerMQTT, brokerAMQP, raw)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("Expected a host and port, got: %s", raw)
+	}
+	if u.Scheme == brokerMQTT && strings.Trim(u.Path, "/") != "" {
+		return nil, fmt.Errorf("Expected no path for MQTT, with the topic a param, got: %s", raw)
+	}
+	return u, nil
+}
+
+// brokerConn is a connection to a message broker, speaking MQTT or AMQP.
+// publish sends the payload to the step's topic, tagged with the
+// correlation ID if it isn't empty, and with QoS 1 waits until the broker
+// acknowledges it or the deadline passes.
+type brokerConn interface {
+	publish(correlation string, payload []byte, deadline time.Time) error
+	Close() error
+}
+
+// brokerError is an error the broker refused a connection or message with
+type brokerError string
+
+func (e brokerError) Error() string {
+	return string(e)
+}
+
+// dialBroker connects to the broker at the URL to publish to it, or, if
+// delivered isn't nil, to subscribe to the step's topic, calling delivered
+// with the correlation ID of each message that comes.
+func (a *Attacker) dialBroker(u *url.URL, config *PublishConfig, timeouts Timeouts, client string, delivered func(string)) (brokerConn, error) {
+	connect := timeouts.Connect
+	if connect == 0 {
+		connect = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connect)
+	defer cancel()
+	conn, err := a.dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = ErrConnectTimeout
+		}
+		return nil, err
+	}
+	// the handshake, and subscribing, have as long as connecting does
+	conn.SetDeadline(time.Now().Add(connect))
+	var broker brokerConn
+	if u.Scheme == brokerMQTT {
+		broker, err = dialMQTT(conn, u, config, client, delivered)
+	} else {
+		broker, err = dialAMQP(conn, u, config, delivered)
+	}
+	if err != nil {
+		conn.Close()
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			err = ErrConnectTimeout
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return broker, nil
+}
+
+// brokerPath is the path of a PUBLISH step's results: the protocol, the
+// exchange if any and the topic
+func brokerPath(u *url.URL, config *PublishConfig) string {
+	return path.Join("/", u.Scheme, config.Exchange, config.Topic)
+}
+
+// hitPublish publishes the payload on the connection, connecting first if
+// conn is nil, for a result that's 200 once it's sent (or acknowledged, with
+// QoS 1). A connection that fails is closed, and returned nil for the next
+// message to make a new one.
+func (a *Attacker) hitPublish(conn brokerConn, tgt *Target, u *url.URL, client, correlation string, payload []byte, tm time.Time, requestCount int) (brokerConn, *Result) {
+	result := &Result{Timestamp: tm, RequestCount: requestCount, Method: "PUBLISH", Path: brokerPath(u, tgt.Publish)}
+	var err error
+	defer func() {
+		result.Latency = time.Since(tm)
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}()
+	if a.limiters != nil {
+		release, ok := a.limiters.acquire(tgt, a.abort)
+		if !ok {
+			err = ErrLimitAborted
+			return conn, result
+		}
+		defer release()
+		tm = time.Now()
+		result.Timestamp = tm
+	}
+	result.InFlight = int(atomic.AddInt64(&inFlight, 1))
+	defer atomic.AddInt64(&inFlight, -1)
+
+	timeouts := a.timeouts.Merge(tgt.Timeouts)
+	if conn == nil {
+		if conn, err = a.dialBroker(u, tgt.Publish, timeouts, client, nil); err != nil {
+			return nil, result
+		}
+	}
+	total := timeouts.Total
+	if total == 0 {
+		total = DefaultTimeout
+	}
+	if err = conn.publish(correlation, payload, tm.Add(total)); err != nil {
+		// a message the broker refused leaves the connection as it was
+		if _, refused := err.(brokerError); refused {
+			return conn, result
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			err = ErrTotalTimeout
+		}
+		conn.Close()
+		return nil, result
+	}
+	result.Code = 200
+	result.BytesOut = uint64(len(payload))
+	return conn, result
+}
+
+// errPublishTimeout is what a publish waiting for its acknowledgement gets
+// once the deadline passes
+type errPublishTimeout struct{}
+
+func (errPublishTimeout) Error() string   { return "timed out waiting for the broker" }
+func (errPublishTimeout) Timeout() bool   { return true }
+func (errPublishTimeout) Temporary() bool { return true }
+
+// doPublish publishes the step's messages, each a result of its own with its
+// number as the request count. With Subscribe, the results are held until
+// every message is delivered, or Wait has passed since the last was
+// published, to record how long each took (see Result.Delivery).
+func (session *Session) doPublish(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	config := target.Publish
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => PUBLISH %s %s", 200, target.URL, config))
+		return
+	}
+	u, err := parseBrokerURL(target.URL)
+	if err == nil {
+		err = config.check(u.Scheme)
+	}
+	var payload []byte
+	if err == nil {
+		var body io.Reader
+		if body, err = target.Body(); err == nil && body != nil {
+			payload, err = io.ReadAll(body)
+		}
+	}
+	if err != nil {
+		result := &Result{Timestamp: time.Now(), Method: "PUBLISH", Error: err.Error()}
+		result.PathFromURL(target.URL)
+		session.send(result)
+		return
+	}
+	client := fmt.Sprintf("korra-%012x", session.attacker.random.Int63n(1<<48))
+
+	var (
+		mu        sync.Mutex
+		published = map[string]int{} // the results held, by correlation ID
+		delivered = map[string]time.Time{}
+		arrived   = make(chan struct{}, 1)
+		results   []*Result
+	)
+	if config.Subscribe {
+		timeouts := session.attacker.timeouts.Merge(target.Timeouts)
+		subscriber, err := session.attacker.dialBroker(u, config, timeouts, client+"-sub", func(correlation string) {
+			mu.Lock()
+			if _, ok := delivered[correlation]; !ok && strings.HasPrefix(correlation, client) {
+				delivered[correlation] = time.Now()
+			}
+			mu.Unlock()
+			select {
+			case arrived <- struct{}{}:
+			default:
+			}
+		})
+		if err != nil {
+			session.send(&Result{Timestamp: time.Now(), Method: "SUBSCRIBE", Path: brokerPath(u, config), Error: err.Error()})
+			return
+		}
+		defer subscriber.Close()
+	}
+
+	var conn brokerConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+publishing:
+	for messages := 1; messages <= config.Messages && !session.isAborted(); messages++ {
+		if messages > 1 && config.Interval > 0 {
+			select {
+			case <-time.After(time.Duration(config.Interval) * time.Millisecond):
+			case <-session.aborted:
+				break publishing
+			}
+		}
+		session.Gate.wait(session.aborted)
+		correlation := ""
+		if config.Subscribe {
+			correlation = fmt.Sprintf("%s-%d", client, messages)
+		}
+		var result *Result
+		conn, result = session.attacker.hitPublish(conn, target, u, client, correlation, payload, time.Now(), messages)
+		if result.Error == ErrLimitAborted.Error() {
+			break publishing
+		}
+		session.debug(fmt.Sprintf("%d => PUBLISH %s, %d/%d, %d ms",
+			result.Code, result.Path, messages, config.Messages, int64(result.Latency/time.Millisecond)))
+		if !config.Subscribe {
+			session.send(result)
+			continue
+		}
+		if result.Code == 200 {
+			mu.Lock()
+			published[correlation] = len(results)
+			mu.Unlock()
+		}
+		results = append(results, result)
+	}
+	if !config.Subscribe {
+		return
+	}
+
+	wait := time.After(time.Duration(config.Wait) * time.Millisecond)
+	for waiting := true; waiting; {
+		mu.Lock()
+		outstanding := 0
+		for correlation := range published {
+			if _, ok := delivered[correlation]; !ok {
+				outstanding++
+			}
+		}
+		mu.Unlock()
+		if outstanding == 0 {
+			break
+		}
+		select {
+		case <-arrived:
+		case <-wait:
+			waiting = false
+		case <-session.aborted:
+			waiting = false
+		}
+	}
+	mu.Lock()
+	for correlation, i := range published {
+		if at, ok := delivered[correlation]; ok {
+			results[i].Delivery = at.Sub(results[i].Timestamp)
+		} else {
+			results[i].Lost = true
+		}
+	}
+	mu.Unlock()
+	for _, result := range results {
+		session.send(result)
+	}
+}
+
+// deliveryShard is what a metrics shard adds up the deliveries of published
+// messages from
+type deliveryShard struct {
+	latencies quantiles
+	latency   time.Duration
+}
+
+func newDeliveryShard(count int) *deliveryShard {
+	return &deliveryShard{latencies: newQuantiles(count, 0)}
+}
+
+// add counts a message that was delivered, or lost, towards the deliveries
+func (ds *deliveryShard) add(m *Metrics, result *Result, w int) {
+	d := &m.Deliveries
+	if result.Lost {
+		d.Total += uint64(w)
+		d.Lost += uint64(w)
+	}
+	if result.Delivery == 0 {
+		return
+	}
+	d.Total += uint64(w)
+	ds.latency += result.Delivery * time.Duration(w)
+	for i := 0; i < w; i++ {
+		ds.latencies.Insert(float64(result.Delivery))
+	}
+	if result.Delivery > d.Latencies.Max {
+		d.Latencies.Max = result.Delivery
+	}
+}
+
+func (ds *deliveryShard) merge(m, om *Metrics, o *deliveryShard) {
+	d, od := &m.Deliveries, &om.Deliveries
+	ds.latencies.merge(o.latencies)
+	ds.latency += o.latency
+	d.Total += od.Total
+	d.Lost += od.Lost
+	if od.Latencies.Max > d.Latencies.Max {
+		d.Latencies.Max = od.Latencies.Max
+	}
+}
+
+// finish computes the mean and percentiles of the delivery latencies
+func (ds *deliveryShard) finish(m *Metrics) {
+	d := &m.Deliveries
+	if delivered := d.Total - d.Lost; delivered > 0 {
+		d.Latencies.Mean = time.Duration(float64(ds.latency) / float64(delivered))
+		d.Latencies.P50 = time.Duration(ds.latencies.Query(0.50))
+		d.Latencies.P95 = time.Duration(ds.latencies.Query(0.95))
+		d.Latencies.P99 = time.Duration(ds.latencies.Query(0.99))
+	}
+}
@@ -0,0 +1,50 @@
+package korra
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+)
+
+// Random is a source of random numbers that's safe for concurrent use. A nil
+// *Random uses the global source from math/rand, so only code that was
+// given one is reproducible.
+type Random struct {
+	sync.Mutex
+	rng *rand.Rand
+}
+
+// NewRandom returns a Random that always produces the same sequence for the
+// same seed
+func NewRandom(seed int64) *Random {
+	return &Random{rng: rand.New(rand.NewSource(seed))}
+}
+
+// SeedFor derives a seed for the named session from the seed of the run, so
+// each session gets its own sequence that doesn't depend on how many other
+// sessions there are or the order they're started in.
+func SeedFor(seed int64, name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return seed ^ int64(h.Sum64())
+}
+
+// Int63n returns a number in [0, n)
+func (r *Random) Int63n(n int64) int64 {
+	if r == nil {
+		return rand.Int63n(n)
+	}
+	r.Lock()
+	defer r.Unlock()
+	return r.rng.Int63n(n)
+}
+
+// Float64 returns a number in [0.0, 1.0)
+func (r *Random) Float64() float64 {
+	if r == nil {
+		return rand.Float64()
+	}
+	r.Lock()
+	defer r.Unlock()
+	return r.rng.Float64()
+}
@@ -0,0 +1,32 @@
+package korra
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRandomReproducible(t *testing.T) {
+	a, b := NewRandom(42), NewRandom(42)
+	for i := 0; i < 10; i++ {
+		if x, y := a.Int63n(1000), b.Int63n(1000); x != y {
+			t.Fatalf("Draw %d; expected the same number for the same seed, got %d and %d", i, x, y)
+		}
+	}
+	if SeedFor(42, "user_1.txt") == SeedFor(42, "user_2.txt") {
+		t.Fatal("Expected different seeds for different sessions")
+	}
+	if SeedFor(42, "user_1.txt") != SeedFor(42, "user_1.txt") {
+		t.Fatal("Expected the same seed for the same session")
+	}
+}
+
+func TestSeedJitter(t *testing.T) {
+	conditions := NetworkConditions{Latency: 100 * time.Millisecond, Jitter: 50 * time.Millisecond}
+	a := NewAttacker(Conditions(conditions), Seed(7))
+	b := NewAttacker(Seed(7), Conditions(conditions))
+	for i := 0; i < 10; i++ {
+		if x, y := a.conditions.delay(), b.conditions.delay(); x != y {
+			t.Fatalf("Delay %d; expected the same jitter for the same seed, got %s and %s", i, x, y)
+		}
+	}
+}
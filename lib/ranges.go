@@ -0,0 +1,202 @@
+package korra
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RangesConfig defines how a RANGES step downloads its URL, as download
+// managers and video players do: in Chunk-byte ranges, Parts of them at a
+// time. The first range tells it how big the whole object is.
+type RangesConfig struct {
+	Parts int    // ranges in flight at once
+	Chunk uint64 // bytes in each range
+}
+
+func NewRangesConfig() *RangesConfig {
+	return &RangesConfig{Parts: 4, Chunk: 1 << 20}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value]
+//
+// and fills itself from the parameters, as:
+//
+//   - parts: The number of ranges to download at once (default: 4)
+//   - chunk: The size of each range, in bytes or with a unit like 512KB
+//     (default: 1MB)
+func (config *RangesConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for ranges param, got: %s", piece)
+		}
+		value := strings.TrimSpace(param[1])
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "parts":
+			num, err := strconv.Atoi(value)
+			if err != nil || num <= 0 {
+				return fmt.Errorf("Expected positive int for ranges param, got: %s", piece)
+			}
+			config.Parts = num
+		case "chunk":
+			size, err := parseBytes(value)
+			if err != nil || size == 0 {
+				return fmt.Errorf("Expected positive size for ranges param, got: %s", piece)
+			}
+			config.Chunk = size
+		default:
+			return fmt.Errorf("Unknown ranges param: %s", param[0])
+		}
+	}
+	return nil
+}
+
+func (config *RangesConfig) String() string {
+	return fmt.Sprintf("[Parts=%d Chunk=%s]", config.Parts, formatBytes(config.Chunk))
+}
+
+// span returns a Target for the range of the target's object starting at
+// from, of a chunk or up to its size, whichever is first; a size of 0 is
+// unknown.
+func (config *RangesConfig) span(tgt *Target, from, size uint64) *Target {
+	to := from + config.Chunk - 1
+	if size > 0 && to >= size {
+		to = size - 1
+	}
+	span := *tgt
+	span.Header = tgt.Header.Clone()
+	if span.Header == nil {
+		span.Header = http.Header{}
+	}
+	span.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to))
+	return &span
+}
+
+// objectSize returns the size of the whole object a response is for: the
+// total of its Content-Range if it's partial, or its own length if it's the
+// whole thing; 0 if it doesn't say.
+func objectSize(response *http.Response) uint64 {
+	if response.StatusCode != http.StatusPartialContent {
+		if response.ContentLength > 0 {
+			return uint64(response.ContentLength)
+		}
+		return 0
+	}
+	_, total, ok := strings.Cut(response.Header.Get("Content-Range"), "/")
+	if !ok {
+		return 0
+	}
+	size, err := strconv.ParseUint(strings.TrimSpace(total), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// doRanges downloads the target's object in ranges: the first on its own,
+// to learn the object's size, then the rest Parts at a time. Each range is
+// a result, with its range number as the request count, and so is the
+// whole download, with the number of ranges it took (see Result.Ranges).
+func (session *Session) doRanges(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	config := target.Ranges
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => RANGES %s %s %s",
+			206, target.Method, target.URL, config))
+		return
+	}
+
+	session.Gate.wait(session.aborted)
+	began := time.Now()
+	download := &Result{Timestamp: began, Method: target.Method, RequestCount: 1}
+	download.PathFromURL(target.URL)
+	failed := 0
+	add := func(result *Result) {
+		session.debug(fmt.Sprintf("%d => RANGES %s %s, range %d, %d bytes, %d ms",
+			result.Code, result.Method, result.Path, result.RequestCount, result.BytesIn, int64(result.Latency/time.Millisecond)))
+		download.Ranges++
+		download.BytesIn += result.BytesIn
+		download.Target = result.Target
+		if result.Error != "" {
+			failed++
+		}
+		session.send(result)
+	}
+
+	first := session.attacker.Hit(func() (*Target, error) { return config.span(target, 0, 0), nil }, began, 1)
+	if first.Error == ErrLimitAborted.Error() {
+		return
+	}
+	add(first)
+	download.Code = first.Code
+	size := first.size
+	if first.Error != "" || first.Code != http.StatusPartialContent {
+		size = 0 // failed, or the server sent it all at once
+	}
+
+	type span struct {
+		number int
+		from   uint64
+	}
+	var (
+		spans   = make(chan span)
+		results = make(chan *Result)
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < config.Parts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range spans {
+				session.Gate.wait(session.aborted)
+				tgt := config.span(target, s.from, size)
+				results <- session.attacker.Hit(func() (*Target, error) { return tgt, nil }, time.Now(), s.number)
+			}
+		}()
+	}
+	go func() {
+		defer close(results)
+		defer wg.Wait()
+		defer close(spans)
+		number := 2
+		for from := config.Chunk; from < size; from += config.Chunk {
+			select {
+			case spans <- span{number, from}:
+				number++
+			case <-session.aborted:
+				return
+			}
+		}
+	}()
+	for result := range results {
+		if result.Error != ErrLimitAborted.Error() {
+			add(result)
+		}
+	}
+
+	download.Latency = time.Since(began)
+	if failed > 0 {
+		download.Error = fmt.Sprintf("%d of %d ranges failed", failed, download.Ranges)
+	}
+	session.debug(fmt.Sprintf("RANGES %s %s: %d bytes in %d ranges, %d ms, %s",
+		download.Method, download.Path, download.BytesIn, download.Ranges, int64(download.Latency/time.Millisecond), formatRate(download.DownloadRate())))
+	session.send(download)
+}
+
+// DownloadRate returns the rate, in bytes per second, of a RANGES download
+// as a whole, or 0 if the result isn't one.
+func (r *Result) DownloadRate() float64 {
+	if r.Ranges == 0 || r.Latency <= 0 {
+		return 0
+	}
+	return float64(r.BytesIn) / r.Latency.Seconds()
+}
@@ -0,0 +1,95 @@
+package korra
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRangesConfig(t *testing.T) {
+	action := &SessionAction{Raw: "RANGES GET http://cdn/video.mp4\n[parts=6 chunk=4MB]", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	if got := action.Target.Ranges.String(); got != "[Parts=6 Chunk=4MB]" {
+		t.Fatalf("bad ranges config: %s", got)
+	}
+	for _, bad := range []string{"[parts=0]", "[chunk=0]", "[chunk=big]", "[speed=1]", "[parts]"} {
+		action = &SessionAction{Raw: "RANGES GET http://cdn/video.mp4\n" + bad, Line: 1}
+		if err := action.CreateTarget("."); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+func TestRangesDownload(t *testing.T) {
+	object := bytes.Repeat([]byte("0123456789"), 1000)
+	var (
+		mu     sync.Mutex
+		ranges []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(object))
+	}))
+	defer server.Close()
+
+	action := &SessionAction{Raw: "RANGES GET " + server.URL + "/video.mp4\n[parts=3 chunk=4KB]", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{attacker: NewAttacker(ClientCache(true)), aborted: make(chan struct{}), results: make(chan *Result, 10)}
+	session.doRanges(action)
+	close(session.results)
+	var results Results
+	for result := range session.results {
+		results = append(results, result)
+	}
+
+	sort.Strings(ranges)
+	if got := strings.Join(ranges, " "); got != "bytes=0-4095 bytes=4096-8191 bytes=8192-9999" {
+		t.Fatalf("want three ranges covering the object, got: %s", got)
+	}
+	if len(results) != 4 {
+		t.Fatalf("want a result a range and one for the download, got %d", len(results))
+	}
+	for _, r := range results[:3] {
+		if r.Code != http.StatusPartialContent || r.Error != "" || r.Conditional || r.LastByte == 0 || r.Ranges != 0 {
+			t.Fatalf("want a partial response read to the end, got: %+v", r)
+		}
+	}
+	download := results[3]
+	if download.Ranges != 3 || download.BytesIn != uint64(len(object)) || download.Error != "" || download.DownloadRate() <= 0 {
+		t.Fatalf("want the download summed up, got: %+v", download)
+	}
+
+	m := NewMetrics(results)
+	if m.Requests != 3 || m.Transfers.Responses != 3 || m.BytesIn.Total != uint64(len(object)) {
+		t.Fatalf("want the ranges counted as the requests, got: %d requests, %d transfers, %d bytes", m.Requests, m.Transfers.Responses, m.BytesIn.Total)
+	}
+	if m.Downloads.Total != 1 || m.Downloads.Ranges != 3 || m.Downloads.Rate.Mean != download.DownloadRate() {
+		t.Fatalf("bad downloads: %+v", m.Downloads)
+	}
+
+	// a server that ignores ranges sends it all in the first
+	whole := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(object)
+	}))
+	defer whole.Close()
+	action = &SessionAction{Raw: "RANGES GET " + whole.URL + "\n[chunk=4KB]", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	session.results = make(chan *Result, 10)
+	session.doRanges(action)
+	if first, download := <-session.results, <-session.results; first.Code != 200 || download.Ranges != 1 || download.BytesIn != uint64(len(object)) {
+		t.Fatalf("want one range with everything, got: %+v then %+v", first, download)
+	}
+}
@@ -0,0 +1,161 @@
+package korra
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ReportSection is the metrics for one set of results in a report: all of
+// them, those for a stage or a target, or those for a URL bucket.
+type ReportSection struct {
+	Name        string            `json:"name"`
+	Results     int               `json:"results"`
+	Metrics     *Metrics          `json:"metrics"`
+	Urls        map[string]uint32 `json:"urls,omitempty"` // the URLs in a bucket and how many times each was hit
+	Slowest     Results           `json:"slowest,omitempty"`
+	Anomalies   []Anomaly         `json:"anomalies,omitempty"`
+	Correlation *ErrorCorrelation `json:"correlation,omitempty"` // nil if there's nothing to correlate
+	Budget      *ErrorBudget      `json:"budget,omitempty"`      // nil without an SLO
+	Timeline    *StatusTimeline   `json:"timeline,omitempty"`
+	Cache       *CacheSplit       `json:"cache_split,omitempty"` // nil without a CacheHeader, or if no results recorded it
+}
+
+// SectionOptions are the extras each section of a report lists
+type SectionOptions struct {
+	Slowest           int           // how many of the slowest results to list
+	AnomalyWindow     time.Duration // how wide the windows latency anomalies are looked for in; 0 for none
+	CorrelationWindow time.Duration // how wide the windows errors are correlated with latency over; 0 for none
+	Stages            []Stage       // the stages of the attack to report on each of, if any
+	LittlesLaw        bool          // whether to check the overall results with Little's Law
+	SLO               float64       // the success ratio to report each section's error budget burn rate against; 0 for none
+	TimelineWindow    time.Duration // how wide the windows of status timelines are; 0 for none
+	CacheHeader       string        // the recorded response header to split latencies into cache hits and misses by, if any
+	InstanceHeader    string        // the recorded response header naming the instance that served each result, to report on each by
+	ScrapeWindow      time.Duration // how wide the windows the target's scraped metrics are reported over are; 0 for none
+}
+
+// section computes the report section for the results
+func (o SectionOptions) section(name string, r Results, urls map[string]uint32) ReportSection {
+	m := NewMetrics(r)
+	return ReportSection{
+		Name:        name,
+		Results:     r.Count(),
+		Metrics:     m,
+		Urls:        urls,
+		Slowest:     r.Slowest(o.Slowest),
+		Anomalies:   DetectAnomalies(r, o.AnomalyWindow),
+		Correlation: CorrelateErrors(r, o.CorrelationWindow),
+		Budget:      NewErrorBudget(m, o.SLO),
+		Timeline:    NewStatusTimeline(r, o.TimelineWindow),
+		Cache:       SplitByCache(r, o.CacheHeader),
+	}
+}
+
+// ReportData is what a report template is executed with. Stages is only
+// filled in when there are SectionOptions.Stages, Targets only when sessions
+// were balanced across targets, Instances only with an InstanceHeader, Pages
+// only when assets were fetched for HTML pages, and Remaining is nil
+// unless some results didn't match any URL pattern.
+type ReportData struct {
+	Attack      *AttackMetadata // nil if the result files didn't say
+	Annotations Annotations     // the moments marked during the attack, in time order
+	Overall     ReportSection
+	Little      *LittleCheck // nil without SectionOptions.LittlesLaw, or if there's nothing to check
+	Stages      []ReportSection
+	Targets     []ReportSection
+	Instances   []ReportSection
+	Buckets     []ReportSection
+	Pages       []ReportSection // each page with its assets, named for its path
+	Remaining   *ReportSection
+
+	// TargetMetrics are the metrics scraped from the target, window by
+	// window next to the results; nil without any, or a ScrapeWindow
+	TargetMetrics *TargetMetrics
+}
+
+// NewReportData computes the sections of a report for the results, with the
+// URL buckets from the collection, inferring them when it has none.
+func NewReportData(r Results, collection BucketCollection, opts SectionOptions) ReportData {
+	data := ReportData{Overall: opts.section("OVERALL", r, nil)}
+	if opts.LittlesLaw {
+		data.Little = CheckLittle(r)
+	}
+	for i, byStage := range SplitStages(r, opts.Stages) {
+		data.Stages = append(data.Stages, opts.section(opts.Stages[i].String(), byStage, nil))
+	}
+	if targets, byTarget := splitByTarget(r); len(targets) > 1 || (len(targets) == 1 && targets[0] != "") {
+		for _, target := range targets {
+			data.Targets = append(data.Targets, opts.section(target, byTarget[target], nil))
+		}
+	}
+	if opts.InstanceHeader != "" {
+		instances, byInstance := splitByHeader(r, opts.InstanceHeader)
+		for _, instance := range instances {
+			data.Instances = append(data.Instances, opts.section(instance, byInstance[instance], nil))
+		}
+	}
+	collection.AddResults(r)
+	for _, bucket := range collection.Buckets() {
+		data.Buckets = append(data.Buckets, opts.section(bucket.String(), bucket.Results, bucket.Urls))
+	}
+	pages, byPage := SplitPages(r)
+	for _, page := range pages {
+		data.Pages = append(data.Pages, opts.section(page, byPage[page], nil))
+	}
+	if catchAll := collection.CatchAllBucket(); catchAll != nil && len(catchAll.Results) > 0 {
+		section := opts.section("Remaining", catchAll.Results, catchAll.Urls)
+		data.Remaining = &section
+	}
+	return data
+}
+
+// ReportFuncs are the functions report templates may call besides the
+// built-in ones:
+//
+//	percent .Metrics.Success        => 99.25%
+//	round .Metrics.Latencies.P95 "1ms" => 87ms
+//	bytes .Metrics.BytesIn.Total    => 1.5MB
+//	join .Metrics.Errors ", "
+var ReportFuncs = template.FuncMap{
+	"percent": func(ratio float64) string { return fmt.Sprintf("%.2f%%", ratio*100) },
+	"round": func(d time.Duration, unit string) (time.Duration, error) {
+		to, err := time.ParseDuration(unit)
+		if err != nil {
+			return 0, err
+		}
+		return d.Round(to), nil
+	},
+	"bytes": formatBytes,
+	"join":  strings.Join,
+}
+
+// ReadTemplate parses the report template in the file, with ReportFuncs.
+func ReadTemplate(path string) (*template.Template, error) {
+	return template.New(filepath.Base(path)).Funcs(ReportFuncs).ParseFiles(path)
+}
+
+// TemplateReporter is a reporter that executes a user's template with the
+// ReportData for the results, so a report can take any layout.
+type TemplateReporter struct {
+	Template    *template.Template
+	Collection  BucketCollection
+	Metadata    *AttackMetadata // of the result files, if they had any
+	Annotations Annotations     // the moments marked during the attack, if any
+	Scrapes     []ScrapeSample  // the target's metrics scraped during the attack, if any
+	SectionOptions
+}
+
+// Report implements the Reporter interface.
+func (tr TemplateReporter) Report(r Results) ([]byte, error) {
+	var buf bytes.Buffer
+	data := NewReportData(r, tr.Collection, tr.SectionOptions)
+	data.Attack = tr.Metadata
+	data.Annotations = tr.Annotations
+	data.TargetMetrics = NewTargetMetrics(r, tr.Scrapes, tr.ScrapeWindow)
+	err := tr.Template.Execute(&buf, data)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,116 @@
+package korra
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestTemplateReporter(t *testing.T) {
+	tmpl := template.Must(template.New("report").Funcs(ReportFuncs).Parse(
+		`{{.Overall.Results}} at {{percent .Overall.Metrics.Success}}{{range .Targets}}; {{.Name}}: {{.Results}}{{end}}` +
+			`{{range .Buckets}}; {{.Name}} max {{round .Metrics.Latencies.Max "1ms"}}{{end}}`))
+	now := time.Now()
+	r := Results{
+		{Code: 200, Method: "GET", Path: "/a", Target: "https://one", Timestamp: now, Latency: 10400 * time.Microsecond},
+		{Code: 500, Method: "GET", Path: "/a", Target: "https://two", Timestamp: now, Latency: 20400 * time.Microsecond, Error: "500 Internal Server Error"},
+	}
+	out, err := TemplateReporter{Template: tmpl}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "2 at 50.00%; https://one: 1; https://two: 1; GET /a max 20ms", string(out); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestReportDataWithoutTargets(t *testing.T) {
+	data := NewReportData(Results{{Code: 200, Method: "GET", Path: "/a", Timestamp: time.Now()}}, BucketCollection{}, SectionOptions{})
+	if len(data.Targets) != 0 {
+		t.Fatalf("want no target sections, got: %d", len(data.Targets))
+	}
+	if data.Remaining != nil {
+		t.Fatalf("want no remaining section, got: %+v", data.Remaining)
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	r := Results{
+		{Code: 200, Method: "GET", Path: "/a", Timestamp: time.Now()},
+		{Code: 200, Method: "GET", Path: "/b", Timestamp: time.Now()},
+	}
+	out, err := JSONReporter{}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Version  int `json:"version"`
+		Requests int `json:"requests"`
+		Buckets  []struct {
+			Name    string `json:"name"`
+			Results int    `json:"results"`
+			Metrics struct {
+				Requests int `json:"requests"`
+			} `json:"metrics"`
+		} `json:"buckets"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Version != JSONVersion || report.Requests != 2 {
+		t.Fatalf("want version %d with 2 requests at the top level, got: %s", JSONVersion, out)
+	}
+	if len(report.Buckets) != 2 || report.Buckets[0].Name != "GET /a" || report.Buckets[0].Metrics.Requests != 1 {
+		t.Fatalf("want a section for each bucket, got: %s", out)
+	}
+}
+
+func TestJSONSchemaVersion(t *testing.T) {
+	data, err := ioutil.ReadFile("../report-schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties struct {
+			Version struct {
+				Const int `json:"const"`
+			} `json:"version"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := JSONVersion, schema.Properties.Version.Const; want != got {
+		t.Fatalf("report-schema.json is out of date; want version: %d, got: %d", want, got)
+	}
+}
+
+func TestSlowest(t *testing.T) {
+	start := time.Now()
+	r := Results{
+		{Path: "/a", Timestamp: start, Latency: 10 * time.Millisecond},
+		{Path: "/b", Timestamp: start.Add(time.Second), Latency: 30 * time.Millisecond},
+		{Path: "/c", Timestamp: start.Add(2 * time.Second), Latency: 20 * time.Millisecond},
+		{Path: "/d", Timestamp: start.Add(3 * time.Second), Latency: 30 * time.Millisecond},
+	}
+	slowest := r.Slowest(3)
+	var paths []string
+	for _, result := range slowest {
+		paths = append(paths, result.Path)
+	}
+	if want, got := "/b /d /c", strings.Join(paths, " "); want != got {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+	if r[0].Path != "/a" {
+		t.Fatalf("want the results left in order, got: %s first", r[0].Path)
+	}
+	if got := len(r.Slowest(10)); got != len(r) {
+		t.Fatalf("want all %d results, got: %d", len(r), got)
+	}
+	if got := r.Slowest(0); got != nil {
+		t.Fatalf("want none, got: %v", got)
+	}
+}
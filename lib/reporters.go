@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -31,24 +32,56 @@ type HistogramReporter []time.Duration
 
 // Report implements the Reporter interface.
 func (h HistogramReporter) Report(r Results) ([]byte, error) {
-	var buf bytes.Buffer
-	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', tabwriter.StripEscape)
+	return h.Styled(HistogramStyle{}).Report(r)
+}
 
-	bucket := func(i int) string {
-		if i+1 >= len(h) {
-			return fmt.Sprintf("[%s,\t+Inf]", h[i])
+// Styled returns a reporter that draws the histogram with the style.
+func (h HistogramReporter) Styled(style HistogramStyle) Reporter {
+	return ReporterFunc(func(r Results) ([]byte, error) {
+		labels := make([]string, len(h))
+		for i := range h {
+			if i+1 >= len(h) {
+				labels[i] = fmt.Sprintf("[%s,\t+Inf]", h[i])
+			} else {
+				labels[i] = fmt.Sprintf("[%s,\t%s]", h[i], h[i+1])
+			}
 		}
-		return fmt.Sprintf("[%s,\t%s]", h[i], h[i+1])
-	}
+		return style.toText(labels, Histogram(h, r), r.Count())
+	})
+}
+
+// HistogramStyle sets how the bars of a histogram are drawn. By default a
+// bar is one '#' for each 1/75 of the total, so a bucket with a handful of
+// results next to one with thousands shows no bar at all.
+type HistogramStyle struct {
+	// Log scales each bar by the log of its count against the log of the
+	// total, so small buckets stay visible; the % column is still linear.
+	Log bool
+	// Unicode draws the bars with block characters in steps of an eighth,
+	// and gives every bucket with results at least the smallest step.
+	Unicode bool
+}
+
+// eighthBlocks are the unicode blocks for 0 to 7 eighths of a character
+var eighthBlocks = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+// histogramWidth is the number of characters for a bar holding the total
+const histogramWidth = 75
+
+// toText writes the counts for each labeled bucket as aligned text, with a
+// bar for each bucket's share of the total
+func (s HistogramStyle) toText(labels []string, counts []uint64, total int) ([]byte, error) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', tabwriter.StripEscape)
 
 	fmt.Fprintf(w, "Bucket\t\t#\t%%\tHistogram\n")
-	for i, count := range Histogram(h, r) {
-		ratio := float64(count) / float64(len(r))
+	for i, count := range counts {
+		ratio := float64(count) / float64(total)
 		fmt.Fprintf(w, "%s\t%d\t%.2f%%\t%s\n",
-			bucket(i),
+			labels[i],
 			count,
 			ratio*100,
-			strings.Repeat("#", int(ratio*75)),
+			s.bar(count, total),
 		)
 	}
 
@@ -56,9 +89,41 @@ func (h HistogramReporter) Report(r Results) ([]byte, error) {
 	return buf.Bytes(), err
 }
 
-// Set implements the flag.Value interface.
+// bar draws the bar for a bucket with count of the total results
+func (s HistogramStyle) bar(count uint64, total int) string {
+	if count == 0 || total == 0 {
+		return ""
+	}
+	scale := float64(count) / float64(total)
+	if s.Log {
+		scale = math.Log1p(float64(count)) / math.Log1p(float64(total))
+	}
+	if !s.Unicode {
+		return strings.Repeat("#", int(scale*histogramWidth))
+	}
+	eighths := int(scale * histogramWidth * 8)
+	if eighths == 0 {
+		eighths = 1
+	}
+	return strings.Repeat("█", eighths/8) + eighthBlocks[eighths%8]
+}
+
+// Set implements the flag.Value interface. Besides a list of buckets it
+// takes a generator for them (see LinearBuckets and ExponentialBuckets):
+//
+//	[linear:min,max,count]
+//	[exp:start,factor,count]
 func (h *HistogramReporter) Set(value string) error {
-	for _, v := range strings.Split(value[1:len(value)-1], ",") {
+	spec := value[1 : len(value)-1]
+	if pieces := strings.SplitN(spec, ":", 2); len(pieces) == 2 {
+		buckets, err := generateBuckets(pieces[0], strings.Split(pieces[1], ","))
+		if err != nil {
+			return fmt.Errorf("bad buckets %s: %s", value, err)
+		}
+		*h = append(*h, buckets...)
+		return nil
+	}
+	for _, v := range strings.Split(spec, ",") {
 		d, err := time.ParseDuration(v)
 		if err != nil {
 			return err
@@ -80,65 +145,546 @@ func (h HistogramReporter) String() string {
 	return "[" + strings.Join(strs, ",") + "]"
 }
 
+// QuantileHistogramReporter is a reporter that computes latency histograms
+// with buckets generated from the results, so each bucket holds about the
+// same number of them (see QuantileBuckets); its value is the number of
+// buckets.
+type QuantileHistogramReporter int
+
+// Report implements the Reporter interface.
+func (q QuantileHistogramReporter) Report(r Results) ([]byte, error) {
+	return q.Styled(HistogramStyle{}).Report(r)
+}
+
+// Styled returns a reporter that draws the histogram with the style.
+func (q QuantileHistogramReporter) Styled(style HistogramStyle) Reporter {
+	return ReporterFunc(func(r Results) ([]byte, error) {
+		return HistogramReporter(QuantileBuckets(r, int(q))).Styled(style).Report(r)
+	})
+}
+
+// SizeHistogramReporter is a reporter that computes histograms of the
+// bytes received with the given buckets of sizes.
+type SizeHistogramReporter []uint64
+
+// Report implements the Reporter interface.
+func (h SizeHistogramReporter) Report(r Results) ([]byte, error) {
+	return h.Styled(HistogramStyle{}).Report(r)
+}
+
+// Styled returns a reporter that draws the histogram with the style.
+func (h SizeHistogramReporter) Styled(style HistogramStyle) Reporter {
+	return ReporterFunc(func(r Results) ([]byte, error) {
+		labels := make([]string, len(h))
+		for i := range h {
+			if i+1 >= len(h) {
+				labels[i] = fmt.Sprintf("[%s,\t+Inf]", formatBytes(h[i]))
+			} else {
+				labels[i] = fmt.Sprintf("[%s,\t%s]", formatBytes(h[i]), formatBytes(h[i+1]))
+			}
+		}
+		return style.toText(labels, SizeHistogram(h, r), r.Count())
+	})
+}
+
+// Set implements the flag.Value interface, with sizes as plain bytes or
+// with a unit of B, KB, MB or GB (each 1024 of the one before).
+func (h *SizeHistogramReporter) Set(value string) error {
+	for _, v := range strings.Split(value[1:len(value)-1], ",") {
+		size, err := parseBytes(strings.TrimSpace(v))
+		if err != nil {
+			return err
+		}
+		*h = append(*h, size)
+	}
+	if len(*h) == 0 {
+		return fmt.Errorf("bad buckets: %s", value)
+	}
+	return nil
+}
+
+// String implements the fmt.Stringer interface.
+func (h SizeHistogramReporter) String() string {
+	strs := make([]string, len(h))
+	for i := range strs {
+		strs[i] = strconv.FormatUint(h[i], 10)
+	}
+	return "[" + strings.Join(strs, ",") + "]"
+}
+
+var byteUnits = []string{"B", "KB", "MB", "GB"}
+
+func parseBytes(value string) (uint64, error) {
+	upper := strings.ToUpper(value)
+	for i := len(byteUnits) - 1; i >= 0; i-- {
+		if strings.HasSuffix(upper, byteUnits[i]) {
+			n, err := strconv.ParseFloat(strings.TrimSpace(upper[:len(upper)-len(byteUnits[i])]), 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("bad size: %s", value)
+			}
+			return uint64(n * float64(uint64(1)<<(10*uint(i)))), nil
+		}
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad size: %s", value)
+	}
+	return n, nil
+}
+
+// formatBytes shows the size in the largest unit it's a whole number of
+func formatBytes(size uint64) string {
+	for i := len(byteUnits) - 1; i > 0; i-- {
+		if unit := uint64(1) << (10 * uint(i)); size >= unit && size%unit == 0 {
+			return fmt.Sprintf("%d%s", size/unit, byteUnits[i])
+		}
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+// formatRate shows the bytes per second in the largest unit it's at least
+// one of
+func formatRate(rate float64) string {
+	for i := len(byteUnits) - 1; i > 0; i-- {
+		if unit := float64(uint64(1) << (10 * uint(i))); rate >= unit {
+			return fmt.Sprintf("%.2f%s/s", rate/unit, byteUnits[i])
+		}
+	}
+	return fmt.Sprintf("%.2fB/s", rate)
+}
+
 // TextReporter returns a set of computed Metrics structs as aligned, formatted
-// text -- one for overall performance, and one for each URL bucket.
+// text -- one for overall performance, one for each of the Stages if there
+// are any, one for each target base URL if ByTarget is set, one for each
+// instance named by the InstanceHeader if there is one, and one for each URL
+// bucket. With Color set it's colored
+// for a terminal: headings bold, labels dimmed, and the success ratio, status
+// codes, timeouts and errors green, yellow or red by how they look.
 type TextReporter struct {
+	ByTarget   bool
 	Collection BucketCollection
+	Color      bool
 	ShowUrls   bool
+	Metadata   *AttackMetadata // of the result files, if they had any
+	// Annotations are the moments marked during the attack, listed after
+	// its metadata and marked under every section's sparklines
+	Annotations Annotations
+	// Scrapes are the target's metrics scraped during the attack, reported
+	// over windows of the ScrapeWindow next to the results
+	Scrapes []ScrapeSample
+	SectionOptions
 }
 
 func (tr TextReporter) Report(r Results) ([]byte, error) {
 	var err error
 
-	// first display overall results
+	// first describe the attack the results came from
 	out := &bytes.Buffer{}
-	fmt.Fprintf(out, "OVERALL: %d results\n", len(r))
-	if err = resultsToText(out, tr.ShowUrls, r, make(map[string]uint32)); err != nil {
+	span := spanOf(r)
+	colors := palette(tr.Color)
+	if tr.Metadata != nil {
+		tr.metadataToText(out)
+	}
+	if len(tr.Annotations) > 0 {
+		tr.annotationsToText(out, span)
+	}
+
+	// then display overall results
+	fmt.Fprintln(out, colors.heading(fmt.Sprintf("OVERALL: %d results", r.Count())))
+	if err = tr.resultsToText(out, span, r, make(map[string]uint32)); err != nil {
 		return []byte{}, err
 	}
 
+	// then display results per stage, so each step of load reads on its own
+	for i, byStage := range SplitStages(r, tr.Stages) {
+		fmt.Fprintln(out, colors.heading(fmt.Sprintf("STAGE %s: %d results", tr.Stages[i], byStage.Count())))
+		if err = tr.resultsToText(out, span, byStage, make(map[string]uint32)); err != nil {
+			return []byte{}, err
+		}
+	}
+
+	// then display results per target, so they can be compared
+	if tr.ByTarget {
+		targets, byTarget := splitByTarget(r)
+		for _, target := range targets {
+			label := target
+			if label == "" {
+				label = "(none)"
+			}
+			fmt.Fprintln(out, colors.heading(fmt.Sprintf("TARGET %s: %d results", label, byTarget[target].Count())))
+			if err = tr.resultsToText(out, span, byTarget[target], make(map[string]uint32)); err != nil {
+				return []byte{}, err
+			}
+		}
+	}
+
+	// then display results per instance that served them, to see how evenly
+	// they were balanced
+	if tr.InstanceHeader != "" {
+		instances, byInstance := splitByHeader(r, tr.InstanceHeader)
+		for _, instance := range instances {
+			count := byInstance[instance].Count()
+			fmt.Fprintln(out, colors.heading(fmt.Sprintf("INSTANCE %s=%s: %d results, %.2f%%",
+				tr.InstanceHeader, instance, count, float64(count)/float64(r.Count())*100)))
+			if err = tr.resultsToText(out, span, byInstance[instance], make(map[string]uint32)); err != nil {
+				return []byte{}, err
+			}
+		}
+	}
+
 	// then display results per URL bucket
 	// ...if no buckets infer from results
 	tr.Collection.AddResults(r)
 
 	// ...then display results for each
 	for _, bucket := range tr.Collection.Buckets() {
-		fmt.Fprintf(out, "%s: %d results\n", bucket.String(), len(bucket.Results))
-		if err = resultsToText(out, tr.ShowUrls, bucket.Results, bucket.Urls); err != nil {
+		fmt.Fprintln(out, colors.heading(fmt.Sprintf("%s: %d results", bucket.String(), bucket.Results.Count())))
+		if err = tr.resultsToText(out, span, bucket.Results, bucket.Urls); err != nil {
 			return []byte{}, err
 		}
 	}
 	catchAll := tr.Collection.CatchAllBucket()
 	if catchAll != nil && len(catchAll.Results) > 0 {
-		fmt.Fprintf(out, "Remaining: %d results\n", len(catchAll.Results))
-		resultsToText(out, tr.ShowUrls, catchAll.Results, catchAll.Urls)
+		fmt.Fprintln(out, colors.heading(fmt.Sprintf("Remaining: %d results", catchAll.Results.Count())))
+		tr.resultsToText(out, span, catchAll.Results, catchAll.Urls)
+	}
+
+	// then display each HTML page with its assets, to read in page loads
+	pages, byPage := SplitPages(r)
+	for _, page := range pages {
+		fmt.Fprintln(out, colors.heading(fmt.Sprintf("PAGE %s: %d results", page, byPage[page].Count())))
+		if err = tr.resultsToText(out, span, byPage[page], make(map[string]uint32)); err != nil {
+			return []byte{}, err
+		}
+	}
+
+	// finally whether each bucket's errors come with its slowdowns, and
+	// whether the concurrency adds up
+	if tr.CorrelationWindow > 0 {
+		if err = tr.correlationsToText(out, r, catchAll); err != nil {
+			return out.Bytes(), err
+		}
+	}
+	if tr.LittlesLaw {
+		tr.littleToText(out, r)
+	}
+	if tm := NewTargetMetrics(r, tr.Scrapes, tr.ScrapeWindow); tm != nil {
+		fmt.Fprintln(out, colors.heading(fmt.Sprintf("TARGET METRICS: %d series over %s windows", len(tm.Series), tm.Window)))
+		err = tm.toText(out, colors)
+	}
+	return out.Bytes(), err
+}
+
+// littleToText writes how the requests in flight compare with what Little's
+// Law expects of the results
+func (tr TextReporter) littleToText(out io.Writer, r Results) {
+	c := palette(tr.Color)
+	fmt.Fprintln(out, c.heading("LITTLE'S LAW: requests in flight"))
+	check := CheckLittle(r)
+	if check == nil {
+		fmt.Fprintf(out, "OVERALL  %s\n", c.label("(nothing recorded what was in flight)"))
+		return
+	}
+	text := check.String()
+	if check.Flagged {
+		text = c.problems(1, text)
+	}
+	fmt.Fprintf(out, "OVERALL  %s\n", text)
+}
+
+// correlationsToText writes how closely the error rate follows latency for
+// all the results and for each bucket
+func (tr TextReporter) correlationsToText(out io.Writer, r Results, catchAll *PathBucket) error {
+	c := palette(tr.Color)
+	fmt.Fprintln(out, c.heading(fmt.Sprintf("ERRORS VS LATENCY: correlated over %s windows", tr.CorrelationWindow)))
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', tabwriter.StripEscape)
+	line := func(name string, r Results) {
+		correlation := CorrelateErrors(r, tr.CorrelationWindow)
+		if correlation == nil {
+			fmt.Fprintf(w, "%s\t%s\n", name, c.label("(nothing to correlate)"))
+			return
+		}
+		text := correlation.String()
+		if correlation.Coincide {
+			text = c.problems(1, text)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, text)
+	}
+	line("OVERALL", r)
+	for _, bucket := range tr.Collection.Buckets() {
+		line(bucket.String(), bucket.Results)
+	}
+	if catchAll != nil && len(catchAll.Results) > 0 {
+		line("Remaining", catchAll.Results)
 	}
-	return out.Bytes(), nil
+	return w.Flush()
 }
 
-func resultsToText(out io.Writer, showUrls bool, r Results, urlCounts map[string]uint32) error {
+// metadataToText writes what the result files say about their attack
+func (tr TextReporter) metadataToText(out io.Writer) {
+	c := palette(tr.Color)
+	m := tr.Metadata
+	started := make([]string, len(m.Started))
+	for i, start := range m.Started {
+		started[i] = start.Format(time.RFC3339)
+	}
+	fmt.Fprintln(out, c.heading(fmt.Sprintf("ATTACK: %d result files", m.Files)))
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', tabwriter.StripEscape)
+	fmt.Fprintf(w, "Korra\t%s\t%s\n", c.label("[versions]"), strings.Join(m.Versions, ", "))
+	fmt.Fprintf(w, "Hosts\t%s\t%s\n", c.label("[names]"), strings.Join(m.Hosts, ", "))
+	fmt.Fprintf(w, "Started\t%s\t%s\n", c.label("[times]"), strings.Join(started, ", "))
+	fmt.Fprintf(w, "Settings\t%s\t%s\n", c.label("[in common]"), settingsString(m.Settings))
+	if m.Skew > 0 || len(m.Unsynced) > 0 {
+		skew := fmt.Sprintf("±%s", m.Skew)
+		if len(m.Unsynced) > 0 {
+			skew += fmt.Sprintf(", unknown for %s", strings.Join(m.Unsynced, ", "))
+		}
+		fmt.Fprintf(w, "Clock skew\t%s\t%s\n", c.label("[residual]"), skew)
+	}
+	w.Flush()
+}
+
+// annotationsToText lists the annotations made during the attack, numbered
+// as they're marked under the sparklines, with how far into the run each was
+func (tr TextReporter) annotationsToText(out io.Writer, span runSpan) {
+	c := palette(tr.Color)
+	fmt.Fprintln(out, c.heading(fmt.Sprintf("ANNOTATIONS: %d", len(tr.Annotations))))
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', tabwriter.StripEscape)
+	for i, a := range tr.Annotations {
+		mark := "+"
+		if i < 9 {
+			mark = strconv.Itoa(i + 1)
+		}
+		offset := c.label("[before the run]")
+		if !a.Timestamp.Before(span.start) {
+			offset = c.label(fmt.Sprintf("[+%s]", a.Timestamp.Sub(span.start).Round(time.Millisecond)))
+		}
+		text := a.Text
+		if a.By != "" {
+			text += " " + c.label("("+a.By+")")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, a.Timestamp.Format("15:04:05.000"), offset, text)
+	}
+	w.Flush()
+}
+
+// splitByTarget groups the results by their target, returning the targets
+// sorted
+func splitByTarget(r Results) ([]string, map[string]Results) {
+	byTarget := map[string]Results{}
+	for _, result := range r {
+		byTarget[result.Target] = append(byTarget[result.Target], result)
+	}
+	targets := make([]string, 0, len(byTarget))
+	for target := range byTarget {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets, byTarget
+}
+
+// certificateErrors returns how many requests failed because a server's
+// certificate didn't verify
+func certificateErrors(m *Metrics) int {
+	total := 0
+	for _, count := range m.CertificateErrors {
+		total += count
+	}
+	return total
+}
+
+// abandoned returns how many sessions were abandoned
+func abandoned(m *Metrics) int {
+	total := 0
+	for _, count := range m.Abandoned {
+		total += count
+	}
+	return total
+}
+
+// splitByHeader groups the results by their value of the recorded response
+// header, returning the values sorted; results without it are under (none)
+func splitByHeader(r Results, header string) ([]string, map[string]Results) {
+	byValue := map[string]Results{}
+	for _, result := range r {
+		value, ok := result.Headers[header]
+		if !ok {
+			value = "(none)"
+		}
+		byValue[value] = append(byValue[value], result)
+	}
+	values := make([]string, 0, len(byValue))
+	for value := range byValue {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values, byValue
+}
+
+// resultsToText writes the metrics for the results, with sparklines drawn
+// over the span of the whole run
+func (tr TextReporter) resultsToText(out io.Writer, span runSpan, r Results, urlCounts map[string]uint32) error {
 	m := NewMetrics(r)
+	c := palette(tr.Color)
 	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', tabwriter.StripEscape)
-	fmt.Fprintf(w, "Requests\t[total]\t%d\n", m.Requests)
-	fmt.Fprintf(w, "Duration\t[total, attack, wait]\t%s, %s, %s\n", m.Duration+m.Wait, m.Duration, m.Wait)
-	fmt.Fprintf(w, "Latencies\t[mean, 50, 95, 99, max]\t%s, %s, %s, %s, %s\n",
+	fmt.Fprintf(w, "Requests\t%s\t%d\n", c.label("[total]"), m.Requests)
+	fmt.Fprintf(w, "Duration\t%s\t%s, %s, %s\n", c.label("[total, attack, wait]"), m.Duration+m.Wait, m.Duration, m.Wait)
+	fmt.Fprintf(w, "Latencies\t%s\t%s, %s, %s, %s, %s\n", c.label("[mean, 50, 95, 99, max]"),
 		m.Latencies.Mean, m.Latencies.P50, m.Latencies.P95, m.Latencies.P99, m.Latencies.Max)
-	fmt.Fprintf(w, "Bytes In\t[total, mean]\t%d, %.2f\n", m.BytesIn.Total, m.BytesIn.Mean)
-	fmt.Fprintf(w, "Bytes Out\t[total, mean]\t%d, %.2f\n", m.BytesOut.Total, m.BytesOut.Mean)
-	fmt.Fprintf(w, "Success\t[ratio]\t%.2f%%\n", m.Success*100)
-	fmt.Fprintf(w, "Status Codes\t[code:count]\t")
+	if m.Events.Total > 0 {
+		fmt.Fprintf(w, "Events\t%s\t%d, %s, %s, %s\n", c.label("[total, first mean, interval mean, interval max]"),
+			m.Events.Total, m.Events.FirstMean, m.Events.IntervalMean, m.Events.IntervalMax)
+	}
+	if m.Held > 0 {
+		fmt.Fprintf(w, "Long Polls\t%s\t%d\n", c.label("[held]"), m.Held)
+	}
+	if d := m.Downloads; d.Total > 0 {
+		fmt.Fprintf(w, "Downloads\t%s\t%d, %d, %s, %s, %s\n", c.label("[total, ranges, mean rate, min rate, max rate]"),
+			d.Total, d.Ranges, formatRate(d.Rate.Mean), formatRate(d.Rate.Min), formatRate(d.Rate.Max))
+	}
+	if p := m.Playback; p.Total > 0 {
+		fmt.Fprintf(w, "Playback\t%s\t%d, %d, %d, %.2f%%, %s, %s\n", c.label("[total, segments, rebuffers, rebuffer ratio, mean startup, max startup]"),
+			p.Total, p.Segments, p.Rebuffers, p.RebufferRatio*100, p.Startup.Mean, p.Startup.Max)
+		s := p.SegmentLatencies
+		fmt.Fprintf(w, "Segments\t%s\t%s, %s, %s, %s, %s\n", c.label("[mean, 50, 95, 99, max]"), s.Mean, s.P50, s.P95, s.P99, s.Max)
+	}
+	if a := m.Assets; a.Pages > 0 {
+		fmt.Fprintf(w, "Assets\t%s\t%d, %d\n", c.label("[total, pages]"), a.Total, a.Pages)
+		p := a.PageLoad
+		fmt.Fprintf(w, "Page Complete\t%s\t%s, %s, %s, %s, %s\n", c.label("[mean, 50, 95, 99, max]"), p.Mean, p.P50, p.P95, p.P99, p.Max)
+	}
+	if d := m.Deliveries; d.Total > 0 {
+		l := d.Latencies
+		fmt.Fprintf(w, "Deliveries\t%s\t%d, %d, %s, %s, %s, %s, %s\n", c.label("[total, lost, mean, 50, 95, 99, max]"),
+			d.Total, d.Lost, l.Mean, l.P50, l.P95, l.P99, l.Max)
+	}
+	if m.IntegrityErrors > 0 {
+		fmt.Fprintf(w, "Integrity\t%s\t%s\n", c.label("[checksum mismatches]"), c.problems(int(m.IntegrityErrors), strconv.FormatUint(m.IntegrityErrors, 10)))
+	}
+	if t := m.Transfers; t.Responses > 0 {
+		for _, times := range []struct {
+			name  string
+			stats DurationStats
+		}{{"First Byte", t.FirstByte}, {"Last Byte", t.LastByte}} {
+			fmt.Fprintf(w, "%s\t%s\t%s, %s, %s, %s, %s\n", times.name, c.label("[mean, 50, 95, 99, max]"),
+				times.stats.Mean, times.stats.P50, times.stats.P95, times.stats.P99, times.stats.Max)
+		}
+		fmt.Fprintf(w, "Transfer Rate\t%s\t%s, %s, %s, %s\n", c.label("[mean, min, 50, max]"),
+			formatRate(t.Rate.Mean), formatRate(t.Rate.Min), formatRate(t.Rate.P50), formatRate(t.Rate.Max))
+	}
+	fmt.Fprintf(w, "DNS\t%s\t%d, %s, %s\n", c.label("[lookups, mean, max]"), m.DNS.Lookups, m.DNS.Mean, m.DNS.Max)
+	if m.TLS.Handshakes > 0 {
+		fmt.Fprintf(w, "TLS\t%s\t%d, %.2f%%, %s, %s, %s, %s, %s\n", c.label("[handshakes, resumed, mean, 50, 95, 99, max]"),
+			m.TLS.Handshakes, m.TLS.Resumption*100, m.TLS.Mean, m.TLS.P50, m.TLS.P95, m.TLS.P99, m.TLS.Max)
+	}
+	fmt.Fprintf(w, "Bytes In\t%s\t%d, %.2f\n", c.label("[total, mean]"), m.BytesIn.Total, m.BytesIn.Mean)
+	fmt.Fprintf(w, "Bytes Out\t%s\t%d, %.2f\n", c.label("[total, mean]"), m.BytesOut.Total, m.BytesOut.Mean)
+	fmt.Fprintf(w, "Success\t%s\t%s\n", c.label("[ratio]"), c.success(m.Success, fmt.Sprintf("%.2f%%", m.Success*100)))
+	if budget := NewErrorBudget(m, tr.SLO); budget != nil {
+		text := budget.String()
+		if budget.BurnRate > 1 {
+			text = c.problems(1, text)
+		}
+		fmt.Fprintf(w, "Error Budget\t%s\t%s\n", c.label("[SLO, burn rate, spent, lasts]"), text)
+	}
+	span.sparklinesToText(w, c, r, tr.Annotations)
+	fmt.Fprintf(w, "Cache\t%s\t%d, %d\n", c.label("[conditional, not modified]"), m.Cache.Conditional, m.Cache.NotModified)
+	headerNames := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	for _, name := range headerNames {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, c.label(fmt.Sprintf("[%d values]", len(m.Headers[name]))), headerValues(m.Headers[name], m.Requests))
+	}
+	for _, kind := range FuzzKinds {
+		if codes := m.Fuzz[kind]; codes != nil {
+			fmt.Fprintf(w, "Fuzzed %s\t%s\t", kind, c.label("[code:count]"))
+			fuzzCodes := make([]string, 0, len(codes))
+			for code := range codes {
+				fuzzCodes = append(fuzzCodes, code)
+			}
+			sort.Strings(fuzzCodes)
+			for _, code := range fuzzCodes {
+				fmt.Fprintf(w, "%s  ", c.status(code, fmt.Sprintf("%s:%d", code, codes[code])))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	if split := SplitByCache(r, tr.CacheHeader); split != nil {
+		for _, side := range []struct {
+			name string
+			l    CacheLatencies
+		}{{"Cache Hits", split.Hits}, {"Cache Misses", split.Misses}} {
+			fmt.Fprintf(w, "%s\t%s\t%d, %s, %s, %s, %s, %s\n", side.name, c.label("[results, mean, 50, 95, 99, max]"),
+				side.l.Results, side.l.Mean, side.l.P50, side.l.P95, side.l.P99, side.l.Max)
+		}
+	}
+	fmt.Fprintf(w, "Status Codes\t%s\t", c.label("[code:count]"))
 	for code, count := range m.StatusCodes {
-		fmt.Fprintf(w, "%s:%d  ", code, count)
+		fmt.Fprintf(w, "%s  ", c.status(code, fmt.Sprintf("%s:%d", code, count)))
+	}
+	if len(m.Rcodes) > 0 {
+		rcodes := make([]string, 0, len(m.Rcodes))
+		for rcode := range m.Rcodes {
+			rcodes = append(rcodes, rcode)
+		}
+		sort.Strings(rcodes)
+		fmt.Fprintf(w, "\nDNS Rcodes\t%s\t", c.label("[rcode:count]"))
+		for _, rcode := range rcodes {
+			fmt.Fprintf(w, "%s:%d  ", rcode, m.Rcodes[rcode])
+		}
+	}
+	fmt.Fprintf(w, "\nTimeouts\t%s\t", c.label("["+strings.Join(TimeoutKinds, ", ")+"]"))
+	timeoutCounts := make([]string, len(TimeoutKinds))
+	for i, kind := range TimeoutKinds {
+		timeoutCounts[i] = c.problems(m.Timeouts[kind], strconv.Itoa(m.Timeouts[kind]))
+	}
+	fmt.Fprintf(w, "%s", strings.Join(timeoutCounts, ", "))
+	if certificateErrors(m) > 0 {
+		fmt.Fprintf(w, "\nCertificate Errors\t%s\t", c.label("["+strings.Join(CertificateErrorKinds, ", ")+"]"))
+		certCounts := make([]string, len(CertificateErrorKinds))
+		for i, kind := range CertificateErrorKinds {
+			certCounts[i] = c.problems(m.CertificateErrors[kind], strconv.Itoa(m.CertificateErrors[kind]))
+		}
+		fmt.Fprintf(w, "%s", strings.Join(certCounts, ", "))
+	}
+	if abandoned(m) > 0 {
+		fmt.Fprintf(w, "\nAbandoned\t%s\t", c.label("["+strings.Join(AbandonKinds, ", ")+"]"))
+		abandonCounts := make([]string, len(AbandonKinds))
+		for i, kind := range AbandonKinds {
+			abandonCounts[i] = c.problems(m.Abandoned[kind], strconv.Itoa(m.Abandoned[kind]))
+		}
+		fmt.Fprintf(w, "%s", strings.Join(abandonCounts, ", "))
 	}
 	errorCount := strconv.Itoa(len(m.Errors))
 	if errorCount == "0" {
 		errorCount = "(empty)"
 	}
-	fmt.Fprintf(w, "\nError Set: %s\n", errorCount)
+	fmt.Fprintf(w, "\nError Set: %s\n", c.problems(len(m.Errors), errorCount))
 	for _, err := range m.Errors {
-		fmt.Fprintln(w, err)
+		fmt.Fprintln(w, c.problems(1, err))
+	}
+	if slowest := r.Slowest(tr.Slowest); len(slowest) > 0 {
+		fmt.Fprintf(w, "Slowest %d:\n", len(slowest))
+		for _, result := range slowest {
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s %s%s\n", result.Timestamp.Format(time.RFC3339Nano), result.Latency,
+				c.status(strconv.Itoa(int(result.Code)), strconv.Itoa(int(result.Code))), result.Method, result.Target, result.Path)
+		}
 	}
-	if showUrls {
+	if anomalies := DetectAnomalies(r, tr.AnomalyWindow); len(anomalies) > 0 {
+		fmt.Fprintf(w, "Anomalies %d: %s windows over %.1f MADs above the median\n", len(anomalies), tr.AnomalyWindow, AnomalyThreshold)
+		for _, anomaly := range anomalies {
+			fmt.Fprintf(w, "\t%s\n", c.problems(1, anomaly.String()))
+		}
+	}
+	if timeline := NewStatusTimeline(r, tr.TimelineWindow); timeline != nil {
+		fmt.Fprintf(w, "Status Timeline: %d outages in %d %s windows\n", len(timeline.Outages), len(timeline.Windows), tr.TimelineWindow)
+		for _, outage := range timeline.Outages {
+			fmt.Fprintf(w, "\t%s\n", c.problems(1, outage.String()))
+		}
+	}
+	if tr.ShowUrls {
 		fmt.Fprintf(w, "URLs in bucket:\n")
 		sorted := make([]string, len(urlCounts))
 		idx := 0
@@ -154,7 +700,86 @@ func resultsToText(out io.Writer, showUrls bool, r Results, urlCounts map[string
 	return w.Flush()
 }
 
-// ReportJSON writes a computed Metrics struct to as JSON
+// headerValuesShown is the most values of a response header a text report
+// lists, the most common first
+const headerValuesShown = 10
+
+// headerValues lists the values of a header recorded with how many of the
+// requests had each, the most common first
+func headerValues(values map[string]int, requests uint64) string {
+	sorted := make([]string, 0, len(values))
+	for value := range values {
+		sorted = append(sorted, value)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if values[sorted[i]] != values[sorted[j]] {
+			return values[sorted[i]] > values[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+	shown := make([]string, 0, headerValuesShown+1)
+	for i, value := range sorted {
+		if i == headerValuesShown {
+			shown = append(shown, fmt.Sprintf("%d more", len(sorted)-i))
+			break
+		}
+		shown = append(shown, fmt.Sprintf("%s:%d (%.2f%%)", value, values[value], float64(values[value])/float64(requests)*100))
+	}
+	return strings.Join(shown, ", ")
+}
+
+// JSONVersion is the version of the schema JSONReporter writes, in
+// report-schema.json. It goes up when a field is renamed, removed or changes
+// meaning, not when one is added.
+const JSONVersion = 2
+
+// JSONReporter writes the overall Metrics as JSON, with the same sections
+// for each stage, target, instance and URL bucket the TextReporter has. The overall metrics
+// stay at the top level, as they were before there were sections.
+type JSONReporter struct {
+	Collection  BucketCollection
+	Metadata    *AttackMetadata // of the result files, if they had any
+	Annotations Annotations     // made during the attack, if any
+	Scrapes     []ScrapeSample  // of the target's metrics during the attack, if any
+	SectionOptions
+}
+
+type jsonReport struct {
+	Version int `json:"version"`
+	*Metrics
+	Attack      *AttackMetadata `json:"attack,omitempty"`
+	Annotations Annotations     `json:"annotations,omitempty"`
+	Little      *LittleCheck    `json:"little,omitempty"`
+	Target      *TargetMetrics  `json:"target_metrics,omitempty"`
+	Stages      []ReportSection `json:"stages,omitempty"`
+	Targets     []ReportSection `json:"targets,omitempty"`
+	Instances   []ReportSection `json:"instances,omitempty"`
+	Buckets     []ReportSection `json:"buckets"`
+	Pages       []ReportSection `json:"pages,omitempty"`
+	Remaining   *ReportSection  `json:"remaining,omitempty"`
+}
+
+// Report implements the Reporter interface.
+func (jr JSONReporter) Report(r Results) ([]byte, error) {
+	data := NewReportData(r, jr.Collection, jr.SectionOptions)
+	return json.Marshal(jsonReport{
+		Version:     JSONVersion,
+		Metrics:     data.Overall.Metrics,
+		Attack:      jr.Metadata,
+		Annotations: jr.Annotations,
+		Little:      data.Little,
+		Target:      NewTargetMetrics(r, jr.Scrapes, jr.ScrapeWindow),
+		Stages:      data.Stages,
+		Targets:     data.Targets,
+		Instances:   data.Instances,
+		Buckets:     data.Buckets,
+		Pages:       data.Pages,
+		Remaining:   data.Remaining,
+	})
+}
+
+// ReportJSON writes a computed Metrics struct to as JSON, with sections for
+// the URL buckets inferred from the results
 var ReportJSON ReporterFunc = func(r Results) ([]byte, error) {
-	return json.Marshal(NewMetrics(r))
+	return JSONReporter{}.Report(r)
 }
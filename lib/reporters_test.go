@@ -5,7 +5,7 @@ import (
 	"time"
 )
 
-func BenchmarkReportPlot(b *testing.B) {
+func BenchmarkTextReport(b *testing.B) {
 	b.StopTimer()
 	// Build result set
 	results := make(Results, 50000)
@@ -22,6 +22,6 @@ func BenchmarkReportPlot(b *testing.B) {
 	// Start benchmark
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		ReportPlot(results)
+		TextReporter{}.Report(results)
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/gob"
 	"io"
 	"regexp"
+	"sort"
 	"sync"
 	"time"
 )
@@ -18,18 +19,129 @@ type Result struct {
 	BytesOut     uint64        `json:"bytes_out"`
 	BytesIn      uint64        `json:"bytes_in"`
 	Code         uint16        `json:"code"`
+	Conditional  bool          `json:"conditional"`
+	DNSLatency   time.Duration `json:"dns_latency"`
+	DNSResolver  string        `json:"dns_resolver"`
 	Error        string        `json:"error"`
+	Event        int           `json:"event"`
+	InFlight     int           `json:"in_flight,omitempty"` // requests the generator had in flight as it sent this one, counting it; 0 if not recorded
 	Latency      time.Duration `json:"latency"`
 	Method       string        `json:"method"`
 	RequestCount int           `json:"request_count"`
 	Timestamp    time.Time     `json:"timestamp"`
 	Path         string        `json:"path"`
+	Target       string        `json:"target"` // base URL the request was balanced to, if any
+	// Weight is how many results this one stands for, in a downsampled
+	// result file; its latencies and sizes are their means. 0 is the same as
+	// 1, so results recorded by sessions don't carry it.
+	Weight int `json:"weight,omitempty"`
+	// Headers are the values of the response headers recorded, by name
+	// (see RecordHeaders)
+	Headers map[string]string `json:"headers,omitempty"`
+	// TLSHandshake is how long the TLS handshake of a new connection for
+	// the request took, and TLSResumed whether it resumed an earlier session
+	// (see TLSResumption); both are zero for a reused connection or no TLS.
+	TLSHandshake time.Duration `json:"tls_handshake,omitempty"`
+	TLSResumed   bool          `json:"tls_resumed,omitempty"`
+	// Fuzz is the protocol anomaly the request was sent with, one of
+	// FuzzKinds, or empty if it was sent as it should be (see Fuzz)
+	Fuzz string `json:"fuzz,omitempty"`
+	// Abandoned is why the session's user gave up on seeing this result, one
+	// of AbandonKinds, or empty if they didn't (see Abandonment)
+	Abandoned string `json:"abandoned,omitempty"`
+	// Held is true for a LONGPOLL cycle the server held for its whole Hold
+	// without answering, as it does with no news; it has no status code
+	// and no error.
+	Held bool `json:"held,omitempty"`
+	// FirstByte and LastByte are how long after the request was sent the
+	// first and last bytes of the response came, when its body was read
+	// to the end (see Transfers), or those of the file an FTP or SFTP step
+	// downloaded; for one it uploaded, when the server was ready for the
+	// file and when it had it. Both are zero otherwise.
+	FirstByte time.Duration `json:"first_byte,omitempty"`
+	LastByte  time.Duration `json:"last_byte,omitempty"`
+	// Ranges is set on the result summing up a RANGES download, to the
+	// number of ranges it took; its latency is the whole download's, and
+	// its bytes in those of every range. It isn't a request of its own.
+	Ranges int `json:"ranges,omitempty"`
+	// Segment is true for a segment a PLAYBACK step fetched. Segments is
+	// set on the result summing up a PLAYBACK as a whole, to the number of
+	// segments it took; its latency is the whole playback's, its bytes in
+	// those of every manifest and segment, and it isn't a request of its
+	// own. Rebuffers counts the times the playback stalled with its buffer
+	// run out, for Stalled in all, and Startup is how long it took to start.
+	Segment   bool          `json:"segment,omitempty"`
+	Segments  int           `json:"segments,omitempty"`
+	Rebuffers int           `json:"rebuffers,omitempty"`
+	Stalled   time.Duration `json:"stalled,omitempty"`
+	Startup   time.Duration `json:"startup,omitempty"`
+	// Page is set on a stylesheet, script, icon or image fetched for an
+	// HTML page (see Session.Assets), to the page's path, and PageLoad on
+	// the page's result, to how long after it was requested its last asset
+	// came: the time to the page being complete.
+	Page     string        `json:"page,omitempty"`
+	PageLoad time.Duration `json:"page_load,omitempty"`
+	// Delivery is set on a message a PUBLISH step published and subscribed
+	// to, to how long after it was published it was delivered; Lost is true
+	// for one never delivered in the step's Wait.
+	Delivery time.Duration `json:"delivery,omitempty"`
+	Lost     bool          `json:"lost,omitempty"`
+	// Rcode is the response code of a DNS step's query, like NOERROR or
+	// NXDOMAIN, that its Code stands for.
+	Rcode string `json:"rcode,omitempty"`
+	// Corrupt is true if the response body didn't match the step's
+	// Checksum, which its Error says more about; it's never a success.
+	Corrupt bool `json:"corrupt,omitempty"`
+	// Capture is the packet capture written of the connection of a failed
+	// request, if one was (see Captures)
+	Capture string `json:"capture,omitempty"`
+	// Monotonic is how long after the attack started the request was sent,
+	// by the monotonic clock, when it's recorded (see Clock)
+	Monotonic time.Duration `json:"monotonic,omitempty"`
+
+	// Metadata is only set on the first record of a result file, which
+	// isn't a result at all but describes the attack (see ReadMetadata)
+	Metadata *Metadata `json:"-"`
+	// Checkpoint is only set on the checkpoint records of a result file,
+	// which aren't results either (see Checkpoint)
+	Checkpoint *Checkpoint `json:"-"`
+
+	// saved are the values a step's saves captured from the response, by
+	// store then column (see Save); they're never written out
+	saved map[string]map[string]string
+	// size is the size of the whole object a RANGES step's response is
+	// part of, when it says (see RangesConfig); it's never written out
+	size uint64
+	// body is the start of the response body, for a PLAYBACK step's
+	// manifests and the HTML pages assets are fetched for; it's never
+	// written out
+	body []byte
+	// dump is the request and response, when the Attacker dumps them (see
+	// Dumps); it's never written out
+	dump string
+	// progress is the session's progress label when it sent the result,
+	// for logging the result from the goroutine recording it; it's never
+	// written out
+	progress string
+}
+
+// weight returns how many results the result stands for (see Weight)
+func (result *Result) weight() int {
+	if result.Weight > 1 {
+		return result.Weight
+	}
+	return 1
 }
 
 func (result *Result) HasErrorCode() bool {
 	return result.Code < 200 || result.Code >= 400
 }
 
+// NotModified returns true if the server told us our cached copy is current
+func (result *Result) NotModified() bool {
+	return result.Code == 304
+}
+
 var pathFromUrl = regexp.MustCompile("^\\w+://[^/]+(.*)$")
 
 func (result *Result) PathFromURL(url string) {
@@ -50,7 +162,7 @@ func Collect(in ...io.Reader) (<-chan *Result, <-chan error) {
 	for i := range in {
 		wg.Add(1)
 		go func(src io.Reader) {
-			dec := gob.NewDecoder(src)
+			dec := newResultDecoder(src)
 			for {
 				var r Result
 				if err := dec.Decode(&r); err != nil {
@@ -61,6 +173,9 @@ func Collect(in ...io.Reader) (<-chan *Result, <-chan error) {
 					errs <- err
 					continue
 				}
+				if r.Metadata != nil {
+					continue
+				}
 				resc <- &r
 			}
 		}(in[i])
@@ -81,3 +196,32 @@ type Results []*Result
 func (r Results) Len() int           { return len(r) }
 func (r Results) Less(i, j int) bool { return r[i].Timestamp.Before(r[j].Timestamp) }
 func (r Results) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// Count returns how many results there are, counting each downsampled
+// result as the results it stands for
+func (r Results) Count() int {
+	count := 0
+	for _, result := range r {
+		count += result.weight()
+	}
+	return count
+}
+
+// Slowest returns the n results with the highest latencies, slowest first;
+// of those with the same latency the earlier comes first
+func (r Results) Slowest(n int) Results {
+	if n > len(r) {
+		n = len(r)
+	}
+	if n <= 0 {
+		return nil
+	}
+	sorted := append(Results{}, r...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Latency != sorted[j].Latency {
+			return sorted[i].Latency > sorted[j].Latency
+		}
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+	return sorted[:n]
+}
@@ -0,0 +1,144 @@
+package korra
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron-like schedule of the minutes to start an attack
+type Schedule struct {
+	minute, hour, dom, month, dow []bool
+	anyDom, anyDow                bool
+}
+
+// scheduleField is the range of values for a field of a cron expression
+type scheduleField struct {
+	name     string
+	min, max int
+}
+
+var scheduleFields = []scheduleField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// ParseSchedule reads a standard five field cron expression:
+//
+//	minute hour day-of-month month day-of-week
+//
+// where each field is '*' or a comma-separated list of values and ranges
+// ('1-5'), any of which may have a step ('*/15', '0-30/10'). As with cron, if
+// both day fields are restricted a day matching either one is scheduled.
+func ParseSchedule(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(scheduleFields) {
+		return nil, fmt.Errorf("Expected %d fields in schedule '%s', got %d", len(scheduleFields), expr, len(fields))
+	}
+	matches := make([][]bool, len(fields))
+	for idx, field := range fields {
+		var err error
+		if matches[idx], err = parseScheduleField(field, scheduleFields[idx]); err != nil {
+			return nil, fmt.Errorf("Bad schedule '%s': %s", expr, err)
+		}
+	}
+	matches[4][0] = matches[4][0] || matches[4][7]
+	return &Schedule{
+		minute: matches[0],
+		hour:   matches[1],
+		dom:    matches[2],
+		month:  matches[3],
+		dow:    matches[4],
+		anyDom: fields[2] == "*",
+		anyDow: fields[4] == "*",
+	}, nil
+}
+
+func parseScheduleField(field string, spec scheduleField) ([]bool, error) {
+	matches := make([]bool, spec.max+1)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if pieces := strings.SplitN(part, "/", 2); len(pieces) == 2 {
+			var err error
+			if step, err = strconv.Atoi(pieces[1]); err != nil || step < 1 {
+				return nil, fmt.Errorf("Bad step for %s: %s", spec.name, part)
+			}
+			part = pieces[0]
+		}
+		low, high := spec.min, spec.max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("Bad value for %s: %s", spec.name, part)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("Bad range for %s: %s", spec.name, part)
+				}
+			} else if step > 1 {
+				high = spec.max // '5/15' means from 5 on, every 15
+			}
+		}
+		if low < spec.min || high > spec.max || low > high {
+			return nil, fmt.Errorf("Out of range for %s (%d-%d): %s", spec.name, spec.min, spec.max, part)
+		}
+		for value := low; value <= high; value += step {
+			matches[value] = true
+		}
+	}
+	return matches, nil
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first scheduled minute after the given time, or the zero
+// time if nothing matches within the next five years (say, February 30th)
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !s.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		} else if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		} else if !s.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		} else if !s.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+		} else {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ParseStartAt reads the time to start an attack, either as a full RFC 3339
+// timestamp or as a local clock time ('15:04' or '15:04:05'), which means
+// its next occurrence after now.
+func ParseStartAt(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if clock, err := time.Parse(layout, value); err == nil {
+			t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, now.Location())
+			if !t.After(now) {
+				t = t.AddDate(0, 0, 1)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Expected start time as RFC 3339 (2006-01-02T15:04:05Z07:00) or a clock time (15:04), got '%s'", value)
+}
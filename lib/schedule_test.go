@@ -0,0 +1,61 @@
+package korra
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	after := time.Date(2015, 2, 17, 15, 44, 9, 0, time.UTC) // a Tuesday
+	for expr, want := range map[string]string{
+		"* * * * *":        "2015-02-17T15:45:00Z",
+		"*/20 * * * *":     "2015-02-17T16:00:00Z",
+		"30 2 * * *":       "2015-02-18T02:30:00Z",
+		"0 9 * * 1-5":      "2015-02-18T09:00:00Z",
+		"0 9 * * 0":        "2015-02-22T09:00:00Z",
+		"0 9 * * 7":        "2015-02-22T09:00:00Z",
+		"0 0 1 3 *":        "2015-03-01T00:00:00Z",
+		"0 0 1,20 * 6":     "2015-02-20T00:00:00Z",
+		"5,50 15-16 * * *": "2015-02-17T15:50:00Z",
+	} {
+		sched, err := ParseSchedule(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sched.Next(after).Format(time.RFC3339); got != want {
+			t.Fatalf("Schedule '%s'; expected %s, got %s", expr, want, got)
+		}
+	}
+	sched, _ := ParseSchedule("0 0 30 2 *")
+	if next := sched.Next(after); !next.IsZero() {
+		t.Fatalf("Expected February 30th to never come around, got %s", next)
+	}
+}
+
+func TestParseScheduleBad(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Fatalf("Expected error parsing '%s'", expr)
+		}
+	}
+}
+
+func TestParseStartAt(t *testing.T) {
+	now := time.Date(2015, 2, 17, 15, 44, 9, 0, time.UTC)
+	for value, want := range map[string]string{
+		"16:00":                "2015-02-17T16:00:00Z",
+		"15:00":                "2015-02-18T15:00:00Z",
+		"2015-03-01T08:00:00Z": "2015-03-01T08:00:00Z",
+	} {
+		start, err := ParseStartAt(value, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := start.Format(time.RFC3339); got != want {
+			t.Fatalf("Start at '%s'; expected %s, got %s", value, want, got)
+		}
+	}
+	if _, err := ParseStartAt("soon", now); err == nil {
+		t.Fatal("Expected error parsing 'soon'")
+	}
+}
@@ -0,0 +1,386 @@
+package korra
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ScrapesFile is the name of the file the target's metrics scraped during
+// an attack are written to, in the directory of its sessions, next to their
+// results
+const ScrapesFile = "scrapes.jsonl"
+
+// ScrapesPath returns the path the metrics scraped for the sessions in the
+// directory are written to
+func ScrapesPath(dir string) string {
+	return path.Join(dir, ScrapesFile)
+}
+
+// ScrapeSample is the value of one of the target's series, as its Prometheus
+// endpoint gave it at the time
+type ScrapeSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Series    string    `json:"series"` // the metric's name and labels, like queue_depth{queue="orders"}
+	Value     float64   `json:"value"`
+	Counter   bool      `json:"counter,omitempty"` // only ever goes up, so it's reported as a rate
+}
+
+// ParseExposition reads the series in Prometheus' text exposition format
+// that are wanted: each wanted is a metric's name, for every series of it,
+// or a series exactly as the endpoint writes it, labels and all. Series
+// without a number, like NaN, are left out.
+func ParseExposition(in io.Reader, wanted []string, at time.Time) ([]ScrapeSample, error) {
+	var (
+		samples  []ScrapeSample
+		counters = map[string]bool{}
+		scanner  = bufio.NewScanner(in)
+	)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "# TYPE ") {
+			if fields := strings.Fields(line); len(fields) == 4 && fields[3] == "counter" {
+				counters[fields[2]] = true
+			}
+			continue
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		series, rest, err := splitSeries(line)
+		if err != nil {
+			return nil, err
+		}
+		name := series
+		if idx := strings.IndexByte(series, '{'); idx >= 0 {
+			name = series[:idx]
+		}
+		if !wants(wanted, name, series) {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("no value for %s", series)
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad value for %s: %s", series, fields[0])
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		samples = append(samples, ScrapeSample{Timestamp: at, Series: series, Value: value,
+			Counter: counters[name] || strings.HasSuffix(name, "_total")})
+	}
+	return samples, scanner.Err()
+}
+
+// splitSeries splits an exposition line into its series and the rest: the
+// value, and maybe a timestamp. Label values may have spaces and braces.
+func splitSeries(line string) (string, string, error) {
+	open := strings.IndexAny(line, "{ \t")
+	if open < 0 {
+		return "", "", fmt.Errorf("bad exposition line: %s", line)
+	}
+	if line[open] != '{' {
+		return line[:open], line[open:], nil
+	}
+	quoted := false
+	for i := open + 1; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && quoted:
+			i++
+		case line[i] == '"':
+			quoted = !quoted
+		case line[i] == '}' && !quoted:
+			return line[:i+1], line[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("bad exposition line: %s", line)
+}
+
+// wants returns true if the metric's name, or the series itself, is wanted
+func wants(wanted []string, name, series string) bool {
+	for _, w := range wanted {
+		if w == name || w == series {
+			return true
+		}
+	}
+	return false
+}
+
+// Scraper scrapes the target's Prometheus endpoint every so often while an
+// attack runs, writing the series wanted of each scrape as JSON lines.
+type Scraper struct {
+	URL    string
+	Series []string // the metric names, or exact series, wanted
+	Every  time.Duration
+
+	client http.Client
+	mu     sync.Mutex
+	file   io.WriteCloser
+	enc    *json.Encoder
+}
+
+// NewScraper starts the scrapes for the sessions in the directory, replacing
+// any an earlier attack left, like their results are; the endpoint is
+// connected to with the TLS config, if it's https.
+func NewScraper(dir, url string, series []string, every time.Duration, tlsc *tls.Config) (*Scraper, error) {
+	if every <= 0 {
+		return nil, fmt.Errorf("bad scrape interval: %s", every)
+	}
+	if len(series) == 0 {
+		return nil, fmt.Errorf("no metrics to scrape from %s", url)
+	}
+	file, err := os.Create(ScrapesPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	return &Scraper{
+		URL:    url,
+		Series: series,
+		Every:  every,
+		client: http.Client{Timeout: every, Transport: &http.Transport{TLSClientConfig: tlsc}},
+		file:   file,
+		enc:    json.NewEncoder(file),
+	}, nil
+}
+
+// Scrape scrapes the endpoint once and writes what it wanted, returning the
+// number of samples
+func (s *Scraper) Scrape(now time.Time) (int, error) {
+	resp, err := s.client.Get(s.URL)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s answered %s", s.URL, resp.Status)
+	}
+	samples, err := ParseExposition(resp.Body, s.Series, now)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sample := range samples {
+		if err = s.enc.Encode(sample); err != nil {
+			return 0, err
+		}
+	}
+	return len(samples), nil
+}
+
+// Run scrapes until stopped, logging scrapes that fail, and those that find
+// none of the series wanted
+func (s *Scraper) Run(stop <-chan struct{}, log chan string) {
+	ticker := time.NewTicker(s.Every)
+	defer ticker.Stop()
+	for now := time.Now(); ; {
+		if count, err := s.Scrape(now); err != nil {
+			log <- fmt.Sprintf("Scrape of %s failed: %s", s.URL, err)
+		} else if count == 0 {
+			log <- fmt.Sprintf("Scrape of %s found none of %s", s.URL, strings.Join(s.Series, ", "))
+		}
+		select {
+		case <-stop:
+			return
+		case now = <-ticker.C:
+		}
+	}
+}
+
+func (s *Scraper) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// ReadScrapes reads the samples written by a Scraper, in time order; a last
+// line only partly written, by a scraper still writing, is left out.
+func ReadScrapes(in io.Reader) ([]ScrapeSample, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(data), "\n")
+	lines = lines[:len(lines)-1]
+	var samples []ScrapeSample
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var sample ScrapeSample
+		if err := json.Unmarshal([]byte(line), &sample); err != nil {
+			return nil, fmt.Errorf("bad sample on line %d: %s", i+1, err)
+		}
+		samples = append(samples, sample)
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Timestamp.Before(samples[j].Timestamp) })
+	return samples, nil
+}
+
+// ScrapeWindow is how the results of a window of the run did, next to what
+// the target's metrics said over it
+type ScrapeWindow struct {
+	Start   time.Time     `json:"start"`
+	Results int           `json:"results"`
+	Mean    time.Duration `json:"mean_latency"`
+	P95     time.Duration `json:"p95_latency"`
+	Success float64       `json:"success"`
+	// Values are the mean of each series' samples in the window, or for a
+	// counter its mean rate per second, by series; a series with no samples
+	// in the window has none.
+	Values map[string]float64 `json:"values"`
+}
+
+// TargetMetrics are the windows of a run with the metrics scraped from the
+// target over each, so capacity can be read off next to latency. Windows are
+// aligned to the clock, like a StatusTimeline's.
+type TargetMetrics struct {
+	Window  time.Duration  `json:"window"`
+	Series  []string       `json:"series"`          // every series scraped, sorted
+	Rates   []string       `json:"rates,omitempty"` // those of the series that are counters, given as rates
+	Windows []ScrapeWindow `json:"windows"`
+}
+
+// NewTargetMetrics puts the samples next to the results over windows of the
+// width, from the first result's to the last's; it's nil if there's no
+// width, or there are no results or samples.
+func NewTargetMetrics(r Results, samples []ScrapeSample, window time.Duration) *TargetMetrics {
+	if window <= 0 || len(r) == 0 || len(samples) == 0 {
+		return nil
+	}
+	first, last := r[0].Timestamp.Truncate(window), r[0].Timestamp.Truncate(window)
+	byWindow := map[time.Time]Results{}
+	for _, result := range r {
+		start := result.Timestamp.Truncate(window)
+		byWindow[start] = append(byWindow[start], result)
+		if start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+
+	// counters become rates between one sample and the next
+	type point struct {
+		at    time.Time
+		value float64
+	}
+	var (
+		points   = map[string][]point{}
+		previous = map[string]ScrapeSample{}
+		series   []string
+		rates    []string
+	)
+	for _, sample := range samples {
+		before, seen := previous[sample.Series]
+		previous[sample.Series] = sample
+		if !seen {
+			series = append(series, sample.Series)
+			if sample.Counter {
+				rates = append(rates, sample.Series)
+			}
+		}
+		value := sample.Value
+		if sample.Counter {
+			if !seen {
+				continue
+			}
+			elapsed := sample.Timestamp.Sub(before.Timestamp).Seconds()
+			if elapsed <= 0 {
+				continue
+			}
+			// a counter that went down was reset, and counted up from 0
+			if increase := sample.Value - before.Value; increase >= 0 {
+				value = increase / elapsed
+			} else {
+				value = sample.Value / elapsed
+			}
+		}
+		points[sample.Series] = append(points[sample.Series], point{sample.Timestamp, value})
+	}
+	sort.Strings(series)
+	sort.Strings(rates)
+
+	tm := &TargetMetrics{Window: window, Series: series, Rates: rates}
+	for start := first; !start.After(last); start = start.Add(window) {
+		w := ScrapeWindow{Start: start, Values: map[string]float64{}}
+		if results := byWindow[start]; len(results) > 0 {
+			m := NewMetrics(results)
+			w.Results, w.Mean, w.P95, w.Success = results.Count(), m.Latencies.Mean, m.Latencies.P95, m.Success
+		}
+		for _, name := range series {
+			sum, count := 0.0, 0
+			for _, p := range points[name] {
+				if !p.at.Before(start) && p.at.Before(start.Add(window)) {
+					sum += p.value
+					count++
+				}
+			}
+			if count > 0 {
+				w.Values[name] = sum / float64(count)
+			}
+		}
+		tm.Windows = append(tm.Windows, w)
+	}
+	return tm
+}
+
+// toText writes a row for each window, with its results' latency and
+// success next to each series' value, a counter's as rate(series)
+func (tm *TargetMetrics) toText(out io.Writer, c palette) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', tabwriter.StripEscape)
+	header := []string{"Window", "Results", "Mean", "95th", "Success"}
+	for _, name := range tm.Series {
+		if tm.rate(name) {
+			name = "rate(" + name + ")"
+		}
+		header = append(header, name)
+	}
+	for i := range header {
+		header[i] = c.label(header[i])
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, window := range tm.Windows {
+		row := []string{window.Start.Format("15:04:05"), strconv.Itoa(window.Results), "-", "-", "-"}
+		if window.Results > 0 {
+			row[2], row[3] = window.Mean.Round(time.Millisecond).String(), window.P95.Round(time.Millisecond).String()
+			row[4] = c.success(window.Success, fmt.Sprintf("%.2f%%", window.Success*100))
+		}
+		for _, name := range tm.Series {
+			if value, ok := window.Values[name]; ok {
+				row = append(row, strconv.FormatFloat(value, 'g', 4, 64))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// rate returns true if the series is a counter, given as a rate
+func (tm *TargetMetrics) rate(series string) bool {
+	for _, name := range tm.Rates {
+		if name == series {
+			return true
+		}
+	}
+	return false
+}
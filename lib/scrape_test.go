@@ -0,0 +1,184 @@
+package korra
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const exposition = `# HELP process_cpu_seconds_total Total user and system CPU time spent in seconds.
+# TYPE process_cpu_seconds_total counter
+process_cpu_seconds_total %d
+# HELP queue_depth Jobs waiting.
+# TYPE queue_depth gauge
+queue_depth{queue="orders"} %d
+queue_depth{queue="mail, {bulk}"} 3 1792079222000
+queue_depth{queue="idle"} NaN
+go_goroutines 12
+`
+
+func TestParseExposition(t *testing.T) {
+	at := time.Date(2026, 10, 15, 15, 47, 2, 0, time.UTC)
+	samples, err := ParseExposition(strings.NewReader(fmt.Sprintf(exposition, 20, 7)),
+		[]string{"process_cpu_seconds_total", "queue_depth"}, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ScrapeSample{
+		{at, "process_cpu_seconds_total", 20, true},
+		{at, `queue_depth{queue="orders"}`, 7, false},
+		{at, `queue_depth{queue="mail, {bulk}"}`, 3, false},
+	}
+	if len(samples) != len(want) {
+		t.Fatalf("want %d samples, got: %+v", len(want), samples)
+	}
+	for i, sample := range samples {
+		if sample != want[i] {
+			t.Errorf("want %+v, got %+v", want[i], sample)
+		}
+	}
+
+	samples, err = ParseExposition(strings.NewReader(fmt.Sprintf(exposition, 20, 7)), []string{`queue_depth{queue="orders"}`}, at)
+	if err != nil || len(samples) != 1 || samples[0].Value != 7 {
+		t.Fatalf("want only the series asked for, got: %+v %v", samples, err)
+	}
+	for _, bad := range []string{"queue_depth{queue=\"orders\" 7\n", "queue_depth seven\n", "queue_depth\n"} {
+		if _, err = ParseExposition(strings.NewReader(bad), []string{"queue_depth"}, at); err == nil {
+			t.Errorf("want an error for %q", bad)
+		}
+	}
+}
+
+func TestScraper(t *testing.T) {
+	var scrapes int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&scrapes, 1)
+		fmt.Fprintf(w, exposition, 10*n, n)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	scraper, err := NewScraper(dir, server.URL, []string{"process_cpu_seconds_total", `queue_depth{queue="orders"}`}, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if count, err := scraper.Scrape(start.Add(time.Duration(i) * time.Second)); err != nil || count != 2 {
+			t.Fatalf("want 2 samples, got %d: %v", count, err)
+		}
+	}
+	scraper.Close()
+
+	// a line still being written is left out
+	file, err := os.OpenFile(ScrapesPath(dir), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"timestamp":"2026-10-15T`)
+	file.Close()
+	in, err := os.Open(ScrapesPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	samples, err := ReadScrapes(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 4 || samples[2].Value != 20 || !samples[2].Counter || samples[3].Value != 2 {
+		t.Fatalf("want the samples as scraped, got: %+v", samples)
+	}
+
+	if _, err = NewScraper(dir, server.URL, nil, time.Second, nil); err == nil {
+		t.Error("want an error scraping no metrics")
+	}
+	failing := httptest.NewServer(http.NotFoundHandler())
+	defer failing.Close()
+	scraper, err = NewScraper(dir, failing.URL, []string{"queue_depth"}, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scraper.Close()
+	if _, err = scraper.Scrape(start); err == nil {
+		t.Error("want an error for an endpoint that isn't there")
+	}
+}
+
+func TestTargetMetrics(t *testing.T) {
+	start := time.Date(2026, 10, 15, 15, 47, 0, 0, time.UTC)
+	var r Results
+	for i := 0; i < 30; i++ {
+		result := &Result{Code: 200, Timestamp: start.Add(time.Duration(i) * time.Second), Latency: 10 * time.Millisecond}
+		if i >= 20 {
+			result.Code, result.Latency = 503, 90*time.Millisecond
+		}
+		r = append(r, result)
+	}
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	samples := []ScrapeSample{
+		{at(0), "cpu_seconds_total", 100, true},
+		{at(0), "queue_depth", 2, false},
+		{at(5), "cpu_seconds_total", 105, true},
+		{at(5), "queue_depth", 4, false},
+		{at(12), "cpu_seconds_total", 119, true},
+		{at(12), "queue_depth", 40, false},
+		// the target restarted, resetting its counter
+		{at(22), "cpu_seconds_total", 5, true},
+	}
+	if NewTargetMetrics(r, samples, 0) != nil || NewTargetMetrics(r, nil, 10*time.Second) != nil {
+		t.Fatal("want no target metrics without a window or samples")
+	}
+	tm := NewTargetMetrics(r, samples, 10*time.Second)
+	if len(tm.Windows) != 3 || strings.Join(tm.Series, ",") != "cpu_seconds_total,queue_depth" || strings.Join(tm.Rates, ",") != "cpu_seconds_total" {
+		t.Fatalf("want 3 windows of both series, got: %+v", tm)
+	}
+	for i, want := range []struct {
+		results int
+		success float64
+		values  map[string]float64
+	}{
+		{10, 1, map[string]float64{"cpu_seconds_total": 1, "queue_depth": 3}},
+		{10, 1, map[string]float64{"cpu_seconds_total": 2, "queue_depth": 40}},
+		{10, 0, map[string]float64{"cpu_seconds_total": 0.5}},
+	} {
+		w := tm.Windows[i]
+		if w.Results != want.results || w.Success != want.success || len(w.Values) != len(want.values) {
+			t.Errorf("window %d: want %+v, got %+v", i, want, w)
+		}
+		for name, value := range want.values {
+			if w.Values[name] != value {
+				t.Errorf("window %d: want %s %g, got %g", i, name, value, w.Values[name])
+			}
+		}
+	}
+	if tm.Windows[2].P95 != 90*time.Millisecond {
+		t.Errorf("want the last window's 95th at 90ms, got %s", tm.Windows[2].P95)
+	}
+
+	report, err := TextReporter{Scrapes: samples, SectionOptions: SectionOptions{ScrapeWindow: 10 * time.Second}}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"TARGET METRICS: 2 series over 10s windows", "rate(cpu_seconds_total)", "15:47:20  10       90ms  90ms  0.00%    0.5"} {
+		if !strings.Contains(string(report), want) {
+			t.Errorf("want %q in the report, got:\n%s", want, report)
+		}
+	}
+	data, err := JSONReporter{Scrapes: samples, SectionOptions: SectionOptions{ScrapeWindow: 10 * time.Second}}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		Target *TargetMetrics `json:"target_metrics"`
+	}
+	if err = json.Unmarshal(data, &parsed); err != nil || parsed.Target == nil || len(parsed.Target.Windows) != 3 {
+		t.Fatalf("want the target metrics in the JSON report, got: %s %v", data, err)
+	}
+}
@@ -0,0 +1,225 @@
+package korra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretsFeed is the name secrets are referenced by in scripts, as
+// ${secrets.name}, so no feed or store may have it
+const SecretsFeed = "secrets"
+
+// Redacted stands in for a secret's value wherever it would be logged or
+// recorded
+const Redacted = "[redacted]"
+
+// vaultTimeout is the time allowed to read a secret from Vault
+const vaultTimeout = 10 * time.Second
+
+// Secrets are credentials resolved when an attack starts, from environment
+// variables, files or Vault, so scripts and configs can reference them
+// without holding them. Every value resolved is redacted from what's logged
+// and recorded (see Redact).
+type Secrets struct {
+	sync.Mutex
+	values map[string]string // by name
+	known  []string          // every value resolved, longest first
+}
+
+func NewSecrets() *Secrets {
+	return &Secrets{values: map[string]string{}}
+}
+
+// Add resolves the source and names its value, for ${secrets.name}
+func (s *Secrets) Add(name, source string) error {
+	value, err := s.Resolve(source)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.values[name] = value
+	return nil
+}
+
+// Resolve returns the secret the source names, as one of:
+//
+//	env:NAME            the environment variable
+//	file:PATH           the file's contents, without a trailing newline
+//	vault:PATH#KEY      the key of the Vault secret at the path, like
+//	                    secret/data/shop#password, read from VAULT_ADDR
+//	                    with VAULT_TOKEN
+//
+// The value is remembered to be redacted, and it's an error for it to be
+// empty.
+func (s *Secrets) Resolve(source string) (string, error) {
+	kind, rest, ok := strings.Cut(source, ":")
+	if !ok || rest == "" {
+		return "", fmt.Errorf("secret %q isn't env:NAME, file:PATH or vault:PATH#KEY", source)
+	}
+	var (
+		value string
+		err   error
+	)
+	switch kind {
+	case "env":
+		value = os.Getenv(rest)
+	case "file":
+		var data []byte
+		if data, err = ioutil.ReadFile(rest); err != nil {
+			return "", err
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	case "vault":
+		if value, err = readVault(rest); err != nil {
+			return "", fmt.Errorf("vault %s: %s", rest, err)
+		}
+	default:
+		return "", fmt.Errorf("secret %q isn't env:NAME, file:PATH or vault:PATH#KEY", source)
+	}
+	if value == "" {
+		return "", fmt.Errorf("secret %s is empty", source)
+	}
+	s.remember(value)
+	return value, nil
+}
+
+// remember adds the value to those redacted, longest first so a secret
+// holding another is redacted whole
+func (s *Secrets) remember(value string) {
+	s.Lock()
+	defer s.Unlock()
+	for _, known := range s.known {
+		if known == value {
+			return
+		}
+	}
+	s.known = append(s.known, value)
+	sort.Slice(s.known, func(i, j int) bool { return len(s.known[i]) > len(s.known[j]) })
+}
+
+// Names returns the names of the secrets, sorted
+func (s *Secrets) Names() []string {
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Redact replaces every secret's value in the text with Redacted
+func (s *Secrets) Redact(text string) string {
+	if s == nil {
+		return text
+	}
+	s.Lock()
+	defer s.Unlock()
+	for _, value := range s.known {
+		text = strings.Replace(text, value, Redacted, -1)
+	}
+	return text
+}
+
+var secretRefRegexp = regexp.MustCompile(`\$\{` + SecretsFeed + `\.(\w+)\}`)
+
+// Expand fills in the ${secrets.name} references in the text, leaving
+// others as they are; it's an error to reference a secret there isn't
+func (s *Secrets) Expand(text string) (string, error) {
+	var missing string
+	expanded := secretRefRegexp.ReplaceAllStringFunc(text, func(ref string) string {
+		name := secretRefRegexp.FindStringSubmatch(ref)[1]
+		if s != nil {
+			s.Lock()
+			defer s.Unlock()
+			if value, ok := s.values[name]; ok {
+				return value
+			}
+		}
+		missing = name
+		return ref
+	})
+	if missing != "" {
+		return "", fmt.Errorf("no secret named %s", missing)
+	}
+	return expanded, nil
+}
+
+// references returns the secrets by the names they're referenced by
+func (s *Secrets) references() map[string]string {
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	refs := make(map[string]string, len(s.values))
+	for name, value := range s.values {
+		refs[SecretsFeed+"."+name] = value
+	}
+	return refs
+}
+
+// readVault reads the key of the secret at the path from Vault's HTTP API,
+// at VAULT_ADDR with VAULT_TOKEN (and VAULT_NAMESPACE, if set). Secrets of a
+// KV version 2 engine, nested a level deeper, are read too.
+func readVault(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("expected PATH#KEY")
+	}
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("set VAULT_ADDR and VAULT_TOKEN to read secrets from Vault")
+	}
+	req, err := http.NewRequest("GET", strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	client := &http.Client{Timeout: vaultTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", res.Status)
+	}
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	data := body.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, isKV1 := data[key]; !isKV1 {
+			data = nested
+		}
+	}
+	switch value := data[key].(type) {
+	case string:
+		return value, nil
+	case nil:
+		return "", fmt.Errorf("no key %s", key)
+	default:
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	}
+}
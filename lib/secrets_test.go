@@ -0,0 +1,83 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecrets(t *testing.T) {
+	t.Setenv("KORRA_TEST_TOKEN", "s3cr3t-token")
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/shop":
+			w.Write([]byte(`{"data": {"data": {"api_key": "kv2-key"}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/shop":
+			w.Write([]byte(`{"data": {"api_key": "kv1-key"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+
+	secrets := NewSecrets()
+	for name, source := range map[string]string{
+		"token":    "env:KORRA_TEST_TOKEN",
+		"password": "file:" + file,
+		"kv2":      "vault:secret/data/shop#api_key",
+		"kv1":      "vault:kv/shop#api_key",
+	} {
+		if err := secrets.Add(name, source); err != nil {
+			t.Fatalf("want %s resolved, got: %v", source, err)
+		}
+	}
+	refs := secrets.references()
+	if refs["secrets.token"] != "s3cr3t-token" || refs["secrets.password"] != "hunter2" ||
+		refs["secrets.kv2"] != "kv2-key" || refs["secrets.kv1"] != "kv1-key" {
+		t.Fatalf("want every secret resolved, got %v", refs)
+	}
+	if got := strings.Join(secrets.Names(), ","); got != "kv1,kv2,password,token" {
+		t.Fatalf("want the names sorted, got %s", got)
+	}
+
+	expanded, err := secrets.Expand("Authorization: Bearer ${secrets.token} for ${users.email}")
+	if err != nil || expanded != "Authorization: Bearer s3cr3t-token for ${users.email}" {
+		t.Fatalf("want the secret filled in and the feed left, got %q %v", expanded, err)
+	}
+	if _, err = secrets.Expand("${secrets.nope}"); err == nil {
+		t.Error("want an error for a secret there isn't")
+	}
+	if got := secrets.Redact("GET http://api/?key=kv2-key failed with s3cr3t-token"); got != "GET http://api/?key=[redacted] failed with [redacted]" {
+		t.Fatalf("want the secrets redacted, got %q", got)
+	}
+	if got := (*Secrets)(nil).Redact("nothing secret"); got != "nothing secret" {
+		t.Fatalf("want the text as it is without secrets, got %q", got)
+	}
+
+	for _, bad := range []string{
+		"KORRA_TEST_TOKEN",
+		"env:KORRA_TEST_UNSET",
+		"file:" + filepath.Join(t.TempDir(), "missing"),
+		"vault:secret/data/shop",
+		"vault:secret/data/shop#missing",
+		"vault:secret/data/other#api_key",
+		"keychain:token",
+	} {
+		if _, err := secrets.Resolve(bad); err == nil {
+			t.Errorf("want an error for %q", bad)
+		}
+	}
+}
@@ -1,31 +1,39 @@
 package korra
 
 import (
-	"encoding/gob"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 )
 
 type ResultEncoder struct {
 	Name        string
-	encoder     *gob.Encoder
+	encoder     *resultEncoder
 	encoderFile io.WriteCloser
 }
 
+// ResultEncoding is the encoding sessions record their result files in, to
+// read them with (see NewResultReader)
+const ResultEncoding = "gob"
+
+// ResultPath returns the path a session script's results are recorded to,
+// next to it
+func ResultPath(scriptPath string) string {
+	return path.Join(path.Dir(scriptPath), strings.Replace(path.Base(scriptPath), ".txt", ".bin", -1))
+}
+
 // name should be the script path
 func NewResultEncoder(scriptPath string) *ResultEncoder {
-	encoderDir := path.Dir(scriptPath)
-	encoderName := strings.Replace(path.Base(scriptPath), ".txt", ".bin", -1)
-	encoderFullPath := path.Join(encoderDir, encoderName)
+	encoderFullPath := ResultPath(scriptPath)
+	encoderName := path.Base(encoderFullPath)
 	if encoderFile, err := os.Create(encoderFullPath); err != nil {
 		panic(fmt.Sprintf("Cannot create encoder for results [Path: %s] [session file: %s] => %s", encoderFullPath, scriptPath, err))
 	} else {
-		encoder := gob.NewEncoder(encoderFile)
-		return &ResultEncoder{encoderName, encoder, encoderFile}
+		return &ResultEncoder{encoderName, newResultEncoder(encoderFile), encoderFile}
 	}
 }
 
@@ -33,20 +41,60 @@ func (e *ResultEncoder) AddResult(r *Result) error {
 	return e.encoder.Encode(r)
 }
 
-func (e *ResultEncoder) Close() {
-	e.encoderFile.Close()
+// AddMetadata writes the record describing the attack, which goes first
+func (e *ResultEncoder) AddMetadata(m *Metadata) error {
+	return e.encoder.Encode(&Result{Metadata: m})
+}
+
+// Close writes the final checkpoint and closes the file
+func (e *ResultEncoder) Close() error {
+	if err := e.encoder.finish(); err != nil {
+		e.encoderFile.Close()
+		return err
+	}
+	return e.encoderFile.Close()
 }
 
 type Session struct {
-	Name     string
-	Path     string
-	Pretend  bool
-	Script   *SessionScript
+	Name      string
+	Path      string
+	Pretend   bool
+	LogOnly   bool // log every result instead of recording them for reports
+	Feeders   Feeders
+	Vars      *Vars      // shared by every session of the attack
+	Secrets   *Secrets   // likewise, and redacted from its results
+	Barriers  *Barriers  // likewise
+	Sitemaps  *Sitemaps  // likewise, for CRAWL steps
+	Databases *Databases // likewise, for SQL steps
+	Gate      *Gate      // pauses the session between steps while closed
+	Metadata  *Metadata  // written at the start of the result file
+	Script    *SessionScript
+
+	Abandonment Abandonment    // how soon the user gives up
+	Assets      int            // assets of HTML pages to fetch at once, 0 for none (see fetchAssets)
+	EveryChance bool           // take every CHANCE block, as a smoke test does, to run every step
+	Annotations *AnnotationLog // shared by every session of the attack, marked by its SSH steps
+	CPUs        CPUSet         // to pin the session's requests to, if any (see CheckPinning)
+	Clock       *Clock         // shared by every session of the attack, to timestamp results by
+
+	aborted  chan struct{}
+	abort    sync.Once
 	attacker *Attacker
+	began    time.Time // when the session started processing its script
+	chance   *Chance   // the CHANCE block being run, if any
+	done     chan struct{}
+	failed   bool // whether any result of the current action failed
+	failures int
+	gated    time.Duration // the time the gate had been paused for when the session started
+	gaveUp   string        // why the user abandoned the session, if they did (see AbandonKinds)
+	hook     string        // of the current action
 	logChan  chan string
 	results  chan *Result
+	rolled   bool // whether the chance of abandoning the current action was rolled
 	running  bool
+	spent    chan struct{} // closed once the session's run past its budget
 	stopper  chan struct{}
+	values   map[string]string // values from the feed rows claimed so far
 	verbose  bool
 }
 
@@ -64,10 +112,12 @@ func NewSession(scriptPath string, opts []func(*Attacker), logChan chan string,
 		Name:     name,
 		Path:     scriptPath,
 		Script:   script,
+		aborted:  make(chan struct{}),
 		attacker: NewAttacker(opts...),
 		logChan:  logChan,
 		results:  make(chan *Result),
 		stopper:  make(chan struct{}),
+		done:     make(chan struct{}),
 		verbose:  verboseLogging,
 	}
 	session.debug("CREATED")
@@ -85,7 +135,15 @@ func (session *Session) debug(msg string) {
 // name and the current progress
 func (session *Session) log(msg string) {
 	if session.logChan != nil {
-		session.logChan <- fmt.Sprintf("%s %s: %s", session.Name, session.Script.ProgressLabel(), msg)
+		session.logAt(session.Script.ProgressLabel(), msg)
+	}
+}
+
+// logAt is log with the progress given, for logging from another goroutine
+// than the one processing the script, which moves the progress along
+func (session *Session) logAt(progress, msg string) {
+	if session.logChan != nil {
+		session.logChan <- fmt.Sprintf("%s %s: %s", session.Name, progress, msg)
 	}
 }
 
@@ -93,54 +151,211 @@ func (session *Session) Progress() SessionProgress {
 	return session.Script.Progress()
 }
 
+// Failures returns the number of results with an error the session has seen
+func (session *Session) Failures() int {
+	return session.failures
+}
+
 func (session *Session) Run(log chan string) {
 	session.running = true
-	enc := NewResultEncoder(session.Path)
+	var enc *ResultEncoder
+	if !session.LogOnly {
+		enc = NewResultEncoder(session.Path)
+		if session.Metadata != nil {
+			enc.AddMetadata(session.Metadata.forSession(session.Name))
+		}
+	}
+	record := func(result *Result) {
+		if result.Error != "" {
+			session.failures += 1
+		}
+		if session.LogOnly {
+			session.logAt(result.progress, fmt.Sprintf("%d => %s %s, %d ms %s",
+				result.Code, result.Method, result.Path, int64(result.Latency/time.Millisecond), result.Error))
+		} else {
+			enc.AddResult(result)
+		}
+		if result.Error != "" && result.dump != "" {
+			session.logAt(result.progress, fmt.Sprintf("Request and response of the failure:\n%s", strings.TrimRight(result.dump, "\r\n")))
+		}
+	}
 	go session.process(log)
 	for {
 		select {
 		case result := <-session.results:
-			enc.AddResult(result)
+			record(result)
 
-		// wait for the next result (or timeout) then wrap up:
+		// every result is in by the time processing is done, so wrap up:
 		case <-session.stopper:
+			for len(session.results) > 0 {
+				record(<-session.results)
+			}
 			session.running = false
-			session.debug("All done or asked to stop, waiting for next result or 5 seconds...")
-			if !session.Pretend {
-				select {
-				case result := <-session.results:
-					enc.AddResult(result)
-				case <-time.After(5 * time.Second):
+			session.debug("All done or asked to stop")
+			if enc != nil {
+				if err := enc.Close(); err != nil {
+					session.log(fmt.Sprintf("Results not finished: %s", err))
 				}
 			}
-			enc.Close()
 			session.debug("DONE")
+			if session.done != nil {
+				close(session.done)
+			}
 			return
 		}
 	}
 }
 
+// Done is closed once the session has run and its result file is closed
+func (session *Session) Done() <-chan struct{} {
+	return session.done
+}
+
+// BufferResults lets the session have up to n results waiting to be
+// recorded before a step waits on them; call it before Run.
+func (session *Session) BufferResults(n int) {
+	session.results = make(chan *Result, n)
+}
+
+// Stop aborts the session: it skips whatever it has left to do except for
+// its ON_END hooks, and finishes once those are done.
 func (session *Session) Stop() {
-	if session.running {
-		session.stopper <- struct{}{}
+	session.abort.Do(func() { close(session.aborted) })
+}
+
+func (session *Session) isAborted() bool {
+	select {
+	case <-session.aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// send passes the result along to be recorded, noting if it failed
+func (session *Session) send(result *Result) {
+	if result.Error != "" {
+		session.failed = true
+		result.Error = session.Secrets.Redact(result.Error)
+	}
+	result.Path = session.Secrets.Redact(result.Path)
+	session.Clock.stamp(result)
+	session.abandon(result)
+	if session.LogOnly || result.dump != "" {
+		result.progress = session.Script.ProgressLabel()
 	}
+	session.results <- result
 }
 
 func (session *Session) process(log chan string) {
+	session.pin()
+	session.began, session.gated = time.Now(), session.Gate.pausedFor()
+	var budgeted chan struct{} // closed to stop watching the budget
 	for session.Script.ActionsRemain() {
+		session.Gate.wait(session.aborted)
+		if session.isAborted() {
+			session.Script.SkipToEnd()
+			if !session.Script.ActionsRemain() {
+				break
+			}
+		}
 		action := session.Script.NextAction()
-		target := action.Target
-		if target.IsComment() {
-			session.log(target.Comment)
-		} else if target.IsPause() {
-			session.pause(target.PauseTime)
-		} else {
-			session.doHttp(action)
+		if action.Hook == "" && budgeted == nil && session.Abandonment.Budget > 0 {
+			budgeted, session.spent = make(chan struct{}), make(chan struct{})
+			go session.watchBudget(budgeted)
+		} else if action.Hook == HookEnd && budgeted != nil {
+			close(budgeted)
+			budgeted = nil
+		}
+		if chance := action.Chance; chance != nil && chance != session.chance {
+			if !session.EveryChance && !chance.taken(session.attacker.random) {
+				session.debug(fmt.Sprintf("Skipping the %s block on line %d", chance, chance.Line))
+				session.Script.SkipChance(chance)
+				continue
+			}
+			session.chance = chance
+		}
+		session.step(action)
+		if action.Hook == HookStart && session.failed && !session.isAborted() {
+			session.log(fmt.Sprintf("%s step on line %d failed, skipping to %s steps", HookStart, action.Line, HookEnd))
+			session.Stop()
 		}
+		// running past the budget stops the session, so it's abandoned
+		// even if this step didn't get as far as a result
+		overBudget := action.Hook == "" && session.overBudget()
+		if overBudget && session.gaveUp == "" {
+			session.gaveUp = AbandonTimeout
+		}
+		if session.gaveUp != "" && (!session.isAborted() || overBudget) {
+			session.log(fmt.Sprintf("Abandoned (%s) on the step on line %d, skipping to %s steps", session.gaveUp, action.Line, HookEnd))
+			session.Stop()
+		}
+	}
+	if budgeted != nil {
+		close(budgeted)
 	}
 	session.stopper <- struct{}{}
 }
 
+// step carries out the action, sending along its results
+func (session *Session) step(action *SessionAction) {
+	target := action.Target
+	session.failed = false
+	session.hook, session.rolled = action.Hook, false
+	// stopping cuts short a wait on the limits, but not for the
+	// ON_END steps that run once the session's stopped
+	if action.Hook == HookEnd {
+		session.attacker.abort = nil
+	} else {
+		session.attacker.abort = session.aborted
+	}
+	switch {
+	case target.IsComment():
+		session.log(target.Comment)
+	case target.IsPause():
+		session.pause(target.PauseTime)
+	case target.IsConnections():
+		session.debug(fmt.Sprintf("Using %s connections", target.Connections))
+		session.attacker.FreshConnections(target.Connections == ConnectionsFresh)
+	case target.IsFeed():
+		session.feed(target.Feed)
+	case target.IsVar():
+		session.doVar(target.Var)
+	case target.IsBarrier():
+		session.doBarrier(target.Barrier)
+	case target.IsStream():
+		session.doStream(action)
+	case target.IsLongPoll():
+		session.doLongPoll(action)
+	case target.IsRanges():
+		session.doRanges(action)
+	case target.IsPlayback():
+		session.doPlayback(action)
+	case target.IsCrawl():
+		session.doCrawl(action)
+	case target.IsKV():
+		session.doKV(action)
+	case target.IsSQL():
+		session.doSQL(action)
+	case target.IsPublish():
+		session.doPublish(action)
+	case target.IsSMTP():
+		session.doSMTP(action)
+	case target.IsIMAP():
+		session.doIMAP(action)
+	case target.IsDNS():
+		session.doDNS(action)
+	case target.IsLDAP():
+		session.doLDAP(action)
+	case target.IsFTP():
+		session.doFTP(action)
+	case target.IsSSH():
+		session.doSSH(action)
+	default:
+		session.doHttp(action)
+	}
+}
+
 func (session *Session) pause(pauseMillis int) {
 	if session.Pretend {
 		session.log(fmt.Sprintf("Sleeping (pretend) (%d ms)...", pauseMillis))
@@ -148,30 +363,168 @@ func (session *Session) pause(pauseMillis int) {
 	}
 	session.debug(fmt.Sprintf("Sleeping (%d ms)...", pauseMillis))
 	select {
-	case <-session.stopper:
+	case <-session.aborted:
 		return
 	case <-time.After(time.Duration(pauseMillis) * time.Millisecond):
 	}
 }
 
+// feed claims the next row from the feeder, keeping its values for the
+// steps that follow; if the feeder's out of rows the session stops.
+func (session *Session) feed(name string) {
+	feeder := session.Feeders[name]
+	if feeder == nil {
+		session.log(fmt.Sprintf("No feed named %s, stopping", name))
+		session.Stop()
+		return
+	}
+	values, err := feeder.Next()
+	if err != nil {
+		session.log(fmt.Sprintf("Feed %s: %s, stopping", name, err))
+		if feeder.Policy == FeedFail && !session.Pretend {
+			session.send(&Result{Timestamp: time.Now(), Method: "FEED", Path: name, Error: err.Error()})
+		}
+		session.Stop()
+		return
+	}
+	if session.values == nil {
+		session.values = map[string]string{}
+	}
+	for key, value := range values {
+		session.values[key] = value
+	}
+	session.debug(fmt.Sprintf("Claimed a row from feed %s, %d left", name, feeder.Remaining()))
+}
+
+// save adds the values the result's saves captured to their stores
+func (session *Session) save(result *Result) {
+	for store, values := range result.saved {
+		if store == VarsFeed && session.Vars != nil {
+			for name, value := range values {
+				session.Vars.Set(name, value)
+			}
+		} else if feeder := session.Feeders[store]; feeder != nil && feeder.IsStore() {
+			feeder.Add(values)
+		}
+	}
+}
+
+// references returns the values references in the session's steps are
+// filled in with: the vars and secrets, then the values of claimed feed rows
+func (session *Session) references() map[string]string {
+	refs := session.Vars.references()
+	for key, value := range session.Secrets.references() {
+		if refs == nil {
+			refs = map[string]string{}
+		}
+		refs[key] = value
+	}
+	if len(refs) == 0 {
+		return session.values
+	}
+	for key, value := range session.values {
+		refs[key] = value
+	}
+	return refs
+}
+
+// doVar carries out the operation on the shared vars
+func (session *Session) doVar(step *VarStep) {
+	if session.Vars == nil {
+		session.log(fmt.Sprintf("No vars for %s", step))
+		return
+	}
+	switch step.Op {
+	case VarSet:
+		session.Vars.Set(step.Name, expandFeeds(step.Value, session.references()))
+	case VarSetNX:
+		if !session.Vars.SetNX(step.Name, expandFeeds(step.Value, session.references())) {
+			session.debug(fmt.Sprintf("Var %s already set", step.Name))
+		}
+	case VarIncr:
+		value, err := session.Vars.Incr(step.Name, step.Delta)
+		if err != nil {
+			session.log(fmt.Sprintf("Cannot %s: %s", step, err))
+			return
+		}
+		session.debug(fmt.Sprintf("Var %s is now %d", step.Name, value))
+	case VarAwait:
+		if session.Pretend {
+			session.log(fmt.Sprintf("Awaiting (pretend) var %s", step.Name))
+			return
+		}
+		session.debug(fmt.Sprintf("Awaiting var %s...", step.Name))
+		session.Vars.Await(step.Name, session.aborted)
+	}
+}
+
+// doBarrier waits at the barrier for the other sessions
+func (session *Session) doBarrier(step *BarrierStep) {
+	if session.Pretend {
+		session.log(fmt.Sprintf("Waiting (pretend) at barrier %s for %d sessions", step.Name, step.Parties))
+		return
+	}
+	if session.Barriers == nil {
+		session.log(fmt.Sprintf("No barriers for %s", step))
+		return
+	}
+	session.debug(fmt.Sprintf("Waiting at barrier %s for %d sessions...", step.Name, step.Parties))
+	if arrived, all := session.Barriers.Wait(step, session.aborted); !all && !session.isAborted() {
+		session.log(fmt.Sprintf("Barrier %s: %d of %d sessions arrived in %s, going on", step.Name, arrived, step.Parties, step.Timeout))
+	}
+}
+
+// bind substitutes the values from claimed feed rows and vars into the
+// target; if that fails the error is sent as the target's result.
+func (session *Session) bind(target *Target) (*Target, bool) {
+	bound, err := target.bind(session.references())
+	if err != nil && session.Pretend {
+		session.log(fmt.Sprintf("Cannot fill in feed values for %s: %s", target, err))
+		return nil, false
+	} else if err != nil {
+		result := &Result{Timestamp: time.Now(), Method: target.Method, Error: err.Error()}
+		result.PathFromURL(target.URL)
+		session.send(result)
+		return nil, false
+	}
+	return bound, true
+}
+
 func (session *Session) doHttp(action *SessionAction) {
-	target := action.Target
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
 	if session.Pretend {
 		session.log(fmt.Sprintf("%d (pretend) => %s %s, %d ms",
 			200, target.Method, target.URL, 0))
 		return
 	}
+	if session.Assets > 0 {
+		page := *target
+		page.assets = true
+		target = &page
+	}
 	targeter := func() (*Target, error) { return target, nil }
 
 	// retry a request if we're supposed to poll
 	requests := 1
 	for {
+		session.Gate.wait(session.aborted)
 		timestamp := time.Now()
 		result := session.attacker.Hit(targeter, timestamp, requests)
+		if result.Error == ErrLimitAborted.Error() {
+			return
+		}
 		session.debug(fmt.Sprintf("%d => %s %s, %d ms",
 			result.Code, result.Method, result.Path, int64(result.Latency/time.Millisecond)))
-		session.results <- result
-		if target.Poller.ShouldRetry(requests, int(result.Code)) {
+		session.save(result)
+		retry := target.Poller.ShouldRetry(requests, int(result.Code))
+		if result.body != nil && !retry && result.Error == "" && !result.HasErrorCode() {
+			session.fetchAssets(target, result)
+		}
+		session.send(result)
+		if retry {
 			pauseMillis := target.Poller.WaitBetweenPolls
 			session.debug(fmt.Sprintf("Attempt %d requires retry, %d ms pause until next poll", requests, pauseMillis))
 			time.Sleep(time.Duration(pauseMillis) * time.Millisecond)
@@ -182,6 +535,60 @@ func (session *Session) doHttp(action *SessionAction) {
 	}
 }
 
+func (session *Session) doStream(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => STREAM %s %s %s",
+			200, target.Method, target.URL, target.Stream))
+		return
+	}
+	session.attacker.Stream(target, time.Now(), func(result *Result) {
+		session.debug(fmt.Sprintf("%d => STREAM %s %s, event %d, %d ms",
+			result.Code, result.Method, result.Path, result.Event, int64(result.Latency/time.Millisecond)))
+		session.send(result)
+	})
+}
+
+// doLongPoll re-requests the target as soon as each response comes back,
+// backing off before reconnecting if a request fails; every cycle is a
+// separate result, with its cycle number as the request count.
+func (session *Session) doLongPoll(action *SessionAction) {
+	target, ok := session.bind(action.Target)
+	if !ok {
+		return
+	}
+	config := target.LongPoll
+	if session.Pretend {
+		session.log(fmt.Sprintf("%d (pretend) => LONGPOLL %s %s %s",
+			200, target.Method, target.URL, config))
+		return
+	}
+	cycle := config.Cycle(target)
+	targeter := func() (*Target, error) { return cycle, nil }
+	for requests := 1; requests <= config.Cycles; requests++ {
+		session.Gate.wait(session.aborted)
+		result := session.attacker.Hit(targeter, time.Now(), requests)
+		if result.Error == ErrLimitAborted.Error() {
+			return
+		}
+		if config.idle(target, result) {
+			session.debug(fmt.Sprintf("LONGPOLL %s %s, cycle %d/%d held for all %d ms",
+				result.Method, result.Path, requests, config.Cycles, config.Hold))
+		} else {
+			session.debug(fmt.Sprintf("%d => LONGPOLL %s %s, cycle %d/%d, %d ms",
+				result.Code, result.Method, result.Path, requests, config.Cycles, int64(result.Latency/time.Millisecond)))
+		}
+		session.send(result)
+		if result.Error != "" && TimeoutKind(result.Error) != "total" && requests < config.Cycles {
+			session.debug(fmt.Sprintf("Cycle %d failed, %d ms pause until reconnect", requests, config.Backoff))
+			time.Sleep(time.Duration(config.Backoff) * time.Millisecond)
+		}
+	}
+}
+
 func retryable(code uint16) bool {
 	return code == 502 || code == 503 || code == 504
 }
@@ -20,8 +20,27 @@ type SessionProgress struct {
 }
 
 type SessionScript struct {
-	Actions []*SessionAction
-	Current int
+	Actions  []*SessionAction
+	Current  int
+	endHooks int // the trailing actions that are ON_END hooks
+}
+
+// newSessionScript orders the actions so the ON_START hooks run first and
+// the ON_END hooks last, with everything else between in script order
+func newSessionScript(actions []*SessionAction) *SessionScript {
+	var start, main, end []*SessionAction
+	for _, action := range actions {
+		switch action.Hook {
+		case HookStart:
+			start = append(start, action)
+		case HookEnd:
+			end = append(end, action)
+		default:
+			main = append(main, action)
+		}
+	}
+	ordered := append(append(start, main...), end...)
+	return &SessionScript{Actions: ordered, Current: 0, endHooks: len(end)}
 }
 
 func (script *SessionScript) ActionCount() int {
@@ -41,12 +60,52 @@ func (script *SessionScript) IsValid() bool {
 	return true
 }
 
+// Feeds returns the names of the feeders the script claims rows from
+func (script *SessionScript) Feeds() []string {
+	var feeds []string
+	seen := map[string]bool{}
+	for _, action := range script.Actions {
+		if tgt := action.Target; tgt != nil && tgt.IsFeed() && !seen[tgt.Feed] {
+			seen[tgt.Feed] = true
+			feeds = append(feeds, tgt.Feed)
+		}
+	}
+	return feeds
+}
+
+// Stores returns the names of the stores the script saves values into, not
+// counting saves into vars
+func (script *SessionScript) Stores() []string {
+	var stores []string
+	seen := map[string]bool{}
+	for _, action := range script.Actions {
+		if action.Target == nil {
+			continue
+		}
+		for _, save := range action.Target.Saves {
+			if save.Store != VarsFeed && !seen[save.Store] {
+				seen[save.Store] = true
+				stores = append(stores, save.Store)
+			}
+		}
+	}
+	return stores
+}
+
 func (script *SessionScript) NextAction() *SessionAction {
 	action := script.Actions[script.Current]
 	script.Current += 1
 	return action
 }
 
+// SkipToEnd moves past any remaining ON_START hooks and main actions so the
+// next action is the first ON_END hook, unless we're already running them.
+func (script *SessionScript) SkipToEnd() {
+	if end := len(script.Actions) - script.endHooks; script.Current < end {
+		script.Current = end
+	}
+}
+
 func (script *SessionScript) Progress() SessionProgress {
 	return SessionProgress{
 		Actions:    script.ActionCount(),
@@ -86,7 +145,7 @@ func NewScript(scriptPath string) (*SessionScript, error) {
 		}
 		validActions = append(validActions, action)
 	}
-	return &SessionScript{Actions: validActions, Current: 0}, nil
+	return newSessionScript(validActions), nil
 }
 
 // CheckScript creates a new script of SessionAction objects from
@@ -107,7 +166,7 @@ func CheckScript(scriptPath string) (*SessionScript, error) {
 		for _, action := range actions {
 			action.CreateTarget(scriptDir)
 		}
-		return &SessionScript{Actions: actions, Current: 0}, nil
+		return newSessionScript(actions), nil
 	}
 }
 
@@ -133,12 +192,14 @@ var (
 	// TODO support additional methods via config? environment variable with added?
 	supportedMethods = []string{"HEAD", "GET", "PUT", "POST", "PATCH", "OPTIONS"}
 	httpMethod       = regexp.MustCompile(fmt.Sprintf("^(%s)$", strings.Join(supportedMethods, "|")))
-	httpMethodLine   = regexp.MustCompile(fmt.Sprintf("^(POLL )?(%s)", strings.Join(supportedMethods, "|")))
+	httpMethodLine   = regexp.MustCompile(fmt.Sprintf("^(POLL |STREAM |LONGPOLL |RANGES |PLAYBACK |CRAWL )?(%s)", strings.Join(supportedMethods, "|")))
 )
 
 type SessionAction struct {
 	Raw    string
 	Line   int
+	Hook   string  // HookStart or HookEnd if the action is in one of those blocks
+	Chance *Chance // the CHANCE block the action is in, if any
 	Error  error
 	Target *Target
 }
@@ -148,6 +209,43 @@ func (action *SessionAction) BadLine(offset int, message string) error {
 	return action.Error
 }
 
+// stepLines are the lines after its first that any step other than SSH may
+// have, for the error when one isn't any of them
+const stepLines = "[params], <limits> or {timeouts}"
+
+// fillStepLine fills the target from a line after the step's first if it's
+// one of the step's [params], which fill parses and which are called params
+// in errors, its <limits> or its {timeouts}. A step that sends a body may
+// also have an @body line, which is called body in errors. It returns false
+// for any other line, for the step to handle itself.
+func (action *SessionAction) fillStepLine(tgt *Target, scriptDir string, idx int, line, params string, fill func(string) error, body string) (bool, error) {
+	switch {
+	case body != "" && strings.HasPrefix(line, "@"):
+		bodyFile := path.Join(scriptDir, line[1:])
+		if bodyInfo, err := os.Stat(bodyFile); err != nil {
+			return true, action.BadLine(idx, fmt.Sprintf("Invalid %s body reference '%s': %s", body, bodyFile, err))
+		} else if bodyInfo.IsDir() {
+			return true, action.BadLine(idx, fmt.Sprintf("Invalid %s body reference '%s': is a directory, not a file", body, bodyFile))
+		}
+		tgt.BodyPath = bodyFile
+	case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+		if err := fill(line[1 : len(line)-1]); err != nil {
+			return true, action.BadLine(idx, fmt.Sprintf("Bad %s params '%s': %s", params, line, err))
+		}
+	case strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">"):
+		if err := tgt.Limit.FillFromLine(line[1 : len(line)-1]); err != nil {
+			return true, action.BadLine(idx, fmt.Sprintf("Bad limit params '%s': %s", line, err))
+		}
+	case strings.HasPrefix(line, "{") && strings.HasSuffix(line, "}"):
+		if err := tgt.Timeouts.FillFromLine(line[1 : len(line)-1]); err != nil {
+			return true, action.BadLine(idx, fmt.Sprintf("Bad timeout params '%s': %s", line, err))
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
 // CreateTarget parses the string stored in the `SessionAction.Raw`
 // property and checks:
 // * if it's a valid action
@@ -155,6 +253,30 @@ func (action *SessionAction) BadLine(offset int, message string) error {
 // * that a header value is specified (if the action lists any request headers)
 // * that the file with the request body exists (if one is specified)
 // * that the polling parameters are valid ones (if polling is being used)
+// * that the timeout parameters are valid ones (if any are given)
+// * that the limit parameters are valid ones (if any are given)
+// * that a feed is named (if the action claims a feed row)
+// * that saves name a store and column and have valid patterns (if any)
+// * that a var is named, with a value if the operation needs one
+// * that a barrier is named, with a number of sessions and maybe a timeout
+// * that a KV step has a redis:// or memcached:// URL and valid params
+// * that a SQL step has a postgres:// or mysql:// URL, a statement and valid
+//   params and args
+// * that a PUBLISH step has an mqtt:// or amqp:// URL, a topic and valid
+//   params, and that its body file exists (if one is specified)
+// * that an SMTP step has an smtp:// or smtps:// URL, a sender and
+//   recipients, valid headers and params, and that its body file exists (if
+//   one is specified)
+// * that an IMAP step has an imap:// or imaps:// URL with a user and
+//   password, and valid params
+// * that a DNS step has a udp://, tcp:// or https:// URL, queries and valid
+//   params
+// * that an LDAP step has an ldap:// or ldaps:// URL, and valid params and
+//   filter
+// * that an FTP or SFTP step has an ftp://, ftps:// or sftp:// URL with a
+//   path, valid params, and a body file that exists to put (if it puts)
+// * that an SSH step has an ssh:// URL with a user, a command, and a key
+//   file that exists (if one is specified)
 func (action *SessionAction) CreateTarget(scriptDir string) error {
 	tgt := NewTarget()
 	lines := strings.Split(action.Raw, "\n")
@@ -173,11 +295,278 @@ func (action *SessionAction) CreateTarget(scriptDir string) error {
 		tgt.Comment = strings.SplitN(firstLine, " ", 2)[1]
 		action.Target = tgt
 		return nil
+	} else if strings.HasPrefix(firstLine, "CONNECTIONS") {
+		tokens = strings.Fields(firstLine)
+		if len(tokens) != 2 || (tokens[1] != ConnectionsFresh && tokens[1] != ConnectionsReuse) {
+			return action.BadLine(0, fmt.Sprintf("Expected '%s' or '%s' as argument to CONNECTIONS, got '%s'",
+				ConnectionsFresh, ConnectionsReuse, strings.Join(tokens[1:], " ")))
+		}
+		tgt.Connections = tokens[1]
+		action.Target = tgt
+		return nil
+	} else if barrierCommand.MatchString(firstLine) {
+		step, err := ParseBarrierStep(firstLine)
+		if err != nil {
+			return action.BadLine(0, err.Error())
+		}
+		tgt.Barrier = step
+		action.Target = tgt
+		return nil
+	} else if varCommand.MatchString(firstLine) {
+		step, err := ParseVarStep(firstLine)
+		if err != nil {
+			return action.BadLine(0, err.Error())
+		}
+		tgt.Var = step
+		action.Target = tgt
+		return nil
+	} else if strings.HasPrefix(firstLine, "KV ") {
+		tokens = strings.Fields(firstLine)
+		if len(tokens) != 2 {
+			return action.BadLine(0, "Expected a redis:// or memcached:// URL as the argument to KV")
+		}
+		if _, err := parseKVURL(tokens[1]); err != nil && !feedReference.MatchString(tokens[1]) {
+			return action.BadLine(0, fmt.Sprintf("Invalid KV URL: %s", err))
+		}
+		tgt.URL, tgt.KV = tokens[1], NewKVConfig()
+		for idx, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if filled, err := action.fillStepLine(tgt, scriptDir, idx, line, "KV", tgt.KV.FillFromLine, ""); err != nil {
+				return err
+			} else if !filled {
+				return action.BadLine(idx, fmt.Sprintf("Bad KV line '%s': Expected %s", line, stepLines))
+			}
+		}
+		action.Target = tgt
+		return nil
+	} else if strings.HasPrefix(firstLine, "SQL ") {
+		tokens = strings.Fields(firstLine)
+		if len(tokens) != 2 {
+			return action.BadLine(0, "Expected a postgres:// or mysql:// URL as the argument to SQL")
+		}
+		if _, _, err := sqlSource(tokens[1]); err != nil && !feedReference.MatchString(tokens[1]) {
+			return action.BadLine(0, fmt.Sprintf("Invalid SQL URL: %s", err))
+		}
+		tgt.URL, tgt.SQL = tokens[1], NewSQLConfig()
+		tgt.SQL.Name = fmt.Sprintf("line%d", action.Line)
+		var statement []string
+		for idx, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if filled, err := action.fillStepLine(tgt, scriptDir, idx, line, "SQL", tgt.SQL.FillFromLine, ""); err != nil {
+				return err
+			} else if filled {
+				continue
+			}
+			if strings.HasPrefix(line, "(") && strings.HasSuffix(line, ")") {
+				if err := tgt.SQL.FillArgs(line[1 : len(line)-1]); err != nil {
+					return action.BadLine(idx, fmt.Sprintf("Bad SQL args '%s': %s", line, err))
+				}
+			} else {
+				statement = append(statement, line)
+			}
+		}
+		if tgt.SQL.Statement = strings.Join(statement, " "); tgt.SQL.Statement == "" {
+			return action.BadLine(0, "Expected a statement for SQL to run on the lines after its URL")
+		}
+		action.Target = tgt
+		return nil
+	} else if strings.HasPrefix(firstLine, "PUBLISH ") {
+		tokens = strings.Fields(firstLine)
+		if len(tokens) != 2 {
+			return action.BadLine(0, "Expected an mqtt:// or amqp:// URL as the argument to PUBLISH")
+		}
+		scheme := ""
+		if u, err := parseBrokerURL(tokens[1]); err == nil {
+			scheme = u.Scheme
+		} else if !feedReference.MatchString(tokens[1]) {
+			return action.BadLine(0, fmt.Sprintf("Invalid PUBLISH URL: %s", err))
+		}
+		tgt.URL, tgt.Publish = tokens[1], NewPublishConfig()
+		for idx, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if filled, err := action.fillStepLine(tgt, scriptDir, idx, line, "PUBLISH", tgt.Publish.FillFromLine, "message"); err != nil {
+				return err
+			} else if !filled {
+				return action.BadLine(idx, fmt.Sprintf("Bad PUBLISH line '%s': Expected @body, %s", line, stepLines))
+			}
+		}
+		if err := tgt.Publish.check(scheme); err != nil {
+			return action.BadLine(0, err.Error())
+		}
+		action.Target = tgt
+		return nil
+	} else if strings.HasPrefix(firstLine, "SMTP ") || strings.HasPrefix(firstLine, "IMAP ") {
+		tokens = strings.Fields(firstLine)
+		schemes := []string{mailSMTP, mailSMTPS}
+		if tokens[0] == "IMAP" {
+			schemes = []string{mailIMAP, mailIMAPS}
+		}
+		if len(tokens) != 2 {
+			return action.BadLine(0, fmt.Sprintf("Expected a %s:// or %s:// URL as the argument to %s", schemes[0], schemes[1], tokens[0]))
+		}
+		if _, err := parseMailURL(tokens[1], schemes...); err != nil && !feedReference.MatchString(tokens[1]) {
+			return action.BadLine(0, fmt.Sprintf("Invalid %s URL: %s", tokens[0], err))
+		}
+		tgt.URL = tokens[1]
+		var fill func(string) error
+		body := ""
+		if tokens[0] == "SMTP" {
+			tgt.SMTP = NewSMTPConfig()
+			fill, body = tgt.SMTP.FillFromLine, "message"
+		} else {
+			tgt.IMAP = NewIMAPConfig()
+			fill = tgt.IMAP.FillFromLine
+		}
+		for idx, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if filled, err := action.fillStepLine(tgt, scriptDir, idx, line, tokens[0], fill, body); err != nil {
+				return err
+			} else if filled {
+				continue
+			}
+			if header := strings.SplitN(line, ":", 2); tgt.SMTP != nil && len(header) == 2 &&
+				strings.TrimSpace(header[0]) != "" && strings.TrimSpace(header[1]) != "" {
+				tgt.Header.Add(strings.TrimSpace(header[0]), strings.TrimSpace(header[1]))
+			} else if tgt.SMTP != nil {
+				return action.BadLine(idx, fmt.Sprintf("Bad SMTP line '%s': Expected a header, @body, %s", line, stepLines))
+			} else {
+				return action.BadLine(idx, fmt.Sprintf("Bad IMAP line '%s': Expected %s", line, stepLines))
+			}
+		}
+		if tgt.SMTP != nil {
+			if err := tgt.SMTP.check(); err != nil {
+				return action.BadLine(0, err.Error())
+			}
+		}
+		action.Target = tgt
+		return nil
+	} else if strings.HasPrefix(firstLine, "DNS ") {
+		tokens = strings.Fields(firstLine)
+		if len(tokens) != 2 {
+			return action.BadLine(0, "Expected a udp://, tcp:// or https:// URL as the argument to DNS")
+		}
+		if _, err := parseDNSURL(tokens[1]); err != nil && !feedReference.MatchString(tokens[1]) {
+			return action.BadLine(0, fmt.Sprintf("Invalid DNS URL: %s", err))
+		}
+		tgt.URL, tgt.DNS = tokens[1], NewDNSConfig()
+		for idx, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if filled, err := action.fillStepLine(tgt, scriptDir, idx, line, "DNS", tgt.DNS.FillFromLine, ""); err != nil {
+				return err
+			} else if !filled {
+				return action.BadLine(idx, fmt.Sprintf("Bad DNS line '%s': Expected %s", line, stepLines))
+			}
+		}
+		if err := tgt.DNS.check(); err != nil {
+			return action.BadLine(0, err.Error())
+		}
+		action.Target = tgt
+		return nil
+	} else if strings.HasPrefix(firstLine, "LDAP ") {
+		tokens = strings.Fields(firstLine)
+		if len(tokens) != 2 {
+			return action.BadLine(0, "Expected an ldap:// or ldaps:// URL as the argument to LDAP")
+		}
+		if _, err := parseLDAPURL(tokens[1]); err != nil && !feedReference.MatchString(tokens[1]) {
+			return action.BadLine(0, fmt.Sprintf("Invalid LDAP URL: %s", err))
+		}
+		tgt.URL, tgt.LDAP = tokens[1], NewLDAPConfig()
+		for idx, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if filled, err := action.fillStepLine(tgt, scriptDir, idx, line, "LDAP", tgt.LDAP.FillFromLine, ""); err != nil {
+				return err
+			} else if !filled {
+				return action.BadLine(idx, fmt.Sprintf("Bad LDAP line '%s': Expected %s", line, stepLines))
+			}
+		}
+		action.Target = tgt
+		return nil
+	} else if strings.HasPrefix(firstLine, "FTP ") || strings.HasPrefix(firstLine, "SFTP ") {
+		tokens = strings.Fields(firstLine)
+		schemes := []string{ftpPlain, ftpTLS}
+		if tokens[0] == "SFTP" {
+			schemes = []string{ftpSFTP}
+		}
+		if len(tokens) != 2 {
+			return action.BadLine(0, fmt.Sprintf("Expected a %s:// URL as the argument to %s", strings.Join(schemes, ":// or "), tokens[0]))
+		}
+		if _, err := parseFTPURL(tokens[1], schemes...); err != nil && !feedReference.MatchString(tokens[1]) {
+			return action.BadLine(0, fmt.Sprintf("Invalid %s URL: %s", tokens[0], err))
+		}
+		tgt.URL, tgt.FTP = tokens[1], NewFTPConfig()
+		for idx, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if filled, err := action.fillStepLine(tgt, scriptDir, idx, line, tokens[0], tgt.FTP.FillFromLine, "file"); err != nil {
+				return err
+			} else if !filled {
+				return action.BadLine(idx, fmt.Sprintf("Bad %s line '%s': Expected @body, %s", tokens[0], line, stepLines))
+			}
+		}
+		if err := tgt.FTP.check(tgt.BodyPath); err != nil {
+			return action.BadLine(0, err.Error())
+		}
+		action.Target = tgt
+		return nil
+	} else if strings.HasPrefix(firstLine, "SSH ") {
+		tokens = strings.Fields(firstLine)
+		if len(tokens) != 2 {
+			return action.BadLine(0, "Expected an ssh:// URL as the argument to SSH")
+		}
+		if _, err := parseSSHURL(tokens[1]); err != nil && !feedReference.MatchString(tokens[1]) {
+			return action.BadLine(0, fmt.Sprintf("Invalid SSH URL: %s", err))
+		}
+		tgt.URL, tgt.SSH = tokens[1], NewSSHConfig()
+		var command []string
+		for idx, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+				if err := tgt.SSH.FillFromLine(line[1:len(line)-1], scriptDir); err != nil {
+					return action.BadLine(idx, fmt.Sprintf("Bad SSH params '%s': %s", line, err))
+				}
+			} else if strings.HasPrefix(line, "{") && strings.HasSuffix(line, "}") {
+				if err := tgt.Timeouts.FillFromLine(line[1 : len(line)-1]); err != nil {
+					return action.BadLine(idx, fmt.Sprintf("Bad timeout params '%s': %s", line, err))
+				}
+			} else {
+				command = append(command, line)
+			}
+		}
+		if tgt.SSH.Command = strings.Join(command, "\n"); tgt.SSH.Command == "" {
+			return action.BadLine(0, "Expected a command to run")
+		}
+		action.Target = tgt
+		return nil
+	} else if strings.HasPrefix(firstLine, "FEED") {
+		tokens = strings.Fields(firstLine)
+		if len(tokens) != 2 || !feedName.MatchString(tokens[1]) {
+			return action.BadLine(0, fmt.Sprintf("Expected a feed name (letters, digits and _) as argument to FEED, got '%s'",
+				strings.Join(tokens[1:], " ")))
+		}
+		tgt.Feed = tokens[1]
+		action.Target = tgt
+		return nil
 	}
 
-	// everything else starts with a URL action, possibly preceded by POLL
+	// everything else starts with a URL action, possibly preceded by POLL,
+	// STREAM, LONGPOLL, RANGES, PLAYBACK or CRAWL
 	tokens = strings.SplitN(firstLine, " ", 3)
-	if len(tokens) < 2 || (tokens[0] == "POLL" && len(tokens) == 2) {
+	if len(tokens) < 2 || (matchesPrefix(tokens[0]) && len(tokens) == 2) {
 		return action.BadLine(0, "Invalid number of arguments for URL command")
 	}
 	var matches []string
@@ -189,6 +578,29 @@ func (action *SessionAction) CreateTarget(scriptDir string) error {
 		tgt.Poller.Active = true // we'll get polling config in a later line
 		tgt.Method = tokens[1]
 		checkUrl = tokens[2]
+	} else if matches[1] == "STREAM " {
+		tgt.Stream = NewStreamConfig() // ...and the same for stream config
+		tgt.Method = tokens[1]
+		checkUrl = tokens[2]
+	} else if matches[1] == "LONGPOLL " {
+		tgt.LongPoll = NewLongPollConfig() // ...and for long polling config
+		tgt.Method = tokens[1]
+		checkUrl = tokens[2]
+	} else if matches[1] == "RANGES " {
+		tgt.Ranges = NewRangesConfig() // ...and for ranged download config
+		tgt.Method = tokens[1]
+		checkUrl = tokens[2]
+	} else if matches[1] == "PLAYBACK " {
+		tgt.Playback = NewPlaybackConfig() // ...and for media playback config
+		tgt.Method = tokens[1]
+		checkUrl = tokens[2]
+	} else if matches[1] == "CRAWL " {
+		if tokens[1] != "GET" {
+			return action.BadLine(0, fmt.Sprintf("CRAWL steps GET their sitemap, not %s", tokens[1]))
+		}
+		tgt.Crawl = NewCrawlConfig() // ...and for crawl config
+		tgt.Method = tokens[1]
+		checkUrl = tokens[2]
 	} else {
 		tgt.Method = tokens[0]
 		checkUrl = tokens[1]
@@ -199,28 +611,43 @@ func (action *SessionAction) CreateTarget(scriptDir string) error {
 	}
 	tgt.URL = checkUrl
 
+	params, fill := "poll", tgt.Poller.FillFromLine
+	switch {
+	case tgt.IsStream():
+		params, fill = "stream", tgt.Stream.FillFromLine
+	case tgt.IsLongPoll():
+		params, fill = "long poll", tgt.LongPoll.FillFromLine
+	case tgt.IsRanges():
+		params, fill = "ranges", tgt.Ranges.FillFromLine
+	case tgt.IsPlayback():
+		params, fill = "playback", tgt.Playback.FillFromLine
+	case tgt.IsCrawl():
+		params, fill = "crawl", tgt.Crawl.FillFromLine
+	}
 	for idx, line := range lines[1:] {
 		if line = strings.TrimSpace(line); line == "" {
 			continue
 		}
-		if strings.HasPrefix(line, "@") {
-			bodyFile := path.Join(scriptDir, line[1:])
-			bodyInfo, err := os.Stat(bodyFile)
-			if err != nil || bodyInfo.IsDir() {
-				var display string
-				if err != nil {
-					display = fmt.Sprintf("%s", err) // TODO: fix when online, dummy!
-				} else {
-					display = "is a directory, not a file"
-				}
-				return action.BadLine(idx, fmt.Sprintf("Invalid request body reference '%s': %s", bodyFile, display))
+		if filled, err := action.fillStepLine(tgt, scriptDir, idx, line, params, fill, "request"); err != nil {
+			return err
+		} else if filled {
+			continue
+		}
+		if strings.HasPrefix(line, ">") {
+			save, err := ParseSave(line[1:])
+			if err != nil {
+				return action.BadLine(idx, fmt.Sprintf("Bad save '%s': %s", line, err))
+			}
+			tgt.Saves = append(tgt.Saves, save)
+		} else if strings.HasPrefix(line, "=") {
+			if tgt.Checksum != nil || tgt.IsStream() {
+				return action.BadLine(idx, fmt.Sprintf("Bad checksum '%s': Only one checksum per step, and none for STREAM steps", line))
 			}
-			tgt.BodyPath = bodyFile
-		} else if strings.HasPrefix(line, "[") {
-			pollingConfig := line[1 : len(line)-1]
-			if err := tgt.Poller.FillFromLine(pollingConfig); err != nil {
-				return action.BadLine(idx, fmt.Sprintf("Bad poll params '%s': %s", line, err))
+			checksum, err := ParseChecksum(line[1:])
+			if err != nil {
+				return action.BadLine(idx, fmt.Sprintf("Bad checksum '%s': %s", line, err))
 			}
+			tgt.Checksum = checksum
 		} else {
 			headerTokens := strings.SplitN(line, ":", 2)
 			if len(headerTokens) < 2 {
@@ -238,14 +665,51 @@ func (action *SessionAction) CreateTarget(scriptDir string) error {
 	return nil
 }
 
+// matchesPrefix returns true if the token is one that may precede the
+// HTTP method of a URL action
+func matchesPrefix(token string) bool {
+	return token == "POLL" || token == "STREAM" || token == "LONGPOLL" || token == "RANGES" || token == "PLAYBACK" || token == "CRAWL"
+}
+
 func (action *SessionAction) String() string {
 	return fmt.Sprintf("[%d] %s", action.Line, action.Target)
 }
 
 var (
+	barrierCommand         = regexp.MustCompile("^BARRIER")
+	chanceCommand          = regexp.MustCompile(`^CHANCE(\s|$)`)
+	connectionsCommand     = regexp.MustCompile("^CONNECTIONS")
 	externalCommentCommand = regexp.MustCompile("^COMMENT")
+	feedCommand            = regexp.MustCompile("^FEED")
+	feedName               = regexp.MustCompile(`^\w+$`)
+	hookCommand            = regexp.MustCompile("^(ON_START|ON_END|END)$")
 	internalCommentCommand = regexp.MustCompile("^//")
 	pauseCommand           = regexp.MustCompile("^PAUSE")
+	varCommand             = regexp.MustCompile(`^(SET|SETNX|INCR|AWAIT)(\s|$)`)
+)
+
+const (
+	// HookStart opens a block of actions that run before the rest of the
+	// session; if any of them fail the session skips to its HookEnd actions
+	HookStart = "ON_START"
+	// HookEnd opens a block of actions that run after the rest of the
+	// session, even if it was stopped or a HookStart action failed
+	HookEnd = "ON_END"
+	// hookClose closes a HookStart or HookEnd block, and a chanceOpen one
+	hookClose = "END"
+	// chanceOpen opens a block of actions the session runs only with the
+	// given probability; it may be inside a HookStart or HookEnd block but
+	// not the other way around
+	chanceOpen = "CHANCE"
+)
+
+const (
+	// ConnectionsFresh is the CONNECTIONS argument to open a new connection
+	// for every request
+	ConnectionsFresh = "fresh"
+	// ConnectionsReuse is the CONNECTIONS argument to reuse pooled
+	// connections when possible (the default)
+	ConnectionsReuse = "reuse"
 )
 
 // Given a file with:
@@ -259,22 +723,46 @@ var (
 //
 //   PAUSE 12345
 //   COMMENT - this line will be ignored
+//   CONNECTIONS fresh
+//   FEED accounts
+//   SET region eu
 //
 //   POLL GET {url}
 //   Header-Three:Value
 //   [status=200 count=5 wait=2500]
+//   {connect=500 total=5000}
+//
+//   CHANCE 30
+//   POST /cart
+//   END
+//
+//   ON_END
+//   POST /logout
+//   END
 //
 // Generate a series of SessionAction objects whose 'Raw'
-// attribute includes the contents of each
+// attribute includes the contents of each, whose 'Hook' is set
+// for those inside an ON_START or ON_END block, and whose 'Chance'
+// is set for those inside a CHANCE block
 // [
 //   "GET /foo/bar\nHeader:Value",
 //   "POST /foo/bar/baz\nHeader:Value\nHeader-Two:Value\n@path/to/body",
-//   "POLL GET /foo/bar?created=true\nHeader-Three:Value\n[status=200 count=5 wait=2500]",
+//   "POLL GET /foo/bar?created=true\nHeader-Three:Value\n[status=200 count=5 wait=2500]\n{connect=500 total=5000}",
 //   "=> PAUSE 12345",
-//   "=> COMMENT - this line will be ignored"
+//   "=> COMMENT - this line will be ignored",
+//   "=> CONNECTIONS fresh",
+//   "=> FEED accounts",
+//   "=> SET region eu",
+//   "POST /cart" (CHANCE 30%),
+//   "POST /logout" (ON_END)
 // ]
 func ScanActions(reader io.Reader) ([]*SessionAction, error) {
-	var actions []*SessionAction
+	var (
+		actions   []*SessionAction
+		chance    *Chance
+		hook      string
+		hookStart int
+	)
 	lineNumber := 0
 
 	sc := peekingScanner{src: bufio.NewScanner(reader)}
@@ -288,6 +776,34 @@ func ScanActions(reader io.Reader) ([]*SessionAction, error) {
 		if line == "" || internalCommentCommand.MatchString(line) {
 			continue
 		}
+		if chanceCommand.MatchString(line) {
+			if chance != nil {
+				return nil, fmt.Errorf("Line %d: %s inside the %s block from line %d", lineNumber, line, chanceOpen, chance.Line)
+			}
+			var err error
+			if chance, err = ParseChance(line, lineNumber); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if hookCommand.MatchString(line) {
+			if chance != nil {
+				if line != hookClose {
+					return nil, fmt.Errorf("Line %d: %s inside the %s block from line %d", lineNumber, line, chanceOpen, chance.Line)
+				}
+				chance = nil
+			} else if line == hookClose {
+				if hook == "" {
+					return nil, fmt.Errorf("Line %d: %s without %s or %s", lineNumber, hookClose, HookStart, HookEnd)
+				}
+				hook = ""
+			} else if hook != "" {
+				return nil, fmt.Errorf("Line %d: %s inside the %s block from line %d", lineNumber, line, hook, hookStart)
+			} else {
+				hook, hookStart = line, lineNumber
+			}
+			continue
+		}
 		current := []string{line}
 		if !isSingleLineCommand(line) {
 			for {
@@ -304,12 +820,25 @@ func ScanActions(reader io.Reader) ([]*SessionAction, error) {
 				}
 			}
 		}
-		action := &SessionAction{Raw: strings.Join(current, "\n"), Line: startLine}
+		action := &SessionAction{Raw: strings.Join(current, "\n"), Line: startLine, Hook: hook, Chance: chance}
 		actions = append(actions, action)
 	}
+	if chance != nil {
+		return nil, fmt.Errorf("Line %d: %s block not closed with %s", chance.Line, chanceOpen, hookClose)
+	}
+	if hook != "" {
+		return nil, fmt.Errorf("Line %d: %s block not closed with %s", hookStart, hook, hookClose)
+	}
 	return actions, nil
 }
 
 func isSingleLineCommand(line string) bool {
-	return pauseCommand.MatchString(line) || externalCommentCommand.MatchString(line)
+	return pauseCommand.MatchString(line) ||
+		externalCommentCommand.MatchString(line) ||
+		connectionsCommand.MatchString(line) ||
+		feedCommand.MatchString(line) ||
+		varCommand.MatchString(line) ||
+		barrierCommand.MatchString(line) ||
+		chanceCommand.MatchString(line) ||
+		hookCommand.MatchString(line)
 }
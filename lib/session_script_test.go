@@ -0,0 +1,220 @@
+package korra
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanActionsSingleLineCommands(t *testing.T) {
+	raw := `
+CONNECTIONS fresh
+GET http://foo/bar
+Header:Value
+PAUSE 100
+CONNECTIONS reuse
+HEAD http://foo/baz
+`
+	actions, err := ScanActions(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"CONNECTIONS fresh",
+		"GET http://foo/bar\nHeader:Value",
+		"PAUSE 100",
+		"CONNECTIONS reuse",
+		"HEAD http://foo/baz",
+	}
+	if len(expected) != len(actions) {
+		t.Fatalf("Expected %d actions, got %d", len(expected), len(actions))
+	}
+	for idx, want := range expected {
+		if got := actions[idx].Raw; want != got {
+			t.Fatalf("Action %d; expected %s, got %s", idx, want, got)
+		}
+	}
+}
+
+func TestCreateTargetConnections(t *testing.T) {
+	action := &SessionAction{Raw: "CONNECTIONS fresh", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	if !action.Target.IsConnections() || action.Target.Connections != ConnectionsFresh {
+		t.Fatalf("want fresh connections, got: %s", action.Target)
+	}
+	for _, bad := range []string{"CONNECTIONS", "CONNECTIONS sometimes", "CONNECTIONS fresh reuse"} {
+		action = &SessionAction{Raw: bad, Line: 1}
+		if err := action.CreateTarget("."); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+func TestCreateTargetStream(t *testing.T) {
+	action := &SessionAction{Raw: "STREAM GET http://foo/events\n[Events=20 Duration=30000]", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := action.Target.Stream, (&StreamConfig{Events: 20, Duration: 30000}); !action.Target.IsStream() || *got != *want {
+		t.Fatalf("got: %s, want: %s", got, want)
+	}
+	if action.Target.Poller.Active {
+		t.Fatalf("stream should not poll")
+	}
+}
+
+func TestCreateTargetLongPoll(t *testing.T) {
+	action := &SessionAction{Raw: "LONGPOLL GET http://foo/news\n[Cycles=3 Hold=500]", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	want := &LongPollConfig{Cycles: 3, Hold: 500, Backoff: 1000}
+	if got := action.Target.LongPoll; !action.Target.IsLongPoll() || *got != *want {
+		t.Fatalf("got: %s, want: %s", got, want)
+	}
+	if got := action.Target.LongPoll.Cycle(action.Target).Timeouts.Total; got != 500*time.Millisecond {
+		t.Fatalf("cycle total timeout: got: %s, want: 500ms", got)
+	}
+	action = &SessionAction{Raw: "LONGPOLL GET", Line: 1}
+	if err := action.CreateTarget("."); err == nil {
+		t.Fatalf("want error for LONGPOLL without URL")
+	}
+}
+
+func TestScanActionsHooks(t *testing.T) {
+	raw := `
+GET http://foo/main
+ON_END
+POST http://foo/logout
+END
+ON_START
+POST http://foo/login
+Header:Value
+END
+PAUSE 100
+`
+	actions, err := ScanActions(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := newSessionScript(actions)
+	expected := []struct{ raw, hook string }{
+		{"POST http://foo/login\nHeader:Value", HookStart},
+		{"GET http://foo/main", ""},
+		{"PAUSE 100", ""},
+		{"POST http://foo/logout", HookEnd},
+	}
+	if len(expected) != len(script.Actions) {
+		t.Fatalf("Expected %d actions, got %d", len(expected), len(script.Actions))
+	}
+	for idx, want := range expected {
+		if got := script.Actions[idx]; want.raw != got.Raw || want.hook != got.Hook {
+			t.Fatalf("Action %d; expected %s (%s), got %s (%s)", idx, want.raw, want.hook, got.Raw, got.Hook)
+		}
+	}
+
+	script.NextAction()
+	script.SkipToEnd()
+	if action := script.NextAction(); action.Hook != HookEnd {
+		t.Fatalf("Expected to skip to the %s hook, got %s", HookEnd, action.Raw)
+	}
+	script.SkipToEnd()
+	if script.ActionsRemain() {
+		t.Fatal("Expected no actions to remain after the last hook")
+	}
+}
+
+func TestScanActionsBadHooks(t *testing.T) {
+	for _, raw := range []string{
+		"GET http://foo/bar\nEND",
+		"ON_START\nON_END\nEND",
+		"ON_END\nGET http://foo/bar",
+	} {
+		if _, err := ScanActions(strings.NewReader(raw)); err == nil {
+			t.Fatalf("Expected error scanning %q", raw)
+		}
+	}
+}
+
+func TestScanActionsChance(t *testing.T) {
+	raw := `
+GET http://foo/product
+CHANCE 30
+POST http://foo/cart
+Header:Value
+PAUSE 100
+END
+CHANCE 12.5%
+POST http://foo/checkout
+END
+ON_END
+CHANCE 50
+POST http://foo/logout
+END
+END
+`
+	actions, err := ScanActions(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := newSessionScript(actions)
+	expected := []struct {
+		raw, chance string
+	}{
+		{"GET http://foo/product", ""},
+		{"POST http://foo/cart\nHeader:Value", "CHANCE 30%"},
+		{"PAUSE 100", "CHANCE 30%"},
+		{"POST http://foo/checkout", "CHANCE 12.5%"},
+		{"POST http://foo/logout", "CHANCE 50%"},
+	}
+	if len(expected) != len(script.Actions) {
+		t.Fatalf("Expected %d actions, got %d", len(expected), len(script.Actions))
+	}
+	for idx, want := range expected {
+		got := script.Actions[idx]
+		chance := ""
+		if got.Chance != nil {
+			chance = got.Chance.String()
+		}
+		if want.raw != got.Raw || want.chance != chance {
+			t.Fatalf("Action %d; expected %s (%s), got %s (%s)", idx, want.raw, want.chance, got.Raw, chance)
+		}
+	}
+	if script.Actions[1].Chance != script.Actions[2].Chance || script.Actions[4].Hook != HookEnd {
+		t.Fatal("Expected the steps of a block to share it, inside any hook")
+	}
+
+	script.NextAction()
+	script.SkipChance(script.NextAction().Chance)
+	if action := script.NextAction(); action.Raw != "POST http://foo/checkout" {
+		t.Fatalf("Expected to skip the rest of the block, got %s", action.Raw)
+	}
+
+	random, taken := NewRandom(1), 0
+	for i := 0; i < 10000; i++ {
+		if script.Actions[1].Chance.taken(random) {
+			taken += 1
+		}
+	}
+	if taken < 2800 || taken > 3200 {
+		t.Fatalf("Expected the block taken about 30%% of the time, got %d of 10000", taken)
+	}
+}
+
+func TestScanActionsBadChance(t *testing.T) {
+	for _, raw := range []string{
+		"CHANCE 30\nGET http://foo/bar",
+		"CHANCE 30\nCHANCE 20\nEND\nEND",
+		"CHANCE 30\nON_START\nEND\nEND",
+		"CHANCE\nEND",
+		"CHANCE 0\nEND",
+		"CHANCE 101\nEND",
+		"CHANCE lots\nEND",
+	} {
+		if _, err := ScanActions(strings.NewReader(raw)); err == nil {
+			t.Fatalf("Expected error scanning %q", raw)
+		}
+	}
+}
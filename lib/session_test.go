@@ -0,0 +1,20 @@
+package korra
+
+import "testing"
+
+// runAction runs the step's action with do, on a session with the values,
+// returning the results it sent
+func runAction(t *testing.T, raw string, count int, do func(*Session, *SessionAction), values map[string]string) Results {
+	action := &SessionAction{Raw: raw, Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{attacker: NewAttacker(), aborted: make(chan struct{}), results: make(chan *Result, count), values: values}
+	do(session, action)
+	close(session.results)
+	var results Results
+	for result := range session.results {
+		results = append(results, result)
+	}
+	return results
+}
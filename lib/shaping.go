@@ -0,0 +1,106 @@
+package korra
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSimulatedReset is returned from reads on a connection that the network
+// conditions decided should be reset.
+var ErrSimulatedReset = errors.New("connection reset (simulated)")
+
+// NetworkConditions describes the last-mile network an Attacker should
+// pretend to be behind. The zero value means no shaping at all.
+type NetworkConditions struct {
+	Latency   time.Duration // added to every round trip
+	Jitter    time.Duration // random +/- variance applied to Latency
+	Bandwidth int64         // bytes per second in each direction; 0 is unlimited
+	ResetRate float64       // percentage (0-100) of connections reset before a response is read
+	random    *Random       // set from the Attacker's Seed, if any
+}
+
+// Active returns true if any of the conditions will change the connection
+func (nc NetworkConditions) Active() bool {
+	return nc.Latency > 0 || nc.Jitter > 0 || nc.Bandwidth > 0 || nc.ResetRate > 0
+}
+
+// Merge returns a copy of these conditions with each non-zero condition
+// from override replacing its counterpart.
+func (nc NetworkConditions) Merge(override NetworkConditions) NetworkConditions {
+	if override.Latency > 0 {
+		nc.Latency = override.Latency
+	}
+	if override.Jitter > 0 {
+		nc.Jitter = override.Jitter
+	}
+	if override.Bandwidth > 0 {
+		nc.Bandwidth = override.Bandwidth
+	}
+	if override.ResetRate > 0 {
+		nc.ResetRate = override.ResetRate
+	}
+	return nc
+}
+
+func (nc NetworkConditions) delay() time.Duration {
+	d := nc.Latency
+	if nc.Jitter > 0 {
+		d += time.Duration(nc.random.Int63n(int64(2*nc.Jitter))) - nc.Jitter
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (nc NetworkConditions) transferTime(n int) time.Duration {
+	if nc.Bandwidth <= 0 || n <= 0 {
+		return 0
+	}
+	return time.Duration(int64(n) * int64(time.Second) / nc.Bandwidth)
+}
+
+// Wrap returns the connection shaped by the conditions; if none are active
+// the connection is returned as-is.
+func (nc NetworkConditions) Wrap(conn net.Conn) net.Conn {
+	if !nc.Active() {
+		return conn
+	}
+	return &shapedConn{
+		Conn:       conn,
+		conditions: nc,
+		reset:      nc.ResetRate > 0 && nc.random.Float64()*100 < nc.ResetRate,
+	}
+}
+
+// shapedConn applies NetworkConditions to the reads and writes of a net.Conn.
+// Latency is applied once per round trip: when the first response bytes
+// arrive after a write. The transport reads and writes from goroutines of
+// its own, so wrote is atomic.
+type shapedConn struct {
+	net.Conn
+	conditions NetworkConditions
+	reset      bool
+	wrote      atomic.Bool
+}
+
+func (c *shapedConn) Read(b []byte) (int, error) {
+	if c.reset {
+		c.Conn.Close()
+		return 0, ErrSimulatedReset
+	}
+	n, err := c.Conn.Read(b)
+	if n > 0 && c.wrote.Swap(false) {
+		time.Sleep(c.conditions.delay())
+	}
+	time.Sleep(c.conditions.transferTime(n))
+	return n, err
+}
+
+func (c *shapedConn) Write(b []byte) (int, error) {
+	time.Sleep(c.conditions.transferTime(len(b)))
+	c.wrote.Store(true)
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,78 @@
+package korra
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNetworkConditionsInactive(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	if got := (NetworkConditions{}).Wrap(client); got != client {
+		t.Fatalf("want unwrapped connection, got: %#v", got)
+	}
+}
+
+func TestNetworkConditionsReset(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := NetworkConditions{ResetRate: 100}.Wrap(client)
+	if _, err := conn.Read(make([]byte, 8)); err != ErrSimulatedReset {
+		t.Fatalf("got: %v, want: %v", err, ErrSimulatedReset)
+	}
+}
+
+func TestNetworkConditionsLatency(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 4)
+		server.Read(buf)
+		server.Write(buf)
+	}()
+	latency := 20 * time.Millisecond
+	conn := NetworkConditions{Latency: latency}.Wrap(client)
+	began := time.Now()
+	conn.Write([]byte("ping"))
+	if _, err := conn.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if got := time.Since(began); got < latency {
+		t.Fatalf("round trip took %s, want at least %s", got, latency)
+	}
+}
+
+func TestNetworkConditionsThroughTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	latency := 50 * time.Millisecond
+	atk := NewAttacker(Conditions(NetworkConditions{Latency: latency}))
+	tr := staticTargeter(&Target{Method: "GET", URL: server.URL})
+
+	// a new connection takes a round trip to connect and one for the request
+	if res := atk.Hit(tr, time.Now(), 1); res.Error != "" || res.Latency < 2*latency {
+		t.Fatalf("want at least %s on a new connection, got: %s %s", 2*latency, res.Latency, res.Error)
+	}
+	for i := 0; i < 3; i++ {
+		if res := atk.Hit(tr, time.Now(), 1); res.Error != "" || res.Latency < latency || res.Latency >= 2*latency {
+			t.Fatalf("want one round trip of %s on a reused connection, got: %s %s", latency, res.Latency, res.Error)
+		}
+	}
+}
+
+func TestNetworkConditionsDialCancelled(t *testing.T) {
+	atk := NewAttacker(Conditions(NetworkConditions{Latency: time.Minute}))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	began := time.Now()
+	if _, err := atk.dial(ctx, "tcp", "127.0.0.1:1"); err != context.DeadlineExceeded {
+		t.Fatalf("want: %v, got: %v", context.DeadlineExceeded, err)
+	}
+	if took := time.Since(began); took > time.Second {
+		t.Fatalf("want the round trip cut short with the dial, took %s", took)
+	}
+}
@@ -0,0 +1,41 @@
+package korra
+
+import (
+	"runtime"
+	"sync"
+)
+
+// minShard is the fewest results worth handing a CPU of their own
+const minShard = 25000
+
+// shardCount returns how many shards to split n results into: one per CPU,
+// but no more than leaves each minShard
+func shardCount(n int) int {
+	shards := runtime.GOMAXPROCS(0)
+	if most := n / minShard; most < shards {
+		shards = most
+	}
+	if shards < 1 {
+		shards = 1
+	}
+	return shards
+}
+
+// forEachShard splits n results into that many shards in order, calling fn
+// with each shard's number and range in a goroutine of its own, and returns
+// once they've all returned
+func forEachShard(n, shards int, fn func(shard, from, to int)) {
+	if shards == 1 {
+		fn(0, 0, n)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < shards; i++ {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			fn(shard, shard*n/shards, (shard+1)*n/shards)
+		}(i)
+	}
+	wg.Wait()
+}
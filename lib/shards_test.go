@@ -0,0 +1,89 @@
+package korra
+
+import (
+	"math"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewMetricsSharded(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	var r Results
+	for i := 0; i < 4*minShard+17; i++ {
+		result := &Result{
+			Timestamp: time.Unix(0, int64(i)*int64(time.Millisecond)),
+			Code:      uint16(200 + 300*(i%7/6)),
+			Latency:   time.Duration(i%1000) * time.Microsecond,
+			BytesIn:   uint64(i % 10),
+		}
+		if i%7 == 6 {
+			result.Error = "500 Internal Server Error"
+		}
+		r = append(r, result)
+	}
+	if shardCount(len(r)) != 4 {
+		t.Fatalf("want 4 shards, got %d", shardCount(len(r)))
+	}
+
+	sharded := NewMetrics(r)
+	runtime.GOMAXPROCS(1)
+	single := NewMetrics(r)
+	sort.Strings(sharded.Errors)
+	sort.Strings(single.Errors)
+	if !reflect.DeepEqual(sharded, single) {
+		t.Fatalf("want the same metrics from shards as from one, got:\n%+v\nfor:\n%+v", sharded, single)
+	}
+}
+
+func TestNewMetricsShardedSketch(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	defer func(limit int) { ExactQuantiles = limit }(ExactQuantiles)
+	ExactQuantiles = minShard
+
+	// each shard's latencies are slower than the last's, which merging the
+	// shards' sketches gets wrong
+	var r Results
+	for i := 0; i < 4*minShard; i++ {
+		r = append(r, &Result{Timestamp: time.Unix(0, int64(i)), Latency: time.Duration(i) * time.Microsecond})
+	}
+	sharded := NewMetrics(r).Latencies
+	runtime.GOMAXPROCS(1)
+	single := NewMetrics(r).Latencies
+	if sharded.Exact || single.Exact {
+		t.Fatal("want the quantiles estimated")
+	}
+	if !reflect.DeepEqual(sharded, single) {
+		t.Fatalf("want the same quantiles from shards as from one, got:\n%+v\nfor:\n%+v", sharded, single)
+	}
+	for _, q := range []struct {
+		at  float64
+		got time.Duration
+	}{{0.50, sharded.P50}, {0.95, sharded.P95}, {0.99, sharded.P99}} {
+		want := time.Duration(q.at*float64(len(r))) * time.Microsecond
+		if off := math.Abs(float64(q.got-want)) / float64(time.Duration(len(r))*time.Microsecond); off > sketchRankError {
+			t.Errorf("P%v: want %s within rank error %v, got %s", q.at*100, want, sketchRankError, q.got)
+		}
+	}
+}
+
+func TestAddResultsSharded(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	var r Results
+	for i := 0; i < 2*minShard; i++ {
+		paths := []string{"/users/1", "/users/2/posts", "/about", "/users/3"}
+		r = append(r, &Result{Method: "GET", Path: paths[i%len(paths)]})
+	}
+	buckets := NewBucketCollection()
+	buckets.AddResults(r)
+	names := map[string]int{}
+	for _, bucket := range buckets.Buckets() {
+		names[bucket.String()] = len(bucket.Results)
+	}
+	want := map[string]int{"GET /users/*": minShard, "GET /users/*/posts": minShard / 2, "GET /about": minShard / 2}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("want %v, got %v", want, names)
+	}
+}
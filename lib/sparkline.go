@@ -0,0 +1,128 @@
+package korra
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// sparkBlocks are the eight heights of a sparkline, lowest first
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparklineSlots is the number of slots -- characters -- each sparkline
+// splits the run into
+const sparklineSlots = 40
+
+// sparkline draws the values as blocks scaled from zero to max; a NaN is a
+// slot with no results and is left blank.
+func sparkline(values []float64, max float64) string {
+	var line strings.Builder
+	for _, value := range values {
+		switch {
+		case math.IsNaN(value):
+			line.WriteRune(' ')
+		case max <= 0:
+			line.WriteRune(sparkBlocks[0])
+		default:
+			level := int(value / max * float64(len(sparkBlocks)-1))
+			if level >= len(sparkBlocks) {
+				level = len(sparkBlocks) - 1
+			}
+			line.WriteRune(sparkBlocks[level])
+		}
+	}
+	return line.String()
+}
+
+// runSpan is the time from the first request of a run to the end of its
+// last one, which every set of results in a report is drawn against so
+// their sparklines line up.
+type runSpan struct {
+	start, end time.Time
+}
+
+func spanOf(r Results) runSpan {
+	var span runSpan
+	for _, result := range r {
+		if span.start.IsZero() || result.Timestamp.Before(span.start) {
+			span.start = result.Timestamp
+		}
+		if end := result.Timestamp.Add(result.Latency); end.After(span.end) {
+			span.end = end
+		}
+	}
+	return span
+}
+
+// slot is the time each character of a sparkline covers
+func (s runSpan) slot() time.Duration {
+	slot := s.end.Sub(s.start) / time.Duration(sparklineSlots)
+	if slot <= 0 {
+		slot = 1
+	}
+	return slot
+}
+
+// trends returns the mean latency and the error rate in each slot of the
+// span for the results, NaN where a slot has none
+func (s runSpan) trends(r Results) (latencies, errors []float64) {
+	var (
+		slot   = s.slot()
+		counts = make([]int, sparklineSlots)
+	)
+	latencies = make([]float64, sparklineSlots)
+	errors = make([]float64, sparklineSlots)
+	for _, result := range r {
+		idx := int(result.Timestamp.Sub(s.start) / slot)
+		if idx < 0 || idx >= sparklineSlots {
+			idx = sparklineSlots - 1
+		}
+		weight := result.weight()
+		counts[idx] += weight
+		latencies[idx] += float64(result.Latency) * float64(weight)
+		if result.Error != "" {
+			errors[idx] += float64(weight)
+		}
+	}
+	for idx, count := range counts {
+		if count == 0 {
+			latencies[idx], errors[idx] = math.NaN(), math.NaN()
+			continue
+		}
+		latencies[idx] /= float64(count)
+		errors[idx] /= float64(count)
+	}
+	return latencies, errors
+}
+
+// sparklinesToText writes the latency and error rate sparklines for the
+// results, each scaled to its highest slot, and under them where the
+// annotations fall, if any do
+func (s runSpan) sparklinesToText(w io.Writer, c palette, r Results, annotations Annotations) {
+	if !s.end.After(s.start) {
+		return
+	}
+	latencies, errors := s.trends(r)
+	maxLatency, maxErrors := maxOf(latencies), maxOf(errors)
+	slot := s.slot().Round(time.Millisecond)
+	fmt.Fprintf(w, "Latency Trend\t%s\t%s\n",
+		c.label(fmt.Sprintf("[mean per %s, max %s]", slot, time.Duration(maxLatency))), sparkline(latencies, maxLatency))
+	fmt.Fprintf(w, "Error Trend\t%s\t%s\n",
+		c.label(fmt.Sprintf("[rate per %s, max %.2f%%]", slot, maxErrors*100)), sparkline(errors, maxErrors))
+	if marks := s.annotationMarks(annotations); marks != "" {
+		fmt.Fprintf(w, "Annotations\t%s\t%s\n", c.label("[as listed]"), marks)
+	}
+}
+
+// maxOf returns the highest of the values, skipping NaNs
+func maxOf(values []float64) float64 {
+	max := 0.0
+	for _, value := range values {
+		if !math.IsNaN(value) && value > max {
+			max = value
+		}
+	}
+	return max
+}
@@ -0,0 +1,44 @@
+package korra
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	values := []float64{0, 1, 2, math.NaN(), 7, 8}
+	if want, got := "▁▁▂ ▇█", sparkline(values, 8); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+	if want, got := "▁▁ ", sparkline([]float64{0, 0, math.NaN()}, 0); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestRunSpanTrends(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	var r Results
+	// a second for each slot, with the second half of the run slower and failing
+	for i := 0; i < sparklineSlots; i++ {
+		result := &Result{Timestamp: start.Add(time.Duration(i) * time.Second), Latency: 100 * time.Millisecond}
+		if i >= sparklineSlots/2 {
+			result.Latency, result.Error = 900*time.Millisecond, "500 Internal Server Error"
+		}
+		r = append(r, result)
+	}
+	span := spanOf(r)
+	if want, got := start.Add(time.Duration(sparklineSlots-1)*time.Second+900*time.Millisecond), span.end; !want.Equal(got) {
+		t.Fatalf("end; want: %s, got: %s", want, got)
+	}
+	latencies, errors := span.trends(r)
+	if want, got := float64(100*time.Millisecond), latencies[0]; want != got {
+		t.Fatalf("first latency; want: %v, got: %v", want, got)
+	}
+	if want, got := float64(900*time.Millisecond), latencies[sparklineSlots-1]; want != got {
+		t.Fatalf("last latency; want: %v, got: %v", want, got)
+	}
+	if errors[0] != 0 || errors[sparklineSlots-1] != 1 {
+		t.Fatalf("want error rates from 0 to 1, got: %v", errors)
+	}
+}
@@ -0,0 +1,90 @@
+package korra
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sqlTimestamp is how timestamps are written for SQLite, which compares
+// them as text and reads them with its date and time functions
+const sqlTimestamp = "2006-01-02 15:04:05.000000"
+
+// sqlColumns are the columns of the results table each result fills, named
+// so that loading into a table with its columns in another order, or with
+// more of them, still puts each value where it belongs
+const sqlColumns = "timestamp, method, path, bucket, target, code, latency, bytes_out, bytes_in, error, dns_latency, dns_resolver, request_count, conditional, event, weight"
+
+// SQLDumper dumps Results as SQL statements that load them into the results
+// table of a SQLite database, with the URL bucket of each from Collection and
+// indexes on the columns questions are asked of: timestamp (UTC), bucket,
+// code and latency (in ns). Header starts a transaction that Footer commits,
+// so loading millions of results takes seconds rather than hours.
+type SQLDumper struct {
+	Collection *BucketCollection
+}
+
+func (d *SQLDumper) Header() []byte {
+	return []byte(`PRAGMA journal_mode = MEMORY;
+PRAGMA synchronous = OFF;
+CREATE TABLE IF NOT EXISTS results (
+  timestamp TEXT NOT NULL,
+  method TEXT NOT NULL,
+  path TEXT NOT NULL,
+  bucket TEXT NOT NULL,
+  target TEXT NOT NULL,
+  code INTEGER NOT NULL,
+  latency INTEGER NOT NULL,
+  bytes_out INTEGER NOT NULL,
+  bytes_in INTEGER NOT NULL,
+  error TEXT NOT NULL,
+  dns_latency INTEGER NOT NULL,
+  dns_resolver TEXT NOT NULL,
+  request_count INTEGER NOT NULL,
+  conditional INTEGER NOT NULL,
+  event INTEGER NOT NULL,
+  weight INTEGER NOT NULL
+);
+BEGIN;
+`)
+}
+
+// Footer commits the results and indexes them, which is quicker after
+// loading than during
+func (d *SQLDumper) Footer() []byte {
+	return []byte(`COMMIT;
+CREATE INDEX IF NOT EXISTS results_timestamp ON results (timestamp);
+CREATE INDEX IF NOT EXISTS results_bucket ON results (bucket, timestamp);
+CREATE INDEX IF NOT EXISTS results_code ON results (code, timestamp);
+CREATE INDEX IF NOT EXISTS results_latency ON results (latency);
+`)
+}
+
+func (d *SQLDumper) Dump(r *Result) ([]byte, error) {
+	conditional := 0
+	if r.Conditional {
+		conditional = 1
+	}
+	return []byte(fmt.Sprintf("INSERT INTO results ("+sqlColumns+") VALUES (%s, %s, %s, %s, %s, %d, %d, %d, %d, %s, %d, %s, %d, %d, %d, %d);\n",
+		sqlString(r.Timestamp.UTC().Format(sqlTimestamp)),
+		sqlString(r.Method),
+		sqlString(r.Path),
+		sqlString(d.Collection.BucketOf(r).String()),
+		sqlString(r.Target),
+		r.Code,
+		r.Latency.Nanoseconds(),
+		r.BytesOut,
+		r.BytesIn,
+		sqlString(r.Error),
+		r.DNSLatency.Nanoseconds(),
+		sqlString(r.DNSResolver),
+		r.RequestCount,
+		conditional,
+		r.Event,
+		r.weight(),
+	)), nil
+}
+
+// sqlString quotes s as an SQL string literal
+func sqlString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
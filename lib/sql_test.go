@@ -0,0 +1,31 @@
+package korra
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLDumper(t *testing.T) {
+	buckets := NewBucketCollection()
+	d := &SQLDumper{Collection: &buckets}
+	ts := time.Date(2015, 2, 17, 14, 2, 3, 123456000, time.UTC)
+	first, err := d.Dump(&Result{Timestamp: ts, Method: "POST", Path: "/checkout/12", Code: 502, Latency: 3 * time.Millisecond, Error: "it's down"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO results (timestamp, method, path, bucket, target, code, latency, bytes_out, bytes_in, error, dns_latency, dns_resolver, request_count, conditional, event, weight) VALUES ('2015-02-17 14:02:03.123456', 'POST', '/checkout/12', 'POST /checkout/*', '', 502, 3000000, 0, 0, 'it''s down', 0, '', 0, 0, 0, 1);\n"
+	if string(first) != want {
+		t.Fatalf("want:\n%s\ngot:\n%s", want, first)
+	}
+	second, _ := d.Dump(&Result{Timestamp: ts, Method: "POST", Path: "/checkout/18", Code: 200, Weight: 4})
+	if !strings.Contains(string(second), "'POST /checkout/*'") || !strings.HasSuffix(string(second), ", 4);\n") {
+		t.Fatalf("want the same bucket and the weight, got: %s", second)
+	}
+	if len(buckets.Buckets()) != 1 {
+		t.Fatalf("want one inferred bucket, got %d", len(buckets.Buckets()))
+	}
+	if !strings.Contains(string(d.Header()), "BEGIN;") || !strings.HasPrefix(string(d.Footer()), "COMMIT;") {
+		t.Fatal("want the header to start a transaction the footer commits")
+	}
+}
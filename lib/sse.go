@@ -0,0 +1,174 @@
+package korra
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrStreamNoEvents is the error when a stream sent no events before it
+	// ended or its duration was up
+	ErrStreamNoEvents = errors.New("stream: no events received")
+)
+
+// StreamConfig defines how long a STREAM step listens to a Server-Sent
+// Events stream; it stops at whichever limit comes first.
+type StreamConfig struct {
+	Events   int // stop after this many events; 0 means no limit
+	Duration int // stop after this many milliseconds
+}
+
+func NewStreamConfig() *StreamConfig {
+	return &StreamConfig{Events: 0, Duration: 10000}
+}
+
+// FillFromLine takes a line formatted:
+//
+//	[param=value param=value]
+//
+// and fills itself from the parameters, as:
+//
+//   - events: The max number of events to read (default: no limit)
+//   - duration: The time (in milliseconds) to listen (default: 10000)
+func (config *StreamConfig) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for stream param, got: %s", piece)
+		}
+		num, err := strconv.Atoi(strings.TrimSpace(param[1]))
+		if err != nil || num < 0 {
+			return fmt.Errorf("Expected positive int for stream param, got: %s", piece)
+		}
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "events":
+			config.Events = num
+		case "duration":
+			config.Duration = num
+		default:
+			return fmt.Errorf("Unknown stream param: %s", param[0])
+		}
+	}
+	if config.Duration == 0 {
+		return fmt.Errorf("Stream duration must be greater than 0")
+	}
+	return nil
+}
+
+func (config *StreamConfig) String() string {
+	return fmt.Sprintf("[Events=%d Duration=%d]", config.Events, config.Duration)
+}
+
+// Stream sends the request from the Target and reads the Server-Sent Events
+// it responds with, passing a Result to emit for every event: the first has
+// the time to the first event as its Latency, and every one after that the
+// time since the event before it. Once the stream is done it emits the
+// Result of the request itself, with the time to its response headers as
+// its Latency, every byte of the events read, and the error if the stream
+// failed or ended without any events. Reports count only that one as a
+// request; the events they report on their own.
+func (a *Attacker) Stream(tgt *Target, tm time.Time, emit func(*Result)) {
+	base := Result{Timestamp: tm, Method: tgt.Method, RequestCount: 1, Target: targetLabel(a.base)}
+	base.PathFromURL(tgt.URL)
+	fail := func(code int, err error) {
+		r := base
+		r.Code = uint16(code)
+		r.Latency = time.Since(tm)
+		r.Error = err.Error()
+		emit(&r)
+	}
+
+	request, err := tgt.Request()
+	if err != nil {
+		fail(0, err)
+		return
+	}
+	rebase(request, a.base)
+	a.addHeaders(request)
+	if request.Header.Get("Accept") == "" {
+		request.Header.Set("Accept", "text/event-stream")
+	}
+	request.Close = a.fresh
+	ctx, cancel := context.WithTimeout(request.Context(), time.Duration(tgt.Stream.Duration)*time.Millisecond)
+	defer cancel()
+	request = request.WithContext(ctx)
+
+	// the stream's duration is its total timeout
+	timeouts := a.timeouts.Merge(tgt.Timeouts)
+	timeouts.Total = 0
+	var timer *phaseTimer
+	if timeouts.Active() {
+		request, timer = timeouts.bind(request)
+		defer timer.finish(nil)
+	}
+
+	response, err := a.client.Do(request)
+	if err != nil {
+		if timer != nil {
+			err = timer.finish(err)
+		}
+		fail(0, err)
+		return
+	}
+	defer response.Body.Close()
+	headers := time.Since(tm)
+	base.Code = uint16(response.StatusCode)
+	if base.HasErrorCode() {
+		fail(response.StatusCode, errors.New(response.Status))
+		return
+	}
+
+	events, last := 0, tm
+	var size, total uint64
+	pending := false
+	reader := bufio.NewReader(response.Body)
+	for tgt.Stream.Events == 0 || events < tgt.Stream.Events {
+		var line string
+		if line, err = reader.ReadString('\n'); err != nil {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if !pending {
+				continue
+			}
+			now := time.Now()
+			events++
+			r := base
+			r.Event = events
+			r.Timestamp = last
+			r.Latency = now.Sub(last)
+			r.BytesIn = size
+			emit(&r)
+			total += size
+			last, size, pending = now, 0, false
+		case strings.HasPrefix(line, ":"):
+			// comment, usually a heartbeat to keep the connection open
+		default:
+			size += uint64(len(line))
+			pending = pending || strings.HasPrefix(line, "data") || strings.HasPrefix(line, "event")
+		}
+	}
+
+	// running out of time or the server closing the stream is expected
+	if err == nil || err == io.EOF || ctx.Err() != nil {
+		err = nil
+		if events == 0 {
+			err = ErrStreamNoEvents
+		}
+	}
+	r := base
+	r.Latency = headers
+	r.BytesIn = total
+	if err != nil {
+		r.Error = err.Error()
+	}
+	emit(&r)
+}
@@ -0,0 +1,67 @@
+package korra
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamEvents(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("Accept"); got != "text/event-stream" {
+				t.Errorf("Accept: got: %s, want: text/event-stream", got)
+			}
+			flusher := w.(http.Flusher)
+			for i := 0; i < 5; i++ {
+				fmt.Fprintf(w, ": heartbeat\nevent: tick\ndata: %d\n\n", i)
+				flusher.Flush()
+				time.Sleep(5 * time.Millisecond)
+			}
+		}),
+	)
+	defer server.Close()
+	tgt := NewTarget()
+	tgt.Method, tgt.URL, tgt.Stream = "GET", server.URL, &StreamConfig{Events: 3, Duration: 1000}
+
+	var results Results
+	NewAttacker().Stream(tgt, time.Now(), func(r *Result) { results = append(results, r) })
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 3 events and the request", len(results))
+	}
+	for idx, r := range results[:3] {
+		if r.Error != "" || r.Event != idx+1 {
+			t.Fatalf("result %d: got event %d error '%s'", idx, r.Event, r.Error)
+		}
+	}
+	request := results[3]
+	if request.Error != "" || request.Event != 0 || request.Latency >= results[1].Timestamp.Sub(request.Timestamp) {
+		t.Fatalf("want the request last, timed to its headers, got: %+v", request)
+	}
+	m := NewMetrics(results)
+	if m.Events.Total != 3 || m.Events.FirstMean == 0 {
+		t.Fatalf("got event metrics %+v", m.Events)
+	}
+	if m.Requests != 1 || m.Latencies.Max != request.Latency || m.StatusCodes["200"] != 1 {
+		t.Fatalf("want only the request counted as one, got: %d requests, max %s, codes %v", m.Requests, m.Latencies.Max, m.StatusCodes)
+	}
+}
+
+func TestStreamNoEvents(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(": just a heartbeat\n\n"))
+		}),
+	)
+	defer server.Close()
+	tgt := NewTarget()
+	tgt.Method, tgt.URL, tgt.Stream = "GET", server.URL, NewStreamConfig()
+
+	var results Results
+	NewAttacker().Stream(tgt, time.Now(), func(r *Result) { results = append(results, r) })
+	if len(results) != 1 || results[0].Error != ErrStreamNoEvents.Error() {
+		t.Fatalf("got %v, want a single result with '%s'", results, ErrStreamNoEvents)
+	}
+}
@@ -0,0 +1,118 @@
+package korra
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSHConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ops"), []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	action := &SessionAction{Raw: "SSH ssh://ops@db-1:22\nsudo systemctl stop postgresql\n[Key=ops]\n{Total=60000}", Line: 1}
+	if err := action.CreateTarget(dir); err != nil {
+		t.Fatal(err)
+	}
+	target := action.Target
+	if target.SSH.Command != "sudo systemctl stop postgresql" || target.SSH.KeyPath != filepath.Join(dir, "ops") || !target.Timeouts.Active() {
+		t.Fatalf("bad SSH config: %s", target.SSH)
+	}
+	if target.String() != "SSH ops@db-1:22" {
+		t.Fatalf("want the step shown without a password, got: %s", target)
+	}
+	for _, bad := range []string{"SSH ssh://ops@db-1:22", "SSH http://ops@db-1:22\nuptime", "SSH ssh://db-1:22\nuptime",
+		"SSH ssh://ops@db-1\nuptime", "SSH ssh://ops@db-1:22\nuptime\n[Key=missing]", "SSH ssh://ops@db-1:22\nuptime\n[Wait=false]"} {
+		action = &SessionAction{Raw: bad, Line: 1}
+		if err := action.CreateTarget(dir); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+func TestSSH(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	notes, err := NewAnnotationLog(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notes.Close()
+	run := func(raw string) (string, bool) {
+		action := &SessionAction{Raw: raw, Line: 1}
+		if err := action.CreateTarget("."); err != nil {
+			t.Fatal(err)
+		}
+		logs := make(chan string, 10)
+		session := &Session{Script: &SessionScript{}, attacker: NewAttacker(), aborted: make(chan struct{}), results: make(chan *Result, 1),
+			logChan: logs, values: map[string]string{"nodes.name": "node-3"}, Annotations: notes}
+		session.doSSH(action)
+		close(logs)
+		if len(session.results) > 0 {
+			t.Fatalf("want no result for an SSH step, got: %+v", <-session.results)
+		}
+		var lines []string
+		for line := range logs {
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n"), session.failed
+	}
+
+	logged, failed := run(fmt.Sprintf("SSH ssh://ops@%s\nkubectl delete pod ${nodes.name}", listener.Addr()))
+	if !failed || !strings.Contains(logged, "no SSH client: build korra with -tags ssh") {
+		t.Fatalf("want the step failed without an SSH client, got: %s", logged)
+	}
+
+	var commands []string
+	SSHRunner = func(conn net.Conn, addr, user, password string, key []byte, command string) ([]byte, int, error) {
+		if user != "ops" || password != "secret" {
+			return nil, 0, fmt.Errorf("ssh: unable to authenticate")
+		}
+		commands = append(commands, command)
+		if strings.HasPrefix(command, "false") {
+			return []byte("oops"), 1, nil
+		}
+		return []byte("pod deleted"), 0, nil
+	}
+	defer func() { SSHRunner = nil }()
+
+	logged, failed = run(fmt.Sprintf("SSH ssh://ops:secret@%s\nkubectl delete pod ${nodes.name}", listener.Addr()))
+	want := fmt.Sprintf(`SSH ops@%s "kubectl delete pod node-3" exited 0 after`, listener.Addr())
+	if failed || !strings.Contains(logged, want) || strings.Contains(logged, "secret") {
+		t.Fatalf("want the command's timing logged, got: %s", logged)
+	}
+	if len(commands) != 1 || commands[0] != "kubectl delete pod node-3" {
+		t.Fatalf("want the command run with the feed's values, got: %v", commands)
+	}
+	if all := notes.All(); len(all) != 1 || all[0].Text != fmt.Sprintf(`SSH ops@%s "kubectl delete pod node-3" exited 0`, listener.Addr()) {
+		t.Fatalf("want the attack annotated with the command, got: %+v", all)
+	}
+
+	logged, failed = run(fmt.Sprintf("SSH ssh://ops:secret@%s\nfalse", listener.Addr()))
+	if !failed || !strings.Contains(logged, `"false" exited 1 after`) {
+		t.Fatalf("want the step failed by the command's exit status, got: %s", logged)
+	}
+
+	logged, failed = run(fmt.Sprintf("SSH ssh://ops:wrong@%s\nuptime", listener.Addr()))
+	if !failed || !strings.Contains(logged, `"uptime" failed after`) || !strings.Contains(logged, "unable to authenticate") {
+		t.Fatalf("want the login failure logged, got: %s", logged)
+	}
+}
@@ -0,0 +1,62 @@
+package korra
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Stage is a stretch of an attack, from and to times since its first
+// result, like one step of load in a test that steps it up.
+type Stage struct {
+	Name     string
+	From, To time.Duration
+}
+
+func (s Stage) String() string {
+	return fmt.Sprintf("%s [%s, %s)", s.Name, s.From, s.To)
+}
+
+// ParseStages reads the lengths of consecutive stages, each optionally
+// named, like:
+//
+//	2m,5m,5m
+//	warmup=2m,100 users=5m,200 users=5m
+//
+// Stages without a name are numbered from 1.
+func ParseStages(spec string) ([]Stage, error) {
+	var (
+		stages []Stage
+		from   time.Duration
+	)
+	for idx, piece := range strings.Split(spec, ",") {
+		name, length := fmt.Sprintf("stage %d", idx+1), strings.TrimSpace(piece)
+		if eq := strings.LastIndex(length, "="); eq >= 0 {
+			name, length = strings.TrimSpace(length[:eq]), strings.TrimSpace(length[eq+1:])
+		}
+		d, err := time.ParseDuration(length)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("bad stage '%s': want a length above zero, like 5m", piece)
+		}
+		stages = append(stages, Stage{Name: name, From: from, To: from + d})
+		from += d
+	}
+	return stages, nil
+}
+
+// SplitStages groups the results by the stage each started in, counting
+// from the first result; those after the last stage are in none of them.
+func SplitStages(r Results, stages []Stage) []Results {
+	byStage := make([]Results, len(stages))
+	start := spanOf(r).start
+	for _, result := range r {
+		since := result.Timestamp.Sub(start)
+		for i, stage := range stages {
+			if since >= stage.From && since < stage.To {
+				byStage[i] = append(byStage[i], result)
+				break
+			}
+		}
+	}
+	return byStage
+}
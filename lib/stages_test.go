@@ -0,0 +1,59 @@
+package korra
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStages(t *testing.T) {
+	stages, err := ParseStages("warmup=2m, 5m,busy=5m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Stage{
+		{"warmup", 0, 2 * time.Minute},
+		{"stage 2", 2 * time.Minute, 7 * time.Minute},
+		{"busy", 7 * time.Minute, 12 * time.Minute},
+	}
+	if len(stages) != len(want) {
+		t.Fatalf("want: %v, got: %v", want, stages)
+	}
+	for i := range want {
+		if want[i] != stages[i] {
+			t.Fatalf("stage %d; want: %v, got: %v", i, want[i], stages[i])
+		}
+	}
+	if want, got := "busy [7m0s, 12m0s)", stages[2].String(); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+	for _, bad := range []string{"", "5m,", "fast=soon", "0s"} {
+		if _, err := ParseStages(bad); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestSplitStages(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	var r Results
+	for i := 0; i < 10; i++ {
+		r = append(r, &Result{Timestamp: start.Add(time.Duration(i) * time.Second), Latency: time.Millisecond})
+	}
+	stages := []Stage{{"first", 0, 3 * time.Second}, {"second", 3 * time.Second, 8 * time.Second}}
+	byStage := SplitStages(r, stages)
+	if want, got := 3, len(byStage[0]); want != got {
+		t.Fatalf("first; want: %d, got: %d", want, got)
+	}
+	if want, got := 5, len(byStage[1]); want != got {
+		t.Fatalf("second; want: %d, got: %d", want, got)
+	}
+
+	report, err := TextReporter{SectionOptions: SectionOptions{Stages: stages}}.Report(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), "STAGE second [3s, 8s): 5 results") {
+		t.Fatalf("no second stage in report:\n%s", report)
+	}
+}
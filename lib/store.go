@@ -0,0 +1,102 @@
+package korra
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// saveBodyLimit is the most of a response body read for a step's saves
+const saveBodyLimit = 1 << 20
+
+// Save captures a value from the body of a step's response into a column
+// of a store: a feeder every session shares, which starts empty and gets a
+// row from each response with something to save. Sessions of a later phase
+// claim the rows with FEED, like those of any feed.
+type Save struct {
+	Store   string
+	Column  string
+	Pattern *regexp.Regexp // the value is its first group, or the whole match without one
+}
+
+// ParseSave parses a save as the store and column, then the pattern:
+//
+//	created.id "id":\s*"(\w+)"
+func ParseSave(line string) (Save, error) {
+	var save Save
+	ref, pattern, _ := strings.Cut(strings.TrimSpace(line), " ")
+	store, column, ok := strings.Cut(ref, ".")
+	if !ok || !feedName.MatchString(store) || !feedName.MatchString(column) {
+		return save, fmt.Errorf("Expected store.column to save to, got '%s'", ref)
+	}
+	if pattern = strings.TrimSpace(pattern); pattern == "" {
+		return save, fmt.Errorf("Expected a pattern to save %s from", ref)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return save, fmt.Errorf("Bad pattern to save %s from: %s", ref, err)
+	}
+	return Save{Store: store, Column: column, Pattern: re}, nil
+}
+
+func (s Save) String() string {
+	return fmt.Sprintf("%s.%s %s", s.Store, s.Column, s.Pattern)
+}
+
+// saveValues returns the values the saves captured from the body, by store
+// then column; a store none of whose saves matched has no row
+func saveValues(saves []Save, body []byte) map[string]map[string]string {
+	var saved map[string]map[string]string
+	for _, save := range saves {
+		match := save.Pattern.FindSubmatch(body)
+		if match == nil {
+			continue
+		}
+		value := match[0]
+		if len(match) > 1 {
+			value = match[1]
+		}
+		if saved == nil {
+			saved = map[string]map[string]string{}
+		}
+		if saved[save.Store] == nil {
+			saved[save.Store] = map[string]string{}
+		}
+		saved[save.Store][save.Column] = string(value)
+	}
+	return saved
+}
+
+// NewStore returns an empty store with the name; its rows are handed out
+// over and over, as FeedRecycle does, since it can't know how many are to
+// come.
+func NewStore(name string) *Feeder {
+	return &Feeder{Name: name, Policy: FeedRecycle, store: true}
+}
+
+// IsStore returns true if the feeder is a store, filled by saves rather
+// than read from a file
+func (f *Feeder) IsStore() bool {
+	return f.store
+}
+
+// Add adds a row of the values by column, adding any columns it hasn't
+// seen before
+func (f *Feeder) Add(values map[string]string) {
+	f.Lock()
+	defer f.Unlock()
+	for column := range values {
+		known := false
+		for _, c := range f.columns {
+			known = known || c == column
+		}
+		if !known {
+			f.columns = append(f.columns, column)
+		}
+	}
+	row := make([]string, len(f.columns))
+	for idx, column := range f.columns {
+		row[idx] = values[column]
+	}
+	f.rows = append(f.rows, row)
+}
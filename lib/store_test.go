@@ -0,0 +1,69 @@
+package korra
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCreateTargetSaves(t *testing.T) {
+	action := &SessionAction{Raw: "POST http://shop/items\n> created.id \"id\":\\s*\"(\\w+)\"\n> created.kind (widget|gadget)", Line: 1}
+	if err := action.CreateTarget("."); err != nil {
+		t.Fatal(err)
+	}
+	saves := action.Target.Saves
+	if len(saves) != 2 || saves[0].String() != `created.id "id":\s*"(\w+)"` || saves[1].Column != "kind" {
+		t.Fatalf("bad saves: %v", saves)
+	}
+	script := newSessionScript([]*SessionAction{action})
+	if got := script.Stores(); !reflect.DeepEqual(got, []string{"created"}) {
+		t.Fatalf("want the created store, got: %v", got)
+	}
+	for _, bad := range []string{"> created", "> created.id", "> created.id (unclosed", "> a-b.id x"} {
+		action = &SessionAction{Raw: "GET http://shop/items\n" + bad, Line: 1}
+		if err := action.CreateTarget("."); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+func TestSavesFillStore(t *testing.T) {
+	next := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next++
+		fmt.Fprintf(w, `{"id": "item%d", "kind": "widget"}`, next)
+	}))
+	defer server.Close()
+	id, _ := ParseSave(`created.id "id":\s*"(\w+)"`)
+	kind, _ := ParseSave(`created.kind widget|gadget`)
+	missing, _ := ParseSave(`other.id "nope":"(\w+)"`)
+	target := &Target{Method: "POST", URL: server.URL, Saves: []Save{id, kind, missing}}
+
+	store := NewStore("created")
+	if _, err := store.Next(); err != ErrFeedExhausted {
+		t.Fatalf("want an empty store exhausted, got: %v", err)
+	}
+	attacker := NewAttacker()
+	session := &Session{Feeders: Feeders{"created": store}}
+	for i := 0; i < 2; i++ {
+		result := attacker.Hit(func() (*Target, error) { return target, nil }, time.Now(), 1)
+		if _, ok := result.saved["other"]; ok {
+			t.Fatalf("want nothing saved without a match, got: %v", result.saved)
+		}
+		session.save(result)
+	}
+
+	// rows recycle once claimed, as the store can't know if more are coming
+	for _, want := range []string{"item1", "item2", "item1"} {
+		values, err := store.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if values["created.id"] != want || values["created.kind"] != "widget" {
+			t.Fatalf("want %s, got: %v", want, values)
+		}
+	}
+}
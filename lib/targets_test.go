@@ -1,10 +1,8 @@
 package korra
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/rand"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -26,7 +24,7 @@ func TestTargetRequest(t *testing.T) {
 	tgt := Target{
 		Method: "GET",
 		URL:    "http://:9999/",
-		Body:   body,
+		body:   body,
 		Header: http.Header{
 			"X-Some-Header":       []string{"1"},
 			"X-Some-Other-Header": []string{"2"},
@@ -41,7 +39,7 @@ func TestTargetRequest(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if !bytes.Equal(tgt.Body, reqBody) {
+	if !bytes.Equal(tgt.body, reqBody) {
 		t.Fatalf("Target body wasn't copied correctly")
 	}
 
@@ -59,7 +57,7 @@ func TestTargetRequest(t *testing.T) {
 	}
 }
 
-func TestTargetFromScanner(t *testing.T) {
+func TestCreateTargetFromAction(t *testing.T) {
 	src := []string{
 		"GET /foo/bar\nHeader:Value",
 		"POST /foo/bar/baz\nHeader:Value\n@../CHANGELOG",
@@ -71,82 +69,48 @@ func TestTargetFromScanner(t *testing.T) {
 	doubleHeader := http.Header{}
 	doubleHeader.Add("Header", "Bees")
 	doubleHeader.Add("Header-Two", "Honey")
-	postBody, _ := ioutil.ReadFile("../CHANGELOG")
-
-	var emptyBody []byte
-	var emptyHeaders http.Header
 
 	wants := []*Target{
-		&Target{Method: "GET", URL: "/foo/bar", Header: singleHeader, Body: emptyBody},
-		&Target{Method: "POST", URL: "/foo/bar/baz", Header: singleHeader, Body: postBody},
-		&Target{Method: "POST", URL: "/buzzer", Header: doubleHeader, Body: postBody},
-		&Target{Method: "HEAD", URL: "/foos", Header: http.Header{}, Body: emptyBody},
+		&Target{Method: "GET", URL: "/foo/bar", Header: singleHeader},
+		&Target{Method: "POST", URL: "/foo/bar/baz", Header: singleHeader, BodyPath: "../CHANGELOG"},
+		&Target{Method: "POST", URL: "/buzzer", Header: doubleHeader, BodyPath: "../CHANGELOG"},
+		&Target{Method: "HEAD", URL: "/foos", Header: http.Header{}},
 	}
 
 	for idx, text := range src {
 		want := wants[idx]
-		scanner := peekingScanner{src: bufio.NewScanner(strings.NewReader(text))}
-		got, err := TargetFromScanner(scanner, emptyBody, emptyHeaders, fmt.Sprintf("Item %d", idx))
-		if err != nil {
+		action := &SessionAction{Raw: text, Line: idx + 1}
+		if err := action.CreateTarget("."); err != nil {
 			t.Fatal(err)
-		} else if !reflect.DeepEqual(want, got) {
-			t.Fatalf("want: %#v, got: %#v", want, got)
 		}
-	}
-}
-
-func TestNewEagerTargeter(t *testing.T) {
-	t.Parallel()
-
-	src := []byte("GET http://:6060/\nHEAD http://:6606/")
-	read, err := NewEagerTargeter(bytes.NewReader(src), []byte("body"), nil)
-	if err != nil {
-		t.Fatalf("Couldn't parse valid source: %s", err)
-	}
-	for _, want := range []*Target{
-		&Target{
-			Method: "GET",
-			URL:    "http://:6060/",
-			Body:   []byte("body"),
-			Header: http.Header{},
-		},
-		&Target{
-			Method: "HEAD",
-			URL:    "http://:6606/",
-			Body:   []byte("body"),
-			Header: http.Header{},
-		},
-	} {
-		if got, err := read(); err != nil {
-			t.Fatal(err)
-		} else if !reflect.DeepEqual(want, got) {
+		got := action.Target
+		if got.Method != want.Method || got.URL != want.URL || got.BodyPath != want.BodyPath || !reflect.DeepEqual(want.Header, got.Header) {
 			t.Fatalf("want: %#v, got: %#v", want, got)
 		}
 	}
 }
 
-func TestNewLazyTargeter(t *testing.T) {
-	for want, def := range map[error]string{
-		errors.New("bad target"): "GET",
-		errors.New("bad method"): "SET http://:6060",
-		errors.New("bad URL"):    "GET foobar",
-		errors.New("bad body"): `
+func TestCreateTargetErrors(t *testing.T) {
+	for want, def := range map[string]string{
+		"bad target": "GET",
+		"bad method": "DELETE http://:6060",
+		"bad URL":    "GET foobar",
+		"bad body": `
 			GET http://:6060
 			@238hhqwjhd8hhw3r.txt`,
-		errors.New("bad header"): `
+		"bad header": `
 		  GET http://:6060
 			Authorization`,
-		errors.New("bad header"): `
+		"blank header": `
 			GET http://:6060
 			Authorization:`,
-		errors.New("bad header"): `
+		"blank header name": `
 			GET http://:6060
 			: 1234`,
 	} {
-		src := bytes.NewBufferString(strings.TrimSpace(def))
-		read := NewLazyTargeter(src, []byte{}, http.Header{})
-		if _, got := read(); got == nil || !strings.HasPrefix(got.Error(), want.Error()) {
-			t.Errorf("got: %s, want: %s\n%s", got, want, def)
+		action := &SessionAction{Raw: strings.TrimSpace(def), Line: 1}
+		if err := action.CreateTarget("."); err == nil || action.Error == nil {
+			t.Errorf("%s; want an error from:\n%s", want, def)
 		}
 	}
 
@@ -169,44 +133,37 @@ func TestNewLazyTargeter(t *testing.T) {
 		Authorization: x12345
 		@`, bodyf.Name(),
 	)
-
-	src := bytes.NewBufferString(strings.TrimSpace(targets))
-	read := NewLazyTargeter(src, []byte{}, http.Header{"Content-Type": []string{"text/plain"}})
-	for _, want := range []*Target{
-		&Target{
-			Method: "GET",
-			URL:    "http://:6060/",
-			Body:   []byte{},
-			Header: http.Header{
-				"X-Header":     []string{"1", "2"},
-				"Content-Type": []string{"text/plain"},
-			},
-		},
-		&Target{
-			Method: "PUT",
-			URL:    "https://:6060/123",
-			Body:   []byte{},
-			Header: http.Header{"Content-Type": []string{"text/plain"}},
-		},
-		&Target{
-			Method: "POST",
-			URL:    "http://foobar.org/fnord",
-			Body:   []byte("Hello world!"),
-			Header: http.Header{
-				"Authorization": []string{"x12345"},
-				"Content-Type":  []string{"text/plain"},
-			},
-		},
-	} {
-		if got, err := read(); err != nil {
+	actions, err := ScanActions(strings.NewReader(strings.TrimSpace(targets)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wants := []struct {
+		target *Target
+		body   string
+	}{
+		{&Target{Method: "GET", URL: "http://:6060/", Header: http.Header{"X-Header": []string{"1", "2"}}}, ""},
+		{&Target{Method: "PUT", URL: "https://:6060/123", Header: http.Header{}}, ""},
+		{&Target{Method: "POST", URL: "http://foobar.org/fnord", Header: http.Header{"Authorization": []string{"x12345"}}}, "Hello world!"},
+	}
+	if len(actions) != len(wants) {
+		t.Fatalf("want %d actions, got %d", len(wants), len(actions))
+	}
+	for idx, want := range wants {
+		if err := actions[idx].CreateTarget("/"); err != nil {
 			t.Fatal(err)
-		} else if !reflect.DeepEqual(want, got) {
-			t.Fatalf("want: %#v, got: %#v", want, got)
 		}
-	}
-	if got, err := read(); err != ErrNoTargets {
-		t.Fatalf("got: %v, want: %v", err, ErrNoTargets)
-	} else if got != nil {
-		t.Fatalf("got: %v, want: %v", got, nil)
+		got := actions[idx].Target
+		if got.Method != want.target.Method || got.URL != want.target.URL || !reflect.DeepEqual(want.target.Header, got.Header) {
+			t.Fatalf("want: %#v, got: %#v", want.target, got)
+		}
+		var body []byte
+		if reader, err := got.Body(); err != nil {
+			t.Fatal(err)
+		} else if reader != nil {
+			body, _ = ioutil.ReadAll(reader)
+		}
+		if string(body) != want.body {
+			t.Fatalf("want body %q, got %q", want.body, body)
+		}
 	}
 }
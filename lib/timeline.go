@@ -0,0 +1,126 @@
+package korra
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StatusClasses are the classes of status a StatusTimeline counts; none is
+// for results that got no response at all.
+var StatusClasses = []string{"2xx", "3xx", "4xx", "5xx", "none"}
+
+// StatusWindow is how many results of each of the StatusClasses started in
+// a window of the run
+type StatusWindow struct {
+	Start  time.Time `json:"start"`
+	Counts []int     `json:"counts"` // by StatusClasses
+}
+
+// Outage is a stretch of the run, one or more windows in a row, in which
+// results failed with an error status or no response: from the start of
+// the first such window to the start of the next window without any, when
+// it recovered.
+type Outage struct {
+	Start     time.Time `json:"start"`
+	Recovered time.Time `json:"recovered"` // zero if it hadn't by the end of the run
+	Failed    []int     `json:"failed"`    // by StatusClasses
+	Results   int       `json:"results"`
+}
+
+func (o Outage) String() string {
+	recovered := "not recovered"
+	if !o.Recovered.IsZero() {
+		recovered = o.Recovered.Format("15:04:05.000")
+	}
+	var (
+		failed []string
+		total  int
+	)
+	for i, count := range o.Failed {
+		if count > 0 {
+			failed = append(failed, fmt.Sprintf("%s %d", StatusClasses[i], count))
+			total += count
+		}
+	}
+	return fmt.Sprintf("%s - %s: %d of %d results failed (%s)",
+		o.Start.Format("15:04:05.000"), recovered, total, o.Results, strings.Join(failed, ", "))
+}
+
+// StatusTimeline is the status classes of a set of results window by window,
+// with the outages among them, so when failures started under load and when
+// they stopped can be read off. Windows are aligned to the clock rather than
+// the first result, so the timelines of every section line up.
+type StatusTimeline struct {
+	Window  time.Duration  `json:"window"`
+	Windows []StatusWindow `json:"windows"` // those with results, in order
+	Outages []Outage       `json:"outages,omitempty"`
+}
+
+// NewStatusTimeline returns the timeline of the results over windows of the
+// width, or nil if there's no width or there are no results.
+func NewStatusTimeline(r Results, window time.Duration) *StatusTimeline {
+	if window <= 0 || len(r) == 0 {
+		return nil
+	}
+	byStart := map[time.Time]*StatusWindow{}
+	for _, result := range r {
+		start := result.Timestamp.Truncate(window)
+		w := byStart[start]
+		if w == nil {
+			w = &StatusWindow{Start: start, Counts: make([]int, len(StatusClasses))}
+			byStart[start] = w
+		}
+		w.Counts[statusClass(result.Code)] += result.weight()
+	}
+	timeline := &StatusTimeline{Window: window}
+	for _, w := range byStart {
+		timeline.Windows = append(timeline.Windows, *w)
+	}
+	sort.Slice(timeline.Windows, func(i, j int) bool { return timeline.Windows[i].Start.Before(timeline.Windows[j].Start) })
+
+	var outage *Outage
+	for _, w := range timeline.Windows {
+		failing := w.Counts[2] + w.Counts[3] + w.Counts[4]
+		// a window with no results isn't a recovery, only one where they succeed
+		if failing == 0 {
+			if outage != nil {
+				outage.Recovered = w.Start
+				timeline.Outages = append(timeline.Outages, *outage)
+				outage = nil
+			}
+			continue
+		}
+		if outage == nil {
+			outage = &Outage{Start: w.Start, Failed: make([]int, len(StatusClasses))}
+		}
+		for i, count := range w.Counts {
+			outage.Results += count
+			if i >= 2 {
+				outage.Failed[i] += count
+			}
+		}
+	}
+	if outage != nil {
+		timeline.Outages = append(timeline.Outages, *outage)
+	}
+	return timeline
+}
+
+// statusClass returns the index in StatusClasses of the status code's class;
+// anything under 200 other than no response at all is counted with 5xx, as
+// HasErrorCode counts it as failing
+func statusClass(code uint16) int {
+	switch {
+	case code == 0:
+		return 4
+	case code >= 200 && code < 300:
+		return 0
+	case code >= 300 && code < 400:
+		return 1
+	case code >= 400 && code < 500:
+		return 2
+	}
+	return 3
+}
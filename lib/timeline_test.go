@@ -0,0 +1,52 @@
+package korra
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewStatusTimeline(t *testing.T) {
+	start := time.Date(2016, 1, 1, 15, 36, 50, 0, time.UTC)
+	var r Results
+	// a second each of success, 503s and timeouts, a quiet second, success,
+	// then 404s to the end
+	codes := []uint16{200, 503, 0, 0, 200, 404}
+	for i, code := range codes {
+		if i == 3 {
+			continue
+		}
+		for j := 0; j < 4; j++ {
+			result := &Result{Timestamp: start.Add(time.Duration(i)*time.Second + time.Duration(j)*250*time.Millisecond), Code: code}
+			if j == 0 && code != 200 {
+				result.Code = 200
+			}
+			r = append(r, result)
+		}
+	}
+
+	timeline := NewStatusTimeline(r, time.Second)
+	if want, got := 5, len(timeline.Windows); want != got {
+		t.Fatalf("windows; want: %d, got: %d", want, got)
+	}
+	if want, got := []int{1, 0, 0, 3, 0}, timeline.Windows[1].Counts; !reflect.DeepEqual(want, got) {
+		t.Fatalf("second window; want: %v, got: %v", want, got)
+	}
+	if want, got := 2, len(timeline.Outages); want != got {
+		t.Fatalf("outages; want: %d, got: %d: %+v", want, got, timeline.Outages)
+	}
+	first, last := timeline.Outages[0], timeline.Outages[1]
+	if !first.Start.Equal(start.Add(time.Second)) || !first.Recovered.Equal(start.Add(4*time.Second)) {
+		t.Fatalf("first outage: %+v", first)
+	}
+	if want, got := "15:36:51.000 - 15:36:54.000: 6 of 8 results failed (5xx 3, none 3)", first.String(); want != got {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+	if !last.Recovered.IsZero() || !strings.Contains(last.String(), "not recovered: 3 of 4 results failed (4xx 3)") {
+		t.Fatalf("last outage: %s", last)
+	}
+	if NewStatusTimeline(r, 0) != nil {
+		t.Fatal("expected no timeline without a window")
+	}
+}
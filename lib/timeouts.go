@@ -0,0 +1,200 @@
+package korra
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrConnectTimeout is the error for a step that couldn't connect in time
+	ErrConnectTimeout = errors.New("timeout: connect")
+	// ErrTLSTimeout is the error for a step whose TLS handshake didn't finish in time
+	ErrTLSTimeout = errors.New("timeout: TLS handshake")
+	// ErrHeaderTimeout is the error for a step with no response header in time
+	ErrHeaderTimeout = errors.New("timeout: response header")
+	// ErrTotalTimeout is the error for a step that didn't complete in time
+	ErrTotalTimeout = errors.New("timeout: total request")
+
+	// TimeoutKinds are the categories reported for timed out requests, in
+	// the order in which they occur during a request
+	TimeoutKinds = []string{"connect", "tls", "header", "total"}
+)
+
+// Timeouts holds the maximum time allowed for each phase of a request; a
+// zero value for any phase means it's not limited beyond the defaults of
+// the Attacker.
+type Timeouts struct {
+	Connect time.Duration
+	TLS     time.Duration
+	Header  time.Duration
+	Total   time.Duration
+}
+
+// Active returns true if at least one phase is limited
+func (t Timeouts) Active() bool {
+	return t.Connect > 0 || t.TLS > 0 || t.Header > 0 || t.Total > 0
+}
+
+// Merge returns a copy of these timeouts with each non-zero phase from
+// override replacing its counterpart.
+func (t Timeouts) Merge(override Timeouts) Timeouts {
+	if override.Connect > 0 {
+		t.Connect = override.Connect
+	}
+	if override.TLS > 0 {
+		t.TLS = override.TLS
+	}
+	if override.Header > 0 {
+		t.Header = override.Header
+	}
+	if override.Total > 0 {
+		t.Total = override.Total
+	}
+	return t
+}
+
+// FillFromLine takes a line formatted:
+//
+//	param=value param=value
+//
+// and fills itself from the parameters, each of which is a time in
+// milliseconds:
+//
+// * connect: time to establish the TCP connection
+// * tls: time to complete the TLS handshake
+// * header: time from sending the request to the first response byte
+// * total: time for the entire request
+func (t *Timeouts) FillFromLine(line string) error {
+	for _, piece := range strings.Fields(line) {
+		param := strings.SplitN(piece, "=", 2)
+		if len(param) != 2 {
+			return fmt.Errorf("Expected key=value for timeout param, got: %s", piece)
+		}
+		millis, err := strconv.Atoi(strings.TrimSpace(param[1]))
+		if err != nil || millis < 0 {
+			return fmt.Errorf("Expected positive int (ms) for timeout param, got: %s", piece)
+		}
+		d := time.Duration(millis) * time.Millisecond
+		switch strings.ToLower(strings.TrimSpace(param[0])) {
+		case "connect":
+			t.Connect = d
+		case "tls":
+			t.TLS = d
+		case "header":
+			t.Header = d
+		case "total":
+			t.Total = d
+		default:
+			return fmt.Errorf("Unknown timeout param: %s", param[0])
+		}
+	}
+	return nil
+}
+
+func (t Timeouts) String() string {
+	return fmt.Sprintf("{Connect=%d TLS=%d Header=%d Total=%d}",
+		t.Connect/time.Millisecond, t.TLS/time.Millisecond, t.Header/time.Millisecond, t.Total/time.Millisecond)
+}
+
+// TimeoutKind categorizes a result error message as one of the
+// TimeoutKinds, or returns an empty string if it's not a timeout. It
+// recognizes errors from the standard library transport as well as our own.
+func TimeoutKind(msg string) string {
+	switch {
+	case msg == "":
+		return ""
+	case strings.HasSuffix(msg, ErrConnectTimeout.Error()),
+		strings.HasPrefix(msg, "dial") && strings.HasSuffix(msg, "i/o timeout"):
+		return "connect"
+	case strings.HasSuffix(msg, ErrTLSTimeout.Error()),
+		strings.HasSuffix(msg, "TLS handshake timeout"):
+		return "tls"
+	case strings.HasSuffix(msg, ErrHeaderTimeout.Error()),
+		strings.HasSuffix(msg, "timeout awaiting response headers"):
+		return "header"
+	case strings.HasSuffix(msg, ErrTotalTimeout.Error()),
+		strings.Contains(msg, "Client.Timeout exceeded"):
+		return "total"
+	}
+	return ""
+}
+
+// phaseTimer arms a timer at the start of each request phase and cancels
+// the request with the phase's error if it doesn't finish in time. The trace
+// calls it from more than one goroutine, dialing every address of a dual
+// stack host at once say, so the timers are kept under its lock, by phase
+// and, for connections, address.
+type phaseTimer struct {
+	sync.Mutex
+	cancel context.CancelCauseFunc
+	ctx    context.Context
+	phases map[string]*time.Timer // the running phases, by phase
+	timers []*time.Timer
+}
+
+// arm starts timing the phase, unless it isn't limited
+func (pt *phaseTimer) arm(phase string, d time.Duration, cause error) {
+	if d <= 0 {
+		return
+	}
+	pt.Lock()
+	defer pt.Unlock()
+	timer := time.AfterFunc(d, func() { pt.cancel(cause) })
+	if old := pt.phases[phase]; old != nil {
+		old.Stop()
+	}
+	pt.phases[phase] = timer
+	pt.timers = append(pt.timers, timer)
+}
+
+// disarm stops timing the phase, which finished in time
+func (pt *phaseTimer) disarm(phase string) {
+	pt.Lock()
+	defer pt.Unlock()
+	if timer := pt.phases[phase]; timer != nil {
+		timer.Stop()
+		delete(pt.phases, phase)
+	}
+}
+
+// finish stops all timers, releases the request context, and translates
+// an error caused by one of our timeouts into its categorized error.
+func (pt *phaseTimer) finish(err error) error {
+	pt.Lock()
+	for _, timer := range pt.timers {
+		timer.Stop()
+	}
+	pt.Unlock()
+	if err != nil {
+		if cause := context.Cause(pt.ctx); cause != nil && cause != context.Canceled {
+			err = cause
+		}
+	}
+	pt.cancel(nil)
+	return err
+}
+
+// bind returns a copy of the request whose phases are limited by these
+// timeouts, along with the phaseTimer to finish once the request is done.
+func (t Timeouts) bind(req *http.Request) (*http.Request, *phaseTimer) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	pt := &phaseTimer{cancel: cancel, ctx: ctx, phases: map[string]*time.Timer{}}
+	trace := &httptrace.ClientTrace{
+		ConnectStart:         func(_, addr string) { pt.arm("connect "+addr, t.Connect, ErrConnectTimeout) },
+		ConnectDone:          func(_, addr string, _ error) { pt.disarm("connect " + addr) },
+		TLSHandshakeStart:    func() { pt.arm("tls", t.TLS, ErrTLSTimeout) },
+		TLSHandshakeDone:     func(_ tls.ConnectionState, _ error) { pt.disarm("tls") },
+		WroteRequest:         func(_ httptrace.WroteRequestInfo) { pt.arm("header", t.Header, ErrHeaderTimeout) },
+		GotFirstResponseByte: func() { pt.disarm("header") },
+	}
+	pt.arm("total", t.Total, ErrTotalTimeout)
+	return req.WithContext(httptrace.WithClientTrace(ctx, trace)), pt
+}
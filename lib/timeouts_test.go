@@ -0,0 +1,105 @@
+package korra
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTimeoutsFillFromLine(t *testing.T) {
+	var timeouts Timeouts
+	if err := timeouts.FillFromLine("Connect=500 total=2000"); err != nil {
+		t.Fatal(err)
+	}
+	want := Timeouts{Connect: 500 * time.Millisecond, Total: 2 * time.Second}
+	if timeouts != want {
+		t.Fatalf("got: %s, want: %s", timeouts, want)
+	}
+	for _, bad := range []string{"Connect", "Connect=soon", "Eventually=100"} {
+		if err := timeouts.FillFromLine(bad); err == nil {
+			t.Errorf("want error for '%s'", bad)
+		}
+	}
+}
+
+func TestTimeoutsMerge(t *testing.T) {
+	defaults := Timeouts{Connect: time.Second, Total: 10 * time.Second}
+	got := defaults.Merge(Timeouts{Total: time.Second})
+	if want := (Timeouts{Connect: time.Second, Total: time.Second}); got != want {
+		t.Fatalf("got: %s, want: %s", got, want)
+	}
+}
+
+func TestTimeoutKind(t *testing.T) {
+	for msg, want := range map[string]string{
+		"":                                  "",
+		"500 Internal Server Error":         "",
+		ErrConnectTimeout.Error():           "connect",
+		"dial tcp 10.0.0.1:80: i/o timeout": "connect",
+		"net/http: TLS handshake timeout":   "tls",
+		"net/http: timeout awaiting response headers": "header",
+		ErrTotalTimeout.Error():                       "total",
+	} {
+		if got := TimeoutKind(msg); got != want {
+			t.Errorf("%s: got: %s, want: %s", msg, got, want)
+		}
+	}
+}
+
+func TestStepHeaderTimeout(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-time.After(50 * time.Millisecond)
+		}),
+	)
+	defer server.Close()
+	tgt := NewTarget()
+	tgt.Method, tgt.URL = "GET", server.URL
+	tgt.Timeouts.Header = 10 * time.Millisecond
+	atk := NewAttacker(PhaseTimeouts(Timeouts{Header: time.Second}))
+	res := atk.Hit(func() (*Target, error) { return tgt, nil }, time.Now(), 1)
+	if got, want := res.Error, ErrHeaderTimeout.Error(); got != want {
+		t.Fatalf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestPhaseTimerDualStack(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://shop.example:8080/", nil)
+	req, timer := Timeouts{Connect: 20 * time.Millisecond}.bind(req)
+	trace := httptrace.ContextClientTrace(req.Context())
+
+	// a dual stack dial races its addresses, tracing each on its own
+	// goroutine; the one that loses is cancelled
+	var wg sync.WaitGroup
+	for _, addr := range []string{"[::1]:8080", "127.0.0.1:8080"} {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			trace.ConnectStart("tcp", addr)
+			trace.ConnectDone("tcp", addr, nil)
+		}(addr)
+	}
+	wg.Wait()
+	time.Sleep(50 * time.Millisecond)
+	if cause := context.Cause(req.Context()); cause != nil {
+		t.Fatalf("want no timeout once both dials are done, got: %v", cause)
+	}
+	timer.finish(nil)
+
+	// but one address that never connects still times out
+	req, _ = http.NewRequest("GET", "http://shop.example:8080/", nil)
+	req, timer = Timeouts{Connect: 20 * time.Millisecond}.bind(req)
+	trace = httptrace.ContextClientTrace(req.Context())
+	trace.ConnectStart("tcp", "[::1]:8080")
+	trace.ConnectStart("tcp", "127.0.0.1:8080")
+	trace.ConnectDone("tcp", "127.0.0.1:8080", nil)
+	time.Sleep(50 * time.Millisecond)
+	if err := timer.finish(errors.New("context canceled")); err != ErrConnectTimeout {
+		t.Fatalf("want: %v, got: %v", ErrConnectTimeout, err)
+	}
+}
@@ -0,0 +1,193 @@
+package korra
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertificateErrorKinds are the ways a server's certificate can fail to
+// verify that CertificateErrorKind tells apart.
+var CertificateErrorKinds = []string{"expired", "hostname", "untrusted", "invalid"}
+
+// TLSResumption returns a functional option which toggles letting an
+// Attacker resume the TLS sessions of its earlier connections when it opens
+// new ones, as browsers do, rather than making a full handshake every time.
+// Each Attacker keeps its own sessions, like a client of its own would.
+func TLSResumption(enabled bool) func(*Attacker) {
+	return func(a *Attacker) {
+		config := a.tlsConfig()
+		config.ClientSessionCache = nil
+		if enabled {
+			config.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+		}
+	}
+}
+
+// VerifyCertificates returns a functional option which toggles verifying
+// the certificate chain and hostname of every server an Attacker connects
+// to, which DefaultTLSConfig skips. Requests to a server that fails fail
+// with the reason, which CertificateErrorKind categorizes.
+func VerifyCertificates(enabled bool) func(*Attacker) {
+	return func(a *Attacker) {
+		a.tlsConfig().InsecureSkipVerify = !enabled
+	}
+}
+
+// TLSOptions restrict what TLS an Attacker negotiates with servers, to test
+// which configurations they accept and how each holds up under load.
+type TLSOptions struct {
+	MinVersion uint16 // 0 for Go's default
+	MaxVersion uint16 // 0 for Go's default
+	// CipherSuites are the suites offered, nil for Go's default. They only
+	// apply up to TLS 1.2; Go doesn't let TLS 1.3's be chosen.
+	CipherSuites []uint16
+}
+
+// ParseTLSOptions parses the versions, like 1.2, and comma-separated cipher
+// suite names, like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256; any may be empty
+// for Go's default. Cipher suites need a maximum version of 1.2 or below.
+func ParseTLSOptions(min, max, ciphers string) (TLSOptions, error) {
+	var (
+		opts TLSOptions
+		err  error
+	)
+	if opts.MinVersion, err = parseTLSVersion(min); err != nil {
+		return opts, err
+	}
+	if opts.MaxVersion, err = parseTLSVersion(max); err != nil {
+		return opts, err
+	}
+	if opts.MinVersion != 0 && opts.MaxVersion != 0 && opts.MaxVersion < opts.MinVersion {
+		return opts, fmt.Errorf("TLS version %s is below the minimum, %s", max, min)
+	}
+	if ciphers == "" {
+		return opts, nil
+	}
+	if opts.MaxVersion == 0 || opts.MaxVersion > tls.VersionTLS12 {
+		return opts, fmt.Errorf("cipher suites can only be chosen up to TLS 1.2, so a maximum version of 1.2 or below is needed")
+	}
+	suites := map[string]uint16{}
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites[suite.Name] = suite.ID
+	}
+	for _, name := range strings.Split(ciphers, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		id, ok := suites[name]
+		if !ok {
+			return opts, fmt.Errorf("unknown cipher suite '%s'", name)
+		}
+		opts.CipherSuites = append(opts.CipherSuites, id)
+	}
+	return opts, nil
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	if v, ok := tlsVersions[version]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version '%s', expected 1.0, 1.1, 1.2 or 1.3", version)
+}
+
+// String returns the options as versions=min-max ciphers=name,..., with
+// default for whatever is Go's default
+func (o TLSOptions) String() string {
+	version := func(v uint16) string {
+		if v == 0 {
+			return "default"
+		}
+		return strings.TrimPrefix(tls.VersionName(v), "TLS ")
+	}
+	ciphers := "default"
+	if o.CipherSuites != nil {
+		names := make([]string, len(o.CipherSuites))
+		for i, id := range o.CipherSuites {
+			names[i] = tls.CipherSuiteName(id)
+		}
+		ciphers = strings.Join(names, ",")
+	}
+	return fmt.Sprintf("versions=%s-%s ciphers=%s", version(o.MinVersion), version(o.MaxVersion), ciphers)
+}
+
+// RestrictTLS returns a functional option which sets the TLS versions and
+// cipher suites an Attacker offers servers.
+func RestrictTLS(opts TLSOptions) func(*Attacker) {
+	return func(a *Attacker) {
+		config := a.tlsConfig()
+		config.MinVersion, config.MaxVersion, config.CipherSuites = opts.MinVersion, opts.MaxVersion, opts.CipherSuites
+	}
+}
+
+// tlsConfig gives the Attacker a copy of its TLS config to change, so a
+// config shared with others, like DefaultTLSConfig, is left alone
+func (a *Attacker) tlsConfig() *tls.Config {
+	tr := a.client.Transport.(*http.Transport)
+	config := &tls.Config{}
+	if tr.TLSClientConfig != nil {
+		config = tr.TLSClientConfig.Clone()
+	}
+	tr.TLSClientConfig = config
+	return config
+}
+
+// CertificateErrorKind categorizes a result error message as one of the
+// CertificateErrorKinds, or returns an empty string if the server's
+// certificate didn't fail to verify. Other TLS errors, like a failed
+// handshake, aren't certificate errors.
+func CertificateErrorKind(msg string) string {
+	idx := strings.Index(msg, "x509: ")
+	if idx < 0 {
+		return ""
+	}
+	switch msg = msg[idx:]; {
+	case strings.Contains(msg, "has expired or is not yet valid"):
+		return "expired"
+	case strings.Contains(msg, "certificate is valid for"),
+		strings.Contains(msg, "certificate is not valid for any names"),
+		strings.Contains(msg, "doesn't contain any IP SANs"):
+		return "hostname"
+	case strings.Contains(msg, "signed by unknown authority"):
+		return "untrusted"
+	}
+	return "invalid"
+}
+
+// tlsTrace travels in a request's context so the TLS handshake made when
+// connecting for that request, if there was one, can be recorded in its
+// Result.
+type tlsTrace struct {
+	sync.Mutex
+	start   time.Time
+	latency time.Duration
+	resumed bool
+}
+
+func (t *tlsTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			t.Lock()
+			t.start = time.Now()
+			t.Unlock()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			t.Lock()
+			t.latency = time.Since(t.start)
+			t.resumed = err == nil && state.DidResume
+			t.Unlock()
+		},
+	}
+}
@@ -0,0 +1,120 @@
+package korra
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTLSHandshakes(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	target := &Target{Method: "GET", URL: server.URL}
+	targeter := func() (*Target, error) { return target, nil }
+
+	for _, resume := range []bool{false, true} {
+		attacker := NewAttacker(TLSConfig(&tls.Config{InsecureSkipVerify: true}), TLSResumption(resume))
+		first := attacker.Hit(targeter, time.Now(), 1)
+		if first.Error != "" || first.TLSHandshake <= 0 || first.TLSResumed {
+			t.Fatalf("want a full handshake first, got: %+v", first)
+		}
+		if reused := attacker.Hit(targeter, time.Now(), 1); reused.TLSHandshake != 0 {
+			t.Fatalf("want no handshake on a reused connection, got: %+v", reused)
+		}
+		attacker.FreshConnections(true)
+		fresh := attacker.Hit(targeter, time.Now(), 1)
+		if fresh.TLSHandshake <= 0 || fresh.TLSResumed != resume {
+			t.Fatalf("resume %v; want a handshake resumed only with resumption, got: %+v", resume, fresh)
+		}
+
+		m := NewMetrics(Results{first, fresh})
+		if m.TLS.Handshakes != 2 || m.TLS.Max < m.TLS.P50 {
+			t.Fatalf("bad TLS metrics: %+v", m.TLS)
+		}
+		if want := map[bool]float64{false: 0, true: 0.5}[resume]; m.TLS.Resumption != want {
+			t.Fatalf("resumption; want: %v, got: %v", want, m.TLS.Resumption)
+		}
+	}
+}
+
+func TestCertificateErrors(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	target := &Target{Method: "GET", URL: server.URL}
+	targeter := func() (*Target, error) { return target, nil }
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	for _, tt := range []struct {
+		config *tls.Config
+		verify bool
+		kind   string
+	}{
+		{&tls.Config{}, false, ""},
+		{&tls.Config{}, true, "untrusted"},
+		{&tls.Config{RootCAs: roots, ServerName: "wrong.test"}, true, "hostname"},
+		{&tls.Config{RootCAs: roots}, true, ""},
+	} {
+		attacker := NewAttacker(TLSConfig(tt.config), VerifyCertificates(tt.verify))
+		result := attacker.Hit(targeter, time.Now(), 1)
+		if got := CertificateErrorKind(result.Error); got != tt.kind {
+			t.Fatalf("verify %v; want: %q, got: %q from %q", tt.verify, tt.kind, got, result.Error)
+		}
+		if m := NewMetrics(Results{result}); tt.kind != "" && m.CertificateErrors[tt.kind] != 1 {
+			t.Fatalf("want the %s error counted, got: %v", tt.kind, m.CertificateErrors)
+		}
+	}
+
+	for msg, want := range map[string]string{
+		"Get \"https://a.test\": tls: failed to verify certificate: x509: certificate has expired or is not yet valid: current time is after": "expired",
+		"Get \"https://a.test\": x509: certificate is not valid for any names, but wanted to match a.test":                                    "hostname",
+		"Get \"https://a.test\": tls: failed to verify certificate: x509: certificate specifies an incompatible key usage":                    "invalid",
+		"Get \"https://a.test\": remote error: tls: handshake failure":                                                                        "",
+	} {
+		if got := CertificateErrorKind(msg); got != want {
+			t.Errorf("%s; want: %q, got: %q", msg, want, got)
+		}
+	}
+}
+
+func TestRestrictTLS(t *testing.T) {
+	negotiated := make(chan tls.ConnectionState, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		negotiated <- *r.TLS
+	}))
+	defer server.Close()
+	target := &Target{Method: "GET", URL: server.URL}
+
+	opts, err := ParseTLSOptions("1.2", "1.2", "tls_ecdhe_rsa_with_aes_128_gcm_sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "versions=1.2-1.2 ciphers=TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"; opts.String() != want {
+		t.Fatalf("want: %s, got: %s", want, opts)
+	}
+	attacker := NewAttacker(TLSConfig(&tls.Config{InsecureSkipVerify: true}), RestrictTLS(opts))
+	if result := attacker.Hit(func() (*Target, error) { return target, nil }, time.Now(), 1); result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	state := <-negotiated
+	if state.Version != tls.VersionTLS12 || state.CipherSuite != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Fatalf("negotiated %s with %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	}
+
+	if opts, err = ParseTLSOptions("", "", ""); err != nil || opts.String() != "versions=default-default ciphers=default" {
+		t.Fatalf("want the defaults, got: %s, %v", opts, err)
+	}
+	for _, bad := range [][3]string{
+		{"1.4", "", ""},
+		{"1.3", "1.2", ""},
+		{"", "", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		{"", "1.2", "TLS_NOT_A_SUITE"},
+	} {
+		if _, err := ParseTLSOptions(bad[0], bad[1], bad[2]); err == nil {
+			t.Errorf("%q; want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package korra
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceFile is the name of the file sampled requests are traced to by
+// default, in the directory of sessions, next to their results
+const TraceFile = "trace.log"
+
+// Tracer writes the whole of every Nth HTTP request sent by the Attackers
+// sharing it, and the response to it, headers and the start of the bodies,
+// so what went over the wire during a run can be looked at without a proxy
+// in the way. It's safe to share between every session at once.
+type Tracer struct {
+	Every   int      // trace every this many requests
+	Secrets *Secrets // redacted from every trace
+
+	mu   sync.Mutex
+	file io.WriteCloser
+	sent int64
+}
+
+// NewTracer starts tracing every Nth request to the file, replacing any an
+// earlier attack left
+func NewTracer(name string, every int) (*Tracer, error) {
+	if every < 1 {
+		return nil, fmt.Errorf("trace every %d requests? at least 1", every)
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Tracer{Every: every, file: file}, nil
+}
+
+// Trace returns a functional option which makes an Attacker trace the
+// requests the tracer samples
+func Trace(t *Tracer) func(*Attacker) {
+	return func(a *Attacker) {
+		a.tracer = t
+	}
+}
+
+// sample counts a request, returning its number and whether it's traced
+func (t *Tracer) sample() (int64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	n := atomic.AddInt64(&t.sent, 1)
+	return n, n%int64(t.Every) == 0
+}
+
+// write adds the result of the nth request to the trace, with its dump
+func (t *Tracer) write(n int64, result *Result) {
+	summary := fmt.Sprintf("=== request %d at %s: %d %s %s, %d ms %s", n, result.Timestamp.UTC().Format(time.RFC3339Nano),
+		result.Code, result.Method, result.Path, int64(result.Latency/time.Millisecond), result.Error)
+	entry := fmt.Sprintf("%s\n%s\n\n", strings.TrimSpace(summary), strings.TrimRight(result.dump, "\r\n"))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	io.WriteString(t.file, t.Secrets.Redact(entry))
+}
+
+// Close closes the trace file
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.file.Close()
+}
@@ -0,0 +1,53 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served", r.URL.Path)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	if _, err := NewTracer(filepath.Join(t.TempDir(), TraceFile), 0); err == nil {
+		t.Error("want an error tracing every 0 requests")
+	}
+	name := filepath.Join(t.TempDir(), TraceFile)
+	tracer, err := NewTracer(name, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer.Secrets = NewSecrets()
+	tracer.Secrets.remember("hunter2")
+
+	attacker := NewAttacker(Trace(tracer))
+	for i := 1; i <= 4; i++ {
+		target := &Target{Method: "GET", URL: server.URL + "/item/" + string(rune('0'+i)), Header: http.Header{"X-Token": {"hunter2"}}}
+		result := attacker.Hit(func() (*Target, error) { return target, nil }, time.Now(), 1)
+		if result.dump != "" {
+			t.Errorf("want traces kept out of results without Dumps, got: %s", result.dump)
+		}
+	}
+	if err = tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	trace, _ := os.ReadFile(name)
+	for _, want := range []string{"=== request 2 at ", "GET /item/2 HTTP/1.1", "X-Served: /item/2", "=== request 4 at ", "X-Token: [redacted]"} {
+		if !strings.Contains(string(trace), want) {
+			t.Errorf("want %q in the trace, got:\n%s", want, trace)
+		}
+	}
+	for _, unwanted := range []string{"/item/1", "/item/3", "hunter2"} {
+		if strings.Contains(string(trace), unwanted) {
+			t.Errorf("want no %q in the trace, got:\n%s", unwanted, trace)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package korra
+
+import (
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Transfers returns a functional option which makes an Attacker read every
+// response body to the end, recording when its first and last bytes came
+// (see Result.FirstByte), so downloads can be told apart from the time to
+// answer. Without it only the bodies of steps that save values or check a
+// checksum are read.
+func Transfers(enabled bool) func(*Attacker) {
+	return func(a *Attacker) {
+		a.transfers = enabled
+	}
+}
+
+// firstByteTrace records when the first byte of the response came, since
+// the request's start
+type firstByteTrace struct {
+	sync.Mutex
+	start time.Time
+	at    time.Duration
+}
+
+func (t *firstByteTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			t.Lock()
+			t.at = time.Since(t.start)
+			t.Unlock()
+		},
+	}
+}
+
+func (t *firstByteTrace) firstByte() time.Duration {
+	t.Lock()
+	defer t.Unlock()
+	return t.at
+}
+
+// countingReader counts what's read through it, for the size of a body read
+// to the end
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// TransferRate returns the rate, in bytes per second, the result's body
+// came at between its first and last bytes, or for an FTP or SFTP upload,
+// with no bytes in, went at; or 0 if it wasn't read to the end or came all
+// at once.
+func (r *Result) TransferRate() float64 {
+	if elapsed := r.LastByte - r.FirstByte; r.LastByte > 0 && elapsed > 0 {
+		if r.BytesIn == 0 {
+			return float64(r.BytesOut) / elapsed.Seconds()
+		}
+		return float64(r.BytesIn) / elapsed.Seconds()
+	}
+	return 0
+}
+
+// DurationStats summarizes a distribution of durations
+type DurationStats struct {
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"50th"`
+	P95  time.Duration `json:"95th"`
+	P99  time.Duration `json:"99th"`
+	Max  time.Duration `json:"max"`
+}
+
+// transferShard is what a metrics shard adds up the transfers from
+type transferShard struct {
+	firstBytes, lastBytes, rates quantiles
+	firstByte, lastByte          time.Duration
+	rate                         float64
+	rated                        uint64
+}
+
+func newTransferShard(count int) *transferShard {
+	return &transferShard{firstBytes: newQuantiles(count, 0), lastBytes: newQuantiles(count, 0), rates: newQuantiles(count, 0)}
+}
+
+// add counts the result towards the transfers if its body was read to the
+// end
+func (ts *transferShard) add(m *Metrics, result *Result, w int) {
+	if result.LastByte == 0 {
+		return
+	}
+	t := &m.Transfers
+	t.Responses += uint64(w)
+	ts.firstByte += result.FirstByte * time.Duration(w)
+	ts.lastByte += result.LastByte * time.Duration(w)
+	for i := 0; i < w; i++ {
+		ts.firstBytes.Insert(float64(result.FirstByte))
+		ts.lastBytes.Insert(float64(result.LastByte))
+	}
+	if result.FirstByte > t.FirstByte.Max {
+		t.FirstByte.Max = result.FirstByte
+	}
+	if result.LastByte > t.LastByte.Max {
+		t.LastByte.Max = result.LastByte
+	}
+	if rate := result.TransferRate(); rate > 0 {
+		ts.rated += uint64(w)
+		ts.rate += rate * float64(w)
+		for i := 0; i < w; i++ {
+			ts.rates.Insert(rate)
+		}
+		if t.Rate.Min == 0 || rate < t.Rate.Min {
+			t.Rate.Min = rate
+		}
+		if rate > t.Rate.Max {
+			t.Rate.Max = rate
+		}
+	}
+}
+
+func (ts *transferShard) merge(m, om *Metrics, o *transferShard) {
+	t, ot := &m.Transfers, &om.Transfers
+	ts.firstBytes.merge(o.firstBytes)
+	ts.lastBytes.merge(o.lastBytes)
+	ts.rates.merge(o.rates)
+	ts.firstByte += o.firstByte
+	ts.lastByte += o.lastByte
+	ts.rate += o.rate
+	ts.rated += o.rated
+	t.Responses += ot.Responses
+	if ot.FirstByte.Max > t.FirstByte.Max {
+		t.FirstByte.Max = ot.FirstByte.Max
+	}
+	if ot.LastByte.Max > t.LastByte.Max {
+		t.LastByte.Max = ot.LastByte.Max
+	}
+	if ot.Rate.Min > 0 && (t.Rate.Min == 0 || ot.Rate.Min < t.Rate.Min) {
+		t.Rate.Min = ot.Rate.Min
+	}
+	if ot.Rate.Max > t.Rate.Max {
+		t.Rate.Max = ot.Rate.Max
+	}
+}
+
+// finish computes the means and percentiles of the transfers
+func (ts *transferShard) finish(m *Metrics) {
+	t := &m.Transfers
+	if t.Responses == 0 {
+		return
+	}
+	t.FirstByte.Mean = time.Duration(float64(ts.firstByte) / float64(t.Responses))
+	t.LastByte.Mean = time.Duration(float64(ts.lastByte) / float64(t.Responses))
+	for _, stats := range []struct {
+		d *DurationStats
+		q quantiles
+	}{{&t.FirstByte, ts.firstBytes}, {&t.LastByte, ts.lastBytes}} {
+		stats.d.P50 = time.Duration(stats.q.Query(0.50))
+		stats.d.P95 = time.Duration(stats.q.Query(0.95))
+		stats.d.P99 = time.Duration(stats.q.Query(0.99))
+	}
+	if ts.rated > 0 {
+		t.Rate.Mean = ts.rate / float64(ts.rated)
+		t.Rate.P50 = ts.rates.Query(0.50)
+	}
+}
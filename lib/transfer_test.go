@@ -0,0 +1,55 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransfers(t *testing.T) {
+	chunk := strings.Repeat("x", 32*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		for i := 0; i < 4; i++ {
+			w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	target := &Target{Method: "GET", URL: server.URL}
+	targeter := func() (*Target, error) { return target, nil }
+
+	if result := NewAttacker().Hit(targeter, time.Now(), 1); result.LastByte != 0 || result.BytesIn != 0 {
+		t.Fatalf("want no transfer recorded without Transfers, got: %+v", result)
+	}
+	attacker := NewAttacker(Transfers(true))
+	var results Results
+	for i := 0; i < 3; i++ {
+		result := attacker.Hit(targeter, time.Now(), 1)
+		if result.Error != "" {
+			t.Fatal(result.Error)
+		}
+		if result.FirstByte < 20*time.Millisecond || result.LastByte < result.FirstByte+30*time.Millisecond {
+			t.Fatalf("want the first byte after 20ms and the last 30ms after it, got: %s, %s", result.FirstByte, result.LastByte)
+		}
+		if result.BytesIn != uint64(4*len(chunk)) || result.TransferRate() <= 0 {
+			t.Fatalf("want every byte counted and a rate, got: %d, %f", result.BytesIn, result.TransferRate())
+		}
+		results = append(results, result)
+	}
+
+	m := NewMetrics(results)
+	tr := m.Transfers
+	if tr.Responses != 3 || tr.FirstByte.Mean <= 0 || tr.LastByte.P50 < tr.FirstByte.P50 || tr.LastByte.Max < tr.LastByte.P99 {
+		t.Fatalf("bad transfer metrics: %+v", tr)
+	}
+	if tr.Rate.Min <= 0 || tr.Rate.Min > tr.Rate.P50 || tr.Rate.P50 > tr.Rate.Max {
+		t.Fatalf("bad transfer rates: %+v", tr.Rate)
+	}
+	if got := formatRate(1.5 * 1024 * 1024); got != "1.50MB/s" {
+		t.Fatalf("want 1.50MB/s, got: %s", got)
+	}
+}
@@ -0,0 +1,111 @@
+package korra
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// tuneHeadroom is how much more than the rate asked for the generator
+	// is tuned to manage, so it keeps up with slower responses, GC pauses
+	// and the like
+	tuneHeadroom = 1.5
+	// tuneMaxBuffer is the most results a session buffers
+	tuneMaxBuffer = 1024
+)
+
+// Benchmark measures how many requests a second this host can generate and
+// record, with workers each sending requests one after another with an
+// Attacker of their own, as sessions do, for the duration. The requests go
+// to a server on the loopback interface answering with an empty 200, which
+// runs on the same CPUs, so the measure is on the low side.
+func Benchmark(workers int, d time.Duration) (float64, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	target := &Target{Method: "GET", URL: "http://" + listener.Addr().String() + "/benchmark"}
+	targeter := func() (*Target, error) { return target, nil }
+	var (
+		sent int64
+		wg   sync.WaitGroup
+		stop = make(chan struct{})
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attacker, enc := NewAttacker(), gob.NewEncoder(io.Discard)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				enc.Encode(attacker.Hit(targeter, time.Now(), 1))
+				atomic.AddInt64(&sent, 1)
+			}
+		}()
+	}
+	began := time.Now()
+	time.Sleep(d)
+	close(stop)
+	wg.Wait()
+	return float64(atomic.LoadInt64(&sent)) / time.Since(began).Seconds(), nil
+}
+
+// Tuning is how the generator is set up to reach a rate, from what
+// Benchmark measured of it
+type Tuning struct {
+	Rate     float64 // requests a second asked for
+	Capacity float64 // requests a second the generator managed
+	CPUs     int     // to run on, as -cpus
+	Buffer   int     // results each session buffers on their way to its file
+}
+
+// Enough returns true if the generator measured enough, with headroom, to
+// reach the rate
+func (t Tuning) Enough() bool {
+	return t.Rate*tuneHeadroom <= t.Capacity
+}
+
+// Tune works out the CPUs and buffers for sessions to reach the rate
+// between them, given the capacity measured on cpus: the CPUs the rate
+// needs with headroom, at least two so recording never waits on sending,
+// and a buffer of a second of each session's results, so a slow disk
+// holds up no request.
+func Tune(rate float64, sessions int, capacity float64, cpus int) Tuning {
+	tuning := Tuning{Rate: rate, Capacity: capacity, CPUs: cpus, Buffer: tuneMaxBuffer}
+	if capacity > 0 {
+		need := int(math.Ceil(rate * tuneHeadroom / (capacity / float64(cpus))))
+		if need < 2 {
+			need = 2
+		}
+		if need < cpus {
+			tuning.CPUs = need
+		}
+	}
+	if sessions > 0 {
+		if buffer := int(math.Ceil(rate / float64(sessions))); buffer < tuneMaxBuffer {
+			tuning.Buffer = buffer
+		}
+	}
+	return tuning
+}
+
+// TuneWorkers is how many workers Benchmark is run with: enough to keep
+// every CPU busy while others wait on the loopback
+func TuneWorkers() int {
+	return 4 * runtime.GOMAXPROCS(0)
+}
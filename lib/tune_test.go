@@ -0,0 +1,62 @@
+package korra
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTune(t *testing.T) {
+	tuning := Tune(1000, 100, 8000, 8)
+	if tuning.CPUs != 2 || tuning.Buffer != 10 || !tuning.Enough() {
+		t.Errorf("want 2 CPUs and 10 results buffered, with enough capacity, got %+v", tuning)
+	}
+	tuning = Tune(6000, 10, 8000, 8)
+	if tuning.CPUs != 8 || tuning.Buffer != 600 || tuning.Enough() {
+		t.Errorf("want every CPU and 600 results buffered, without enough capacity, got %+v", tuning)
+	}
+	if tuning = Tune(50000, 1, 8000, 4); tuning.CPUs != 4 || tuning.Buffer != tuneMaxBuffer {
+		t.Errorf("want no more than 4 CPUs and the most results buffered, got %+v", tuning)
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	rate, err := Benchmark(2, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate <= 0 {
+		t.Errorf("want a rate, got %f", rate)
+	}
+}
+
+func TestBufferResults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	script := filepath.Join(t.TempDir(), "shopper.txt")
+	raw := strings.ReplaceAll("GET {}/one\nGET {}/two\nGET {}/three\n", "{}", server.URL)
+	if err := os.WriteFile(script, []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+	log := make(chan string, 100)
+	session, err := NewSession(script, nil, log, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.LogOnly = true
+	session.BufferResults(10)
+	session.Run(log)
+	recorded := 0
+	for len(log) > 0 {
+		if strings.Contains(<-log, "200 => GET") {
+			recorded++
+		}
+	}
+	if recorded != 3 {
+		t.Errorf("want every buffered result recorded, got %d", recorded)
+	}
+}
@@ -1,12 +1,11 @@
 package korra
 
 import (
-	"bufio"
 	"strings"
 	"testing"
 )
 
-func TestScanTargetsToChunks(t *testing.T) {
+func TestScanActionsToChunks(t *testing.T) {
 	raw := `
 GET /foo/bar
 Header:Value
@@ -19,24 +18,26 @@ POST /buzzer
 Header:Bees
 Header-Two:Honey
 @path/to/hive
-=> PAUSE 12345
+PAUSE 12345
 HEAD /foos
 `
 	expected := []string{
 		"GET /foo/bar\nHeader:Value",
 		"POST /foo/bar/baz\nHeader:Value\nHeader-Two:Value\n@path/to/body",
 		"POST /buzzer\nHeader:Bees\nHeader-Two:Honey\n@path/to/hive",
-		"=> PAUSE 12345",
+		"PAUSE 12345",
 		"HEAD /foos",
 	}
-	scanner := bufio.NewScanner(strings.NewReader(raw))
-	chunks := ScanTargetsToChunks(peekingScanner{src: scanner})
-	if len(expected) != len(chunks) {
-		t.Fatalf("Expected %d chunks, got %d", len(expected), len(chunks))
+	actions, err := ScanActions(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) != len(actions) {
+		t.Fatalf("Expected %d chunks, got %d", len(expected), len(actions))
 	}
 	for idx, want := range expected {
-		if want != chunks[idx] {
-			t.Fatalf("Chunk %d; expected %s, got %s", idx, want, chunks[idx])
+		if want != actions[idx].Raw {
+			t.Fatalf("Chunk %d; expected %s, got %s", idx, want, actions[idx].Raw)
 		}
 	}
 }
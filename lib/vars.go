@@ -0,0 +1,173 @@
+package korra
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// VarsFeed is the name vars are referenced by in scripts, as ${vars.name},
+// so no feed or store may have it
+const VarsFeed = "vars"
+
+// The operations of a VarStep
+const (
+	VarSet   = "SET"   // sets the var to the value
+	VarSetNX = "SETNX" // sets the var to the value unless it has one
+	VarIncr  = "INCR"  // adds the value, an integer (1 if none), to the var
+	VarAwait = "AWAIT" // waits until the var has a value
+)
+
+// Vars are values shared by every session of an attack, so one session can
+// tell others about something it did, like the id of what it created. Each
+// operation is atomic.
+type Vars struct {
+	sync.Mutex
+	values  map[string]string
+	changed chan struct{} // closed, and replaced, whenever a value changes
+}
+
+func NewVars() *Vars {
+	return &Vars{values: map[string]string{}, changed: make(chan struct{})}
+}
+
+// Get returns the var's value and whether it has one
+func (v *Vars) Get(name string) (string, bool) {
+	v.Lock()
+	defer v.Unlock()
+	value, ok := v.values[name]
+	return value, ok
+}
+
+// Set sets the var to the value
+func (v *Vars) Set(name, value string) {
+	v.Lock()
+	defer v.Unlock()
+	v.set(name, value)
+}
+
+// SetNX sets the var to the value unless it already has one, returning
+// whether it did
+func (v *Vars) SetNX(name, value string) bool {
+	v.Lock()
+	defer v.Unlock()
+	if _, ok := v.values[name]; ok {
+		return false
+	}
+	v.set(name, value)
+	return true
+}
+
+// Incr adds the delta to the var, which counts as 0 without a value,
+// returning its new value; it's an error if the var isn't an integer.
+func (v *Vars) Incr(name string, delta int64) (int64, error) {
+	v.Lock()
+	defer v.Unlock()
+	var current int64
+	if value, ok := v.values[name]; ok {
+		var err error
+		if current, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return 0, fmt.Errorf("var %s is '%s', not an integer", name, value)
+		}
+	}
+	current += delta
+	v.set(name, strconv.FormatInt(current, 10))
+	return current, nil
+}
+
+// Await blocks until the var has a value or abort is closed, returning the
+// value and whether it has one
+func (v *Vars) Await(name string, abort <-chan struct{}) (string, bool) {
+	for {
+		v.Lock()
+		value, ok := v.values[name]
+		changed := v.changed
+		v.Unlock()
+		if ok {
+			return value, true
+		}
+		select {
+		case <-changed:
+		case <-abort:
+			return "", false
+		}
+	}
+}
+
+// references returns every var's value keyed as it's referenced in scripts
+// ("vars.name"), or nil for nil Vars
+func (v *Vars) references() map[string]string {
+	if v == nil {
+		return nil
+	}
+	v.Lock()
+	defer v.Unlock()
+	refs := make(map[string]string, len(v.values))
+	for name, value := range v.values {
+		refs[VarsFeed+"."+name] = value
+	}
+	return refs
+}
+
+// set sets the var and wakes those awaiting a change; the caller holds the
+// lock
+func (v *Vars) set(name, value string) {
+	v.values[name] = value
+	close(v.changed)
+	v.changed = make(chan struct{})
+}
+
+// VarStep is a script step operating on one of the Vars
+type VarStep struct {
+	Op    string // one of VarSet, VarSetNX, VarIncr or VarAwait
+	Name  string
+	Value string // for VarSet and VarSetNX, may reference feeds and vars
+	Delta int64  // for VarIncr
+}
+
+// ParseVarStep parses a step like SET name value, SETNX name value,
+// INCR name [delta] or AWAIT name
+func ParseVarStep(line string) (*VarStep, error) {
+	tokens := strings.Fields(line)
+	if len(tokens) < 2 || !feedName.MatchString(tokens[1]) {
+		return nil, fmt.Errorf("Expected a var name (letters, digits and _) after %s", tokens[0])
+	}
+	step := &VarStep{Op: tokens[0], Name: tokens[1]}
+	switch step.Op {
+	case VarSet, VarSetNX:
+		if len(tokens) < 3 {
+			return nil, fmt.Errorf("Expected a value to %s %s to", step.Op, step.Name)
+		}
+		rest := strings.TrimSpace(strings.TrimSpace(line)[len(step.Op):])
+		step.Value = strings.TrimSpace(rest[len(step.Name):])
+	case VarIncr:
+		step.Delta = 1
+		if len(tokens) == 3 {
+			delta, err := strconv.ParseInt(tokens[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Expected an integer to INCR %s by, got '%s'", step.Name, tokens[2])
+			}
+			step.Delta = delta
+		} else if len(tokens) > 3 {
+			return nil, fmt.Errorf("Expected at most an integer after INCR %s", step.Name)
+		}
+	case VarAwait:
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("Expected only a var name after AWAIT")
+		}
+	default:
+		return nil, fmt.Errorf("Unknown var operation %s", step.Op)
+	}
+	return step, nil
+}
+
+func (step *VarStep) String() string {
+	switch step.Op {
+	case VarSet, VarSetNX:
+		return fmt.Sprintf("%s %s %s", step.Op, step.Name, step.Value)
+	case VarIncr:
+		return fmt.Sprintf("%s %s %d", step.Op, step.Name, step.Delta)
+	}
+	return fmt.Sprintf("%s %s", step.Op, step.Name)
+}
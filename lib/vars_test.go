@@ -0,0 +1,114 @@
+package korra
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVarsAtomic(t *testing.T) {
+	vars := NewVars()
+	var wg sync.WaitGroup
+	won := make(chan string, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := vars.Incr("count", 2); err != nil {
+				t.Error(err)
+			}
+			if vars.SetNX("owner", strings.Repeat("x", i+1)) {
+				won <- "won"
+			}
+		}(i)
+	}
+	wg.Wait()
+	if count, _ := vars.Get("count"); count != "100" {
+		t.Fatalf("want 50 increments of 2, got: %s", count)
+	}
+	if len(won) != 1 {
+		t.Fatalf("want exactly one SETNX to win, got %d", len(won))
+	}
+	vars.Set("name", "korra")
+	if _, err := vars.Incr("name", 1); err == nil {
+		t.Fatal("want an error incrementing a string")
+	}
+
+	got := make(chan string)
+	go func() {
+		value, _ := vars.Await("ready", nil)
+		got <- value
+	}()
+	select {
+	case <-got:
+		t.Fatal("want AWAIT to wait for a value")
+	case <-time.After(10 * time.Millisecond):
+	}
+	vars.Set("ready", "yes")
+	if value := <-got; value != "yes" {
+		t.Fatalf("want the awaited value, got: %s", value)
+	}
+	abort := make(chan struct{})
+	close(abort)
+	if _, ok := vars.Await("never", abort); ok {
+		t.Fatal("want an aborted AWAIT to give up")
+	}
+}
+
+func TestParseVarStep(t *testing.T) {
+	for line, want := range map[string]VarStep{
+		"SET region  eu west":    {Op: VarSet, Name: "region", Value: "eu west"},
+		"SETNX owner ${acct.id}": {Op: VarSetNX, Name: "owner", Value: "${acct.id}"},
+		"INCR created":           {Op: VarIncr, Name: "created", Delta: 1},
+		"INCR created -3":        {Op: VarIncr, Name: "created", Delta: -3},
+		"AWAIT order":            {Op: VarAwait, Name: "order"},
+	} {
+		step, err := ParseVarStep(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *step != want {
+			t.Errorf("%s; want: %+v, got: %+v", line, want, *step)
+		}
+	}
+	for _, bad := range []string{"SET", "SET region", "SET a-b c", "INCR n x", "INCR n 1 2", "AWAIT a b"} {
+		if _, err := ParseVarStep(bad); err == nil {
+			t.Errorf("want an error for '%s'", bad)
+		}
+	}
+}
+
+func TestSessionVars(t *testing.T) {
+	actions, err := ScanActions(strings.NewReader("FEED accounts\nSET greeting hi ${accounts.name}\nINCR seen\nAWAIT greeting\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 4 {
+		t.Fatalf("want 4 actions, got %d", len(actions))
+	}
+	for _, action := range actions[1:] {
+		if err := action.CreateTarget("."); err != nil || !action.Target.IsVar() {
+			t.Fatalf("want a var step from %q: %v", action.Raw, err)
+		}
+	}
+
+	vars := NewVars()
+	session := &Session{Vars: vars, aborted: make(chan struct{}), values: map[string]string{"accounts.name": "bolin"}}
+	for _, action := range actions[1:] {
+		session.doVar(action.Target.Var)
+	}
+	if greeting, _ := vars.Get("greeting"); greeting != "hi bolin" {
+		t.Fatalf("want the feed value in the var, got: %s", greeting)
+	}
+	target := &Target{Method: "GET", URL: "http://shop/${vars.greeting}/${vars.seen}/${accounts.name}"}
+	bound, ok := session.bind(target)
+	if !ok || bound.URL != "http://shop/hi bolin/1/bolin" {
+		t.Fatalf("want vars and feed values bound, got: %s", bound.URL)
+	}
+
+	session.save(&Result{saved: map[string]map[string]string{VarsFeed: {"token": "abc"}}})
+	if token, _ := vars.Get("token"); token != "abc" {
+		t.Fatalf("want a save into vars to set it, got: %s", token)
+	}
+}
@@ -0,0 +1,156 @@
+package korra
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// webhookEvent is every field of the events WebhookAnnotations understands,
+// which are read from whichever the event has
+type webhookEvent struct {
+	// korra's own, as the control API takes them
+	Text      string    `json:"text"`
+	By        string    `json:"by"`
+	Timestamp time.Time `json:"timestamp"`
+	// Grafana's annotations: the time in milliseconds since the epoch
+	Time int64    `json:"time"`
+	Tags []string `json:"tags"`
+	// GitHub's deployment and deployment_status events
+	Deployment *struct {
+		Ref         string `json:"ref"`
+		Environment string `json:"environment"`
+	} `json:"deployment"`
+	DeploymentStatus *struct {
+		State       string `json:"state"`
+		Environment string `json:"environment"`
+	} `json:"deployment_status"`
+	Repository *struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	// Alertmanager's, with an alert for each firing or resolved
+	Alerts []struct {
+		Status      string            `json:"status"`
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+		StartsAt    time.Time         `json:"startsAt"`
+		EndsAt      time.Time         `json:"endsAt"`
+	} `json:"alerts"`
+	// and anything else that says what happened
+	Message     string `json:"message"`
+	Title       string `json:"title"`
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	Source      string `json:"source"`
+}
+
+// WebhookAnnotations turns an event another system posted, like a deploy
+// pipeline or a chaos tool, into annotations of the attack, by the sender
+// if it doesn't say. It understands:
+//
+//   - korra's own: {"text": ..., "by": ..., "timestamp": ...}
+//   - Grafana's annotations: {"text": ..., "tags": [...], "time": ms}
+//   - GitHub's deployment and deployment_status events
+//   - Alertmanager's, with an annotation for each alert
+//   - anything else with a message, title, summary or description
+//
+// An annotation's time is now unless the event says when it happened.
+func WebhookAnnotations(body []byte, header http.Header, sender string) ([]Annotation, error) {
+	var event webhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("bad event: %s", err)
+	}
+	by := firstOf(event.By, event.Source, sender)
+	at := event.Timestamp
+	if at.IsZero() && event.Time > 0 {
+		at = time.Unix(0, event.Time*int64(time.Millisecond))
+	}
+	if kind := header.Get("X-GitHub-Event"); kind == "deployment" || kind == "deployment_status" {
+		return githubAnnotations(kind, &event, at, by)
+	}
+	if len(event.Alerts) > 0 {
+		var annotations []Annotation
+		for _, alert := range event.Alerts {
+			text := firstOf(alert.Annotations["summary"], alert.Annotations["description"], alert.Labels["alertname"])
+			if text == "" {
+				continue
+			}
+			when := alert.StartsAt
+			if alert.Status == "resolved" {
+				when = alert.EndsAt
+			}
+			annotations = append(annotations, Annotation{Timestamp: when, By: firstOf(event.By, "alertmanager"),
+				Text: fmt.Sprintf("alert %s: %s", firstOf(alert.Status, "firing"), text)})
+		}
+		if len(annotations) == 0 {
+			return nil, fmt.Errorf("no alert says what it's about")
+		}
+		return annotations, nil
+	}
+	text := firstOf(event.Text, event.Message, event.Title, event.Summary, event.Description)
+	if text == "" {
+		return nil, fmt.Errorf("event has no text, message, title, summary or description")
+	}
+	if len(event.Tags) > 0 {
+		text = fmt.Sprintf("%s [%s]", text, strings.Join(event.Tags, ", "))
+	}
+	return []Annotation{{Timestamp: at, Text: text, By: by}}, nil
+}
+
+// githubAnnotations describes a GitHub deployment, or a change in one's
+// status, like "deployed v2.3 to production: success"
+func githubAnnotations(kind string, event *webhookEvent, at time.Time, by string) ([]Annotation, error) {
+	if event.Deployment == nil {
+		return nil, fmt.Errorf("%s event has no deployment", kind)
+	}
+	if event.Repository != nil && event.Repository.FullName != "" {
+		by = "github " + event.Repository.FullName
+	}
+	d := event.Deployment
+	text := fmt.Sprintf("deploying %s to %s", d.Ref, d.Environment)
+	if kind == "deployment_status" {
+		if event.DeploymentStatus == nil {
+			return nil, fmt.Errorf("%s event has no status", kind)
+		}
+		text = fmt.Sprintf("deployed %s to %s: %s", d.Ref, firstOf(event.DeploymentStatus.Environment, d.Environment),
+			event.DeploymentStatus.State)
+	}
+	return []Annotation{{Timestamp: at, Text: text, By: by}}, nil
+}
+
+// WebhookAuthorized returns true if the request carries the secret: as a
+// bearer token, or as the key of the SHA-256 HMAC of the body GitHub and
+// others sign their webhooks with, in X-Hub-Signature-256. With no secret
+// every request is.
+func WebhookAuthorized(secret string, header http.Header, body []byte) bool {
+	if secret == "" {
+		return true
+	}
+	if token := strings.TrimPrefix(header.Get("Authorization"), "Bearer "); token != header.Get("Authorization") {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+	signature := strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+	sent, err := hex.DecodeString(signature)
+	if err != nil || signature == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sent, mac.Sum(nil))
+}
+
+// firstOf returns the first of the values that isn't empty
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package korra
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWebhookAnnotations(t *testing.T) {
+	deployed := time.Date(2026, 10, 15, 15, 47, 2, 0, time.UTC)
+	for _, test := range []struct {
+		body, event string
+		want        []Annotation
+	}{
+		{`{"text": "deployed v2.3", "by": "ci", "timestamp": "2026-10-15T15:47:02Z"}`, "",
+			[]Annotation{{Timestamp: deployed, Text: "deployed v2.3", By: "ci"}}},
+		{`{"text": "killed node-3", "tags": ["chaos", "db"], "time": 1792079222000}`, "",
+			[]Annotation{{Timestamp: deployed, Text: "killed node-3 [chaos, db]", By: "sender"}}},
+		{`{"message": "pod-kill experiment started", "source": "litmus"}`, "",
+			[]Annotation{{Text: "pod-kill experiment started", By: "litmus"}}},
+		{`{"deployment": {"ref": "v2.3", "environment": "production"}, "repository": {"full_name": "shop/api"}}`, "deployment",
+			[]Annotation{{Text: "deploying v2.3 to production", By: "github shop/api"}}},
+		{`{"deployment_status": {"state": "success"}, "deployment": {"ref": "v2.3", "environment": "production"}}`, "deployment_status",
+			[]Annotation{{Text: "deployed v2.3 to production: success", By: "sender"}}},
+		{`{"alerts": [{"status": "firing", "labels": {"alertname": "HighLatency"}, "startsAt": "2026-10-15T15:47:02Z"},
+			{"status": "resolved", "annotations": {"summary": "disk full"}, "endsAt": "2026-10-15T15:47:02Z"}]}`, "",
+			[]Annotation{{Timestamp: deployed, Text: "alert firing: HighLatency", By: "alertmanager"},
+				{Timestamp: deployed, Text: "alert resolved: disk full", By: "alertmanager"}}},
+	} {
+		header := http.Header{}
+		if test.event != "" {
+			header.Set("X-GitHub-Event", test.event)
+		}
+		got, err := WebhookAnnotations([]byte(test.body), header, "sender")
+		if err != nil {
+			t.Fatalf("%s: %s", test.body, err)
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("%s: want %d annotations, got: %+v", test.body, len(test.want), got)
+		}
+		for i, a := range got {
+			if want := test.want[i]; a.Text != want.Text || a.By != want.By || !a.Timestamp.Equal(want.Timestamp) {
+				t.Errorf("%s: want %+v, got %+v", test.body, want, a)
+			}
+		}
+	}
+	for _, bad := range []string{`not json`, `{"tags": ["a"]}`, `{"alerts": [{"status": "firing"}]}`} {
+		if _, err := WebhookAnnotations([]byte(bad), http.Header{}, "sender"); err == nil {
+			t.Errorf("want an error for %s", bad)
+		}
+	}
+	if _, err := WebhookAnnotations([]byte(`{"zen": "hi"}`), http.Header{"X-Github-Event": {"deployment"}}, "sender"); err == nil {
+		t.Error("want an error for a deployment event without a deployment")
+	}
+}
+
+func TestWebhookAuthorized(t *testing.T) {
+	body := []byte(`{"text": "deployed v2.3"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	signed := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, test := range []struct {
+		secret string
+		header http.Header
+		want   bool
+	}{
+		{"", http.Header{}, true},
+		{"s3cret", http.Header{}, false},
+		{"s3cret", http.Header{"Authorization": {"Bearer s3cret"}}, true},
+		{"s3cret", http.Header{"Authorization": {"Bearer wrong"}}, false},
+		{"s3cret", http.Header{"X-Hub-Signature-256": {signed}}, true},
+		{"s3cret", http.Header{"X-Hub-Signature-256": {"sha256=00ff"}}, false},
+		{"s3cret", http.Header{"X-Hub-Signature-256": {"sha256=nothex"}}, false},
+	} {
+		if got := WebhookAuthorized(test.secret, test.header, body); got != test.want {
+			t.Errorf("secret %q with %v: want %t, got %t", test.secret, test.header, test.want, got)
+		}
+	}
+}
@@ -10,10 +10,21 @@ import (
 
 func main() {
 	commands := map[string]command{
-		"dump":     dumpCmd(),
-		"report":   reportCmd(),
-		"sessions": sessionsCmd(),
-		"validate": validateCmd(),
+		"annotate":   annotateCmd(),
+		"bundle":     bundleCmd(),
+		"convert":    convertCmd(),
+		"debug":      debugCmd(),
+		"downsample": downsampleCmd(),
+		"dump":       dumpCmd(),
+		"env":        envCmd(),
+		"estimate":   estimateCmd(),
+		"grpc":       grpcCmd(),
+		"inspect":    inspectCmd(),
+		"report":     reportCmd(),
+		"schedule":   scheduleCmd(),
+		"sessions":   sessionsCmd(),
+		"tail":       tailCmd(),
+		"validate":   validateCmd(),
 	}
 
 	flag.Usage = func() {
@@ -23,7 +34,7 @@ func main() {
 			cmd.fs.PrintDefaults()
 		}
 		fmt.Printf("\nglobal flags:\n  -cpus=%d Number of CPUs to use\n", runtime.NumCPU())
-		fmt.Println(examples)
+		fmt.Print(examples)
 	}
 
 	cpus := flag.Int("cpus", runtime.NumCPU(), "Number of CPUs to use")
@@ -47,8 +58,22 @@ func main() {
 const examples = `
 examples:
   korra sessions -dir=path/to/sessions > overall-status.log
+  korra sessions -dir=path/to/sessions -start-at=02:30
+  korra debug -feed=users=users.csv path/to/sessions/user_1.txt
+  korra estimate -dir=path/to/sessions -latency=250ms -response-size=10KB
+  korra annotate -control=localhost:9911 -by=deploy deployed v2.3
+  korra bundle -dir=path/to/sessions -sign=team.key -out=suite.kor
+  korra sessions -dir=suite.kor -bundle-key=team.pub
+  korra env -dir=path/to/sessions sessions -dir=path/to/sessions
+  korra schedule -cron='30 2 * * 1-5' sessions -dir=path/to/sessions
+  korra grpc -target=grpc://localhost:50051 -methods=shop.Cart/AddItem
+  korra inspect path/to/results/user_4512.bin
+  korra tail -every=10s path/to/results/user_4512.bin
+  korra downsample -window=1m -input=path/to/results/user_4512.bin -output=archive/user_4512.bin
+  korra convert -from=json -to=gob -input=archive/user_4512.json -output=path/to/results/user_4512.bin
   korra report -inputs='path/to/results/12*.bin' -reporter=json > metrics.json
   korra report -inputs='path/to/results' -reporter=text 
+  korra report -reporter=text host1/results/*.bin host2/results/*.bin
 `
 
 type command struct {
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignal and resumeSignal pause and resume a running attack
+var pauseSignal, resumeSignal os.Signal = syscall.SIGUSR1, syscall.SIGUSR2
@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// pauseSignal and resumeSignal don't exist on Windows, so pausing and
+// resuming is only available from the control API
+var pauseSignal, resumeSignal os.Signal
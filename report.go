@@ -2,11 +2,14 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,78 +19,190 @@ import (
 )
 
 type reportOpts struct {
-	filters  string
-	inputs   string
-	output   string
-	reporter string
-	showurls bool
-	urlf     string
+	anomalies time.Duration
+	byHeader  string
+	byTarget  bool
+	cacheHdr  string
+	correlate time.Duration
+	files     []string // given as arguments, which take the place of inputs
+	filters   string
+	histLog   bool
+	histUni   bool
+	inputs    string
+	little    bool
+	noColor   bool
+	notesf    string // of annotations
+	output    string
+	reporter  string
+	scrapef   string        // of the target's metrics
+	scrapeWin time.Duration // to report them over
+	showurls  bool
+	slo       float64
+	slowest   int
+	stages    string
+	template  string
+	timeline  time.Duration
+	urlf      string
 }
 
 func reportCmd() command {
 	opts := &reportOpts{}
 
 	fs := flag.NewFlagSet("korra report", flag.ExitOnError)
+	fs.DurationVar(&opts.anomalies, "anomalies", 0, "Width of the windows to look for latency anomalies in, like 1s; 0 for none (0*)")
+	fs.StringVar(&opts.byHeader, "by-header", "", "Response header recorded with -record-headers naming the instance that served each result, like X-Served-By, to report on each instance")
+	fs.BoolVar(&opts.byTarget, "by-target", false, "If true also report on the results for each target base URL (false*)")
+	fs.StringVar(&opts.cacheHdr, "cache-header", "", "Response header recorded with -record-headers to split latencies into cache hits and misses by, like X-Cache")
+	fs.DurationVar(&opts.correlate, "correlate", 0, "Width of the windows to correlate error rates with latency over, like 10s; 0 for none (0*)")
 	fs.StringVar(&opts.filters, "filters", "", "One or more space-separated filters to operate on subsets of the inputs")
+	fs.BoolVar(&opts.histLog, "hist-log", false, "If true scale histogram bars by the log of their counts (false*)")
+	fs.BoolVar(&opts.histUni, "hist-unicode", false, "If true draw histogram bars with unicode blocks, eight steps to a character (false*)")
 	fs.StringVar(&opts.inputs, "inputs", ".", "Input files (comma separated, glob, or dir with .bin files; cwd*)")
+	fs.BoolVar(&opts.little, "little", false, "If true check the requests in flight against Little's Law (false*)")
+	fs.StringVar(&opts.notesf, "annotations", "", "File of annotations made during the attack; otherwise those next to the result files, if any")
+	fs.BoolVar(&opts.noColor, "no-color", false, "If true never color the text report, which is otherwise colored when written to a terminal (false*)")
 	fs.StringVar(&opts.output, "output", "stdout", "Report output destination (stdout*)")
-	fs.StringVar(&opts.reporter, "reporter", "text", "Reporter [text*, json, plot, dump, hist[buckets]]")
+	fs.StringVar(&opts.reporter, "reporter", "text", "Reporter [text*, json, plot, dump, hist[buckets], sizehist[buckets], knee[window]]")
+	fs.StringVar(&opts.scrapef, "scrapes", "", "File of the target's metrics scraped during the attack with sessions -scrape; otherwise those next to the result files, if any")
+	fs.DurationVar(&opts.scrapeWin, "scrape-window", defaultScrapeWindow, "Width of the windows to report the target's scraped metrics over next to latency; 0 for none (1m*)")
 	fs.BoolVar(&opts.showurls, "show-urls", false, "If true show all URLs in bucket -- may be long! (false*)")
+	fs.Float64Var(&opts.slo, "slo", 0, "Success percentage to report each section's error budget burn rate against, like 99.9; 0 for none (0*)")
+	fs.IntVar(&opts.slowest, "slowest", 0, "Number of the slowest requests to list for each bucket (0*)")
+	fs.StringVar(&opts.stages, "stages", "", "Lengths of the attack's stages to report on each of, from its first result, like 2m,5m or warmup=2m,busy=5m")
+	fs.StringVar(&opts.template, "template", "", "Go template file to write the report with instead of a reporter")
+	fs.DurationVar(&opts.timeline, "timeline", 0, "Width of the windows to trace each section's status classes over, and when failures started and stopped, like 10s; 0 for none (0*)")
 	fs.StringVar(&opts.urlf, "urls", "", "File from which I should read URL patterns for analysis; if not given I'll infer them from the results")
 
 	return command{fs, func(args []string) error {
 		fs.Parse(args)
+		opts.files = fs.Args()
 		return report(opts)
 	}}
 }
 
+// defaultScrapeWindow is how wide the windows the target's scraped metrics
+// are reported over are, unless -scrape-window says
+const defaultScrapeWindow = time.Minute
+
 func chooseReporter(opts *reportOpts) (korra.Reporter, error) {
-	var err error
-	switch opts.reporter {
-	case "text":
-		if opts.urlf == "" {
-			return korra.TextReporter{ShowUrls: opts.showurls}, nil
-		}
-		var in io.Reader
-		if in, err = korra.File(opts.urlf, false); err != nil {
-			return nil, fmt.Errorf("bad URL pattern file: '%s'", err)
-		}
-		urls := make([]string, 0)
-		scanner := bufio.NewScanner(in)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
-			urls = append(urls, line)
+	sections := korra.SectionOptions{Slowest: opts.slowest, AnomalyWindow: opts.anomalies, CorrelationWindow: opts.correlate, LittlesLaw: opts.little, TimelineWindow: opts.timeline, ScrapeWindow: opts.scrapeWin}
+	if opts.slo < 0 || opts.slo >= 100 {
+		return nil, fmt.Errorf("bad -slo: %g, want a percentage below 100", opts.slo)
+	}
+	sections.SLO = opts.slo / 100
+	if opts.cacheHdr != "" {
+		sections.CacheHeader = http.CanonicalHeaderKey(opts.cacheHdr)
+	}
+	if opts.byHeader != "" {
+		sections.InstanceHeader = http.CanonicalHeaderKey(opts.byHeader)
+	}
+	if opts.stages != "" {
+		stages, err := korra.ParseStages(opts.stages)
+		if err != nil {
+			return nil, fmt.Errorf("bad -stages: %s", err)
+		}
+		sections.Stages = stages
+	}
+	if opts.template != "" {
+		tmpl, err := korra.ReadTemplate(opts.template)
+		if err != nil {
+			return nil, fmt.Errorf("bad template: %s", err)
+		}
+		buckets, err := readBuckets(opts.urlf)
+		if err != nil {
+			return nil, err
 		}
-		buckets := korra.BucketCollection{}
-		if err = buckets.CreateBucketsFromSpecs(urls); err != nil {
+		return korra.TemplateReporter{Template: tmpl, Collection: buckets, SectionOptions: sections}, nil
+	}
+	style := korra.HistogramStyle{Log: opts.histLog, Unicode: opts.histUni}
+	// histogram reporters carry their buckets, like hist[0,10ms,100ms]
+	name := opts.reporter
+	if idx := strings.Index(name, "["); idx >= 0 {
+		name = name[:idx]
+	}
+	switch name {
+	case "text":
+		buckets, err := readBuckets(opts.urlf)
+		if err != nil {
 			return nil, err
 		}
-		return korra.TextReporter{Collection: buckets, ShowUrls: opts.showurls}, nil
+		return korra.TextReporter{ByTarget: opts.byTarget, Collection: buckets, ShowUrls: opts.showurls, SectionOptions: sections}, nil
 	case "json":
-		return korra.ReportJSON, nil
+		buckets, err := readBuckets(opts.urlf)
+		if err != nil {
+			return nil, err
+		}
+		return korra.JSONReporter{Collection: buckets, SectionOptions: sections}, nil
 	case "hist":
 		if len(opts.reporter) < 6 {
 			return nil, fmt.Errorf("bad buckets: '%s'", opts.reporter[4:])
 		}
+		if spec := opts.reporter[4:]; strings.HasPrefix(spec, "[quantile:") && strings.HasSuffix(spec, "]") {
+			count, err := strconv.Atoi(spec[10 : len(spec)-1])
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("bad buckets: '%s'", spec)
+			}
+			return korra.QuantileHistogramReporter(count).Styled(style), nil
+		}
 		var hist korra.HistogramReporter
 		if err := hist.Set(opts.reporter[4:len(opts.reporter)]); err != nil {
 			return nil, err
 		}
-		return hist, nil
+		return hist.Styled(style), nil
+	case "knee":
+		if name == opts.reporter {
+			return korra.DefaultKneeWindow, nil
+		}
+		spec := opts.reporter[4:]
+		window, err := time.ParseDuration(strings.Trim(spec, "[]"))
+		if err != nil || window <= 0 || !strings.HasSuffix(spec, "]") {
+			return nil, fmt.Errorf("bad window: '%s'", spec)
+		}
+		return korra.KneeReporter(window), nil
+	case "sizehist":
+		if len(opts.reporter) < 10 {
+			return nil, fmt.Errorf("bad buckets: '%s'", opts.reporter[8:])
+		}
+		var hist korra.SizeHistogramReporter
+		if err := hist.Set(opts.reporter[8:]); err != nil {
+			return nil, err
+		}
+		return hist.Styled(style), nil
 	}
 
 	return nil, fmt.Errorf("unknown reporter: %s", opts.reporter)
 }
 
+// readBuckets reads the URL patterns to group results by from the file,
+// one per line; with no file the buckets are inferred from the results
+func readBuckets(urlf string) (korra.BucketCollection, error) {
+	buckets := korra.BucketCollection{}
+	if urlf == "" {
+		return buckets, nil
+	}
+	in, err := korra.File(urlf, false)
+	if err != nil {
+		return buckets, fmt.Errorf("bad URL pattern file: '%s'", err)
+	}
+	urls := make([]string, 0)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	err = buckets.CreateBucketsFromSpecs(urls)
+	return buckets, err
+}
+
 // report validates the report arguments, sets up the required resources
 // and writes the report
 func report(opts *reportOpts) error {
 	var (
 		err error
-		in  *os.File
+		in  io.ReadCloser
 		out *os.File
 		rep korra.Reporter
 	)
@@ -95,9 +210,15 @@ func report(opts *reportOpts) error {
 		return err
 	}
 	files := korra.GlobResults(opts.inputs)
+	if len(opts.files) > 0 {
+		files = nil
+		for _, arg := range opts.files {
+			files = append(files, korra.GlobResults(arg)...)
+		}
+	}
 	srcs := make([]io.Reader, len(files))
 	for i, f := range files {
-		if in, err = korra.File(f, false); err != nil {
+		if in, err = korra.OpenResults(f); err != nil {
 			return err
 		}
 		defer in.Close()
@@ -107,9 +228,22 @@ func report(opts *reportOpts) error {
 		return err
 	}
 	defer out.Close()
+	metadata, err := readMetadata(files)
+	if err != nil {
+		return err
+	}
+	annotations, err := readAnnotations(opts.notesf, files)
+	if err != nil {
+		return err
+	}
+	scrapes, err := readScrapes(opts.scrapef, files)
+	if err != nil {
+		return err
+	}
+	rep = describeAttack(rep, metadata, annotations, scrapes, !opts.noColor && korra.IsTerminal(out))
 
 	var results korra.Results
-	res, errs := korra.Collect(srcs...)
+	res, errs := korra.MergeResults(srcs...)
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt)
 
@@ -118,20 +252,29 @@ outer:
 		select {
 		case _ = <-sig:
 			break outer
-		case r, ok := <-res:
+		case batch, ok := <-res:
 			if !ok {
 				break outer
 			}
-			results = append(results, r)
+			results = append(results, batch...)
 		case err, ok := <-errs:
 			if !ok {
 				break outer
 			}
-			return err
+			// a file of a run that was cut short still has the results
+			// recorded before it was, so report on those
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Reporting on the results recorded before: %s\n", err)
 		}
 	}
 
-	sort.Sort(results)
+	// merged they're in order unless a file wasn't, which is rare enough
+	// that checking is cheaper than sorting every time
+	if !sort.IsSorted(results) {
+		sort.Sort(results)
+	}
 
 	results = filterResults(results, opts.filters)
 	data, err := rep.Report(results)
@@ -142,6 +285,107 @@ outer:
 	return err
 }
 
+// describeAttack gives the reporters that describe the attack its metadata,
+// annotations and the target's scraped metrics, and the text reporter
+// whether to color its report
+func describeAttack(rep korra.Reporter, metadata *korra.AttackMetadata, annotations korra.Annotations, scrapes []korra.ScrapeSample, color bool) korra.Reporter {
+	switch chosen := rep.(type) {
+	case korra.TextReporter:
+		chosen.Color = color
+		chosen.Metadata = metadata
+		chosen.Annotations = annotations
+		chosen.Scrapes = scrapes
+		return chosen
+	case korra.JSONReporter:
+		chosen.Metadata = metadata
+		chosen.Annotations = annotations
+		chosen.Scrapes = scrapes
+		return chosen
+	case korra.TemplateReporter:
+		chosen.Metadata = metadata
+		chosen.Annotations = annotations
+		chosen.Scrapes = scrapes
+		return chosen
+	}
+	return rep
+}
+
+// readMetadata summarizes the metadata at the start of each result file
+func readMetadata(files []string) (*korra.AttackMetadata, error) {
+	all := make([]*korra.Metadata, 0, len(files))
+	for _, f := range files {
+		in, err := korra.File(f, false)
+		if err != nil {
+			return nil, err
+		}
+		m, err := korra.ReadMetadata(in)
+		in.Close()
+		if err != nil {
+			return nil, fmt.Errorf("bad result file %s: %s", f, err)
+		}
+		all = append(all, m)
+	}
+	return korra.SummarizeMetadata(all), nil
+}
+
+// besideResults returns the file if given, or else the files at the path of
+// the directory of each result file that exist
+func besideResults(file string, results []string, pathIn func(dir string) string) []string {
+	if file != "" {
+		return []string{file}
+	}
+	var files []string
+	seen := map[string]bool{}
+	for _, result := range results {
+		path := pathIn(filepath.Dir(result))
+		if _, err := os.Stat(path); err == nil && !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// readAnnotations reads the annotations in the file, or without one those
+// written next to any of the result files, in time order
+func readAnnotations(file string, results []string) (korra.Annotations, error) {
+	var all korra.Annotations
+	for _, f := range besideResults(file, results, korra.AnnotationsPath) {
+		in, err := korra.File(f, false)
+		if err != nil {
+			return nil, err
+		}
+		annotations, err := korra.ReadAnnotations(in)
+		in.Close()
+		if err != nil {
+			return nil, fmt.Errorf("bad annotations file %s: %s", f, err)
+		}
+		all = append(all, annotations...)
+	}
+	sort.Stable(all)
+	return all, nil
+}
+
+// readScrapes reads the target's metrics scraped into the file, or without
+// one those scraped next to any of the result files, in time order
+func readScrapes(file string, results []string) ([]korra.ScrapeSample, error) {
+	var all []korra.ScrapeSample
+	for _, f := range besideResults(file, results, korra.ScrapesPath) {
+		in, err := korra.File(f, false)
+		if err != nil {
+			return nil, err
+		}
+		samples, err := korra.ReadScrapes(in)
+		in.Close()
+		if err != nil {
+			return nil, fmt.Errorf("bad scrapes file %s: %s", f, err)
+		}
+		all = append(all, samples...)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Timestamp.Before(all[j].Timestamp) })
+	return all, nil
+}
+
 func filterResults(results korra.Results, filters string) korra.Results {
 	trimmed := strings.TrimSpace(filters)
 	if trimmed == "" {
@@ -195,6 +439,10 @@ func newFilterGroup(filterSpecs string, results korra.Results) ResultFilterGroup
 			group.filters = append(group.filters, func(result *korra.Result) bool {
 				return strings.Contains(result.Path, pieces[1])
 			})
+		case "Target":
+			group.filters = append(group.filters, func(result *korra.Result) bool {
+				return strings.Contains(result.Target, pieces[1])
+			})
 		// Examples:
 		//    Time=1m  => Include results from start to 1 minute after start
 		//    Time=-1m  => (same as above)
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+type scheduleOpts struct {
+	cron string
+	runs int
+}
+
+func scheduleCmd() command {
+	fs := flag.NewFlagSet("korra schedule", flag.ExitOnError)
+	opts := &scheduleOpts{}
+	fs.StringVar(&opts.cron, "cron", "", "Cron schedule (minute hour day-of-month month day-of-week) to run the command on")
+	fs.IntVar(&opts.runs, "runs", 0, "Number of runs before exiting, 0 runs until interrupted")
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		return schedule(opts, fs.Args())
+	}}
+}
+
+var errNoScheduledCommand = errors.New("give the command to schedule after the schedule options, like: korra schedule -cron='0 2 * * *' sessions -dir=scripts")
+
+// schedule runs the korra command in args every time the schedule comes
+// around, each run in its own process so none shares state with another.
+// A run that's still going when its next time comes around skips that time.
+func schedule(opts *scheduleOpts, args []string) error {
+	if len(args) == 0 {
+		return errNoScheduledCommand
+	}
+	sched, err := korra.ParseSchedule(opts.cron)
+	if err != nil {
+		return err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+
+	for run := 1; opts.runs == 0 || run <= opts.runs; run++ {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("schedule '%s' never comes around", opts.cron)
+		}
+		log.Printf("Run %d scheduled for %s: korra %s", run, next.Format(time.RFC3339), strings.Join(args, " "))
+		select {
+		case <-interrupted:
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+
+		// an interrupt reaches the run too, so let it finish up before we quit
+		cmd := exec.Command(self, args...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		finished := make(chan error, 1)
+		go func() { finished <- cmd.Wait() }()
+		select {
+		case err = <-finished:
+		case <-interrupted:
+			err = <-finished
+			log.Printf("Run %d interrupted: %v", run, err)
+			return nil
+		}
+		if err != nil {
+			log.Printf("Run %d failed: %s", run, err)
+		} else {
+			log.Printf("Run %d complete", run)
+		}
+		if skipped := sched.Next(next); skipped.Before(time.Now()) {
+			log.Printf("Run %d ran past %s, skipping to the next time after now", run, skipped.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
@@ -10,8 +10,14 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,44 +31,193 @@ func sessionsCmd() command {
 		headers: headers{http.Header{}},
 		laddr:   localAddr{&korra.DefaultLocalAddr},
 	}
+	opts.dns.Pins = map[string]string{}
+	opts.feeds = feeds{}
+	opts.secrets = secretSources{korra.NewSecrets(), map[string]string{}}
 
+	fs.Float64Var(&opts.abandonment.Chance, "abandon", 0, "Percentage chance a session's user gives up after each step, skipping to its ON_END steps")
+	fs.IntVar(&opts.assets, "assets", 0, "Assets (CSS, JS, icons and images) of HTML pages to fetch at once, as a browser would; 0 fetches none")
+	fs.Int64Var(&opts.conditions.Bandwidth, "bandwidth", 0, "Simulated client bandwidth in bytes/sec, 0 is unlimited")
+	fs.StringVar(&opts.bundleKey, "bundle-key", "", "Ed25519 public key file (PEM) a bundle given as -dir must be signed with")
+	fs.IntVar(&opts.captures, "capture-failures", 0, "Failed HTTP requests to write packet captures (pcap) of the connections of, into captures in -dir; 0 captures none")
 	fs.StringVar(&opts.certf, "cert", "", "x509 Certificate file")
-	fs.StringVar(&opts.sessiond, "dir", ".", "Directory of sessions")
+	fs.BoolVar(&opts.clientCache, "client-cache", false, "Remember ETag/Last-Modified per URL and send conditional requests")
+	fs.StringVar(&opts.clock, "clock", korra.WallClock, "Clock to timestamp results by: wall, monotonic (the start plus the monotonic time since, immune to NTP steps) or both (wall, recording the monotonic time too)")
+	fs.StringVar(&opts.clockSync, "clock-sync", "", "NTP server (host or host:port) to measure the clock against, correcting timestamps by the offset, so every host of a distributed run lines up")
+	fs.DurationVar(&opts.timeouts.Connect, "connect-timeout", 0, "Default time allowed to connect, per request")
+	fs.StringVar(&opts.config, "config", "", "YAML file of options for every run and for each -profile; korra.yaml if it's there")
+	fs.StringVar(&opts.controlAddr, "control", "", "Address (host:port) to serve the control API on, for status, pausing and annotations")
+	fs.StringVar(&opts.controlCA, "control-ca", "", "CA certificate file the control API requires clients' certificates to be signed by, with -control-cert")
+	fs.StringVar(&opts.controlCert, "control-cert", "", "Certificate file to serve the control API with TLS, with -control-key")
+	fs.StringVar(&opts.controlKey, "control-key", "", "Private key file for -control-cert")
+	fs.StringVar(&opts.controlToken, "control-token", "", "Bearer token the control API requires of every request")
+	fs.StringVar(&opts.sessiond, "dir", ".", "Directory of sessions, or a bundle of them ending in .kor to check and extract next to itself")
+	fs.Var(dnsPins(opts.dns.Pins), "dns-pin", "Pin host to an address as host=ip, or resolve once at startup with just host")
+	fs.StringVar(&opts.dns.Server, "dns-server", "", "Nameserver (host:port) to resolve with instead of the system's")
+	fs.DurationVar(&opts.dns.TTL, "dns-ttl", 0, "Time to cache DNS answers, 0 disables caching")
+	fs.Var(opts.feeds, "feed", "CSV file of rows for FEED steps as name=path, or name=path:policy with policy stop, recycle or fail")
+	fs.StringVar(&opts.feedPartition, "feed-partition", "1/1", "Partition of the load this node takes, as node/nodes or first-last/nodes for a larger node's share: it uses only its share of every feed's rows, so nodes sharing feeds never share rows, and of every -limits, step limit and -tune rate")
+	fs.StringVar(&opts.fingerprints, "fingerprints", "", "Rotate browser fingerprints (User-Agent and friends) across sessions, as 'all' or name=weight,...")
+	fs.Float64Var(&opts.fuzz, "fuzz", 0, "Percentage of requests to send malformed (duplicate headers, odd chunk sizes, wrong Content-Length) to stress proxies and WAFs")
+	fs.StringVar(&opts.grpc, "grpc", "", "gRPC server (grpc://host:port or grpcs://host:port) to health check and discover before starting")
+	fs.StringVar(&opts.grpcMethods, "grpc-methods", "", "Comma-separated methods (package.Service/Method) the -grpc server must have")
 	fs.Var(&opts.headers, "header", "Request header")
+	fs.DurationVar(&opts.timeouts.Header, "header-timeout", 0, "Default time allowed from sending a request to its first response byte")
+	fs.DurationVar(&opts.conditions.Jitter, "jitter", 0, "Simulated random variance applied to -latency")
 	fs.BoolVar(&opts.keepalive, "keepalive", true, "Use persistent connections")
+	fs.StringVar(&opts.kube.api, "kube", "", "Kubernetes API to watch the target's pods and autoscalers through, annotating the attack with restarts and scaling, like http://localhost:8001 from kubectl proxy, or in-cluster")
+	fs.DurationVar(&opts.kube.every, "kube-every", 5*time.Second, "Interval to poll -kube at")
+	fs.StringVar(&opts.kube.namespace, "kube-namespace", "", "Namespace of the target's pods for -kube; default, or korra's own in-cluster")
+	fs.StringVar(&opts.kube.selector, "kube-selector", "", "Label selector of the target's pods for -kube, like app=api; all in the namespace if not given")
 	fs.Var(&opts.laddr, "laddr", "Local IP address")
+	fs.DurationVar(&opts.conditions.Latency, "latency", 0, "Simulated client latency added to every round trip")
+	fs.StringVar(&opts.limitsf, "limits", "", "File of per-bucket rate and concurrency limits")
 	fs.StringVar(&opts.logf, "log", "stdout", "Overall log")
+	fs.DurationVar(&opts.abandonment.Patience, "patience", 0, "Response time after which a session's user gives up, skipping to its ON_END steps; 0 for never")
+	fs.Var(&opts.pins, "pin", "CPUs to pin sessions to, like 0-7,16-23, or numa for each NUMA node's; repeat to share the sessions out between groups of CPUs (Linux only)")
+	fs.BoolVar(&opts.precheck, "precheck", true, "Request each unique GET/HEAD/OPTIONS bucket once before starting")
+	fs.Float64Var(&opts.precheckMax, "precheck-max-fail", 0, "Percentage of precheck requests that may fail before we abort")
+	fs.BoolVar(&opts.precheckWarn, "precheck-warn", false, "Only warn, rather than abort, when the precheck fails")
+	fs.BoolVar(&opts.preflight, "preflight", true, "Check open file limits, ephemeral ports and conntrack room against the sessions before starting")
+	fs.BoolVar(&opts.preflightWarn, "preflight-warn", false, "Only warn, rather than abort, when the preflight fails")
 	fs.BoolVar(&opts.pretend, "pretend", false, "Do everything but send traffic")
+	fs.StringVar(&opts.profile, "profile", "", "Profile of options in the -config file to run with, like smoke, soak or stress")
+	fs.StringVar(&opts.profilesf, "profiles", "", "File of client profiles (network conditions and headers) to give shares of the sessions")
+	fs.StringVar(&opts.record, "record-headers", "", "Comma-separated response headers to record the values of, like X-Cache,Server, for reports to count")
 	fs.IntVar(&opts.redirects, "redirects", korra.DefaultRedirects, "Number of redirects to follow. -1 will not follow but marks as success")
+	fs.Float64Var(&opts.conditions.ResetRate, "resets", 0, "Percentage of connections to reset before reading the response")
+	fs.StringVar(&opts.scrapeURL, "scrape", "", "Prometheus endpoint of the target, like http://api:9100/metrics, to scrape the -scrape-metrics of while the attack runs, for reports")
+	fs.DurationVar(&opts.scrapeEvery, "scrape-every", 15*time.Second, "Interval to scrape -scrape at")
+	fs.StringVar(&opts.scrapeSeries, "scrape-metrics", "", "Comma-separated metrics to keep from each -scrape, by name or as an exact series, like process_cpu_seconds_total,queue_depth{queue=\"orders\"}")
+	fs.Var(opts.secrets, "secret", "Secret for scripts and the -config file to reference as ${secrets.name}, as name=env:VAR, name=file:path or name=vault:path#key; redacted from logs and results")
+	fs.Int64Var(&opts.seed, "seed", 0, "Seed for every random choice, to replay a run exactly; 0 picks one (and logs it)")
+	fs.DurationVar(&opts.abandonment.Budget, "session-budget", 0, "Time a session may run for, less any time paused, before its user gives up, skipping to its ON_END steps; 0 for never")
+	fs.StringVar(&opts.setupf, "setup", "", "Script to run once before any sessions start; its results are logged, not recorded")
+	fs.BoolVar(&opts.smoke, "smoke", false, "Smoke test the scripts: run each session once, one at a time, taking every CHANCE block, logging every result and the request and response of failures rather than recording them; fails if any step does")
+	fs.DurationVar(&opts.snapshotEvery, "snapshot", 0, "Interval to report on the results so far while the attack runs, like 10m; 0 for never")
+	fs.StringVar(&opts.snapshotDir, "snapshot-dir", "", "Directory to write each -snapshot report to; otherwise only the latest is kept, for the control API")
+	fs.StringVar(&opts.snapshotRep, "snapshot-reporter", "text", "Reporter for -snapshot reports [text*, json]")
+	fs.StringVar(&opts.startAt, "start-at", "", "Wait to start until this time, as RFC 3339 or the next local 15:04")
 	fs.IntVar(&opts.statusSec, "status", 30, "Interval to log overall status, in seconds")
+	fs.StringVar(&opts.teardownf, "teardown", "", "Script to run once after all sessions are done; its results are logged, not recorded")
+	fs.Var(&opts.targets, "target", "Base URL to balance sessions across as url or url=weight, replacing the scheme and host in scripts; repeat for more")
+	fs.Var(&opts.phases, "then", "Directory of sessions to start once every session before it is done, as a later phase; repeat for more")
 	fs.DurationVar(&opts.timeout, "timeout", korra.DefaultTimeout, "Requests timeout")
+	fs.StringVar(&opts.tlsCiphers, "tls-ciphers", "", "Comma-separated cipher suites to offer, like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256; needs -tls-max=1.2 or below")
+	fs.StringVar(&opts.tlsMax, "tls-max", "", "Highest TLS version to negotiate [1.0, 1.1, 1.2, 1.3]")
+	fs.StringVar(&opts.tlsMin, "tls-min", "", "Lowest TLS version to negotiate [1.0, 1.1, 1.2, 1.3]")
+	fs.BoolVar(&opts.tlsResume, "tls-resume", false, "Let each session resume its earlier TLS sessions on new connections, rather than a full handshake for each")
+	fs.DurationVar(&opts.timeouts.TLS, "tls-timeout", 0, "Default time allowed for the TLS handshake, per request")
+	fs.DurationVar(&opts.timeouts.Total, "total-timeout", 0, "Default time allowed for an entire request")
+	fs.StringVar(&opts.traceFile, "trace-file", "", "File to write -trace-sample traces to; trace.log in -dir if not given")
+	fs.IntVar(&opts.traceEvery, "trace-sample", 0, "Trace every Nth HTTP request, writing it and its response (headers and the start of the bodies) to -trace-file; 0 traces none")
+	fs.BoolVar(&opts.transfers, "transfers", false, "Read every response body to the end, recording the time to its first and last bytes and its transfer rate")
+	fs.Float64Var(&opts.tune, "tune", 0, "Requests per second the attack must reach: benchmark this host first, picking -cpus and result buffers to reach it, and warn if it can't; 0 for no tuning")
 	fs.BoolVar(&opts.verbose, "verbose", false, "Verbose logging, show progress from every session")
+	fs.BoolVar(&opts.verifyTLS, "verify-tls", false, "Verify servers' certificates, failing requests to any that don't verify")
+	fs.StringVar(&opts.webhookAddr, "webhook", "", "Address (host:port) to take events from deploy pipelines, chaos tools and alerts on, annotating the attack with them")
+	fs.StringVar(&opts.webhookSecret, "webhook-secret", "", "Secret -webhook events must carry, as a bearer token or the key of an X-Hub-Signature-256 HMAC")
 
 	return command{fs, func(args []string) error {
 		fs.Parse(args)
+		if err := applyConfig(fs, opts.config, opts.profile, opts.secrets.Secrets); err != nil {
+			return err
+		}
+		opts.settings = recordedSettings(fs, opts.secrets.Secrets)
 		return Sessions(opts)
 	}}
 }
 
 var (
-	errBadCert    = errors.New("bad certificate")
-	errMissingDir = errors.New("directory must exist and have at least one .txt file")
-	timeFormat    = "15:04:05.999999"
+	errBadCert        = errors.New("bad certificate")
+	errMissingDir     = errors.New("directory must exist and have at least one .txt file")
+	errSetupFailed    = errors.New("setup script had failures, not starting sessions")
+	errPrecheckFailed = errors.New("precheck failed, not starting sessions (use -precheck-warn to start anyway)")
+	errNoScrapes      = errors.New("give the metrics to keep from each -scrape with -scrape-metrics")
+	errSmokeFailed    = errors.New("smoke test failed")
+	timeFormat        = "15:04:05.999999"
 )
 
 // sessionOpts aggregates the session function command options
 type sessionsOpts struct {
-	certf     string
-	headers   headers
-	keepalive bool
-	laddr     localAddr
-	logf      string
-	pretend   bool
-	redirects int
-	sessiond  string
-	statusSec int
-	timeout   time.Duration
-	verbose   bool
+	abandonment   korra.Abandonment
+	assets        int
+	bundleKey     string
+	captures      int
+	certf         string
+	clientCache   bool
+	clock         string
+	clockSync     string
+	conditions    korra.NetworkConditions
+	config        string
+	controlAddr   string
+	controlCA     string
+	controlCert   string
+	controlKey    string
+	controlToken  string
+	dns           korra.DNSOptions
+	feedPartition string
+	feeds         feeds
+	fingerprints  string
+	fuzz          float64
+	grpc          string
+	grpcMethods   string
+	headers       headers
+	keepalive     bool
+	kube          kubeOpts
+	laddr         localAddr
+	limitsf       string
+	logf          string
+	phases        phaseDirs
+	pins          cpuGroups
+	precheck      bool
+	precheckMax   float64
+	precheckWarn  bool
+	preflight     bool
+	preflightWarn bool
+	pretend       bool
+	profile       string
+	profilesf     string
+	record        string
+	redirects     int
+	scrapeEvery   time.Duration
+	scrapeSeries  string
+	scrapeURL     string
+	secrets       secretSources
+	seed          int64
+	sessiond      string
+	settings      map[string]string
+	setupf        string
+	smoke         bool
+	snapshotDir   string
+	snapshotEvery time.Duration
+	snapshotRep   string
+	startAt       string
+	statusSec     int
+	targets       weightedTargets
+	teardownf     string
+	timeout       time.Duration
+	timeouts      korra.Timeouts
+	traceEvery    int
+	traceFile     string
+	tlsCiphers    string
+	tlsMax        string
+	tlsMin        string
+	tlsResume     bool
+	transfers     bool
+	tune          float64
+	verbose       bool
+	verifyTLS     bool
+	webhookAddr   string
+	webhookSecret string
+}
+
+// kubeOpts are where the target's pods are, for -kube to watch
+type kubeOpts struct {
+	api       string
+	every     time.Duration
+	namespace string
+	selector  string
 }
 
 // sessions validates the arguments, reads in the session scripts and launches
@@ -74,6 +229,7 @@ func Sessions(opts *sessionsOpts) error {
 		err      error
 		sessions []*korra.Session
 		tlsc     *tls.Config
+		tlsOpts  korra.TLSOptions
 	)
 	log := os.Stdout
 	logChan := make(chan string)
@@ -81,89 +237,701 @@ func Sessions(opts *sessionsOpts) error {
 		for {
 			select {
 			case msg := <-o:
-				out := fmt.Sprintf("%s %s\n", time.Now().Format(timeFormat), msg)
+				out := fmt.Sprintf("%s %s\n", time.Now().Format(timeFormat), opts.secrets.Redact(msg))
 				log.Write([]byte(out))
 			}
 		}
 	}(logChan)
 
+	if korra.IsBundle(opts.sessiond) {
+		if err = extractBundle(opts, logChan); err != nil {
+			return err
+		}
+	}
+	if opts.startAt != "" {
+		if err = waitToStart(opts.startAt, logChan); err != nil {
+			return err
+		}
+	}
+	if opts.seed == 0 {
+		opts.seed = time.Now().UnixNano()
+	}
+	if opts.smoke {
+		// every step runs once, to its end, so abandoning any would miss it
+		opts.abandonment = korra.Abandonment{}
+	}
+	logChan <- fmt.Sprintf("Random seed %d (replay with -seed=%d)", opts.seed, opts.seed)
+
 	if tlsc, err = setupTLS(opts.certf); err != nil {
 		return err
 	}
+	if tlsOpts, err = korra.ParseTLSOptions(opts.tlsMin, opts.tlsMax, opts.tlsCiphers); err != nil {
+		return err
+	}
+	if opts.grpc != "" {
+		if err = grpcCheck(opts.grpc, opts.grpcMethods, opts.certf, opts.timeout); err != nil {
+			return err
+		}
+	}
+	if err = korra.PinHosts(opts.dns.Pins); err != nil {
+		return err
+	}
+	partition, err := korra.ParsePartition(opts.feedPartition)
+	if err != nil {
+		return err
+	}
+	feeders, err := readFeeders(opts.feeds, partition)
+	if err != nil {
+		return err
+	}
+	vars, barriers, sitemaps, databases := korra.NewVars(), korra.NewBarriers(), korra.NewSitemaps(), korra.NewDatabases()
+	defer databases.Close()
+	var profiles []*korra.ClientProfile
+	if opts.profilesf != "" {
+		profilesFile, err := korra.File(opts.profilesf, false)
+		if err != nil {
+			return fmt.Errorf("error opening %s: %s", opts.profilesf, err)
+		}
+		defer profilesFile.Close()
+		if profiles, err = korra.ReadProfiles(profilesFile); err != nil {
+			return err
+		}
+	}
+	limiters := korra.NewLimiters()
+	limiters.Seed(korra.SeedFor(opts.seed, "limits"))
+	limiters.Share(partition.Share())
+	if opts.limitsf != "" {
+		limitsFile, err := korra.File(opts.limitsf, false)
+		if err != nil {
+			return fmt.Errorf("error opening %s: %s", opts.limitsf, err)
+		}
+		defer limitsFile.Close()
+		if err = limiters.ReadLimits(limitsFile); err != nil {
+			return err
+		}
+	}
 	clientOptions := []func(*korra.Attacker){
 		korra.Redirects(opts.redirects),
 		korra.Timeout(opts.timeout),
 		korra.LocalAddr(*opts.laddr.IPAddr),
 		korra.TLSConfig(tlsc),
+		korra.TLSResumption(opts.tlsResume),
+		korra.Transfers(opts.transfers),
+		korra.VerifyCertificates(opts.verifyTLS),
+		korra.RestrictTLS(tlsOpts),
+		korra.Fuzz(opts.fuzz),
 		korra.KeepAlive(opts.keepalive),
+		korra.Conditions(opts.conditions),
+		korra.PhaseTimeouts(opts.timeouts),
+		korra.DNS(opts.dns),
+		korra.ClientCache(opts.clientCache),
+		korra.Limits(limiters),
+		korra.Headers(opts.headers.Header),
+	}
+	if opts.record != "" {
+		clientOptions = append(clientOptions, korra.RecordHeaders(strings.Split(opts.record, ",")...))
+	}
+	if opts.smoke {
+		clientOptions = append(clientOptions, korra.Dumps(true))
+	}
+	if opts.captures > 0 {
+		captureDir := filepath.Join(opts.sessiond, korra.CapturesDir)
+		captures, err := korra.NewCaptures(captureDir, opts.captures)
+		if err != nil {
+			return fmt.Errorf("error starting -capture-failures: %s", err)
+		}
+		clientOptions = append(clientOptions, korra.Capture(captures))
+		logChan <- fmt.Sprintf("Capturing up to %d failed requests' connections to %s", opts.captures, captureDir)
+	}
+	clock, err := korra.NewClock(opts.clock)
+	if err != nil {
+		return fmt.Errorf("bad -clock: %s", err)
+	}
+	var clockSync *korra.ClockSync
+	if opts.clockSync != "" {
+		if clockSync, err = korra.SyncClock(opts.clockSync, clockSyncTimeout); err != nil {
+			return fmt.Errorf("error syncing the clock with -clock-sync: %s", err)
+		}
+		clock.Offset = clockSync.Offset
+		logChan <- fmt.Sprintf("Clock is %s; correcting timestamps by it", clockSync)
+	}
+	if len(opts.pins) > 0 {
+		if !korra.CanPin {
+			return errNoPinning
+		}
+		groups := make([]string, len(opts.pins))
+		for idx, group := range opts.pins {
+			if err = korra.CheckPinning(group); err != nil {
+				return err
+			}
+			groups[idx] = group.String()
+		}
+		logChan <- fmt.Sprintf("Pinning sessions to CPUs in turn: %s", strings.Join(groups, "; "))
+	}
+	if opts.traceEvery > 0 {
+		traceFile := opts.traceFile
+		if traceFile == "" {
+			traceFile = filepath.Join(opts.sessiond, korra.TraceFile)
+		}
+		tracer, err := korra.NewTracer(traceFile, opts.traceEvery)
+		if err != nil {
+			return fmt.Errorf("error starting -trace-sample: %s", err)
+		}
+		defer tracer.Close()
+		tracer.Secrets = opts.secrets.Secrets
+		clientOptions = append(clientOptions, korra.Trace(tracer))
+		logChan <- fmt.Sprintf("Tracing every %d requests to %s", opts.traceEvery, traceFile)
 	}
 
 	startTime := time.Now()
 
-	sessionFiles := korra.GlobInputs(fmt.Sprintf("%s/*.txt", opts.sessiond))
-	if sessions, err = readSessions(opts, sessionFiles, clientOptions, logChan); err != nil {
-		return err
+	// each phase's sessions start once every session of the phase before is done
+	var phases [][]*korra.Session
+	for _, dir := range append([]string{opts.sessiond}, opts.phases...) {
+		sessionFiles := excludeFiles(korra.GlobInputs(fmt.Sprintf("%s/*.txt", dir)), opts.setupf, opts.teardownf)
+		phase, err := readSessions(opts, sessionFiles, clientOptions, feeders, vars, barriers, sitemaps, databases, profiles, logChan)
+		if err != nil {
+			return err
+		}
+		phases = append(phases, phase)
+		sessions = append(sessions, phase...)
+	}
+	if opts.preflight && !opts.pretend && !opts.smoke {
+		if err = preflight(opts, phases, logChan); err != nil {
+			return err
+		}
+	}
+	if opts.tune > 0 && !opts.pretend && !opts.smoke {
+		if err = tune(opts.tune*partition.Share(), sessions, logChan); err != nil {
+			return err
+		}
+	}
+	// setup first, since the precheck may need what it creates
+	if opts.teardownf != "" {
+		defer runOnce("Teardown", opts, opts.teardownf, clientOptions, feeders, vars, logChan)
+	}
+	if opts.setupf != "" {
+		if failures, err := runOnce("Setup", opts, opts.setupf, clientOptions, feeders, vars, logChan); err != nil {
+			return err
+		} else if failures > 0 {
+			return errSetupFailed
+		}
+	}
+	if opts.precheck && !opts.pretend && !opts.smoke {
+		if err = precheck(opts, sessions, clientOptions, logChan); err != nil {
+			return err
+		}
+	}
+
+	var (
+		snaps         *snapshots
+		snapshotTicks <-chan time.Time
+	)
+	if opts.snapshotEvery > 0 {
+		if snaps, err = newSnapshots(opts, sessions, logChan); err != nil {
+			return err
+		}
+		ticker := time.NewTicker(opts.snapshotEvery)
+		defer ticker.Stop()
+		snapshotTicks = ticker.C
 	}
 
-	var wg sync.WaitGroup
-	for _, aSession := range sessions {
-		wg.Add(1)
-		go func(session *korra.Session) {
-			defer wg.Done()
-			session.Run(logChan)
-		}(aSession)
+	annotations, err := korra.NewAnnotationLog(opts.sessiond)
+	if err != nil {
+		return fmt.Errorf("error starting annotations: %s", err)
 	}
+	defer annotations.Close()
 
-	// catch completion of all sessions, and from the OS
-	var done = make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt)
+	gate := korra.NewGate()
+	progress := func() attackProgress { return progressOf(sessions, gate, startTime) }
+	if opts.controlAddr != "" {
+		recording := map[string]*korra.Session{}
+		for _, session := range sessions {
+			if !session.LogOnly {
+				recording[session.Name] = session
+			}
+		}
+		controlTLS, err := korra.ControlTLS(opts.controlCert, opts.controlKey, opts.controlCA)
+		if err != nil {
+			return fmt.Errorf("error starting control API: %s", err)
+		}
+		listener, err := serveControl(opts.controlAddr, &control{gate, logChan, progress, snaps.Latest, annotations, recording, opts.controlToken, controlTLS})
+		if err != nil {
+			return err
+		}
+		defer listener.Close()
+	}
+	if opts.webhookAddr != "" {
+		listener, err := serveWebhook(opts.webhookAddr, &webhook{opts.webhookSecret, annotations, logChan})
+		if err != nil {
+			return err
+		}
+		defer listener.Close()
+	}
+	if opts.kube.api != "" {
+		watch, err := korra.NewKubeWatch(opts.kube.api, opts.kube.namespace, opts.kube.selector, opts.kube.every)
+		if err != nil {
+			return fmt.Errorf("error starting -kube: %s", err)
+		}
+		logChan <- fmt.Sprintf("Watching Kubernetes pods in %s every %s", watch.Namespace, watch.Every)
+		stopWatching := make(chan struct{})
+		defer close(stopWatching)
+		go watch.Run(stopWatching, annotations, logChan)
+	}
+	if opts.scrapeURL != "" {
+		scraper, err := newScraper(opts, tlsc, logChan)
+		if err != nil {
+			return err
+		}
+		defer scraper.Close()
+		stopScraping := make(chan struct{})
+		defer close(stopScraping)
+		go scraper.Run(stopScraping, logChan)
+	}
+
+	metadata := korra.NewMetadata(len(sessions), opts.settings)
+	metadata.Started = metadata.Started.Add(clock.Offset)
+	metadata.ClockSync = clockSync
+	metadata.Settings["seed"] = strconv.FormatInt(opts.seed, 10)
+	metadata.Settings["tls"] = fmt.Sprintf("verify=%t %s", opts.verifyTLS, tlsOpts)
+
+	var (
+		wg       sync.WaitGroup
+		previous = make(chan struct{})
+	)
+	close(previous)
+	for idx, phase := range phases {
+		var phaseWg sync.WaitGroup
+		phaseDone := make(chan struct{})
+		// in a smoke test each session waits its turn, after the one before
+		turn := previous
+		for _, aSession := range phase {
+			aSession.Gate = gate
+			aSession.Metadata = metadata
+			aSession.Clock = clock
+			aSession.Annotations = annotations
+			wg.Add(1)
+			phaseWg.Add(1)
+			ran := make(chan struct{})
+			go func(session *korra.Session, previous <-chan struct{}, ran chan struct{}) {
+				defer wg.Done()
+				defer phaseWg.Done()
+				defer close(ran)
+				<-previous
+				session.Run(logChan)
+			}(aSession, turn, ran)
+			if opts.smoke {
+				turn = ran
+			}
+		}
+		go func(idx int, size int, previous <-chan struct{}) {
+			<-previous
+			if idx > 0 {
+				logChan <- fmt.Sprintf("Phase %d: starting %d sessions", idx+1, size)
+			}
+			phaseWg.Wait()
+			close(phaseDone)
+		}(idx, len(phase), previous)
+		previous = phaseDone
+	}
+
+	// catch completion of all sessions, and interrupts from the OS
+	var done = make(chan struct{})
 	go func() {
 		wg.Wait()
-		done <- os.Interrupt
+		close(done)
 	}()
+	var interrupted = make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	var toggled = make(chan os.Signal, 1)
+	if pauseSignal != nil {
+		signal.Notify(toggled, pauseSignal, resumeSignal)
+	}
 
 	for {
 		select {
 		case <-done:
-			for _, session := range sessions {
-				session.Stop() // wait for each session to finish up?
+			if opts.smoke {
+				return smokeSummary(sessions, logChan)
 			}
 			return nil
-		case <-time.After(time.Duration(opts.statusSec) * time.Second):
-			actionCount, actionsDone, sessionsDone := 0, 0, 0
+		case <-interrupted:
+			// give each session the chance to run its ON_END steps
+			logChan <- "Interrupted, stopping sessions once their ON_END steps are done (interrupt again to quit now)"
 			for _, session := range sessions {
-				progress := session.Progress()
-				actionCount += progress.Actions
-				actionsDone += progress.Current
-				if progress.Complete {
-					sessionsDone += 1
-				}
+				session.Stop()
 			}
-			sessionCount := len(sessions)
-			logChan <- fmt.Sprintf("Elapsed %s: %d/%d actions complete (%.2f%%); %d/%d sessions complete (%.2f%%)",
-				time.Since(startTime),
-				actionsDone, actionCount, (float32(actionsDone)/float32(actionCount))*100,
-				sessionsDone, sessionCount, (float32(sessionsDone)/float32(sessionCount))*100)
+			select {
+			case <-done:
+			case <-interrupted:
+			}
+			return nil
+		case sig := <-toggled:
+			setPaused(gate, sig == pauseSignal, fmt.Sprintf("signal %s", sig), logChan)
+		case now := <-snapshotTicks:
+			go snaps.take(now)
+		case <-time.After(time.Duration(opts.statusSec) * time.Second):
+			logChan <- progress().String()
+		}
+	}
+}
+
+// smokeSummary logs which sessions of a smoke test passed and which had
+// failures, failing if any did
+func smokeSummary(sessions []*korra.Session, log chan string) error {
+	failed := 0
+	for _, session := range sessions {
+		if failures := session.Failures(); failures > 0 {
+			failed++
+			log <- fmt.Sprintf("Smoke: %s FAILED, %d failures", session.Name, failures)
+		} else {
+			log <- fmt.Sprintf("Smoke: %s OK", session.Name)
+		}
+	}
+	log <- fmt.Sprintf("Smoke: %d of %d sessions passed", len(sessions)-failed, len(sessions))
+	if failed > 0 {
+		return errSmokeFailed
+	}
+	return nil
+}
+
+// newScraper scrapes the target's metrics into the directory of sessions
+// once run, so reports can put them next to the results
+func newScraper(opts *sessionsOpts, tlsc *tls.Config, log chan string) (*korra.Scraper, error) {
+	if opts.scrapeSeries == "" {
+		return nil, errNoScrapes
+	}
+	var series []string
+	for _, name := range strings.Split(opts.scrapeSeries, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			series = append(series, name)
+		}
+	}
+	scraper, err := korra.NewScraper(opts.sessiond, opts.scrapeURL, series, opts.scrapeEvery, tlsc)
+	if err != nil {
+		return nil, fmt.Errorf("error starting -scrape: %s", err)
+	}
+	log <- fmt.Sprintf("Scraping %s every %s for %s", opts.scrapeURL, opts.scrapeEvery, strings.Join(series, ", "))
+	return scraper, nil
+}
+
+// precheck hits every unique bucket in the session scripts once and logs
+// those that fail, returning an error if too many did to bother starting.
+// With -target every target is checked.
+func precheck(opts *sessionsOpts, sessions []*korra.Session, clientOptions []func(*korra.Attacker), log chan string) error {
+	scripts := make([]*korra.SessionScript, len(sessions))
+	for idx, session := range sessions {
+		scripts[idx] = session.Script
+	}
+	bases := []*url.URL{nil}
+	if len(opts.targets) > 0 {
+		bases = bases[:0]
+		for _, target := range opts.targets {
+			bases = append(bases, target.URL)
+		}
+	}
+	failed := false
+	for _, base := range bases {
+		prefix := "Precheck"
+		checkOptions := clientOptions
+		if base != nil {
+			prefix = fmt.Sprintf("Precheck %s", base)
+			checkOptions = append(append([]func(*korra.Attacker){}, clientOptions...), korra.BaseURL(base))
+		}
+		report := korra.Precheck(scripts, checkOptions)
+		for _, key := range report.Failures {
+			result := report.Results[key]
+			log <- fmt.Sprintf("%s FAIL %s: %d %s", prefix, key, result.Code, result.Error)
+		}
+		for _, key := range report.Skipped {
+			log <- fmt.Sprintf("%s SKIP %s: fills in feed or var values", prefix, key)
+		}
+		log <- fmt.Sprintf("%s%s", prefix, strings.TrimPrefix(report.String(), "Precheck"))
+		failed = failed || report.FailureRate() > opts.precheckMax
+	}
+	if failed {
+		if !opts.precheckWarn {
+			return errPrecheckFailed
+		}
+		log <- "WARNING: precheck failed, starting sessions anyway"
+	}
+	return nil
+}
+
+var errPreflightFailed = errors.New("preflight failed, not starting sessions (use -preflight-warn to start anyway)")
+
+// preflight checks the host can take the largest phase's sessions at once,
+// each with the connections -assets has it open, logging each limit and
+// returning an error if one falls short
+func preflight(opts *sessionsOpts, phases [][]*korra.Session, log chan string) error {
+	load := korra.PreflightLoad{Conns: 1 + opts.assets, KeepAlive: opts.keepalive}
+	for _, phase := range phases {
+		if len(phase) > load.Sessions {
+			load.Sessions = len(phase)
 		}
 	}
+	failed := false
+	for _, check := range korra.Preflight(load) {
+		status := "OK"
+		if !check.OK {
+			status, failed = "FAIL", true
+		}
+		log <- fmt.Sprintf("Preflight %s %s", status, check)
+	}
+	if failed {
+		if !opts.preflightWarn {
+			return errPreflightFailed
+		}
+		log <- "WARNING: preflight failed, starting sessions anyway"
+	}
+	return nil
+}
+
+// clockSyncTimeout is how long -clock-sync waits on each answer
+const clockSyncTimeout = 2 * time.Second
+
+// tuneFor is how long the generator is benchmarked for -tune
+const tuneFor = 2 * time.Second
+
+// tune benchmarks the host and sets up the CPUs and the sessions' buffers
+// to reach the rate, its share of the -tune rate, warning if it can't
+func tune(rate float64, sessions []*korra.Session, log chan string) error {
+	cpus := runtime.GOMAXPROCS(0)
+	capacity, err := korra.Benchmark(korra.TuneWorkers(), tuneFor)
+	if err != nil {
+		return fmt.Errorf("error benchmarking for -tune: %s", err)
+	}
+	tuning := korra.Tune(rate, len(sessions), capacity, cpus)
+	runtime.GOMAXPROCS(tuning.CPUs)
+	for _, session := range sessions {
+		session.BufferResults(tuning.Buffer)
+	}
+	log <- fmt.Sprintf("Tuned for %.0f requests/sec: this host generated %.0f/sec on %d CPUs; running on %d CPUs, buffering %d results per session",
+		tuning.Rate, tuning.Capacity, cpus, tuning.CPUs, tuning.Buffer)
+	if !tuning.Enough() {
+		log <- fmt.Sprintf("WARNING: %.0f requests/sec is more than this host can reliably generate; split the sessions across hosts with -feed-partition, or expect to fall short", tuning.Rate)
+	}
 	return nil
 }
 
-func readSessions(opts *sessionsOpts, sessionFiles []string, clientOptions []func(*korra.Attacker), log chan string) ([]*korra.Session, error) {
+var errInterruptedWaiting = errors.New("interrupted while waiting to start")
+
+// waitToStart blocks until the start time, returning an error if it's not a
+// time or we're interrupted
+func waitToStart(startAt string, log chan string) error {
+	start, err := korra.ParseStartAt(startAt, time.Now())
+	if err != nil {
+		return err
+	}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	defer signal.Stop(interrupted)
+	log <- fmt.Sprintf("Waiting to start at %s (%s from now)", start.Format(time.RFC3339), time.Until(start).Round(time.Second))
+	select {
+	case <-interrupted:
+		return errInterruptedWaiting
+	case <-time.After(time.Until(start)):
+	}
+	return nil
+}
+
+// runOnce runs the script as a single session that logs its results rather
+// than recording them, and waits for it to finish; it returns the number of
+// failed requests.
+func runOnce(phase string, opts *sessionsOpts, scriptFile string, clientOptions []func(*korra.Attacker), feeders korra.Feeders, vars *korra.Vars, log chan string) (int, error) {
+	session, err := korra.NewSession(scriptFile, seeded(clientOptions, opts.seed, phase), log, true)
+	if err != nil {
+		return 0, fmt.Errorf("Error creating %s script %s: %s", strings.ToLower(phase), scriptFile, err)
+	}
+	session.Pretend = opts.pretend
+	session.Feeders = feeders
+	session.Vars = vars
+	session.Secrets = opts.secrets.Secrets
+	session.LogOnly = true
+	log <- fmt.Sprintf("%s: running %s", phase, scriptFile)
+	session.Run(log)
+	log <- fmt.Sprintf("%s: complete with %d failures", phase, session.Failures())
+	return session.Failures(), nil
+}
+
+// excludeFiles returns the files without any of those given to exclude
+func excludeFiles(files []string, exclude ...string) []string {
+	var kept []string
+	for _, file := range files {
+		keep := true
+		for _, excluded := range exclude {
+			if excluded != "" && filepath.Clean(file) == filepath.Clean(excluded) {
+				keep = false
+			}
+		}
+		if keep {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
+
+func readSessions(opts *sessionsOpts, sessionFiles []string, clientOptions []func(*korra.Attacker), feeders korra.Feeders, vars *korra.Vars, barriers *korra.Barriers, sitemaps *korra.Sitemaps, databases *korra.Databases, profiles []*korra.ClientProfile, log chan string) ([]*korra.Session, error) {
 	var err error
 	sessions := make([]*korra.Session, len(sessionFiles))
 	if len(sessionFiles) == 0 {
 		return sessions, errMissingDir
 	}
+	var rotation *korra.FingerprintRotation
+	if opts.fingerprints != "" {
+		if rotation, err = korra.ParseFingerprintRotation(opts.fingerprints); err != nil {
+			return sessions, err
+		}
+	}
+	balancer := korra.NewBalancer(opts.targets)
+	picker := korra.NewProfilePicker(profiles)
+	profiled := map[string]int{}
 	for idx, sessionFile := range sessionFiles {
-		if sessions[idx], err = korra.NewSession(sessionFile, clientOptions, log, opts.verbose); err != nil {
+		sessionOptions := seeded(clientOptions, opts.seed, seedName(opts.sessiond, sessionFile))
+		if base := balancer.Next(); base != nil {
+			sessionOptions = append(sessionOptions, korra.BaseURL(base))
+		}
+		// a profile's headers win over the fingerprint's
+		if rotation != nil {
+			sessionOptions = append(sessionOptions, korra.Headers(rotation.Next().Header))
+		}
+		if profile := picker.Next(); profile != nil {
+			sessionOptions = append(sessionOptions,
+				korra.Conditions(opts.conditions.Merge(profile.Conditions)), korra.Headers(profile.Header))
+			profiled[profile.Name] += 1
+		}
+		if sessions[idx], err = korra.NewSession(sessionFile, sessionOptions, log, opts.verbose); err != nil {
 			return sessions, fmt.Errorf("Error creating session script %s: %s", sessionFile, err)
 		}
 		sessions[idx].Pretend = opts.pretend
+		sessions[idx].LogOnly = opts.smoke
+		sessions[idx].EveryChance = opts.smoke
+		sessions[idx].Abandonment = opts.abandonment
+		sessions[idx].Assets = opts.assets
+		if len(opts.pins) > 0 {
+			sessions[idx].CPUs = opts.pins[idx%len(opts.pins)]
+		}
+		sessions[idx].Feeders = feeders
+		sessions[idx].Vars = vars
+		sessions[idx].Secrets = opts.secrets.Secrets
+		sessions[idx].Barriers = barriers
+		sessions[idx].Sitemaps = sitemaps
+		sessions[idx].Databases = databases
+		for _, store := range sessions[idx].Script.Stores() {
+			if store == korra.SecretsFeed {
+				return sessions, fmt.Errorf("Session script %s saves to %s, which is for -secret values", sessionFile, store)
+			}
+			if feeders[store] == nil {
+				feeders[store] = korra.NewStore(store)
+			} else if !feeders[store].IsStore() {
+				return sessions, fmt.Errorf("Session script %s saves to %s, but that's a -feed", sessionFile, store)
+			}
+		}
+	}
+	// a session may claim rows saved by another in the same phase or before
+	for idx, session := range sessions {
+		for _, feed := range session.Script.Feeds() {
+			if feeders[feed] == nil {
+				return sessions, fmt.Errorf("Session script %s uses feed %s, but no -feed names it", sessionFiles[idx], feed)
+			}
+		}
+	}
+	for _, profile := range profiles {
+		log <- fmt.Sprintf("Profile %s: %d of %d sessions", profile, profiled[profile.Name], len(sessions))
 	}
 	return sessions, nil
 }
 
+// unrecordedFlags are the flags left out of the metadata in result files,
+// since their values may hold secrets like Authorization headers
+var unrecordedFlags = map[string]bool{"control-token": true, "header": true, "webhook-secret": true}
+
+// recordedSettings returns the flags that were set on the command line, by
+// name, for the metadata in result files, with any secrets' values redacted
+func recordedSettings(fs *flag.FlagSet, secrets *korra.Secrets) map[string]string {
+	settings := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		if !unrecordedFlags[f.Name] {
+			settings[f.Name] = secrets.Redact(f.Value.String())
+		}
+	})
+	return settings
+}
+
+// seeded returns the client options plus a seed for the named session,
+// derived from the seed for the whole run
+func seeded(clientOptions []func(*korra.Attacker), seed int64, name string) []func(*korra.Attacker) {
+	opts := make([]func(*korra.Attacker), 0, len(clientOptions)+1)
+	opts = append(opts, clientOptions...)
+	return append(opts, korra.Seed(korra.SeedFor(seed, name)))
+}
+
+// seedName names a session file for its seed by its path relative to the
+// sessions directory, so files with the same name in different phase
+// directories get different sequences
+func seedName(root, sessionFile string) string {
+	if rel, err := filepath.Rel(root, sessionFile); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(sessionFile)
+}
+
+// readFeeders reads the CSV file for every feed, keeping only the rows in
+// the partition
+func readFeeders(specs feeds, partition korra.Partition) (korra.Feeders, error) {
+	feeders := korra.Feeders{}
+	for name, spec := range specs {
+		if name == korra.VarsFeed {
+			return nil, fmt.Errorf("feed can't be named %s, which is for vars", name)
+		}
+		if name == korra.SecretsFeed {
+			return nil, fmt.Errorf("feed can't be named %s, which is for -secret values", name)
+		}
+		feedFile, err := korra.File(spec.path, false)
+		if err != nil {
+			return nil, fmt.Errorf("error opening %s: %s", spec.path, err)
+		}
+		feeders[name], err = korra.NewFeeder(name, spec.policy, feedFile, partition)
+		feedFile.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return feeders, nil
+}
+
+// secretSources are the -secret flags, each resolved as it's given, and the
+// sources they were resolved from, which are all that's recorded of them
+type secretSources struct {
+	*korra.Secrets
+	sources map[string]string
+}
+
+var secretNameRegexp = regexp.MustCompile(`^\w+$`)
+
+func (s secretSources) String() string {
+	specs := make([]string, 0, len(s.sources))
+	for name, source := range s.sources {
+		specs = append(specs, fmt.Sprintf("%s=%s", name, source))
+	}
+	sort.Strings(specs)
+	return strings.Join(specs, ",")
+}
+
+func (s secretSources) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	name := strings.TrimSpace(parts[0])
+	if len(parts) != 2 || !secretNameRegexp.MatchString(name) {
+		return fmt.Errorf("secret '%s' has a wrong format, expected name=source", value)
+	}
+	source := strings.TrimSpace(parts[1])
+	if err := s.Add(name, source); err != nil {
+		return err
+	}
+	s.sources[name] = source
+	return nil
+}
+
 // headers is the http.Header used in each target request
 // it is defined here to implement the flag.Value interface
 // in order to support multiple identical flags for request header
@@ -191,6 +959,133 @@ func (h headers) Set(value string) error {
 	return nil
 }
 
+// dnsPins implements the flag.Value interface so hosts can be pinned to
+// addresses with multiple flags
+type dnsPins map[string]string
+
+func (p dnsPins) String() string {
+	pins := make([]string, 0, len(p))
+	for host, addr := range p {
+		pins = append(pins, fmt.Sprintf("%s=%s", host, addr))
+	}
+	return strings.Join(pins, ",")
+}
+
+func (p dnsPins) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	host := strings.TrimSpace(parts[0])
+	if host == "" {
+		return fmt.Errorf("DNS pin '%s' has a wrong format", value)
+	}
+	p[host] = ""
+	if len(parts) == 2 {
+		addr := strings.TrimSpace(parts[1])
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf("DNS pin '%s' has an invalid address", value)
+		}
+		p[host] = addr
+	}
+	return nil
+}
+
+// feeds implements the flag.Value interface so multiple feeds can be given
+// with multiple flags
+type feeds map[string]feedSpec
+
+type feedSpec struct {
+	path   string
+	policy string
+}
+
+func (f feeds) String() string {
+	specs := make([]string, 0, len(f))
+	for name, spec := range f {
+		specs = append(specs, fmt.Sprintf("%s=%s:%s", name, spec.path, spec.policy))
+	}
+	return strings.Join(specs, ",")
+}
+
+func (f feeds) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("feed '%s' has a wrong format", value)
+	}
+	spec := feedSpec{path: strings.TrimSpace(parts[1]), policy: korra.FeedStop}
+	if idx := strings.LastIndex(spec.path, ":"); idx >= 0 {
+		spec.path, spec.policy = spec.path[:idx], spec.path[idx+1:]
+	}
+	if spec.path == "" {
+		return fmt.Errorf("feed '%s' has a wrong format", value)
+	}
+	f[strings.TrimSpace(parts[0])] = spec
+	return nil
+}
+
+// phaseDirs implements the flag.Value interface for the directories of the
+// sessions of each phase after the first, in order
+type phaseDirs []string
+
+func (p *phaseDirs) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *phaseDirs) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// cpuGroups implements the flag.Value interface so sessions can be pinned
+// to groups of CPUs given with multiple flags
+type cpuGroups []korra.CPUSet
+
+func (g *cpuGroups) String() string {
+	groups := make([]string, len(*g))
+	for idx, group := range *g {
+		groups[idx] = group.String()
+	}
+	return strings.Join(groups, "; ")
+}
+
+func (g *cpuGroups) Set(value string) error {
+	if value == "numa" {
+		nodes, err := korra.NUMANodes()
+		if err != nil {
+			return err
+		}
+		*g = append(*g, nodes...)
+		return nil
+	}
+	group, err := korra.ParseCPUSet(value)
+	if err != nil {
+		return err
+	}
+	*g = append(*g, group)
+	return nil
+}
+
+var errNoPinning = errors.New("-pin needs Linux to pin threads to CPUs")
+
+// weightedTargets implements the flag.Value interface so sessions can be
+// balanced across targets given with multiple flags
+type weightedTargets []korra.WeightedTarget
+
+func (t *weightedTargets) String() string {
+	targets := make([]string, len(*t))
+	for idx, target := range *t {
+		targets[idx] = target.String()
+	}
+	return strings.Join(targets, ",")
+}
+
+func (t *weightedTargets) Set(value string) error {
+	target, err := korra.ParseWeightedTarget(strings.TrimSpace(value))
+	if err != nil {
+		return err
+	}
+	*t = append(*t, target)
+	return nil
+}
+
 // localAddr implements the Flag interface for parsing net.IPAddr
 type localAddr struct{ *net.IPAddr }
 
@@ -200,7 +1095,7 @@ func (ip *localAddr) Set(value string) (err error) {
 }
 
 func setupTLS(filename string) (*tls.Config, error) {
-	tlsc := *korra.DefaultTLSConfig
+	tlsc := korra.DefaultTLSConfig.Clone()
 	if filename != "" {
 		certf, err := korra.File(filename, false)
 		if err != nil {
@@ -214,7 +1109,7 @@ func setupTLS(filename string) (*tls.Config, error) {
 			return nil, err
 		}
 	}
-	return &tlsc, nil
+	return tlsc, nil
 }
 
 // certPool returns a new *x509.CertPool with the passed cert included.
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+// snapshots reports on an attack while it runs, from what its sessions have
+// recorded so far, so there's a report even if the run is cut short. Each is
+// written to the directory, if there is one, and the latest is kept for the
+// control API.
+type snapshots struct {
+	files    []string
+	notes    string // the annotations file
+	scrapes  string // the file of the target's scraped metrics, if it's scraped
+	reporter korra.Reporter
+	dir      string
+	ext      string
+	log      chan string
+
+	mu     sync.Mutex
+	taking bool
+	latest []byte
+}
+
+func newSnapshots(opts *sessionsOpts, sessions []*korra.Session, log chan string) (*snapshots, error) {
+	reporter, err := chooseReporter(&reportOpts{reporter: opts.snapshotRep, scrapeWin: defaultScrapeWindow})
+	if err != nil {
+		return nil, fmt.Errorf("bad -snapshot-reporter: %s", err)
+	}
+	if opts.snapshotDir != "" {
+		if err = os.MkdirAll(opts.snapshotDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	s := &snapshots{reporter: reporter, dir: opts.snapshotDir, ext: ".txt", log: log}
+	if opts.snapshotRep == "json" {
+		s.ext = ".json"
+	}
+	s.notes = korra.AnnotationsPath(opts.sessiond)
+	if opts.scrapeURL != "" {
+		s.scrapes = korra.ScrapesPath(opts.sessiond)
+	}
+	for _, session := range sessions {
+		s.files = append(s.files, korra.ResultPath(session.Path))
+	}
+	return s, nil
+}
+
+// take takes a snapshot, unless the last is still being taken
+func (s *snapshots) take(now time.Time) {
+	s.mu.Lock()
+	if s.taking {
+		s.mu.Unlock()
+		return
+	}
+	s.taking = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.taking = false
+		s.mu.Unlock()
+	}()
+
+	count, report, err := s.report()
+	if err != nil {
+		s.log <- fmt.Sprintf("Snapshot failed: %s", err)
+		return
+	}
+	s.mu.Lock()
+	s.latest = report
+	s.mu.Unlock()
+	if s.dir == "" {
+		s.log <- fmt.Sprintf("Snapshot of %d results taken", count)
+		return
+	}
+	name := filepath.Join(s.dir, "snapshot-"+now.Format("20060102T150405")+s.ext)
+	if err = ioutil.WriteFile(name, report, 0644); err != nil {
+		s.log <- fmt.Sprintf("Snapshot failed: %s", err)
+		return
+	}
+	s.log <- fmt.Sprintf("Snapshot of %d results written to %s", count, name)
+}
+
+// report reports on the results recorded so far; the last result of a file
+// may be only partly written, which is as far as the file goes for now
+func (s *snapshots) report() (int, []byte, error) {
+	var (
+		srcs  []io.Reader
+		files []string
+	)
+	for _, file := range s.files {
+		in, err := os.Open(file)
+		if err != nil {
+			continue // its session hasn't started recording
+		}
+		defer in.Close()
+		srcs = append(srcs, in)
+		files = append(files, file)
+	}
+	metadata, err := readMetadata(files)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var results korra.Results
+	res, errs := korra.MergeResults(srcs...)
+	for batch := range res {
+		results = append(results, batch...)
+	}
+	for err := range errs {
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, err
+		}
+	}
+	if !sort.IsSorted(results) {
+		sort.Sort(results)
+	}
+	annotations, err := readAnnotations(s.notes, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	var scrapes []korra.ScrapeSample
+	if s.scrapes != "" {
+		if scrapes, err = readScrapes(s.scrapes, nil); err != nil {
+			return 0, nil, err
+		}
+	}
+	report, err := describeAttack(s.reporter, metadata, annotations, scrapes, false).Report(results)
+	return len(results), report, err
+}
+
+// Latest returns the latest snapshot, or nil if none has been taken
+func (s *snapshots) Latest() []byte {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest
+}
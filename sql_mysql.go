@@ -0,0 +1,7 @@
+//go:build mysql
+// +build mysql
+
+package main
+
+// the MySQL driver for SQL steps, linked in with -tags mysql
+import _ "github.com/go-sql-driver/mysql"
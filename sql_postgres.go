@@ -0,0 +1,7 @@
+//go:build postgres
+// +build postgres
+
+package main
+
+// the Postgres driver for SQL steps, linked in with -tags postgres
+import _ "github.com/lib/pq"
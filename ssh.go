@@ -0,0 +1,99 @@
+//go:build ssh
+// +build ssh
+
+package main
+
+// the SSH client for SFTP and SSH steps, linked in with -tags ssh
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+func init() {
+	korra.SFTPDialer = dialSFTP
+	korra.SSHRunner = runSSH
+}
+
+// sftpClient is an SFTP session, and the SSH connection it's over
+type sftpClient struct {
+	*sftp.Client
+	conn *ssh.Client
+}
+
+func (c *sftpClient) Open(path string) (io.ReadCloser, error) {
+	return c.Client.Open(path)
+}
+
+func (c *sftpClient) Create(path string) (io.WriteCloser, error) {
+	return c.Client.Create(path)
+}
+
+func (c *sftpClient) Close() error {
+	c.Client.Close()
+	return c.conn.Close()
+}
+
+// dialSSH logs in over conn with the password, or the private key if it's
+// given one, not checking the server's host key as the attacker doesn't
+// check certificates by default either
+func dialSSH(conn net.Conn, addr, user, password string, key []byte) (*ssh.Client, error) {
+	auth := ssh.Password(password)
+	if key != nil {
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		auth = ssh.PublicKeys(signer)
+	}
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+func dialSFTP(conn net.Conn, addr, user, password string) (korra.SFTPClient, error) {
+	client, err := dialSSH(conn, addr, user, password, nil)
+	if err != nil {
+		return nil, err
+	}
+	session, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &sftpClient{Client: session, conn: client}, nil
+}
+
+// runSSH runs the command in a session of its own, returning how it exited
+// rather than an error if it exits other than 0
+func runSSH(conn net.Conn, addr, user, password string, key []byte, command string) ([]byte, int, error) {
+	client, err := dialSSH(conn, addr, user, password, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer session.Close()
+	output, err := session.CombinedOutput(command)
+	var exit *ssh.ExitError
+	if errors.As(err, &exit) {
+		return output, exit.ExitStatus(), nil
+	}
+	return output, 0, err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+func tailCmd() command {
+	fs := flag.NewFlagSet("korra tail", flag.ExitOnError)
+	every := fs.Duration("every", 5*time.Second, "Width of the windows to print metrics for")
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			return errNoTailFile
+		}
+		return tail(fs.Arg(0), *every)
+	}}
+}
+
+var errNoTailFile = errors.New("give the result file to follow, like: korra tail results/user_4512.bin")
+
+// tail follows a result file as a running attack records it, printing the
+// metrics of the results so far and then of each window as they come in,
+// until it's interrupted
+func tail(file string, every time.Duration) error {
+	in, err := korra.File(file, false)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	follower := korra.NewFollower(in, every/10)
+	reader, _ := korra.NewResultReader(korra.ResultEncoding, follower)
+
+	results, errs := make(chan *korra.Result), make(chan error, 1)
+	go func() {
+		defer close(results)
+		for {
+			r, err := reader.Read()
+			if err != nil {
+				if err != io.EOF {
+					errs <- err
+				}
+				return
+			}
+			results <- r
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	var (
+		ticks    <-chan time.Time
+		caughtUp = follower.CaughtUp()
+		window   korra.Results
+		start    = time.Now()
+	)
+	for {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				return nil
+			}
+			if r.Metadata != nil {
+				fmt.Printf("Following %s: %s\n", file, r.Metadata)
+				continue
+			}
+			window = append(window, r)
+		case <-caughtUp:
+			caughtUp = nil
+			fmt.Println(tailLine("so far", window, 0))
+			window, start = nil, time.Now()
+			ticker := time.NewTicker(every)
+			defer ticker.Stop()
+			ticks = ticker.C
+		case now := <-ticks:
+			fmt.Println(tailLine(now.Format("15:04:05"), window, now.Sub(start)))
+			window, start = nil, now
+		case err := <-errs:
+			return fmt.Errorf("following %s: %s", file, err)
+		case <-sig:
+			follower.Stop()
+			if caughtUp == nil {
+				fmt.Println(tailLine(time.Now().Format("15:04:05"), window, time.Since(start)))
+			}
+			return nil
+		}
+	}
+}
+
+// tailLine summarizes the results in a line, with their rate over the time
+// they came in if it's given
+func tailLine(label string, r korra.Results, over time.Duration) string {
+	m := korra.NewMetrics(r)
+	rate := ""
+	if over > 0 {
+		rate = fmt.Sprintf(" (%.1f/s)", float64(m.Requests)/over.Seconds())
+	}
+	if m.Requests == 0 {
+		return fmt.Sprintf("%-8s  %6d results%s", label, 0, rate)
+	}
+	return fmt.Sprintf("%-8s  %6d results%s  success %6.2f%%  mean %s  50th %s  95th %s  99th %s  max %s  errors %d",
+		label, m.Requests, rate, m.Success*100, readable(m.Latencies.Mean), readable(m.Latencies.P50),
+		readable(m.Latencies.P95), readable(m.Latencies.P99), readable(m.Latencies.Max), len(m.Errors))
+}
+
+// readable rounds a latency to a precision that's easy to read in a line
+func readable(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -54,6 +54,12 @@ func validateScript(scriptFile string, verbose bool) ([]string, int) {
 		}
 		if verbose {
 			message := fmt.Sprintf("%d: ", action.Line)
+			if action.Hook != "" {
+				message += fmt.Sprintf("(%s) ", action.Hook)
+			}
+			if action.Chance != nil {
+				message += fmt.Sprintf("(%s) ", action.Chance)
+			}
 			if action.Error != nil {
 				message += fmt.Sprintf("INVALID %s", action.Error)
 			} else {
@@ -62,6 +68,66 @@ func validateScript(scriptFile string, verbose bool) ([]string, int) {
 					message += fmt.Sprintf("INFO => %s", target.Comment)
 				} else if target.PauseTime > 0 {
 					message += fmt.Sprintf("PAUSE for %d ms", target.PauseTime)
+				} else if target.IsConnections() {
+					message += fmt.Sprintf("CONNECTIONS %s from here on", target.Connections)
+				} else if target.IsFeed() {
+					message += fmt.Sprintf("FEED a row from %s", target.Feed)
+				} else if target.IsVar() {
+					message += fmt.Sprintf("VAR %s", target.Var)
+				} else if target.IsBarrier() {
+					message += fmt.Sprintf("%s, waiting for that many sessions", target.Barrier)
+				} else if target.IsSQL() {
+					message += fmt.Sprintf("%s [SQL: %s]", target, target.SQL)
+					if target.Limit.Active() {
+						message += fmt.Sprintf(" [Limit: %s]", target.Limit)
+					}
+					if target.Timeouts.Active() {
+						message += fmt.Sprintf(" [Timeouts: %s]", target.Timeouts)
+					}
+				} else if target.IsPublish() {
+					message += fmt.Sprintf("%s [Publish: %s]", target, target.Publish)
+					if target.Limit.Active() {
+						message += fmt.Sprintf(" [Limit: %s]", target.Limit)
+					}
+					if target.Timeouts.Active() {
+						message += fmt.Sprintf(" [Timeouts: %s]", target.Timeouts)
+					}
+				} else if target.IsSMTP() || target.IsIMAP() {
+					if target.IsSMTP() {
+						message += fmt.Sprintf("%s [SMTP: %s] [Headers: %d] [Body? %t]", target, target.SMTP, len(target.Header), target.BodyPath != "")
+					} else {
+						message += fmt.Sprintf("%s [IMAP: %s]", target, target.IMAP)
+					}
+					if target.Limit.Active() {
+						message += fmt.Sprintf(" [Limit: %s]", target.Limit)
+					}
+					if target.Timeouts.Active() {
+						message += fmt.Sprintf(" [Timeouts: %s]", target.Timeouts)
+					}
+				} else if target.IsDNS() || target.IsLDAP() || target.IsFTP() || target.IsSSH() {
+					if target.IsDNS() {
+						message += fmt.Sprintf("%s [DNS: %s]", target, target.DNS)
+					} else if target.IsLDAP() {
+						message += fmt.Sprintf("%s [LDAP: %s]", target, target.LDAP)
+					} else if target.IsFTP() {
+						message += fmt.Sprintf("%s [FTP: %s] [Body? %t]", target, target.FTP, target.BodyPath != "")
+					} else {
+						message += fmt.Sprintf("%s [SSH: %s]", target, target.SSH)
+					}
+					if target.Limit.Active() {
+						message += fmt.Sprintf(" [Limit: %s]", target.Limit)
+					}
+					if target.Timeouts.Active() {
+						message += fmt.Sprintf(" [Timeouts: %s]", target.Timeouts)
+					}
+				} else if target.IsKV() {
+					message += fmt.Sprintf("%s [KV: %s]", target, target.KV)
+					if target.Limit.Active() {
+						message += fmt.Sprintf(" [Limit: %s]", target.Limit)
+					}
+					if target.Timeouts.Active() {
+						message += fmt.Sprintf(" [Timeouts: %s]", target.Timeouts)
+					}
 				} else {
 					pollingMessage := "NO"
 					if target.Poller.Active {
@@ -69,6 +135,33 @@ func validateScript(scriptFile string, verbose bool) ([]string, int) {
 					}
 					message += fmt.Sprintf("%s %s [Headers: %d] [Body? %t] [Polling? %s]",
 						target.Method, target.URL, len(target.Header), target.BodyPath != "", pollingMessage)
+					if target.IsStream() {
+						message += fmt.Sprintf(" [Stream: %s]", target.Stream)
+					}
+					if target.IsLongPoll() {
+						message += fmt.Sprintf(" [Long poll: %s]", target.LongPoll)
+					}
+					if target.IsRanges() {
+						message += fmt.Sprintf(" [Ranges: %s]", target.Ranges)
+					}
+					if target.IsPlayback() {
+						message += fmt.Sprintf(" [Playback: %s]", target.Playback)
+					}
+					if target.IsCrawl() {
+						message += fmt.Sprintf(" [Crawl: %s]", target.Crawl)
+					}
+					if target.Limit.Active() {
+						message += fmt.Sprintf(" [Limit: %s]", target.Limit)
+					}
+					if target.Timeouts.Active() {
+						message += fmt.Sprintf(" [Timeouts: %s]", target.Timeouts)
+					}
+					for _, save := range target.Saves {
+						message += fmt.Sprintf(" [Save: %s]", save)
+					}
+					if target.Checksum != nil {
+						message += fmt.Sprintf(" [Checksum: %s]", target.Checksum)
+					}
 				}
 			}
 			messages = append(messages, message)
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+// webhookLimit is the most of a posted event read; deploy and alert events
+// are well under it
+const webhookLimit = 1 << 20
+
+// webhook takes events from other systems, like deploy pipelines and chaos
+// tools, while an attack runs, annotating the attack with each
+type webhook struct {
+	secret string // the events must carry, if any (see korra.WebhookAuthorized)
+	notes  *korra.AnnotationLog
+	log    chan string
+}
+
+// serveWebhook starts taking events posted to any path on the address
+func serveWebhook(addr string, w *webhook) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error starting webhook on %s: %s", addr, err)
+	}
+	go http.Serve(listener, w)
+	w.log <- fmt.Sprintf("Webhook listening on %s", listener.Addr())
+	return listener, nil
+}
+
+func (w *webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(rw, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, webhookLimit))
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("error reading event: %s", err), http.StatusBadRequest)
+		return
+	}
+	if !korra.WebhookAuthorized(w.secret, r.Header, body) {
+		w.log <- fmt.Sprintf("Webhook refused an event from %s without the secret", r.RemoteAddr)
+		http.Error(rw, "missing or wrong secret", http.StatusUnauthorized)
+		return
+	}
+	annotations, err := korra.WebhookAnnotations(body, r.Header, fmt.Sprintf("webhook (%s)", r.RemoteAddr))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// the whole event is checked before any of it's added, so one that's
+	// refused can be posted again once it's fixed
+	added, err := w.notes.AddAll(annotations)
+	for _, annotation := range added {
+		w.log <- fmt.Sprintf("Annotated by %s: %s", annotation.By, annotation.Text)
+	}
+	if err != nil && added == nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(rw, fmt.Sprintf("error writing annotations, added the first %d of %d: %s", len(added), len(annotations), err), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+	json.NewEncoder(rw).Encode(added)
+}